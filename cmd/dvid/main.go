@@ -35,6 +35,7 @@ import (
 	_ "github.com/janelia-flyem/dvid/datatype/labelmap"
 	_ "github.com/janelia-flyem/dvid/datatype/labelsz"
 	_ "github.com/janelia-flyem/dvid/datatype/labelvol"
+	_ "github.com/janelia-flyem/dvid/datatype/multichan"
 	_ "github.com/janelia-flyem/dvid/datatype/multichan16"
 	_ "github.com/janelia-flyem/dvid/datatype/roi"
 	_ "github.com/janelia-flyem/dvid/datatype/tarsupervoxels"
@@ -55,6 +55,13 @@ $ dvid repo <UUID> new annotation <data name> <settings...>
     UUID           Hexadecimal string with enough characters to uniquely identify a version node.
     data name      Name of data to create, e.g., "synapses"
     settings       Configuration settings in "key=value" format separated by spaces.
+
+    Configuration Settings (case-insensitive keys)
+
+    IndexedProps   Comma-separated list of element property names to index for value queries.
+    Validation     Relationship validation mode for mutations: "off" (default), "warn", or "strict".
+    ElementKinds   Comma-separated list of custom element kinds, e.g., "Mito,SomaCenter".
+    RelationTypes  Comma-separated list of custom relation types, e.g., "InsideOf".
 	
 $ dvid node <UUID> <data name> reload <settings...>
 
@@ -178,6 +185,172 @@ GET <api URL>/node/<UUID>/<data name>/roi/<ROI specification>
 
 	The returned point annotations will be an array of elements.
 
+GET <api URL>/node/<UUID>/<data name>/connections[?<options>]
+
+	Returns weighted body-to-body connections, where each connection is the number of
+	PreSynTo relationships from PreSyn elements in the "Pre" body to elements in the "Post"
+	body.  This endpoint is only available if the annotation data instance is synced with
+	voxel label data instances (labelblk, labelarray, labelmap).  Connections are kept in
+	an index that is updated as annotations are modified and labels are merged or split.
+
+	If no query options are given, all connections are streamed in pre then post label order.
+	The returned JSON is an array of connections:
+
+	[
+		{ "Pre": 23, "Post": 35, "Weight": 12 },
+		{ "Pre": 23, "Post": 81, "Weight": 3 },
+		...
+	]
+
+	GET Query-string Options:
+
+	pre         Comma-separated list of labels.  Only connections from these labels are returned.
+	post        Comma-separated list of labels.  Only connections into these labels are returned.
+	roi         ROI specification as "roiname,uuid" or just "roiname" for the current UUID.
+	              Connections are computed from the PreSyn elements within the ROI and not
+	              from the index.  The ROI must have the same block size as the annotations.
+
+	Example:
+
+	GET http://foo.com/api/node/83af/myannotations/connections?pre=23&post=35,81
+
+GET <api URL>/node/<UUID>/<data name>/prop/<property name>?<options>
+
+	Returns all point annotations with a value for the given property that matches a value
+	or falls within an inclusive range.  The property must be indexed, either through the
+	"IndexedProps" setting on creation or the "indexed-props" endpoint.  Property values
+	that are numbers are compared numerically and precede all string values, which are
+	compared lexicographically.
+
+	The returned point annotations will be an array of elements with relationships in order
+	of increasing property value.
+
+	GET Query-string Options (either value or a min and/or max is required):
+
+	value       Return elements with exactly this property value.
+	min         Return elements with property value greater than or equal to min.
+	max         Return elements with property value less than or equal to max.
+
+	If the min and max given are numbers, only numeric property values are returned.
+
+	Example:
+
+	GET http://foo.com/api/node/83af/myannotations/prop/conf?min=0.9
+
+GET  <api URL>/node/<UUID>/<data name>/indexed-props
+POST <api URL>/node/<UUID>/<data name>/indexed-props
+
+	Gets or sets the property names that are indexed as a JSON array of strings, e.g.,
+	["user", "conf"].  A POST replaces the indexed property names and rebuilds the property
+	index for the given version by reading all annotations.  The POST only applies to the
+	given version, which must be unlocked, and to child versions created afterwards.  Other
+	versions keep their own indexed property names, and property queries on a version
+	without an index for the property are rejected.
+
+GET  <api URL>/node/<UUID>/<data name>/kinds
+POST <api URL>/node/<UUID>/<data name>/kinds
+
+	Gets or adds the custom element kinds and relation types allowed for this instance in
+	addition to the built-in kinds (PostSyn, PreSyn, Gap, Note) and relation types (PostSynTo,
+	PreSynTo, ConvergentTo, GroupedWith).  The JSON is of the form:
+
+	{
+		"ElementKinds": ["Mito", "SomaCenter"],
+		"RelationTypes": ["InsideOf"]
+	}
+
+	A POST adds any new names to the current lists.  Names can only use letters, digits,
+	'_', and '-', and names cannot be removed.  Custom kinds and relation types can also be
+	set with the "ElementKinds" and "RelationTypes" settings on creation.  POSTed elements
+	using custom kinds or relation types not registered for this instance are rejected.
+	Custom kinds are not synaptic, and custom relation types are their own reciprocal for
+	validation.  Synced labelsz instances index each custom kind by its name.
+
+GET  <api URL>/node/<UUID>/<data name>/validation
+POST <api URL>/node/<UUID>/<data name>/validation
+
+	Gets or sets the relationship validation mode for mutations as JSON, e.g.,
+	{"Mode": "strict"}.  The mode can also be set with the "Validation" setting on creation.
+
+	off         No validation (default).
+	warn        Violations are logged but the mutation proceeds.
+	strict      Mutations with violations are rejected with an error.
+
+	Validation checks that every relationship in POSTed elements has an element at its
+	target with the reciprocal relationship (PreSynTo and PostSynTo are reciprocal, while
+	ConvergentTo and GroupedWith are their own reciprocal), that POSTed positions are not
+	duplicated, and that a replaced element does not drop relationships its partners keep.
+	Moves cannot place an element onto another element, and deletes are checked for
+	relationships between the deleted element and its partners that are not reciprocated.
+	Since a partner's relationship to the deleted element may not be reciprocated, all
+	elements are scanned on delete, and in warn mode such relationships are removed along
+	with the deleted element.  Mutations are applied one at a time while validation is on.
+
+GET <api URL>/node/<UUID>/<data name>/integrity
+
+	Scans all elements and returns a JSON report of orphaned relationships (no element at
+	the target), asymmetric relationships (target lacks the reciprocal relationship),
+	duplicate positions, and elements stored outside the block containing their position.
+
+	Returned JSON:
+
+	{
+		"NumElements": 1031,
+		"OrphanedRels": [{"Pos": [10, 20, 30], "Rel": "PreSynTo", "To": [11, 20, 30]}, ...],
+		"AsymmetricRels": [{"Pos": [15, 22, 30], "Rel": "GroupedWith", "To": [14, 25, 37]}, ...],
+		"DuplicatePositions": [[1, 2, 3], ...],
+		"MisplacedElements": [{"Pos": [40, 2, 3], "Block": [0, 0, 0]}, ...]
+	}
+
+GET <api URL>/node/<UUID>/<data name>/nearest/<coord>[?<options>]
+
+	Returns the point annotations nearest to the given coordinate, e.g., "40_3_122",
+	sorted by increasing distance.  The search proceeds outward over blocks of annotations
+	until the nearest elements are found or the maximum distance is reached, so fewer than
+	the requested number of elements can be returned.
+
+	The returned point annotations will be an array of elements with relationships, where each
+	element has an additional "Distance" property giving its distance from the coordinate.
+	Distances are in voxels unless "voxelsize" or "physical" is given, in which case they are
+	in the units of the voxel size, e.g., nanometers.  A search covering more than 2097152 blocks
+	of annotations is rejected.
+
+	GET Query-string Options:
+
+	k           Number of nearest elements to return.  Default is 1.
+	kind        Only return elements of this kind, e.g., "PreSyn".
+	tag         Only return elements with this tag.
+	maxdist     Maximum distance to search.  Default is 1000 voxels.
+	voxelsize   Voxel size, e.g., "8_8_40", so distances are in physical units.
+	physical    If "true", distances are in the physical units of the synced label data's
+	              resolution unless "voxelsize" is given.
+
+	Example:
+
+	GET http://foo.com/api/node/83af/myannotations/nearest/40_3_122?k=10&kind=PreSyn
+
+GET <api URL>/node/<UUID>/<data name>/radius/<coord>/<radius>[?<options>]
+
+	Returns all point annotations within the given radius of a coordinate, sorted by increasing
+	distance.  The returned point annotations will be an array of elements with relationships,
+	where each element has an additional "Distance" property giving its distance from the
+	coordinate.  The radius and distances are in voxels unless "voxelsize" or "physical" is
+	given, in which case they are in the units of the voxel size.  A radius covering more than
+	2097152 blocks of annotations is rejected.
+
+	GET Query-string Options:
+
+	kind        Only return elements of this kind, e.g., "PreSyn".
+	tag         Only return elements with this tag.
+	voxelsize   Voxel size, e.g., "8_8_40", so distances are in physical units.
+	physical    If "true", distances are in the physical units of the synced label data's
+	              resolution unless "voxelsize" is given.
+
+	Example:
+
+	GET http://foo.com/api/node/83af/myannotations/radius/40_3_122/60?tag=goodstuff
+	GET http://foo.com/api/node/83af/myannotations/radius/40_3_122/500?physical=true
+
 GET <api URL>/node/<UUID>/<data name>/elements/<size>/<offset>
 
 	Returns all point annotations within subvolume of given size with upper left corner
@@ -228,6 +401,124 @@ GET <api URL>/node/<UUID>/<data name>/blocks/<size>/<offset>
 		...
 	}
 
+GET  <api URL>/node/<UUID>/<data name>/all[?<options>]
+POST <api URL>/node/<UUID>/<data name>/all[?<options>]
+
+	Streams all point annotations or ingests point annotations in bulk.  This is faster to
+	parse than the /blocks JSON for whole-dataset analysis.  A POST adds or modifies the
+	given elements in a single batch, like the /elements endpoint, so synced data receives
+	one notification for the whole POST.
+
+	Supported formats:
+
+	ndjson      One JSON element with relationships per line.  If labels or supervoxels are
+	            requested, each element has an additional "Label" or "Supervoxel" property.
+	csv         A header row followed by one row per element with columns x, y, z, kind,
+	            tags, props, rels, and optionally label and supervoxel.  Tags are separated
+	            by semicolons, with any semicolon or backslash within a tag escaped by a
+	            backslash, and props and rels are JSON.  On POST, only the x, y, z, and
+	            kind columns are required and column order is taken from the header.
+	arrow       An Apache Arrow IPC stream with int32 x, y, z columns, a utf8 kind column,
+	            a list of utf8 tags column, nullable utf8 props and rels columns holding
+	            JSON, and optionally uint64 label and supervoxel columns.  On POST, only the
+	            x, y, z, and kind columns are required, coordinates may be any integer type
+	            with values in the int32 range, and other columns are ignored.  The kind,
+	            props, and rels columns may be utf8 or large_utf8, optionally dictionary
+	            encoded, and tags may be a list or large_list of utf8.  LZ4 and ZSTD
+	            compressed record batches are accepted.  The Arrow file format (with its
+	            footer), null coordinates or kinds, and any other column types, e.g.,
+	            floating point coordinates or binary strings, are not supported.
+
+	Any label or supervoxel fields in POSTed data are ignored.
+
+	Query-string Options:
+
+	format      "csv", "arrow", or "ndjson" (default).
+	labels      (GET only) Set to "true" to add the synced label at each element.
+	supervoxels (GET only) Set to "true" to add the synced supervoxel at each element.
+	kafkalog    (POST only) Set to "off" if you don't want this mutation logged to kafka.
+
+	Example:
+
+	GET http://foo.com/api/node/83af/myannotations/all?format=csv&labels=true
+
+GET  <api URL>/node/<UUID>/<data name>/shapes/<size>/<offset>
+POST <api URL>/node/<UUID>/<data name>/shapes[?<options>]
+
+	Returns all shapes intersecting the subvolume of given size with upper left corner at
+	given offset, or adds or replaces shapes.  Shapes are spatial primitives stored alongside
+	point annotations and indexed by the blocks they intersect:
+
+	Polyline    "Points" is an array of at least 2 vertices joined by line segments.
+	Box         "Min" and "Max" are the inclusive corners of an axis-aligned box.
+	Ellipsoid   "Center" is a point and "Radii" are the 3 positive radii in voxels.
+
+	Each shape is identified by a unique "ID".  A POSTed shape without an ID is added and
+	assigned a new ID, while a POSTed shape with the ID of a stored shape replaces it.  The
+	POST returns a JSON array of the IDs of the POSTed shapes in order.  Each shape also has
+	an anchor, which is the first point of a polyline or the center of a box or ellipsoid.
+	If the annotation is synced to label data, the "Label" of each shape is the label at its
+	anchor and is kept current through merges, cleaves, and splits.
+
+	Example shapes JSON:
+
+	[
+		{
+			"Kind": "Polyline",
+			"Points": [[10,20,30], [40,20,30], [40,80,35]],
+			"Tags": ["trace"],
+			"Prop": {"user": "bob"}
+		},
+		{
+			"Kind": "Box",
+			"Min": [100,100,100],
+			"Max": [150,120,130]
+		},
+		{
+			"Kind": "Ellipsoid",
+			"Center": [500,500,500],
+			"Radii": [20,10,5.5]
+		}
+	]
+
+	Returned shapes also have an "ID", an "Anchor", and, if synced, a "Label".
+
+	Kafka JSON message generated by a POST:
+		{ 
+			"Action": "shape-post",
+			"Shapes": <array of stored shapes>,
+			"UUID": <UUID on which POST was done>
+		}
+
+	POST Query-string Options:
+
+	kafkalog    Set to "off" if you don't want this mutation logged to kafka.
+
+GET <api URL>/node/<UUID>/<data name>/shapes-roi/<ROI specification>
+
+	Returns all shapes intersecting blocks of the given ROI.  The ROI specification must be
+	of the form "<roiname>,<uuid>" or just "<roiname>" as for the /roi endpoint, and the ROI
+	must have the same block size as this annotation.
+
+GET <api URL>/node/<UUID>/<data name>/shapes-label/<label>
+
+	Returns all shapes whose anchor is within the given label of the synced label data.
+
+DELETE <api URL>/node/<UUID>/<data name>/shape/<id>[?<options>]
+
+	Deletes the shape with the given ID.
+
+	Kafka JSON message generated by this request:
+		{ 
+			"Action": "shape-delete",
+			"ID": <shape ID>,
+			"UUID": <UUID on which delete was done>
+		}
+
+	POST Query-string Options:
+
+	kafkalog    Set to "off" if you don't want this mutation logged to kafka.
+
 POST <api URL>/node/<UUID>/<data name>/move/<from_coord>/<to_coord>[?<options>]
 
 	Moves the point annotation from <from_coord> to <to_coord> where
@@ -347,8 +638,18 @@ func (e ElementType) IsSynaptic() bool {
 	}
 }
 
-// StringToElementType converts a string
+// StringToElementType converts a string, which can be a registered custom kind.
 func StringToElementType(s string) ElementType {
+	if e := builtinElementType(s); e != UnknownElem {
+		return e
+	}
+	if e, found := customElementType(s); found {
+		return e
+	}
+	return UnknownElem
+}
+
+func builtinElementType(s string) ElementType {
 	switch s {
 	case "PostSyn":
 		return PostSyn
@@ -374,6 +675,9 @@ func (e ElementType) String() string {
 	case Note:
 		return "Note"
 	default:
+		if name, found := customElementName(e); found {
+			return name
+		}
 		return fmt.Sprintf("Unknown element type: %d", e)
 	}
 }
@@ -391,6 +695,9 @@ func (e ElementType) MarshalJSON() ([]byte, error) {
 	case Note:
 		return []byte(`"Note"`), nil
 	default:
+		if name, found := customElementName(e); found {
+			return json.Marshal(name)
+		}
 		return nil, fmt.Errorf("Unknown element type: %s", e)
 	}
 }
@@ -408,6 +715,13 @@ func (e *ElementType) UnmarshalJSON(b []byte) error {
 	case `"Note"`:
 		*e = Note
 	default:
+		var name string
+		if err := json.Unmarshal(b, &name); err == nil {
+			if custom, found := customElementType(name); found {
+				*e = custom
+				return nil
+			}
+		}
 		return fmt.Errorf("Unknown element type in JSON: %s", string(b))
 	}
 	return nil
@@ -436,10 +750,28 @@ func (r RelationType) MarshalJSON() ([]byte, error) {
 	case GroupedWith:
 		return []byte(`"GroupedWith"`), nil
 	default:
+		if name, found := customRelationName(r); found {
+			return json.Marshal(name)
+		}
 		return nil, fmt.Errorf("Unknown relation type: %d", r)
 	}
 }
 
+func builtinRelationType(s string) RelationType {
+	switch s {
+	case "PostSynTo":
+		return PostSynTo
+	case "PreSynTo":
+		return PreSynTo
+	case "ConvergentTo":
+		return ConvergentTo
+	case "GroupedWith":
+		return GroupedWith
+	default:
+		return UnknownRel
+	}
+}
+
 func (r *RelationType) UnmarshalJSON(b []byte) error {
 	switch string(b) {
 	case `"UnknownRelationship"`:
@@ -453,6 +785,13 @@ func (r *RelationType) UnmarshalJSON(b []byte) error {
 	case `"GroupedWith"`:
 		*r = GroupedWith
 	default:
+		var name string
+		if err := json.Unmarshal(b, &name); err == nil {
+			if custom, found := customRelationType(name); found {
+				*r = custom
+				return nil
+			}
+		}
 		return fmt.Errorf("Unknown relationship type in JSON: %s", string(b))
 	}
 	return nil
@@ -868,9 +1207,35 @@ func NewData(uuid dvid.UUID, id dvid.InstanceID, name dvid.InstanceName, c dvid.
 	if err != nil {
 		return nil, err
 	}
+	var props Properties
+	s, found, err := c.GetString("IndexedProps")
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		props.IndexedProps = parseNameList(s)
+	}
+	s, _, err = c.GetString("Validation")
+	if err != nil {
+		return nil, err
+	}
+	if props.Validation, err = NewValidationMode(s); err != nil {
+		return nil, err
+	}
+	if s, _, err = c.GetString("ElementKinds"); err != nil {
+		return nil, err
+	}
+	props.ElementKinds = appendNewNames(nil, parseNameList(s))
+	if s, _, err = c.GetString("RelationTypes"); err != nil {
+		return nil, err
+	}
+	props.RelationTypes = appendNewNames(nil, parseNameList(s))
 	data := &Data{
 		Data:       basedata,
-		Properties: Properties{},
+		Properties: props,
+	}
+	if err := data.registerCustomTypes(); err != nil {
+		return nil, err
 	}
 	return data, nil
 }
@@ -1043,7 +1408,18 @@ func addTagDelta(newBlockE, curBlockE Elements, tagDelta map[Tag]tagDeltaT) {
 
 // Properties are additional properties for data beyond those in standard datastore.Data.
 type Properties struct {
-	// Currently unused since block sizes are either default or taken from synced labelblk.
+	// IndexedProps are element property names with a secondary index for value queries
+	// as set on creation.  Versions whose indexed properties were set through the
+	// "indexed-props" endpoint store their names separately.
+	IndexedProps []string
+
+	// Validation is the mode for checking relationships on mutations.
+	Validation ValidationMode
+
+	// ElementKinds and RelationTypes are user-defined names allowed in addition to the
+	// built-in element kinds and relation types.  Names are only appended.
+	ElementKinds  []string
+	RelationTypes []string
 }
 
 // Data instance of labelvol, label sparse volumes.
@@ -1061,6 +1437,16 @@ type Data struct {
 	// Cached in-memory so we only have to lookup block size once.
 	cachedBlockSize *dvid.Point3d
 
+	// serializes element mutations while validation is on.
+	mutateMu sync.Mutex
+
+	// indexed property names per version, cached from the store.
+	versionProps map[dvid.VersionID][]string
+	propsMu      sync.RWMutex
+
+	// Serializes modifications of the label connection index.
+	connMu sync.Mutex
+
 	sync.RWMutex // For CAS ops.  TODO: Make more specific (e.g., point locks) for efficiency.
 }
 
@@ -1304,30 +1690,40 @@ func (d *Data) deleteElementInLabel(ctx *datastore.VersionedCtx, batch storage.B
 	return nil
 }
 
-// delete all reference to given element point in the related points.
+// delete all reference to given element point in the given partner points, returning the
+// removed PreSynTo relationships of partner elements.
 // This is private method and assumes outer locking.
-func (d *Data) deleteElementInRelationships(ctx *datastore.VersionedCtx, batch storage.Batch, pt dvid.Point3d, rels []Relationship) error {
+func (d *Data) deleteElementInRelationships(ctx *datastore.VersionedCtx, batch storage.Batch, pt dvid.Point3d, partners []dvid.Point3d) ([]synapticEdge, error) {
 	blockSize := d.blockSize()
-	for _, rel := range rels {
-		// Get the block elements containing the related element.
-		bcoord := rel.To.Chunk(blockSize).(dvid.ChunkPoint3d)
+	relBlocks := make(map[dvid.IZYXString]struct{})
+	var removed []synapticEdge
+	for _, partner := range partners {
+		// Get the block elements containing the partner element.
+		bcoord := partner.Chunk(blockSize).(dvid.ChunkPoint3d)
+		izyx := bcoord.ToIZYXString()
+		if _, found := relBlocks[izyx]; found {
+			continue
+		}
+		relBlocks[izyx] = struct{}{}
 		tk := NewBlockTKey(bcoord)
 		elems, err := getElements(ctx, tk)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		// Delete the point in relationships
+		edges := edgesTo(elems, pt)
 		if !elems.deleteRel(pt) {
 			continue
 		}
+		removed = append(removed, edges...)
 
 		// Save the block elements.
 		if err := putBatchElements(batch, tk, elems); err != nil {
-			return err
+			return nil, err
 		}
 	}
-	return nil
+	return removed, nil
 }
 
 // move all reference to given element point in the slice of tags.
@@ -1414,10 +1810,11 @@ func (d *Data) moveElementInLabels(ctx *datastore.VersionedCtx, batch storage.Ba
 	return nil
 }
 
-// move all reference to given element point in the related points in different blocks.
+// move all reference to given element point in the related points in different blocks,
+// returning the PreSynTo relationships of related elements that pointed to the "from" point.
 // This is private method and assumes outer locking as well as current "from" block already being modified,
 // including relationships.
-func (d *Data) moveElementInRelationships(ctx *datastore.VersionedCtx, batch storage.Batch, from, to dvid.Point3d, rels []Relationship) error {
+func (d *Data) moveElementInRelationships(ctx *datastore.VersionedCtx, batch storage.Batch, from, to dvid.Point3d, rels []Relationship) ([]synapticEdge, error) {
 	blockSize := d.blockSize()
 	fromBlockCoord := from.Chunk(blockSize).(dvid.ChunkPoint3d)
 
@@ -1432,29 +1829,32 @@ func (d *Data) moveElementInRelationships(ctx *datastore.VersionedCtx, batch sto
 	}
 
 	// Alter the moved points in those related blocks.
+	var moved []synapticEdge
 	for izyxstr := range relBlocks {
 		bcoord, err := izyxstr.ToChunkPoint3d()
 		if err != nil {
-			return err
+			return nil, err
 		}
 		tk := NewBlockTKey(bcoord)
 		elems, err := getElements(ctx, tk)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		// Move element in related element.
+		edges := edgesTo(elems, from)
 		if _, changed := elems.move(from, to, false); !changed {
 			dvid.Errorf("Unable to find moved element %s in related element @ block %s:\n%v\n", from, bcoord, elems)
 			continue
 		}
+		moved = append(moved, edges...)
 
 		// Save the block elements.
 		if err := putBatchElements(batch, tk, elems); err != nil {
-			return err
+			return nil, err
 		}
 	}
-	return nil
+	return moved, nil
 }
 
 func (d *Data) modifyElements(ctx *datastore.VersionedCtx, batch storage.Batch, tk storage.TKey, toAdd Elements) error {
@@ -2014,11 +2414,28 @@ func (d *Data) StoreElements(ctx *datastore.VersionedCtx, r io.Reader, kafkaOff
 	if err := json.Unmarshal(jsonBytes, &elems); err != nil {
 		return err
 	}
+	dvid.Infof("%d synaptic elements received via POST\n", len(elems))
+	return d.storeElements(ctx, elems, jsonBytes, kafkaOff)
+}
 
-	// d.Lock()
-	// defer d.Unlock()
+// storeElements stores the given elements and their denormalizations in one batch.
+// The posted data is referenced in any kafka message.
+func (d *Data) storeElements(ctx *datastore.VersionedCtx, elems Elements, postData []byte, kafkaOff bool) error {
+	unlock := d.lockMutation()
+	defer unlock()
 
-	dvid.Infof("%d synaptic elements received via POST\n", len(elems))
+	if err := d.checkCustomTypes(elems); err != nil {
+		return err
+	}
+	if d.validationMode() != ValidationOff {
+		violations, err := d.validateElements(ctx, elems)
+		if err != nil {
+			return err
+		}
+		if err := d.handleViolations("POST of elements", violations); err != nil {
+			return err
+		}
+	}
 
 	blockSize := d.blockSize()
 	addToBlock := make(map[dvid.IZYXString]Elements)
@@ -2036,6 +2453,7 @@ func (d *Data) StoreElements(ctx *datastore.VersionedCtx, r io.Reader, kafkaOff
 	}
 
 	// Find current elements under the blocks.
+	var replaced Elements
 	for izyxStr, elems := range addToBlock {
 		bcoord, err := izyxStr.ToChunkPoint3d()
 		if err != nil {
@@ -2047,6 +2465,7 @@ func (d *Data) StoreElements(ctx *datastore.VersionedCtx, r io.Reader, kafkaOff
 			return err
 		}
 		addTagDelta(elems, curBlockE, tagDelta)
+		replaced = append(replaced, replacedElements(elems, curBlockE)...)
 	}
 
 	// Do modifications under a batch.
@@ -2075,10 +2494,23 @@ func (d *Data) StoreElements(ctx *datastore.VersionedCtx, r io.Reader, kafkaOff
 		return err
 	}
 
+	// Replace any indexed property values
+	added := make(ElementsNR, len(elems))
+	for i, elem := range elems {
+		added[i] = elem.ElementNR
+	}
+	replacedNR := make(ElementsNR, len(replaced))
+	for i, elem := range replaced {
+		replacedNR[i] = elem.ElementNR
+	}
+	if err := d.modifyPropIndex(ctx, batch, replacedNR, added); err != nil {
+		return err
+	}
+
 	if !kafkaOff {
 		// store synapse info into blob store for kakfa reference
 		var postRef string
-		if postRef, err = d.PutBlob(jsonBytes); err != nil {
+		if postRef, err = d.PutBlob(postData); err != nil {
 			dvid.Errorf("storing posted synapse data %q to kafka: %v", d.DataName(), err)
 		}
 
@@ -2097,7 +2529,11 @@ func (d *Data) StoreElements(ctx *datastore.VersionedCtx, r io.Reader, kafkaOff
 		}
 	}
 
-	return batch.Commit()
+	if err := batch.Commit(); err != nil {
+		return err
+	}
+	d.adjustConnections(ctx, preSynEdges(replaced), preSynEdges(elems))
+	return nil
 }
 
 func (d *Data) DeleteElement(ctx *datastore.VersionedCtx, pt dvid.Point3d, kafkaOff bool) error {
@@ -2106,8 +2542,8 @@ func (d *Data) DeleteElement(ctx *datastore.VersionedCtx, pt dvid.Point3d, kafka
 	bcoord := pt.Chunk(blockSize).(dvid.ChunkPoint3d)
 	tk := NewBlockTKey(bcoord)
 
-	// d.Lock()
-	// defer d.Unlock()
+	unlock := d.lockMutation()
+	defer unlock()
 
 	elems, err := getElements(ctx, tk)
 	if err != nil {
@@ -2115,10 +2551,25 @@ func (d *Data) DeleteElement(ctx *datastore.VersionedCtx, pt dvid.Point3d, kafka
 	}
 
 	// Delete the given element
+	removed := edgesTo(elems, pt)
 	deleted, _ := elems.delete(pt)
 	if deleted == nil {
 		return fmt.Errorf("Did not find element %s in datastore", pt)
 	}
+	partners := make([]dvid.Point3d, len(deleted.Rels))
+	for i, rel := range deleted.Rels {
+		partners[i] = rel.To
+	}
+	if d.validationMode() != ValidationOff {
+		violations, referrers, err := d.validateDelete(ctx, *deleted)
+		if err != nil {
+			return err
+		}
+		if err := d.handleViolations(fmt.Sprintf("DELETE of element %s", pt), violations); err != nil {
+			return err
+		}
+		partners = append(partners, referrers...)
+	}
 
 	// Put block key version without given element
 	if err := putElements(ctx, tk, elems); err != nil {
@@ -2147,7 +2598,15 @@ func (d *Data) DeleteElement(ctx *datastore.VersionedCtx, pt dvid.Point3d, kafka
 	}
 
 	// Modify any reference in relationships
-	if err := d.deleteElementInRelationships(ctx, batch, deleted.Pos, deleted.Rels); err != nil {
+	relEdges, err := d.deleteElementInRelationships(ctx, batch, deleted.Pos, partners)
+	if err != nil {
+		return err
+	}
+	removed = append(removed, relEdges...)
+	removed = append(removed, preSynEdges(Elements{*deleted})...)
+
+	// Delete any indexed property values
+	if err := d.modifyPropIndex(ctx, batch, ElementsNR{deleted.ElementNR}, nil); err != nil {
 		return err
 	}
 
@@ -2167,7 +2626,11 @@ func (d *Data) DeleteElement(ctx *datastore.VersionedCtx, pt dvid.Point3d, kafka
 		}
 	}
 
-	return batch.Commit()
+	if err := batch.Commit(); err != nil {
+		return err
+	}
+	d.adjustConnections(ctx, removed, nil)
+	return nil
 }
 
 func (d *Data) MoveElement(ctx *datastore.VersionedCtx, from, to dvid.Point3d, kafkaOff bool) error {
@@ -2179,8 +2642,18 @@ func (d *Data) MoveElement(ctx *datastore.VersionedCtx, from, to dvid.Point3d, k
 	toCoord := to.Chunk(blockSize).(dvid.ChunkPoint3d)
 	toTk := NewBlockTKey(toCoord)
 
-	// d.Lock()
-	// defer d.Unlock()
+	unlock := d.lockMutation()
+	defer unlock()
+
+	if d.validationMode() != ValidationOff {
+		violations, err := d.validateMove(ctx, from, to)
+		if err != nil {
+			return err
+		}
+		if err := d.handleViolations(fmt.Sprintf("move of element %s to %s", from, to), violations); err != nil {
+			return err
+		}
+	}
 
 	// Alter all stored versions of this annotation using a batch.
 	store, err := d.KVStore()
@@ -2200,6 +2673,7 @@ func (d *Data) MoveElement(ctx *datastore.VersionedCtx, from, to dvid.Point3d, k
 	}
 
 	deleteElement := (bytes.Compare(fromTk, toTk) != 0)
+	partnerEdges := edgesTo(fromElems, from)
 	moved, _ := fromElems.move(from, to, deleteElement)
 	if moved == nil {
 		return fmt.Errorf("Did not find moved element %s in datastore", from)
@@ -2257,11 +2731,34 @@ func (d *Data) MoveElement(ctx *datastore.VersionedCtx, from, to dvid.Point3d, k
 	}
 
 	// Move any reference in relationships
-	if err := d.moveElementInRelationships(ctx, batch, from, to, moved.Rels); err != nil {
+	relEdges, err := d.moveElementInRelationships(ctx, batch, from, to, moved.Rels)
+	if err != nil {
+		return err
+	}
+	partnerEdges = append(partnerEdges, relEdges...)
+
+	// Move any indexed property values
+	prevElem := moved.ElementNR
+	prevElem.Pos = from
+	if err := d.modifyPropIndex(ctx, batch, ElementsNR{prevElem}, ElementsNR{moved.ElementNR}); err != nil {
+		return err
+	}
+
+	if err := batch.Commit(); err != nil {
 		return err
 	}
 
-	return batch.Commit()
+	// Both the moved element's own PreSynTo relationships and those of partners pointing
+	// to it now have a different position.
+	premove := *moved
+	premove.Pos = from
+	removed := append(preSynEdges(Elements{premove}), partnerEdges...)
+	added := preSynEdges(Elements{*moved})
+	for _, edge := range partnerEdges {
+		added = append(added, synapticEdge{pre: edge.pre, post: to})
+	}
+	d.adjustConnections(ctx, removed, added)
+	return nil
 }
 
 // RecreateDenormalizations will recreate label and tag denormalizations from
@@ -2461,6 +2958,9 @@ func (d *Data) resyncInMemory(ctx *datastore.VersionedCtx, check bool) {
 	close(ch)
 	wg.Wait()
 	timedLog.Infof("Finished denormalization of %d kvs, %d changed (%d errors)", numProcessed, numChanged, numErrs)
+	if err := d.rebuildConnections(ctx); err != nil {
+		dvid.Errorf("Error rebuilding connections of data %q: %v\n", d.DataName(), err)
+	}
 }
 
 // Get all keyBlock kv pairs, forcing the label and tag denormalizations.
@@ -2590,6 +3090,9 @@ func (d *Data) resyncLowMemory(ctx *datastore.VersionedCtx) {
 	}
 
 	timedLog.Infof("Completed asynchronous annotation %q reload of %d block and %d tag elements.", d.DataName(), totBlockE, totTagE)
+	if err := d.rebuildConnections(ctx); err != nil {
+		dvid.Errorf("Error rebuilding connections of data %q: %v\n", d.DataName(), err)
+	}
 }
 
 // GetByDataUUID returns a pointer to annotation data given a data UUID.
@@ -2643,7 +3146,7 @@ func (d *Data) GobDecode(b []byte) error {
 	if err := dec.Decode(&(d.Properties)); err != nil {
 		return err
 	}
-	return nil
+	return d.registerCustomTypes()
 }
 
 func (d *Data) GobEncode() ([]byte, error) {
@@ -2862,33 +3365,410 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 			return
 		}
 
-	case "blocks":
-		switch action {
-		case "get":
-			// GET <api URL>/node/<UUID>/<data name>/blocks/<size>/<offset>
-			if len(parts) < 6 {
-				server.BadRequest(w, r, "Expect size and offset to follow 'blocks' in GET request")
-				return
-			}
-			sizeStr, offsetStr := parts[4], parts[5]
-			ext3d, err := dvid.NewExtents3dFromStrings(offsetStr, sizeStr, "_")
-			if err != nil {
+	case "connections":
+		// GET <api URL>/node/<UUID>/<data name>/connections[?<options>]
+		if action != "get" {
+			server.BadRequest(w, r, "Only GET action is available on 'connections' endpoint.")
+			return
+		}
+		if d.getSyncedLabels() == nil {
+			server.BadRequest(w, r, "connections endpoint requires annotation %q be synced with label data", d.DataName())
+			return
+		}
+		queryStrings := r.URL.Query()
+		preLabels, err := parseLabelSet(queryStrings.Get("pre"))
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		postLabels, err := parseLabelSet(queryStrings.Get("post"))
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-type", "application/json")
+		roiStr := queryStrings.Get("roi")
+		if roiStr == "" && len(preLabels) == 0 && len(postLabels) == 0 {
+			if err := d.StreamConnections(ctx, w); err != nil {
 				server.BadRequest(w, r, err)
 				return
 			}
-			w.Header().Set("Content-type", "application/json")
-			if err = d.StreamBlocks(ctx, w, ext3d); err != nil {
-				server.BadRequest(w, r, err)
+			timedLog.Infof("HTTP %s: streamed all connections (%s)", r.Method, r.URL)
+			return
+		}
+		var conns Connections
+		if roiStr != "" {
+			roiParts := strings.Split(roiStr, ",")
+			var roiSpec string
+			switch len(roiParts) {
+			case 1:
+				roiSpec = "roi:" + roiParts[0] + "," + string(uuid)
+			case 2:
+				roiSpec = "roi:" + roiStr
+			default:
+				server.BadRequest(w, r, "Bad ROI specification: %q", roiStr)
 				return
 			}
-			timedLog.Infof("HTTP %s: synapse elements in blocks intersecting subvolume (size %s, offset %s) (%s)", r.Method, sizeStr, offsetStr, r.URL)
-
-		default:
-			server.BadRequest(w, r, "Only GET action is available on 'blocks' endpoint.")
+			conns, err = d.GetROIConnections(ctx, storage.FilterSpec(roiSpec), preLabels, postLabels)
+		} else {
+			conns, err = d.GetConnections(ctx, preLabels, postLabels)
+		}
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		jsonBytes, err := json.Marshal(conns)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if _, err := w.Write(jsonBytes); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		timedLog.Infof("HTTP %s: got %d connections (%s)", r.Method, len(conns), r.URL)
+
+	case "nearest":
+		// GET <api URL>/node/<UUID>/<data name>/nearest/<coord>[?<options>]
+		if action != "get" {
+			server.BadRequest(w, r, "Only GET action is available on 'nearest' endpoint.")
+			return
+		}
+		if len(parts) < 5 {
+			server.BadRequest(w, r, "Expect coordinate to follow 'nearest' in GET request")
+			return
+		}
+		pt, err := dvid.StringToPoint3d(parts[4], "_")
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		queryStrings := r.URL.Query()
+		filter, err := NewElementFilter(queryStrings.Get("kind"), queryStrings.Get("tag"))
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		k := 1
+		if kStr := queryStrings.Get("k"); kStr != "" {
+			if k, err = strconv.Atoi(kStr); err != nil {
+				server.BadRequest(w, r, "bad k value %q: %v", kStr, err)
+				return
+			}
+		}
+		voxelSize, err := d.QueryVoxelSize(queryStrings)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		maxDist := DefaultNearestMaxDist
+		if len(voxelSize) == 3 {
+			maxDist *= float64(voxelSize.GetMin())
+		}
+		if maxStr := queryStrings.Get("maxdist"); maxStr != "" {
+			if maxDist, err = strconv.ParseFloat(maxStr, 64); err != nil {
+				server.BadRequest(w, r, "bad maxdist value %q: %v", maxStr, err)
+				return
+			}
+		}
+		elems, err := d.GetNearestElements(ctx, pt, k, maxDist, voxelSize, filter)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		jsonBytes, err := json.Marshal(elems)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-type", "application/json")
+		if _, err := w.Write(jsonBytes); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		timedLog.Infof("HTTP %s: %d nearest elements to %s (%s)", r.Method, len(elems), pt, r.URL)
+
+	case "radius":
+		// GET <api URL>/node/<UUID>/<data name>/radius/<coord>/<radius>[?<options>]
+		if action != "get" {
+			server.BadRequest(w, r, "Only GET action is available on 'radius' endpoint.")
+			return
+		}
+		if len(parts) < 6 {
+			server.BadRequest(w, r, "Expect coordinate and radius to follow 'radius' in GET request")
+			return
+		}
+		pt, err := dvid.StringToPoint3d(parts[4], "_")
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		radius, err := strconv.ParseFloat(parts[5], 64)
+		if err != nil {
+			server.BadRequest(w, r, "bad radius %q: %v", parts[5], err)
+			return
+		}
+		queryStrings := r.URL.Query()
+		filter, err := NewElementFilter(queryStrings.Get("kind"), queryStrings.Get("tag"))
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		voxelSize, err := d.QueryVoxelSize(queryStrings)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		elems, err := d.GetRadiusElements(ctx, pt, radius, voxelSize, filter)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		jsonBytes, err := json.Marshal(elems)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-type", "application/json")
+		if _, err := w.Write(jsonBytes); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		timedLog.Infof("HTTP %s: %d elements within %f of %s (%s)", r.Method, len(elems), radius, pt, r.URL)
+
+	case "prop":
+		// GET <api URL>/node/<UUID>/<data name>/prop/<property name>?<options>
+		if action != "get" {
+			server.BadRequest(w, r, "Only GET action is available on 'prop' endpoint.")
+			return
+		}
+		if len(parts) < 5 {
+			server.BadRequest(w, r, "Must include property name after 'prop' endpoint.")
+			return
+		}
+		var q PropQuery
+		queryStrings := r.URL.Query()
+		if vals, found := queryStrings["value"]; found {
+			q.Value = &vals[0]
+		}
+		if vals, found := queryStrings["min"]; found {
+			q.Min = &vals[0]
+		}
+		if vals, found := queryStrings["max"]; found {
+			q.Max = &vals[0]
+		}
+		if q.Value != nil && (q.Min != nil || q.Max != nil) {
+			server.BadRequest(w, r, "Cannot specify both a value and a min/max range for 'prop' endpoint.")
+			return
+		}
+		elems, err := d.GetPropElements(ctx, parts[4], q)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		jsonBytes, err := json.Marshal(elems)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-type", "application/json")
+		if _, err := w.Write(jsonBytes); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		timedLog.Infof("HTTP %s: %d elements with property %q (%s)", r.Method, len(elems), parts[4], r.URL)
+
+	case "indexed-props":
+		switch action {
+		case "get":
+			props, err := d.indexedProps(ctx)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			jsonBytes, err := json.Marshal(props)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			w.Header().Set("Content-type", "application/json")
+			if _, err := w.Write(jsonBytes); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+		case "post":
+			var props []string
+			if err := json.NewDecoder(r.Body).Decode(&props); err != nil {
+				server.BadRequest(w, r, "unable to decode JSON list of property names: %v", err)
+				return
+			}
+			if err := d.SetIndexedProps(ctx, props); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			timedLog.Infof("HTTP %s: set indexed properties to %v (%s)", r.Method, props, r.URL)
+		default:
+			server.BadRequest(w, r, "Only GET or POST action is available on 'indexed-props' endpoint.")
+			return
+		}
+
+	case "kinds":
+		switch action {
+		case "get":
+			d.RLock()
+			jsonBytes, err := json.Marshal(struct {
+				ElementKinds  []string
+				RelationTypes []string
+			}{d.ElementKinds, d.RelationTypes})
+			d.RUnlock()
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			w.Header().Set("Content-type", "application/json")
+			if _, err := w.Write(jsonBytes); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+		case "post":
+			var added struct {
+				ElementKinds  []string
+				RelationTypes []string
+			}
+			if err := json.NewDecoder(r.Body).Decode(&added); err != nil {
+				server.BadRequest(w, r, "unable to decode JSON custom kinds and relation types: %v", err)
+				return
+			}
+			if err := d.AddCustomTypes(added.ElementKinds, added.RelationTypes); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			if err := datastore.SaveDataByUUID(uuid, d); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			timedLog.Infof("HTTP %s: added element kinds %v and relation types %v (%s)", r.Method, added.ElementKinds, added.RelationTypes, r.URL)
+		default:
+			server.BadRequest(w, r, "Only GET or POST action is available on 'kinds' endpoint.")
+			return
+		}
+
+	case "validation":
+		switch action {
+		case "get":
+			jsonBytes, err := json.Marshal(struct{ Mode ValidationMode }{d.validationMode()})
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			w.Header().Set("Content-type", "application/json")
+			if _, err := w.Write(jsonBytes); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+		case "post":
+			var setting struct{ Mode string }
+			if err := json.NewDecoder(r.Body).Decode(&setting); err != nil {
+				server.BadRequest(w, r, "unable to decode JSON validation setting: %v", err)
+				return
+			}
+			mode, err := NewValidationMode(setting.Mode)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			d.SetValidation(mode)
+			if err := datastore.SaveDataByUUID(uuid, d); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			timedLog.Infof("HTTP %s: set validation mode to %q (%s)", r.Method, mode, r.URL)
+		default:
+			server.BadRequest(w, r, "Only GET or POST action is available on 'validation' endpoint.")
+			return
+		}
+
+	case "integrity":
+		if action != "get" {
+			server.BadRequest(w, r, "Only GET action is available on 'integrity' endpoint.")
+			return
+		}
+		report, err := d.GetIntegrityReport(ctx)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		jsonBytes, err := json.Marshal(report)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-type", "application/json")
+		if _, err := w.Write(jsonBytes); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		timedLog.Infof("HTTP %s: integrity report (%s)", r.Method, r.URL)
+
+	case "all":
+		queryStrings := r.URL.Query()
+		format, err := NewBulkFormat(queryStrings.Get("format"))
+		if err != nil {
+			server.BadRequest(w, r, err)
 			return
 		}
-
-	case "elements":
+		switch action {
+		case "get":
+			// GET <api URL>/node/<UUID>/<data name>/all?format=csv&labels=true
+			opts := BulkOptions{
+				Labels:      queryStrings.Get("labels") == "true",
+				Supervoxels: queryStrings.Get("supervoxels") == "true",
+			}
+			w.Header().Set("Content-type", format.ContentType())
+			if err := d.StreamAll(ctx, w, format, opts); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			timedLog.Infof("HTTP %s: all elements in %s format (%s)", r.Method, format, r.URL)
+		case "post":
+			kafkaOff := queryStrings.Get("kafkalog") == "off"
+			if err := d.StoreAll(ctx, r.Body, format, kafkaOff); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			timedLog.Infof("HTTP %s: bulk elements in %s format (%s)", r.Method, format, r.URL)
+		default:
+			server.BadRequest(w, r, "Only GET or POST action is available on 'all' endpoint.")
+			return
+		}
+
+	case "blocks":
+		switch action {
+		case "get":
+			// GET <api URL>/node/<UUID>/<data name>/blocks/<size>/<offset>
+			if len(parts) < 6 {
+				server.BadRequest(w, r, "Expect size and offset to follow 'blocks' in GET request")
+				return
+			}
+			sizeStr, offsetStr := parts[4], parts[5]
+			ext3d, err := dvid.NewExtents3dFromStrings(offsetStr, sizeStr, "_")
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			w.Header().Set("Content-type", "application/json")
+			if err = d.StreamBlocks(ctx, w, ext3d); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			timedLog.Infof("HTTP %s: synapse elements in blocks intersecting subvolume (size %s, offset %s) (%s)", r.Method, sizeStr, offsetStr, r.URL)
+
+		default:
+			server.BadRequest(w, r, "Only GET action is available on 'blocks' endpoint.")
+			return
+		}
+
+	case "elements":
 		switch action {
 		case "get":
 			// GET <api URL>/node/<UUID>/<data name>/elements/<size>/<offset>
@@ -2952,6 +3832,162 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 		}
 		timedLog.Infof("HTTP %s: delete synaptic element at %s (%s)", r.Method, pt, r.URL)
 
+	case "shapes":
+		switch action {
+		case "get":
+			// GET <api URL>/node/<UUID>/<data name>/shapes/<size>/<offset>
+			if len(parts) < 6 {
+				server.BadRequest(w, r, "Expect size and offset to follow 'shapes' in GET request")
+				return
+			}
+			sizeStr, offsetStr := parts[4], parts[5]
+			ext3d, err := dvid.NewExtents3dFromStrings(offsetStr, sizeStr, "_")
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			shapes, err := d.GetRegionShapes(ctx, ext3d)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			w.Header().Set("Content-type", "application/json")
+			jsonBytes, err := json.Marshal(shapes)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			if _, err := w.Write(jsonBytes); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			timedLog.Infof("HTTP %s: %d shapes in subvolume (size %s, offset %s) (%s)", r.Method, len(shapes), sizeStr, offsetStr, r.URL)
+
+		case "post":
+			var shapes Shapes
+			if err := json.NewDecoder(r.Body).Decode(&shapes); err != nil {
+				server.BadRequest(w, r, "unable to decode posted shapes: %v", err)
+				return
+			}
+			kafkaOff := r.URL.Query().Get("kafkalog") == "off"
+			ids, err := d.StoreShapes(ctx, shapes, kafkaOff)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			w.Header().Set("Content-type", "application/json")
+			jsonBytes, err := json.Marshal(ids)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			if _, err := w.Write(jsonBytes); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			timedLog.Infof("HTTP %s: stored %d shapes (%s)", r.Method, len(shapes), r.URL)
+
+		default:
+			server.BadRequest(w, r, "Only GET or POST action is available on 'shapes' endpoint.")
+			return
+		}
+
+	case "shapes-roi":
+		// GET <api URL>/node/<UUID>/<data name>/shapes-roi/<ROI specification>
+		if action != "get" {
+			server.BadRequest(w, r, "Only GET action is available on 'shapes-roi' endpoint.")
+			return
+		}
+		if len(parts) < 5 {
+			server.BadRequest(w, r, "Expect ROI specification to follow 'shapes-roi' in GET request")
+			return
+		}
+		roiParts := strings.Split(parts[4], ",")
+		roiSpec := "roi:"
+		switch len(roiParts) {
+		case 1:
+			roiSpec += roiParts[0] + "," + string(uuid)
+		case 2:
+			roiSpec += parts[4]
+		default:
+			server.BadRequest(w, r, "Bad ROI specification: %q", parts[4])
+			return
+		}
+		shapes, err := d.GetROIShapes(ctx, storage.FilterSpec(roiSpec))
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-type", "application/json")
+		jsonBytes, err := json.Marshal(shapes)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if _, err := w.Write(jsonBytes); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		timedLog.Infof("HTTP %s: %d shapes in ROI (%s) (%s)", r.Method, len(shapes), parts[4], r.URL)
+
+	case "shapes-label":
+		// GET <api URL>/node/<UUID>/<data name>/shapes-label/<label>
+		if action != "get" {
+			server.BadRequest(w, r, "Only GET action is available on 'shapes-label' endpoint.")
+			return
+		}
+		if len(parts) < 5 {
+			server.BadRequest(w, r, "Must include label after 'shapes-label' endpoint.")
+			return
+		}
+		label, err := strconv.ParseUint(parts[4], 10, 64)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if label == 0 {
+			server.BadRequest(w, r, "Label 0 is protected background value and cannot be used as query.")
+			return
+		}
+		shapes, err := d.GetLabelShapes(ctx, label)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-type", "application/json")
+		jsonBytes, err := json.Marshal(shapes)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if _, err := w.Write(jsonBytes); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		timedLog.Infof("HTTP %s: %d shapes for label %d (%s)", r.Method, len(shapes), label, r.URL)
+
+	case "shape":
+		// DELETE <api URL>/node/<UUID>/<data name>/shape/<id>
+		if action != "delete" {
+			server.BadRequest(w, r, "Only DELETE action is available on 'shape' endpoint.")
+			return
+		}
+		if len(parts) < 5 {
+			server.BadRequest(w, r, "Must include shape ID after DELETE on 'shape' endpoint.")
+			return
+		}
+		id, err := strconv.ParseUint(parts[4], 10, 64)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		kafkaOff := r.URL.Query().Get("kafkalog") == "off"
+		if err := d.DeleteShape(ctx, id, kafkaOff); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		timedLog.Infof("HTTP %s: delete shape %d (%s)", r.Method, id, r.URL)
+
 	case "move":
 		// POST <api URL>/node/<UUID>/<data name>/move/<from_coord>/<to_coord>
 		if action != "post" {
@@ -6,12 +6,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"reflect"
 	"runtime"
 	"strings"
 	"sync"
 	"testing"
 
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/ipc"
+	"github.com/apache/arrow/go/v14/arrow/memory"
 	"github.com/janelia-flyem/dvid/datastore"
 	"github.com/janelia-flyem/dvid/dvid"
 	"github.com/janelia-flyem/dvid/server"
@@ -779,6 +784,185 @@ func TestRequests(t *testing.T) {
 	testResponse(t, synapse2, "%snode/%s/%s/tag/%s?relationships=true", server.WebAPIPath, uuid, data.DataName(), tag)
 }
 
+func testDistances(t *testing.T, expected []dvid.Point3d, template string, args ...interface{}) ElementDistances {
+	url := fmt.Sprintf(template, args...)
+	returnValue := server.TestHTTP(t, "GET", url, nil)
+	var got ElementDistances
+	if err := json.Unmarshal(returnValue, &got); err != nil {
+		t.Fatalf("unable to decode elements from %s: %v\n", url, err)
+	}
+	if len(got) != len(expected) {
+		_, fn, line, _ := runtime.Caller(1)
+		t.Fatalf("Expected %d elements for %s [%s:%d], got %d: %v\n", len(expected), url, fn, line, len(got), got)
+	}
+	for i, pt := range expected {
+		if !got[i].Pos.Equals(pt) {
+			_, fn, line, _ := runtime.Caller(1)
+			t.Fatalf("Expected element %d at %s for %s [%s:%d], got %s\n", i, pt, url, fn, line, got[i].Pos)
+		}
+	}
+	return got
+}
+
+func TestSpatialQueries(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "annotation", "mysynapses", dvid.Config{})
+
+	testJSON, err := json.Marshal(testData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url1 := fmt.Sprintf("%snode/%s/mysynapses/elements", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", url1, strings.NewReader(string(testJSON)))
+
+	nearestURL := fmt.Sprintf("%snode/%s/mysynapses/nearest/16_28_36", server.WebAPIPath, uuid)
+	got := testDistances(t, []dvid.Point3d{{15, 27, 35}}, nearestURL)
+	if math.Abs(got[0].Distance-math.Sqrt(3)) > 0.0001 {
+		t.Errorf("expected distance of sqrt(3), got %f\n", got[0].Distance)
+	}
+	if len(got[0].Rels) != 3 {
+		t.Errorf("expected relationships with nearest element, got %v\n", got[0])
+	}
+	testDistances(t, []dvid.Point3d{{15, 27, 35}, {14, 25, 37}, {20, 30, 40}}, nearestURL+"?k=3")
+	testDistances(t, []dvid.Point3d{{15, 27, 35}, {127, 63, 99}}, nearestURL+"?k=2&kind=PreSyn")
+	testDistances(t, []dvid.Point3d{{15, 27, 35}}, nearestURL+"?k=2&kind=PreSyn&maxdist=100")
+	testDistances(t, []dvid.Point3d{{88, 47, 80}}, nearestURL+"?tag=Synapse2")
+	testDistances(t, []dvid.Point3d{}, nearestURL+"?kind=Note")
+	server.TestBadHTTP(t, "GET", nearestURL+"?kind=Foo", nil)
+	server.TestBadHTTP(t, "GET", nearestURL+"?k=0", nil)
+
+	radiusURL := fmt.Sprintf("%snode/%s/mysynapses/radius/16_28_36", server.WebAPIPath, uuid)
+	testDistances(t, []dvid.Point3d{{15, 27, 35}, {14, 25, 37}, {20, 30, 40}}, radiusURL+"/6")
+	testDistances(t, []dvid.Point3d{{14, 25, 37}, {20, 30, 40}}, radiusURL+"/6?kind=PostSyn")
+	testDistances(t, []dvid.Point3d{{14, 25, 37}}, radiusURL+"/6?kind=PostSyn&tag=Zlt90")
+	testDistances(t, []dvid.Point3d{}, radiusURL+"/1")
+	server.TestBadHTTP(t, "GET", radiusURL+"/-1", nil)
+	server.TestBadHTTP(t, "GET", radiusURL+"/NaN", nil)
+	server.TestBadHTTP(t, "GET", radiusURL+"/Inf", nil)
+	server.TestBadHTTP(t, "GET", radiusURL+"/1e12", nil)
+	server.TestBadHTTP(t, "GET", nearestURL+"?maxdist=NaN", nil)
+	server.TestBadHTTP(t, "GET", nearestURL+"?maxdist=-1", nil)
+	server.TestBadHTTP(t, "GET", nearestURL+"?maxdist=1e12", nil)
+
+	// Distances in physical units.
+	testDistances(t, []dvid.Point3d{{15, 27, 35}, {14, 25, 37}, {20, 30, 40}}, radiusURL+"/24?voxelsize=4_4_4")
+	testDistances(t, []dvid.Point3d{{15, 27, 35}, {14, 25, 37}}, radiusURL+"/20?voxelsize=4_4_4")
+	got = testDistances(t, []dvid.Point3d{{15, 27, 35}}, nearestURL+"?voxelsize=4_4_4")
+	if math.Abs(got[0].Distance-4*math.Sqrt(3)) > 0.0001 {
+		t.Errorf("expected distance of 4*sqrt(3), got %f\n", got[0].Distance)
+	}
+	server.TestBadHTTP(t, "GET", radiusURL+"/24?voxelsize=4_0_4", nil)
+	server.TestBadHTTP(t, "GET", radiusURL+"/24?physical=true", nil)
+}
+
+func testPropPositions(t *testing.T, expected []dvid.Point3d, template string, args ...interface{}) {
+	url := fmt.Sprintf(template, args...)
+	returnValue := server.TestHTTP(t, "GET", url, nil)
+	var got Elements
+	if err := json.Unmarshal(returnValue, &got); err != nil {
+		t.Fatalf("unable to decode elements from %s: %v\n", url, err)
+	}
+	if !reflect.DeepEqual(got.positions(), expected) && (len(expected) != 0 || len(got) != 0) {
+		_, fn, line, _ := runtime.Caller(1)
+		t.Fatalf("Expected elements at %v for %s [%s:%d], got %v\n", expected, url, fn, line, got.positions())
+	}
+}
+
+func TestPropQueries(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("IndexedProps", "user")
+	server.CreateTestInstance(t, uuid, "annotation", "mysynapses", config)
+
+	elems := Elements{
+		{ElementNR{Pos: dvid.Point3d{10, 10, 10}, Kind: PreSyn, Prop: map[string]string{"user": "alice", "conf": "0.95"}}, nil},
+		{ElementNR{Pos: dvid.Point3d{50, 10, 10}, Kind: PostSyn, Prop: map[string]string{"user": "bob", "conf": "0.5"}}, nil},
+		{ElementNR{Pos: dvid.Point3d{100, 40, 10}, Kind: PostSyn, Prop: map[string]string{"user": "alice", "conf": "1"}}, nil},
+		{ElementNR{Pos: dvid.Point3d{5, 70, 90}, Kind: Note, Prop: map[string]string{"user": "carl", "conf": "high"}}, nil},
+	}
+	testJSON, err := json.Marshal(elems)
+	if err != nil {
+		t.Fatal(err)
+	}
+	elemsURL := fmt.Sprintf("%snode/%s/mysynapses/elements", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", elemsURL, bytes.NewBuffer(testJSON))
+
+	propURL := fmt.Sprintf("%snode/%s/mysynapses/prop", server.WebAPIPath, uuid)
+	testPropPositions(t, []dvid.Point3d{{10, 10, 10}, {100, 40, 10}}, propURL+"/user?value=alice")
+	testPropPositions(t, []dvid.Point3d{{10, 10, 10}, {100, 40, 10}, {50, 10, 10}}, propURL+"/user?min=a&max=bob")
+	testPropPositions(t, []dvid.Point3d{{50, 10, 10}, {5, 70, 90}}, propURL+"/user?min=b")
+	testPropPositions(t, nil, propURL+"/user?value=dave")
+	server.TestBadHTTP(t, "GET", propURL+"/user", nil)
+	server.TestBadHTTP(t, "GET", propURL+"/user?value=alice&min=a", nil)
+	server.TestBadHTTP(t, "GET", propURL+"/conf?min=0.9", nil)
+
+	// Index another property.
+	indexedURL := fmt.Sprintf("%snode/%s/mysynapses/indexed-props", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", indexedURL, strings.NewReader(`["user", "conf"]`))
+	if returnValue := server.TestHTTP(t, "GET", indexedURL, nil); string(returnValue) != `["user","conf"]` {
+		t.Fatalf("Expected indexed properties to be set, got %s\n", string(returnValue))
+	}
+	testPropPositions(t, []dvid.Point3d{{10, 10, 10}, {100, 40, 10}}, propURL+"/conf?min=0.9")
+	testPropPositions(t, []dvid.Point3d{{50, 10, 10}}, propURL+"/conf?max=0.6")
+	testPropPositions(t, []dvid.Point3d{{100, 40, 10}}, propURL+"/conf?value=1.0")
+	testPropPositions(t, []dvid.Point3d{{5, 70, 90}}, propURL+"/conf?min=a")
+
+	// Modify, move and delete elements.
+	elems[0].Prop["user"] = "dave"
+	testJSON, err = json.Marshal(elems[0:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TestHTTP(t, "POST", elemsURL, bytes.NewBuffer(testJSON))
+	testPropPositions(t, []dvid.Point3d{{100, 40, 10}}, propURL+"/user?value=alice")
+	testPropPositions(t, []dvid.Point3d{{10, 10, 10}}, propURL+"/user?value=dave")
+
+	moveURL := fmt.Sprintf("%snode/%s/mysynapses/move/100_40_10/101_40_10", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", moveURL, nil)
+	testPropPositions(t, []dvid.Point3d{{101, 40, 10}}, propURL+"/user?value=alice")
+
+	delURL := fmt.Sprintf("%snode/%s/mysynapses/element/50_10_10", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "DELETE", delURL, nil)
+	testPropPositions(t, nil, propURL+"/conf?max=0.6")
+	testPropPositions(t, nil, propURL+"/user?value=bob")
+
+	// Indexed properties are set per version and inherited by new child versions.
+	commitURL := fmt.Sprintf("%snode/%s/commit", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", commitURL, strings.NewReader(`{"note": "props"}`))
+	newVersionURL := fmt.Sprintf("%snode/%s/newversion", server.WebAPIPath, uuid)
+	var newVersion struct {
+		Child string `json:"child"`
+	}
+	if err := json.Unmarshal(server.TestHTTP(t, "POST", newVersionURL, nil), &newVersion); err != nil {
+		t.Fatalf("unable to parse newversion response: %v\n", err)
+	}
+	childIndexedURL := fmt.Sprintf("%snode/%s/mysynapses/indexed-props", server.WebAPIPath, newVersion.Child)
+	childPropURL := fmt.Sprintf("%snode/%s/mysynapses/prop", server.WebAPIPath, newVersion.Child)
+	if returnValue := server.TestHTTP(t, "GET", childIndexedURL, nil); string(returnValue) != `["user","conf"]` {
+		t.Fatalf("Expected child version to inherit indexed properties, got %s\n", string(returnValue))
+	}
+	testPropPositions(t, []dvid.Point3d{{101, 40, 10}}, childPropURL+"/user?value=alice")
+
+	server.TestBadHTTP(t, "POST", indexedURL, strings.NewReader(`["conf"]`))
+	server.TestHTTP(t, "POST", childIndexedURL, strings.NewReader(`["conf"]`))
+	if returnValue := server.TestHTTP(t, "GET", indexedURL, nil); string(returnValue) != `["user","conf"]` {
+		t.Fatalf("Expected parent version to keep its indexed properties, got %s\n", string(returnValue))
+	}
+	testPropPositions(t, []dvid.Point3d{{101, 40, 10}}, propURL+"/user?value=alice")
+	testPropPositions(t, []dvid.Point3d{{10, 10, 10}, {101, 40, 10}}, childPropURL+"/conf?min=0.9")
+	server.TestBadHTTP(t, "GET", childPropURL+"/user?value=alice", nil)
+}
+
 func TestPropChange(t *testing.T) {
 	if err := server.OpenTest(); err != nil {
 		t.Fatalf("can't open test server: %v\n", err)
@@ -1686,6 +1870,137 @@ func TestSupervoxelSplit(t *testing.T) {
 	testResponseLabel(t, expectedLabel3, "%snode/%s/mysynapses/label/3?relationships=true", server.WebAPIPath, uuid)
 }
 
+func testConnections(t *testing.T, expected Connections, template string, args ...interface{}) {
+	url := fmt.Sprintf(template, args...)
+	returnValue := server.TestHTTP(t, "GET", url, nil)
+	var got Connections
+	if err := json.Unmarshal(returnValue, &got); err != nil {
+		t.Fatalf("unable to decode connections from %s: %v\n", url, err)
+	}
+	if len(expected) == 0 && len(got) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(expected, got) {
+		_, fn, line, _ := runtime.Caller(1)
+		t.Fatalf("Expected connections for %s [%s:%d]:\n%v\nGot:\n%v\n", url, fn, line, expected, got)
+	}
+}
+
+func TestConnections(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, v := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelmap", "mylabelmap", config)
+	_ = createLabelTestVolume(t, uuid, "mylabelmap")
+	if err := datastore.BlockOnUpdating(uuid, "mylabelmap"); err != nil {
+		t.Fatalf("Error blocking on labels updating: %v\n", err)
+	}
+
+	server.CreateTestInstance(t, uuid, "annotation", "mysynapses", config)
+	server.CreateTestSync(t, uuid, "mysynapses", "mylabelmap")
+
+	connURL := fmt.Sprintf("%snode/%s/mysynapses/connections", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", connURL+"?pre=0", nil)
+	server.TestBadHTTP(t, "GET", connURL+"?pre=foo", nil)
+	testConnections(t, nil, connURL)
+
+	testJSON, err := json.Marshal(testData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url1 := fmt.Sprintf("%snode/%s/mysynapses/elements", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", url1, strings.NewReader(string(testJSON)))
+
+	all := Connections{{Pre: 1, Post: 2, Weight: 1}, {Pre: 1, Post: 3, Weight: 1}, {Pre: 3, Post: 4, Weight: 1}}
+	testConnections(t, all, connURL)
+	testConnections(t, all[0:2], connURL+"?pre=1")
+	testConnections(t, all[1:2], connURL+"?pre=1&post=3,4")
+	testConnections(t, all[1:3], connURL+"?post=3,4")
+	testConnections(t, nil, connURL+"?pre=4")
+
+	// ROI only includes the first PreSyn element.
+	server.CreateTestInstance(t, uuid, "roi", "myroi", dvid.Config{})
+	apiStr := fmt.Sprintf("%snode/%s/myroi/roi", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", apiStr, bytes.NewBufferString(labelsJSON()))
+	testConnections(t, all[0:2], connURL+"?roi=myroi")
+	testConnections(t, all[1:2], "%s?roi=myroi,%s&post=3", connURL, uuid)
+
+	// Merge 3 into 2 and make sure connections are combined.
+	testMerge := mergeJSON(`[2, 3]`)
+	testMerge.send(t, uuid, "mylabelmap")
+	if err := datastore.BlockOnUpdating(uuid, "mysynapses"); err != nil {
+		t.Fatalf("Error blocking on sync of synapses: %v\n", err)
+	}
+	merged := Connections{{Pre: 1, Post: 2, Weight: 2}, {Pre: 2, Post: 4, Weight: 1}}
+	testConnections(t, merged, connURL)
+	testConnections(t, nil, connURL+"?post=3")
+
+	// Split off the voxels of both PostSyn elements in label 2.
+	rles := dvid.RLEs{
+		dvid.NewRLE(dvid.Point3d{14, 25, 37}, 2),
+		dvid.NewRLE(dvid.Point3d{19, 30, 40}, 2),
+	}
+	reqStr := fmt.Sprintf("%snode/%s/mylabelmap/split/2", server.WebAPIPath, uuid)
+	r := server.TestHTTP(t, "POST", reqStr, getBytesRLE(t, rles))
+	var jsonVal struct {
+		Label uint64
+	}
+	if err := json.Unmarshal(r, &jsonVal); err != nil {
+		t.Fatalf("Unable to get new label from split.  Instead got: %v\n", jsonVal)
+	}
+	if err := datastore.BlockOnUpdating(uuid, "mysynapses"); err != nil {
+		t.Fatalf("Error blocking on sync of synapses: %v\n", err)
+	}
+	split := Connections{{Pre: 1, Post: jsonVal.Label, Weight: 2}, {Pre: 2, Post: 4, Weight: 1}}
+	testConnections(t, split, connURL)
+	testConnections(t, split[0:1], "%s?post=%d", connURL, jsonVal.Label)
+
+	// Deleting a PostSyn element should lower the weight.
+	delurl := fmt.Sprintf("%snode/%s/mysynapses/element/20_30_40", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "DELETE", delurl, nil)
+	split[0].Weight = 1
+	testConnections(t, split, connURL)
+
+	// Rebuilding the index should give the same connections.
+	d, err := GetByUUIDName(uuid, "mysynapses")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := datastore.NewVersionedCtx(d, v)
+	if err := d.rebuildConnections(ctx); err != nil {
+		t.Fatalf("error rebuilding connections: %v\n", err)
+	}
+	testConnections(t, split, connURL)
+
+	// Moves of a PostSyn within its partner's block and of a PreSyn to another block should
+	// incrementally give the same connections as a rebuild.
+	moveurl := fmt.Sprintf("%snode/%s/mysynapses/move/14_25_37/88_47_81", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", moveurl, nil)
+	moveurl = fmt.Sprintf("%snode/%s/mysynapses/move/127_63_99/100_60_90", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", moveurl, nil)
+	var moved Connections
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", connURL, nil), &moved); err != nil {
+		t.Fatalf("unable to decode connections: %v\n", err)
+	}
+	if reflect.DeepEqual(moved, split) {
+		t.Fatalf("expected moves to change connections, got %v\n", moved)
+	}
+	if err := d.rebuildConnections(ctx); err != nil {
+		t.Fatalf("error rebuilding connections: %v\n", err)
+	}
+	testConnections(t, moved, connURL)
+
+	// Deleting the PreSyn element removes all connections from its label.
+	delurl = fmt.Sprintf("%snode/%s/mysynapses/element/15_27_35", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "DELETE", delurl, nil)
+	testConnections(t, nil, connURL+"?pre=1")
+}
+
 func testLabelsReload(t *testing.T, uuid dvid.UUID, labelblkName, labelvolName dvid.InstanceName) {
 	// Test if labels were properly denormalized.  For the POST we have synchronized label denormalization.
 
@@ -2011,3 +2326,509 @@ var (
 	bodysplit = bodies[6]
 	svsplit   = bodies[7]
 )
+
+func TestBulkAll(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelmap", "mylabelmap", config)
+	_ = createLabelTestVolume(t, uuid, "mylabelmap")
+	if err := datastore.BlockOnUpdating(uuid, "mylabelmap"); err != nil {
+		t.Fatalf("Error blocking on labels updating: %v\n", err)
+	}
+	server.CreateTestInstance(t, uuid, "annotation", "mysynapses", config)
+	server.CreateTestSync(t, uuid, "mysynapses", "mylabelmap")
+
+	testJSON, err := json.Marshal(testData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := fmt.Sprintf("%snode/%s/mysynapses/elements", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", url, bytes.NewBuffer(testJSON))
+
+	allURL := fmt.Sprintf("%snode/%s/mysynapses/all", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", allURL+"?format=foo", nil)
+
+	// Check ndjson export with labels.
+	ndjson := server.TestHTTP(t, "GET", allURL+"?format=ndjson&labels=true", nil)
+	expectedLabels := map[string]uint64{
+		dvid.Point3d{15, 27, 35}.MapKey(): 1,
+		dvid.Point3d{20, 30, 40}.MapKey(): 2,
+		dvid.Point3d{14, 25, 37}.MapKey(): 3,
+	}
+	got := Elements{}
+	for _, line := range strings.Split(strings.TrimSpace(string(ndjson)), "\n") {
+		var elem bulkElement
+		if err := json.Unmarshal([]byte(line), &elem); err != nil {
+			t.Fatalf("bad ndjson line %q: %v\n", line, err)
+		}
+		if elem.Label == nil || elem.Supervoxel != nil {
+			t.Fatalf("expected only label in ndjson line: %s\n", line)
+		}
+		if label, found := expectedLabels[elem.Pos.MapKey()]; found && label != *elem.Label {
+			t.Fatalf("expected label %d for element %s, got %d\n", label, elem.Pos, *elem.Label)
+		}
+		got = append(got, elem.Element)
+	}
+	if !reflect.DeepEqual(testData.Normalize(), got.Normalize()) {
+		t.Fatalf("bad ndjson export.  Expected:\n%v\nGot:\n%v\n", testData.Normalize(), got.Normalize())
+	}
+
+	// Check csv export has label and supervoxel columns.
+	csvData := server.TestHTTP(t, "GET", allURL+"?format=csv&labels=true&supervoxels=true", nil)
+	lines := strings.Split(strings.TrimSpace(string(csvData)), "\n")
+	if lines[0] != "x,y,z,kind,tags,props,rels,label,supervoxel" {
+		t.Fatalf("bad csv header: %s\n", lines[0])
+	}
+	if len(lines) != len(testData)+1 {
+		t.Fatalf("expected %d csv rows, got %d\n", len(testData), len(lines)-1)
+	}
+
+	// Check arrow export with labels and supervoxels.
+	arrowData := server.TestHTTP(t, "GET", allURL+"?format=arrow&labels=true&supervoxels=true", nil)
+	got, err = readArrowElements(bytes.NewReader(arrowData))
+	if err != nil {
+		t.Fatalf("bad arrow export: %v\n", err)
+	}
+	if !reflect.DeepEqual(testData.Normalize(), got.Normalize()) {
+		t.Fatalf("bad arrow export.  Expected:\n%v\nGot:\n%v\n", testData.Normalize(), got.Normalize())
+	}
+
+	// Round-trip exports through bulk POST, including tags with separators.
+	tagged := Elements{
+		{ElementNR{Pos: dvid.Point3d{5, 6, 7}, Kind: Note, Tags: Tags{"a;b", `c\d`, "e"}}, nil},
+	}
+	taggedJSON, err := json.Marshal(tagged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TestHTTP(t, "POST", url, bytes.NewBuffer(taggedJSON))
+	expectedAll := append(append(Elements{}, testData...), tagged...)
+	for _, format := range []string{"csv", "ndjson", "arrow"} {
+		name := "bulk" + format
+		server.CreateTestInstance(t, uuid, "annotation", name, config)
+		exported := server.TestHTTP(t, "GET", allURL+"?format="+format, nil)
+		bulkURL := fmt.Sprintf("%snode/%s/%s/all?format=%s", server.WebAPIPath, uuid, name, format)
+		server.TestHTTP(t, "POST", bulkURL, bytes.NewBuffer(exported))
+		testResponse(t, expectedAll, "%snode/%s/%s/elements/1000_1000_1000/0_0_0", server.WebAPIPath, uuid, name)
+		server.TestBadHTTP(t, "GET", bulkURL+"&labels=true", nil)
+	}
+
+	// Check csv import with reordered and missing columns.
+	csvPost := "kind,z,y,x,tags\nPreSyn,3,2,1,a;b\nNote,30,20,10,\n"
+	server.CreateTestInstance(t, uuid, "annotation", "bulkcsv2", config)
+	bulkURL := fmt.Sprintf("%snode/%s/bulkcsv2/all?format=csv", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", bulkURL, strings.NewReader(csvPost))
+	expected := Elements{
+		{ElementNR{Pos: dvid.Point3d{1, 2, 3}, Kind: PreSyn, Tags: Tags{"a", "b"}}, nil},
+		{ElementNR{Pos: dvid.Point3d{10, 20, 30}, Kind: Note}, nil},
+	}
+	testResponse(t, expected, "%snode/%s/bulkcsv2/elements/100_100_100/0_0_0", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "POST", bulkURL, strings.NewReader("x,y,z\n1,2,3\n"))
+	server.TestBadHTTP(t, "POST", bulkURL, strings.NewReader("x,y,z,kind\n1,2,foo,PreSyn\n"))
+	server.TestBadHTTP(t, "POST", bulkURL, strings.NewReader("x,y,z,kind\n1,2,3,Foo\n"))
+	server.TestBadHTTP(t, "POST", bulkURL, strings.NewReader("x,y,z,kind,tags\n1,2,3,Note,a\\\n"))
+	arrowURL := fmt.Sprintf("%snode/%s/bulkcsv2/all?format=arrow", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "POST", arrowURL, bytes.NewReader(arrowData[:len(arrowData)/2]))
+
+	// Check arrow import of a compressed stream with int64 coordinates and dictionary-encoded kinds.
+	kindType := &arrow.DictionaryType{IndexType: arrow.PrimitiveTypes.Int8, ValueType: arrow.BinaryTypes.String}
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "kind", Type: kindType},
+		{Name: "x", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "y", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "z", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "score", Type: arrow.PrimitiveTypes.Float64},
+	}, nil)
+	rb := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer rb.Release()
+	for i, kind := range []string{"PreSyn", "Note", "PreSyn"} {
+		if err := rb.Field(0).(*array.BinaryDictionaryBuilder).AppendString(kind); err != nil {
+			t.Fatal(err)
+		}
+		for dim := 1; dim <= 3; dim++ {
+			rb.Field(dim).(*array.Int64Builder).Append(int64(100*i + dim))
+		}
+		rb.Field(4).(*array.Float64Builder).Append(0.5)
+	}
+	rec := rb.NewRecord()
+	defer rec.Release()
+	var buf bytes.Buffer
+	aw := ipc.NewWriter(&buf, ipc.WithSchema(schema), ipc.WithLZ4())
+	if err := aw.Write(rec); err != nil {
+		t.Fatal(err)
+	}
+	if err := aw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	server.CreateTestInstance(t, uuid, "annotation", "bulkarrow2", config)
+	arrowURL = fmt.Sprintf("%snode/%s/bulkarrow2/all?format=arrow", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", arrowURL, &buf)
+	expected = Elements{
+		{ElementNR{Pos: dvid.Point3d{1, 2, 3}, Kind: PreSyn}, nil},
+		{ElementNR{Pos: dvid.Point3d{101, 102, 103}, Kind: Note}, nil},
+		{ElementNR{Pos: dvid.Point3d{201, 202, 203}, Kind: PreSyn}, nil},
+	}
+	testResponse(t, expected, "%snode/%s/bulkarrow2/elements/300_300_300/0_0_0", server.WebAPIPath, uuid)
+}
+
+func testIntegrity(t *testing.T, expected IntegrityReport, template string, args ...interface{}) {
+	url := fmt.Sprintf(template, args...)
+	returnValue := server.TestHTTP(t, "GET", url, nil)
+	var got IntegrityReport
+	if err := json.Unmarshal(returnValue, &got); err != nil {
+		t.Fatal(err)
+	}
+	for _, rels := range []*[]RelViolation{&expected.OrphanedRels, &expected.AsymmetricRels} {
+		if *rels == nil {
+			*rels = []RelViolation{}
+		}
+	}
+	if expected.DuplicatePositions == nil {
+		expected.DuplicatePositions = []dvid.Point3d{}
+	}
+	if expected.MisplacedElements == nil {
+		expected.MisplacedElements = []MisplacedElement{}
+	}
+	if !reflect.DeepEqual(expected, got) {
+		_, fn, line, _ := runtime.Caller(1)
+		t.Fatalf("Expected integrity report for %s [%s:%d]:\n%v\nGot:\n%v\n", url, fn, line, expected, got)
+	}
+}
+
+func TestValidation(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, v := initTestRepo()
+	var config dvid.Config
+	config.Set("Validation", "strict")
+	server.CreateTestInstance(t, uuid, "annotation", "mysynapses", config)
+
+	validationURL := fmt.Sprintf("%snode/%s/mysynapses/validation", server.WebAPIPath, uuid)
+	if returnValue := server.TestHTTP(t, "GET", validationURL, nil); string(returnValue) != `{"Mode":"strict"}` {
+		t.Fatalf("Expected strict validation mode, got %s\n", string(returnValue))
+	}
+	server.TestBadHTTP(t, "POST", validationURL, strings.NewReader(`{"Mode": "sometimes"}`))
+
+	elemsURL := fmt.Sprintf("%snode/%s/mysynapses/elements", server.WebAPIPath, uuid)
+	integrityURL := fmt.Sprintf("%snode/%s/mysynapses/integrity", server.WebAPIPath, uuid)
+	pre := `{"Pos":[10,10,10],"Kind":"PreSyn","Rels":[{"Rel":"PreSynTo","To":[20,10,10]}]}`
+	post := `{"Pos":[20,10,10],"Kind":"PostSyn","Rels":[{"Rel":"PostSynTo","To":[10,10,10]}]}`
+	server.TestBadHTTP(t, "POST", elemsURL, strings.NewReader("["+pre+"]"))
+	server.TestBadHTTP(t, "POST", elemsURL, strings.NewReader("["+pre+","+post+","+post+"]"))
+	server.TestHTTP(t, "POST", elemsURL, strings.NewReader("["+pre+","+post+"]"))
+	testIntegrity(t, IntegrityReport{NumElements: 2}, integrityURL)
+
+	// Replacing an element cannot drop a relationship its partner keeps.
+	server.TestBadHTTP(t, "POST", elemsURL, strings.NewReader(`[{"Pos":[20,10,10],"Kind":"PostSyn"}]`))
+	server.TestBadHTTP(t, "POST", elemsURL, strings.NewReader(`[{"Pos":[30,10,10],"Kind":"Note","Rels":[{"Rel":"GroupedWith","To":[90,90,90]}]}]`))
+
+	// Moves cannot replace another element.
+	server.TestBadHTTP(t, "POST", fmt.Sprintf("%snode/%s/mysynapses/move/20_10_10/10_10_10", server.WebAPIPath, uuid), nil)
+	server.TestHTTP(t, "POST", fmt.Sprintf("%snode/%s/mysynapses/move/20_10_10/21_10_10", server.WebAPIPath, uuid), nil)
+	testIntegrity(t, IntegrityReport{NumElements: 2}, integrityURL)
+
+	// Violations are allowed but logged in warn mode.
+	server.TestHTTP(t, "POST", validationURL, strings.NewReader(`{"Mode": "warn"}`))
+	server.TestHTTP(t, "POST", elemsURL, strings.NewReader(`[{"Pos":[30,10,10],"Kind":"Note","Rels":[{"Rel":"GroupedWith","To":[10,10,10]},{"Rel":"GroupedWith","To":[90,90,90]}]}]`))
+	testIntegrity(t, IntegrityReport{
+		NumElements:    3,
+		OrphanedRels:   []RelViolation{{dvid.Point3d{30, 10, 10}, GroupedWith, dvid.Point3d{90, 90, 90}}},
+		AsymmetricRels: []RelViolation{{dvid.Point3d{30, 10, 10}, GroupedWith, dvid.Point3d{10, 10, 10}}},
+	}, integrityURL)
+
+	// Deletes of elements with unreciprocated relationships are rejected in strict mode.
+	server.TestHTTP(t, "POST", validationURL, strings.NewReader(`{"Mode": "strict"}`))
+	deleteURL := fmt.Sprintf("%snode/%s/mysynapses/element/30_10_10", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "DELETE", deleteURL, nil)
+	server.TestHTTP(t, "POST", validationURL, strings.NewReader(`{"Mode": "off"}`))
+	server.TestHTTP(t, "DELETE", deleteURL, nil)
+	testIntegrity(t, IntegrityReport{NumElements: 2}, integrityURL)
+
+	// Deletes find partners whose relationships to the deleted element aren't reciprocated,
+	// rejecting the delete in strict mode and removing the relationships in warn mode.
+	server.TestHTTP(t, "POST", validationURL, strings.NewReader(`{"Mode": "warn"}`))
+	server.TestHTTP(t, "POST", elemsURL, strings.NewReader(`[{"Pos":[40,10,10],"Kind":"Note","Rels":[{"Rel":"GroupedWith","To":[10,10,10]}]}]`))
+	server.TestHTTP(t, "POST", validationURL, strings.NewReader(`{"Mode": "strict"}`))
+	deleteURL = fmt.Sprintf("%snode/%s/mysynapses/element/10_10_10", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "DELETE", deleteURL, nil)
+	server.TestHTTP(t, "POST", validationURL, strings.NewReader(`{"Mode": "warn"}`))
+	server.TestHTTP(t, "DELETE", deleteURL, nil)
+	testIntegrity(t, IntegrityReport{NumElements: 2}, integrityURL)
+
+	server.TestHTTP(t, "POST", validationURL, strings.NewReader(`{"Mode": "off"}`))
+	server.TestHTTP(t, "DELETE", fmt.Sprintf("%snode/%s/mysynapses/element/40_10_10", server.WebAPIPath, uuid), nil)
+	server.TestHTTP(t, "DELETE", fmt.Sprintf("%snode/%s/mysynapses/element/21_10_10", server.WebAPIPath, uuid), nil)
+	post = `{"Pos":[21,10,10],"Kind":"PostSyn","Rels":[{"Rel":"PostSynTo","To":[10,10,10]}]}`
+	pre = `{"Pos":[10,10,10],"Kind":"PreSyn","Rels":[{"Rel":"PreSynTo","To":[21,10,10]}]}`
+	server.TestHTTP(t, "POST", elemsURL, strings.NewReader("["+pre+","+post+"]"))
+	testIntegrity(t, IntegrityReport{NumElements: 2}, integrityURL)
+
+	// Unvalidated moves can create duplicate positions.
+	server.TestHTTP(t, "POST", fmt.Sprintf("%snode/%s/mysynapses/move/21_10_10/10_10_10", server.WebAPIPath, uuid), nil)
+	testIntegrity(t, IntegrityReport{
+		NumElements:        2,
+		AsymmetricRels:     []RelViolation{{dvid.Point3d{10, 10, 10}, PostSynTo, dvid.Point3d{10, 10, 10}}},
+		DuplicatePositions: []dvid.Point3d{{10, 10, 10}},
+	}, integrityURL)
+
+	// Check elements stored outside their block.
+	d, err := GetByUUIDName(uuid, "mysynapses")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := datastore.NewVersionedCtx(d, v)
+	misplaced := Elements{{ElementNR{Pos: dvid.Point3d{100, 10, 10}, Kind: Note}, nil}}
+	if err := putElements(ctx, NewBlockTKey(dvid.ChunkPoint3d{0, 0, 0}), misplaced); err != nil {
+		t.Fatal(err)
+	}
+	testIntegrity(t, IntegrityReport{
+		NumElements:       1,
+		MisplacedElements: []MisplacedElement{{dvid.Point3d{100, 10, 10}, dvid.ChunkPoint3d{0, 0, 0}}},
+	}, integrityURL)
+}
+
+func TestCustomKinds(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("ElementKinds", "Mito,SomaCenter")
+	config.Set("RelationTypes", "InsideOf")
+	server.CreateTestInstance(t, uuid, "annotation", "mysynapses", config)
+
+	config.Set("ElementKinds", "Bookmark")
+	config.Set("RelationTypes", "")
+	server.CreateTestInstance(t, uuid, "annotation", "other", config)
+
+	kindsURL := fmt.Sprintf("%snode/%s/mysynapses/kinds", server.WebAPIPath, uuid)
+	if returnValue := server.TestHTTP(t, "GET", kindsURL, nil); string(returnValue) != `{"ElementKinds":["Mito","SomaCenter"],"RelationTypes":["InsideOf"]}` {
+		t.Fatalf("Expected custom kinds, got %s\n", string(returnValue))
+	}
+
+	elems := `[{"Pos":[10,10,10],"Kind":"SomaCenter","Tags":[],"Prop":{},"Rels":[]},` +
+		`{"Pos":[20,10,10],"Kind":"Mito","Tags":[],"Prop":{},"Rels":[{"Rel":"InsideOf","To":[10,10,10]}]}]`
+	elemsURL := fmt.Sprintf("%snode/%s/mysynapses/elements", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", elemsURL, strings.NewReader(elems))
+	var expected Elements
+	if err := json.Unmarshal([]byte(elems), &expected); err != nil {
+		t.Fatal(err)
+	}
+	if expected[1].Kind != StringToElementType("Mito") || !expected[1].Kind.IsCustom() || expected[1].Kind.IsSynaptic() {
+		t.Fatalf("Bad custom element kind: %v\n", expected[1].Kind)
+	}
+	testResponse(t, expected, "%snode/%s/mysynapses/elements/100_100_100/0_0_0", server.WebAPIPath, uuid)
+
+	// Kinds and relation types must be registered for the instance.
+	bookmark := `[{"Pos":[30,10,10],"Kind":"Bookmark"}]`
+	server.TestBadHTTP(t, "POST", elemsURL, strings.NewReader(`[{"Pos":[30,10,10],"Kind":"Golgi"}]`))
+	server.TestBadHTTP(t, "POST", elemsURL, strings.NewReader(bookmark))
+	server.TestBadHTTP(t, "POST", fmt.Sprintf("%snode/%s/other/elements", server.WebAPIPath, uuid),
+		strings.NewReader(`[{"Pos":[30,10,10],"Kind":"Bookmark","Rels":[{"Rel":"InsideOf","To":[10,10,10]}]}]`))
+	server.TestHTTP(t, "POST", fmt.Sprintf("%snode/%s/other/elements", server.WebAPIPath, uuid), strings.NewReader(bookmark))
+
+	server.TestBadHTTP(t, "POST", kindsURL, strings.NewReader(`{"ElementKinds":["PreSyn"]}`))
+	server.TestBadHTTP(t, "POST", kindsURL, strings.NewReader(`{"RelationTypes":["bad name"]}`))
+	server.TestHTTP(t, "POST", kindsURL, strings.NewReader(`{"ElementKinds":["Bookmark","Mito"]}`))
+	if returnValue := server.TestHTTP(t, "GET", kindsURL, nil); string(returnValue) != `{"ElementKinds":["Mito","SomaCenter","Bookmark"],"RelationTypes":["InsideOf"]}` {
+		t.Fatalf("Expected added custom kinds, got %s\n", string(returnValue))
+	}
+	server.TestHTTP(t, "POST", elemsURL, strings.NewReader(bookmark))
+
+	// Custom kinds can be used for filtering.
+	radiusURL := fmt.Sprintf("%snode/%s/mysynapses/radius/0_10_10/100?kind=Mito", server.WebAPIPath, uuid)
+	testDistances(t, []dvid.Point3d{{20, 10, 10}}, radiusURL)
+}
+
+func testShapes(t *testing.T, expected []dvid.Point3d, template string, args ...interface{}) Shapes {
+	_, fn, line, _ := runtime.Caller(1)
+	url := fmt.Sprintf(template, args...)
+	returnValue := server.TestHTTP(t, "GET", url, nil)
+	var got Shapes
+	if err := json.Unmarshal(returnValue, &got); err != nil {
+		t.Fatalf("Error on unmarshal of shapes from %s: %v [%s:%d]\n", url, err, fn, line)
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %d shapes from %s, got %d: %s [%s:%d]\n", len(expected), url, len(got), string(returnValue), fn, line)
+	}
+	for i, shape := range got {
+		if !shape.Anchor.Equals(expected[i]) {
+			t.Fatalf("Expected shape %d from %s to have anchor %s, got %s [%s:%d]\n", i, url, expected[i], shape.Anchor, fn, line)
+		}
+	}
+	return got
+}
+
+var testShapesJSON = `[
+	{"Kind": "Polyline", "Points": [[14,25,37], [20,25,37], [20,28,39]], "Tags": ["trace"]},
+	{"Kind": "Box", "Min": [12,30,40], "Max": [20,30,40], "Prop": {"user": "bob"}},
+	{"Kind": "Ellipsoid", "Center": [88,47,80], "Radii": [4,4,4]},
+	{"Kind": "Box", "Min": [100,100,100], "Max": [110,110,110]},
+	{"Kind": "Polyline", "Points": [[60,5,5], [60,120,5]]}
+]`
+
+func TestShapes(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelmap", "mylabelmap", config)
+	_ = createLabelTestVolume(t, uuid, "mylabelmap")
+	if err := datastore.BlockOnUpdating(uuid, "mylabelmap"); err != nil {
+		t.Fatalf("Error blocking on labels updating: %v\n", err)
+	}
+
+	server.CreateTestInstance(t, uuid, "annotation", "mysynapses", config)
+	server.CreateTestSync(t, uuid, "mysynapses", "mylabelmap")
+
+	shapesURL := fmt.Sprintf("%snode/%s/mysynapses/shapes", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "POST", shapesURL, strings.NewReader(`[{"Kind": "Polyline", "Points": [[1,2,3]]}]`))
+	server.TestBadHTTP(t, "POST", shapesURL, strings.NewReader(`[{"Kind": "Box", "Min": [5,5,5], "Max": [4,6,6]}]`))
+	server.TestBadHTTP(t, "POST", shapesURL, strings.NewReader(`[{"Kind": "Ellipsoid", "Center": [5,5,5], "Radii": [1,0,1]}]`))
+	server.TestBadHTTP(t, "POST", shapesURL, strings.NewReader(`[{"Kind": "Sphere", "Center": [5,5,5]}]`))
+	server.TestBadHTTP(t, "POST", shapesURL, strings.NewReader(`[{"Kind": "Ellipsoid", "Center": [5,5,5], "Radii": [1,1e300,1]}]`))
+	server.TestBadHTTP(t, "POST", shapesURL, strings.NewReader(`[{"Kind": "Ellipsoid", "Center": [2147483000,5,5], "Radii": [1000,1,1]}]`))
+	server.TestBadHTTP(t, "POST", shapesURL, strings.NewReader(`[{"Kind": "Box", "Min": [-2000000000,0,0], "Max": [2000000000,0,0]}]`))
+	server.TestBadHTTP(t, "POST", shapesURL, strings.NewReader(`[{"ID": 12345, "Kind": "Box", "Min": [5,5,5], "Max": [6,6,6]}]`))
+	testShapes(t, nil, "%s/128_128_128/0_0_0", shapesURL)
+
+	r := server.TestHTTP(t, "POST", shapesURL, strings.NewReader(testShapesJSON))
+	var ids []uint64
+	if err := json.Unmarshal(r, &ids); err != nil {
+		t.Fatalf("unable to decode shape IDs from POST: %v\n", err)
+	}
+	if len(ids) != 5 {
+		t.Fatalf("expected 5 shape IDs from POST, got %v\n", ids)
+	}
+	idSet := make(map[uint64]struct{}, len(ids))
+	for _, id := range ids {
+		if id == 0 {
+			t.Fatalf("expected nonzero shape IDs, got %v\n", ids)
+		}
+		idSet[id] = struct{}{}
+	}
+	if len(idSet) != len(ids) {
+		t.Fatalf("expected unique shape IDs, got %v\n", ids)
+	}
+	polyAnchor := dvid.Point3d{14, 25, 37}
+	boxAnchor := dvid.Point3d{16, 30, 40}
+	ellipsoidAnchor := dvid.Point3d{88, 47, 80}
+	farAnchor := dvid.Point3d{105, 105, 105}
+	longAnchor := dvid.Point3d{60, 5, 5}
+
+	// Subvolume queries use exact shape geometry rather than just block indices.
+	got := testShapes(t, []dvid.Point3d{longAnchor, polyAnchor, boxAnchor, ellipsoidAnchor, farAnchor}, "%s/128_128_128/0_0_0", shapesURL)
+	if got[1].Kind != Polyline || len(got[1].Points) != 3 || len(got[1].Tags) != 1 || got[1].Tags[0] != "trace" {
+		t.Fatalf("bad polyline returned: %v\n", got[1])
+	}
+	if got[2].Kind != Box || got[2].Prop["user"] != "bob" {
+		t.Fatalf("bad box returned: %v\n", got[2])
+	}
+	if got[1].ID != ids[0] || got[2].ID != ids[1] || got[3].ID != ids[2] {
+		t.Fatalf("expected returned shapes to have POSTed IDs %v: %v\n", ids, got)
+	}
+	testShapes(t, []dvid.Point3d{longAnchor}, "%s/10_10_10/55_50_0", shapesURL)
+	testShapes(t, nil, "%s/10_10_10/70_50_0", shapesURL)
+	testShapes(t, []dvid.Point3d{polyAnchor}, "%s/2_2_2/19_27_38", shapesURL)
+	testShapes(t, []dvid.Point3d{ellipsoidAnchor}, "%s/5_5_5/92_47_80", shapesURL)
+	testShapes(t, nil, "%s/5_5_5/93_47_80", shapesURL)
+
+	// ROI queries are at block resolution.
+	server.CreateTestInstance(t, uuid, "roi", "myroi", dvid.Config{})
+	apiStr := fmt.Sprintf("%snode/%s/myroi/roi", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", apiStr, bytes.NewBufferString(labelsJSON()))
+	roiURL := fmt.Sprintf("%snode/%s/mysynapses/shapes-roi", server.WebAPIPath, uuid)
+	testShapes(t, []dvid.Point3d{polyAnchor, boxAnchor, ellipsoidAnchor}, "%s/myroi", roiURL)
+	testShapes(t, []dvid.Point3d{polyAnchor, boxAnchor, ellipsoidAnchor}, "%s/myroi,%s", roiURL, uuid)
+
+	// Label lookups use the label at each anchor.
+	labelURL := fmt.Sprintf("%snode/%s/mysynapses/shapes-label", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", labelURL+"/0", nil)
+	got = testShapes(t, []dvid.Point3d{polyAnchor}, "%s/3", labelURL)
+	if got[0].Label != 3 {
+		t.Fatalf("expected polyline to have label 3, got %d\n", got[0].Label)
+	}
+	testShapes(t, []dvid.Point3d{boxAnchor}, "%s/2", labelURL)
+	testShapes(t, []dvid.Point3d{ellipsoidAnchor}, "%s/4", labelURL)
+
+	// Replacing a shape by ID removes its old block index.
+	replaceJSON := fmt.Sprintf(`[{"ID": %d, "Kind": "Ellipsoid", "Center": [88,47,80], "Radii": [2,2,2]}]`, ids[2])
+	server.TestHTTP(t, "POST", shapesURL, strings.NewReader(replaceJSON))
+	testShapes(t, nil, "%s/5_5_5/92_47_80", shapesURL)
+	got = testShapes(t, []dvid.Point3d{ellipsoidAnchor}, "%s/4", labelURL)
+	if got[0].ID != ids[2] || (*got[0].Radii)[0] != 2 {
+		t.Fatalf("expected replaced ellipsoid with ID %d, got %v\n", ids[2], got[0])
+	}
+	dupJSON := fmt.Sprintf(`[%s, %s]`, replaceJSON[1:len(replaceJSON)-1], replaceJSON[1:len(replaceJSON)-1])
+	server.TestBadHTTP(t, "POST", shapesURL, strings.NewReader(dupJSON))
+
+	// Shapes sharing an anchor are stored separately.
+	r = server.TestHTTP(t, "POST", shapesURL, strings.NewReader(`[{"Kind": "Ellipsoid", "Center": [88,47,80], "Radii": [3,1,1]}]`))
+	var sharedIDs []uint64
+	if err := json.Unmarshal(r, &sharedIDs); err != nil || len(sharedIDs) != 1 {
+		t.Fatalf("unable to decode shape ID from POST: %s\n", string(r))
+	}
+	got = testShapes(t, []dvid.Point3d{ellipsoidAnchor, ellipsoidAnchor}, "%s/4", labelURL)
+	if got[0].ID != ids[2] || got[1].ID != sharedIDs[0] {
+		t.Fatalf("expected shapes %d and %d at shared anchor, got %v\n", ids[2], sharedIDs[0], got)
+	}
+	delURL := fmt.Sprintf("%snode/%s/mysynapses/shape", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "DELETE", fmt.Sprintf("%s/%d", delURL, sharedIDs[0]), nil)
+	testShapes(t, []dvid.Point3d{ellipsoidAnchor}, "%s/4", labelURL)
+
+	// Merge 3 into 2 and make sure the polyline moves to label 2.
+	testMerge := mergeJSON(`[2, 3]`)
+	testMerge.send(t, uuid, "mylabelmap")
+	if err := datastore.BlockOnUpdating(uuid, "mysynapses"); err != nil {
+		t.Fatalf("Error blocking on sync of synapses: %v\n", err)
+	}
+	testShapes(t, nil, "%s/3", labelURL)
+	got = testShapes(t, []dvid.Point3d{polyAnchor, boxAnchor}, "%s/2", labelURL)
+	if got[0].Label != 2 || got[1].Label != 2 {
+		t.Fatalf("expected merged shapes to have label 2: %v\n", got)
+	}
+
+	// Split off the box anchor from label 2.
+	rles := dvid.RLEs{
+		dvid.NewRLE(dvid.Point3d{14, 30, 40}, 5),
+	}
+	reqStr := fmt.Sprintf("%snode/%s/mylabelmap/split/2", server.WebAPIPath, uuid)
+	r = server.TestHTTP(t, "POST", reqStr, getBytesRLE(t, rles))
+	var jsonVal struct {
+		Label uint64
+	}
+	if err := json.Unmarshal(r, &jsonVal); err != nil {
+		t.Fatalf("Unable to get new label from split.  Instead got: %v\n", jsonVal)
+	}
+	if err := datastore.BlockOnUpdating(uuid, "mysynapses"); err != nil {
+		t.Fatalf("Error blocking on sync of synapses: %v\n", err)
+	}
+	testShapes(t, []dvid.Point3d{polyAnchor}, "%s/2", labelURL)
+	got = testShapes(t, []dvid.Point3d{boxAnchor}, "%s/%d", labelURL, jsonVal.Label)
+	if got[0].Label != jsonVal.Label {
+		t.Fatalf("expected split box to have label %d, got %d\n", jsonVal.Label, got[0].Label)
+	}
+
+	// Delete the box.
+	server.TestHTTP(t, "DELETE", fmt.Sprintf("%s/%d", delURL, ids[1]), nil)
+	server.TestBadHTTP(t, "DELETE", fmt.Sprintf("%s/%d", delURL, ids[1]), nil)
+	server.TestBadHTTP(t, "DELETE", delURL+"/16_30_40", nil)
+	testShapes(t, nil, "%s/%d", labelURL, jsonVal.Label)
+	testShapes(t, []dvid.Point3d{longAnchor, polyAnchor, ellipsoidAnchor, farAnchor}, "%s/128_128_128/0_0_0", shapesURL)
+	testShapes(t, []dvid.Point3d{polyAnchor, ellipsoidAnchor}, "%s/myroi", roiURL)
+}
@@ -0,0 +1,294 @@
+/*
+	This file supports bulk export and import of elements in the Apache Arrow IPC streaming
+	format using the Apache Arrow Go library.
+*/
+
+package annotation
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/ipc"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+)
+
+// maximum number of elements in each exported record batch.
+const arrowBatchSize = 1 << 16
+
+// arrowSchema returns the columns of exported elements.  Coordinates are int32, kind is
+// utf8, tags is a list of utf8, props and rels are JSON in utf8, and the optional label
+// and supervoxel columns are uint64.
+func arrowSchema(opts BulkOptions) *arrow.Schema {
+	fields := []arrow.Field{
+		{Name: "x", Type: arrow.PrimitiveTypes.Int32},
+		{Name: "y", Type: arrow.PrimitiveTypes.Int32},
+		{Name: "z", Type: arrow.PrimitiveTypes.Int32},
+		{Name: "kind", Type: arrow.BinaryTypes.String},
+		{Name: "tags", Type: arrow.ListOf(arrow.BinaryTypes.String)},
+		{Name: "props", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "rels", Type: arrow.BinaryTypes.String, Nullable: true},
+	}
+	if opts.Labels {
+		fields = append(fields, arrow.Field{Name: "label", Type: arrow.PrimitiveTypes.Uint64})
+	}
+	if opts.Supervoxels {
+		fields = append(fields, arrow.Field{Name: "supervoxel", Type: arrow.PrimitiveTypes.Uint64})
+	}
+	return arrow.NewSchema(fields, nil)
+}
+
+// arrowWriter writes elements as an Arrow IPC stream, one record batch per
+// arrowBatchSize elements.
+type arrowWriter struct {
+	w    *ipc.Writer
+	b    *array.RecordBuilder
+	opts BulkOptions
+	n    int
+}
+
+func newArrowWriter(w io.Writer, opts BulkOptions) (*arrowWriter, error) {
+	schema := arrowSchema(opts)
+	return &arrowWriter{
+		w:    ipc.NewWriter(w, ipc.WithSchema(schema)),
+		b:    array.NewRecordBuilder(memory.DefaultAllocator, schema),
+		opts: opts,
+	}, nil
+}
+
+func (aw *arrowWriter) write(elem bulkElement) error {
+	for dim := 0; dim < 3; dim++ {
+		aw.b.Field(dim).(*array.Int32Builder).Append(elem.Pos[dim])
+	}
+	aw.b.Field(3).(*array.StringBuilder).Append(elem.Kind.String())
+	tags := aw.b.Field(4).(*array.ListBuilder)
+	tags.Append(true)
+	for _, tag := range elem.Tags {
+		tags.ValueBuilder().(*array.StringBuilder).Append(string(tag))
+	}
+	if err := appendArrowJSON(aw.b.Field(5).(*array.StringBuilder), len(elem.Prop) == 0, elem.Prop); err != nil {
+		return err
+	}
+	if err := appendArrowJSON(aw.b.Field(6).(*array.StringBuilder), len(elem.Rels) == 0, elem.Rels); err != nil {
+		return err
+	}
+	col := 7
+	if aw.opts.Labels {
+		aw.b.Field(col).(*array.Uint64Builder).Append(*elem.Label)
+		col++
+	}
+	if aw.opts.Supervoxels {
+		aw.b.Field(col).(*array.Uint64Builder).Append(*elem.Supervoxel)
+	}
+	if aw.n++; aw.n >= arrowBatchSize {
+		return aw.flush()
+	}
+	return nil
+}
+
+// appends the JSON of v, or null if v is empty.
+func appendArrowJSON(sb *array.StringBuilder, empty bool, v interface{}) error {
+	if empty {
+		sb.AppendNull()
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	sb.Append(string(b))
+	return nil
+}
+
+func (aw *arrowWriter) flush() error {
+	if aw.n == 0 {
+		return nil
+	}
+	rec := aw.b.NewRecord()
+	defer rec.Release()
+	aw.n = 0
+	return aw.w.Write(rec)
+}
+
+// close writes any remaining elements and the end-of-stream marker.
+func (aw *arrowWriter) close() error {
+	defer aw.b.Release()
+	if err := aw.flush(); err != nil {
+		return err
+	}
+	return aw.w.Close()
+}
+
+// arrowValue returns the array and row holding the value at row i of a column, looking
+// through any dictionary encoding.
+func arrowValue(col arrow.Array, i int) (arrow.Array, int) {
+	if dict, ok := col.(*array.Dictionary); ok {
+		return dict.Dictionary(), dict.GetValueIndex(i)
+	}
+	return col, i
+}
+
+// returns the integer at row i of a column, which must be in the int32 range.
+func arrowInt32(col arrow.Array, i int) (int32, error) {
+	if col.IsNull(i) {
+		return 0, fmt.Errorf("null coordinate")
+	}
+	col, i = arrowValue(col, i)
+	var v int64
+	switch a := col.(type) {
+	case *array.Int8:
+		v = int64(a.Value(i))
+	case *array.Int16:
+		v = int64(a.Value(i))
+	case *array.Int32:
+		v = int64(a.Value(i))
+	case *array.Int64:
+		v = a.Value(i)
+	case *array.Uint8:
+		v = int64(a.Value(i))
+	case *array.Uint16:
+		v = int64(a.Value(i))
+	case *array.Uint32:
+		v = int64(a.Value(i))
+	case *array.Uint64:
+		if a.Value(i) > math.MaxInt32 {
+			return 0, fmt.Errorf("coordinate %d out of int32 range", a.Value(i))
+		}
+		v = int64(a.Value(i))
+	default:
+		return 0, fmt.Errorf("coordinates must be integers, not %s", col.DataType())
+	}
+	if v < math.MinInt32 || v > math.MaxInt32 {
+		return 0, fmt.Errorf("coordinate %d out of int32 range", v)
+	}
+	return int32(v), nil
+}
+
+// returns the string at row i of a column and false if it is null.
+func arrowString(col arrow.Array, i int) (string, bool, error) {
+	if col.IsNull(i) {
+		return "", false, nil
+	}
+	col, i = arrowValue(col, i)
+	switch a := col.(type) {
+	case *array.String:
+		return a.Value(i), true, nil
+	case *array.LargeString:
+		return a.Value(i), true, nil
+	default:
+		return "", false, fmt.Errorf("expected utf8 values, not %s", col.DataType())
+	}
+}
+
+// returns the strings in the list at row i of a column.
+func arrowStrings(col arrow.Array, i int) ([]string, error) {
+	if col.IsNull(i) {
+		return nil, nil
+	}
+	list, ok := col.(array.ListLike)
+	if !ok {
+		return nil, fmt.Errorf("expected list of utf8, not %s", col.DataType())
+	}
+	beg, end := list.ValueOffsets(i)
+	strs := make([]string, 0, end-beg)
+	for j := beg; j < end; j++ {
+		s, valid, err := arrowString(list.ListValues(), int(j))
+		if err != nil {
+			return nil, err
+		}
+		if valid {
+			strs = append(strs, s)
+		}
+	}
+	return strs, nil
+}
+
+// readArrowBatch returns the elements in a record batch.
+func readArrowBatch(rec arrow.Record) (Elements, error) {
+	cols := make(map[string]arrow.Array, rec.NumCols())
+	for i, f := range rec.Schema().Fields() {
+		cols[f.Name] = rec.Column(i)
+	}
+	elems := make(Elements, rec.NumRows())
+	for i := range elems {
+		elem := &elems[i]
+		for dim, name := range []string{"x", "y", "z"} {
+			v, err := arrowInt32(cols[name], i)
+			if err != nil {
+				return nil, fmt.Errorf("bad %s in arrow row %d: %v", name, i, err)
+			}
+			elem.Pos[dim] = v
+		}
+		kind, valid, err := arrowString(cols["kind"], i)
+		if err != nil {
+			return nil, fmt.Errorf("bad kind in arrow row %d: %v", i, err)
+		}
+		if !valid {
+			return nil, fmt.Errorf("null element kind in arrow row %d", i)
+		}
+		if elem.Kind = StringToElementType(kind); elem.Kind == UnknownElem {
+			return nil, fmt.Errorf("unknown element kind %q in arrow row %d", kind, i)
+		}
+		if col, found := cols["tags"]; found {
+			tags, err := arrowStrings(col, i)
+			if err != nil {
+				return nil, fmt.Errorf("bad tags in arrow row %d: %v", i, err)
+			}
+			for _, tag := range tags {
+				elem.Tags = append(elem.Tags, Tag(tag))
+			}
+		}
+		for _, field := range []struct {
+			name string
+			dst  interface{}
+		}{
+			{"props", &elem.Prop},
+			{"rels", &elem.Rels},
+		} {
+			col, found := cols[field.name]
+			if !found {
+				continue
+			}
+			s, valid, err := arrowString(col, i)
+			if err == nil && valid && s != "" {
+				err = json.Unmarshal([]byte(s), field.dst)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("bad %s in arrow row %d: %v", field.name, i, err)
+			}
+		}
+	}
+	return elems, nil
+}
+
+// readArrowElements reads all elements from an Arrow IPC stream.  Only the x, y, z, and
+// kind columns are required.  Coordinates may be any integer type with values in the
+// int32 range, and columns other than x, y, z, kind, tags, props, and rels are ignored.
+func readArrowElements(r io.Reader) (Elements, error) {
+	reader, err := ipc.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read arrow stream: %v", err)
+	}
+	defer reader.Release()
+	for _, name := range []string{"x", "y", "z", "kind"} {
+		if !reader.Schema().HasField(name) {
+			return nil, fmt.Errorf("arrow schema must include %q column", name)
+		}
+	}
+	elems := Elements{}
+	for reader.Next() {
+		batch, err := readArrowBatch(reader.Record())
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, batch...)
+	}
+	if err := reader.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read arrow stream: %v", err)
+	}
+	return elems, nil
+}
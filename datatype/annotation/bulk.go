@@ -0,0 +1,399 @@
+/*
+	This file supports bulk export and import of all elements in CSV, newline-delimited JSON,
+	and Apache Arrow IPC streams.
+*/
+
+package annotation
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// BulkFormat is a format for bulk export and import of elements.
+type BulkFormat string
+
+const (
+	BulkCSV    BulkFormat = "csv"
+	BulkNDJSON BulkFormat = "ndjson"
+	BulkArrow  BulkFormat = "arrow"
+)
+
+// NewBulkFormat returns a supported bulk format from a string, defaulting to ndjson
+// if the string is empty.
+func NewBulkFormat(s string) (BulkFormat, error) {
+	switch BulkFormat(s) {
+	case "", BulkNDJSON:
+		return BulkNDJSON, nil
+	case BulkCSV:
+		return BulkCSV, nil
+	case BulkArrow:
+		return BulkArrow, nil
+	default:
+		return "", fmt.Errorf("unknown bulk format %q, must be csv, ndjson, or arrow", s)
+	}
+}
+
+// ContentType returns the HTTP Content-type for the format.
+func (f BulkFormat) ContentType() string {
+	switch f {
+	case BulkCSV:
+		return "text/csv"
+	case BulkArrow:
+		return "application/vnd.apache.arrow.stream"
+	default:
+		return "application/x-ndjson"
+	}
+}
+
+// BulkOptions specifies which synced label data, if any, is added to each exported element.
+type BulkOptions struct {
+	Labels      bool
+	Supervoxels bool
+}
+
+// bulkElement is an element with optional label and supervoxel at its position.
+type bulkElement struct {
+	Element
+	Label      *uint64 `json:",omitempty"`
+	Supervoxel *uint64 `json:",omitempty"`
+}
+
+// CSV columns for bulk export and import.  The tags column is a semicolon-separated list,
+// while the props and rels columns hold JSON.
+var bulkCSVHeader = []string{"x", "y", "z", "kind", "tags", "props", "rels"}
+
+var csvTagEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`)
+
+// joinCSVTags returns the tags separated by semicolons, with any semicolon or backslash
+// within a tag escaped by a backslash.
+func joinCSVTags(tags Tags) string {
+	escaped := make([]string, len(tags))
+	for i, tag := range tags {
+		escaped[i] = csvTagEscaper.Replace(string(tag))
+	}
+	return strings.Join(escaped, ";")
+}
+
+// splitCSVTags is the inverse of joinCSVTags.
+func splitCSVTags(s string) (Tags, error) {
+	var tags Tags
+	var tag []byte
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i++; i == len(s) {
+				return nil, fmt.Errorf("tags %q end with an unescaped backslash", s)
+			}
+			tag = append(tag, s[i])
+		case ';':
+			tags = append(tags, Tag(tag))
+			tag = tag[:0]
+		default:
+			tag = append(tag, s[i])
+		}
+	}
+	return append(tags, Tag(tag)), nil
+}
+
+// returns the supervoxels at the given points using the synced label data.
+func (d *Data) getPointSupervoxels(v dvid.VersionID, pts []dvid.Point3d) ([]uint64, error) {
+	labelData := d.getSyncedLabels()
+	if labelData == nil {
+		return nil, fmt.Errorf("no synced labels for annotation %q", d.DataName())
+	}
+	if labelPointData, ok := labelData.(labelPointType); ok {
+		return labelPointData.GetLabelPoints(v, pts, 0, true)
+	}
+	svData, ok := labelData.(supervoxelType)
+	if !ok {
+		return nil, fmt.Errorf("synced labels for annotation %q do not support supervoxels", d.DataName())
+	}
+	svs := make([]uint64, len(pts))
+	for i, pt := range pts {
+		sv, err := svData.GetSupervoxelAtPoint(v, pt)
+		if err != nil {
+			return nil, err
+		}
+		svs[i] = sv
+	}
+	return svs, nil
+}
+
+// returns the elements of a block with any requested labels and supervoxels.
+func (d *Data) getBulkElements(v dvid.VersionID, elems Elements, opts BulkOptions) ([]bulkElement, error) {
+	bulkElems := make([]bulkElement, len(elems))
+	pts := make([]dvid.Point3d, len(elems))
+	for i, elem := range elems {
+		bulkElems[i].Element = elem
+		pts[i] = elem.Pos
+	}
+	if opts.Labels {
+		lbls, err := d.getPointLabels(v, pts)
+		if err != nil {
+			return nil, err
+		}
+		for i := range bulkElems {
+			bulkElems[i].Label = &lbls[i]
+		}
+	}
+	if opts.Supervoxels {
+		svs, err := d.getPointSupervoxels(v, pts)
+		if err != nil {
+			return nil, err
+		}
+		for i := range bulkElems {
+			bulkElems[i].Supervoxel = &svs[i]
+		}
+	}
+	return bulkElems, nil
+}
+
+func csvRecord(elem bulkElement, opts BulkOptions) ([]string, error) {
+	var props, rels string
+	if len(elem.Prop) != 0 {
+		b, err := json.Marshal(elem.Prop)
+		if err != nil {
+			return nil, err
+		}
+		props = string(b)
+	}
+	if len(elem.Rels) != 0 {
+		b, err := json.Marshal(elem.Rels)
+		if err != nil {
+			return nil, err
+		}
+		rels = string(b)
+	}
+	record := []string{
+		strconv.Itoa(int(elem.Pos[0])),
+		strconv.Itoa(int(elem.Pos[1])),
+		strconv.Itoa(int(elem.Pos[2])),
+		elem.Kind.String(),
+		joinCSVTags(elem.Tags),
+		props,
+		rels,
+	}
+	if opts.Labels {
+		record = append(record, strconv.FormatUint(*elem.Label, 10))
+	}
+	if opts.Supervoxels {
+		record = append(record, strconv.FormatUint(*elem.Supervoxel, 10))
+	}
+	return record, nil
+}
+
+// StreamAll writes every element in the given format, one row or line per element.
+func (d *Data) StreamAll(ctx *datastore.VersionedCtx, w io.Writer, format BulkFormat, opts BulkOptions) error {
+	if (opts.Labels || opts.Supervoxels) && d.getSyncedLabels() == nil {
+		return fmt.Errorf("annotation %q must be synced with label data to export labels or supervoxels", d.DataName())
+	}
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	timedLog := dvid.NewTimeLog()
+
+	var csvWriter *csv.Writer
+	var jsonEncoder *json.Encoder
+	var arrowOut *arrowWriter
+	switch format {
+	case BulkCSV:
+		csvWriter = csv.NewWriter(w)
+		header := append([]string{}, bulkCSVHeader...)
+		if opts.Labels {
+			header = append(header, "label")
+		}
+		if opts.Supervoxels {
+			header = append(header, "supervoxel")
+		}
+		if err := csvWriter.Write(header); err != nil {
+			return err
+		}
+	case BulkNDJSON:
+		jsonEncoder = json.NewEncoder(w)
+	case BulkArrow:
+		if arrowOut, err = newArrowWriter(w, opts); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported bulk format %q", format)
+	}
+
+	var numElems int
+	err = store.ProcessRange(ctx, storage.MinTKey(keyBlock), storage.MaxTKey(keyBlock), nil, func(chunk *storage.Chunk) error {
+		if len(chunk.V) == 0 {
+			return nil
+		}
+		var elems Elements
+		if err := json.Unmarshal(chunk.V, &elems); err != nil {
+			return err
+		}
+		bulkElems, err := d.getBulkElements(ctx.VersionID(), elems, opts)
+		if err != nil {
+			return err
+		}
+		for _, elem := range bulkElems {
+			switch {
+			case csvWriter != nil:
+				record, err := csvRecord(elem, opts)
+				if err != nil {
+					return err
+				}
+				if err := csvWriter.Write(record); err != nil {
+					return err
+				}
+			case arrowOut != nil:
+				if err := arrowOut.write(elem); err != nil {
+					return err
+				}
+			default:
+				if err := jsonEncoder.Encode(elem); err != nil {
+					return err
+				}
+			}
+		}
+		numElems += len(bulkElems)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if csvWriter != nil {
+		csvWriter.Flush()
+		if err := csvWriter.Error(); err != nil {
+			return err
+		}
+	}
+	if arrowOut != nil {
+		if err := arrowOut.close(); err != nil {
+			return err
+		}
+	}
+	timedLog.Infof("Streamed %d elements in %s format for annotation %q", numElems, format, d.DataName())
+	return nil
+}
+
+func readCSVElements(r io.Reader) (Elements, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read CSV header: %v", err)
+	}
+	col := make(map[string]int, len(header))
+	for i, name := range header {
+		col[strings.TrimSpace(strings.ToLower(name))] = i
+	}
+	for _, name := range []string{"x", "y", "z", "kind"} {
+		if _, found := col[name]; !found {
+			return nil, fmt.Errorf("CSV header must include %q column", name)
+		}
+	}
+	field := func(record []string, name string) string {
+		if i, found := col[name]; found && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	elems := Elements{}
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var elem Element
+		for i, name := range []string{"x", "y", "z"} {
+			coord, err := strconv.ParseInt(strings.TrimSpace(field(record, name)), 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("bad %s coordinate in CSV row %d: %v", name, row, err)
+			}
+			elem.Pos[i] = int32(coord)
+		}
+		kind := field(record, "kind")
+		if elem.Kind = StringToElementType(kind); elem.Kind == UnknownElem {
+			return nil, fmt.Errorf("unknown element kind %q in CSV row %d", kind, row)
+		}
+		if tags := field(record, "tags"); tags != "" {
+			if elem.Tags, err = splitCSVTags(tags); err != nil {
+				return nil, fmt.Errorf("bad tags in CSV row %d: %v", row, err)
+			}
+		}
+		if props := field(record, "props"); props != "" {
+			if err := json.Unmarshal([]byte(props), &elem.Prop); err != nil {
+				return nil, fmt.Errorf("bad props in CSV row %d: %v", row, err)
+			}
+		}
+		if rels := field(record, "rels"); rels != "" {
+			if err := json.Unmarshal([]byte(rels), &elem.Rels); err != nil {
+				return nil, fmt.Errorf("bad rels in CSV row %d: %v", row, err)
+			}
+		}
+		elems = append(elems, elem)
+	}
+	return elems, nil
+}
+
+func readNDJSONElements(r io.Reader) (Elements, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	elems := Elements{}
+	for line := 1; scanner.Scan(); line++ {
+		b := scanner.Bytes()
+		if len(strings.TrimSpace(string(b))) == 0 {
+			continue
+		}
+		var elem bulkElement
+		if err := json.Unmarshal(b, &elem); err != nil {
+			return nil, fmt.Errorf("bad element on ndjson line %d: %v", line, err)
+		}
+		elems = append(elems, elem.Element)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return elems, nil
+}
+
+// StoreAll ingests elements in the given format through a single batch write, so
+// synced data receives a single notification.  Any label or supervoxel fields are
+// ignored since they are derived from the synced label data.
+func (d *Data) StoreAll(ctx *datastore.VersionedCtx, r io.Reader, format BulkFormat, kafkaOff bool) error {
+	var elems Elements
+	var err error
+	switch format {
+	case BulkCSV:
+		elems, err = readCSVElements(r)
+	case BulkNDJSON:
+		elems, err = readNDJSONElements(r)
+	case BulkArrow:
+		elems, err = readArrowElements(r)
+	default:
+		err = fmt.Errorf("unsupported bulk format %q", format)
+	}
+	if err != nil {
+		return err
+	}
+	dvid.Infof("%d elements received via bulk %s POST\n", len(elems), format)
+	if len(elems) == 0 {
+		return nil
+	}
+	postData, err := json.Marshal(elems)
+	if err != nil {
+		return err
+	}
+	return d.storeElements(ctx, elems, postData, kafkaOff)
+}
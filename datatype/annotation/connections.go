@@ -0,0 +1,687 @@
+/*
+	This file supports the body-to-body connectivity index built from PreSyn->PostSyn
+	relationships and the synced label data.
+*/
+
+package annotation
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// Connection is a weighted edge from a body with PreSyn elements to a body with the
+// partnered PostSyn elements.  The weight is the number of PreSynTo relationships.
+type Connection struct {
+	Pre    uint64
+	Post   uint64
+	Weight uint32
+}
+
+type connectionPair struct {
+	pre, post uint64
+}
+
+// Connections is a slice of Connection sortable by pre then post label.
+type Connections []Connection
+
+func (c Connections) Len() int {
+	return len(c)
+}
+
+func (c Connections) Less(i, j int) bool {
+	if c[i].Pre != c[j].Pre {
+		return c[i].Pre < c[j].Pre
+	}
+	return c[i].Post < c[j].Post
+}
+
+func (c Connections) Swap(i, j int) {
+	c[i], c[j] = c[j], c[i]
+}
+
+func encodeWeight(weight uint32) []byte {
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, weight)
+	return buf
+}
+
+func decodeWeight(val []byte) (uint32, error) {
+	if len(val) != 4 {
+		return 0, fmt.Errorf("expected 4 byte connection weight, got %d bytes", len(val))
+	}
+	return binary.LittleEndian.Uint32(val), nil
+}
+
+// parses a comma-separated list of labels, returning an empty set for an empty string.
+func parseLabelSet(s string) (labels.Set, error) {
+	set := make(labels.Set)
+	if s == "" {
+		return set, nil
+	}
+	for _, labelStr := range strings.Split(s, ",") {
+		label, err := strconv.ParseUint(strings.TrimSpace(labelStr), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad label %q in list %q: %v", labelStr, s, err)
+		}
+		if label == 0 {
+			return nil, fmt.Errorf("label 0 is protected background value and cannot be used for query")
+		}
+		set[label] = struct{}{}
+	}
+	return set, nil
+}
+
+// returns the labels at the given points using the synced label data.
+func (d *Data) getPointLabels(v dvid.VersionID, pts []dvid.Point3d) ([]uint64, error) {
+	labelData := d.getSyncedLabels()
+	if labelData == nil {
+		return nil, fmt.Errorf("no synced labels for annotation %q", d.DataName())
+	}
+	if labelPointData, ok := labelData.(labelPointType); ok {
+		return labelPointData.GetLabelPoints(v, pts, 0, false)
+	}
+	lbls := make([]uint64, len(pts))
+	for i, pt := range pts {
+		label, err := labelData.GetLabelAtPoint(v, pt)
+		if err != nil {
+			return nil, err
+		}
+		lbls[i] = label
+	}
+	return lbls, nil
+}
+
+// returns the labels of the given elements, any extra points, and the synaptic partners
+// of the elements.  These are the labels whose connections could change if the elements
+// are modified.  Returns an empty set if the annotations are not synced with label data.
+func (d *Data) getSynapticLabels(v dvid.VersionID, elems Elements, extra ...dvid.Point3d) (labels.Set, error) {
+	affected := make(labels.Set)
+	if d.getSyncedLabels() == nil {
+		return affected, nil
+	}
+	pts := append([]dvid.Point3d{}, extra...)
+	for _, elem := range elems {
+		pts = append(pts, elem.Pos)
+		for _, rel := range elem.Rels {
+			if rel.Rel == PreSynTo || rel.Rel == PostSynTo {
+				pts = append(pts, rel.To)
+			}
+		}
+	}
+	if len(pts) == 0 {
+		return affected, nil
+	}
+	lbls, err := d.getPointLabels(v, pts)
+	if err != nil {
+		return nil, err
+	}
+	for _, label := range lbls {
+		if label != 0 {
+			affected[label] = struct{}{}
+		}
+	}
+	return affected, nil
+}
+
+// synapticEdge is a PreSynTo relationship from a PreSyn element to its partner, which adds
+// one to the weight of the connection between the labels at the two points.
+type synapticEdge struct {
+	pre, post dvid.Point3d
+}
+
+// returns the PreSynTo relationships of any PreSyn elements.
+func preSynEdges(elems Elements) []synapticEdge {
+	var edges []synapticEdge
+	for _, elem := range elems {
+		if elem.Kind != PreSyn {
+			continue
+		}
+		for _, rel := range elem.Rels {
+			if rel.Rel == PreSynTo {
+				edges = append(edges, synapticEdge{pre: elem.Pos, post: rel.To})
+			}
+		}
+	}
+	return edges
+}
+
+// returns the PreSynTo relationships of any PreSyn elements that point to the given point.
+func edgesTo(elems Elements, pt dvid.Point3d) []synapticEdge {
+	var edges []synapticEdge
+	for _, elem := range elems {
+		if elem.Kind != PreSyn || elem.Pos.Equals(pt) {
+			continue
+		}
+		for _, rel := range elem.Rels {
+			if rel.Rel == PreSynTo && rel.To.Equals(pt) {
+				edges = append(edges, synapticEdge{pre: elem.Pos, post: pt})
+			}
+		}
+	}
+	return edges
+}
+
+// adjustConnections changes the stored connection weights by the removed and added PreSynTo
+// relationships of an element write, so only the label pairs of those relationships are
+// modified.  Since the elements have already been committed, errors are logged rather than
+// returned.  Does nothing if the annotations are not synced with label data.
+func (d *Data) adjustConnections(ctx *datastore.VersionedCtx, removed, added []synapticEdge) {
+	if err := d.adjustConnectionWeights(ctx, removed, added); err != nil {
+		dvid.Errorf("unable to update connections in annotations %q after element write: %v\n", d.DataName(), err)
+	}
+}
+
+func (d *Data) adjustConnectionWeights(ctx *datastore.VersionedCtx, removed, added []synapticEdge) error {
+	if len(removed)+len(added) == 0 || d.getSyncedLabels() == nil {
+		return nil
+	}
+	edges := append(append([]synapticEdge{}, removed...), added...)
+	pts := make([]dvid.Point3d, 0, 2*len(edges))
+	for _, edge := range edges {
+		pts = append(pts, edge.pre, edge.post)
+	}
+	lbls, err := d.getPointLabels(ctx.VersionID(), pts)
+	if err != nil {
+		return err
+	}
+	deltas := make(map[connectionPair]int64)
+	for i := range edges {
+		pre, post := lbls[2*i], lbls[2*i+1]
+		if pre == 0 || post == 0 {
+			continue
+		}
+		if i < len(removed) {
+			deltas[connectionPair{pre, post}]--
+		} else {
+			deltas[connectionPair{pre, post}]++
+		}
+	}
+
+	d.connMu.Lock()
+	defer d.connMu.Unlock()
+
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	batcher, err := d.getBatcher()
+	if err != nil {
+		return err
+	}
+	batch := batcher.NewBatch(ctx)
+	for pair, delta := range deltas {
+		if delta == 0 {
+			continue
+		}
+		val, err := store.Get(ctx, NewConnectionTKey(pair.pre, pair.post))
+		if err != nil {
+			return err
+		}
+		var weight int64
+		if val != nil {
+			oldWeight, err := decodeWeight(val)
+			if err != nil {
+				return err
+			}
+			weight = int64(oldWeight)
+		}
+		if weight += delta; weight <= 0 {
+			deleteBatchConnection(batch, pair.pre, pair.post)
+		} else {
+			putBatchConnection(batch, pair.pre, pair.post, uint32(weight))
+		}
+	}
+	return batch.Commit()
+}
+
+// updates the connections of any label that could change if the labels under the given
+// elements change, e.g., after ingestion of label blocks.
+func (d *Data) updateElementConnections(ctx *datastore.VersionedCtx, elems Elements, extra ...dvid.Point3d) error {
+	affected, err := d.getSynapticLabels(ctx.VersionID(), elems, extra...)
+	if err != nil {
+		return err
+	}
+	return d.updateConnections(ctx, affected)
+}
+
+// computes the outgoing connection weights of a label from its PreSyn elements.
+func (d *Data) computeOutgoing(ctx *datastore.VersionedCtx, pre uint64) (map[uint64]uint32, error) {
+	elems, err := d.getExpandedElements(ctx, NewLabelTKey(pre))
+	if err != nil {
+		return nil, err
+	}
+	var pts []dvid.Point3d
+	for _, elem := range elems {
+		if elem.Kind != PreSyn {
+			continue
+		}
+		for _, rel := range elem.Rels {
+			if rel.Rel == PreSynTo {
+				pts = append(pts, rel.To)
+			}
+		}
+	}
+	if len(pts) == 0 {
+		return nil, nil
+	}
+	lbls, err := d.getPointLabels(ctx.VersionID(), pts)
+	if err != nil {
+		return nil, err
+	}
+	weights := make(map[uint64]uint32)
+	for _, post := range lbls {
+		if post != 0 {
+			weights[post]++
+		}
+	}
+	return weights, nil
+}
+
+// returns the stored connections from the given pre label.
+func (d *Data) getOutgoing(ctx *datastore.VersionedCtx, pre uint64) (Connections, error) {
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	kvs, err := store.GetRange(ctx, NewConnectionTKey(pre, 0), NewConnectionTKey(pre, math.MaxUint64))
+	if err != nil {
+		return nil, err
+	}
+	conns := make(Connections, 0, len(kvs))
+	for _, kv := range kvs {
+		_, post, err := DecodeConnectionTKey(kv.K)
+		if err != nil {
+			return nil, err
+		}
+		weight, err := decodeWeight(kv.V)
+		if err != nil {
+			return nil, err
+		}
+		conns = append(conns, Connection{Pre: pre, Post: post, Weight: weight})
+	}
+	return conns, nil
+}
+
+// returns the stored connections into the given post label.
+func (d *Data) getIncoming(ctx *datastore.VersionedCtx, post uint64) (Connections, error) {
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	kvs, err := store.GetRange(ctx, NewConnectionRevTKey(post, 0), NewConnectionRevTKey(post, math.MaxUint64))
+	if err != nil {
+		return nil, err
+	}
+	conns := make(Connections, 0, len(kvs))
+	for _, kv := range kvs {
+		_, pre, err := DecodeConnectionRevTKey(kv.K)
+		if err != nil {
+			return nil, err
+		}
+		weight, err := decodeWeight(kv.V)
+		if err != nil {
+			return nil, err
+		}
+		conns = append(conns, Connection{Pre: pre, Post: post, Weight: weight})
+	}
+	return conns, nil
+}
+
+func putBatchConnection(batch storage.Batch, pre, post uint64, weight uint32) {
+	val := encodeWeight(weight)
+	batch.Put(NewConnectionTKey(pre, post), val)
+	batch.Put(NewConnectionRevTKey(post, pre), val)
+}
+
+func deleteBatchConnection(batch storage.Batch, pre, post uint64) {
+	batch.Delete(NewConnectionTKey(pre, post))
+	batch.Delete(NewConnectionRevTKey(post, pre))
+}
+
+// recomputes the outgoing connections of a pre label, replacing the stored ones.
+func (d *Data) replaceOutgoing(ctx *datastore.VersionedCtx, batch storage.Batch, pre uint64) error {
+	oldConns, err := d.getOutgoing(ctx, pre)
+	if err != nil {
+		return err
+	}
+	weights, err := d.computeOutgoing(ctx, pre)
+	if err != nil {
+		return err
+	}
+	for _, c := range oldConns {
+		weight, found := weights[c.Post]
+		if !found {
+			deleteBatchConnection(batch, pre, c.Post)
+		} else if weight == c.Weight {
+			delete(weights, c.Post)
+		}
+	}
+	for post, weight := range weights {
+		putBatchConnection(batch, pre, post, weight)
+	}
+	return nil
+}
+
+func (d *Data) getBatcher() (storage.KeyValueBatcher, error) {
+	store, err := d.KVStore()
+	if err != nil {
+		return nil, err
+	}
+	batcher, ok := store.(storage.KeyValueBatcher)
+	if !ok {
+		return nil, fmt.Errorf("data type annotation requires batch-enabled store, which %q is not", store)
+	}
+	return batcher, nil
+}
+
+// updateConnections recomputes the connections of the affected labels after label changes
+// like splits and cleaves.  Since a change in an affected label can change the post label
+// of other bodies' connections, any label with a stored connection into an affected label
+// is also recomputed.  Element writes should use adjustConnections instead.  Does nothing
+// if the annotations are not synced with label data.
+func (d *Data) updateConnections(ctx *datastore.VersionedCtx, affected labels.Set) error {
+	if len(affected) == 0 || d.getSyncedLabels() == nil {
+		return nil
+	}
+	d.connMu.Lock()
+	defer d.connMu.Unlock()
+
+	pres := make(labels.Set, len(affected))
+	for label := range affected {
+		pres[label] = struct{}{}
+		incoming, err := d.getIncoming(ctx, label)
+		if err != nil {
+			return err
+		}
+		for _, c := range incoming {
+			pres[c.Pre] = struct{}{}
+		}
+	}
+	batcher, err := d.getBatcher()
+	if err != nil {
+		return err
+	}
+	batch := batcher.NewBatch(ctx)
+	for pre := range pres {
+		if err := d.replaceOutgoing(ctx, batch, pre); err != nil {
+			return fmt.Errorf("unable to update connections for label %d in annotation %q: %v", pre, d.DataName(), err)
+		}
+	}
+	return batch.Commit()
+}
+
+// mergeConnections relabels any connection to or from the merged labels with the target
+// label, summing the weights of connections that now have the same labels.  This does not
+// require label lookups so is independent of how quickly the synced label data reflects
+// the merge.
+func (d *Data) mergeConnections(ctx *datastore.VersionedCtx, target uint64, merged labels.Set) error {
+	if d.getSyncedLabels() == nil {
+		return nil
+	}
+	d.connMu.Lock()
+	defer d.connMu.Unlock()
+
+	group := merged.Copy()
+	group[target] = struct{}{}
+	oldWeights := make(map[connectionPair]uint32)
+	for label := range group {
+		outgoing, err := d.getOutgoing(ctx, label)
+		if err != nil {
+			return err
+		}
+		incoming, err := d.getIncoming(ctx, label)
+		if err != nil {
+			return err
+		}
+		for _, c := range append(outgoing, incoming...) {
+			oldWeights[connectionPair{c.Pre, c.Post}] = c.Weight
+		}
+	}
+	if len(oldWeights) == 0 {
+		return nil
+	}
+
+	relabel := func(label uint64) uint64 {
+		if _, found := merged[label]; found {
+			return target
+		}
+		return label
+	}
+	newWeights := make(map[connectionPair]uint32, len(oldWeights))
+	for pair, weight := range oldWeights {
+		newWeights[connectionPair{relabel(pair.pre), relabel(pair.post)}] += weight
+	}
+
+	batcher, err := d.getBatcher()
+	if err != nil {
+		return err
+	}
+	batch := batcher.NewBatch(ctx)
+	for pair := range oldWeights {
+		if _, found := newWeights[pair]; !found {
+			deleteBatchConnection(batch, pair.pre, pair.post)
+		}
+	}
+	for pair, weight := range newWeights {
+		if oldWeights[pair] != weight {
+			putBatchConnection(batch, pair.pre, pair.post, weight)
+		}
+	}
+	return batch.Commit()
+}
+
+// rebuildConnections deletes the connection index and recomputes it from the label
+// denormalizations.
+func (d *Data) rebuildConnections(ctx *datastore.VersionedCtx) error {
+	if d.getSyncedLabels() == nil {
+		return nil
+	}
+	d.connMu.Lock()
+	defer d.connMu.Unlock()
+
+	timedLog := dvid.NewTimeLog()
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	if err := store.DeleteRange(ctx, storage.MinTKey(keyConnection), storage.MaxTKey(keyConnection)); err != nil {
+		return fmt.Errorf("unable to delete connections for annotations %q: %v", d.DataName(), err)
+	}
+	if err := store.DeleteRange(ctx, storage.MinTKey(keyConnectionRev), storage.MaxTKey(keyConnectionRev)); err != nil {
+		return fmt.Errorf("unable to delete reverse connections for annotations %q: %v", d.DataName(), err)
+	}
+
+	var preLabels []uint64
+	err = d.ProcessLabelAnnotations(ctx.VersionID(), func(label uint64, elems ElementsNR) {
+		for _, elem := range elems {
+			if elem.Kind == PreSyn {
+				preLabels = append(preLabels, label)
+				return
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	batcher, err := d.getBatcher()
+	if err != nil {
+		return err
+	}
+	batch := batcher.NewBatch(ctx)
+	var numConns int
+	for i, pre := range preLabels {
+		weights, err := d.computeOutgoing(ctx, pre)
+		if err != nil {
+			return fmt.Errorf("unable to compute connections for label %d in annotation %q: %v", pre, d.DataName(), err)
+		}
+		for post, weight := range weights {
+			putBatchConnection(batch, pre, post, weight)
+		}
+		numConns += len(weights)
+		if (i+1)%1000 == 0 {
+			if err := batch.Commit(); err != nil {
+				return err
+			}
+			batch = batcher.NewBatch(ctx)
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		return err
+	}
+	timedLog.Infof("Rebuilt %d connections from %d pre labels for annotation %q", numConns, len(preLabels), d.DataName())
+	return nil
+}
+
+// GetConnections returns the stored connections from any of the given pre labels and into any
+// of the given post labels.  If only one set of labels is given, the other side is unrestricted.
+// At least one set of labels must be given.
+func (d *Data) GetConnections(ctx *datastore.VersionedCtx, pre, post labels.Set) (Connections, error) {
+	var conns Connections
+	switch {
+	case len(pre) != 0:
+		for label := range pre {
+			outgoing, err := d.getOutgoing(ctx, label)
+			if err != nil {
+				return nil, err
+			}
+			for _, c := range outgoing {
+				if len(post) == 0 || post.Exists(c.Post) {
+					conns = append(conns, c)
+				}
+			}
+		}
+	case len(post) != 0:
+		for label := range post {
+			incoming, err := d.getIncoming(ctx, label)
+			if err != nil {
+				return nil, err
+			}
+			conns = append(conns, incoming...)
+		}
+	default:
+		return nil, fmt.Errorf("must specify pre or post labels for connections")
+	}
+	sort.Sort(conns)
+	return conns, nil
+}
+
+// StreamConnections writes a JSON array of all stored connections in pre then post label order.
+func (d *Data) StreamConnections(ctx *datastore.VersionedCtx, w io.Writer) error {
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte("[")); err != nil {
+		return err
+	}
+	numConns := 0
+	err = store.ProcessRange(ctx, storage.MinTKey(keyConnection), storage.MaxTKey(keyConnection), nil, func(chunk *storage.Chunk) error {
+		if len(chunk.V) == 0 {
+			return nil
+		}
+		pre, post, err := DecodeConnectionTKey(chunk.K)
+		if err != nil {
+			return err
+		}
+		weight, err := decodeWeight(chunk.V)
+		if err != nil {
+			return err
+		}
+		jsonBytes, err := json.Marshal(Connection{Pre: pre, Post: post, Weight: weight})
+		if err != nil {
+			return err
+		}
+		if numConns > 0 {
+			if _, err := w.Write([]byte(",")); err != nil {
+				return err
+			}
+		}
+		if _, err := w.Write(jsonBytes); err != nil {
+			return err
+		}
+		numConns++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write([]byte("]"))
+	return err
+}
+
+// GetROIConnections computes the connections made by PreSyn elements within the given ROI.
+// Optional pre and post label sets restrict the returned connections.
+func (d *Data) GetROIConnections(ctx *datastore.VersionedCtx, roiSpec storage.FilterSpec, pre, post labels.Set) (Connections, error) {
+	elems, err := d.GetROISynapses(ctx, roiSpec)
+	if err != nil {
+		return nil, err
+	}
+	var pts []dvid.Point3d
+	var numPre int
+	for _, elem := range elems {
+		if elem.Kind != PreSyn {
+			continue
+		}
+		pts = append(pts, elem.Pos)
+		for _, rel := range elem.Rels {
+			if rel.Rel == PreSynTo {
+				pts = append(pts, rel.To)
+			}
+		}
+		numPre++
+	}
+	if numPre == 0 {
+		return Connections{}, nil
+	}
+	lbls, err := d.getPointLabels(ctx.VersionID(), pts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Labels were fetched in element order, so walk elements again to pair them up.
+	weights := make(map[connectionPair]uint32)
+	i := 0
+	for _, elem := range elems {
+		if elem.Kind != PreSyn {
+			continue
+		}
+		preLabel := lbls[i]
+		i++
+		for _, rel := range elem.Rels {
+			if rel.Rel != PreSynTo {
+				continue
+			}
+			postLabel := lbls[i]
+			i++
+			if preLabel == 0 || postLabel == 0 {
+				continue
+			}
+			if len(pre) != 0 && !pre.Exists(preLabel) {
+				continue
+			}
+			if len(post) != 0 && !post.Exists(postLabel) {
+				continue
+			}
+			weights[connectionPair{preLabel, postLabel}]++
+		}
+	}
+	conns := make(Connections, 0, len(weights))
+	for pair, weight := range weights {
+		conns = append(conns, Connection{Pre: pair.pre, Post: pair.post, Weight: weight})
+	}
+	sort.Sort(conns)
+	return conns, nil
+}
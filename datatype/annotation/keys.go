@@ -7,6 +7,8 @@ package annotation
 import (
 	"encoding/binary"
 	"fmt"
+	"math"
+	"strconv"
 
 	"github.com/janelia-flyem/dvid/datastore"
 	"github.com/janelia-flyem/dvid/dvid"
@@ -28,8 +30,32 @@ const (
 
 	// key is block coordinate.  value is serialization of synaptic elements.
 	keyBlock = 72
+
+	// key is pre label + post label.  value is the number of PreSyn->PostSyn connections.
+	keyConnection = 73
+
+	// key is post label + pre label.  value is the number of PreSyn->PostSyn connections.
+	keyConnectionRev = 74
+
+	// key is indexed property name + encoded property value + element position.  value is empty.
+	keyProp = 75
+
+	// key is shape ID.  value is serialization of the shape.
+	keyShape = 76
+
+	// key is block coordinate + shape ID.  value is empty.
+	keyShapeBlock = 77
+
+	// key is label + shape ID.  value is empty.
+	keyShapeLabel = 78
+
+	// single key per version.  value is JSON of the indexed property names for the version.
+	keyIndexedProps = 79
 )
 
+// indexedPropsTKey is the versioned key for the names of properties indexed in a version.
+var indexedPropsTKey = storage.NewTKey(keyIndexedProps, nil)
+
 // DescribeTKeyClass returns a string explanation of what a particular TKeyClass
 // is used for.  Implements the datastore.TKeyClassDescriber interface.
 func (d *Data) DescribeTKeyClass(tkc storage.TKeyClass) string {
@@ -40,6 +66,20 @@ func (d *Data) DescribeTKeyClass(tkc storage.TKeyClass) string {
 		return "annotation label key"
 	case keyBlock:
 		return "annotation block coord key"
+	case keyConnection:
+		return "annotation pre-post label connection key"
+	case keyConnectionRev:
+		return "annotation post-pre label connection key"
+	case keyProp:
+		return "annotation property name + value + position key"
+	case keyShape:
+		return "annotation shape ID key"
+	case keyShapeBlock:
+		return "annotation block coord + shape ID key"
+	case keyShapeLabel:
+		return "annotation label + shape ID key"
+	case keyIndexedProps:
+		return "annotation indexed property names key"
 	default:
 	}
 	return "unknown annotation key"
@@ -101,3 +141,184 @@ func DecodeBlockTKey(tk storage.TKey) (pt dvid.ChunkPoint3d, err error) {
 	pt = dvid.ChunkPoint3d(idx)
 	return
 }
+
+// NewConnectionTKey returns a TKey for the connection from a pre label to a post label.
+func NewConnectionTKey(pre, post uint64) storage.TKey {
+	buf := make([]byte, 16)
+	binary.BigEndian.PutUint64(buf[0:8], pre)
+	binary.BigEndian.PutUint64(buf[8:16], post)
+	return storage.NewTKey(keyConnection, buf)
+}
+
+// DecodeConnectionTKey returns the pre and post labels of a connection key.
+func DecodeConnectionTKey(tk storage.TKey) (pre, post uint64, err error) {
+	ibytes, err := tk.ClassBytes(keyConnection)
+	if err != nil {
+		return
+	}
+	if len(ibytes) != 16 {
+		err = fmt.Errorf("expected 16 bytes for connection key, got %d bytes", len(ibytes))
+		return
+	}
+	pre = binary.BigEndian.Uint64(ibytes[0:8])
+	post = binary.BigEndian.Uint64(ibytes[8:16])
+	return
+}
+
+// NewConnectionRevTKey returns a TKey for the connection into a post label from a pre label.
+func NewConnectionRevTKey(post, pre uint64) storage.TKey {
+	buf := make([]byte, 16)
+	binary.BigEndian.PutUint64(buf[0:8], post)
+	binary.BigEndian.PutUint64(buf[8:16], pre)
+	return storage.NewTKey(keyConnectionRev, buf)
+}
+
+// DecodeConnectionRevTKey returns the post and pre labels of a reverse connection key.
+func DecodeConnectionRevTKey(tk storage.TKey) (post, pre uint64, err error) {
+	ibytes, err := tk.ClassBytes(keyConnectionRev)
+	if err != nil {
+		return
+	}
+	if len(ibytes) != 16 {
+		err = fmt.Errorf("expected 16 bytes for reverse connection key, got %d bytes", len(ibytes))
+		return
+	}
+	post = binary.BigEndian.Uint64(ibytes[0:8])
+	pre = binary.BigEndian.Uint64(ibytes[8:16])
+	return
+}
+
+// Property values are encoded so that numeric values sort numerically and precede
+// all string values, which sort lexicographically.
+const (
+	propNumber byte = 1
+	propString byte = 2
+)
+
+// returns an order-preserving encoding of a float64.
+func encodeOrderedFloat(f float64) []byte {
+	if f == 0 {
+		f = 0 // treat negative zero as zero
+	}
+	bits := math.Float64bits(f)
+	if f >= 0 {
+		bits ^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, bits)
+	return buf
+}
+
+// returns the encoding of a property value, treating the value as numeric if possible.
+func encodePropValue(value string) []byte {
+	if f, err := strconv.ParseFloat(value, 64); err == nil && !math.IsNaN(f) {
+		return append([]byte{propNumber}, encodeOrderedFloat(f)...)
+	}
+	buf := make([]byte, 0, len(value)+2)
+	buf = append(buf, propString)
+	buf = append(buf, value...)
+	return append(buf, 0)
+}
+
+// returns the key prefix for all values of a property.
+func propNamePrefix(name string) []byte {
+	return append([]byte(name), 0)
+}
+
+// NewPropTKey returns a TKey for an element position having the given property value.
+func NewPropTKey(name, value string, pt dvid.Point3d) storage.TKey {
+	buf := propNamePrefix(name)
+	buf = append(buf, encodePropValue(value)...)
+	idx := dvid.IndexZYX(pt)
+	buf = append(buf, idx.Bytes()...)
+	return storage.NewTKey(keyProp, buf)
+}
+
+// DecodePropTKey returns the element position of a property key.
+func DecodePropTKey(tk storage.TKey) (pt dvid.Point3d, err error) {
+	ibytes, err := tk.ClassBytes(keyProp)
+	if err != nil {
+		return
+	}
+	if len(ibytes) < 14 {
+		err = fmt.Errorf("expected at least 14 bytes for property key, got %d bytes", len(ibytes))
+		return
+	}
+	var idx dvid.IndexZYX
+	if err = idx.IndexFromBytes(ibytes[len(ibytes)-12:]); err != nil {
+		return
+	}
+	pt = dvid.Point3d(idx)
+	return
+}
+
+// NewShapeTKey returns a TKey for the shape with the given ID.
+func NewShapeTKey(id uint64) storage.TKey {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, id)
+	return storage.NewTKey(keyShape, buf)
+}
+
+// DecodeShapeTKey returns the ID of a shape key.
+func DecodeShapeTKey(tk storage.TKey) (id uint64, err error) {
+	ibytes, err := tk.ClassBytes(keyShape)
+	if err != nil {
+		return
+	}
+	if len(ibytes) != 8 {
+		err = fmt.Errorf("expected 8 bytes for shape key, got %d bytes", len(ibytes))
+		return
+	}
+	id = binary.BigEndian.Uint64(ibytes)
+	return
+}
+
+// NewShapeBlockTKey returns a TKey indexing a shape with the given ID in a block.
+func NewShapeBlockTKey(block dvid.ChunkPoint3d, id uint64) storage.TKey {
+	bidx := dvid.IndexZYX(block)
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, id)
+	return storage.NewTKey(keyShapeBlock, append(bidx.Bytes(), buf...))
+}
+
+// DecodeShapeBlockTKey returns the block coordinate and shape ID of a shape block key.
+func DecodeShapeBlockTKey(tk storage.TKey) (block dvid.ChunkPoint3d, id uint64, err error) {
+	ibytes, err := tk.ClassBytes(keyShapeBlock)
+	if err != nil {
+		return
+	}
+	if len(ibytes) != 20 {
+		err = fmt.Errorf("expected 20 bytes for shape block key, got %d bytes", len(ibytes))
+		return
+	}
+	var bidx dvid.IndexZYX
+	if err = bidx.IndexFromBytes(ibytes[:12]); err != nil {
+		return
+	}
+	block, id = dvid.ChunkPoint3d(bidx), binary.BigEndian.Uint64(ibytes[12:])
+	return
+}
+
+// NewShapeLabelTKey returns a TKey indexing a shape with the given ID under a label.
+func NewShapeLabelTKey(label, id uint64) storage.TKey {
+	buf := make([]byte, 16)
+	binary.BigEndian.PutUint64(buf, label)
+	binary.BigEndian.PutUint64(buf[8:], id)
+	return storage.NewTKey(keyShapeLabel, buf)
+}
+
+// DecodeShapeLabelTKey returns the label and shape ID of a shape label key.
+func DecodeShapeLabelTKey(tk storage.TKey) (label, id uint64, err error) {
+	ibytes, err := tk.ClassBytes(keyShapeLabel)
+	if err != nil {
+		return
+	}
+	if len(ibytes) != 16 {
+		err = fmt.Errorf("expected 16 bytes for shape label key, got %d bytes", len(ibytes))
+		return
+	}
+	label, id = binary.BigEndian.Uint64(ibytes[:8]), binary.BigEndian.Uint64(ibytes[8:])
+	return
+}
@@ -0,0 +1,246 @@
+/*
+	This file supports user-defined element kinds and relation types registered per instance.
+*/
+
+package annotation
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Custom element kinds and relation types are assigned values starting at these bases.
+// Values are only used in memory since elements are stored with kind and relation names.
+const (
+	firstCustomElem ElementType  = 64
+	firstCustomRel  RelationType = 64
+)
+
+// customTypes is the process-wide registry of custom element kind and relation type names.
+// Each instance restricts its elements to the names in its own Properties.
+var customTypes struct {
+	sync.RWMutex
+	elemByName map[string]ElementType
+	elemNames  map[ElementType]string
+	relByName  map[string]RelationType
+	relNames   map[RelationType]string
+}
+
+func init() {
+	customTypes.elemByName = make(map[string]ElementType)
+	customTypes.elemNames = make(map[ElementType]string)
+	customTypes.relByName = make(map[string]RelationType)
+	customTypes.relNames = make(map[RelationType]string)
+}
+
+// checks that a custom kind or relation name is usable in URLs, CSV, and JSON.
+func checkCustomName(name string) error {
+	if name == "" {
+		return fmt.Errorf("custom element kind or relation type name cannot be empty")
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_', c == '-':
+		default:
+			return fmt.Errorf("custom name %q can only have letters, digits, '_', or '-'", name)
+		}
+	}
+	return nil
+}
+
+func registerElementKind(name string) (ElementType, error) {
+	if err := checkCustomName(name); err != nil {
+		return UnknownElem, err
+	}
+	if name == "Unknown" || builtinElementType(name) != UnknownElem {
+		return UnknownElem, fmt.Errorf("element kind %q is built-in", name)
+	}
+	customTypes.Lock()
+	defer customTypes.Unlock()
+	if e, found := customTypes.elemByName[name]; found {
+		return e, nil
+	}
+	n := len(customTypes.elemByName)
+	if n > 255-int(firstCustomElem) {
+		return UnknownElem, fmt.Errorf("cannot register element kind %q: too many custom element kinds", name)
+	}
+	e := firstCustomElem + ElementType(n)
+	customTypes.elemByName[name] = e
+	customTypes.elemNames[e] = name
+	return e, nil
+}
+
+func registerRelationType(name string) (RelationType, error) {
+	if err := checkCustomName(name); err != nil {
+		return UnknownRel, err
+	}
+	if builtinRelationType(name) != UnknownRel || name == "UnknownRelationship" {
+		return UnknownRel, fmt.Errorf("relation type %q is built-in", name)
+	}
+	customTypes.Lock()
+	defer customTypes.Unlock()
+	if r, found := customTypes.relByName[name]; found {
+		return r, nil
+	}
+	n := len(customTypes.relByName)
+	if n > 255-int(firstCustomRel) {
+		return UnknownRel, fmt.Errorf("cannot register relation type %q: too many custom relation types", name)
+	}
+	r := firstCustomRel + RelationType(n)
+	customTypes.relByName[name] = r
+	customTypes.relNames[r] = name
+	return r, nil
+}
+
+func customElementType(name string) (ElementType, bool) {
+	customTypes.RLock()
+	defer customTypes.RUnlock()
+	e, found := customTypes.elemByName[name]
+	return e, found
+}
+
+func customElementName(e ElementType) (string, bool) {
+	customTypes.RLock()
+	defer customTypes.RUnlock()
+	name, found := customTypes.elemNames[e]
+	return name, found
+}
+
+func customRelationType(name string) (RelationType, bool) {
+	customTypes.RLock()
+	defer customTypes.RUnlock()
+	r, found := customTypes.relByName[name]
+	return r, found
+}
+
+func customRelationName(r RelationType) (string, bool) {
+	customTypes.RLock()
+	defer customTypes.RUnlock()
+	name, found := customTypes.relNames[r]
+	return name, found
+}
+
+// IsCustom returns true if the ElementType is a user-defined kind.
+func (e ElementType) IsCustom() bool {
+	return e >= firstCustomElem
+}
+
+// IsCustom returns true if the RelationType is a user-defined relation.
+func (r RelationType) IsCustom() bool {
+	return r >= firstCustomRel
+}
+
+// registers the custom element kinds and relation types of the instance.
+func (d *Data) registerCustomTypes() error {
+	for _, name := range d.ElementKinds {
+		if _, err := registerElementKind(name); err != nil {
+			return err
+		}
+	}
+	for _, name := range d.RelationTypes {
+		if _, err := registerRelationType(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddCustomTypes registers additional element kinds and relation types for this instance.
+// Names already registered for the instance are ignored.  Custom kinds cannot be removed
+// since their position in ElementKinds is used by synced label size indices.
+func (d *Data) AddCustomTypes(kinds, rels []string) error {
+	for _, name := range kinds {
+		if _, err := registerElementKind(name); err != nil {
+			return err
+		}
+	}
+	for _, name := range rels {
+		if _, err := registerRelationType(name); err != nil {
+			return err
+		}
+	}
+	d.Lock()
+	defer d.Unlock()
+	d.ElementKinds = appendNewNames(d.ElementKinds, kinds)
+	d.RelationTypes = appendNewNames(d.RelationTypes, rels)
+	return nil
+}
+
+func appendNewNames(names, added []string) []string {
+	for _, name := range added {
+		found := false
+		for _, cur := range names {
+			if cur == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// ElementKindIndex returns the position of a custom element kind among the kinds
+// registered for this instance.
+func (d *Data) ElementKindIndex(name string) (int, bool) {
+	d.RLock()
+	defer d.RUnlock()
+	for i, kind := range d.ElementKinds {
+		if kind == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// NumElementKinds returns the number of custom element kinds registered for this instance.
+func (d *Data) NumElementKinds() int {
+	d.RLock()
+	defer d.RUnlock()
+	return len(d.ElementKinds)
+}
+
+// CustomElementKind returns the name of the i-th custom element kind for this instance.
+func (d *Data) CustomElementKind(i int) (string, bool) {
+	d.RLock()
+	defer d.RUnlock()
+	if i < 0 || i >= len(d.ElementKinds) {
+		return "", false
+	}
+	return d.ElementKinds[i], true
+}
+
+// checkCustomTypes returns an error if any element uses a custom kind or relation type
+// not registered for this instance.
+func (d *Data) checkCustomTypes(elems Elements) error {
+	d.RLock()
+	defer d.RUnlock()
+	for _, elem := range elems {
+		if elem.Kind.IsCustom() {
+			name, _ := customElementName(elem.Kind)
+			if !containsName(d.ElementKinds, name) {
+				return fmt.Errorf("element kind %q at %s is not registered for annotation %q", name, elem.Pos, d.DataName())
+			}
+		}
+		for _, rel := range elem.Rels {
+			if rel.Rel.IsCustom() {
+				name, _ := customRelationName(rel.Rel)
+				if !containsName(d.RelationTypes, name) {
+					return fmt.Errorf("relation type %q at %s is not registered for annotation %q", name, elem.Pos, d.DataName())
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func containsName(names []string, name string) bool {
+	for _, cur := range names {
+		if cur == name {
+			return true
+		}
+	}
+	return false
+}
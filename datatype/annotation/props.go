@@ -0,0 +1,338 @@
+/*
+	This file supports secondary indices on configured element property names.
+*/
+
+package annotation
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// parses a comma-separated list of names.
+func parseNameList(s string) []string {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// indexedProps returns the indexed property names for the version of the context.  Names
+// set through SetIndexedProps are stored under a versioned key, so child versions created
+// afterwards inherit them.  Versions without stored names use those given on creation.
+func (d *Data) indexedProps(ctx *datastore.VersionedCtx) ([]string, error) {
+	v := ctx.VersionID()
+	d.propsMu.RLock()
+	props, found := d.versionProps[v]
+	d.propsMu.RUnlock()
+	if found {
+		return props, nil
+	}
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	data, err := store.Get(ctx, indexedPropsTKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		props = d.IndexedProps
+	} else if err := json.Unmarshal(data, &props); err != nil {
+		return nil, fmt.Errorf("bad stored indexed properties for annotation %q: %v", d.DataName(), err)
+	}
+	d.propsMu.Lock()
+	if d.versionProps == nil {
+		d.versionProps = make(map[dvid.VersionID][]string)
+	}
+	d.versionProps[v] = props
+	d.propsMu.Unlock()
+	return props, nil
+}
+
+func isIndexedProp(props []string, name string) bool {
+	for _, prop := range props {
+		if prop == name {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the property index keys for an element.
+func propTKeys(props []string, elem ElementNR) []storage.TKey {
+	var tkeys []storage.TKey
+	for _, name := range props {
+		if value, found := elem.Prop[name]; found {
+			tkeys = append(tkeys, NewPropTKey(name, value, elem.Pos))
+		}
+	}
+	return tkeys
+}
+
+// modifyPropIndex replaces the property index keys of the old elements with those
+// of the new elements.  Keys common to both are left untouched.
+func (d *Data) modifyPropIndex(ctx *datastore.VersionedCtx, batch storage.Batch, oldElems, newElems ElementsNR) error {
+	props, err := d.indexedProps(ctx)
+	if err != nil {
+		return err
+	}
+	if len(props) == 0 {
+		return nil
+	}
+	newKeys := make(map[string]storage.TKey)
+	for _, elem := range newElems {
+		for _, tk := range propTKeys(props, elem) {
+			newKeys[string(tk)] = tk
+		}
+	}
+	oldKeys := make(map[string]struct{})
+	for _, elem := range oldElems {
+		for _, tk := range propTKeys(props, elem) {
+			oldKeys[string(tk)] = struct{}{}
+			if _, found := newKeys[string(tk)]; !found {
+				batch.Delete(tk)
+			}
+		}
+	}
+	for keyStr, tk := range newKeys {
+		if _, found := oldKeys[keyStr]; !found {
+			batch.Put(tk, nil)
+		}
+	}
+	return nil
+}
+
+// returns the current block elements that would be replaced by the new block elements.
+func replacedElements(newBlockE, curBlockE Elements) Elements {
+	curByPt := make(map[string]int, len(curBlockE))
+	for i, elem := range curBlockE {
+		curByPt[elem.Pos.MapKey()] = i
+	}
+	var replaced Elements
+	for _, elem := range newBlockE {
+		if i, found := curByPt[elem.Pos.MapKey()]; found {
+			replaced = append(replaced, curBlockE[i])
+		}
+	}
+	return replaced
+}
+
+// PropQuery specifies either an exact property value or an inclusive range of values.
+// Range bounds are compared numerically if all given bounds are numbers, otherwise
+// lexicographically as strings.  A nil bound is unbounded.
+type PropQuery struct {
+	Value    *string
+	Min, Max *string
+}
+
+func isNumber(s *string) bool {
+	if s == nil {
+		return true
+	}
+	f, err := strconv.ParseFloat(*s, 64)
+	return err == nil && !math.IsNaN(f)
+}
+
+// returns the inclusive range of property keys satisfying the query.
+func propRange(name string, q PropQuery) (beg, end storage.TKey) {
+	prefix := propNamePrefix(name)
+	minIdx := dvid.MinIndexZYX.Bytes()
+	maxIdx := dvid.MaxIndexZYX.Bytes()
+
+	var begBytes, endBytes []byte
+	switch {
+	case q.Value != nil:
+		enc := encodePropValue(*q.Value)
+		begBytes = append(append(append(begBytes, prefix...), enc...), minIdx...)
+		endBytes = append(append(append(endBytes, prefix...), enc...), maxIdx...)
+	case isNumber(q.Min) && isNumber(q.Max):
+		minF, maxF := math.Inf(-1), math.Inf(1)
+		if q.Min != nil {
+			minF, _ = strconv.ParseFloat(*q.Min, 64)
+		}
+		if q.Max != nil {
+			maxF, _ = strconv.ParseFloat(*q.Max, 64)
+		}
+		begBytes = append(append(begBytes, prefix...), propNumber)
+		begBytes = append(append(begBytes, encodeOrderedFloat(minF)...), minIdx...)
+		endBytes = append(append(endBytes, prefix...), propNumber)
+		endBytes = append(append(endBytes, encodeOrderedFloat(maxF)...), maxIdx...)
+	default:
+		// Range keys must be full-length keys for versioned range queries.
+		begBytes = append(append(begBytes, prefix...), propString)
+		if q.Min != nil {
+			begBytes = append(begBytes, *q.Min...)
+		}
+		begBytes = append(append(begBytes, 0), minIdx...)
+		endBytes = append(endBytes, prefix...)
+		if q.Max != nil {
+			endBytes = append(endBytes, propString)
+			endBytes = append(append(endBytes, *q.Max...), 0)
+			endBytes = append(endBytes, maxIdx...)
+		} else {
+			endBytes = append(endBytes, propString+1)
+		}
+	}
+	return storage.NewTKey(keyProp, begBytes), storage.NewTKey(keyProp, endBytes)
+}
+
+// GetPropElements returns the elements with relationships whose value for an indexed
+// property satisfies the query.  Elements are returned in order of property value.
+// The property must be indexed in the version of the context.
+func (d *Data) GetPropElements(ctx *datastore.VersionedCtx, name string, q PropQuery) (Elements, error) {
+	props, err := d.indexedProps(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !isIndexedProp(props, name) {
+		return nil, fmt.Errorf("property %q is not indexed for annotation %q in this version", name, d.DataName())
+	}
+	if q.Value == nil && q.Min == nil && q.Max == nil {
+		return nil, fmt.Errorf("must specify a value or range for property %q query", name)
+	}
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	beg, end := propRange(name, q)
+	tkeys, err := store.KeysInRange(ctx, beg, end)
+	if err != nil {
+		return nil, err
+	}
+
+	blockSize := d.blockSize()
+	blockElems := make(map[dvid.IZYXString]map[string]Element)
+	elems := Elements{}
+	for _, tk := range tkeys {
+		pt, err := DecodePropTKey(tk)
+		if err != nil {
+			return nil, err
+		}
+		izyx := pt.ToBlockIZYXString(blockSize)
+		emap, found := blockElems[izyx]
+		if !found {
+			bcoord, err := izyx.ToChunkPoint3d()
+			if err != nil {
+				return nil, err
+			}
+			be, err := getElements(ctx, NewBlockTKey(bcoord))
+			if err != nil {
+				return nil, err
+			}
+			emap = make(map[string]Element, len(be))
+			for _, elem := range be {
+				emap[elem.Pos.MapKey()] = elem
+			}
+			blockElems[izyx] = emap
+		}
+		elem, found := emap[pt.MapKey()]
+		if !found {
+			dvid.Errorf("property %q index for annotation %q has element %s not in block %s\n", name, d.DataName(), pt, izyx)
+			continue
+		}
+		elems = append(elems, elem)
+	}
+	return elems, nil
+}
+
+// SetIndexedProps replaces the indexed property names for the given version, which must
+// be unlocked, and rebuilds its property index.  Other existing versions are unaffected.
+func (d *Data) SetIndexedProps(ctx *datastore.VersionedCtx, props []string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	v := ctx.VersionID()
+	locked, err := datastore.LockedVersion(v)
+	if err != nil {
+		return err
+	}
+	if locked {
+		return fmt.Errorf("can't set indexed properties of annotation %q in locked version id %d", d.DataName(), v)
+	}
+	if props == nil {
+		props = []string{}
+	}
+	data, err := json.Marshal(props)
+	if err != nil {
+		return err
+	}
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	if err := store.Put(ctx, indexedPropsTKey, data); err != nil {
+		return err
+	}
+	d.propsMu.Lock()
+	if d.versionProps == nil {
+		d.versionProps = make(map[dvid.VersionID][]string)
+	}
+	d.versionProps[v] = props
+	d.propsMu.Unlock()
+	return d.reindexProps(ctx, props)
+}
+
+// reindexProps deletes the property index of a version and recreates it from the block
+// elements using the given property names.
+func (d *Data) reindexProps(ctx *datastore.VersionedCtx, props []string) error {
+	timedLog := dvid.NewTimeLog()
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	if err := store.DeleteRange(ctx, storage.MinTKey(keyProp), storage.MaxTKey(keyProp)); err != nil {
+		return fmt.Errorf("unable to delete property index for annotations %q: %v", d.DataName(), err)
+	}
+	if len(props) == 0 {
+		return nil
+	}
+	batcher, err := d.getBatcher()
+	if err != nil {
+		return err
+	}
+	batch := batcher.NewBatch(ctx)
+	var numBlocks, numKeys int
+	err = store.ProcessRange(ctx, storage.MinTKey(keyBlock), storage.MaxTKey(keyBlock), nil, func(chunk *storage.Chunk) error {
+		if len(chunk.V) == 0 {
+			return nil
+		}
+		var elems Elements
+		if err := json.Unmarshal(chunk.V, &elems); err != nil {
+			return err
+		}
+		for _, elem := range elems {
+			for _, tk := range propTKeys(props, elem.ElementNR) {
+				batch.Put(tk, nil)
+				numKeys++
+			}
+		}
+		numBlocks++
+		if numBlocks%1000 == 0 {
+			if err := batch.Commit(); err != nil {
+				return err
+			}
+			batch = batcher.NewBatch(ctx)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := batch.Commit(); err != nil {
+		return err
+	}
+	timedLog.Infof("Indexed %d property values in %d blocks for annotation %q", numKeys, numBlocks, d.DataName())
+	return nil
+}
@@ -0,0 +1,729 @@
+/*
+	This file supports spatial primitives (polylines, boxes, and ellipsoids) that are stored
+	by a unique ID and indexed by the blocks they intersect and by the label at their anchor.
+*/
+
+package annotation
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/datatype/roi"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// MaxShapeBlocks is the maximum number of blocks a shape can be indexed under.
+const MaxShapeBlocks = 1 << 20
+
+const (
+	UnknownShape ShapeKind = iota
+	Polyline               // Connected line segments, e.g., a skeleton trace
+	Box                    // Axis-aligned box
+	Ellipsoid              // Axis-aligned ellipsoid
+)
+
+// ShapeKind gives the type of a spatial primitive.
+type ShapeKind uint8
+
+func (k ShapeKind) String() string {
+	switch k {
+	case Polyline:
+		return "Polyline"
+	case Box:
+		return "Box"
+	case Ellipsoid:
+		return "Ellipsoid"
+	default:
+		return fmt.Sprintf("Unknown shape kind: %d", k)
+	}
+}
+
+func (k ShapeKind) MarshalJSON() ([]byte, error) {
+	switch k {
+	case Polyline, Box, Ellipsoid:
+		return json.Marshal(k.String())
+	default:
+		return nil, fmt.Errorf("Unknown shape kind: %d", k)
+	}
+}
+
+func (k *ShapeKind) UnmarshalJSON(b []byte) error {
+	switch string(b) {
+	case `"Polyline"`:
+		*k = Polyline
+	case `"Box"`:
+		*k = Box
+	case `"Ellipsoid"`:
+		*k = Ellipsoid
+	default:
+		return fmt.Errorf("Unknown shape kind in JSON: %s", string(b))
+	}
+	return nil
+}
+
+// Shape is a spatial primitive identified by a unique ID.  Its anchor is the first point of
+// a polyline or the center of a box or ellipsoid and gives its label when synced.
+type Shape struct {
+	ID     uint64 `json:",omitempty"` // assigned on storage if zero
+	Kind   ShapeKind
+	Anchor dvid.Point3d // set on storage
+
+	Points []dvid.Point3d `json:",omitempty"` // polyline vertices
+	Min    *dvid.Point3d  `json:",omitempty"` // inclusive box corners
+	Max    *dvid.Point3d  `json:",omitempty"`
+	Center *dvid.Point3d  `json:",omitempty"` // ellipsoid center and radii in voxels
+	Radii  *[3]float64    `json:",omitempty"`
+
+	Tags  Tags
+	Prop  map[string]string
+	Label uint64 `json:",omitempty"` // label at anchor, set on storage and sync
+}
+
+// Shapes is a slice of shapes sortable by anchor and then ID.
+type Shapes []Shape
+
+func (s Shapes) Len() int {
+	return len(s)
+}
+
+func (s Shapes) Less(i, j int) bool {
+	if !s[i].Anchor.Equals(s[j].Anchor) {
+		return s[i].Anchor.Less(s[j].Anchor)
+	}
+	return s[i].ID < s[j].ID
+}
+
+func (s Shapes) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+
+// checks the shape geometry and sets its anchor.
+func (s *Shape) validate() error {
+	switch s.Kind {
+	case Polyline:
+		if len(s.Points) < 2 {
+			return fmt.Errorf("polyline must have at least 2 points, got %d", len(s.Points))
+		}
+		if s.Min != nil || s.Max != nil || s.Center != nil || s.Radii != nil {
+			return fmt.Errorf("polyline at %s can only have Points geometry", s.Points[0])
+		}
+		s.Anchor = s.Points[0]
+	case Box:
+		if s.Min == nil || s.Max == nil {
+			return fmt.Errorf("box must have Min and Max corners")
+		}
+		if len(s.Points) != 0 || s.Center != nil || s.Radii != nil {
+			return fmt.Errorf("box %s -> %s can only have Min and Max geometry", *s.Min, *s.Max)
+		}
+		for i := 0; i < 3; i++ {
+			if s.Min[i] > s.Max[i] {
+				return fmt.Errorf("box Min %s must not exceed Max %s", *s.Min, *s.Max)
+			}
+			s.Anchor[i] = int32(int64(s.Min[i]) + (int64(s.Max[i])-int64(s.Min[i]))/2)
+		}
+	case Ellipsoid:
+		if s.Center == nil || s.Radii == nil {
+			return fmt.Errorf("ellipsoid must have Center and Radii")
+		}
+		if len(s.Points) != 0 || s.Min != nil || s.Max != nil {
+			return fmt.Errorf("ellipsoid at %s can only have Center and Radii geometry", *s.Center)
+		}
+		for i := 0; i < 3; i++ {
+			if !(s.Radii[i] > 0) || math.IsInf(s.Radii[i], 0) {
+				return fmt.Errorf("ellipsoid at %s must have positive, finite radii, got %v", *s.Center, *s.Radii)
+			}
+		}
+		s.Anchor = *s.Center
+	default:
+		return fmt.Errorf("shape must have Kind of Polyline, Box, or Ellipsoid")
+	}
+	_, _, err := s.bounds()
+	return err
+}
+
+// returns the inclusive voxel bounds of the shape or an error if they fall outside the
+// int32 coordinate range.
+func (s Shape) bounds() (min, max dvid.Point3d, err error) {
+	switch s.Kind {
+	case Polyline:
+		min, max = s.Points[0], s.Points[0]
+		for _, pt := range s.Points[1:] {
+			for i := 0; i < 3; i++ {
+				if pt[i] < min[i] {
+					min[i] = pt[i]
+				}
+				if pt[i] > max[i] {
+					max[i] = pt[i]
+				}
+			}
+		}
+	case Box:
+		min, max = *s.Min, *s.Max
+	case Ellipsoid:
+		for i := 0; i < 3; i++ {
+			r := math.Ceil(s.Radii[i])
+			lo, hi := float64(s.Center[i])-r, float64(s.Center[i])+r
+			if lo < math.MinInt32 || hi > math.MaxInt32 {
+				err = fmt.Errorf("ellipsoid at %s with radii %v exceeds the coordinate range", *s.Center, *s.Radii)
+				return
+			}
+			min[i], max[i] = int32(lo), int32(hi)
+		}
+	}
+	return
+}
+
+// returns true if the segment from a to b intersects the box of voxels from lo to hi,
+// where each voxel extends 0.5 from its integer center.
+func segmentIntersects(a, b, lo, hi dvid.Point3d) bool {
+	t0, t1 := 0.0, 1.0
+	for i := 0; i < 3; i++ {
+		boxLo, boxHi := float64(lo[i])-0.5, float64(hi[i])+0.5
+		start, delta := float64(a[i]), float64(b[i]-a[i])
+		if delta == 0 {
+			if start < boxLo || start > boxHi {
+				return false
+			}
+			continue
+		}
+		tLo, tHi := (boxLo-start)/delta, (boxHi-start)/delta
+		if tLo > tHi {
+			tLo, tHi = tHi, tLo
+		}
+		t0, t1 = math.Max(t0, tLo), math.Min(t1, tHi)
+		if t0 > t1 {
+			return false
+		}
+	}
+	return true
+}
+
+// returns true if the shape intersects the box of voxels from lo to hi.
+func (s Shape) intersects(lo, hi dvid.Point3d) bool {
+	switch s.Kind {
+	case Polyline:
+		for i := 1; i < len(s.Points); i++ {
+			if segmentIntersects(s.Points[i-1], s.Points[i], lo, hi) {
+				return true
+			}
+		}
+		return false
+	case Box:
+		for i := 0; i < 3; i++ {
+			if s.Min[i] > hi[i] || s.Max[i] < lo[i] {
+				return false
+			}
+		}
+		return true
+	case Ellipsoid:
+		var sum float64
+		for i := 0; i < 3; i++ {
+			c := float64(s.Center[i])
+			nearest := math.Max(float64(lo[i])-0.5, math.Min(c, float64(hi[i])+0.5))
+			d := (nearest - c) / s.Radii[i]
+			sum += d * d
+		}
+		return sum <= 1
+	default:
+		return false
+	}
+}
+
+// returns the blocks intersected by the shape.
+func (s Shape) blocks(blockSize dvid.Point3d) ([]dvid.ChunkPoint3d, error) {
+	// Polyline segments are handled separately so long traces aren't indexed by their bounds.
+	type span struct{ min, max dvid.Point3d }
+	var spans []span
+	if s.Kind == Polyline {
+		for i := 1; i < len(s.Points); i++ {
+			a, b := s.Points[i-1], s.Points[i]
+			var sp span
+			for j := 0; j < 3; j++ {
+				sp.min[j], sp.max[j] = a[j], b[j]
+				if a[j] > b[j] {
+					sp.min[j], sp.max[j] = b[j], a[j]
+				}
+			}
+			spans = append(spans, sp)
+		}
+	} else {
+		min, max, err := s.bounds()
+		if err != nil {
+			return nil, err
+		}
+		spans = []span{{min, max}}
+	}
+
+	found := make(map[dvid.IZYXString]dvid.ChunkPoint3d)
+	var numTested int64
+	for _, sp := range spans {
+		begBlock := sp.min.Chunk(blockSize).(dvid.ChunkPoint3d)
+		endBlock := sp.max.Chunk(blockSize).(dvid.ChunkPoint3d)
+		spanBlocks := int64(1)
+		for i := 0; i < 3; i++ {
+			spanBlocks *= int64(endBlock[i]) - int64(begBlock[i]) + 1
+			if spanBlocks > MaxShapeBlocks {
+				break
+			}
+		}
+		if numTested += spanBlocks; numTested > MaxShapeBlocks {
+			return nil, fmt.Errorf("%s shape at %s spans more than %d blocks", s.Kind, s.Anchor, MaxShapeBlocks)
+		}
+		for z64 := int64(begBlock[2]); z64 <= int64(endBlock[2]); z64++ {
+			for y64 := int64(begBlock[1]); y64 <= int64(endBlock[1]); y64++ {
+				for x64 := int64(begBlock[0]); x64 <= int64(endBlock[0]); x64++ {
+					x, y, z := int32(x64), int32(y64), int32(z64)
+					bcoord := dvid.ChunkPoint3d{x, y, z}
+					lo := dvid.Point3d{x * blockSize[0], y * blockSize[1], z * blockSize[2]}
+					hi := dvid.Point3d{lo[0] + blockSize[0] - 1, lo[1] + blockSize[1] - 1, lo[2] + blockSize[2] - 1}
+					if s.intersects(lo, hi) {
+						found[bcoord.ToIZYXString()] = bcoord
+					}
+				}
+			}
+		}
+	}
+	blocks := make([]dvid.ChunkPoint3d, 0, len(found))
+	for _, bcoord := range found {
+		blocks = append(blocks, bcoord)
+	}
+	return blocks, nil
+}
+
+func getShape(ctx *datastore.VersionedCtx, id uint64) (*Shape, error) {
+	store, err := ctx.GetOrderedKeyValueDB()
+	if err != nil {
+		return nil, err
+	}
+	data, err := store.Get(ctx, NewShapeTKey(id))
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, nil
+	}
+	shape := new(Shape)
+	if err := json.Unmarshal(data, shape); err != nil {
+		return nil, err
+	}
+	return shape, nil
+}
+
+func putBatchShape(batch storage.Batch, shape *Shape) error {
+	val, err := json.Marshal(shape)
+	if err != nil {
+		return err
+	}
+	batch.Put(NewShapeTKey(shape.ID), val)
+	return nil
+}
+
+// deletes the shape and its block and label index keys.
+func (d *Data) deleteBatchShape(batch storage.Batch, shape *Shape) error {
+	blocks, err := shape.blocks(d.blockSize())
+	if err != nil {
+		return err
+	}
+	for _, bcoord := range blocks {
+		batch.Delete(NewShapeBlockTKey(bcoord, shape.ID))
+	}
+	if shape.Label != 0 {
+		batch.Delete(NewShapeLabelTKey(shape.Label, shape.ID))
+	}
+	batch.Delete(NewShapeTKey(shape.ID))
+	return nil
+}
+
+// StoreShapes adds shapes without an ID, assigning each a new unique ID, and replaces
+// stored shapes with the IDs of the others.  The IDs of the shapes are returned in order.
+func (d *Data) StoreShapes(ctx *datastore.VersionedCtx, shapes Shapes, kafkaOff bool) ([]uint64, error) {
+	var numNew int
+	given := make(map[uint64]struct{}, len(shapes))
+	for i := range shapes {
+		if err := shapes[i].validate(); err != nil {
+			return nil, err
+		}
+		if id := shapes[i].ID; id == 0 {
+			numNew++
+		} else if _, found := given[id]; found {
+			return nil, fmt.Errorf("shape ID %d given more than once", id)
+		} else {
+			given[id] = struct{}{}
+		}
+	}
+
+	// Replaced shapes must already exist so IDs are only ever assigned here.
+	olds := make([]*Shape, len(shapes))
+	for i, shape := range shapes {
+		if shape.ID == 0 {
+			continue
+		}
+		old, err := getShape(ctx, shape.ID)
+		if err != nil {
+			return nil, err
+		}
+		if old == nil {
+			return nil, fmt.Errorf("no shape with ID %d to replace", shape.ID)
+		}
+		olds[i] = old
+	}
+
+	// Get the labels at the anchors if synced.
+	lbls := make([]uint64, len(shapes))
+	if d.getSyncedLabels() != nil {
+		anchors := make([]dvid.Point3d, len(shapes))
+		for i, shape := range shapes {
+			anchors[i] = shape.Anchor
+		}
+		var err error
+		if lbls, err = d.getPointLabels(ctx.VersionID(), anchors); err != nil {
+			return nil, err
+		}
+	}
+
+	// New IDs come from the repo-wide mutation IDs.  Since the first reserved ID can be 0,
+	// which marks an unassigned shape, one extra ID is reserved and the first is skipped.
+	var nextID uint64
+	if numNew > 0 {
+		nextID = d.NewMutationIDs(uint64(numNew)+1) + 1
+	}
+
+	batcher, err := d.getBatcher()
+	if err != nil {
+		return nil, err
+	}
+	batch := batcher.NewBatch(ctx)
+	blockSize := d.blockSize()
+	ids := make([]uint64, len(shapes))
+	for i := range shapes {
+		shape := &shapes[i]
+		shape.Label = lbls[i]
+		if olds[i] != nil {
+			if err := d.deleteBatchShape(batch, olds[i]); err != nil {
+				return nil, err
+			}
+		} else {
+			shape.ID = nextID
+			nextID++
+		}
+		ids[i] = shape.ID
+		blocks, err := shape.blocks(blockSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, bcoord := range blocks {
+			batch.Put(NewShapeBlockTKey(bcoord, shape.ID), nil)
+		}
+		if shape.Label != 0 {
+			batch.Put(NewShapeLabelTKey(shape.Label, shape.ID), nil)
+		}
+		if err := putBatchShape(batch, shape); err != nil {
+			return nil, err
+		}
+	}
+
+	if !kafkaOff {
+		versionuuid, _ := datastore.UUIDFromVersion(ctx.VersionID())
+		msginfo := map[string]interface{}{
+			"Action":    "shape-post",
+			"Shapes":    shapes,
+			"UUID":      string(versionuuid),
+			"Timestamp": time.Now().String(),
+		}
+		jsonmsg, err := json.Marshal(msginfo)
+		if err != nil {
+			dvid.Errorf("error marshaling JSON for annotations %q shape post: %v\n", d.DataName(), err)
+		} else if err = d.ProduceKafkaMsg(jsonmsg); err != nil {
+			dvid.Errorf("error on sending shape post op to kafka: %v\n", err)
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// DeleteShape deletes the shape with the given ID.
+func (d *Data) DeleteShape(ctx *datastore.VersionedCtx, id uint64, kafkaOff bool) error {
+	shape, err := getShape(ctx, id)
+	if err != nil {
+		return err
+	}
+	if shape == nil {
+		return fmt.Errorf("Did not find shape with ID %d in datastore", id)
+	}
+	batcher, err := d.getBatcher()
+	if err != nil {
+		return err
+	}
+	batch := batcher.NewBatch(ctx)
+	if err := d.deleteBatchShape(batch, shape); err != nil {
+		return err
+	}
+
+	if !kafkaOff {
+		versionuuid, _ := datastore.UUIDFromVersion(ctx.VersionID())
+		msginfo := map[string]interface{}{
+			"Action":    "shape-delete",
+			"ID":        id,
+			"UUID":      string(versionuuid),
+			"Timestamp": time.Now().String(),
+		}
+		jsonmsg, err := json.Marshal(msginfo)
+		if err != nil {
+			dvid.Errorf("error marshaling JSON for annotations %q shape delete: %v\n", d.DataName(), err)
+		} else if err = d.ProduceKafkaMsg(jsonmsg); err != nil {
+			dvid.Errorf("error on sending shape delete op to kafka: %v\n", err)
+		}
+	}
+	return batch.Commit()
+}
+
+// returns the IDs of shapes indexed in blocks from begX to endX at the given y and z.
+func getShapeBlockRowIDs(ctx *datastore.VersionedCtx, store storage.OrderedKeyValueDB, begX, endX, y, z int32, ids map[uint64]struct{}) error {
+	begTKey := NewShapeBlockTKey(dvid.ChunkPoint3d{begX, y, z}, 0)
+	endTKey := NewShapeBlockTKey(dvid.ChunkPoint3d{endX, y, z}, math.MaxUint64)
+	tkeys, err := store.KeysInRange(ctx, begTKey, endTKey)
+	if err != nil {
+		return err
+	}
+	for _, tk := range tkeys {
+		_, id, err := DecodeShapeBlockTKey(tk)
+		if err != nil {
+			return err
+		}
+		ids[id] = struct{}{}
+	}
+	return nil
+}
+
+// returns the shapes with the given IDs sorted by anchor.
+func getShapes(ctx *datastore.VersionedCtx, ids map[uint64]struct{}) (Shapes, error) {
+	shapes := make(Shapes, 0, len(ids))
+	for id := range ids {
+		shape, err := getShape(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if shape == nil {
+			dvid.Errorf("shape index has ID %d with no shape\n", id)
+			continue
+		}
+		shapes = append(shapes, *shape)
+	}
+	sort.Sort(shapes)
+	return shapes, nil
+}
+
+// GetRegionShapes returns the shapes intersecting the given subvolume.
+func (d *Data) GetRegionShapes(ctx *datastore.VersionedCtx, ext *dvid.Extents3d) (Shapes, error) {
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	begBlock, endBlock := ext.BlockRange(d.blockSize())
+	ids := make(map[uint64]struct{})
+	for z := begBlock[2]; z <= endBlock[2]; z++ {
+		for y := begBlock[1]; y <= endBlock[1]; y++ {
+			if err := getShapeBlockRowIDs(ctx, store, begBlock[0], endBlock[0], y, z, ids); err != nil {
+				return nil, err
+			}
+		}
+	}
+	shapes, err := getShapes(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	filtered := shapes[:0]
+	for _, shape := range shapes {
+		if shape.intersects(ext.MinPoint, ext.MaxPoint) {
+			filtered = append(filtered, shape)
+		}
+	}
+	return filtered, nil
+}
+
+// GetROIShapes returns the shapes intersecting blocks of the given ROI.
+func (d *Data) GetROIShapes(ctx *datastore.VersionedCtx, roiSpec storage.FilterSpec) (Shapes, error) {
+	roidata, roiV, roiFound, err := roi.DataByFilter(roiSpec)
+	if err != nil {
+		return nil, fmt.Errorf("ROI specification was not parsable (%s): %v", roiSpec, err)
+	}
+	if !roiFound {
+		return nil, fmt.Errorf("No ROI found that matches specification %q", roiSpec)
+	}
+	if !d.blockSize().Equals(roidata.BlockSize) {
+		return nil, fmt.Errorf("ROI %q must have same block size as annotation %q", roidata.DataName(), d.DataName())
+	}
+	roiSpans, err := roidata.GetSpans(roiV)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get ROI spans for %q: %v", roiSpec, err)
+	}
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[uint64]struct{})
+	for _, span := range roiSpans {
+		if err := getShapeBlockRowIDs(ctx, store, span[2], span[3], span[1], span[0], ids); err != nil {
+			return nil, err
+		}
+	}
+	return getShapes(ctx, ids)
+}
+
+// returns the IDs of shapes indexed under the given label.
+func getLabelShapeIDs(ctx *datastore.VersionedCtx, label uint64) ([]uint64, error) {
+	store, err := ctx.GetOrderedKeyValueDB()
+	if err != nil {
+		return nil, err
+	}
+	begTKey := NewShapeLabelTKey(label, 0)
+	endTKey := NewShapeLabelTKey(label, math.MaxUint64)
+	tkeys, err := store.KeysInRange(ctx, begTKey, endTKey)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint64, len(tkeys))
+	for i, tk := range tkeys {
+		if _, ids[i], err = DecodeShapeLabelTKey(tk); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// GetLabelShapes returns the shapes whose anchor is in the given label.
+func (d *Data) GetLabelShapes(ctx *datastore.VersionedCtx, label uint64) (Shapes, error) {
+	idList, err := getLabelShapeIDs(ctx, label)
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[uint64]struct{}, len(idList))
+	for _, id := range idList {
+		ids[id] = struct{}{}
+	}
+	return getShapes(ctx, ids)
+}
+
+// updateShapeLabels sets the labels of the given shapes.
+func (d *Data) updateShapeLabels(ctx *datastore.VersionedCtx, shapes Shapes, lbls []uint64) error {
+	if len(shapes) == 0 {
+		return nil
+	}
+	batcher, err := d.getBatcher()
+	if err != nil {
+		return err
+	}
+	batch := batcher.NewBatch(ctx)
+	for i := range shapes {
+		shape := &shapes[i]
+		if shape.Label == lbls[i] {
+			continue
+		}
+		if shape.Label != 0 {
+			batch.Delete(NewShapeLabelTKey(shape.Label, shape.ID))
+		}
+		if lbls[i] != 0 {
+			batch.Put(NewShapeLabelTKey(lbls[i], shape.ID), nil)
+		}
+		shape.Label = lbls[i]
+		if err := putBatchShape(batch, shape); err != nil {
+			return err
+		}
+	}
+	return batch.Commit()
+}
+
+// relabelBlockShapes updates the labels of shapes anchored in a block given its label data.
+func (d *Data) relabelBlockShapes(ctx *datastore.VersionedCtx, chunkPt dvid.ChunkPoint3d, data []byte) error {
+	blockSize := d.blockSize()
+	if int64(len(data)) != blockSize.Prod()*8 {
+		return fmt.Errorf("block %s has %d bytes, not %s block of labels", chunkPt, len(data), blockSize)
+	}
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	ids := make(map[uint64]struct{})
+	if err := getShapeBlockRowIDs(ctx, store, chunkPt[0], chunkPt[0], chunkPt[1], chunkPt[2], ids); err != nil {
+		return err
+	}
+	blockShapes, err := getShapes(ctx, ids)
+	if err != nil {
+		return err
+	}
+	var shapes Shapes
+	var lbls []uint64
+	for _, shape := range blockShapes {
+		if !shape.Anchor.Chunk(blockSize).(dvid.ChunkPoint3d).Equals(chunkPt) {
+			continue
+		}
+		pt := shape.Anchor.Point3dInChunk(blockSize)
+		i := ((pt[2]*blockSize[1]+pt[1])*blockSize[0] + pt[0]) * 8
+		shapes = append(shapes, shape)
+		lbls = append(lbls, binary.LittleEndian.Uint64(data[i:i+8]))
+	}
+	return d.updateShapeLabels(ctx, shapes, lbls)
+}
+
+// returns the shapes indexed under any of the given labels.
+func getLabelsShapes(ctx *datastore.VersionedCtx, lbls ...uint64) (Shapes, error) {
+	ids := make(map[uint64]struct{})
+	for _, label := range lbls {
+		labelIDs, err := getLabelShapeIDs(ctx, label)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range labelIDs {
+			ids[id] = struct{}{}
+		}
+	}
+	return getShapes(ctx, ids)
+}
+
+// mergeShapes relabels shapes of merged labels to the target label.
+func (d *Data) mergeShapes(ctx *datastore.VersionedCtx, target uint64, merged labels.Set) error {
+	mergedLabels := make([]uint64, 0, len(merged))
+	for label := range merged {
+		mergedLabels = append(mergedLabels, label)
+	}
+	shapes, err := getLabelsShapes(ctx, mergedLabels...)
+	if err != nil {
+		return err
+	}
+	lbls := make([]uint64, len(shapes))
+	for i := range lbls {
+		lbls[i] = target
+	}
+	return d.updateShapeLabels(ctx, shapes, lbls)
+}
+
+// relabelShapes updates the labels of shapes currently in the given labels using the
+// synced label data.
+func (d *Data) relabelShapes(ctx *datastore.VersionedCtx, affected ...uint64) error {
+	shapes, err := getLabelsShapes(ctx, affected...)
+	if err != nil {
+		return err
+	}
+	if len(shapes) == 0 {
+		return nil
+	}
+	anchors := make([]dvid.Point3d, len(shapes))
+	for i, shape := range shapes {
+		anchors[i] = shape.Anchor
+	}
+	lbls, err := d.getPointLabels(ctx.VersionID(), anchors)
+	if err != nil {
+		return err
+	}
+	return d.updateShapeLabels(ctx, shapes, lbls)
+}
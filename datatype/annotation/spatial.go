@@ -0,0 +1,312 @@
+/*
+	This file supports nearest-neighbor and radius queries on the block-indexed elements.
+*/
+
+package annotation
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// DefaultNearestMaxDist is the default maximum distance in voxels searched for nearest elements.
+const DefaultNearestMaxDist = 1000.0
+
+// MaxSearchBlocks is the maximum number of annotation blocks a nearest or radius query
+// can search.
+const MaxSearchBlocks = 1 << 21
+
+// ElementDistance is an element with its distance, in voxels or physical units, from a
+// query point.
+type ElementDistance struct {
+	Element
+	Distance float64
+}
+
+// ElementDistances is a slice of elements sortable by increasing distance.
+type ElementDistances []ElementDistance
+
+func (elems ElementDistances) Len() int {
+	return len(elems)
+}
+
+func (elems ElementDistances) Less(i, j int) bool {
+	if elems[i].Distance != elems[j].Distance {
+		return elems[i].Distance < elems[j].Distance
+	}
+	return elems[i].Pos.Less(elems[j].Pos)
+}
+
+func (elems ElementDistances) Swap(i, j int) {
+	elems[i], elems[j] = elems[j], elems[i]
+}
+
+// ElementFilter restricts spatial queries to elements of a kind and/or with a tag.
+// Zero values match all elements.
+type ElementFilter struct {
+	Kind ElementType
+	Tag  Tag
+}
+
+// NewElementFilter returns a filter from kind and tag strings, either of which can be empty.
+func NewElementFilter(kind, tag string) (ElementFilter, error) {
+	var filter ElementFilter
+	if kind != "" {
+		filter.Kind = StringToElementType(kind)
+		if filter.Kind == UnknownElem {
+			return filter, fmt.Errorf("unknown element kind %q", kind)
+		}
+	}
+	filter.Tag = Tag(tag)
+	return filter, nil
+}
+
+// Matches returns true if the element passes the filter.
+func (f ElementFilter) Matches(elem ElementNR) bool {
+	if f.Kind != UnknownElem && elem.Kind != f.Kind {
+		return false
+	}
+	if f.Tag != "" {
+		for _, tag := range elem.Tags {
+			if tag == f.Tag {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// returns the per-axis scale from voxels to distance units given a voxel size, where an
+// empty voxel size gives distances in voxels.
+func distanceScale(voxelSize dvid.NdFloat32) (scale [3]float64, err error) {
+	scale = [3]float64{1, 1, 1}
+	if len(voxelSize) == 0 {
+		return
+	}
+	if len(voxelSize) != 3 {
+		err = fmt.Errorf("voxel size for distances must be 3d, got %v", voxelSize)
+		return
+	}
+	for i := 0; i < 3; i++ {
+		size := float64(voxelSize[i])
+		if !(size > 0) || math.IsInf(size, 1) {
+			err = fmt.Errorf("voxel size for distances must be positive and finite, got %v", voxelSize)
+			return
+		}
+		scale[i] = size
+	}
+	return
+}
+
+func pointDistance(a, b dvid.Point3d, scale [3]float64) float64 {
+	var sum float64
+	for i := 0; i < 3; i++ {
+		delta := (float64(a[i]) - float64(b[i])) * scale[i]
+		sum += delta * delta
+	}
+	return math.Sqrt(sum)
+}
+
+// returns the range of blocks holding any voxel within the given distance of a point, or
+// an error if the distance isn't finite and non-negative or the range has more than
+// MaxSearchBlocks blocks.
+func (d *Data) searchBlockRange(center dvid.Point3d, dist float64, scale [3]float64) (beg, end dvid.ChunkPoint3d, err error) {
+	if math.IsNaN(dist) || math.IsInf(dist, 0) || dist < 0 {
+		err = fmt.Errorf("search distance must be finite and non-negative, got %f", dist)
+		return
+	}
+	blockSize := d.blockSize()
+	numBlocks := 1.0
+	for i := 0; i < 3; i++ {
+		r := dist / scale[i]
+		lo := math.Floor((float64(center[i]) - r) / float64(blockSize[i]))
+		hi := math.Floor((float64(center[i]) + r) / float64(blockSize[i]))
+		if numBlocks *= hi - lo + 1; numBlocks > MaxSearchBlocks {
+			err = fmt.Errorf("search distance %f from %s covers more than %d blocks", dist, center, MaxSearchBlocks)
+			return
+		}
+		beg[i] = int32(math.Max(lo, math.MinInt32))
+		end[i] = int32(math.Min(hi, math.MaxInt32))
+	}
+	return
+}
+
+// QueryVoxelSize returns the voxel size used for distances in nearest and radius queries
+// from "voxelsize" or "physical" query strings.  If "physical" is "true" without a voxel
+// size, the resolution of the synced label data is used.  A nil voxel size means
+// distances are in voxels.
+func (d *Data) QueryVoxelSize(queryStrings url.Values) (dvid.NdFloat32, error) {
+	if sizeStr := queryStrings.Get("voxelsize"); sizeStr != "" {
+		return dvid.StringToNdFloat32(sizeStr, "_")
+	}
+	if queryStrings.Get("physical") != "true" {
+		return nil, nil
+	}
+	if labelData, ok := d.getSyncedLabels().(resolutionType); ok {
+		if voxelSize := labelData.Resolution().VoxelSize; len(voxelSize) == 3 {
+			return voxelSize, nil
+		}
+	}
+	return nil, fmt.Errorf("physical distances for annotation %q require a voxelsize or synced label data with a resolution", d.DataName())
+}
+
+// resolutionType is data with a voxel resolution, e.g., synced label data.
+type resolutionType interface {
+	Resolution() dvid.Resolution
+}
+
+// calls f on the elements of each stored block along x from begX to endX at the given y and z.
+func processBlockRow(ctx *datastore.VersionedCtx, store storage.OrderedKeyValueDB, begX, endX, y, z int32, f func(Elements)) error {
+	begTKey := NewBlockTKey(dvid.ChunkPoint3d{begX, y, z})
+	endTKey := NewBlockTKey(dvid.ChunkPoint3d{endX, y, z})
+	return store.ProcessRange(ctx, begTKey, endTKey, nil, func(chunk *storage.Chunk) error {
+		if len(chunk.V) == 0 {
+			return nil
+		}
+		var blockElems Elements
+		if err := json.Unmarshal(chunk.V, &blockElems); err != nil {
+			return err
+		}
+		f(blockElems)
+		return nil
+	})
+}
+
+// GetRadiusElements returns elements passing the filter within the given radius of a point,
+// sorted by increasing distance.  Distances are in the units of the given voxel size, or in
+// voxels if it is empty.
+func (d *Data) GetRadiusElements(ctx *datastore.VersionedCtx, center dvid.Point3d, radius float64, voxelSize dvid.NdFloat32, filter ElementFilter) (ElementDistances, error) {
+	scale, err := distanceScale(voxelSize)
+	if err != nil {
+		return nil, err
+	}
+	begBlock, endBlock, err := d.searchBlockRange(center, radius, scale)
+	if err != nil {
+		return nil, err
+	}
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+
+	found := ElementDistances{}
+	addElems := func(elems Elements) {
+		for _, elem := range elems {
+			if !filter.Matches(elem.ElementNR) {
+				continue
+			}
+			if dist := pointDistance(center, elem.Pos, scale); dist <= radius {
+				found = append(found, ElementDistance{elem, dist})
+			}
+		}
+	}
+	for z := begBlock[2]; z <= endBlock[2]; z++ {
+		for y := begBlock[1]; y <= endBlock[1]; y++ {
+			if err := processBlockRow(ctx, store, begBlock[0], endBlock[0], y, z, addElems); err != nil {
+				return nil, err
+			}
+		}
+	}
+	sort.Sort(found)
+	return found, nil
+}
+
+// GetNearestElements returns up to k elements passing the filter that are nearest to a point,
+// sorted by increasing distance.  The search proceeds outward in shells of blocks and stops
+// once no unsearched block could hold a closer element or the maximum distance is reached.
+// Distances are in the units of the given voxel size, or in voxels if it is empty.
+func (d *Data) GetNearestElements(ctx *datastore.VersionedCtx, center dvid.Point3d, k int, maxDist float64, voxelSize dvid.NdFloat32, filter ElementFilter) (ElementDistances, error) {
+	if k <= 0 {
+		return nil, fmt.Errorf("number of nearest elements must be positive, got %d", k)
+	}
+	scale, err := distanceScale(voxelSize)
+	if err != nil {
+		return nil, err
+	}
+	begBlock, endBlock, err := d.searchBlockRange(center, maxDist, scale)
+	if err != nil {
+		return nil, err
+	}
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	blockSize := d.blockSize()
+	c := center.Chunk(blockSize).(dvid.ChunkPoint3d)
+
+	// The shells never need to go beyond the blocks within the maximum distance.
+	var maxShell int32
+	for i := 0; i < 3; i++ {
+		if n := c[i] - begBlock[i]; n > maxShell {
+			maxShell = n
+		}
+		if n := endBlock[i] - c[i]; n > maxShell {
+			maxShell = n
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if int64(c[i])-int64(maxShell) < math.MinInt32 || int64(c[i])+int64(maxShell) >= math.MaxInt32 {
+			return nil, fmt.Errorf("search within %f of %s exceeds the block coordinate range", maxDist, center)
+		}
+	}
+
+	found := ElementDistances{}
+	addElems := func(elems Elements) {
+		for _, elem := range elems {
+			if !filter.Matches(elem.ElementNR) {
+				continue
+			}
+			if dist := pointDistance(center, elem.Pos, scale); dist <= maxDist {
+				found = append(found, ElementDistance{elem, dist})
+			}
+		}
+	}
+	for n := int32(0); n <= maxShell; n++ {
+		// Process the shell of blocks at Chebyshev distance n from the center block.
+		for z := c[2] - n; z <= c[2]+n; z++ {
+			for y := c[1] - n; y <= c[1]+n; y++ {
+				if n == 0 || z == c[2]-n || z == c[2]+n || y == c[1]-n || y == c[1]+n {
+					err = processBlockRow(ctx, store, c[0]-n, c[0]+n, y, z, addElems)
+				} else {
+					if err = processBlockRow(ctx, store, c[0]-n, c[0]-n, y, z, addElems); err == nil {
+						err = processBlockRow(ctx, store, c[0]+n, c[0]+n, y, z, addElems)
+					}
+				}
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		// Any unsearched voxel is at least this distance from the center.
+		minUnsearched := math.MaxFloat64
+		for i := uint8(0); i < 3; i++ {
+			lo := (int64(c[i]) - int64(n)) * int64(blockSize[i])
+			hi := (int64(c[i])+int64(n)+1)*int64(blockSize[i]) - 1
+			minUnsearched = math.Min(minUnsearched, float64(int64(center[i])-lo+1)*scale[i])
+			minUnsearched = math.Min(minUnsearched, float64(hi-int64(center[i])+1)*scale[i])
+		}
+		if minUnsearched > maxDist {
+			break
+		}
+		if len(found) >= k {
+			sort.Sort(found)
+			if found[k-1].Distance <= minUnsearched {
+				break
+			}
+		}
+	}
+	sort.Sort(found)
+	if len(found) > k {
+		found = found[:k]
+	}
+	return found, nil
+}
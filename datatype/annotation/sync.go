@@ -210,6 +210,11 @@ func (d *Data) GetSyncSubs(synced dvid.Data) (subs datastore.SyncSubs, err error
 				Notify: d.DataUUID(),
 				Ch:     d.syncCh,
 			},
+			datastore.SyncSub{
+				Event:  datastore.SyncEvent{synced.DataUUID(), labels.BatchEvent},
+				Notify: d.DataUUID(),
+				Ch:     d.syncCh,
+			},
 		}
 	default:
 		err = fmt.Errorf("unable to sync %s with %s since datatype %q is not supported", d.DataName(), synced.DataName(), synced.TypeName())
@@ -341,6 +346,25 @@ func (d *Data) handleSyncMessage(ctx *datastore.VersionedCtx, msg datastore.Sync
 		}
 		mutID = delta.MutID
 
+	case labels.DeltaBatch:
+		for _, opDelta := range delta.Deltas {
+			var err error
+			switch op := opDelta.(type) {
+			case labels.DeltaMerge:
+				err = d.mergeLabels(batcher, msg.Version, op.MergeOp)
+			case labels.CleaveOp:
+				err = d.cleaveLabels(batcher, msg.Version, op)
+			case labels.SplitSupervoxelOp:
+				// supervoxel split does not change labels of a point, so ignored
+			}
+			if err != nil {
+				diagnostic = fmt.Sprintf("error on batch mutation for data %s: %v", d.DataName(), err)
+				successful = false
+				break
+			}
+		}
+		mutID = delta.MutID
+
 	default:
 		diagnostic = fmt.Sprintf("critical error - unexpected delta: %v\n", msg)
 		successful = false
@@ -372,6 +396,9 @@ func (d *Data) ingestBlock(ctx *datastore.VersionedCtx, chunkPt dvid.ChunkPoint3
 		dvid.Errorf("ingested block %s during sync of annotation %q is not appropriate block size %s (block data bytes = %d)... skipping\n", chunkPt, d.DataName(), blockSize, len(data))
 		return
 	}
+	if err := d.relabelBlockShapes(ctx, chunkPt, data); err != nil {
+		dvid.Errorf("unable to relabel shapes in block %s of annotation %q: %v\n", chunkPt, d.DataName(), err)
+	}
 
 	// Get the synaptic elements for this block
 	tk := NewBlockTKey(chunkPt)
@@ -427,6 +454,9 @@ func (d *Data) ingestBlock(ctx *datastore.VersionedCtx, chunkPt dvid.ChunkPoint3
 		dvid.Criticalf("bad commit in annotations %q after delete block: %v\n", d.DataName(), err)
 		return
 	}
+	if err := d.updateElementConnections(ctx, elems); err != nil {
+		dvid.Errorf("unable to update connections in annotations %q after ingest of block %s: %v\n", d.DataName(), chunkPt, err)
+	}
 
 	// Notify any subscribers of label annotation changes.
 	evt := datastore.SyncEvent{Data: d.DataUUID(), Event: ModifyElementsEvent}
@@ -452,6 +482,10 @@ func (d *Data) ingestBlock(ctx *datastore.VersionedCtx, chunkPt dvid.ChunkPoint3
 
 // If a block of labels is mutated, adjust any label that was either removed or added.
 func (d *Data) mutateBlock(ctx *datastore.VersionedCtx, chunkPt dvid.ChunkPoint3d, prev, data []byte, batcher storage.KeyValueBatcher) {
+	if err := d.relabelBlockShapes(ctx, chunkPt, data); err != nil {
+		dvid.Errorf("unable to relabel shapes in block %s of annotation %q: %v\n", chunkPt, d.DataName(), err)
+	}
+
 	// Get the synaptic elements for this block
 	tk := NewBlockTKey(chunkPt)
 	elems, err := getElements(ctx, tk)
@@ -523,6 +557,16 @@ func (d *Data) mutateBlock(ctx *datastore.VersionedCtx, chunkPt dvid.ChunkPoint3
 		dvid.Criticalf("bad commit in annotations %q after delete block: %v\n", d.DataName(), err)
 		return
 	}
+	affected, err := d.getSynapticLabels(ctx.VersionID(), elems)
+	if err == nil {
+		for label := range labels {
+			affected[label] = struct{}{}
+		}
+		err = d.updateConnections(ctx, affected)
+	}
+	if err != nil {
+		dvid.Errorf("unable to update connections in annotations %q after mutation of block %s: %v\n", d.DataName(), chunkPt, err)
+	}
 
 	// Notify any subscribers of label annotation changes.
 	evt := datastore.SyncEvent{Data: d.DataUUID(), Event: ModifyElementsEvent}
@@ -606,6 +650,12 @@ func (d *Data) mergeLabels(batcher storage.KeyValueBatcher, v dvid.VersionID, op
 			dvid.Errorf("unable to write merge to kafka for data %q: %v\n", d.DataName(), err)
 		}
 	}
+	if err := d.mergeConnections(ctx, op.Target, op.Merged); err != nil {
+		return fmt.Errorf("unable to merge connections for instance %q: %v", d.DataName(), err)
+	}
+	if err := d.mergeShapes(ctx, op.Target, op.Merged); err != nil {
+		return fmt.Errorf("unable to merge shapes for instance %q: %v", d.DataName(), err)
+	}
 
 	// Notify any subscribers of label annotation changes.
 	evt := datastore.SyncEvent{Data: d.DataUUID(), Event: ModifyElementsEvent}
@@ -624,6 +674,9 @@ func (d *Data) cleaveLabels(batcher storage.KeyValueBatcher, v dvid.VersionID, o
 	defer d.StopUpdate()
 
 	ctx := datastore.NewVersionedCtx(d, v)
+	if err := d.relabelShapes(ctx, op.Target); err != nil {
+		return fmt.Errorf("unable to relabel shapes after cleave in annotations %q: %v", d.DataName(), err)
+	}
 	targetTk := NewLabelTKey(op.Target)
 	targetElems, err := getElementsNR(ctx, targetTk)
 	if err != nil {
@@ -669,6 +722,13 @@ func (d *Data) cleaveLabels(batcher storage.KeyValueBatcher, v dvid.VersionID, o
 	if err := batch.Commit(); err != nil {
 		return fmt.Errorf("bad commit in annotations %q after split: %v", d.DataName(), err)
 	}
+	affected := labels.Set{op.Target: struct{}{}}
+	for label := range labelElems {
+		affected[label] = struct{}{}
+	}
+	if err := d.updateConnections(ctx, affected); err != nil {
+		return fmt.Errorf("unable to update connections after cleave in annotations %q: %v", d.DataName(), err)
+	}
 
 	// Notify any subscribers of label annotation changes.
 	if len(delta.Add) != 0 || len(delta.Del) != 0 {
@@ -703,6 +763,9 @@ func (d *Data) splitLabelsCoarse(batcher storage.KeyValueBatcher, v dvid.Version
 	defer d.StopUpdate()
 
 	ctx := datastore.NewVersionedCtx(d, v)
+	if err := d.relabelShapes(ctx, op.OldLabel); err != nil {
+		return fmt.Errorf("unable to relabel shapes after split in annotations %q: %v", d.DataName(), err)
+	}
 	batch := batcher.NewBatch(ctx)
 
 	// Get the elements for the old label.
@@ -775,6 +838,10 @@ func (d *Data) splitLabelsCoarse(batcher storage.KeyValueBatcher, v dvid.Version
 	if err := batch.Commit(); err != nil {
 		return fmt.Errorf("bad commit in annotations %q after split: %v", d.DataName(), err)
 	}
+	affected := labels.Set{op.OldLabel: struct{}{}, op.NewLabel: struct{}{}}
+	if err := d.updateConnections(ctx, affected); err != nil {
+		return fmt.Errorf("unable to update connections after split in annotations %q: %v", d.DataName(), err)
+	}
 
 	// Notify any subscribers of label annotation changes.
 	evt := datastore.SyncEvent{Data: d.DataUUID(), Event: ModifyElementsEvent}
@@ -807,6 +874,9 @@ func (d *Data) splitLabels(batcher storage.KeyValueBatcher, v dvid.VersionID, op
 	defer d.StopUpdate()
 
 	ctx := datastore.NewVersionedCtx(d, v)
+	if err := d.relabelShapes(ctx, op.OldLabel); err != nil {
+		return fmt.Errorf("unable to relabel shapes after split in annotations %q: %v", d.DataName(), err)
+	}
 	batch := batcher.NewBatch(ctx)
 
 	var delta DeltaModifyElements
@@ -889,6 +959,10 @@ func (d *Data) splitLabels(batcher storage.KeyValueBatcher, v dvid.VersionID, op
 	if err := batch.Commit(); err != nil {
 		return fmt.Errorf("bad commit in annotations %q after split: %v", d.DataName(), err)
 	}
+	affected := labels.Set{op.OldLabel: struct{}{}, op.NewLabel: struct{}{}}
+	if err := d.updateConnections(ctx, affected); err != nil {
+		return fmt.Errorf("unable to update connections after split in annotations %q: %v", d.DataName(), err)
+	}
 
 	// Notify any subscribers of label annotation changes.
 	evt := datastore.SyncEvent{Data: d.DataUUID(), Event: ModifyElementsEvent}
@@ -0,0 +1,359 @@
+/*
+	This file supports validation of element relationships on mutation and integrity reports.
+*/
+
+package annotation
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// ValidationMode determines how relationship violations are handled on mutation.
+type ValidationMode string
+
+const (
+	// ValidationOff does not check mutations.
+	ValidationOff ValidationMode = "off"
+
+	// ValidationWarn logs violations but allows the mutation.
+	ValidationWarn ValidationMode = "warn"
+
+	// ValidationStrict rejects mutations with violations.
+	ValidationStrict ValidationMode = "strict"
+)
+
+// NewValidationMode returns a validation mode from a string, where an empty string is off.
+func NewValidationMode(s string) (ValidationMode, error) {
+	switch ValidationMode(strings.ToLower(s)) {
+	case "", ValidationOff:
+		return ValidationOff, nil
+	case ValidationWarn:
+		return ValidationWarn, nil
+	case ValidationStrict:
+		return ValidationStrict, nil
+	default:
+		return "", fmt.Errorf("unknown validation mode %q, must be off, warn, or strict", s)
+	}
+}
+
+// Reciprocal returns the relationship expected from the target of a relationship back
+// to its source.
+func (r RelationType) Reciprocal() RelationType {
+	switch r {
+	case PreSynTo:
+		return PostSynTo
+	case PostSynTo:
+		return PreSynTo
+	default:
+		return r
+	}
+}
+
+func (r RelationType) String() string {
+	b, err := r.MarshalJSON()
+	if err != nil {
+		return fmt.Sprintf("Unknown relation type: %d", r)
+	}
+	return strings.Trim(string(b), `"`)
+}
+
+// returns true if the element has the given relationship.
+func (e Element) hasRel(rel RelationType, to dvid.Point3d) bool {
+	for _, r := range e.Rels {
+		if r.Rel == rel && r.To.Equals(to) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Data) validationMode() ValidationMode {
+	if d.Validation == "" {
+		return ValidationOff
+	}
+	return d.Validation
+}
+
+// elementCache retrieves stored elements by position, caching the elements of each block read.
+type elementCache struct {
+	ctx       *datastore.VersionedCtx
+	blockSize dvid.Point3d
+	blocks    map[dvid.IZYXString]map[string]Element
+}
+
+// maximum number of blocks held by an elementCache before it is cleared.
+const maxCachedBlocks = 10000
+
+func (d *Data) newElementCache(ctx *datastore.VersionedCtx) *elementCache {
+	return &elementCache{
+		ctx:       ctx,
+		blockSize: d.blockSize(),
+		blocks:    make(map[dvid.IZYXString]map[string]Element),
+	}
+}
+
+func (c *elementCache) get(pt dvid.Point3d) (elem Element, found bool, err error) {
+	izyx := pt.ToBlockIZYXString(c.blockSize)
+	emap, cached := c.blocks[izyx]
+	if !cached {
+		var bcoord dvid.ChunkPoint3d
+		if bcoord, err = izyx.ToChunkPoint3d(); err != nil {
+			return
+		}
+		var elems Elements
+		if elems, err = getElements(c.ctx, NewBlockTKey(bcoord)); err != nil {
+			return
+		}
+		if len(c.blocks) >= maxCachedBlocks {
+			c.blocks = make(map[dvid.IZYXString]map[string]Element)
+		}
+		emap = make(map[string]Element, len(elems))
+		for _, e := range elems {
+			emap[e.Pos.MapKey()] = e
+		}
+		c.blocks[izyx] = emap
+	}
+	elem, found = emap[pt.MapKey()]
+	return
+}
+
+// validateElements returns the relationship violations that storing the given elements
+// would create.  Every relationship must have an element at its target, and that element
+// must have the reciprocal relationship, e.g., a PreSynTo is matched by a PostSynTo.
+func (d *Data) validateElements(ctx *datastore.VersionedCtx, elems Elements) ([]string, error) {
+	var violations []string
+	posted := make(map[string]Element, len(elems))
+	for _, elem := range elems {
+		key := elem.Pos.MapKey()
+		if _, found := posted[key]; found {
+			violations = append(violations, fmt.Sprintf("duplicate element position %s", elem.Pos))
+		}
+		posted[key] = elem
+	}
+	cache := d.newElementCache(ctx)
+	getElement := func(pt dvid.Point3d) (Element, bool, error) {
+		if elem, found := posted[pt.MapKey()]; found {
+			return elem, true, nil
+		}
+		return cache.get(pt)
+	}
+
+	for _, elem := range elems {
+		for _, rel := range elem.Rels {
+			target, found, err := getElement(rel.To)
+			if err != nil {
+				return nil, err
+			}
+			if !found {
+				violations = append(violations, fmt.Sprintf("%s relationship from %s to %s has no element at target", rel.Rel, elem.Pos, rel.To))
+			} else if !target.hasRel(rel.Rel.Reciprocal(), elem.Pos) {
+				violations = append(violations, fmt.Sprintf("%s relationship from %s to %s is not reciprocated by a %s relationship", rel.Rel, elem.Pos, rel.To, rel.Rel.Reciprocal()))
+			}
+		}
+
+		// Stored partners of a replaced element must not keep relationships the new element drops.
+		stored, found, err := cache.get(elem.Pos)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			continue
+		}
+		for _, rel := range stored.Rels {
+			if _, posted := posted[rel.To.MapKey()]; posted || elem.hasRel(rel.Rel, rel.To) {
+				continue
+			}
+			partner, found, err := cache.get(rel.To)
+			if err != nil {
+				return nil, err
+			}
+			if found && partner.hasRel(rel.Rel.Reciprocal(), elem.Pos) {
+				violations = append(violations, fmt.Sprintf("element %s drops %s relationship to %s, which keeps its relationship to the element", elem.Pos, rel.Rel, rel.To))
+			}
+		}
+	}
+	return violations, nil
+}
+
+// validateMove returns the violations of moving an element, which cannot be moved onto
+// another element.
+func (d *Data) validateMove(ctx *datastore.VersionedCtx, from, to dvid.Point3d) ([]string, error) {
+	if from.Equals(to) {
+		return nil, nil
+	}
+	if _, found, err := d.newElementCache(ctx).get(to); err != nil {
+		return nil, err
+	} else if found {
+		return []string{fmt.Sprintf("move of element %s would replace element at %s", from, to)}, nil
+	}
+	return nil, nil
+}
+
+// validateDelete returns the violations of deleting an element, which are relationships
+// between the element and stored partners that are not reciprocated.  Since partners with
+// a relationship to the element that it doesn't reciprocate can't be found through the
+// element's own relationships, all elements are scanned, and the positions of such
+// referring partners are returned so their relationships can be removed with the element.
+func (d *Data) validateDelete(ctx *datastore.VersionedCtx, elem Element) (violations []string, referrers []dvid.Point3d, err error) {
+	cache := d.newElementCache(ctx)
+	for _, rel := range elem.Rels {
+		partner, found, err := cache.get(rel.To)
+		if err != nil {
+			return nil, nil, err
+		}
+		if found && !partner.hasRel(rel.Rel.Reciprocal(), elem.Pos) {
+			violations = append(violations, fmt.Sprintf("deleted element %s has %s relationship to %s that is not reciprocated", elem.Pos, rel.Rel, rel.To))
+		}
+	}
+
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = store.ProcessRange(ctx, storage.MinTKey(keyBlock), storage.MaxTKey(keyBlock), nil, func(chunk *storage.Chunk) error {
+		if len(chunk.V) == 0 {
+			return nil
+		}
+		var elems Elements
+		if err := json.Unmarshal(chunk.V, &elems); err != nil {
+			return err
+		}
+		for _, partner := range elems {
+			if partner.Pos.Equals(elem.Pos) {
+				continue
+			}
+			for _, rel := range partner.Rels {
+				if rel.To.Equals(elem.Pos) && !elem.hasRel(rel.Rel.Reciprocal(), partner.Pos) {
+					violations = append(violations, fmt.Sprintf("element %s has %s relationship to deleted element %s that is not reciprocated", partner.Pos, rel.Rel, elem.Pos))
+					referrers = append(referrers, partner.Pos)
+					break
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return violations, referrers, nil
+}
+
+// lockMutation serializes element mutations while validation is on, so a mutation is
+// validated against elements that can't change until it completes.  It returns the
+// function that releases the lock.
+func (d *Data) lockMutation() (unlock func()) {
+	if d.validationMode() == ValidationOff {
+		return func() {}
+	}
+	d.mutateMu.Lock()
+	return d.mutateMu.Unlock
+}
+
+// handleViolations returns an error for any violations in strict mode or logs them in warn mode.
+func (d *Data) handleViolations(op string, violations []string) error {
+	if len(violations) == 0 {
+		return nil
+	}
+	if d.validationMode() == ValidationStrict {
+		return fmt.Errorf("%s rejected by strict validation of annotation %q: %s", op, d.DataName(), strings.Join(violations, "; "))
+	}
+	for _, violation := range violations {
+		dvid.Warningf("%s on annotation %q: %s\n", op, d.DataName(), violation)
+	}
+	return nil
+}
+
+// SetValidation sets the validation mode used for mutations.
+func (d *Data) SetValidation(mode ValidationMode) {
+	d.Lock()
+	d.Validation = mode
+	d.Unlock()
+}
+
+// RelViolation describes a relationship that fails an integrity check.
+type RelViolation struct {
+	Pos dvid.Point3d
+	Rel RelationType
+	To  dvid.Point3d
+}
+
+// MisplacedElement is an element stored in a block that does not contain its position.
+type MisplacedElement struct {
+	Pos   dvid.Point3d
+	Block dvid.ChunkPoint3d
+}
+
+// IntegrityReport gives the results of an integrity scan of all elements.
+type IntegrityReport struct {
+	NumElements        int
+	OrphanedRels       []RelViolation // relationships with no element at the target
+	AsymmetricRels     []RelViolation // relationships not reciprocated by the target
+	DuplicatePositions []dvid.Point3d
+	MisplacedElements  []MisplacedElement
+}
+
+// GetIntegrityReport scans all elements for orphaned or asymmetric relationships, duplicate
+// positions, and elements stored outside their block.
+func (d *Data) GetIntegrityReport(ctx *datastore.VersionedCtx) (*IntegrityReport, error) {
+	timedLog := dvid.NewTimeLog()
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	report := &IntegrityReport{
+		OrphanedRels:       []RelViolation{},
+		AsymmetricRels:     []RelViolation{},
+		DuplicatePositions: []dvid.Point3d{},
+		MisplacedElements:  []MisplacedElement{},
+	}
+	blockSize := d.blockSize()
+	cache := d.newElementCache(ctx)
+	err = store.ProcessRange(ctx, storage.MinTKey(keyBlock), storage.MaxTKey(keyBlock), nil, func(chunk *storage.Chunk) error {
+		if len(chunk.V) == 0 {
+			return nil
+		}
+		bcoord, err := DecodeBlockTKey(chunk.K)
+		if err != nil {
+			return err
+		}
+		var elems Elements
+		if err := json.Unmarshal(chunk.V, &elems); err != nil {
+			return err
+		}
+		report.NumElements += len(elems)
+		positions := make(map[string]struct{}, len(elems))
+		for _, elem := range elems {
+			key := elem.Pos.MapKey()
+			if _, found := positions[key]; found {
+				report.DuplicatePositions = append(report.DuplicatePositions, elem.Pos)
+			}
+			positions[key] = struct{}{}
+			if !elem.Pos.Chunk(blockSize).(dvid.ChunkPoint3d).Equals(bcoord) {
+				report.MisplacedElements = append(report.MisplacedElements, MisplacedElement{elem.Pos, bcoord})
+			}
+			for _, rel := range elem.Rels {
+				target, found, err := cache.get(rel.To)
+				if err != nil {
+					return err
+				}
+				if !found {
+					report.OrphanedRels = append(report.OrphanedRels, RelViolation{elem.Pos, rel.Rel, rel.To})
+				} else if !target.hasRel(rel.Rel.Reciprocal(), elem.Pos) {
+					report.AsymmetricRels = append(report.AsymmetricRels, RelViolation{elem.Pos, rel.Rel, rel.To})
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	timedLog.Infof("Checked integrity of %d elements for annotation %q", report.NumElements, d.DataName())
+	return report, nil
+}
@@ -2424,7 +2424,114 @@ func (pb *PositionedBlock) WriteBinaryBlock(indices map[uint32]struct{}, hasBack
 // GoogleCompression writes label compression compliant with the Google Neuroglancer
 // specification:   https://goo.gl/IyQbzL
 func (b Block) WriteGoogleCompression(w io.Writer) error {
-	return fmt.Errorf("labels.Block -> Google Compression not implemented yet")
+	uint64array, size := b.MakeLabelVolume()
+	return WriteGoogleCompressedVolume(w, uint64array, size)
+}
+
+// WriteGoogleCompressedVolume writes a single-channel volume of little-endian uint64
+// labels in ZYX order using the Neuroglancer compressed_segmentation encoding with
+// SubBlockSize compression blocks.  The volume need not be a multiple of SubBlockSize.
+func WriteGoogleCompressedVolume(w io.Writer, uint64array []byte, size dvid.Point3d) error {
+	nx, ny, nz := int(size[0]), int(size[1]), int(size[2])
+	if nx <= 0 || ny <= 0 || nz <= 0 {
+		return fmt.Errorf("bad volume size for google compression: %s", size)
+	}
+	if len(uint64array) != nx*ny*nz*8 {
+		return fmt.Errorf("expected %d bytes for %s label volume, got %d bytes", nx*ny*nz*8, size, len(uint64array))
+	}
+	lbls, err := dvid.AliasByteToUint64(uint64array)
+	if err != nil {
+		return err
+	}
+	gx := (nx + SubBlockSize - 1) / SubBlockSize
+	gy := (ny + SubBlockSize - 1) / SubBlockSize
+	gz := (nz + SubBlockSize - 1) / SubBlockSize
+
+	// The channel data starts with a 2 word header per block followed by the encoded
+	// values and lookup table for each block.  Offsets are relative to channel start.
+	words := make([]uint32, 2*gx*gy*gz)
+	var blockNum int
+	for bz := 0; bz < gz; bz++ {
+		z0 := bz * SubBlockSize
+		for by := 0; by < gy; by++ {
+			y0 := by * SubBlockSize
+			for bx := 0; bx < gx; bx++ {
+				x0 := bx * SubBlockSize
+
+				// get the lookup table of labels in this block, ignoring out-of-bounds voxels.
+				var lut []uint64
+				table := make(map[uint64]uint32)
+				for z := z0; z < z0+SubBlockSize && z < nz; z++ {
+					for y := y0; y < y0+SubBlockSize && y < ny; y++ {
+						i := (z*ny+y)*nx + x0
+						for x := x0; x < x0+SubBlockSize && x < nx; x++ {
+							if _, found := table[lbls[i]]; !found {
+								table[lbls[i]] = uint32(len(lut))
+								lut = append(lut, lbls[i])
+							}
+							i++
+						}
+					}
+				}
+				bits := googleEncodedBits(len(lut))
+
+				valuesOffset := len(words)
+				if bits > 0 {
+					values := make([]uint32, (SubBlockSize*SubBlockSize*SubBlockSize*bits+31)/32)
+					var pos int
+					for z := z0; z < z0+SubBlockSize; z++ {
+						for y := y0; y < y0+SubBlockSize; y++ {
+							for x := x0; x < x0+SubBlockSize; x++ {
+								if x < nx && y < ny && z < nz {
+									index := table[lbls[(z*ny+y)*nx+x]]
+									values[pos>>5] |= index << uint(pos&31)
+								}
+								pos += bits
+							}
+						}
+					}
+					words = append(words, values...)
+				}
+				lutOffset := len(words)
+				if lutOffset >= 1<<24 {
+					return fmt.Errorf("google compression of %s volume exceeds maximum lookup table offset", size)
+				}
+				for _, label := range lut {
+					words = append(words, uint32(label), uint32(label>>32))
+				}
+				words[2*blockNum] = uint32(lutOffset) | uint32(bits)<<24
+				words[2*blockNum+1] = uint32(valuesOffset)
+				blockNum++
+			}
+		}
+	}
+
+	// single channel header gives offset of channel data in 32-bit words.
+	if err := binary.Write(w, binary.LittleEndian, uint32(1)); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, words)
+}
+
+// returns the # of bits used to encode the given number of labels in a block, which
+// must be 0 or a power of 2 no larger than 32.
+func googleEncodedBits(numLabels int) int {
+	switch {
+	case numLabels <= 1:
+		return 0
+	case numLabels <= 2:
+		return 1
+	case numLabels <= 4:
+		return 2
+	case numLabels <= 16:
+		return 4
+	case numLabels <= 256:
+		return 8
+	case numLabels <= 65536:
+		return 16
+	default:
+		return 32
+	}
 }
 
 // label array and portion of data that is being processed
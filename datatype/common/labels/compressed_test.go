@@ -1264,3 +1264,76 @@ func BenchmarkOldPointLabels(b *testing.B) {
 		}
 	}
 }
+
+// decodes a single-channel Neuroglancer compressed_segmentation volume.
+func decodeGoogleCompression(t *testing.T, data []byte, size dvid.Point3d) []uint64 {
+	if len(data)%4 != 0 {
+		t.Fatalf("google compression has %d bytes, not multiple of 4\n", len(data))
+	}
+	words := make([]uint32, len(data)/4)
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint32(data[i*4:])
+	}
+	if words[0] != 1 {
+		t.Fatalf("expected channel offset 1, got %d\n", words[0])
+	}
+	channel := words[1:]
+	nx, ny, nz := int(size[0]), int(size[1]), int(size[2])
+	gx, gy := (nx+7)/8, (ny+7)/8
+	out := make([]uint64, nx*ny*nz)
+	for z := 0; z < nz; z++ {
+		for y := 0; y < ny; y++ {
+			for x := 0; x < nx; x++ {
+				blockNum := ((z/8)*gy+y/8)*gx + x/8
+				lutOffset := channel[2*blockNum] & 0xFFFFFF
+				bits := channel[2*blockNum] >> 24
+				valuesOffset := channel[2*blockNum+1]
+				var index uint32
+				if bits > 0 {
+					pos := uint32(((z%8)*8+y%8)*8+x%8) * bits
+					index = (channel[valuesOffset+pos/32] >> (pos % 32)) & (1<<bits - 1)
+				}
+				lo, hi := channel[lutOffset+2*index], channel[lutOffset+2*index+1]
+				out[(z*ny+y)*nx+x] = uint64(hi)<<32 | uint64(lo)
+			}
+		}
+	}
+	return out
+}
+
+func TestGoogleCompression(t *testing.T) {
+	// non-multiple of 8 volume with increasing # of labels per compression block.
+	size := dvid.Point3d{21, 13, 10}
+	lbls := make([]uint64, size.Prod())
+	for i := range lbls {
+		lbls[i] = uint64(rand.Intn(1+i/50)) + 1<<40
+	}
+	var buf bytes.Buffer
+	if err := WriteGoogleCompressedVolume(&buf, dvid.AliasUint64ToByte(lbls), size); err != nil {
+		t.Fatal(err)
+	}
+	decoded := decodeGoogleCompression(t, buf.Bytes(), size)
+	for i, label := range lbls {
+		if decoded[i] != label {
+			t.Fatalf("bad decoded label at voxel %d: expected %d, got %d\n", i, label, decoded[i])
+		}
+	}
+
+	for _, filename := range testFiles {
+		td := loadTestData(t, filename)
+		block, err := MakeBlock(td.b, dvid.Point3d{64, 64, 64})
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Reset()
+		if err := block.WriteGoogleCompression(&buf); err != nil {
+			t.Fatal(err)
+		}
+		decoded = decodeGoogleCompression(t, buf.Bytes(), dvid.Point3d{64, 64, 64})
+		for i, label := range td.u {
+			if decoded[i] != label {
+				t.Fatalf("bad decoded label at voxel %d of %s: expected %d, got %d\n", i, td, label, decoded[i])
+			}
+		}
+	}
+}
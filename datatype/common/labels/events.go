@@ -168,6 +168,14 @@ type DeltaSplitEnd struct {
 	NewLabel uint64
 }
 
+// DeltaBatch describes an ordered set of mutations that were applied together as a batch.
+// Each element of Deltas is a DeltaMerge, CleaveOp, or SplitSupervoxelOp.  It is sent
+// during a BatchEvent.
+type DeltaBatch struct {
+	MutID  uint64 // the first mutation ID of the batch
+	Deltas []interface{}
+}
+
 // DeltaSparsevol describes a change to an existing label.
 type DeltaSparsevol struct {
 	Label uint64
@@ -195,4 +203,5 @@ const (
 	SupervoxelSplitStartEvent = "SV_SPLIT_START"
 	SupervoxelSplitEvent      = "SV_SPLIT"
 	SupervoxelSplitEndEvent   = "SV_SPLIT_END"
+	BatchEvent                = "LABEL_BATCH"
 )
@@ -22,6 +22,8 @@
 		SVCount
 		LabelIndex
 		LabelIndices
+		BatchOp
+		BatchOps
 */
 package proto
 
@@ -460,6 +462,60 @@ func (m *LabelIndices) GetIndices() []*LabelIndex {
 	return nil
 }
 
+type BatchOp struct {
+	Merge   *MergeOp           `protobuf:"bytes,1,opt,name=merge" json:"merge,omitempty"`
+	Cleave  *CleaveOp          `protobuf:"bytes,2,opt,name=cleave" json:"cleave,omitempty"`
+	Svsplit *SupervoxelSplitOp `protobuf:"bytes,3,opt,name=svsplit" json:"svsplit,omitempty"`
+	Rles    []byte             `protobuf:"bytes,4,opt,name=rles,proto3" json:"rles,omitempty"`
+}
+
+func (m *BatchOp) Reset()                    { *m = BatchOp{} }
+func (*BatchOp) ProtoMessage()               {}
+func (*BatchOp) Descriptor() ([]byte, []int) { return fileDescriptorLabelops, []int{14} }
+
+func (m *BatchOp) GetMerge() *MergeOp {
+	if m != nil {
+		return m.Merge
+	}
+	return nil
+}
+
+func (m *BatchOp) GetCleave() *CleaveOp {
+	if m != nil {
+		return m.Cleave
+	}
+	return nil
+}
+
+func (m *BatchOp) GetSvsplit() *SupervoxelSplitOp {
+	if m != nil {
+		return m.Svsplit
+	}
+	return nil
+}
+
+func (m *BatchOp) GetRles() []byte {
+	if m != nil {
+		return m.Rles
+	}
+	return nil
+}
+
+type BatchOps struct {
+	Ops []*BatchOp `protobuf:"bytes,1,rep,name=ops" json:"ops,omitempty"`
+}
+
+func (m *BatchOps) Reset()                    { *m = BatchOps{} }
+func (*BatchOps) ProtoMessage()               {}
+func (*BatchOps) Descriptor() ([]byte, []int) { return fileDescriptorLabelops, []int{15} }
+
+func (m *BatchOps) GetOps() []*BatchOp {
+	if m != nil {
+		return m.Ops
+	}
+	return nil
+}
+
 func init() {
 	proto1.RegisterType((*MergeOp)(nil), "proto.MergeOp")
 	proto1.RegisterType((*CleaveOp)(nil), "proto.CleaveOp")
@@ -475,6 +531,8 @@ func init() {
 	proto1.RegisterType((*SVCount)(nil), "proto.SVCount")
 	proto1.RegisterType((*LabelIndex)(nil), "proto.LabelIndex")
 	proto1.RegisterType((*LabelIndices)(nil), "proto.LabelIndices")
+	proto1.RegisterType((*BatchOp)(nil), "proto.BatchOp")
+	proto1.RegisterType((*BatchOps)(nil), "proto.BatchOps")
 }
 func (this *MergeOp) Equal(that interface{}) bool {
 	if that == nil {
@@ -942,6 +1000,68 @@ func (this *LabelIndices) Equal(that interface{}) bool {
 	}
 	return true
 }
+func (this *BatchOp) Equal(that interface{}) bool {
+	if that == nil {
+		return this == nil
+	}
+
+	that1, ok := that.(*BatchOp)
+	if !ok {
+		that2, ok := that.(BatchOp)
+		if ok {
+			that1 = &that2
+		} else {
+			return false
+		}
+	}
+	if that1 == nil {
+		return this == nil
+	} else if this == nil {
+		return false
+	}
+	if !this.Merge.Equal(that1.Merge) {
+		return false
+	}
+	if !this.Cleave.Equal(that1.Cleave) {
+		return false
+	}
+	if !this.Svsplit.Equal(that1.Svsplit) {
+		return false
+	}
+	if !bytes.Equal(this.Rles, that1.Rles) {
+		return false
+	}
+	return true
+}
+func (this *BatchOps) Equal(that interface{}) bool {
+	if that == nil {
+		return this == nil
+	}
+
+	that1, ok := that.(*BatchOps)
+	if !ok {
+		that2, ok := that.(BatchOps)
+		if ok {
+			that1 = &that2
+		} else {
+			return false
+		}
+	}
+	if that1 == nil {
+		return this == nil
+	} else if this == nil {
+		return false
+	}
+	if len(this.Ops) != len(that1.Ops) {
+		return false
+	}
+	for i := range this.Ops {
+		if !this.Ops[i].Equal(that1.Ops[i]) {
+			return false
+		}
+	}
+	return true
+}
 func (this *MergeOp) GoString() string {
 	if this == nil {
 		return "nil"
@@ -1159,6 +1279,37 @@ func (this *LabelIndices) GoString() string {
 	s = append(s, "}")
 	return strings.Join(s, "")
 }
+func (this *BatchOp) GoString() string {
+	if this == nil {
+		return "nil"
+	}
+	s := make([]string, 0, 8)
+	s = append(s, "&proto.BatchOp{")
+	if this.Merge != nil {
+		s = append(s, "Merge: "+fmt.Sprintf("%#v", this.Merge)+",\n")
+	}
+	if this.Cleave != nil {
+		s = append(s, "Cleave: "+fmt.Sprintf("%#v", this.Cleave)+",\n")
+	}
+	if this.Svsplit != nil {
+		s = append(s, "Svsplit: "+fmt.Sprintf("%#v", this.Svsplit)+",\n")
+	}
+	s = append(s, "Rles: "+fmt.Sprintf("%#v", this.Rles)+",\n")
+	s = append(s, "}")
+	return strings.Join(s, "")
+}
+func (this *BatchOps) GoString() string {
+	if this == nil {
+		return "nil"
+	}
+	s := make([]string, 0, 5)
+	s = append(s, "&proto.BatchOps{")
+	if this.Ops != nil {
+		s = append(s, "Ops: "+fmt.Sprintf("%#v", this.Ops)+",\n")
+	}
+	s = append(s, "}")
+	return strings.Join(s, "")
+}
 func valueToGoStringLabelops(v interface{}, typ string) string {
 	rv := reflect.ValueOf(v)
 	if rv.IsNil() {
@@ -1768,6 +1919,90 @@ func (m *LabelIndices) MarshalTo(dAtA []byte) (int, error) {
 	return i, nil
 }
 
+func (m *BatchOp) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *BatchOp) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if m.Merge != nil {
+		dAtA[i] = 0xa
+		i++
+		i = encodeVarintLabelops(dAtA, i, uint64(m.Merge.Size()))
+		n13, err := m.Merge.MarshalTo(dAtA[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n13
+	}
+	if m.Cleave != nil {
+		dAtA[i] = 0x12
+		i++
+		i = encodeVarintLabelops(dAtA, i, uint64(m.Cleave.Size()))
+		n14, err := m.Cleave.MarshalTo(dAtA[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n14
+	}
+	if m.Svsplit != nil {
+		dAtA[i] = 0x1a
+		i++
+		i = encodeVarintLabelops(dAtA, i, uint64(m.Svsplit.Size()))
+		n15, err := m.Svsplit.MarshalTo(dAtA[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n15
+	}
+	if len(m.Rles) > 0 {
+		dAtA[i] = 0x22
+		i++
+		i = encodeVarintLabelops(dAtA, i, uint64(len(m.Rles)))
+		i += copy(dAtA[i:], m.Rles)
+	}
+	return i, nil
+}
+
+func (m *BatchOps) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *BatchOps) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.Ops) > 0 {
+		for _, msg := range m.Ops {
+			dAtA[i] = 0xa
+			i++
+			i = encodeVarintLabelops(dAtA, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(dAtA[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
+	return i, nil
+}
+
 func encodeVarintLabelops(dAtA []byte, offset int, v uint64) int {
 	for v >= 1<<7 {
 		dAtA[offset] = uint8(v&0x7f | 0x80)
@@ -2040,6 +2275,40 @@ func (m *LabelIndices) Size() (n int) {
 	return n
 }
 
+func (m *BatchOp) Size() (n int) {
+	var l int
+	_ = l
+	if m.Merge != nil {
+		l = m.Merge.Size()
+		n += 1 + l + sovLabelops(uint64(l))
+	}
+	if m.Cleave != nil {
+		l = m.Cleave.Size()
+		n += 1 + l + sovLabelops(uint64(l))
+	}
+	if m.Svsplit != nil {
+		l = m.Svsplit.Size()
+		n += 1 + l + sovLabelops(uint64(l))
+	}
+	l = len(m.Rles)
+	if l > 0 {
+		n += 1 + l + sovLabelops(uint64(l))
+	}
+	return n
+}
+
+func (m *BatchOps) Size() (n int) {
+	var l int
+	_ = l
+	if len(m.Ops) > 0 {
+		for _, e := range m.Ops {
+			l = e.Size()
+			n += 1 + l + sovLabelops(uint64(l))
+		}
+	}
+	return n
+}
+
 func sovLabelops(x uint64) (n int) {
 	for {
 		n++
@@ -2258,6 +2527,29 @@ func (this *LabelIndices) String() string {
 	}, "")
 	return s
 }
+func (this *BatchOp) String() string {
+	if this == nil {
+		return "nil"
+	}
+	s := strings.Join([]string{`&BatchOp{`,
+		`Merge:` + strings.Replace(fmt.Sprintf("%v", this.Merge), "MergeOp", "MergeOp", 1) + `,`,
+		`Cleave:` + strings.Replace(fmt.Sprintf("%v", this.Cleave), "CleaveOp", "CleaveOp", 1) + `,`,
+		`Svsplit:` + strings.Replace(fmt.Sprintf("%v", this.Svsplit), "SupervoxelSplitOp", "SupervoxelSplitOp", 1) + `,`,
+		`Rles:` + fmt.Sprintf("%v", this.Rles) + `,`,
+		`}`,
+	}, "")
+	return s
+}
+func (this *BatchOps) String() string {
+	if this == nil {
+		return "nil"
+	}
+	s := strings.Join([]string{`&BatchOps{`,
+		`Ops:` + strings.Replace(fmt.Sprintf("%v", this.Ops), "BatchOp", "BatchOp", 1) + `,`,
+		`}`,
+	}, "")
+	return s
+}
 func valueToStringLabelops(v interface{}) string {
 	rv := reflect.ValueOf(v)
 	if rv.IsNil() {
@@ -4331,6 +4623,267 @@ func (m *LabelIndices) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
+func (m *BatchOp) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowLabelops
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: BatchOp: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: BatchOp: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Merge", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowLabelops
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthLabelops
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Merge == nil {
+				m.Merge = &MergeOp{}
+			}
+			if err := m.Merge.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Cleave", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowLabelops
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthLabelops
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Cleave == nil {
+				m.Cleave = &CleaveOp{}
+			}
+			if err := m.Cleave.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Svsplit", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowLabelops
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthLabelops
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Svsplit == nil {
+				m.Svsplit = &SupervoxelSplitOp{}
+			}
+			if err := m.Svsplit.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Rles", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowLabelops
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthLabelops
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Rles = append(m.Rles[:0], dAtA[iNdEx:postIndex]...)
+			if m.Rles == nil {
+				m.Rles = []byte{}
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipLabelops(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthLabelops
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *BatchOps) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowLabelops
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: BatchOps: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: BatchOps: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Ops", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowLabelops
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthLabelops
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Ops = append(m.Ops, &BatchOp{})
+			if err := m.Ops[len(m.Ops)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipLabelops(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthLabelops
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
 func skipLabelops(dAtA []byte) (n int, err error) {
 	l := len(dAtA)
 	iNdEx := 0
@@ -4439,53 +4992,58 @@ var (
 func init() { proto1.RegisterFile("labelops.proto", fileDescriptorLabelops) }
 
 var fileDescriptorLabelops = []byte{
-	// 759 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x54, 0x4d, 0x4f, 0xdb, 0x4a,
-	0x14, 0x8d, 0xf3, 0x9d, 0x9b, 0x04, 0xc1, 0x08, 0x3d, 0x59, 0xd1, 0x7b, 0x7e, 0x96, 0x55, 0xa9,
-	0x91, 0x8a, 0x22, 0x35, 0x15, 0x12, 0xd0, 0x15, 0xd0, 0x2e, 0x10, 0x8d, 0xa8, 0x0c, 0x74, 0x8b,
-	0x9c, 0x78, 0x88, 0x46, 0xf8, 0x63, 0xe4, 0x19, 0xa7, 0xb0, 0xeb, 0xaa, 0x9b, 0x6e, 0x2a, 0xf5,
-	0x4f, 0x74, 0xd5, 0xdf, 0xd1, 0x25, 0xcb, 0x2e, 0x4b, 0xba, 0xe9, 0x92, 0x9f, 0x50, 0xcd, 0x87,
-	0x8d, 0x53, 0x28, 0x15, 0x1b, 0x67, 0xce, 0xbd, 0xe7, 0xde, 0x7b, 0x7c, 0x7c, 0x27, 0xb0, 0x14,
-	0x78, 0x63, 0x1c, 0xc4, 0x94, 0x0d, 0x68, 0x12, 0xf3, 0x18, 0xd5, 0xe4, 0x8f, 0x73, 0x00, 0x8d,
-	0x11, 0x4e, 0xa6, 0xf8, 0x80, 0xa2, 0x55, 0xa8, 0x85, 0x29, 0x27, 0xbe, 0x69, 0xd8, 0x46, 0xbf,
-	0xea, 0x2a, 0x80, 0xfe, 0x81, 0x3a, 0xf7, 0x92, 0x29, 0xe6, 0x66, 0x59, 0x86, 0x35, 0x12, 0xf1,
-	0x50, 0x14, 0xfa, 0x66, 0xc5, 0xae, 0x88, 0xb8, 0x42, 0xce, 0x0c, 0x9a, 0xbb, 0x01, 0xf6, 0x66,
-	0x0f, 0xef, 0xe8, 0x40, 0x67, 0x22, 0x2b, 0x7d, 0x29, 0xd5, 0xac, 0xc8, 0xec, 0x42, 0x0c, 0x99,
-	0xd0, 0xd0, 0xd8, 0xac, 0xca, 0xb1, 0x19, 0x74, 0x8e, 0xa1, 0x35, 0xf2, 0x28, 0x25, 0xd1, 0xf4,
-	0xbe, 0xc1, 0xa1, 0x47, 0x29, 0xf6, 0xb3, 0xc1, 0x0a, 0xa1, 0x1e, 0x34, 0xe3, 0x84, 0x4c, 0x49,
-	0xe4, 0x05, 0xfa, 0x65, 0x72, 0xec, 0x6c, 0x01, 0xe4, 0x6d, 0x19, 0x5a, 0x83, 0x66, 0xa8, 0x10,
-	0x33, 0x0d, 0xbb, 0xd2, 0x6f, 0x0f, 0x97, 0x95, 0x9d, 0x83, 0x9c, 0xe4, 0xe6, 0x0c, 0xe7, 0x7d,
-	0x19, 0x1a, 0x87, 0x34, 0x20, 0xfc, 0xc1, 0x56, 0xf4, 0xa0, 0x19, 0xe1, 0xb7, 0x45, 0x1b, 0x72,
-	0x2c, 0x6a, 0x26, 0xb1, 0x97, 0x30, 0x6c, 0x56, 0x6d, 0xa3, 0xdf, 0x74, 0x35, 0x42, 0x08, 0xaa,
-	0x49, 0x80, 0x99, 0x59, 0xb3, 0x8d, 0x7e, 0xc7, 0x95, 0x67, 0xb4, 0x01, 0x4d, 0x36, 0x63, 0x42,
-	0x02, 0x33, 0xeb, 0x52, 0xef, 0xbf, 0x5a, 0xaf, 0xd6, 0x35, 0x38, 0xd4, 0xe9, 0x97, 0x11, 0x4f,
-	0x2e, 0xdc, 0x9c, 0xdd, 0xdb, 0x87, 0xee, 0x42, 0x0a, 0x2d, 0x43, 0xe5, 0x0c, 0x5f, 0x68, 0xf9,
-	0xe2, 0x88, 0x1e, 0x41, 0x6d, 0xe6, 0x05, 0x29, 0x96, 0xda, 0xdb, 0xc3, 0xa5, 0xac, 0xf3, 0x1b,
-	0xd9, 0xdb, 0x55, 0xc9, 0xad, 0xf2, 0x86, 0xe1, 0xec, 0x43, 0x43, 0x47, 0x91, 0x05, 0x20, 0xbb,
-	0xaa, 0x77, 0x53, 0xdd, 0x0a, 0x11, 0x64, 0x43, 0x3b, 0xc1, 0xa1, 0x47, 0x22, 0x45, 0x50, 0xb6,
-	0x14, 0x43, 0xce, 0x07, 0x03, 0x56, 0x0e, 0x53, 0x8a, 0x93, 0x59, 0x7c, 0x8e, 0x83, 0xfb, 0xfd,
-	0x15, 0xd3, 0x72, 0xaa, 0x6e, 0x56, 0x88, 0xfc, 0xa6, 0xa6, 0xf2, 0x37, 0x35, 0xd5, 0xdb, 0x6a,
-	0x36, 0xa1, 0x7d, 0x40, 0x77, 0xe3, 0x90, 0x06, 0x98, 0x63, 0xff, 0x0f, 0x32, 0x56, 0xa1, 0xc6,
-	0xb8, 0x37, 0x55, 0x4e, 0xb5, 0x5c, 0x05, 0x9c, 0xd7, 0xd0, 0xdc, 0x3e, 0x3d, 0x25, 0x11, 0xe1,
-	0x17, 0xe2, 0xa3, 0xca, 0x7e, 0x4f, 0x75, 0xa1, 0x46, 0x79, 0x7c, 0x98, 0x2d, 0x88, 0x42, 0xa2,
-	0xa3, 0xf2, 0x5e, 0x68, 0x2e, 0x6b, 0xaf, 0x9d, 0x17, 0x00, 0xba, 0x23, 0xc1, 0x2c, 0xaf, 0x55,
-	0xab, 0x9a, 0xd5, 0x32, 0xf1, 0xd2, 0x5e, 0xce, 0x32, 0xcb, 0x76, 0xa5, 0x5f, 0x76, 0x0b, 0x11,
-	0xe7, 0x93, 0x01, 0xdd, 0x4c, 0xd8, 0x91, 0x37, 0x0e, 0x30, 0x5a, 0x87, 0x1a, 0x17, 0x07, 0xbd,
-	0xf3, 0xff, 0xeb, 0x2f, 0xbd, 0x40, 0x1a, 0xc8, 0xa7, 0x5a, 0x23, 0xc5, 0xee, 0xed, 0x03, 0xdc,
-	0x04, 0xef, 0x58, 0xa0, 0xc7, 0x8b, 0x0b, 0xb4, 0xb2, 0xd8, 0x96, 0x60, 0x56, 0xdc, 0xa1, 0x73,
-	0xb1, 0x43, 0xbb, 0x71, 0x1a, 0x71, 0x34, 0x14, 0x37, 0x20, 0x8d, 0x78, 0x76, 0x07, 0x7b, 0xf9,
-	0xe6, 0xc9, 0xfc, 0x40, 0x3e, 0xf5, 0x46, 0x6b, 0x66, 0x6f, 0x13, 0xda, 0x85, 0xf0, 0x1d, 0x62,
-	0x56, 0x8b, 0x62, 0xba, 0xc5, 0xc9, 0x5f, 0xca, 0x00, 0xaf, 0x84, 0x75, 0x7b, 0x91, 0x8f, 0xcf,
-	0xd1, 0x3a, 0xd4, 0xc7, 0x41, 0x3c, 0x39, 0xcb, 0xa6, 0xff, 0xa7, 0xa7, 0xdf, 0x50, 0x06, 0x3b,
-	0x32, 0xaf, 0x05, 0x28, 0xb2, 0xe8, 0x5f, 0x5c, 0x69, 0x05, 0x90, 0x05, 0xed, 0xc0, 0x63, 0xfc,
-	0x24, 0x4c, 0xf9, 0x09, 0xf1, 0xf5, 0x06, 0xb6, 0x44, 0x68, 0x94, 0xf2, 0x3d, 0x1f, 0x39, 0xd0,
-	0x55, 0xf9, 0xd8, 0x3f, 0xe1, 0x24, 0x54, 0x77, 0xbe, 0xe5, 0xca, 0xa2, 0x51, 0xec, 0x1f, 0x91,
-	0x10, 0x2f, 0x70, 0x52, 0x86, 0x13, 0xf9, 0x0f, 0x70, 0xc3, 0x39, 0x66, 0x38, 0x41, 0x36, 0x74,
-	0x72, 0x8e, 0x47, 0xa9, 0x59, 0x97, 0x14, 0xd0, 0x94, 0x6d, 0x4a, 0x7b, 0x7b, 0xd0, 0x2e, 0xc8,
-	0x7e, 0xc8, 0x75, 0x97, 0xbe, 0x16, 0x0d, 0x7b, 0x0e, 0x9d, 0xcc, 0x0c, 0x32, 0xc1, 0x0c, 0x3d,
-	0x81, 0x06, 0x51, 0x47, 0x6d, 0xd9, 0xca, 0x2d, 0xcb, 0xdc, 0x8c, 0xb1, 0xb3, 0x76, 0x79, 0x65,
-	0x95, 0xbe, 0x5d, 0x59, 0xa5, 0xeb, 0x2b, 0xcb, 0x78, 0x37, 0xb7, 0x8c, 0xcf, 0x73, 0xcb, 0xf8,
-	0x3a, 0xb7, 0x8c, 0xcb, 0xb9, 0x65, 0x7c, 0x9f, 0x5b, 0xc6, 0xcf, 0xb9, 0x55, 0xba, 0x9e, 0x5b,
-	0xc6, 0xc7, 0x1f, 0x56, 0x69, 0x5c, 0x97, 0x8d, 0x9e, 0xfd, 0x0a, 0x00, 0x00, 0xff, 0xff, 0xc5,
-	0x62, 0xdc, 0x21, 0xde, 0x06, 0x00, 0x00,
+	// 839 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x55, 0x4f, 0x6f, 0xe3, 0x44,
+	0x14, 0xcf, 0xc4, 0xf9, 0xe3, 0x3c, 0x27, 0xcb, 0x76, 0x54, 0x21, 0x2b, 0x02, 0x63, 0x59, 0x48,
+	0x1b, 0x89, 0x2a, 0x12, 0x41, 0x2b, 0xed, 0x2e, 0xa7, 0x6d, 0xe1, 0x50, 0x95, 0x28, 0xc8, 0xdd,
+	0x72, 0xad, 0x9c, 0x78, 0x1a, 0xac, 0xfa, 0xcf, 0xc8, 0x33, 0x0e, 0xed, 0x8d, 0x13, 0x17, 0x2e,
+	0x48, 0x7c, 0x01, 0x8e, 0x9c, 0xf8, 0x1c, 0x1c, 0x7b, 0xe4, 0x48, 0xc3, 0x85, 0x63, 0x3f, 0x02,
+	0x9a, 0x3f, 0x76, 0xed, 0xb6, 0x74, 0xd5, 0x4b, 0x32, 0xef, 0xbd, 0xdf, 0x7b, 0xef, 0x37, 0x3f,
+	0xbf, 0x99, 0x81, 0x67, 0x71, 0xb0, 0x24, 0x71, 0x46, 0xd9, 0x94, 0xe6, 0x19, 0xcf, 0x70, 0x57,
+	0xfe, 0x79, 0x0b, 0xe8, 0xcf, 0x49, 0xbe, 0x26, 0x0b, 0x8a, 0x77, 0xa1, 0x9b, 0x14, 0x3c, 0x0a,
+	0x6d, 0xe4, 0xa2, 0x49, 0xc7, 0x57, 0x06, 0xfe, 0x10, 0x7a, 0x3c, 0xc8, 0xd7, 0x84, 0xdb, 0x6d,
+	0xe9, 0xd6, 0x96, 0xf0, 0x27, 0x22, 0x31, 0xb4, 0x0d, 0xd7, 0x10, 0x7e, 0x65, 0x79, 0x1b, 0x30,
+	0x0f, 0x62, 0x12, 0x6c, 0x9e, 0x5e, 0xd1, 0x83, 0xe1, 0x4a, 0x66, 0x86, 0x92, 0xaa, 0x6d, 0xc8,
+	0x68, 0xc3, 0x87, 0x6d, 0xe8, 0x6b, 0xdb, 0xee, 0xc8, 0xb6, 0xa5, 0xe9, 0x9d, 0xc0, 0x60, 0x1e,
+	0x50, 0x1a, 0xa5, 0xeb, 0xc7, 0x1a, 0x27, 0x01, 0xa5, 0x24, 0x2c, 0x1b, 0x2b, 0x0b, 0x8f, 0xc1,
+	0xcc, 0xf2, 0x68, 0x1d, 0xa5, 0x41, 0xac, 0x37, 0x53, 0xd9, 0xde, 0x1b, 0x80, 0xaa, 0x2c, 0xc3,
+	0x7b, 0x60, 0x26, 0xca, 0x62, 0x36, 0x72, 0x8d, 0x89, 0x35, 0x7b, 0xae, 0xe4, 0x9c, 0x56, 0x20,
+	0xbf, 0x42, 0x78, 0x3f, 0xb5, 0xa1, 0x7f, 0x4c, 0xe3, 0x88, 0x3f, 0x59, 0x8a, 0x31, 0x98, 0x29,
+	0xf9, 0xa1, 0x2e, 0x43, 0x65, 0x8b, 0x9c, 0x55, 0x16, 0xe4, 0x8c, 0xd8, 0x1d, 0x17, 0x4d, 0x4c,
+	0x5f, 0x5b, 0x18, 0x43, 0x27, 0x8f, 0x09, 0xb3, 0xbb, 0x2e, 0x9a, 0x0c, 0x7d, 0xb9, 0xc6, 0xaf,
+	0xc0, 0x64, 0x1b, 0x26, 0x28, 0x30, 0xbb, 0x27, 0xf9, 0x7e, 0xa4, 0xf9, 0x6a, 0x5e, 0xd3, 0x63,
+	0x1d, 0xfe, 0x3a, 0xe5, 0xf9, 0xa5, 0x5f, 0xa1, 0xc7, 0x47, 0x30, 0x6a, 0x84, 0xf0, 0x73, 0x30,
+	0xce, 0xc9, 0xa5, 0xa6, 0x2f, 0x96, 0xf8, 0x53, 0xe8, 0x6e, 0x82, 0xb8, 0x20, 0x92, 0xbb, 0x35,
+	0x7b, 0x56, 0x56, 0xfe, 0x4e, 0xd6, 0xf6, 0x55, 0xf0, 0x4d, 0xfb, 0x15, 0xf2, 0x8e, 0xa0, 0xaf,
+	0xbd, 0xd8, 0x01, 0x90, 0x55, 0xd5, 0xde, 0x54, 0xb5, 0x9a, 0x07, 0xbb, 0x60, 0xe5, 0x24, 0x09,
+	0xa2, 0x54, 0x01, 0x94, 0x2c, 0x75, 0x97, 0xf7, 0x33, 0x82, 0x9d, 0xe3, 0x82, 0x92, 0x7c, 0x93,
+	0x5d, 0x90, 0xf8, 0x71, 0x7d, 0x45, 0xb7, 0x0a, 0xaa, 0x8b, 0xd5, 0x3c, 0x77, 0xd8, 0x18, 0xef,
+	0x63, 0xd3, 0xb9, 0xcf, 0xe6, 0x35, 0x58, 0x0b, 0x7a, 0x90, 0x25, 0x34, 0x26, 0x9c, 0x84, 0xff,
+	0x43, 0x63, 0x17, 0xba, 0x8c, 0x07, 0x6b, 0xa5, 0xd4, 0xc0, 0x57, 0x86, 0xf7, 0x2d, 0x98, 0x6f,
+	0xcf, 0xce, 0xa2, 0x34, 0xe2, 0x97, 0xe2, 0xa3, 0xca, 0x7a, 0x9f, 0xeb, 0x44, 0x6d, 0x55, 0xfe,
+	0x59, 0x39, 0x20, 0xca, 0x12, 0x15, 0x95, 0xf6, 0x82, 0x73, 0x5b, 0x6b, 0xed, 0x7d, 0x05, 0xa0,
+	0x2b, 0x46, 0x84, 0x55, 0xb9, 0x6a, 0x54, 0xcb, 0x5c, 0x26, 0x36, 0x1d, 0x54, 0x28, 0xbb, 0xed,
+	0x1a, 0x93, 0xb6, 0x5f, 0xf3, 0x78, 0xbf, 0x22, 0x18, 0x95, 0xc4, 0xde, 0x05, 0xcb, 0x98, 0xe0,
+	0x97, 0xd0, 0xe5, 0x62, 0xa1, 0x67, 0xfe, 0x13, 0xfd, 0xa5, 0x1b, 0xa0, 0xa9, 0xfc, 0x55, 0x63,
+	0xa4, 0xd0, 0xe3, 0x23, 0x80, 0x5b, 0xe7, 0x03, 0x03, 0xf4, 0xa2, 0x39, 0x40, 0x3b, 0xcd, 0xb2,
+	0x11, 0x61, 0xf5, 0x19, 0xba, 0x10, 0x33, 0x74, 0x90, 0x15, 0x29, 0xc7, 0x33, 0x71, 0x02, 0x8a,
+	0x94, 0x97, 0x67, 0x70, 0x5c, 0x4d, 0x9e, 0x8c, 0x4f, 0xe5, 0xaf, 0x9e, 0x68, 0x8d, 0x1c, 0xbf,
+	0x06, 0xab, 0xe6, 0x7e, 0x80, 0xcc, 0x6e, 0x9d, 0xcc, 0xa8, 0xde, 0xf9, 0x8f, 0x36, 0xc0, 0x37,
+	0x42, 0xba, 0xc3, 0x34, 0x24, 0x17, 0xf8, 0x25, 0xf4, 0x96, 0x71, 0xb6, 0x3a, 0x2f, 0xbb, 0x7f,
+	0xac, 0xbb, 0xdf, 0x42, 0xa6, 0xfb, 0x32, 0xae, 0x09, 0x28, 0xb0, 0xa8, 0x5f, 0x1f, 0x69, 0x65,
+	0x60, 0x07, 0xac, 0x38, 0x60, 0xfc, 0x34, 0x29, 0xf8, 0x69, 0x14, 0xea, 0x09, 0x1c, 0x08, 0xd7,
+	0xbc, 0xe0, 0x87, 0x21, 0xf6, 0x60, 0xa4, 0xe2, 0x59, 0x78, 0xca, 0xa3, 0x44, 0x9d, 0xf9, 0x81,
+	0x2f, 0x93, 0xe6, 0x59, 0xf8, 0x2e, 0x4a, 0x48, 0x03, 0x53, 0x30, 0x92, 0xdb, 0xdd, 0x06, 0xe6,
+	0x84, 0x91, 0x1c, 0xbb, 0x30, 0xac, 0x30, 0x01, 0xa5, 0x76, 0x4f, 0x42, 0x40, 0x43, 0xde, 0x52,
+	0x3a, 0x3e, 0x04, 0xab, 0x46, 0xfb, 0x29, 0xc7, 0x5d, 0xea, 0x5a, 0x17, 0xec, 0x4b, 0x18, 0x96,
+	0x62, 0x44, 0x2b, 0xc2, 0xf0, 0x67, 0xd0, 0x8f, 0xd4, 0x52, 0x4b, 0xb6, 0x73, 0x4f, 0x32, 0xbf,
+	0x44, 0x78, 0xbf, 0x21, 0xe8, 0xef, 0x07, 0x7c, 0xf5, 0xfd, 0x82, 0x8a, 0x96, 0xf2, 0x55, 0xb1,
+	0x51, 0xa3, 0xa5, 0x7e, 0xb0, 0x7c, 0x15, 0xc4, 0x2f, 0xa0, 0xa7, 0x1e, 0x01, 0xcd, 0xec, 0x03,
+	0x0d, 0x2b, 0x9f, 0x21, 0x5f, 0x87, 0xf1, 0x0c, 0xfa, 0xfa, 0x7e, 0x93, 0x42, 0x5b, 0x33, 0xbb,
+	0xdc, 0xc3, 0xdd, 0xeb, 0xc4, 0x2f, 0x81, 0xd5, 0xad, 0xda, 0xb9, 0xbd, 0x55, 0xbd, 0x3d, 0x30,
+	0x35, 0x43, 0x86, 0x5d, 0x30, 0x32, 0x5a, 0xee, 0xab, 0x24, 0xa8, 0xa3, 0xbe, 0x08, 0xed, 0xef,
+	0x5d, 0x5d, 0x3b, 0xad, 0xbf, 0xae, 0x9d, 0xd6, 0xcd, 0xb5, 0x83, 0x7e, 0xdc, 0x3a, 0xe8, 0xf7,
+	0xad, 0x83, 0xfe, 0xdc, 0x3a, 0xe8, 0x6a, 0xeb, 0xa0, 0xbf, 0xb7, 0x0e, 0xfa, 0x77, 0xeb, 0xb4,
+	0x6e, 0xb6, 0x0e, 0xfa, 0xe5, 0x1f, 0xa7, 0xb5, 0xec, 0xc9, 0x0a, 0x5f, 0xfc, 0x37, 0x00, 0x83,
+	0x86, 0x3d, 0xa8, 0xaf, 0x07, 0x00, 0x00,
 }
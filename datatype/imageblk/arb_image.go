@@ -85,7 +85,27 @@ func (s ArbSlice) String() string {
 		s.size[0], s.size[1], s.topLeft, s.topRight, s.bottomLeft, s.res)
 }
 
-func (d *Data) GetArbitraryImage(ctx storage.Context, tlStr, trStr, blStr, resStr string) (*dvid.Image, error) {
+// Size returns the size of the arbitrary image in pixels.
+func (s ArbSlice) Size() dvid.Point2d {
+	return s.size
+}
+
+// Point returns the real world coordinate of the given pixel in the arbitrary image.
+func (s ArbSlice) Point(x, y int32) dvid.Vector3d {
+	pt := s.topLeft
+	for i := 0; i < 3; i++ {
+		pt[i] += float64(x)*s.incrX[i] + float64(y)*s.incrY[i]
+	}
+	return pt
+}
+
+// GetArbitraryImage returns an image with arbitrary 3D orientation computed from the voxels
+// at the given scale.
+func (d *Data) GetArbitraryImage(ctx storage.Context, tlStr, trStr, blStr, resStr string, scale uint8) (*dvid.Image, error) {
+	if scale > d.MaxDownresLevel {
+		return nil, fmt.Errorf("scale %d exceeds max downres level %d of data %q", scale, d.MaxDownresLevel, d.DataName())
+	}
+
 	// Setup the image buffer
 	arb, err := d.NewArbSliceFromStrings(tlStr, trStr, blStr, resStr, "_")
 	if err != nil {
@@ -98,7 +118,7 @@ func (d *Data) GetArbitraryImage(ctx storage.Context, tlStr, trStr, blStr, resSt
 	keyF := func(pt dvid.Point3d) []byte {
 		chunkPt := pt.Chunk(d.BlockSize()).(dvid.ChunkPoint3d)
 		idx := dvid.IndexZYX(chunkPt)
-		return NewTKey(&idx)
+		return NewScaledTKey(scale, &idx)
 	}
 
 	// TODO: Add concurrency.
@@ -114,7 +134,7 @@ func (d *Data) GetArbitraryImage(ctx storage.Context, tlStr, trStr, blStr, resSt
 				wg.Done()
 			}()
 			for x := int32(0); x < arb.size[0]; x++ {
-				value, err := d.computeValue(curPt, ctx, KeyFunc(keyF), cache)
+				value, err := d.computeValue(curPt, scale, ctx, KeyFunc(keyF), cache)
 				if err != nil {
 					dvid.Errorf("Error in concurrent arbitrary image calc: %v", err)
 					return
@@ -139,9 +159,10 @@ type neighbors struct {
 	values     []byte
 }
 
-func (d *Data) neighborhood(pt dvid.Vector3d) neighbors {
+func (d *Data) neighborhood(pt dvid.Vector3d, scale uint8) neighbors {
 	res32 := d.Properties.Resolution
-	res := dvid.Vector3d{float64(res32.VoxelSize[0]), float64(res32.VoxelSize[1]), float64(res32.VoxelSize[2])}
+	mult := float64(int32(1) << scale)
+	res := dvid.Vector3d{float64(res32.VoxelSize[0]) * mult, float64(res32.VoxelSize[1]) * mult, float64(res32.VoxelSize[2]) * mult}
 
 	// Calculate voxel lattice points
 	voxelCoord := dvid.Vector3d{pt[0] / res[0], pt[1] / res[1], pt[2] / res[2]}
@@ -258,8 +279,9 @@ func (vc *ValueCache) Clear() {
 	vc.Unlock()
 }
 
-// Calculates value of a 3d real world point in space defined by underlying data resolution.
-func (d *Data) computeValue(pt dvid.Vector3d, ctx storage.Context, keyF KeyFunc, cache *ValueCache) ([]byte, error) {
+// Calculates value of a 3d real world point in space defined by underlying data resolution
+// at the given scale.
+func (d *Data) computeValue(pt dvid.Vector3d, scale uint8, ctx storage.Context, keyF KeyFunc, cache *ValueCache) ([]byte, error) {
 	db, err := datastore.GetOrderedKeyValueDB(d)
 	if err != nil {
 		return nil, err
@@ -299,7 +321,7 @@ func (d *Data) computeValue(pt dvid.Vector3d, ctx storage.Context, keyF KeyFunc,
 	}
 
 	// For the given point, compute surrounding lattice points and retrieve values.
-	neighbors := d.neighborhood(pt)
+	neighbors := d.neighborhood(pt, scale)
 	var valuesI int32
 	for _, voxelCoord := range neighbors.coords {
 		deserializedData, _, err := cache.Get(keyF(voxelCoord), populateF)
@@ -0,0 +1,830 @@
+package imageblk
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// Formats of chunked arrays on local disk that can be exported or ingested.
+const (
+	FormatZarr = "zarr" // zarr v2 with C order chunks
+	FormatN5   = "n5"
+)
+
+// Chunk compressions supported for chunked arrays.  Blosc is not supported.
+const (
+	ChunkRaw  = "raw"
+	ChunkGzip = "gzip"
+	ChunkZlib = "zlib" // zarr only
+)
+
+var chunkedTypes = []struct {
+	t    dvid.DataType
+	name string // N5 data type; zarr uses the numpy type code
+	code string
+}{
+	{dvid.T_uint8, "uint8", "u1"},
+	{dvid.T_int8, "int8", "i1"},
+	{dvid.T_uint16, "uint16", "u2"},
+	{dvid.T_int16, "int16", "i2"},
+	{dvid.T_uint32, "uint32", "u4"},
+	{dvid.T_int32, "int32", "i4"},
+	{dvid.T_uint64, "uint64", "u8"},
+	{dvid.T_int64, "int64", "i8"},
+	{dvid.T_float32, "float32", "f4"},
+	{dvid.T_float64, "float64", "f8"},
+}
+
+// ChunkedArray is a single-channel 3d array stored as chunk files in a local directory
+// using the zarr v2 or N5 format.  All coordinates and sizes are in x, y, z order
+// even though zarr metadata lists dimensions in z, y, x order.  The array voxel (0,0,0)
+// corresponds to the DVID voxel at Offset, which is kept in the array attributes as
+// "voxel_offset".
+type ChunkedArray struct {
+	Dir         string
+	Format      string
+	DataType    dvid.DataType
+	Shape       dvid.Point3d
+	ChunkSize   dvid.Point3d
+	Offset      dvid.Point3d
+	Compression string
+
+	elemBytes int
+	bigEndian bool
+	separator string // zarr dimension separator
+}
+
+type zarrCompressor struct {
+	ID    string `json:"id"`
+	Level *int   `json:"level,omitempty"`
+}
+
+type zarrArray struct {
+	ZarrFormat         int             `json:"zarr_format"`
+	Shape              []int64         `json:"shape"`
+	Chunks             []int64         `json:"chunks"`
+	DType              string          `json:"dtype"`
+	Compressor         *zarrCompressor `json:"compressor"`
+	FillValue          interface{}     `json:"fill_value"`
+	Order              string          `json:"order"`
+	Filters            []interface{}   `json:"filters"`
+	DimensionSeparator string          `json:"dimension_separator,omitempty"`
+}
+
+type zarrAttributes struct {
+	VoxelOffset []int32 `json:"voxel_offset,omitempty"`
+}
+
+type n5Compression struct {
+	Type  string `json:"type"`
+	Level *int   `json:"level,omitempty"`
+}
+
+type n5Attributes struct {
+	Dimensions  []int64        `json:"dimensions"`
+	BlockSize   []int64        `json:"blockSize"`
+	DataType    string         `json:"dataType"`
+	Compression *n5Compression `json:"compression"`
+	VoxelOffset []int32        `json:"voxel_offset,omitempty"`
+}
+
+// OpenChunkedArray reads the metadata of a zarr v2 or N5 array in a local directory.
+func OpenChunkedArray(dir string) (*ChunkedArray, error) {
+	a := &ChunkedArray{Dir: dir}
+	if metadata, err := ioutil.ReadFile(filepath.Join(dir, ".zarray")); err == nil {
+		a.Format = FormatZarr
+		if err := a.parseZarr(metadata); err != nil {
+			return nil, err
+		}
+	} else if metadata, err := ioutil.ReadFile(filepath.Join(dir, "attributes.json")); err == nil {
+		a.Format = FormatN5
+		if err := a.parseN5(metadata); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, fmt.Errorf("directory %q has no zarr .zarray or N5 attributes.json", dir)
+	}
+	a.elemBytes = int(dvid.DataTypeBytes(a.DataType))
+	return a, nil
+}
+
+func (a *ChunkedArray) parseZarr(metadata []byte) error {
+	var zarray zarrArray
+	if err := json.Unmarshal(metadata, &zarray); err != nil {
+		return fmt.Errorf("bad zarr metadata in %q: %v", a.Dir, err)
+	}
+	if zarray.ZarrFormat != 2 {
+		return fmt.Errorf("zarr array %q has format %d, only version 2 supported", a.Dir, zarray.ZarrFormat)
+	}
+	if len(zarray.Shape) != 3 || len(zarray.Chunks) != 3 {
+		return fmt.Errorf("zarr array %q must be 3d, has shape %v", a.Dir, zarray.Shape)
+	}
+	if zarray.Order != "C" {
+		return fmt.Errorf("zarr array %q has order %q, only C order supported", a.Dir, zarray.Order)
+	}
+	if len(zarray.Filters) != 0 {
+		return fmt.Errorf("zarr array %q has filters, which are not supported", a.Dir)
+	}
+	if len(zarray.DType) != 3 {
+		return fmt.Errorf("zarr array %q has unsupported dtype %q", a.Dir, zarray.DType)
+	}
+	a.bigEndian = zarray.DType[0] == '>'
+	found := false
+	for _, ct := range chunkedTypes {
+		if ct.code == zarray.DType[1:] {
+			a.DataType, found = ct.t, true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("zarr array %q has unsupported dtype %q", a.Dir, zarray.DType)
+	}
+	if zarray.Compressor == nil {
+		a.Compression = ChunkRaw
+	} else {
+		switch zarray.Compressor.ID {
+		case ChunkGzip, ChunkZlib:
+			a.Compression = zarray.Compressor.ID
+		default:
+			return fmt.Errorf("zarr array %q has unsupported compressor %q", a.Dir, zarray.Compressor.ID)
+		}
+	}
+	a.separator = "."
+	if zarray.DimensionSeparator != "" {
+		a.separator = zarray.DimensionSeparator
+	}
+	for i := 0; i < 3; i++ {
+		a.Shape[i] = int32(zarray.Shape[2-i])
+		a.ChunkSize[i] = int32(zarray.Chunks[2-i])
+	}
+
+	if attrs, err := ioutil.ReadFile(filepath.Join(a.Dir, ".zattrs")); err == nil {
+		var zattrs zarrAttributes
+		if err := json.Unmarshal(attrs, &zattrs); err != nil {
+			return fmt.Errorf("bad zarr attributes in %q: %v", a.Dir, err)
+		}
+		if err := a.setOffset(zattrs.VoxelOffset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *ChunkedArray) parseN5(metadata []byte) error {
+	var attrs n5Attributes
+	if err := json.Unmarshal(metadata, &attrs); err != nil {
+		return fmt.Errorf("bad N5 attributes in %q: %v", a.Dir, err)
+	}
+	if len(attrs.Dimensions) != 3 || len(attrs.BlockSize) != 3 {
+		return fmt.Errorf("N5 dataset %q must be 3d, has dimensions %v", a.Dir, attrs.Dimensions)
+	}
+	found := false
+	for _, ct := range chunkedTypes {
+		if ct.name == attrs.DataType {
+			a.DataType, found = ct.t, true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("N5 dataset %q has unsupported data type %q", a.Dir, attrs.DataType)
+	}
+	a.Compression = ChunkRaw
+	if attrs.Compression != nil {
+		switch attrs.Compression.Type {
+		case ChunkRaw, ChunkGzip:
+			a.Compression = attrs.Compression.Type
+		default:
+			return fmt.Errorf("N5 dataset %q has unsupported compression %q", a.Dir, attrs.Compression.Type)
+		}
+	}
+	a.bigEndian = true
+	for i := 0; i < 3; i++ {
+		a.Shape[i] = int32(attrs.Dimensions[i])
+		a.ChunkSize[i] = int32(attrs.BlockSize[i])
+	}
+	return a.setOffset(attrs.VoxelOffset)
+}
+
+func (a *ChunkedArray) setOffset(offset []int32) error {
+	if len(offset) == 0 {
+		return nil
+	}
+	if len(offset) != 3 {
+		return fmt.Errorf("voxel_offset of array %q must be 3d, got %v", a.Dir, offset)
+	}
+	a.Offset = dvid.Point3d{offset[0], offset[1], offset[2]}
+	return nil
+}
+
+// CreateChunkedArray creates a directory with the metadata of a new zarr v2 or N5 array.
+// Zarr arrays are written little-endian.
+func CreateChunkedArray(dir, format string, t dvid.DataType, shape, chunkSize, offset dvid.Point3d, compression string) (*ChunkedArray, error) {
+	var typeName, typeCode string
+	for _, ct := range chunkedTypes {
+		if ct.t == t {
+			typeName, typeCode = ct.name, ct.code
+			break
+		}
+	}
+	if typeName == "" {
+		return nil, fmt.Errorf("data type %d not supported for chunked arrays", t)
+	}
+	if compression == "" {
+		compression = ChunkGzip
+	}
+	a := &ChunkedArray{
+		Dir:         dir,
+		Format:      format,
+		DataType:    t,
+		Shape:       shape,
+		ChunkSize:   chunkSize,
+		Offset:      offset,
+		Compression: compression,
+		elemBytes:   int(dvid.DataTypeBytes(t)),
+		separator:   ".",
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	voxelOffset := []int32{offset[0], offset[1], offset[2]}
+
+	switch format {
+	case FormatZarr:
+		zarray := zarrArray{
+			ZarrFormat: 2,
+			Shape:      []int64{int64(shape[2]), int64(shape[1]), int64(shape[0])},
+			Chunks:     []int64{int64(chunkSize[2]), int64(chunkSize[1]), int64(chunkSize[0])},
+			DType:      "<" + typeCode,
+			FillValue:  0,
+			Order:      "C",
+		}
+		if typeCode == "u1" || typeCode == "i1" {
+			zarray.DType = "|" + typeCode
+		}
+		switch compression {
+		case ChunkRaw:
+		case ChunkGzip, ChunkZlib:
+			zarray.Compressor = &zarrCompressor{ID: compression}
+		default:
+			return nil, fmt.Errorf("unsupported zarr compression %q", compression)
+		}
+		if err := writeJSONFile(filepath.Join(dir, ".zarray"), zarray); err != nil {
+			return nil, err
+		}
+		if err := writeJSONFile(filepath.Join(dir, ".zattrs"), zarrAttributes{VoxelOffset: voxelOffset}); err != nil {
+			return nil, err
+		}
+	case FormatN5:
+		if compression != ChunkRaw && compression != ChunkGzip {
+			return nil, fmt.Errorf("unsupported N5 compression %q", compression)
+		}
+		a.bigEndian = true
+		attrs := n5Attributes{
+			Dimensions:  []int64{int64(shape[0]), int64(shape[1]), int64(shape[2])},
+			BlockSize:   []int64{int64(chunkSize[0]), int64(chunkSize[1]), int64(chunkSize[2])},
+			DataType:    typeName,
+			Compression: &n5Compression{Type: compression},
+			VoxelOffset: voxelOffset,
+		}
+		if err := writeJSONFile(filepath.Join(dir, "attributes.json"), attrs); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown chunked array format %q, must be %q or %q", format, FormatZarr, FormatN5)
+	}
+	return a, nil
+}
+
+func writeJSONFile(filename string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0644)
+}
+
+// numChunks returns the number of chunks along each axis.
+func (a *ChunkedArray) numChunks() dvid.Point3d {
+	var n dvid.Point3d
+	for i := 0; i < 3; i++ {
+		n[i] = (a.Shape[i] + a.ChunkSize[i] - 1) / a.ChunkSize[i]
+	}
+	return n
+}
+
+func (a *ChunkedArray) chunkPath(c dvid.ChunkPoint3d) string {
+	if a.Format == FormatN5 {
+		return filepath.Join(a.Dir, fmt.Sprintf("%d", c[0]), fmt.Sprintf("%d", c[1]), fmt.Sprintf("%d", c[2]))
+	}
+	name := strings.Join([]string{fmt.Sprintf("%d", c[2]), fmt.Sprintf("%d", c[1]), fmt.Sprintf("%d", c[0])}, a.separator)
+	return filepath.Join(a.Dir, filepath.FromSlash(name))
+}
+
+// swapEndian reverses the bytes of each element in place.
+func (a *ChunkedArray) swapEndian(data []byte) {
+	for i := 0; i+a.elemBytes <= len(data); i += a.elemBytes {
+		for j, k := i, i+a.elemBytes-1; j < k; j, k = j+1, k-1 {
+			data[j], data[k] = data[k], data[j]
+		}
+	}
+}
+
+func (a *ChunkedArray) decompress(data []byte) ([]byte, error) {
+	switch a.Compression {
+	case ChunkGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return ioutil.ReadAll(zr)
+	case ChunkZlib:
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return ioutil.ReadAll(zr)
+	default:
+		return data, nil
+	}
+}
+
+func (a *ChunkedArray) compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	switch a.Compression {
+	case ChunkGzip:
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+	case ChunkZlib:
+		zw := zlib.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+	default:
+		return data, nil
+	}
+	return buf.Bytes(), nil
+}
+
+// readChunk returns the little-endian data and stored size of a chunk, or found = false
+// if the chunk file doesn't exist.
+func (a *ChunkedArray) readChunk(c dvid.ChunkPoint3d) (data []byte, size dvid.Point3d, found bool, err error) {
+	var stored []byte
+	if stored, err = ioutil.ReadFile(a.chunkPath(c)); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	size = a.ChunkSize
+	if a.Format == FormatN5 {
+		if len(stored) < 16 {
+			err = fmt.Errorf("N5 chunk %s in %q has truncated header", c, a.Dir)
+			return
+		}
+		mode := binary.BigEndian.Uint16(stored[0:2])
+		ndims := binary.BigEndian.Uint16(stored[2:4])
+		if mode != 0 || ndims != 3 {
+			err = fmt.Errorf("N5 chunk %s in %q has unsupported mode %d or %d dimensions", c, a.Dir, mode, ndims)
+			return
+		}
+		for i := 0; i < 3; i++ {
+			size[i] = int32(binary.BigEndian.Uint32(stored[4+4*i:]))
+		}
+		stored = stored[16:]
+	}
+	if data, err = a.decompress(stored); err != nil {
+		err = fmt.Errorf("unable to decompress chunk %s in %q: %v", c, a.Dir, err)
+		return
+	}
+	if expected := int(size.Prod()) * a.elemBytes; len(data) != expected {
+		err = fmt.Errorf("chunk %s in %q has %d bytes, expected %d", c, a.Dir, len(data), expected)
+		return
+	}
+	if a.bigEndian {
+		a.swapEndian(data)
+	}
+	found = true
+	return
+}
+
+// writeChunk writes little-endian data of the given size for a chunk.  N5 chunks may be
+// truncated at the array bounds while zarr chunks must be of full chunk size.
+func (a *ChunkedArray) writeChunk(c dvid.ChunkPoint3d, data []byte, size dvid.Point3d) error {
+	if a.bigEndian {
+		swapped := make([]byte, len(data))
+		copy(swapped, data)
+		a.swapEndian(swapped)
+		data = swapped
+	}
+	compressed, err := a.compress(data)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if a.Format == FormatN5 {
+		header := make([]byte, 16)
+		binary.BigEndian.PutUint16(header[2:4], 3)
+		for i := 0; i < 3; i++ {
+			binary.BigEndian.PutUint32(header[4+4*i:], uint32(size[i]))
+		}
+		buf.Write(header)
+	}
+	buf.Write(compressed)
+
+	filename := a.chunkPath(c)
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, buf.Bytes(), 0644)
+}
+
+// returns the number of chunk files present and the number of chunks intersecting the
+// given DVID subvolume.
+func (a *ChunkedArray) countChunks(subvol *dvid.Subvolume) (present, total int, err error) {
+	offset := subvol.StartPoint().(dvid.Point3d)
+	size := subvol.Size().(dvid.Point3d)
+	var lo, hi dvid.Point3d
+	for i := 0; i < 3; i++ {
+		lo[i] = offset[i] - a.Offset[i]
+		if lo[i] < 0 {
+			lo[i] = 0
+		}
+		hi[i] = offset[i] + size[i] - a.Offset[i]
+		if hi[i] > a.Shape[i] {
+			hi[i] = a.Shape[i]
+		}
+		if hi[i] <= lo[i] {
+			return 0, 0, nil
+		}
+	}
+	for cz := lo[2] / a.ChunkSize[2]; cz <= (hi[2]-1)/a.ChunkSize[2]; cz++ {
+		for cy := lo[1] / a.ChunkSize[1]; cy <= (hi[1]-1)/a.ChunkSize[1]; cy++ {
+			for cx := lo[0] / a.ChunkSize[0]; cx <= (hi[0]-1)/a.ChunkSize[0]; cx++ {
+				total++
+				if _, err = os.Stat(a.chunkPath(dvid.ChunkPoint3d{cx, cy, cz})); err == nil {
+					present++
+				} else if os.IsNotExist(err) {
+					err = nil
+				} else {
+					return
+				}
+			}
+		}
+	}
+	return
+}
+
+// ReadInto copies any array voxels within the given DVID subvolume into dst, which holds
+// little-endian voxels of the subvolume.  Voxels outside the array or in chunks without
+// files are left unchanged.  Returns the number of chunk files read.
+func (a *ChunkedArray) ReadInto(subvol *dvid.Subvolume, dst []byte) (numChunks int, err error) {
+	offset := subvol.StartPoint().(dvid.Point3d)
+	size := subvol.Size().(dvid.Point3d)
+	if expected := int(size.Prod()) * a.elemBytes; len(dst) != expected {
+		return 0, fmt.Errorf("expected %d bytes for subvolume %s, got %d", expected, subvol, len(dst))
+	}
+
+	// bounds of subvolume within array coordinates
+	var lo, hi dvid.Point3d
+	for i := 0; i < 3; i++ {
+		lo[i] = offset[i] - a.Offset[i]
+		if lo[i] < 0 {
+			lo[i] = 0
+		}
+		hi[i] = offset[i] + size[i] - a.Offset[i]
+		if hi[i] > a.Shape[i] {
+			hi[i] = a.Shape[i]
+		}
+		if hi[i] <= lo[i] {
+			return 0, nil
+		}
+	}
+
+	for cz := lo[2] / a.ChunkSize[2]; cz <= (hi[2]-1)/a.ChunkSize[2]; cz++ {
+		for cy := lo[1] / a.ChunkSize[1]; cy <= (hi[1]-1)/a.ChunkSize[1]; cy++ {
+			for cx := lo[0] / a.ChunkSize[0]; cx <= (hi[0]-1)/a.ChunkSize[0]; cx++ {
+				c := dvid.ChunkPoint3d{cx, cy, cz}
+				data, csize, found, err := a.readChunk(c)
+				if err != nil {
+					return numChunks, err
+				}
+				if !found {
+					continue
+				}
+				numChunks++
+				corigin := dvid.Point3d{cx * a.ChunkSize[0], cy * a.ChunkSize[1], cz * a.ChunkSize[2]}
+				var ilo, ihi dvid.Point3d
+				for i := 0; i < 3; i++ {
+					ilo[i], ihi[i] = lo[i], hi[i]
+					if corigin[i] > ilo[i] {
+						ilo[i] = corigin[i]
+					}
+					if corigin[i]+csize[i] < ihi[i] {
+						ihi[i] = corigin[i] + csize[i]
+					}
+				}
+				rowBytes := int(ihi[0]-ilo[0]) * a.elemBytes
+				if rowBytes <= 0 || ihi[1] <= ilo[1] || ihi[2] <= ilo[2] {
+					continue
+				}
+				for z := ilo[2]; z < ihi[2]; z++ {
+					for y := ilo[1]; y < ihi[1]; y++ {
+						src := int(((z-corigin[2])*csize[1]+y-corigin[1])*csize[0]+ilo[0]-corigin[0]) * a.elemBytes
+						dz, dy, dx := z+a.Offset[2]-offset[2], y+a.Offset[1]-offset[1], ilo[0]+a.Offset[0]-offset[0]
+						dstPos := int((dz*size[1]+dy)*size[0]+dx) * a.elemBytes
+						copy(dst[dstPos:dstPos+rowBytes], data[src:src+rowBytes])
+					}
+				}
+			}
+		}
+	}
+	return numChunks, nil
+}
+
+// Export writes every chunk of the array using voxels returned by get for a DVID subvolume.
+// Chunks that are entirely zero are not written since zero is the fill value.
+func (a *ChunkedArray) Export(get func(*dvid.Subvolume) ([]byte, error)) (numChunks int, err error) {
+	n := a.numChunks()
+	for cz := int32(0); cz < n[2]; cz++ {
+		for cy := int32(0); cy < n[1]; cy++ {
+			for cx := int32(0); cx < n[0]; cx++ {
+				c := dvid.ChunkPoint3d{cx, cy, cz}
+				var offset, size dvid.Point3d
+				for i := 0; i < 3; i++ {
+					offset[i] = c[i] * a.ChunkSize[i]
+					size[i] = a.ChunkSize[i]
+					if a.Format == FormatN5 && offset[i]+size[i] > a.Shape[i] {
+						size[i] = a.Shape[i] - offset[i]
+					}
+					offset[i] += a.Offset[i]
+				}
+				data, err := get(dvid.NewSubvolume(offset, size))
+				if err != nil {
+					return numChunks, err
+				}
+				if allZero(data) {
+					continue
+				}
+				if err := a.writeChunk(c, data, size); err != nil {
+					return numChunks, err
+				}
+				numChunks++
+			}
+		}
+	}
+	return numChunks, nil
+}
+
+func allZero(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func alignDown(x, size int32) int32 {
+	if x < 0 {
+		return -((-x + size - 1) / size) * size
+	}
+	return (x / size) * size
+}
+
+// Ingest stores the array through put using block-aligned subvolumes that cover the
+// array, where each subvolume spans a chunk rounded up to whole blocks.  If a subvolume
+// extends past the array or any of its chunk files are missing, the current voxels are
+// read using get so the voxels outside the array and in missing chunks are preserved.
+// Subvolumes without any chunk files are skipped.  Returns the number of subvolumes put.
+func (a *ChunkedArray) Ingest(blockSize dvid.Point3d, get func(*dvid.Subvolume) ([]byte, error),
+	put func(*dvid.Subvolume, []byte) error) (numPuts int, err error) {
+
+	var tileSize, begin, end dvid.Point3d
+	for i := 0; i < 3; i++ {
+		tileSize[i] = ((a.ChunkSize[i] + blockSize[i] - 1) / blockSize[i]) * blockSize[i]
+		begin[i] = alignDown(a.Offset[i], blockSize[i])
+		end[i] = alignDown(a.Offset[i]+a.Shape[i]+blockSize[i]-1, blockSize[i])
+	}
+	for z := begin[2]; z < end[2]; z += tileSize[2] {
+		for y := begin[1]; y < end[1]; y += tileSize[1] {
+			for x := begin[0]; x < end[0]; x += tileSize[0] {
+				offset := dvid.Point3d{x, y, z}
+				var size dvid.Point3d
+				covered := true
+				for i := 0; i < 3; i++ {
+					size[i] = tileSize[i]
+					if offset[i]+size[i] > end[i] {
+						size[i] = end[i] - offset[i]
+					}
+					if offset[i] < a.Offset[i] || offset[i]+size[i] > a.Offset[i]+a.Shape[i] {
+						covered = false
+					}
+				}
+				subvol := dvid.NewSubvolume(offset, size)
+				var present, total int
+				if present, total, err = a.countChunks(subvol); err != nil {
+					return
+				}
+				if present == 0 {
+					continue
+				}
+				var data []byte
+				if covered && present == total {
+					data = make([]byte, int(size.Prod())*a.elemBytes)
+				} else if data, err = get(subvol); err != nil {
+					return
+				}
+				if _, err = a.ReadInto(subvol, data); err != nil {
+					return
+				}
+				if err = put(subvol, data); err != nil {
+					return
+				}
+				numPuts++
+			}
+		}
+	}
+	return
+}
+
+// ParseExportCommand parses an export command of the form
+//
+//	node <UUID> <data name> export-zarr <dir> <bounds> [scale=N] [format=zarr|n5] [compression=gzip|zlib|raw]
+//
+// where bounds is "x0,y0,z0,x1,y1,z1" in voxel coordinates of the given scale with exclusive
+// upper bounds.  It returns the version, scale, and a newly created chunked array whose chunks
+// are of the given size.
+func ParseExportCommand(req datastore.Request, t dvid.DataType, chunkSize dvid.Point3d) (uuid dvid.UUID, v dvid.VersionID, scale uint8, a *ChunkedArray, err error) {
+	var uuidStr, dataName, cmdStr, dir, boundsStr string
+	req.CommandArgs(1, &uuidStr, &dataName, &cmdStr, &dir, &boundsStr)
+	if dir == "" || boundsStr == "" {
+		err = fmt.Errorf("poorly formatted %s command, need directory and bounds.  See command-line help", cmdStr)
+		return
+	}
+	if uuid, v, err = datastore.MatchingUUID(uuidStr); err != nil {
+		return
+	}
+	var bounds []int32
+	for _, str := range strings.Split(boundsStr, ",") {
+		var i int
+		if i, err = strconv.Atoi(strings.TrimSpace(str)); err != nil {
+			err = fmt.Errorf("bad bounds %q: %v", boundsStr, err)
+			return
+		}
+		bounds = append(bounds, int32(i))
+	}
+	if len(bounds) != 6 {
+		err = fmt.Errorf("bounds %q must be of form x0,y0,z0,x1,y1,z1", boundsStr)
+		return
+	}
+	offset := dvid.Point3d{bounds[0], bounds[1], bounds[2]}
+	shape := dvid.Point3d{bounds[3] - bounds[0], bounds[4] - bounds[1], bounds[5] - bounds[2]}
+	if shape[0] <= 0 || shape[1] <= 0 || shape[2] <= 0 {
+		err = fmt.Errorf("bounds %q must have upper bounds greater than lower bounds", boundsStr)
+		return
+	}
+
+	settings := req.Settings()
+	var scaleInt int
+	if scaleInt, _, err = settings.GetInt("scale"); err != nil {
+		return
+	}
+	if scaleInt < 0 || scaleInt > 255 {
+		err = fmt.Errorf("bad scale %d", scaleInt)
+		return
+	}
+	scale = uint8(scaleInt)
+	format, found, err := settings.GetString("format")
+	if err != nil {
+		return
+	}
+	if !found {
+		format = FormatZarr
+	}
+	compression, _, err := settings.GetString("compression")
+	if err != nil {
+		return
+	}
+	a, err = CreateChunkedArray(dir, format, t, shape, chunkSize, offset, compression)
+	return
+}
+
+// ParseIngestCommand parses an ingest command of the form
+//
+//	node <UUID> <data name> ingest-zarr <dir> [offset=x,y,z]
+//
+// and returns the version and opened chunked array, which is expected to hold values of
+// the given data type.  If given, offset overrides any voxel_offset array attribute.
+func ParseIngestCommand(req datastore.Request, t dvid.DataType) (uuid dvid.UUID, v dvid.VersionID, a *ChunkedArray, err error) {
+	var uuidStr, dataName, cmdStr, dir string
+	req.CommandArgs(1, &uuidStr, &dataName, &cmdStr, &dir)
+	if dir == "" {
+		err = fmt.Errorf("poorly formatted %s command, need directory.  See command-line help", cmdStr)
+		return
+	}
+	if uuid, v, err = datastore.MatchingUUID(uuidStr); err != nil {
+		return
+	}
+	if a, err = OpenChunkedArray(dir); err != nil {
+		return
+	}
+	if a.DataType != t {
+		err = fmt.Errorf("array %q has data type %d, expected %d", dir, a.DataType, t)
+		return
+	}
+	if offsetStr, found := req.Setting("offset"); found {
+		if a.Offset, err = dvid.StringToPoint3d(offsetStr, ","); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// chunkedDataType returns the value type of single channel data.
+func (d *Data) chunkedDataType() (dvid.DataType, error) {
+	if len(d.Values) != 1 {
+		return 0, fmt.Errorf("data %q has %d channels, only single channel data can use chunked arrays", d.DataName(), len(d.Values))
+	}
+	return d.Values[0].T, nil
+}
+
+// ExportChunkedArray writes the voxels at the given scale within the array bounds to
+// the array's chunk files.
+func (d *Data) ExportChunkedArray(v dvid.VersionID, scale uint8, a *ChunkedArray) error {
+	if scale > d.MaxDownresLevel {
+		return fmt.Errorf("scale %d exceeds max downres level %d of data %q", scale, d.MaxDownresLevel, d.DataName())
+	}
+	timedLog := dvid.NewTimeLog()
+	numChunks, err := a.Export(func(subvol *dvid.Subvolume) ([]byte, error) {
+		vox, err := d.NewVoxels(subvol, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := d.GetScaledVoxels(v, vox, scale, ""); err != nil {
+			return nil, err
+		}
+		return vox.Data(), nil
+	})
+	if err != nil {
+		return err
+	}
+	timedLog.Infof("Exported %d chunks of data %q scale %d to %s %q", numChunks, d.DataName(), scale, a.Format, a.Dir)
+	return nil
+}
+
+// IngestChunkedArray stores the voxels of a chunked array using block-aligned mutations.
+func (d *Data) IngestChunkedArray(v dvid.VersionID, a *ChunkedArray) error {
+	blockSize, ok := d.BlockSize().(dvid.Point3d)
+	if !ok {
+		return fmt.Errorf("block size for data %q is not 3d: %v", d.DataName(), d.BlockSize())
+	}
+	d.StartUpdate()
+	defer d.StopUpdate()
+
+	timedLog := dvid.NewTimeLog()
+	get := func(subvol *dvid.Subvolume) ([]byte, error) {
+		vox, err := d.NewVoxels(subvol, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := d.GetVoxels(v, vox, ""); err != nil {
+			return nil, err
+		}
+		return vox.Data(), nil
+	}
+	put := func(subvol *dvid.Subvolume, data []byte) error {
+		vox, err := d.NewVoxels(subvol, data)
+		if err != nil {
+			return err
+		}
+		return d.PutVoxels(v, d.NewMutationID(), vox, "", true)
+	}
+	numPuts, err := a.Ingest(blockSize, get, put)
+	if err != nil {
+		return err
+	}
+	timedLog.Infof("Ingested %s %q into data %q using %d subvolume puts", a.Format, a.Dir, d.DataName(), numPuts)
+	return nil
+}
@@ -0,0 +1,519 @@
+/*
+	This file supports contrast normalization of 2d images using per-Z-slice intensity
+	histograms computed in the background.
+*/
+
+package imageblk
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"net/http"
+	"strconv"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// Values for the "normalize" query string option of 2d image requests.
+const (
+	NormalizeLinear = "true"  // stretch each slice's intensity percentiles to the full range
+	NormalizeCLAHE  = "clahe" // linear normalization followed by CLAHE
+)
+
+const (
+	// DefaultLowPercentile and DefaultHighPercentile are the percentiles of slice intensities
+	// mapped to 0 and 255 for linear normalization.
+	DefaultLowPercentile  = 0.5
+	DefaultHighPercentile = 99.5
+
+	// claheGridSize is the number of CLAHE tiles along each image dimension.
+	claheGridSize = 8
+
+	// claheClipLimit is the CLAHE histogram clip limit relative to a uniform histogram.
+	claheClipLimit = 2.0
+)
+
+// Adjustments are the settings for contrast normalization using per-Z-slice histograms
+// computed by POST .../adjustments.
+type Adjustments struct {
+	// LowPercentile and HighPercentile give the percentiles of each slice's intensities that
+	// are mapped to 0 and 255 when normalizing.
+	LowPercentile  float64
+	HighPercentile float64
+}
+
+// SliceAdjustment is the stored intensity histogram of a Z slice and the intensity levels
+// that are stretched to the full range on normalization.
+type SliceAdjustment struct {
+	Z         int32
+	Histogram []uint64
+	Low       uint8
+	High      uint8
+}
+
+// NewContrastTKey returns a TKey for the intensity histogram of a Z slice.
+func NewContrastTKey(z int32) storage.TKey {
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, uint32(z)^0x80000000) // preserve sort order of negative z
+	return storage.NewTKey(keyContrastHistogram, buf)
+}
+
+// DecodeContrastTKey returns the Z slice of a histogram key.
+func DecodeContrastTKey(tk storage.TKey) (int32, error) {
+	ibytes, err := tk.ClassBytes(keyContrastHistogram)
+	if err != nil {
+		return 0, err
+	}
+	if len(ibytes) != 4 {
+		return 0, fmt.Errorf("expected 4 bytes for contrast histogram key, got %d", len(ibytes))
+	}
+	return int32(binary.BigEndian.Uint32(ibytes) ^ 0x80000000), nil
+}
+
+// ValidNormalize returns an error if the given "normalize" option is not supported.
+func ValidNormalize(mode string) error {
+	switch mode {
+	case "", "false", NormalizeLinear, NormalizeCLAHE:
+		return nil
+	}
+	return fmt.Errorf("normalize must be %q or %q, not %q", NormalizeLinear, NormalizeCLAHE, mode)
+}
+
+// canNormalize returns an error if the data is not 8-bit grayscale.
+func (d *Data) canNormalize() error {
+	if len(d.Values) != 1 || d.Values[0].T != dvid.T_uint8 {
+		return fmt.Errorf("contrast normalization only supported for 8-bit grayscale data, not %q", d.DataName())
+	}
+	return nil
+}
+
+func (d *Data) adjustments() Adjustments {
+	d.adjustMu.RLock()
+	adj := d.Adjustments
+	d.adjustMu.RUnlock()
+	if adj.LowPercentile == 0 && adj.HighPercentile == 0 {
+		adj.LowPercentile, adj.HighPercentile = DefaultLowPercentile, DefaultHighPercentile
+	}
+	return adj
+}
+
+// levels returns the intensities at the given percentiles of a histogram.  If the histogram
+// is empty or doesn't have a range of intensities, ok is false.
+func levels(histogram []uint64, lowPct, highPct float64) (low, high uint8, ok bool) {
+	var total uint64
+	for _, count := range histogram {
+		total += count
+	}
+	if total == 0 {
+		return
+	}
+	lowCount := uint64(lowPct / 100.0 * float64(total))
+	highCount := uint64(highPct / 100.0 * float64(total))
+	var cum uint64
+	lowFound := false
+	for v, count := range histogram {
+		cum += count
+		if !lowFound && cum > lowCount {
+			low, lowFound = uint8(v), true
+		}
+		if cum >= highCount {
+			high = uint8(v)
+			break
+		}
+	}
+	return low, high, high > low
+}
+
+// GetSliceAdjustment returns the stored histogram and normalization levels for a Z slice
+// or nil if no histogram is stored.
+func (d *Data) GetSliceAdjustment(v dvid.VersionID, z int32) (*SliceAdjustment, error) {
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	value, err := store.Get(datastore.NewVersionedCtx(d, v), NewContrastTKey(z))
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return nil, nil
+	}
+	if len(value) != 256*8 {
+		return nil, fmt.Errorf("bad stored histogram for z %d of %q: %d bytes", z, d.DataName(), len(value))
+	}
+	adj := &SliceAdjustment{Z: z, Histogram: make([]uint64, 256)}
+	for i := range adj.Histogram {
+		adj.Histogram[i] = binary.LittleEndian.Uint64(value[i*8:])
+	}
+	settings := d.adjustments()
+	adj.Low, adj.High, _ = levels(adj.Histogram, settings.LowPercentile, settings.HighPercentile)
+	return adj, nil
+}
+
+// GetAdjustedZRange returns the minimum and maximum Z with stored histograms and the number
+// of stored slices.
+func (d *Data) GetAdjustedZRange(v dvid.VersionID) (minZ, maxZ int32, numSlices int, err error) {
+	var store storage.OrderedKeyValueDB
+	if store, err = datastore.GetOrderedKeyValueDB(d); err != nil {
+		return
+	}
+	var tkeys []storage.TKey
+	tkeys, err = store.KeysInRange(datastore.NewVersionedCtx(d, v), storage.MinTKey(keyContrastHistogram), storage.MaxTKey(keyContrastHistogram))
+	if err != nil || len(tkeys) == 0 {
+		return
+	}
+	if minZ, err = DecodeContrastTKey(tkeys[0]); err != nil {
+		return
+	}
+	if maxZ, err = DecodeContrastTKey(tkeys[len(tkeys)-1]); err != nil {
+		return
+	}
+	return minZ, maxZ, len(tkeys), nil
+}
+
+// ComputeAdjustments starts a background computation of per-Z-slice intensity histograms for
+// all scale 0 voxels that are not the background value, replacing previously stored histograms.
+func (d *Data) ComputeAdjustments(v dvid.VersionID) error {
+	if err := d.canNormalize(); err != nil {
+		return err
+	}
+	d.StartUpdate()
+	go func() {
+		defer d.StopUpdate()
+		if err := d.computeHistograms(v); err != nil {
+			dvid.Errorf("Unable to compute contrast histograms for %q: %v\n", d.DataName(), err)
+		}
+	}()
+	return nil
+}
+
+func (d *Data) computeHistograms(v dvid.VersionID) error {
+	timedLog := dvid.NewTimeLog()
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	blockSize, ok := d.BlockSize().(dvid.Point3d)
+	if !ok {
+		return fmt.Errorf("data %q does not have 3d block size", d.DataName())
+	}
+	blockVoxels := int(blockSize.Prod())
+	sliceVoxels := int(blockSize[0] * blockSize[1])
+	histograms := make(map[int32][]uint64)
+	ctx := datastore.NewVersionedCtx(d, v)
+	var f storage.ChunkFunc = func(chunk *storage.Chunk) error {
+		if chunk == nil || chunk.V == nil {
+			return nil
+		}
+		indexZYX, err := DecodeTKey(chunk.K)
+		if err != nil {
+			return err
+		}
+		data, _, err := dvid.DeserializeData(chunk.V, true)
+		if err != nil {
+			return fmt.Errorf("Error decoding block %s: %v", indexZYX, err)
+		}
+		if len(data) != blockVoxels {
+			return fmt.Errorf("block %s has %d bytes, expected %d", indexZYX, len(data), blockVoxels)
+		}
+		z0 := indexZYX.Value(2) * blockSize[2]
+		for dz := int32(0); dz < blockSize[2]; dz++ {
+			histogram, found := histograms[z0+dz]
+			if !found {
+				histogram = make([]uint64, 256)
+				histograms[z0+dz] = histogram
+			}
+			for _, value := range data[int(dz)*sliceVoxels : int(dz+1)*sliceVoxels] {
+				if value != d.Background {
+					histogram[value]++
+				}
+			}
+		}
+		return nil
+	}
+	err = store.ProcessRange(ctx, storage.MinTKey(keyImageBlock), storage.MaxTKey(keyImageBlock), &storage.ChunkOp{}, f)
+	if err != nil {
+		return err
+	}
+
+	if err := store.DeleteRange(ctx, storage.MinTKey(keyContrastHistogram), storage.MaxTKey(keyContrastHistogram)); err != nil {
+		return err
+	}
+	for z, histogram := range histograms {
+		value := make([]byte, 256*8)
+		for i, count := range histogram {
+			binary.LittleEndian.PutUint64(value[i*8:], count)
+		}
+		if err := store.Put(ctx, NewContrastTKey(z), value); err != nil {
+			return err
+		}
+	}
+	timedLog.Infof("Computed %d contrast histograms for %q", len(histograms), d.DataName())
+	return nil
+}
+
+// NormalizeImage returns a contrast-normalized 8-bit 2d image using the stored histograms
+// of the image's Z slices.  Each row of the image is at Z = z0 + row * zStep for planes like
+// XZ and YZ whose vertical axis is Z, while XY images are at z0.  Rows without stored histograms are not changed.
+// If mode is NormalizeCLAHE, contrast limited adaptive histogram equalization is applied
+// after the linear normalization.
+func (d *Data) NormalizeImage(v dvid.VersionID, img *dvid.Image, plane dvid.DataShape, z0, zStep int32, mode string) (*dvid.Image, error) {
+	if err := ValidNormalize(mode); err != nil {
+		return nil, err
+	}
+	if mode == "" || mode == "false" {
+		return img, nil
+	}
+	if err := d.canNormalize(); err != nil {
+		return nil, err
+	}
+	src, ok := img.Get().(*image.Gray)
+	if !ok {
+		return nil, fmt.Errorf("can only normalize 8-bit grayscale images, got %T", img.Get())
+	}
+	horzAxis, err := plane.ShapeDimension(0)
+	if err != nil {
+		return nil, err
+	}
+	vertAxis, err := plane.ShapeDimension(1)
+	if err != nil {
+		return nil, err
+	}
+	if horzAxis == 2 {
+		return nil, fmt.Errorf("can't normalize images with Z as horizontal axis: %s", plane)
+	}
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	gray := image.NewGray(image.Rect(0, 0, width, height))
+
+	settings := d.adjustments()
+	luts := make(map[int32]*[256]uint8)
+	for y := 0; y < height; y++ {
+		z := z0
+		if vertAxis == 2 {
+			z += int32(y) * zStep
+		}
+		lut, found := luts[z]
+		if !found {
+			adj, err := d.GetSliceAdjustment(v, z)
+			if err != nil {
+				return nil, err
+			}
+			if adj != nil {
+				if low, high, ok := levels(adj.Histogram, settings.LowPercentile, settings.HighPercentile); ok {
+					lut = new([256]uint8)
+					for value := range lut {
+						scaled := (value - int(low)) * 255 / (int(high) - int(low))
+						if scaled < 0 {
+							scaled = 0
+						} else if scaled > 255 {
+							scaled = 255
+						}
+						lut[value] = uint8(scaled)
+					}
+				}
+			}
+			luts[z] = lut
+		}
+		srcRow := src.Pix[y*src.Stride : y*src.Stride+width]
+		dstRow := gray.Pix[y*gray.Stride : y*gray.Stride+width]
+		if lut == nil {
+			copy(dstRow, srcRow)
+			continue
+		}
+		for x, value := range srcRow {
+			dstRow[x] = lut[value]
+		}
+	}
+	if mode == NormalizeCLAHE {
+		gray = CLAHE(gray, claheGridSize, claheClipLimit)
+	}
+	return dvid.ImageFromGoImage(gray, d.Values, d.Interpolable)
+}
+
+// CLAHE returns a copy of a grayscale image with contrast limited adaptive histogram
+// equalization applied using a grid of gridSize x gridSize tiles.  The clip limit is
+// relative to a uniform histogram, so 1.0 gives no contrast enhancement.
+func CLAHE(src *image.Gray, gridSize int, clipLimit float64) *image.Gray {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	dst := image.NewGray(image.Rect(0, 0, width, height))
+	if width == 0 || height == 0 {
+		return dst
+	}
+	tilesX, tilesY := gridSize, gridSize
+	if tilesX > width {
+		tilesX = width
+	}
+	if tilesY > height {
+		tilesY = height
+	}
+	tileW := (width + tilesX - 1) / tilesX
+	tileH := (height + tilesY - 1) / tilesY
+
+	// Compute a clipped, equalized mapping for each tile.
+	luts := make([][256]uint8, tilesX*tilesY)
+	for ty := 0; ty < tilesY; ty++ {
+		for tx := 0; tx < tilesX; tx++ {
+			var histogram [256]int
+			var numPixels int
+			for y := ty * tileH; y < (ty+1)*tileH && y < height; y++ {
+				for _, value := range src.Pix[y*src.Stride+tx*tileW : y*src.Stride+minInt((tx+1)*tileW, width)] {
+					histogram[value]++
+					numPixels++
+				}
+			}
+			lut := &luts[ty*tilesX+tx]
+			if numPixels == 0 {
+				for value := range lut {
+					lut[value] = uint8(value)
+				}
+				continue
+			}
+			clip := int(clipLimit * float64(numPixels) / 256)
+			if clip < 1 {
+				clip = 1
+			}
+			var excess int
+			for value, count := range histogram {
+				if count > clip {
+					excess += count - clip
+					histogram[value] = clip
+				}
+			}
+			for value := range histogram {
+				histogram[value] += excess / 256
+				if value < excess%256 {
+					histogram[value]++
+				}
+			}
+			var cum int
+			for value, count := range histogram {
+				cum += count
+				lut[value] = uint8(cum * 255 / numPixels)
+			}
+		}
+	}
+
+	// Bilinearly interpolate the mappings of the four nearest tile centers.
+	for y := 0; y < height; y++ {
+		gy := (float64(y)+0.5)/float64(tileH) - 0.5
+		ty0, wy := tileCoord(gy, tilesY)
+		ty1 := minInt(ty0+1, tilesY-1)
+		for x := 0; x < width; x++ {
+			gx := (float64(x)+0.5)/float64(tileW) - 0.5
+			tx0, wx := tileCoord(gx, tilesX)
+			tx1 := minInt(tx0+1, tilesX-1)
+			value := src.Pix[y*src.Stride+x]
+			top := (1-wx)*float64(luts[ty0*tilesX+tx0][value]) + wx*float64(luts[ty0*tilesX+tx1][value])
+			bottom := (1-wx)*float64(luts[ty1*tilesX+tx0][value]) + wx*float64(luts[ty1*tilesX+tx1][value])
+			dst.Pix[y*dst.Stride+x] = uint8((1-wy)*top + wy*bottom + 0.5)
+		}
+	}
+	return dst
+}
+
+// tileCoord returns the lower tile index and interpolation weight for a position in
+// tile-center coordinates.
+func tileCoord(g float64, numTiles int) (int, float64) {
+	if g <= 0 {
+		return 0, 0
+	}
+	if g >= float64(numTiles-1) {
+		return numTiles - 1, 0
+	}
+	t := int(g)
+	return t, g - float64(t)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// handleAdjustments handles GET and POST of the "adjustments" endpoint.
+func (d *Data) handleAdjustments(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) error {
+	if err := d.canNormalize(); err != nil {
+		return err
+	}
+	writeJSON := func(v interface{}) error {
+		jsonBytes, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, err = w.Write(jsonBytes)
+		return err
+	}
+	switch r.Method {
+	case "GET":
+		if len(parts) >= 5 {
+			z, err := strconv.ParseInt(parts[4], 10, 32)
+			if err != nil {
+				return fmt.Errorf("bad z %q for adjustments: %v", parts[4], err)
+			}
+			adj, err := d.GetSliceAdjustment(ctx.VersionID(), int32(z))
+			if err != nil {
+				return err
+			}
+			if adj == nil {
+				http.NotFound(w, r)
+				return nil
+			}
+			return writeJSON(adj)
+		}
+		minZ, maxZ, numSlices, err := d.GetAdjustedZRange(ctx.VersionID())
+		if err != nil {
+			return err
+		}
+		settings := d.adjustments()
+		return writeJSON(struct {
+			LowPercentile  float64
+			HighPercentile float64
+			Computing      bool
+			NumSlices      int
+			MinZ           int32
+			MaxZ           int32
+		}{settings.LowPercentile, settings.HighPercentile, d.Updating(), numSlices, minZ, maxZ})
+
+	case "POST":
+		queryStrings := r.URL.Query()
+		settings := d.adjustments()
+		var err error
+		if lowStr := queryStrings.Get("low"); lowStr != "" {
+			if settings.LowPercentile, err = strconv.ParseFloat(lowStr, 64); err != nil {
+				return fmt.Errorf("bad low percentile %q: %v", lowStr, err)
+			}
+		}
+		if highStr := queryStrings.Get("high"); highStr != "" {
+			if settings.HighPercentile, err = strconv.ParseFloat(highStr, 64); err != nil {
+				return fmt.Errorf("bad high percentile %q: %v", highStr, err)
+			}
+		}
+		if settings.LowPercentile < 0 || settings.HighPercentile > 100 || settings.LowPercentile >= settings.HighPercentile {
+			return fmt.Errorf("percentiles must satisfy 0 <= low < high <= 100, got low %g, high %g", settings.LowPercentile, settings.HighPercentile)
+		}
+		d.adjustMu.Lock()
+		changed := settings != d.Adjustments
+		d.Adjustments = settings
+		d.adjustMu.Unlock()
+		if changed {
+			if err := datastore.SaveDataByVersion(ctx.VersionID(), d); err != nil {
+				return err
+			}
+		}
+		if queryStrings.Get("compute") == "false" {
+			return nil
+		}
+		return d.ComputeAdjustments(ctx.VersionID())
+
+	default:
+		return fmt.Errorf("adjustments endpoint only supports GET and POST")
+	}
+}
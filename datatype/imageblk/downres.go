@@ -0,0 +1,306 @@
+package imageblk
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/downres"
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// Downsampling modes used to compute each lower-resolution voxel from its 2x2x2
+// higher-resolution voxels.
+const (
+	DownresMean = "mean" // average of the 8 voxels (default)
+	DownresMode = "mode" // most frequent value, preferring the first encountered on ties
+	DownresMin  = "min"
+	DownresMax  = "max"
+)
+
+func validDownresMode(mode string) bool {
+	switch mode {
+	case "", DownresMean, DownresMode, DownresMin, DownresMax:
+		return true
+	}
+	return false
+}
+
+// GetMaxDownresLevel returns the number of down-res levels, where level 0 = high-resolution
+// and each subsequent level has one-half the resolution.
+func (d *Data) GetMaxDownresLevel() uint8 {
+	return d.MaxDownresLevel
+}
+
+func (d *Data) StartScaleUpdate(scale uint8) {
+	d.updateMu.Lock()
+	if d.updates == nil {
+		d.updates = make(map[uint8]int)
+	}
+	d.updates[scale]++
+	d.updateMu.Unlock()
+}
+
+func (d *Data) StopScaleUpdate(scale uint8) {
+	d.updateMu.Lock()
+	d.updates[scale]--
+	if d.updates[scale] < 0 {
+		dvid.Criticalf("StopScaleUpdate(%d) called more than StartScaleUpdate.", scale)
+	}
+	d.updateMu.Unlock()
+}
+
+func (d *Data) ScaleUpdating(scale uint8) bool {
+	d.updateMu.RLock()
+	updating := d.updates[scale] > 0
+	d.updateMu.RUnlock()
+	return updating
+}
+
+func (d *Data) AnyScaleUpdating() bool {
+	d.updateMu.RLock()
+	defer d.updateMu.RUnlock()
+	for _, n := range d.updates {
+		if n > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// newDownresMutation returns a mutation for stashing changed scale 0 blocks or nil
+// if this data has no lower-resolution scales.
+func (d *Data) newDownresMutation(v dvid.VersionID, mutID uint64) *downres.Mutation {
+	if d.MaxDownresLevel == 0 {
+		return nil
+	}
+	return downres.NewMutation(d, v, mutID)
+}
+
+// getScaledBlock returns the uncompressed block at the given scale and block coordinate,
+// or a background block if none is stored.
+func (d *Data) getScaledBlock(v dvid.VersionID, scale uint8, izyx dvid.IZYXString) ([]byte, error) {
+	blockData, err := d.GetBlock(v, NewScaledTKeyByCoord(scale, izyx))
+	if err != nil {
+		return nil, err
+	}
+	if len(blockData) == 0 {
+		return d.BackgroundBlock(), nil
+	}
+	return blockData, nil
+}
+
+// StoreDownres computes and stores a lower-resolution representation of a set of mutated
+// blocks, which are uncompressed block data keyed by block coordinate at hiresScale.
+// Any block in an octant that wasn't mutated is read from storage.  Returns the
+// computed blocks at hiresScale + 1.
+func (d *Data) StoreDownres(v dvid.VersionID, hiresScale uint8, hires downres.BlockMap) (downres.BlockMap, error) {
+	timedLog := dvid.NewTimeLog()
+	if hiresScale >= d.MaxDownresLevel {
+		return nil, fmt.Errorf("can't downres %q scale %d since max downres scale is %d", d.DataName(), hiresScale, d.MaxDownresLevel)
+	}
+
+	// Group mutated blocks by the lower-res block that contains them.
+	octants := make(map[dvid.IZYXString][8][]byte)
+	for hiresZYX, value := range hires {
+		blockData, ok := value.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("bad changing block %s: expected []byte got %T", hiresZYX, value)
+		}
+		hresCoord, err := hiresZYX.ToChunkPoint3d()
+		if err != nil {
+			return nil, err
+		}
+		loresZYX := dvid.ChunkPoint3d{hresCoord[0] >> 1, hresCoord[1] >> 1, hresCoord[2] >> 1}.ToIZYXString()
+		octidx := ((hresCoord[2] & 1) << 2) + ((hresCoord[1] & 1) << 1) + (hresCoord[0] & 1)
+		oct := octants[loresZYX]
+		oct[octidx] = blockData
+		octants[loresZYX] = oct
+	}
+
+	batcher, err := datastore.GetKeyValueBatcher(d)
+	if err != nil {
+		return nil, err
+	}
+	ctx := datastore.NewVersionedCtx(d, v)
+	batch := batcher.NewBatch(ctx)
+
+	downresBMap := make(downres.BlockMap, len(octants))
+	for loresZYX, oct := range octants {
+		loresCoord, err := loresZYX.ToChunkPoint3d()
+		if err != nil {
+			return nil, err
+		}
+		for i := range oct {
+			if oct[i] != nil {
+				continue
+			}
+			hresCoord := dvid.ChunkPoint3d{
+				loresCoord[0]<<1 + int32(i&1),
+				loresCoord[1]<<1 + int32((i>>1)&1),
+				loresCoord[2]<<1 + int32((i>>2)&1),
+			}
+			if oct[i], err = d.getScaledBlock(v, hiresScale, hresCoord.ToIZYXString()); err != nil {
+				return nil, err
+			}
+		}
+		loresBlock, err := d.downresOctant(oct)
+		if err != nil {
+			return nil, err
+		}
+		downresBMap[loresZYX] = loresBlock
+
+		serialization, err := dvid.SerializeData(loresBlock, d.Compression(), d.Checksum())
+		if err != nil {
+			return nil, fmt.Errorf("unable to serialize downres block in %q: %v", d.DataName(), err)
+		}
+		batch.Put(NewScaledTKeyByCoord(hiresScale+1, loresZYX), serialization)
+	}
+	if err := batch.Commit(); err != nil {
+		return nil, fmt.Errorf("error on trying to write downres batch of scale %d->%d: %v", hiresScale, hiresScale+1, err)
+	}
+	timedLog.Infof("Computed down-resolution of %d octants for %q scale %d", len(octants), d.DataName(), hiresScale+1)
+	return downresBMap, nil
+}
+
+// downresOctant returns a block computed from the 8 higher-resolution blocks of an octant,
+// indexed by ((z % 2) << 2) + ((y % 2) << 1) + (x % 2).
+func (d *Data) downresOctant(oct [8][]byte) ([]byte, error) {
+	blockSize, ok := d.BlockSize().(dvid.Point3d)
+	if !ok {
+		return nil, fmt.Errorf("block size for data %q is not 3d: %v", d.DataName(), d.BlockSize())
+	}
+	bx, by, bz := int(blockSize[0]), int(blockSize[1]), int(blockSize[2])
+	if bx%2 != 0 || by%2 != 0 || bz%2 != 0 {
+		return nil, fmt.Errorf("can't downres %q with odd block size %s", d.DataName(), blockSize)
+	}
+	if len(d.Values) == 0 {
+		return nil, fmt.Errorf("no values defined for data %q", d.DataName())
+	}
+	elemType := d.Values[0].T
+	elemBytes := int(d.Values[0].ValueBytes())
+	for _, value := range d.Values {
+		if value.T != elemType {
+			return nil, fmt.Errorf("can't downres %q with mixed value types", d.DataName())
+		}
+	}
+	voxelBytes := elemBytes * len(d.Values)
+	blockBytes := bx * by * bz * voxelBytes
+	for i, block := range oct {
+		if len(block) != blockBytes {
+			return nil, fmt.Errorf("octant %d block for %q has %d bytes, expected %d", i, d.DataName(), len(block), blockBytes)
+		}
+	}
+	downsample, err := elementDownreser(d.DownresMode, elemType)
+	if err != nil {
+		return nil, err
+	}
+
+	lores := make([]byte, blockBytes)
+	hx, hy, hz := bx/2, by/2, bz/2
+	var elems [8][]byte
+	var i int
+	for z := 0; z < bz; z++ {
+		oz, sz := z/hz, (z%hz)*2
+		for y := 0; y < by; y++ {
+			oy, sy := y/hy, (y%hy)*2
+			for x := 0; x < bx; x++ {
+				ox, sx := x/hx, (x%hx)*2
+				block := oct[(oz<<2)+(oy<<1)+ox]
+				for e := 0; e < voxelBytes; e += elemBytes {
+					var n int
+					for dz := 0; dz < 2; dz++ {
+						for dy := 0; dy < 2; dy++ {
+							for dx := 0; dx < 2; dx++ {
+								pos := (((sz+dz)*by+sy+dy)*bx+sx+dx)*voxelBytes + e
+								elems[n] = block[pos : pos+elemBytes]
+								n++
+							}
+						}
+					}
+					downsample(elems, lores[i:i+elemBytes])
+					i += elemBytes
+				}
+			}
+		}
+	}
+	return lores, nil
+}
+
+// elementDownreser returns a function that computes one little-endian element from 8
+// higher-resolution elements using the given downsampling mode.
+func elementDownreser(mode string, t dvid.DataType) (func(elems [8][]byte, dst []byte), error) {
+	if mode == DownresMode {
+		return func(elems [8][]byte, dst []byte) {
+			var best, bestCount int
+			for i := 0; i < 8; i++ {
+				var count int
+				for j := i; j < 8; j++ {
+					if string(elems[i]) == string(elems[j]) {
+						count++
+					}
+				}
+				if count > bestCount {
+					best, bestCount = i, count
+				}
+			}
+			copy(dst, elems[best])
+		}, nil
+	}
+
+	var decode func([]byte) float64
+	var encode func(float64, []byte)
+	switch t {
+	case dvid.T_uint8:
+		decode = func(b []byte) float64 { return float64(b[0]) }
+		encode = func(f float64, b []byte) { b[0] = uint8(f) }
+	case dvid.T_uint16:
+		decode = func(b []byte) float64 { return float64(binary.LittleEndian.Uint16(b)) }
+		encode = func(f float64, b []byte) { binary.LittleEndian.PutUint16(b, uint16(f)) }
+	case dvid.T_uint32:
+		decode = func(b []byte) float64 { return float64(binary.LittleEndian.Uint32(b)) }
+		encode = func(f float64, b []byte) { binary.LittleEndian.PutUint32(b, uint32(f)) }
+	case dvid.T_uint64:
+		decode = func(b []byte) float64 { return float64(binary.LittleEndian.Uint64(b)) }
+		encode = func(f float64, b []byte) { binary.LittleEndian.PutUint64(b, uint64(f)) }
+	case dvid.T_float32:
+		decode = func(b []byte) float64 { return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))) }
+		encode = func(f float64, b []byte) { binary.LittleEndian.PutUint32(b, math.Float32bits(float32(f))) }
+	case dvid.T_float64:
+		decode = func(b []byte) float64 { return math.Float64frombits(binary.LittleEndian.Uint64(b)) }
+		encode = func(f float64, b []byte) { binary.LittleEndian.PutUint64(b, math.Float64bits(f)) }
+	default:
+		return nil, fmt.Errorf("downres mode %q only supported for unsigned integer or float values, not data type %d", mode, t)
+	}
+	isInt := t != dvid.T_float32 && t != dvid.T_float64
+
+	switch mode {
+	case "", DownresMean:
+		return func(elems [8][]byte, dst []byte) {
+			var sum float64
+			for _, elem := range elems {
+				sum += decode(elem)
+			}
+			mean := sum / 8
+			if isInt {
+				mean = math.Floor(mean + 0.5)
+			}
+			encode(mean, dst)
+		}, nil
+	case DownresMin, DownresMax:
+		isMin := mode == DownresMin
+		return func(elems [8][]byte, dst []byte) {
+			best, bestVal := 0, decode(elems[0])
+			for i := 1; i < 8; i++ {
+				val := decode(elems[i])
+				if (isMin && val < bestVal) || (!isMin && val > bestVal) {
+					best, bestVal = i, val
+				}
+			}
+			copy(dst, elems[best])
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown downres mode %q", mode)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"image"
+	_ "image/png"
 	"reflect"
 	"testing"
 
@@ -216,3 +218,54 @@ func TestFloat32RepoPersistence(t *testing.T) {
 		t.Errorf("Expected %v, got %v\n", oldData, *floatimg2)
 	}
 }
+
+func TestFloat32Colormap(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "float32blk", "floatimg", dvid.Config{})
+
+	offset := dvid.Point3d{0, 0, 0}
+	size := dvid.Point3d{64, 64, 64}
+	createFloatTestVolume(t, uuid, "floatimg", offset, size)
+
+	apiStr := fmt.Sprintf("%snode/%s/floatimg/raw/xy/64_64/0_0_0/png?colormap=gray&min=0&max=4095", server.WebAPIPath, uuid)
+	data := server.TestHTTP(t, "GET", apiStr, nil)
+	img, format, err := image.Decode(bytes.NewBuffer(data))
+	if err != nil {
+		t.Fatalf("unable to decode colormapped float32 image: %v\n", err)
+	}
+	if format != "png" {
+		t.Fatalf("expected png format, got %q\n", format)
+	}
+	gray, ok := img.(*image.Gray)
+	if !ok {
+		t.Fatalf("expected gray colormapped image, got %T\n", img)
+	}
+	if gray.Pix[0] != 0 || gray.Pix[len(gray.Pix)-1] != 255 {
+		t.Errorf("bad colormapped range: first %d, last %d\n", gray.Pix[0], gray.Pix[len(gray.Pix)-1])
+	}
+	if gray.Pix[32*64] != 128 {
+		t.Errorf("expected mid-image value 128, got %d\n", gray.Pix[32*64])
+	}
+
+	// Isotropic viridis with automatic range and downsampling.
+	apiStr = fmt.Sprintf("%snode/%s/floatimg/isotropic/xy/64_64/0_0_0/png?colormap=viridis", server.WebAPIPath, uuid)
+	data = server.TestHTTP(t, "GET", apiStr, nil)
+	img, _, err = image.Decode(bytes.NewBuffer(data))
+	if err != nil {
+		t.Fatalf("unable to decode viridis float32 image: %v\n", err)
+	}
+	r, g, b, _ := img.At(0, 0).RGBA()
+	if r>>8 != 68 || g>>8 != 1 || b>>8 != 84 {
+		t.Errorf("expected first viridis color at origin, got (%d,%d,%d)\n", r>>8, g>>8, b>>8)
+	}
+
+	apiStr = fmt.Sprintf("%snode/%s/floatimg/raw/xy/64_64/0_0_0/png?colormap=jet", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", apiStr, nil)
+	apiStr = fmt.Sprintf("%snode/%s/floatimg/raw/xy/64_64/0_0_0/png?colormap=gray&min=abc", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", apiStr, nil)
+}
@@ -12,8 +12,11 @@ import (
 	"errors"
 	"fmt"
 	"image"
+	"io"
 	"io/ioutil"
+	"math"
 	"net/http"
+	"net/url"
 	"os"
 	"reflect"
 	"strconv"
@@ -64,6 +67,9 @@ $ dvid repo <UUID> new imageblk <data name> <settings...>
     VoxelSize      Resolution of voxels (default: %f)
     VoxelUnits     Resolution units (default: "nanometers")
     Background     Integer value that signifies background in any element (default: 0)
+    MaxDownresLevel  The maximum down-res level supported.  Each down-res is factor of 2. (default: 0)
+    DownresMode    How lower-resolution voxels are computed from 2x2x2 voxels: "mean", "mode", "min",
+                     or "max" (default: "mean")
 
 $ dvid node <UUID> <data name> load <offset> <image glob>
 
@@ -110,6 +116,55 @@ $ dvid node <UUID> <data name> roi <new roi data name> <background values separa
 
     $ dvid node 3f8c mygrayscale roi grayscale_roi 0,255
 
+$ dvid node <UUID> <data name> export-zarr <dir> <bounds> [settings...]
+
+    Asynchronously writes single channel voxels within the bounds to a chunked array in a
+    local directory visible to the DVID server.  Chunks are the size of data blocks and
+    chunks that are entirely zero are not written.  The lower bound is saved as a
+    "voxel_offset" [x,y,z] attribute of the array.
+
+    Example:
+
+    $ dvid node 3f8c mygrayscale export-zarr /data/gray.zarr 0,0,0,1024,1024,512 scale=1
+
+    Arguments:
+
+    UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+    data name     Name of data to export.
+    dir           Directory of the new array.
+    bounds        Voxel bounds at the given scale in the format "x0,y0,z0,x1,y1,z1" where
+                    the upper bounds are exclusive.
+
+    Settings:
+
+    scale         Scale to export, from 0 to MaxDownresLevel (default 0).
+    format        "zarr" for zarr v2 (default) or "n5".
+    compression   "gzip" (default), "raw", or for zarr only, "zlib".  Blosc is not supported.
+
+$ dvid node <UUID> <data name> ingest-zarr <dir> [offset=x,y,z]
+
+    Asynchronously stores a chunked array in zarr v2 or N5 format from a local directory
+    visible to the DVID server.  The array must be single channel and of the same data type
+    as the data instance.  Voxels are written in block-aligned subvolumes through the normal
+    mutation path, so down-resolution scales and syncs are updated.  Chunks without files
+    are skipped and voxels outside the array are preserved.  Only zarr arrays in C order
+    without filters and with raw, gzip, or zlib compression are supported.
+
+    Example:
+
+    $ dvid node 3f8c mygrayscale ingest-zarr /data/gray.n5/s0 offset=0,0,100
+
+    Arguments:
+
+    UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+    data name     Name of data to ingest into.
+    dir           Directory of the array, holding either a zarr ".zarray" or N5 "attributes.json".
+
+    Settings:
+
+    offset        Voxel coordinate of the array's first voxel.  Defaults to the "voxel_offset"
+                    attribute of the array if present or 0,0,0 otherwise.
+
     
     ------------------
 
@@ -161,6 +216,36 @@ POST  <api URL>/node/<UUID>/<data name>/resolution
   	Extents should be in JSON in the following format:
   	[8,8,8]
 
+GET  <api URL>/node/<UUID>/<data name>/adjustments[/<z>]
+POST <api URL>/node/<UUID>/<data name>/adjustments[?queryopts]
+
+	Manages the per-Z-slice intensity histograms used for contrast normalization of 2d images
+	via the "normalize" query option.  Only available for 8-bit grayscale data.
+
+	The POST starts a background computation of the intensity histogram of each Z slice from
+	all scale 0 voxels that are not the Background value, replacing any prior histograms for
+	this version.  GET without a Z returns JSON with the normalization settings and the Z range
+	of stored histograms:
+
+	{
+		"LowPercentile": 0.5,
+		"HighPercentile": 99.5,
+		"Computing": false,
+		"NumSlices": 512,
+		"MinZ": 0,
+		"MaxZ": 511
+	}
+
+	GET with a Z returns JSON with the histogram of that slice (256 counts) and the "Low" and
+	"High" intensities at the normalization percentiles.  Returns status 404 if the slice has
+	no stored histogram.
+
+	POST Query-string Options:
+
+	low           Percentile of slice intensities mapped to 0 on normalization (default 0.5).
+	high          Percentile of slice intensities mapped to 255 on normalization (default 99.5).
+	compute       If "false", only the percentiles are changed and histograms are not recomputed.
+
 GET <api URL>/node/<UUID>/<data name>/rawkey?x=<block x>&y=<block y>&z=<block z>
 
     Returns JSON describing hex-encoded binary key used to store a block of data at the given block coordinate:
@@ -174,7 +259,8 @@ GET <api URL>/node/<UUID>/<data name>/rawkey?x=<block x>&y=<block y>&z=<block z>
 GET  <api URL>/node/<UUID>/<data name>/isotropic/<dims>/<size>/<offset>[/<format>][?queryopts]
 
     Retrieves either 2d images (PNG by default) or 3d binary data, depending on the dims parameter. 
-	If the underlying data is float32, then the little-endian four byte format is written as RGBA.
+	If the underlying data is float32, then the little-endian four byte format is written as RGBA
+	unless a colormap is requested.
     The 3d binary data response has "Content-type" set to "application/octet-stream" and is an array of 
     voxel values in ZYX order (X iterates most rapidly).
 
@@ -209,6 +295,19 @@ GET  <api URL>/node/<UUID>/<data name>/isotropic/<dims>/<size>/<offset>[/<format
 
     Query-string Options:
 
+    scale         A number from 0 up to MaxDownresLevel where each level beyond 0 has 1/2 resolution
+                    of the previous level.  Level 0 (default) is the highest resolution.  The size and
+                    offset are given in voxels at the requested scale.
+    normalize     Only works for 2d requests of 8-bit grayscale data.  If "true", the intensities of
+                    each Z slice are linearly stretched so the slice's low and high percentiles (see
+                    POST .../adjustments) map to 0 and 255.  If "clahe", contrast limited adaptive
+                    histogram equalization is also applied to the image.  Slices without computed
+                    histograms are not stretched.
+    colormap      Only works for 2d requests of float32 or 16-bit data.  Either "gray" or "viridis".
+                    Values are scaled between min and max and written as a PNG or JPG image.
+                    Values outside the range are clamped and NaN values are transparent for "viridis".
+    min           Value mapped to the bottom of the colormap (default: minimum value in image).
+    max           Value mapped to the top of the colormap (default: maximum value in image).
     throttle      Only works for 3d data requests.  If "true", makes sure only N compute-intense operation 
                     (all API calls that can be throttled) are handled.  If the server can't initiate the API 
                     call right away, a 503 (Service Unavailable) status code is returned.
@@ -264,6 +363,9 @@ GET  <api URL>/node/<UUID>/<data name>/specificblocks[?queryopts]
 
     compression   Allows retrieval of block data in default storage or as "uncompressed".
     blocks	  x,y,z... block string
+    scale         A number from 0 up to MaxDownresLevel where each level beyond 0 has 1/2 resolution
+                    of the previous level.  Level 0 (default) is the highest resolution.  The block
+                    coordinates are at the requested scale.
     prefetch	  ("on" or "true") Do not actually send data, non-blocking (default "off")
 
 
@@ -319,6 +421,9 @@ GET  <api URL>/node/<UUID>/<data name>/subvolblocks/<size>/<offset>[?queryopts]
     Query-string Options:
 
     compression   Allows retrieval of block data in "jpeg" (default) or "uncompressed".
+    scale         A number from 0 up to MaxDownresLevel where each level beyond 0 has 1/2 resolution
+                    of the previous level.  Level 0 (default) is the highest resolution.  The size and
+                    offset are given in voxels at the requested scale.
     throttle      If "true", makes sure only N compute-intense operation (all API calls that can be throttled) 
                     are handled.  If the server can't initiate the API call right away, a 503 (Service Unavailable) 
                     status code is returned.
@@ -330,7 +435,8 @@ GET  <api URL>/node/<UUID>/<data name>/subvolblocks/<size>/<offset>[?queryopts]
 GET  <api URL>/node/<UUID>/<data name>/raw/<dims>/<size>/<offset>[/<format>][?queryopts]
 
     Retrieves either 2d images (PNG by default) or 3d binary data, depending on the dims parameter.
-	If the underlying data is float32, then the little-endian four byte format is written as RGBA.
+	If the underlying data is float32, then the little-endian four byte format is written as RGBA
+	unless a colormap is requested.
     The 3d binary data response has "Content-type" set to "application/octet-stream" and is an array of 
     voxel values in ZYX order (X iterates most rapidly).
 
@@ -360,22 +466,40 @@ GET  <api URL>/node/<UUID>/<data name>/raw/<dims>/<size>/<offset>[/<format>][?qu
                     available in server implementation.
                   2D: "png", "jpg" (default: "png")
                     jpg allows lossy quality setting, e.g., "jpg:80"
-                  3D: uses default "octet-stream".
+                  3D: uses default "octet-stream".  Also accepts "tiff" for an uncompressed
+                    multi-page TIFF with one page per z, or "nrrd" for an NRRD file.  Both
+                    include the voxel offset and the voxel resolution at the requested scale.
 
     Query-string Options:
 
-    roi           Name of roi data instance used to mask the requested data.
+    roi           Name of roi data instance used to mask the requested data.  Only allowed at scale 0.
     attenuation   For attenuation n, this reduces the intensity of voxels outside ROI by 2^n.
                   Valid range is n = 1 to n = 7.  Currently only implemented for 8-bit voxels.
                   Default is to zero out voxels outside ROI.
+    scale         A number from 0 up to MaxDownresLevel where each level beyond 0 has 1/2 resolution
+                    of the previous level.  Level 0 (default) is the highest resolution.  The size and
+                    offset are given in voxels at the requested scale.
+    normalize     Only works for 2d requests of 8-bit grayscale data.  If "true", the intensities of
+                    each Z slice are linearly stretched so the slice's low and high percentiles (see
+                    POST .../adjustments) map to 0 and 255.  If "clahe", contrast limited adaptive
+                    histogram equalization is also applied to the image.  Slices without computed
+                    histograms are not stretched.
+    colormap      Only works for 2d requests of float32 or 16-bit data.  Either "gray" or "viridis".
+                    Values are scaled between min and max and written as a PNG or JPG image.
+                    Values outside the range are clamped and NaN values are transparent for "viridis".
+    min           Value mapped to the bottom of the colormap (default: minimum value in image).
+    max           Value mapped to the top of the colormap (default: maximum value in image).
     throttle      Only works for 3d data requests.  If "true", makes sure only N compute-intense operation 
                     (all API calls that can be throttled) are handled.  If the server can't initiate the API 
                     call right away, a 503 (Service Unavailable) status code is returned.
 
-POST <api URL>/node/<UUID>/<data name>/raw/0_1_2/<size>/<offset>[?queryopts]
+POST <api URL>/node/<UUID>/<data name>/raw/0_1_2/<size>/<offset>[/<format>][?queryopts]
 
     Puts block-aligned voxel data using the block sizes defined for  this data instance.  
     For example, if the BlockSize = 32, offset and size must be multiples of 32.
+    If MaxDownresLevel > 0, the lower-resolution scales are recomputed for the written blocks
+    after the POST, using the data's DownresMode.  Data ingested via the "load" command
+    does not have its lower-resolution scales computed.
 
     Example: 
 
@@ -392,6 +516,9 @@ POST <api URL>/node/<UUID>/<data name>/raw/0_1_2/<size>/<offset>[?queryopts]
     data name     Name of data to add.
     size          Size in voxels along each dimension specified in <dims>.
     offset        Gives coordinate of first voxel using dimensionality of data.
+    format        If omitted, the POSTed body is raw voxel values in ZYX order.  Use "tiff" or
+                    "nrrd" to POST a multi-page TIFF or NRRD file, which must have the size and
+                    voxel type of this data.  The offset in the URL is used for the write.
 
     Query-string Options:
 
@@ -429,14 +556,44 @@ GET  <api URL>/node/<UUID>/<data name>/arb/<top left>/<top right>/<bottom left>/
 
     Query-string Options:
 
+    scale         Sample voxels from the given down-resolution scale, where the voxel size is
+                    2^scale times the scale 0 voxel size.  Real world coordinates are unchanged.
+    colormap      For float32 or 16-bit data, "gray" or "viridis" to write a colormapped image
+                    using the "min" and "max" query options as the value range.
     throttle      If "true", makes sure only N compute-intense operation 
                     (all API calls that can be throttled) are handled.  If the server can't initiate the API 
                     call right away, a 503 (Service Unavailable) status code is returned.
 
+GET  <api URL>/node/<UUID>/<data name>/precomputed[/<encoding>]/info
+GET  <api URL>/node/<UUID>/<data name>/precomputed[/<encoding>]/<scale>/<x0>-<x1>_<y0>-<y1>_<z0>-<z1>
+
+    Read-only Neuroglancer precomputed volume, so a viewer can use the source
+    "precomputed://<api URL>/node/<UUID>/<data name>/precomputed" for any version.
+
+    The "info" JSON is generated from the data extents, resolution, block size, and
+    MaxDownresLevel.  Each scale uses the block size as chunk size with a block-aligned
+    voxel offset.  The resolution is in nanometers, converted from the voxel size and
+    units of the data.  Chunks are returned for a scale key (0 to MaxDownresLevel) and the
+    voxel bounds of the chunk at that scale, where the upper bounds are exclusive and
+    bounds can be negative, e.g., "-64--32_0-64_0-64".
+
+    Example: 
+
+    GET <api URL>/node/3f8c/grayscale/precomputed/jpeg/1/0-32_32-64_0-32
+
+    Arguments:
+
+    UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+    data name     Name of data.
+    encoding      Optional chunk encoding: "raw" (default) or "jpeg", which is only available
+                    for single channel uint8 data.
+
  GET <api URL>/node/<UUID>/<data name>/blocks/<block coord>/<spanX>
 POST <api URL>/node/<UUID>/<data name>/blocks/<block coord>/<spanX>
 
     Retrieves or puts "spanX" blocks of uncompressed voxel data along X starting from given block coordinate.
+    Blocks are at scale 0, and POSTed blocks have their lower-resolution scales recomputed if
+    MaxDownresLevel > 0.
 
     Example: 
 
@@ -738,6 +895,30 @@ func (v *Voxels) GetImage2d() (*dvid.Image, error) {
 	return dvid.ImageFromGoImage(img, v.Values(), v.Interpolable())
 }
 
+// colormapImage returns the image for a 2d request, converting single-channel values to
+// a displayable 8-bit image if a "colormap" query option is given.  The optional "min" and
+// "max" query options give the value range of the colormap, which defaults to the range
+// of image values.
+func colormapImage(img *dvid.Image, queryStrings url.Values) (image.Image, error) {
+	colormap := queryStrings.Get("colormap")
+	if colormap == "" {
+		return img.Get(), nil
+	}
+	minVal, maxVal := math.NaN(), math.NaN()
+	var err error
+	if minStr := queryStrings.Get("min"); minStr != "" {
+		if minVal, err = strconv.ParseFloat(minStr, 64); err != nil {
+			return nil, fmt.Errorf("bad colormap min %q: %v", minStr, err)
+		}
+	}
+	if maxStr := queryStrings.Get("max"); maxStr != "" {
+		if maxVal, err = strconv.ParseFloat(maxStr, 64); err != nil {
+			return nil, fmt.Errorf("bad colormap max %q: %v", maxStr, err)
+		}
+	}
+	return dvid.ColormapImage(img, colormap, minVal, maxVal)
+}
+
 // Properties are additional properties for image block data instances beyond those
 // in standard datastore.Data.   These will be persisted to metadata storage.
 type Properties struct {
@@ -757,6 +938,17 @@ type Properties struct {
 
 	// Background value for data
 	Background uint8
+
+	// MaxDownresLevel is the number of lower-resolution scales maintained for the data,
+	// each having half the resolution of the prior scale.  0 means only scale 0 is stored.
+	MaxDownresLevel uint8
+
+	// DownresMode is how lower-resolution voxels are computed: "mean" (default if empty),
+	// "mode", "min", or "max".
+	DownresMode string
+
+	// Adjustments are the settings for contrast normalization of 2d images.
+	Adjustments Adjustments
 }
 
 func (d *Data) PropertiesWithExtents(ctx *datastore.VersionedCtx) (props Properties, err error) {
@@ -775,6 +967,11 @@ func (d *Data) PropertiesWithExtents(ctx *datastore.VersionedCtx) (props Propert
 	props.Extents.MinIndex = verExtents.MinIndex
 	props.Extents.MaxIndex = verExtents.MaxIndex
 	props.Background = d.Properties.Background
+	props.MaxDownresLevel = d.Properties.MaxDownresLevel
+	props.DownresMode = d.Properties.DownresMode
+	d.adjustMu.RLock()
+	props.Adjustments = d.Properties.Adjustments
+	d.adjustMu.RUnlock()
 	return
 }
 
@@ -805,6 +1002,8 @@ func (p *Properties) copyImmutable(p2 *Properties) {
 	copy(p.Resolution.VoxelUnits, p2.Resolution.VoxelUnits)
 
 	p.Background = p2.Background
+	p.MaxDownresLevel = p2.MaxDownresLevel
+	p.DownresMode = p2.DownresMode
 }
 
 // setDefault sets Voxels properties to default values.
@@ -880,6 +1079,27 @@ func (p *Properties) setByConfig(config dvid.Config) error {
 		}
 		p.Background = uint8(background)
 	}
+	levels, found, err := config.GetInt("MaxDownresLevel")
+	if err != nil {
+		return err
+	}
+	if found {
+		if levels < 0 || levels > 255 {
+			return fmt.Errorf("illegal number of down-res levels specified (%d): must be 0 <= n <= 255", levels)
+		}
+		p.MaxDownresLevel = uint8(levels)
+	}
+	s, found, err = config.GetString("DownresMode")
+	if err != nil {
+		return err
+	}
+	if found {
+		mode := strings.ToLower(s)
+		if !validDownresMode(mode) {
+			return fmt.Errorf("unknown DownresMode %q, must be %q, %q, %q, or %q", s, DownresMean, DownresMode, DownresMin, DownresMax)
+		}
+		p.DownresMode = mode
+	}
 	return nil
 }
 
@@ -1036,6 +1256,13 @@ type Data struct {
 	*datastore.Data
 	Properties
 	sync.Mutex // to protect extent updates
+
+	datastore.Updater // tracks background computation of contrast adjustments
+
+	adjustMu sync.RWMutex // protects Properties.Adjustments
+
+	updates  map[uint8]int // tracks updating to each scale
+	updateMu sync.RWMutex
 }
 
 func (d *Data) Equals(d2 *Data) bool {
@@ -1403,11 +1630,55 @@ func (d *Data) Resolution() dvid.Resolution {
 	return d.Properties.Resolution
 }
 
+// VolumeMetadata returns the description of a subvolume at the given scale used when
+// writing self-describing volume formats.  The voxel size is scaled to match the
+// downres level.
+func (d *Data) VolumeMetadata(subvol *dvid.Subvolume, scale uint8) (dvid.VolumeMetadata, error) {
+	if len(d.Values) == 0 {
+		return dvid.VolumeMetadata{}, fmt.Errorf("data %q has no values", d.DataName())
+	}
+	for _, value := range d.Values {
+		if value.T != d.Values[0].T {
+			return dvid.VolumeMetadata{}, fmt.Errorf("data %q has channels of differing types", d.DataName())
+		}
+	}
+	meta := dvid.VolumeMetadata{
+		Type:        d.Values[0].T,
+		NumChannels: int32(len(d.Values)),
+		Size:        subvol.Size().(dvid.Point3d),
+		Offset:      subvol.StartPoint().(dvid.Point3d),
+	}
+	meta.VoxelUnits = d.Properties.VoxelUnits
+	if len(d.Properties.VoxelSize) > 0 {
+		meta.VoxelSize = make(dvid.NdFloat32, len(d.Properties.VoxelSize))
+		for i, size := range d.Properties.VoxelSize {
+			meta.VoxelSize[i] = size * float32(uint32(1)<<scale)
+		}
+	}
+	return meta, nil
+}
+
+// ReadVolumeFormat decodes a POSTed subvolume in a self-describing format and checks that
+// it matches the subvolume given in the request URL.
+func (d *Data) ReadVolumeFormat(format string, r io.Reader, subvol *dvid.Subvolume) ([]byte, error) {
+	expected, err := d.VolumeMetadata(subvol, 0)
+	if err != nil {
+		return nil, err
+	}
+	_, data, err := dvid.ReadVolume(format, r, &expected)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
 func (d *Data) String() string {
 	return string(d.DataName())
 }
 
 func (d *Data) MarshalJSON() ([]byte, error) {
+	d.adjustMu.RLock()
+	defer d.adjustMu.RUnlock()
 	return json.Marshal(struct {
 		Base     *datastore.Data
 		Extended Properties
@@ -1461,6 +1732,8 @@ func (d *Data) GobEncode() ([]byte, error) {
 	if err := enc.Encode(d.Data); err != nil {
 		return nil, err
 	}
+	d.adjustMu.RLock()
+	defer d.adjustMu.RUnlock()
 	if err := enc.Encode(d.Properties); err != nil {
 		return nil, err
 	}
@@ -1700,6 +1973,51 @@ func (d *Data) DoRPC(req datastore.Request, reply *datastore.Response) error {
 		}
 		return d.ForegroundROI(req, reply)
 
+	case "export-zarr":
+		t, err := d.chunkedDataType()
+		if err != nil {
+			return err
+		}
+		blockSize, ok := d.BlockSize().(dvid.Point3d)
+		if !ok {
+			return fmt.Errorf("block size for data %q is not 3d: %v", d.DataName(), d.BlockSize())
+		}
+		uuid, v, scale, a, err := ParseExportCommand(req, t, blockSize)
+		if err != nil {
+			return err
+		}
+		if scale > d.MaxDownresLevel {
+			return fmt.Errorf("scale %d exceeds max downres level %d of data %q", scale, d.MaxDownresLevel, d.DataName())
+		}
+		if err = datastore.AddToNodeLog(uuid, []string{req.Command.String()}); err != nil {
+			return err
+		}
+		reply.Text = fmt.Sprintf("Exporting data %q @ node %s to %s %q...\n", d.DataName(), uuid, a.Format, a.Dir)
+		go func() {
+			if err := d.ExportChunkedArray(v, scale, a); err != nil {
+				dvid.Errorf("Cannot export data %q @ node %s to %q: %v\n", d.DataName(), uuid, a.Dir, err)
+			}
+		}()
+
+	case "ingest-zarr":
+		t, err := d.chunkedDataType()
+		if err != nil {
+			return err
+		}
+		uuid, v, a, err := ParseIngestCommand(req, t)
+		if err != nil {
+			return err
+		}
+		if err = datastore.AddToNodeLog(uuid, []string{req.Command.String()}); err != nil {
+			return err
+		}
+		reply.Text = fmt.Sprintf("Ingesting %s %q into data %q @ node %s...\n", a.Format, a.Dir, d.DataName(), uuid)
+		go func() {
+			if err := d.IngestChunkedArray(v, a); err != nil {
+				dvid.Errorf("Cannot ingest %q into data %q @ node %s: %v\n", a.Dir, d.DataName(), uuid, err)
+			}
+		}()
+
 	default:
 		return fmt.Errorf("Unknown command.  Data instance '%s' [%s] does not support '%s' command.",
 			d.DataName(), d.TypeName(), req.TypeCommand())
@@ -1773,7 +2091,7 @@ func (d *Data) SendBlockSimple(w http.ResponseWriter, x, y, z int32, v []byte, c
 }
 
 // SendBlocksSpecific writes data to the blocks specified -- best for non-ordered backend
-func (d *Data) SendBlocksSpecific(ctx *datastore.VersionedCtx, w http.ResponseWriter, compression string, blockstring string, isprefetch bool) (numBlocks int, err error) {
+func (d *Data) SendBlocksSpecific(ctx *datastore.VersionedCtx, w http.ResponseWriter, scale uint8, compression string, blockstring string, isprefetch bool) (numBlocks int, err error) {
 	w.Header().Set("Content-type", "application/octet-stream")
 
 	if compression != "uncompressed" && compression != "jpeg" && compression != "" {
@@ -1829,7 +2147,7 @@ func (d *Data) SendBlocksSpecific(ctx *datastore.VersionedCtx, w http.ResponseWr
 				}()
 			}
 			indexBeg := dvid.IndexZYX(dvid.ChunkPoint3d{xloc, yloc, zloc})
-			keyBeg := NewTKey(&indexBeg)
+			keyBeg := NewScaledTKey(scale, &indexBeg)
 
 			value, err := store.Get(ctx, keyBeg)
 			if err != nil {
@@ -1858,8 +2176,9 @@ func (d *Data) SendBlocksSpecific(ctx *datastore.VersionedCtx, w http.ResponseWr
 	return
 }
 
-// GetBlocks returns a slice of bytes corresponding to all the blocks along a span in X
-func (d *Data) SendBlocks(ctx *datastore.VersionedCtx, w http.ResponseWriter, subvol *dvid.Subvolume, compression string) error {
+// SendBlocks writes all the blocks at the given scale within a block-aligned subvolume
+// to the HTTP response.
+func (d *Data) SendBlocks(ctx *datastore.VersionedCtx, w http.ResponseWriter, scale uint8, subvol *dvid.Subvolume, compression string) error {
 	w.Header().Set("Content-type", "application/octet-stream")
 
 	if compression != "uncompressed" && compression != "jpeg" && compression != "" {
@@ -1881,7 +2200,7 @@ func (d *Data) SendBlocks(ctx *datastore.VersionedCtx, w http.ResponseWriter, su
 	// if only one block is requested, avoid the range query
 	if blocksize.Value(0) == int32(1) && blocksize.Value(1) == int32(1) && blocksize.Value(2) == int32(1) {
 		indexBeg := dvid.IndexZYX(dvid.ChunkPoint3d{blockoffset.Value(0), blockoffset.Value(1), blockoffset.Value(2)})
-		keyBeg := NewTKey(&indexBeg)
+		keyBeg := NewScaledTKey(scale, &indexBeg)
 
 		value, err := store.Get(ctx, keyBeg)
 		if err != nil {
@@ -1911,9 +2230,9 @@ func (d *Data) SendBlocks(ctx *datastore.VersionedCtx, w http.ResponseWriter, su
 				endPoint := dvid.ChunkPoint3d{blockoffset.Value(0) + blocksize.Value(0) - 1, blockoffset.Value(1) + yiter, blockoffset.Value(2) + ziter}
 				indexBeg := dvid.IndexZYX(beginPoint)
 				sx, sy, sz := indexBeg.Unpack()
-				begTKey := NewTKey(&indexBeg)
+				begTKey := NewScaledTKey(scale, &indexBeg)
 				indexEnd := dvid.IndexZYX(endPoint)
-				endTKey := NewTKey(&indexEnd)
+				endTKey := NewScaledTKey(scale, &indexEnd)
 
 				// Send the entire range of key-value pairs to chunk processor
 				err = okv.ProcessRange(ctx, begTKey, endTKey, &storage.ChunkOp{}, func(c *storage.Chunk) error {
@@ -1948,7 +2267,7 @@ func (d *Data) SendBlocks(ctx *datastore.VersionedCtx, w http.ResponseWriter, su
 				for xiter := int32(0); xiter < blocksize.Value(0); xiter++ {
 					currPoint := dvid.ChunkPoint3d{blockoffset.Value(0) + xiter, blockoffset.Value(1) + yiter, blockoffset.Value(2) + ziter}
 					currPoint2 := dvid.IndexZYX(currPoint)
-					currTKey := NewTKey(&currPoint2)
+					currTKey := NewScaledTKey(scale, &currPoint2)
 					tkeys = append(tkeys, currTKey)
 				}
 				// Send the entire range of key-value pairs to chunk processor
@@ -1994,6 +2313,24 @@ func (d *Data) SendBlocks(ctx *datastore.VersionedCtx, w http.ResponseWriter, su
 	return err
 }
 
+// getScale returns the scale given by the "scale" query string, which defaults to 0.
+func (d *Data) getScale(queryStrings url.Values) (scale uint8, err error) {
+	scaleStr := queryStrings.Get("scale")
+	if scaleStr == "" {
+		return
+	}
+	var scaleInt int
+	if scaleInt, err = strconv.Atoi(scaleStr); err != nil {
+		return
+	}
+	if scaleInt < 0 || scaleInt > int(d.MaxDownresLevel) {
+		err = fmt.Errorf("scale %d is not in range 0 to max down-res level %d for data %q", scaleInt, d.MaxDownresLevel, d.DataName())
+		return
+	}
+	scale = uint8(scaleInt)
+	return
+}
+
 // ServeHTTP handles all incoming HTTP requests for this data.
 func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request) (activity map[string]interface{}) {
 	timedLog := dvid.NewTimeLog()
@@ -2035,6 +2372,15 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 			roiptr.attenuation = uint8(attenuation)
 		}
 	}
+	scale, err := d.getScale(queryStrings)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	if scale != 0 && len(roiname) != 0 {
+		server.BadRequest(w, r, "roi masking is only available at scale 0")
+		return
+	}
 
 	// Handle POST on data -> setting of configuration
 	if len(parts) == 3 && action == "put" {
@@ -2127,7 +2473,7 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 		}
 
 		if action == "get" {
-			numBlocks, err := d.SendBlocksSpecific(ctx, w, compression, blocklist, isprefetch)
+			numBlocks, err := d.SendBlocksSpecific(ctx, w, scale, compression, blocklist, isprefetch)
 			if err != nil {
 				server.BadRequest(w, r, err)
 				return
@@ -2170,7 +2516,7 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 		}
 
 		if action == "get" {
-			if err := d.SendBlocks(ctx, w, subvol, compression); err != nil {
+			if err := d.SendBlocks(ctx, w, scale, subvol, compression); err != nil {
 				server.BadRequest(w, r, err)
 				return
 			}
@@ -2219,6 +2565,16 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 		}
 		timedLog.Infof("HTTP %s: Blocks (%s)", r.Method, r.URL)
 
+	case "precomputed":
+		d.handlePrecomputed(ctx, w, r, parts)
+
+	case "adjustments":
+		if err := d.handleAdjustments(ctx, w, r, parts); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		timedLog.Infof("HTTP %s: adjustments (%s)", r.Method, r.URL)
+
 	case "arb":
 		// GET  <api URL>/node/<UUID>/<data name>/arb/<top left>/<top right>/<bottom left>/<res>[/<format>]
 		if len(parts) < 8 {
@@ -2231,7 +2587,7 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 			}
 			defer server.ThrottledOpDone()
 		}
-		img, err := d.GetArbitraryImage(ctx, parts[4], parts[5], parts[6], parts[7])
+		img, err := d.GetArbitraryImage(ctx, parts[4], parts[5], parts[6], parts[7], scale)
 		if err != nil {
 			server.BadRequest(w, r, err)
 			return
@@ -2240,7 +2596,12 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 		if len(parts) >= 9 {
 			formatStr = parts[8]
 		}
-		err = dvid.WriteImageHttp(w, img.Get(), formatStr)
+		goImg, err := colormapImage(img, queryStrings)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		err = dvid.WriteImageHttp(w, goImg, formatStr)
 		if err != nil {
 			server.BadRequest(w, r, err)
 			return
@@ -2282,11 +2643,24 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 				server.BadRequest(w, r, err)
 				return
 			}
-			img, err := d.GetImage(ctx.VersionID(), vox, roiname)
+			if err := d.GetScaledVoxels(ctx.VersionID(), vox, scale, roiname); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			img, err := vox.GetImage2d()
 			if err != nil {
 				server.BadRequest(w, r, err)
 				return
 			}
+			if normalize := queryStrings.Get("normalize"); normalize != "" {
+				zStep := int32(1) << scale
+				z0 := rawSlice.StartPoint().Value(2) * zStep
+				img, err = d.NormalizeImage(ctx.VersionID(), img, plane, z0, zStep, normalize)
+				if err != nil {
+					server.BadRequest(w, r, err)
+					return
+				}
+			}
 			if isotropic {
 				dstW := int(slice.Size().Value(0))
 				dstH := int(slice.Size().Value(1))
@@ -2300,7 +2674,12 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 			if len(parts) >= 8 {
 				formatStr = parts[7]
 			}
-			err = dvid.WriteImageHttp(w, img.Get(), formatStr)
+			goImg, err := colormapImage(img, queryStrings)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			err = dvid.WriteImageHttp(w, goImg, formatStr)
 			if err != nil {
 				server.BadRequest(w, r, err)
 				return
@@ -2328,7 +2707,7 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 				if len(parts) >= 8 && (parts[7] == "jpeg" || parts[7] == "jpg") {
 
 					// extract volume
-					if err := d.GetVoxels(ctx.VersionID(), vox, roiname); err != nil {
+					if err := d.GetScaledVoxels(ctx.VersionID(), vox, scale, roiname); err != nil {
 						server.BadRequest(w, r, err)
 						return
 					}
@@ -2357,13 +2736,25 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 					}
 				} else {
 
-					data, err := d.GetVolume(ctx.VersionID(), vox, roiname)
-					if err != nil {
+					if err := d.GetScaledVoxels(ctx.VersionID(), vox, scale, roiname); err != nil {
 						server.BadRequest(w, r, err)
 						return
 					}
+					if len(parts) >= 8 && dvid.IsVolumeFormat(parts[7]) {
+						meta, err := d.VolumeMetadata(subvol, scale)
+						if err != nil {
+							server.BadRequest(w, r, err)
+							return
+						}
+						if err := dvid.WriteVolumeHTTP(w, parts[7], meta, vox.Data()); err != nil {
+							server.BadRequest(w, r, err)
+							return
+						}
+						timedLog.Infof("HTTP %s: %s (%s)", r.Method, subvol, r.URL)
+						return
+					}
 					w.Header().Set("Content-type", "application/octet-stream")
-					_, err = w.Write(data)
+					_, err = w.Write(vox.Data())
 					if err != nil {
 						server.BadRequest(w, r, err)
 						return
@@ -2375,7 +2766,16 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 					server.BadRequest(w, r, err)
 					return
 				}
-				data, err := ioutil.ReadAll(r.Body)
+				if scale != 0 {
+					server.BadRequest(w, r, "can only POST scale 0 voxels; lower-resolution scales are computed")
+					return
+				}
+				var data []byte
+				if len(parts) >= 8 && dvid.IsVolumeFormat(parts[7]) {
+					data, err = d.ReadVolumeFormat(parts[7], r.Body, subvol)
+				} else {
+					data, err = ioutil.ReadAll(r.Body)
+				}
 				if err != nil {
 					server.BadRequest(w, r, err)
 					return
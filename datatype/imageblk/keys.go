@@ -25,6 +25,13 @@ const (
 
 	// legacy key class where extents property is stored
 	metaKeyClass = 24
+
+	// key class for blocks at lower-resolution scales, where the block coordinate is
+	// prefixed by the scale byte.  Scale 0 blocks use keyImageBlock.
+	keyImageBlockScaled = 25
+
+	// key class for per-Z-slice intensity histograms used for contrast normalization.
+	keyContrastHistogram = 26
 )
 
 // DescribeTKeyClass returns a string explanation of what a particular TKeyClass
@@ -35,6 +42,10 @@ func (d *Data) DescribeTKeyClass(tkc storage.TKeyClass) string {
 		return "imageblk properties key"
 	case keyImageBlock:
 		return "imageblk block coord key"
+	case keyImageBlockScaled:
+		return "imageblk scale + block coord key"
+	case keyContrastHistogram:
+		return "imageblk z slice intensity histogram key"
 	default:
 		return "unknown imageblk key"
 	}
@@ -52,21 +63,58 @@ func NewTKey(idx dvid.Index) storage.TKey {
 	return NewTKeyByCoord(izyx.ToIZYXString())
 }
 
+// NewScaledTKeyByCoord returns a TKey for a block coord at the given scale, where scale 0
+// is the highest resolution.
+func NewScaledTKeyByCoord(scale uint8, izyx dvid.IZYXString) storage.TKey {
+	if scale == 0 {
+		return NewTKeyByCoord(izyx)
+	}
+	buf := make([]byte, 1+len(izyx))
+	buf[0] = scale
+	copy(buf[1:], izyx)
+	return storage.NewTKey(keyImageBlockScaled, buf)
+}
+
+// NewScaledTKey returns a type-specific key component for an image block at the given scale.
+func NewScaledTKey(scale uint8, idx dvid.Index) storage.TKey {
+	izyx := idx.(*dvid.IndexZYX)
+	return NewScaledTKeyByCoord(scale, izyx.ToIZYXString())
+}
+
 // MetaTKey provides a TKey for metadata (extents)
 func MetaTKey() storage.TKey {
 	return storage.NewTKey(metaKeyClass, nil)
 }
 
-// DecodeTKey returns a spatial index from a image block key.
+// DecodeTKey returns a spatial index from a image block key of any scale.
 // TODO: Extend this when necessary to allow any form of spatial indexing like CZYX.
 func DecodeTKey(tk storage.TKey) (*dvid.IndexZYX, error) {
-	ibytes, err := tk.ClassBytes(keyImageBlock)
-	if err != nil {
-		return nil, err
+	_, zyx, err := DecodeScaledTKey(tk)
+	return zyx, err
+}
+
+// DecodeScaledTKey returns the scale and spatial index from an image block key.
+func DecodeScaledTKey(tk storage.TKey) (scale uint8, zyx *dvid.IndexZYX, err error) {
+	var class storage.TKeyClass
+	if class, err = tk.Class(); err != nil {
+		return
+	}
+	var ibytes []byte
+	if class == keyImageBlockScaled {
+		if ibytes, err = tk.ClassBytes(keyImageBlockScaled); err != nil {
+			return
+		}
+		if len(ibytes) == 0 {
+			err = fmt.Errorf("scaled image block key %v has no scale", tk)
+			return
+		}
+		scale, ibytes = ibytes[0], ibytes[1:]
+	} else if ibytes, err = tk.ClassBytes(keyImageBlock); err != nil {
+		return
 	}
-	var zyx dvid.IndexZYX
+	zyx = new(dvid.IndexZYX)
 	if err = zyx.IndexFromBytes(ibytes); err != nil {
-		return nil, fmt.Errorf("Cannot recover ZYX index from image block key %v: %v\n", tk, err)
+		err = fmt.Errorf("Cannot recover ZYX index from image block key %v: %v\n", tk, err)
 	}
-	return &zyx, nil
+	return
 }
@@ -0,0 +1,319 @@
+package imageblk
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+)
+
+// Encodings of chunks in the Neuroglancer precomputed format.
+const (
+	PrecomputedRaw     = "raw"
+	PrecomputedJPEG    = "jpeg"
+	PrecomputedCompSeg = "compressed_segmentation"
+)
+
+// PrecomputedScale describes one scale of a Neuroglancer precomputed volume.
+type PrecomputedScale struct {
+	Key                             string     `json:"key"`
+	Size                            [3]int32   `json:"size"`
+	VoxelOffset                     [3]int32   `json:"voxel_offset"`
+	ChunkSizes                      [][3]int32 `json:"chunk_sizes"`
+	Resolution                      [3]float32 `json:"resolution"`
+	Encoding                        string     `json:"encoding"`
+	CompressedSegmentationBlockSize *[3]int32  `json:"compressed_segmentation_block_size,omitempty"`
+}
+
+// PrecomputedInfo is the "info" JSON of a Neuroglancer precomputed volume.
+type PrecomputedInfo struct {
+	Type        string             `json:"@type"`
+	VolumeType  string             `json:"type"`
+	DataType    string             `json:"data_type"`
+	NumChannels int                `json:"num_channels"`
+	Scales      []PrecomputedScale `json:"scales"`
+}
+
+// nanometersPerUnit gives the size of voxel units in nanometers, which is the unit of
+// precomputed resolutions.
+var nanometersPerUnit = map[string]float64{
+	"picometers":  0.001,
+	"angstroms":   0.1,
+	"nanometers":  1,
+	"nm":          1,
+	"micrometers": 1000,
+	"microns":     1000,
+	"um":          1000,
+	"millimeters": 1000000,
+	"mm":          1000000,
+}
+
+// PrecomputedResolution returns the voxel size at scale 0 in nanometers using the voxel
+// units of the data, which default to nanometers.
+func (d *Data) PrecomputedResolution() (res [3]float64, err error) {
+	if len(d.Properties.VoxelSize) != 3 {
+		err = fmt.Errorf("voxel size for data %q is not 3d: %v", d.DataName(), d.Properties.VoxelSize)
+		return
+	}
+	for i := 0; i < 3; i++ {
+		units := DefaultUnits
+		if i < len(d.Properties.VoxelUnits) && d.Properties.VoxelUnits[i] != "" {
+			units = d.Properties.VoxelUnits[i]
+		}
+		factor, found := nanometersPerUnit[strings.ToLower(units)]
+		if !found {
+			err = fmt.Errorf("voxel units %q of data %q can't be converted to nanometers for precomputed format", units, d.DataName())
+			return
+		}
+		res[i] = float64(d.Properties.VoxelSize[i]) * factor
+	}
+	return
+}
+
+// PrecomputedDataType returns the Neuroglancer data type of the voxel values.
+func (d *Data) PrecomputedDataType() (string, error) {
+	if len(d.Values) == 0 {
+		return "", fmt.Errorf("no values defined for data %q", d.DataName())
+	}
+	t := d.Values[0].T
+	for _, value := range d.Values {
+		if value.T != t {
+			return "", fmt.Errorf("data %q has mixed value types, which precomputed format doesn't support", d.DataName())
+		}
+	}
+	switch t {
+	case dvid.T_uint8:
+		return "uint8", nil
+	case dvid.T_int8:
+		return "int8", nil
+	case dvid.T_uint16:
+		return "uint16", nil
+	case dvid.T_int16:
+		return "int16", nil
+	case dvid.T_uint32:
+		return "uint32", nil
+	case dvid.T_int32:
+		return "int32", nil
+	case dvid.T_uint64:
+		return "uint64", nil
+	case dvid.T_float32:
+		return "float32", nil
+	default:
+		return "", fmt.Errorf("data type %d of data %q not supported by precomputed format", t, d.DataName())
+	}
+}
+
+// PrecomputedInfo returns the info for a Neuroglancer precomputed volume with the given
+// volume type ("image" or "segmentation") and chunk encoding, where scales 0 through
+// maxScale are available.  The volume bounds are computed from the data extents, with the
+// voxel offset aligned to blocks so chunks are blocks except at the upper bounds.
+func (d *Data) PrecomputedInfo(ctx *datastore.VersionedCtx, volumeType, encoding string, maxScale uint8) (*PrecomputedInfo, error) {
+	dataType, err := d.PrecomputedDataType()
+	if err != nil {
+		return nil, err
+	}
+	extents, err := d.GetExtents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if extents.MinPoint == nil || extents.MaxPoint == nil || extents.MinPoint.NumDims() != 3 {
+		return nil, fmt.Errorf("data %q has no 3d extents so precomputed info can't be generated", d.DataName())
+	}
+	blockSize, ok := d.BlockSize().(dvid.Point3d)
+	if !ok {
+		return nil, fmt.Errorf("block size for data %q is not 3d: %v", d.DataName(), d.BlockSize())
+	}
+	resolution, err := d.PrecomputedResolution()
+	if err != nil {
+		return nil, err
+	}
+
+	info := &PrecomputedInfo{
+		Type:        "neuroglancer_multiscale_volume",
+		VolumeType:  volumeType,
+		DataType:    dataType,
+		NumChannels: len(d.Values),
+	}
+	for scale := uint8(0); scale <= maxScale; scale++ {
+		ps := PrecomputedScale{
+			Key:        strconv.Itoa(int(scale)),
+			ChunkSizes: [][3]int32{{blockSize[0], blockSize[1], blockSize[2]}},
+			Encoding:   encoding,
+		}
+		for i := uint8(0); i < 3; i++ {
+			minPt := extents.MinPoint.Value(i) >> scale
+			maxPt := extents.MaxPoint.Value(i) >> scale
+			offset := minPt - minPt%blockSize[i]
+			if minPt < 0 && minPt%blockSize[i] != 0 {
+				offset -= blockSize[i]
+			}
+			ps.VoxelOffset[i] = offset
+			ps.Size[i] = maxPt + 1 - offset
+			ps.Resolution[i] = float32(resolution[i] * float64(int64(1)<<scale))
+		}
+		if encoding == PrecomputedCompSeg {
+			ps.CompressedSegmentationBlockSize = &[3]int32{8, 8, 8}
+		}
+		info.Scales = append(info.Scales, ps)
+	}
+	return info, nil
+}
+
+// precomputedRangeRE matches a chunk range like "64-128" or "-64--32".
+var precomputedRangeRE = regexp.MustCompile(`^(-?[0-9]+)-(-?[0-9]+)$`)
+
+// ParsePrecomputedChunk returns the scale and subvolume of a precomputed chunk request
+// given the scale key and a chunk name of form "<x0>-<x1>_<y0>-<y1>_<z0>-<z1>", where
+// the bounds can be negative, e.g., "-64--32_0-64_0-64".
+func ParsePrecomputedChunk(key, chunk string, maxScale uint8) (scale uint8, subvol *dvid.Subvolume, err error) {
+	var scaleInt int
+	if scaleInt, err = strconv.Atoi(key); err != nil || scaleInt < 0 || scaleInt > int(maxScale) {
+		err = fmt.Errorf("bad precomputed scale key %q, must be 0 to %d", key, maxScale)
+		return
+	}
+	scale = uint8(scaleInt)
+	ranges := strings.Split(chunk, "_")
+	if len(ranges) != 3 {
+		err = fmt.Errorf("bad precomputed chunk %q, must be of form <x0>-<x1>_<y0>-<y1>_<z0>-<z1>", chunk)
+		return
+	}
+	var offset, size dvid.Point3d
+	for i, rng := range ranges {
+		bounds := precomputedRangeRE.FindStringSubmatch(rng)
+		if bounds == nil {
+			err = fmt.Errorf("bad range %q in precomputed chunk %q", rng, chunk)
+			return
+		}
+		var begin, end int64
+		if begin, err = strconv.ParseInt(bounds[1], 10, 32); err != nil {
+			return
+		}
+		if end, err = strconv.ParseInt(bounds[2], 10, 32); err != nil {
+			return
+		}
+		if end <= begin || end-begin > math.MaxInt32 {
+			err = fmt.Errorf("bad range %q in precomputed chunk %q", rng, chunk)
+			return
+		}
+		offset[i] = int32(begin)
+		size[i] = int32(end - begin)
+	}
+	subvol = dvid.NewSubvolume(offset, size)
+	return
+}
+
+// WritePrecomputedInfo writes the precomputed info as JSON to the HTTP response.
+func WritePrecomputedInfo(w http.ResponseWriter, info *PrecomputedInfo) error {
+	jsonBytes, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(jsonBytes)
+	return err
+}
+
+// handlePrecomputed serves a read-only Neuroglancer precomputed volume.
+func (d *Data) handlePrecomputed(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
+	// GET <api URL>/node/<UUID>/<data name>/precomputed[/<encoding>]/info
+	// GET <api URL>/node/<UUID>/<data name>/precomputed[/<encoding>]/<scale>/<x0>-<x1>_<y0>-<y1>_<z0>-<z1>
+	timedLog := dvid.NewTimeLog()
+
+	if strings.ToLower(r.Method) != "get" {
+		server.BadRequest(w, r, "only GET action allowed for precomputed endpoint")
+		return
+	}
+	encoding := PrecomputedRaw
+	path := parts[4:]
+	if len(path) > 0 && (path[0] == PrecomputedRaw || path[0] == PrecomputedJPEG) {
+		encoding = path[0]
+		path = path[1:]
+	}
+	if encoding == PrecomputedJPEG && (len(d.Values) != 1 || d.Values[0].T != dvid.T_uint8) {
+		server.BadRequest(w, r, "jpeg precomputed encoding only available for single channel uint8 data")
+		return
+	}
+
+	switch {
+	case len(path) == 1 && path[0] == "info":
+		info, err := d.PrecomputedInfo(ctx, "image", encoding, d.MaxDownresLevel)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if err := WritePrecomputedInfo(w, info); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+
+	case len(path) == 2:
+		scale, subvol, err := ParsePrecomputedChunk(path[0], path[1], d.MaxDownresLevel)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		vox, err := d.NewVoxels(subvol, nil)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if err := d.GetScaledVoxels(ctx.VersionID(), vox, scale, ""); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if encoding == PrecomputedJPEG {
+			// single channel jpeg chunks are images of width x and height y * z.
+			size := subvol.Size()
+			vox.Geometry, err = dvid.NewOrthogSlice(dvid.XY, subvol.StartPoint(), dvid.Point2d{size.Value(0), size.Value(1) * size.Value(2)})
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			img, err := vox.GetImage2d()
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			if err := dvid.WriteImageHttp(w, img.Get(), "jpg"); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+		} else {
+			w.Header().Set("Content-type", "application/octet-stream")
+			if _, err := w.Write(channelsToPlanes(vox.Data(), len(d.Values), int(d.Values[0].ValueBytes()))); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+		}
+
+	default:
+		server.BadRequest(w, r, "precomputed endpoint must be followed by \"info\" or <scale>/<chunk>")
+		return
+	}
+	timedLog.Infof("HTTP GET precomputed (%s)", r.URL)
+}
+
+// channelsToPlanes converts interleaved voxel values to the precomputed raw layout where
+// each channel is a separate volume.
+func channelsToPlanes(data []byte, numChannels, valueBytes int) []byte {
+	if numChannels <= 1 {
+		return data
+	}
+	voxelBytes := numChannels * valueBytes
+	numVoxels := len(data) / voxelBytes
+	planes := make([]byte, len(data))
+	for c := 0; c < numChannels; c++ {
+		dst := planes[c*numVoxels*valueBytes:]
+		for i := 0; i < numVoxels; i++ {
+			copy(dst[i*valueBytes:(i+1)*valueBytes], data[i*voxelBytes+c*valueBytes:])
+		}
+	}
+	return planes
+}
@@ -39,10 +39,14 @@ type Filter struct {
 }
 
 func (f Filter) Check(tkv *storage.TKeyValue) (skip bool, err error) {
-	indexZYX, err := DecodeTKey(tkv.K)
+	scale, indexZYX, err := DecodeScaledTKey(tkv.K)
 	if err != nil {
 		return true, fmt.Errorf("key (%v) cannot be decoded as block coord: %v", tkv.K, err)
 	}
+	// Lower-resolution blocks can't be exactly filtered by a scale 0 ROI so they are skipped.
+	if scale != 0 {
+		return true, nil
+	}
 	if !f.it.InsideFast(*indexZYX) {
 		return true, nil
 	}
@@ -321,13 +321,26 @@ type getOperation struct {
 
 // GetVoxels copies voxels from the storage engine to Voxels, a requested subvolume or 2d image.
 func (d *Data) GetVoxels(v dvid.VersionID, vox *Voxels, roiname dvid.InstanceName) error {
+	return d.GetScaledVoxels(v, vox, 0, roiname)
+}
+
+// GetScaledVoxels copies voxels at the given scale from the storage engine to Voxels, a
+// requested subvolume or 2d image whose geometry is in voxels at that scale.  An ROI can
+// only be used at scale 0.
+func (d *Data) GetScaledVoxels(v dvid.VersionID, vox *Voxels, scale uint8, roiname dvid.InstanceName) error {
+	if scale > d.MaxDownresLevel {
+		return fmt.Errorf("scale %d exceeds max down-res level %d for data %q", scale, d.MaxDownresLevel, d.DataName())
+	}
+	if scale != 0 && roiname != "" {
+		return fmt.Errorf("roi %q can only be used at scale 0", roiname)
+	}
 	r, err := GetROI(v, roiname, vox)
 	if err != nil {
 		return err
 	}
 
 	timedLog := dvid.NewTimeLog()
-	defer timedLog.Infof("GetVoxels %s", vox)
+	defer timedLog.Infof("GetVoxels %s, scale %d", vox, scale)
 
 	store, err := datastore.GetOrderedKeyValueDB(d)
 	if err != nil {
@@ -354,8 +367,8 @@ func (d *Data) GetVoxels(v dvid.VersionID, vox *Voxels, roiname dvid.InstanceNam
 		if err != nil {
 			return err
 		}
-		begTKey := NewTKey(indexBeg)
-		endTKey := NewTKey(indexEnd)
+		begTKey := NewScaledTKey(scale, indexBeg)
+		endTKey := NewScaledTKey(scale, indexEnd)
 
 		// Get set of blocks in ROI if ROI provided
 		var chunkOp *storage.ChunkOp
@@ -399,7 +412,7 @@ func (d *Data) GetVoxels(v dvid.VersionID, vox *Voxels, roiname dvid.InstanceNam
 			for x := begX; x <= endX; x++ {
 				c[0] = x
 				curIndex := dvid.IndexZYX(c)
-				currTKey := NewTKey(&curIndex)
+				currTKey := NewScaledTKey(scale, &curIndex)
 				tkeys = append(tkeys, currTKey)
 
 			}
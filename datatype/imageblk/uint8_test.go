@@ -4,13 +4,21 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
 	"log"
 	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
 	"reflect"
 	"sync"
 	"testing"
 
 	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/downres"
 	"github.com/janelia-flyem/dvid/dvid"
 	"github.com/janelia-flyem/dvid/server"
 )
@@ -455,3 +463,566 @@ func TestGrayscaleRepoPersistence(t *testing.T) {
 		t.Errorf("Expected %v, got %v\n", oldData, *grayscale2)
 	}
 }
+
+// returns a volume at half resolution computed using mean or max.
+func downresVolume(data []byte, size dvid.Point3d, mode string) []byte {
+	nx, ny, nz := size[0]/2, size[1]/2, size[2]/2
+	lores := make([]byte, nx*ny*nz)
+	var i int
+	for z := int32(0); z < nz; z++ {
+		for y := int32(0); y < ny; y++ {
+			for x := int32(0); x < nx; x++ {
+				var sum, max int
+				for dz := int32(0); dz < 2; dz++ {
+					for dy := int32(0); dy < 2; dy++ {
+						for dx := int32(0); dx < 2; dx++ {
+							v := int(data[((2*z+dz)*size[1]+2*y+dy)*size[0]+2*x+dx])
+							sum += v
+							if v > max {
+								max = v
+							}
+						}
+					}
+				}
+				if mode == DownresMax {
+					lores[i] = byte(max)
+				} else {
+					lores[i] = byte((sum + 4) / 8)
+				}
+				i++
+			}
+		}
+	}
+	return lores
+}
+
+func TestGrayscaleDownres(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	for _, mode := range []string{DownresMean, DownresMax} {
+		name := "grayscale-" + mode
+		config := dvid.NewConfig()
+		config.Set("MaxDownresLevel", "2")
+		config.Set("DownresMode", mode)
+		if _, err := datastore.NewData(uuid, grayscaleT, dvid.InstanceName(name), config); err != nil {
+			t.Fatalf("Unable to create grayscale instance %q: %v\n", name, err)
+		}
+
+		vol := testVolume{
+			data:   dvid.RandomBytes(128 * 128 * 64),
+			offset: dvid.Point3d{0, 0, 0},
+			size:   dvid.Point3d{128, 128, 64},
+		}
+		vol.put(t, uuid, name)
+		if err := downres.BlockOnUpdating(uuid, dvid.InstanceName(name)); err != nil {
+			t.Fatalf("Error blocking on downres of %q: %v\n", name, err)
+		}
+
+		// scale 1 is a 64 x 64 x 32 volume.
+		expected1 := downresVolume(vol.data, vol.size, mode)
+		apiStr := fmt.Sprintf("%snode/%s/%s/raw/0_1_2/64_64_32/0_0_0?scale=1", server.WebAPIPath, uuid, name)
+		if data := server.TestHTTP(t, "GET", apiStr, nil); !bytes.Equal(data, expected1) {
+			t.Fatalf("bad scale 1 volume for %q\n", name)
+		}
+
+		// scale 2 is a 32 x 32 x 16 volume since the rest of its block is background.
+		expected2 := downresVolume(expected1, dvid.Point3d{64, 64, 32}, mode)
+		apiStr = fmt.Sprintf("%snode/%s/%s/raw/0_1_2/32_32_16/0_0_0?scale=2", server.WebAPIPath, uuid, name)
+		if data := server.TestHTTP(t, "GET", apiStr, nil); !bytes.Equal(data, expected2) {
+			t.Fatalf("bad scale 2 volume for %q\n", name)
+		}
+
+		apiStr = fmt.Sprintf("%snode/%s/%s/raw/0_1_2/32_32_16/0_0_0?scale=3", server.WebAPIPath, uuid, name)
+		server.TestBadHTTP(t, "GET", apiStr, nil)
+
+		// axis-aligned arbitrary image at scale 1 should sample the scale 1 voxels, where the
+		// default voxel size is 8 nm at scale 0.
+		apiStr = fmt.Sprintf("%snode/%s/%s/arb/0_0_160/1008_0_160/0_1008_160/16/png?scale=1", server.WebAPIPath, uuid, name)
+		img, err := png.Decode(bytes.NewReader(server.TestHTTP(t, "GET", apiStr, nil)))
+		if err != nil {
+			t.Fatalf("unable to decode arbitrary image for %q: %v\n", name, err)
+		}
+		gray, ok := img.(*image.Gray)
+		if !ok || !bytes.Equal(gray.Pix, expected1[10*64*64:11*64*64]) {
+			t.Fatalf("bad scale 1 arbitrary image for %q\n", name)
+		}
+	}
+
+	// modify one scale 0 block via the blocks endpoint and make sure lower scales are updated.
+	name := "grayscale-" + DownresMean
+	apiStr := fmt.Sprintf("%snode/%s/%s/raw/0_1_2/64_64_64/0_0_0", server.WebAPIPath, uuid, name)
+	hires := server.TestHTTP(t, "GET", apiStr, nil)
+	block := bytes.Repeat([]byte{200}, 32*32*32)
+	blockReq := fmt.Sprintf("%snode/%s/%s/blocks/1_1_1/1", server.WebAPIPath, uuid, name)
+	server.TestHTTP(t, "POST", blockReq, bytes.NewBuffer(block))
+	if err := downres.BlockOnUpdating(uuid, dvid.InstanceName(name)); err != nil {
+		t.Fatalf("Error blocking on downres of %q: %v\n", name, err)
+	}
+	for z := 32; z < 64; z++ {
+		for y := 32; y < 64; y++ {
+			copy(hires[(z*64+y)*64+32:(z*64+y)*64+64], block[:32])
+		}
+	}
+	expected := downresVolume(hires, dvid.Point3d{64, 64, 64}, DownresMean)
+	apiStr = fmt.Sprintf("%snode/%s/%s/raw/0_1_2/32_32_32/0_0_0?scale=1", server.WebAPIPath, uuid, name)
+	if data := server.TestHTTP(t, "GET", apiStr, nil); !bytes.Equal(data, expected) {
+		t.Fatalf("bad scale 1 block after POST of scale 0 block\n")
+	}
+}
+
+func TestGrayscalePrecomputed(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("MaxDownresLevel", "1")
+	config.Set("VoxelSize", "4.0, 4.0, 8.0")
+	dataservice, err := datastore.NewData(uuid, grayscaleT, "grayscale", config)
+	if err != nil {
+		t.Fatalf("Unable to create grayscale instance: %v\n", err)
+	}
+	vol := testVolume{
+		data:   dvid.RandomBytes(128 * 96 * 64),
+		offset: dvid.Point3d{0, 0, 0},
+		size:   dvid.Point3d{128, 96, 64},
+	}
+	vol.put(t, uuid, "grayscale")
+	if err := downres.BlockOnUpdating(uuid, "grayscale"); err != nil {
+		t.Fatalf("Error blocking on downres of grayscale: %v\n", err)
+	}
+
+	apiStr := fmt.Sprintf("%snode/%s/grayscale/precomputed/info", server.WebAPIPath, uuid)
+	var info PrecomputedInfo
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", apiStr, nil), &info); err != nil {
+		t.Fatalf("Unable to parse precomputed info: %v\n", err)
+	}
+	if info.Type != "neuroglancer_multiscale_volume" || info.VolumeType != "image" || info.DataType != "uint8" || info.NumChannels != 1 {
+		t.Fatalf("bad precomputed info: %v\n", info)
+	}
+	if len(info.Scales) != 2 {
+		t.Fatalf("expected 2 scales in precomputed info, got %d\n", len(info.Scales))
+	}
+	if info.Scales[0].Size != [3]int32{128, 96, 64} || info.Scales[1].Size != [3]int32{64, 48, 32} {
+		t.Errorf("bad precomputed scale sizes: %v, %v\n", info.Scales[0].Size, info.Scales[1].Size)
+	}
+	if info.Scales[1].Resolution != [3]float32{8, 8, 16} || info.Scales[1].Key != "1" {
+		t.Errorf("bad precomputed scale 1: %v\n", info.Scales[1])
+	}
+	if info.Scales[0].Encoding != PrecomputedRaw || info.Scales[0].ChunkSizes[0] != [3]int32{32, 32, 32} {
+		t.Errorf("bad precomputed scale 0: %v\n", info.Scales[0])
+	}
+
+	// raw chunk should match the subvolume.
+	apiStr = fmt.Sprintf("%snode/%s/grayscale/precomputed/0/32-64_64-96_0-32", server.WebAPIPath, uuid)
+	chunk := server.TestHTTP(t, "GET", apiStr, nil)
+	apiStr = fmt.Sprintf("%snode/%s/grayscale/raw/0_1_2/32_32_32/32_64_0", server.WebAPIPath, uuid)
+	if expected := server.TestHTTP(t, "GET", apiStr, nil); !bytes.Equal(chunk, expected) {
+		t.Errorf("precomputed scale 0 chunk doesn't match raw subvolume\n")
+	}
+	apiStr = fmt.Sprintf("%snode/%s/grayscale/precomputed/raw/1/32-64_32-48_0-32", server.WebAPIPath, uuid)
+	chunk = server.TestHTTP(t, "GET", apiStr, nil)
+	apiStr = fmt.Sprintf("%snode/%s/grayscale/raw/0_1_2/32_16_32/32_32_0?scale=1", server.WebAPIPath, uuid)
+	if expected := server.TestHTTP(t, "GET", apiStr, nil); !bytes.Equal(chunk, expected) {
+		t.Errorf("precomputed scale 1 chunk doesn't match raw subvolume\n")
+	}
+
+	// jpeg chunk is 32 x (32 * 32) image.
+	apiStr = fmt.Sprintf("%snode/%s/grayscale/precomputed/jpeg/0/0-32_0-32_0-32", server.WebAPIPath, uuid)
+	img, err := jpeg.Decode(bytes.NewReader(server.TestHTTP(t, "GET", apiStr, nil)))
+	if err != nil {
+		t.Fatalf("Unable to decode precomputed jpeg chunk: %v\n", err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != 32 || bounds.Dy() != 32*32 {
+		t.Errorf("expected 32 x 1024 jpeg chunk, got %d x %d\n", bounds.Dx(), bounds.Dy())
+	}
+
+	apiStr = fmt.Sprintf("%snode/%s/grayscale/precomputed/2/0-32_0-32_0-32", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", apiStr, nil)
+	apiStr = fmt.Sprintf("%snode/%s/grayscale/precomputed/0/0-32_0-32", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", apiStr, nil)
+
+	// chunk bounds can be negative.
+	_, subvol, err := ParsePrecomputedChunk("0", "-64--32_-32-0_0-32", 0)
+	if err != nil {
+		t.Fatalf("unable to parse negative precomputed chunk: %v\n", err)
+	}
+	if !subvol.StartPoint().(dvid.Point3d).Equals(dvid.Point3d{-64, -32, 0}) || !subvol.Size().(dvid.Point3d).Equals(dvid.Point3d{32, 32, 32}) {
+		t.Errorf("bad negative precomputed chunk: %s\n", subvol)
+	}
+	for _, chunk := range []string{"-32--64_0-32_0-32", "0--32_0-32_0-32", "0-32_0-32_0-4294967296", "a-32_0-32_0-32"} {
+		if _, _, err := ParsePrecomputedChunk("0", chunk, 0); err == nil {
+			t.Errorf("expected error parsing precomputed chunk %q\n", chunk)
+		}
+	}
+
+	// resolution is converted to nanometers from the voxel units.
+	grayscale := dataservice.(*Data)
+	grayscale.Properties.VoxelUnits = dvid.NdString{"micrometers", "micrometers", "nanometers"}
+	if res, err := grayscale.PrecomputedResolution(); err != nil || res != [3]float64{4000, 4000, 8} {
+		t.Errorf("bad precomputed resolution for micrometers: %v, %v\n", res, err)
+	}
+	grayscale.Properties.VoxelUnits = dvid.NdString{"parsecs", "parsecs", "parsecs"}
+	if _, err := grayscale.PrecomputedResolution(); err == nil {
+		t.Errorf("expected error for unknown voxel units\n")
+	}
+}
+
+func TestGrayscaleChunkedArray(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, v := initTestRepo()
+	grayscale := makeGrayscale(uuid, t, "grayscale")
+	vol := testVolume{
+		data:   dvid.RandomBytes(128 * 96 * 64),
+		offset: dvid.Point3d{0, 0, 0},
+		size:   dvid.Point3d{128, 96, 64},
+	}
+	vol.put(t, uuid, "grayscale")
+
+	tmpDir, err := ioutil.TempDir("", "dvid-chunkedarray")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v\n", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// export a non-block aligned subvolume, then ingest it offset into another instance
+	// that has existing voxels, which should be preserved outside the array.
+	apiStr := fmt.Sprintf("%snode/%s/grayscale/raw/0_1_2/70_50_40/10_20_5", server.WebAPIPath, uuid)
+	expected := server.TestHTTP(t, "GET", apiStr, nil)
+	for _, format := range []string{FormatZarr, FormatN5} {
+		for _, compression := range []string{ChunkRaw, ChunkGzip} {
+			dir := filepath.Join(tmpDir, format+"-"+compression)
+			cmd := dvid.Command{"node", string(uuid), "grayscale", "export-zarr", dir, "10,20,5,80,70,45",
+				"format=" + format, "compression=" + compression}
+			_, _, scale, a, err := ParseExportCommand(datastore.Request{Command: cmd}, dvid.T_uint8, dvid.Point3d{32, 32, 32})
+			if err != nil {
+				t.Fatalf("bad export command: %v\n", err)
+			}
+			if err := grayscale.ExportChunkedArray(v, scale, a); err != nil {
+				t.Fatalf("unable to export %s: %v\n", format, err)
+			}
+
+			a, err = OpenChunkedArray(dir)
+			if err != nil {
+				t.Fatalf("unable to open exported %s: %v\n", format, err)
+			}
+			if a.Format != format || a.Compression != compression || a.DataType != dvid.T_uint8 ||
+				!a.Shape.Equals(dvid.Point3d{70, 50, 40}) || !a.Offset.Equals(dvid.Point3d{10, 20, 5}) {
+				t.Fatalf("bad exported %s array: %v\n", format, a)
+			}
+			data := make([]byte, len(expected))
+			if _, err := a.ReadInto(dvid.NewSubvolume(a.Offset, a.Shape), data); err != nil {
+				t.Fatalf("unable to read exported %s: %v\n", format, err)
+			}
+			if !bytes.Equal(data, expected) {
+				t.Fatalf("exported %s doesn't match original voxels\n", format)
+			}
+
+			name := "ingested-" + format + "-" + compression
+			ingested := makeGrayscale(uuid, t, name)
+			background := testVolume{
+				data:   bytes.Repeat([]byte{7}, 128*128*128),
+				offset: dvid.Point3d{0, 0, 0},
+				size:   dvid.Point3d{128, 128, 128},
+			}
+			background.put(t, uuid, name)
+			cmd = dvid.Command{"node", string(uuid), name, "ingest-zarr", dir, "offset=40,30,20"}
+			if _, _, a, err = ParseIngestCommand(datastore.Request{Command: cmd}, dvid.T_uint8); err != nil {
+				t.Fatalf("bad ingest command: %v\n", err)
+			}
+			if err := ingested.IngestChunkedArray(v, a); err != nil {
+				t.Fatalf("unable to ingest %s: %v\n", format, err)
+			}
+			apiStr = fmt.Sprintf("%snode/%s/%s/raw/0_1_2/70_50_40/40_30_20", server.WebAPIPath, uuid, name)
+			if got := server.TestHTTP(t, "GET", apiStr, nil); !bytes.Equal(got, expected) {
+				t.Fatalf("ingested %s doesn't match exported voxels\n", format)
+			}
+			apiStr = fmt.Sprintf("%snode/%s/%s/raw/0_1_2/10_10_10/100_0_0", server.WebAPIPath, uuid, name)
+			if got := server.TestHTTP(t, "GET", apiStr, nil); !bytes.Equal(got, background.data[:1000]) {
+				t.Fatalf("ingest of %s didn't preserve voxels outside array\n", format)
+			}
+		}
+	}
+
+	// chunks missing from within the array also leave existing voxels unchanged.
+	dir := filepath.Join(tmpDir, "missing")
+	a, err := CreateChunkedArray(dir, FormatZarr, dvid.T_uint8, dvid.Point3d{64, 64, 64}, dvid.Point3d{16, 16, 16}, dvid.Point3d{0, 0, 0}, ChunkRaw)
+	if err != nil {
+		t.Fatalf("unable to create chunked array: %v\n", err)
+	}
+	if err := a.writeChunk(dvid.ChunkPoint3d{0, 0, 0}, bytes.Repeat([]byte{9}, 16*16*16), a.ChunkSize); err != nil {
+		t.Fatalf("unable to write chunk: %v\n", err)
+	}
+	ingested := makeGrayscale(uuid, t, "ingested-missing")
+	background := testVolume{
+		data:   bytes.Repeat([]byte{7}, 64*64*64),
+		offset: dvid.Point3d{0, 0, 0},
+		size:   dvid.Point3d{64, 64, 64},
+	}
+	background.put(t, uuid, "ingested-missing")
+	if err := ingested.IngestChunkedArray(v, a); err != nil {
+		t.Fatalf("unable to ingest array with missing chunks: %v\n", err)
+	}
+	apiStr = fmt.Sprintf("%snode/%s/ingested-missing/raw/0_1_2/16_16_16/0_0_0", server.WebAPIPath, uuid)
+	if got := server.TestHTTP(t, "GET", apiStr, nil); !bytes.Equal(got, bytes.Repeat([]byte{9}, 16*16*16)) {
+		t.Fatalf("ingest didn't store voxels of present chunk\n")
+	}
+	apiStr = fmt.Sprintf("%snode/%s/ingested-missing/raw/0_1_2/48_48_48/16_16_16", server.WebAPIPath, uuid)
+	if got := server.TestHTTP(t, "GET", apiStr, nil); !bytes.Equal(got, bytes.Repeat([]byte{7}, 48*48*48)) {
+		t.Fatalf("ingest didn't preserve voxels of missing chunks\n")
+	}
+}
+
+func TestGrayscaleVolumeFormats(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	grayscale := makeGrayscale(uuid, t, "grayscale")
+	vol := testVolume{
+		data:   dvid.RandomBytes(128 * 96 * 64),
+		offset: dvid.Point3d{0, 0, 0},
+		size:   dvid.Point3d{128, 96, 64},
+	}
+	vol.put(t, uuid, "grayscale")
+
+	apiStr := fmt.Sprintf("%snode/%s/grayscale/raw/0_1_2/70_50_40/10_20_5", server.WebAPIPath, uuid)
+	expected := server.TestHTTP(t, "GET", apiStr, nil)
+	for _, format := range []string{dvid.VolumeTIFF, dvid.VolumeNRRD} {
+		returned := server.TestHTTP(t, "GET", apiStr+"/"+format, nil)
+		meta, data, err := dvid.ReadVolume(format, bytes.NewBuffer(returned), nil)
+		if err != nil {
+			t.Fatalf("unable to read returned %s: %v\n", format, err)
+		}
+		if err := meta.CheckVolume(dvid.T_uint8, 1, dvid.Point3d{70, 50, 40}); err != nil {
+			t.Fatalf("bad returned %s: %v\n", format, err)
+		}
+		if !meta.Offset.Equals(dvid.Point3d{10, 20, 5}) {
+			t.Fatalf("expected returned %s to have offset (10,20,5), got %s\n", format, meta.Offset)
+		}
+		if !bytes.Equal(data, expected) {
+			t.Fatalf("returned %s doesn't match raw voxels\n", format)
+		}
+	}
+	tiff := server.TestHTTP(t, "GET", apiStr+"/tiff", nil)
+	meta, _, err := dvid.ReadTIFFVolume(bytes.NewBuffer(tiff), nil)
+	if err != nil {
+		t.Fatalf("unable to read returned tiff: %v\n", err)
+	}
+	if !reflect.DeepEqual(meta.VoxelSize, grayscale.Properties.VoxelSize) {
+		t.Fatalf("expected tiff voxel size %v, got %v\n", grayscale.Properties.VoxelSize, meta.VoxelSize)
+	}
+
+	// POST block-aligned volumes in each format and read them back as raw voxels.
+	blockApi := fmt.Sprintf("%snode/%s/grayscale/raw/0_1_2/64_64_32/32_0_32", server.WebAPIPath, uuid)
+	for _, format := range []string{dvid.VolumeTIFF, dvid.VolumeNRRD} {
+		newData := dvid.RandomBytes(64 * 64 * 32)
+		meta := dvid.VolumeMetadata{Type: dvid.T_uint8, NumChannels: 1, Size: dvid.Point3d{64, 64, 32}}
+		var buf bytes.Buffer
+		if format == dvid.VolumeTIFF {
+			err = dvid.WriteTIFFVolume(&buf, meta, newData)
+		} else {
+			err = dvid.WriteNRRDVolume(&buf, meta, newData)
+		}
+		if err != nil {
+			t.Fatalf("unable to write %s: %v\n", format, err)
+		}
+		server.TestHTTP(t, "POST", blockApi+"/"+format, &buf)
+		if returned := server.TestHTTP(t, "GET", blockApi, nil); !bytes.Equal(returned, newData) {
+			t.Fatalf("voxels POSTed as %s not returned\n", format)
+		}
+	}
+
+	// a volume whose size doesn't match the URL should be rejected.
+	var buf bytes.Buffer
+	meta = dvid.VolumeMetadata{Type: dvid.T_uint8, NumChannels: 1, Size: dvid.Point3d{32, 64, 32}}
+	if err := dvid.WriteNRRDVolume(&buf, meta, make([]byte, 32*64*32)); err != nil {
+		t.Fatalf("unable to write nrrd: %v\n", err)
+	}
+	server.TestBadHTTP(t, "POST", blockApi+"/nrrd", &buf)
+}
+
+// Run with -race to check that adjustment settings are safely shared by POST and GET.
+func TestConcurrentContrastAdjustments(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	makeGrayscale(uuid, t, "grayscale")
+	apiStr := fmt.Sprintf("%snode/%s/grayscale/adjustments", server.WebAPIPath, uuid)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				url := fmt.Sprintf("%s?low=%d&high=%d&compute=false", apiStr, i+j%5, 90+i)
+				if resp := server.TestHTTPResponse(t, "POST", url, nil); resp.Code != http.StatusOK {
+					t.Errorf("Bad status %d on POST %q: %s\n", resp.Code, url, resp.Body.String())
+				}
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if resp := server.TestHTTPResponse(t, "GET", apiStr, nil); resp.Code != http.StatusOK {
+					t.Errorf("Bad status %d on GET adjustments: %s\n", resp.Code, resp.Body.String())
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	var status struct {
+		LowPercentile, HighPercentile float64
+	}
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", apiStr, nil), &status); err != nil {
+		t.Fatalf("Unable to parse adjustments status: %v\n", err)
+	}
+	if status.LowPercentile < 0 || status.LowPercentile > 7 || status.HighPercentile < 90 || status.HighPercentile > 93 {
+		t.Fatalf("Bad adjustments after concurrent POSTs: %v\n", status)
+	}
+}
+
+func TestGrayscaleContrastAdjustments(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	makeGrayscale(uuid, t, "grayscale")
+	vol := testVolume{
+		data:   make([]byte, 64*64*64),
+		offset: dvid.Point3d{0, 0, 0},
+		size:   dvid.Point3d{64, 64, 64},
+	}
+	// Each z slice has 100 intensities starting at 10 + z.
+	for z := 0; z < 64; z++ {
+		for i := 0; i < 64*64; i++ {
+			vol.data[z*64*64+i] = byte(10 + z + i%100)
+		}
+	}
+	vol.put(t, uuid, "grayscale")
+
+	apiStr := fmt.Sprintf("%snode/%s/grayscale/", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", apiStr+"adjustments?low=1&high=99", nil)
+	if err := datastore.BlockOnUpdating(uuid, "grayscale"); err != nil {
+		t.Fatalf("Error blocking on adjustments of grayscale: %v\n", err)
+	}
+	var status struct {
+		LowPercentile, HighPercentile float64
+		Computing                     bool
+		NumSlices                     int
+		MinZ, MaxZ                    int32
+	}
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", apiStr+"adjustments", nil), &status); err != nil {
+		t.Fatalf("Unable to parse adjustments status: %v\n", err)
+	}
+	if status.Computing || status.NumSlices != 64 || status.MinZ != 0 || status.MaxZ != 63 || status.LowPercentile != 1 || status.HighPercentile != 99 {
+		t.Fatalf("Bad adjustments status: %v\n", status)
+	}
+	var adj SliceAdjustment
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", apiStr+"adjustments/5", nil), &adj); err != nil {
+		t.Fatalf("Unable to parse slice adjustment: %v\n", err)
+	}
+	if adj.Z != 5 || adj.Low != 15 || adj.High != 113 || adj.Histogram[15] != 41 {
+		t.Fatalf("Bad adjustment for slice 5: z %d, low %d, high %d, histogram[15] %d\n", adj.Z, adj.Low, adj.High, adj.Histogram[15])
+	}
+	if resp := server.TestHTTPResponse(t, "GET", apiStr+"adjustments/100", nil); resp.Code != 404 {
+		t.Fatalf("Expected 404 for slice without histogram, got %d\n", resp.Code)
+	}
+
+	getGray := func(url string) *image.Gray {
+		img, err := png.Decode(bytes.NewBuffer(server.TestHTTP(t, "GET", url, nil)))
+		if err != nil {
+			t.Fatalf("Unable to decode image from %q: %v\n", url, err)
+		}
+		gray, ok := img.(*image.Gray)
+		if !ok {
+			t.Fatalf("Expected gray image from %q, got %T\n", url, img)
+		}
+		return gray
+	}
+	checkRange := func(pix []uint8, expectedMin, expectedMax uint8) {
+		minV, maxV := uint8(255), uint8(0)
+		for _, v := range pix {
+			if v < minV {
+				minV = v
+			}
+			if v > maxV {
+				maxV = v
+			}
+		}
+		if minV != expectedMin || maxV != expectedMax {
+			t.Fatalf("Expected intensity range %d-%d, got %d-%d\n", expectedMin, expectedMax, minV, maxV)
+		}
+	}
+
+	// XY slice without normalization keeps the original intensities.
+	checkRange(getGray(apiStr+"raw/xy/64_64/0_0_5").Pix, 15, 114)
+	checkRange(getGray(apiStr+"raw/xy/64_64/0_0_5?normalize=false").Pix, 15, 114)
+
+	// Normalized XY and XZ slices are stretched per z.
+	checkRange(getGray(apiStr+"raw/xy/64_64/0_0_5?normalize=true").Pix, 0, 255)
+	xz := getGray(apiStr + "raw/xz/64_64/0_0_0")
+	normalizedXZ := getGray(apiStr + "raw/xz/64_64/0_0_0?normalize=true")
+	for z := 0; z < 64; z++ {
+		row := xz.Pix[z*xz.Stride : z*xz.Stride+64]
+		checkRange(row, byte(10+z), byte(10+z+63))
+		// Slice z maps its 1st percentile 10+z to 0 and its 99th percentile 108+z to 255.
+		for x, v := range normalizedXZ.Pix[z*normalizedXZ.Stride : z*normalizedXZ.Stride+64] {
+			expected := (int(row[x]) - (10 + z)) * 255 / 98
+			if expected > 255 {
+				expected = 255
+			}
+			if int(v) != expected {
+				t.Fatalf("Normalized XZ voxel (%d,%d) expected %d, got %d\n", x, z, expected, v)
+			}
+		}
+	}
+	clahe := getGray(apiStr + "isotropic/xy/64_64/0_0_5?normalize=clahe")
+	if clahe.Rect.Dx() != 64 || clahe.Rect.Dy() != 64 {
+		t.Fatalf("Expected 64x64 CLAHE image, got %v\n", clahe.Rect)
+	}
+	server.TestBadHTTP(t, "GET", apiStr+"raw/xy/64_64/0_0_5?normalize=gamma", nil)
+}
+
+func TestCLAHE(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, 40, 30))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(100 + i%20)
+	}
+	dst := CLAHE(src, 4, 4.0)
+	if !dst.Rect.Eq(src.Rect) {
+		t.Fatalf("Expected CLAHE image bounds %v, got %v\n", src.Rect, dst.Rect)
+	}
+	// Contrast of the narrow intensity range should be enhanced.
+	var minV, maxV uint8 = 255, 0
+	for _, v := range dst.Pix {
+		if v < minV {
+			minV = v
+		}
+		if v > maxV {
+			maxV = v
+		}
+	}
+	if int(maxV)-int(minV) <= 19 {
+		t.Fatalf("Expected CLAHE to increase contrast of range 19, got %d-%d\n", minV, maxV)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"sync"
 
 	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/downres"
 	"github.com/janelia-flyem/dvid/dvid"
 	"github.com/janelia-flyem/dvid/server"
 	"github.com/janelia-flyem/dvid/storage"
@@ -106,6 +107,8 @@ type putOperation struct {
 	version  dvid.VersionID
 	mutate   bool   // if false, we just ingest without needing to GET previous value
 	mutID    uint64 // should be unique within a server's uptime.
+
+	downresMut *downres.Mutation // nil if no lower-resolution scales
 }
 
 type patchGeo struct {
@@ -178,6 +181,8 @@ func (d *Data) PutVoxels(v dvid.VersionID, mutID uint64, vox *Voxels, roiname dv
 	voxstartpt := vox.Geometry.StartPoint()
 	voxendpt := vox.Geometry.EndPoint()
 
+	downresMut := d.newDownresMutation(v, mutID)
+
 	// Iterate through index space for this data.
 	for it, err := vox.NewIndexIterator(d.BlockSize()); err == nil && it.Valid(); it.NextSpan() {
 		i0, i1, err := it.IndexSpan()
@@ -254,7 +259,7 @@ func (d *Data) PutVoxels(v dvid.VersionID, mutID uint64, vox *Voxels, roiname dv
 			}
 
 			kv := &storage.TKeyValue{K: NewTKey(&curIndex)}
-			putOp := &putOperation{vox, curIndex, v, mutate, mutID}
+			putOp := &putOperation{vox, curIndex, v, mutate, mutID, downresMut}
 			op := &storage.ChunkOp{putOp, nil}
 			putrequests++
 			d.PutChunk(&storage.Chunk{op, kv}, hasbuffer, patchgeo, finishedRequests)
@@ -267,11 +272,16 @@ func (d *Data) PutVoxels(v dvid.VersionID, mutID uint64, vox *Voxels, roiname dv
 			err = errjob
 		}
 	}
+	if downresMut != nil {
+		if derr := downresMut.Execute(); derr != nil && err == nil {
+			err = derr
+		}
+	}
 	return err
 }
 
 // PutBlocks stores blocks of data in a span along X
-func (d *Data) PutBlocks(v dvid.VersionID, mutID uint64, start dvid.ChunkPoint3d, span int, data io.ReadCloser, mutate bool) error {
+func (d *Data) PutBlocks(v dvid.VersionID, mutID uint64, start dvid.ChunkPoint3d, span int, data io.ReadCloser, mutate bool) (err error) {
 	batcher, err := datastore.GetKeyValueBatcher(d)
 	if err != nil {
 		return err
@@ -280,6 +290,15 @@ func (d *Data) PutBlocks(v dvid.VersionID, mutID uint64, start dvid.ChunkPoint3d
 	ctx := datastore.NewVersionedCtx(d, v)
 	batch := batcher.NewBatch(ctx)
 
+	downresMut := d.newDownresMutation(v, mutID)
+	if downresMut != nil {
+		defer func() {
+			if derr := downresMut.Execute(); derr != nil && err == nil {
+				err = derr
+			}
+		}()
+	}
+
 	// Read blocks from the stream until we can output a batch put.
 	const BatchSize = 1000
 	var readBlocks int
@@ -325,6 +344,13 @@ func (d *Data) PutBlocks(v dvid.VersionID, mutID uint64, start dvid.ChunkPoint3d
 
 		// Write the new block
 		batch.Put(tk, serialization)
+		if downresMut != nil {
+			blockData := make([]byte, len(buf))
+			copy(blockData, buf)
+			if err := downresMut.BlockMutated(zyx.ToIZYXString(), blockData); err != nil {
+				return err
+			}
+		}
 
 		// Notify any subscribers that you've changed block.
 		var event string
@@ -520,6 +546,9 @@ func (d *Data) putChunk(chunk *storage.Chunk, hasbuffer bool, patchgeo *patchGeo
 	}
 	ready <- nil
 	callback()
+	if err == nil && op.downresMut != nil {
+		err = op.downresMut.BlockMutated(op.indexZYX.ToIZYXString(), block.V)
+	}
 }
 
 // Writes a XY image into the blocks that intersect it.  This function assumes the
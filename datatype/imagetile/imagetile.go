@@ -59,12 +59,24 @@ $ dvid repo <UUID> new imagetile <data name> <settings...>
 
 	Configuration Settings (case-insensitive keys)
 
-	Format         "lz4", "jpg", or "png" (default).  In the case of "lz4", decoding/encoding is done at
-					  tile request time and is a better choice if you primarily ask for arbitrary sized images
-					  (via GET .../raw/... or .../isotropic/...) instead of tiles (via GET .../tile/...)
+	Format         "lz4", "jpg", "png" (default), "webp", or "webp-lossy".  In the case of "lz4",
+					  decoding/encoding is done at tile request time and is a better choice if you primarily
+					  ask for arbitrary sized images (via GET .../raw/... or .../isotropic/...) instead of
+					  tiles (via GET .../tile/...).  "webp" stores lossless WebP tiles while "webp-lossy"
+					  stores lossy WebP tiles encoded at the given Quality.
+	Quality        Quality of "jpg" and "webp-lossy" encoding, 1-100 where higher is better.
+					  Default is 80.
 	Versioned      "true" or "false" (default)
 	Source         Name of uint8blk data instance if using the tile "generate" command below.
 	Placeholder    Bool ("false", "true", "0", or "1").  Return placeholder tile if missing.
+	Lazy           Bool ("false", "true", "0", or "1").  If true, a missing tile is computed from
+					  Source on its first request and stored for later requests, so "generate" need
+					  not be run.  If no metadata has been set, a default tile spec covering Source
+					  is used.  Sync to Source (see POST .../sync) to invalidate stored tiles when
+					  Source blocks are written.
+	MaxLazyTiles   Maximum number of lazily computed tiles to keep stored, evicting the least
+					  recently used tiles first.  Only tiles computed since the server started are
+					  counted.  Default 0 keeps all tiles.
 
 
 $ dvid node <UUID> <data name> generate [settings]
@@ -195,6 +207,26 @@ POST <api URL>/node/<UUID>/<data name>/metadata
 	thereby defining the extent of the tiled volume when coupled with level "0" tile sizes.
 
 
+POST <api URL>/node/<UUID>/<data name>/sync?<options>
+
+	Establishes the source imageblk instance whose block writes invalidate tiles of a Lazy
+	imagetile.  Expects JSON to be POSTed with the following format:
+
+	{ "sync": "grayscale" }
+
+	To delete syncs, pass an empty string of names with query string "replace=true":
+
+	{ "sync": "" }
+
+	Each written block of the synced instance deletes the stored tiles at all scales and
+	planes that intersect it, and these tiles are recomputed on their next request.
+
+	POST Query-string Options:
+
+	replace    Set to "true" if you want passed syncs to replace and not be appended to current syncs.
+			   Default operation is false.
+
+
 GET  <api URL>/node/<UUID>/<data name>/tile/<dims>/<scaling>/<tile coord>[?noblanks=true]
 POST
 	Retrieves or adds tile of named data within a version node.  This GET call should be the fastest
@@ -202,12 +234,19 @@ POST
 	compression format, whereas arbitrary geometry calls require the DVID server to stitch images
 	together.
 
-	The returned image format is dictated by the imagetile encoding.  PNG tiles are returned
-	if internal encoding is either lz4 or png.  JPG tiles are returned if internal encoding is JPG.
+	By default, the returned image format is dictated by the imagetile encoding.  PNG tiles
+	are returned if internal encoding is either lz4 or png.  JPG tiles are returned if internal
+	encoding is JPG, and WebP tiles are returned for webp or webp-lossy encodings.  If the
+	request's Accept header does not accept the stored format, the tile is re-encoded into
+	the most preferred of WebP, PNG, or JPG given by the Accept header.  Stored tiles are
+	returned without re-encoding unless a different format or a quality is requested.
 	The only reason to use lz4 for internal encoding is if the majority of endpoint use for
 	the data instance is via the "raw" endpoint where many tiles need to be stitched before
 	sending the requested image back.
 
+	If the imagetile is Lazy, a tile that hasn't been stored is computed from the source data
+	on the GET, stored, and then returned.
+
 	Note on POSTs: The data of the body in the POST is assumed to match the data instance's 
 	chosen compression and tile sizes.  Currently, no checks are performed to make sure the
 	POSTed data meets the specification.
@@ -230,6 +269,12 @@ POST
 
   	noblanks	  (only GET) If true, any tile request for tiles outside the currently stored extents
   				  will return a blank image.
+  	format        (only GET) "png", "jpg", or "webp" overrides the format given by the Accept header.
+  	quality       (only GET) Re-encodes the tile at the given quality, 1-100 where higher is better.
+  				  Applies to "jpg" and "webp" output, where a quality makes WebP output lossy.
+  	normalize     (only GET) "true" or "clahe" normalizes tile contrast using the per-Z-slice
+  				  histograms of the 8-bit Source.  See the "normalize" option and POST .../adjustments
+  				  of the imageblk datatype.
 
 
 GET  <api URL>/node/<UUID>/<data name>/tilekey/<dims>/<scaling>/<tile coord>
@@ -280,6 +325,11 @@ GET  <api URL>/node/<UUID>/<data name>/raw/<dims>/<size>/<offset>[/<format>]
 	format        "png", "jpg" (default: "png")
 					jpg allows lossy quality setting, e.g., "jpg:80"
 
+	Query-string options:
+
+	normalize     "true" or "clahe" normalizes image contrast using the per-Z-slice histograms
+					of the 8-bit Source.  See the "normalize" option of the imageblk datatype.
+
 GET  <api URL>/node/<UUID>/<data name>/isotropic/<dims>/<size>/<offset>[/<format>]
 
 	Retrieves isotropic image of named data within a version node using the precomputed imagetile.
@@ -304,6 +354,11 @@ GET  <api URL>/node/<UUID>/<data name>/isotropic/<dims>/<size>/<offset>[/<format
 	format        "png", "jpg" (default: "png")
 					jpg allows lossy quality setting, e.g., "jpg:80"
 
+	Query-string options:
+
+	normalize     "true" or "clahe" normalizes image contrast using the per-Z-slice histograms
+					of the 8-bit Source.  See the "normalize" option of the imageblk datatype.
+
 `
 
 var (
@@ -373,10 +428,21 @@ func (dtype *Type) NewDataService(uuid dvid.UUID, id dvid.InstanceID, name dvid.
 			format = PNG
 		case "jpg":
 			format = JPG
+		case "webp":
+			format = WEBP
+		case "webp-lossy":
+			format = WEBPLossy
 		default:
-			return nil, fmt.Errorf("Unknown encoding specified: '%s' (should be 'lz4', 'png', or 'jpg'", encoding)
+			return nil, fmt.Errorf("Unknown encoding specified: '%s' (should be 'lz4', 'png', 'jpg', 'webp', or 'webp-lossy'", encoding)
 		}
 	}
+	quality, found, err := c.GetInt("Quality")
+	if err != nil {
+		return nil, err
+	}
+	if found && (quality < 1 || quality > 100) {
+		return nil, fmt.Errorf("Quality must be 1-100, got %d", quality)
+	}
 
 	// Compression is determined by encoding.  Inform user if there's a discrepancy.
 	var compression string
@@ -385,7 +451,7 @@ func (dtype *Type) NewDataService(uuid dvid.UUID, id dvid.InstanceID, name dvid.
 		compression = "lz4"
 	case PNG:
 		compression = "none"
-	case JPG:
+	case JPG, WEBP, WEBPLossy:
 		compression = "none"
 	}
 	compressConfig, found, err := c.GetString("Compression")
@@ -398,6 +464,19 @@ func (dtype *Type) NewDataService(uuid dvid.UUID, id dvid.InstanceID, name dvid.
 	}
 	c.Set("Compression", compression)
 
+	// See if tiles should be generated on demand.
+	lazy, _, err := c.GetBool("Lazy")
+	if err != nil {
+		return nil, err
+	}
+	maxLazyTiles, _, err := c.GetInt("MaxLazyTiles")
+	if err != nil {
+		return nil, err
+	}
+	if lazy && sourcename == "" {
+		return nil, fmt.Errorf("Lazy imagetile requires a Source data instance")
+	}
+
 	// Initialize the imagetile data
 	basedata, err := datastore.NewDataService(dtype, uuid, id, name, c)
 	if err != nil {
@@ -406,9 +485,12 @@ func (dtype *Type) NewDataService(uuid dvid.UUID, id dvid.InstanceID, name dvid.
 	data := &Data{
 		Data: basedata,
 		Properties: Properties{
-			Source:      dvid.InstanceName(sourcename),
-			Placeholder: placeholder,
-			Encoding:    format,
+			Source:       dvid.InstanceName(sourcename),
+			Placeholder:  placeholder,
+			Encoding:     format,
+			Quality:      quality,
+			Lazy:         lazy,
+			MaxLazyTiles: maxLazyTiles,
 		},
 	}
 	return data, nil
@@ -491,9 +573,11 @@ func (d *Data) SetMetadata(uuid dvid.UUID, jsonBytes []byte) error {
 		return err
 	}
 
+	d.Lock()
 	d.Levels = tileSpec
 	d.MinTileCoord = config.MinTileCoord
 	d.MaxTileCoord = config.MaxTileCoord
+	d.Unlock()
 	if err := datastore.SaveDataByUUID(uuid, d); err != nil {
 		return err
 	}
@@ -565,6 +649,8 @@ const (
 	LZ4 Format = iota
 	PNG
 	JPG
+	WEBP      // lossless WebP
+	WEBPLossy // lossy WebP using Quality
 )
 
 func (f Format) String() string {
@@ -575,6 +661,10 @@ func (f Format) String() string {
 		return "png"
 	case JPG:
 		return "jpeg"
+	case WEBP:
+		return "webp"
+	case WEBPLossy:
+		return "webp-lossy"
 	default:
 		return fmt.Sprintf("format %d", f)
 	}
@@ -605,14 +695,34 @@ type Properties struct {
 	// Encoding describes encoding of the stored tile.  See imagetile.Format
 	Encoding Format
 
-	// Quality is optional quality of encoding for jpeg, 1-100, higher is better.
+	// Quality is optional quality of encoding for jpeg and lossy webp, 1-100, higher is better.
 	Quality int
+
+	// Lazy, when true, generates a missing tile from the Source on its first request and
+	// stores it for later requests.
+	Lazy bool
+
+	// MaxLazyTiles is the maximum number of lazily generated tiles kept in storage, where
+	// the least recently used tiles are evicted first.  Zero means no limit.
+	MaxLazyTiles int
 }
 
 // Data embeds the datastore's Data and extends it with voxel-specific properties.
 type Data struct {
 	*datastore.Data
 	Properties
+
+	// Keep track of sync operations that could be invalidating lazy tiles.
+	datastore.Updater
+
+	lazyMu    sync.Mutex
+	lazyCache *tileCache
+
+	tileGenMu sync.Mutex
+	tileGens  map[string]*tileGen // invalidation generations of tiles being generated
+
+	syncCh   chan datastore.SyncMessage
+	syncDone chan *sync.WaitGroup
 }
 
 // CopyPropertiesFrom copies the data instance-specific properties from a given
@@ -641,6 +751,8 @@ func (p *Properties) copyImmutable(p2 *Properties) {
 	p.Placeholder = p2.Placeholder
 	p.Encoding = p2.Encoding
 	p.Quality = p2.Quality
+	p.Lazy = p2.Lazy
+	p.MaxLazyTiles = p2.MaxLazyTiles
 }
 
 // Returns the bounds in voxels for a given tile.
@@ -880,7 +992,8 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 			}
 
 		case "get":
-			if d.Levels == nil || len(d.Levels) == 0 {
+			levels := d.levels()
+			if len(levels) == 0 {
 				server.BadRequest(w, r, "tile metadata for imagetile %q was not set\n", d.DataName())
 				return
 			}
@@ -891,7 +1004,7 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 			}{
 				d.MinTileCoord,
 				d.MaxTileCoord,
-				d.Levels,
+				levels,
 			}
 			jsonBytes, err := json.Marshal(metadata)
 			if err != nil {
@@ -903,6 +1016,17 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 		}
 		timedLog.Infof("HTTP %s: metadata (%s)", r.Method, r.URL)
 
+	case "sync":
+		if action != "post" {
+			server.BadRequest(w, r, "Only POST allowed to sync endpoint")
+			return
+		}
+		replace := r.URL.Query().Get("replace") == "true"
+		if err := datastore.SetSyncByJSON(d, uuid, replace, r.Body); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+
 	case "tile":
 		switch action {
 		case "post":
@@ -971,7 +1095,12 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 			server.BadRequest(w, r, "Cannot construct imagetile for non-voxels data: %s", d.Source)
 			return
 		}
-		img, err := d.GetImage(ctx, src, slice, parts[3] == "isotropic")
+		normalize := r.URL.Query().Get("normalize")
+		if err := imageblk.ValidNormalize(normalize); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		img, err := d.GetImage(ctx, src, slice, parts[3] == "isotropic", normalize)
 		if err != nil {
 			server.BadRequest(w, r, err)
 			return
@@ -994,13 +1123,14 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 
 // GetImage returns an image given a 2d orthogonal image description.  Since imagetile tiles
 // have precomputed XY, XZ, and YZ orientations, reconstruction of the desired image should
-// be much faster than computing the image from voxel blocks.
-func (d *Data) GetImage(ctx storage.Context, src *imageblk.Data, geom dvid.Geometry, isotropic bool) (*dvid.Image, error) {
+// be much faster than computing the image from voxel blocks.  If normalize is non-empty,
+// the image contrast is normalized using the source's adjustments (see imageblk.NormalizeImage).
+func (d *Data) GetImage(ctx storage.Context, src *imageblk.Data, geom dvid.Geometry, isotropic bool, normalize string) (*dvid.Image, error) {
 	// Iterate through tiles that intersect our geometry.
-	if d.Levels == nil || len(d.Levels) == 0 {
-		return nil, ErrNoMetadataSet
+	if err := d.checkLevels(ctx); err != nil {
+		return nil, err
 	}
-	levelSpec := d.Levels[0]
+	levelSpec := d.levels()[0]
 	minSlice, err := dvid.Isotropy2D(src.VoxelSize, geom, isotropic)
 	if err != nil {
 		return nil, err
@@ -1064,6 +1194,12 @@ func (d *Data) GetImage(ctx storage.Context, src *imageblk.Data, geom dvid.Geome
 	}
 	wg.Wait()
 
+	if normalize != "" {
+		dst, err = src.NormalizeImage(ctx.VersionID(), dst, slice, minSlice.StartPoint().Value(2), 1, normalize)
+		if err != nil {
+			return nil, err
+		}
+	}
 	if isotropic {
 		dstW := int(geom.Size().Value(0))
 		dstH := int(geom.Size().Value(1))
@@ -1099,8 +1235,8 @@ func (d *Data) PostTile(ctx storage.Context, w http.ResponseWriter, r *http.Requ
 // ServeTile returns a tile with appropriate Content-Type set.
 func (d *Data) ServeTile(ctx storage.Context, w http.ResponseWriter, r *http.Request, parts []string) error {
 
-	if d.Levels == nil || len(d.Levels) == 0 {
-		return ErrNoMetadataSet
+	if err := d.checkLevels(ctx); err != nil {
+		return err
 	}
 	tileReq, err := d.ParseTileReq(r, parts)
 
@@ -1114,6 +1250,43 @@ func (d *Data) ServeTile(ctx storage.Context, w http.ResponseWriter, r *http.Req
 	if len(parts) >= 8 {
 		formatStr = parts[7]
 	}
+	if queryStrings.Get("format") != "" {
+		formatStr = queryStrings.Get("format")
+	}
+	qualityStr := queryStrings.Get("quality")
+	if fmtParts := strings.SplitN(formatStr, ":", 2); len(fmtParts) == 2 {
+		formatStr = fmtParts[0]
+		if qualityStr == "" {
+			qualityStr = fmtParts[1]
+		}
+	}
+	if formatStr == "" {
+		formatStr = negotiateTileFormat(r.Header.Get("Accept"), d.Encoding)
+	}
+	switch formatStr {
+	case "png", "webp":
+	case "jpg", "jpeg":
+		formatStr = "jpeg"
+	default:
+		return fmt.Errorf("unsupported tile format %q, must be png, jpg, or webp", formatStr)
+	}
+	if qualityStr != "" {
+		quality, err := strconv.Atoi(qualityStr)
+		if err != nil || quality < 1 || quality > 100 {
+			return fmt.Errorf("bad tile quality %q, must be 1-100", qualityStr)
+		}
+		if formatStr != "png" {
+			formatStr += ":" + qualityStr
+		}
+	}
+	w.Header().Set("Vary", "Accept")
+	normalize := queryStrings.Get("normalize")
+	if err := imageblk.ValidNormalize(normalize); err != nil {
+		return err
+	}
+	if normalize == "false" {
+		normalize = ""
+	}
 
 	data, err := d.getTileData(ctx, tileReq)
 	if err != nil {
@@ -1132,27 +1305,130 @@ func (d *Data) ServeTile(ctx storage.Context, w http.ResponseWriter, r *http.Req
 		return dvid.WriteImageHttp(w, img, formatStr)
 	}
 
-	switch d.Encoding {
-	case LZ4:
-		var img dvid.Image
-		if err := img.Deserialize(data); err != nil {
+	if normalize != "" {
+		img, err := d.normalizeTile(ctx, tileReq, data, normalize)
+		if err != nil {
 			return err
 		}
-		data, err = img.GetPNG()
-		w.Header().Set("Content-type", "image/png")
-	case PNG:
-		w.Header().Set("Content-type", "image/png")
-	case JPG:
-		w.Header().Set("Content-type", "image/jpeg")
+		return dvid.WriteImageHttp(w, img, formatStr)
 	}
-	if err != nil {
-		server.BadRequest(w, r, err)
+
+	// Return stored tile if it's in the requested format, else re-encode it.
+	if storedType := d.Encoding.mimeType(); storedType != "" && storedType == "image/"+formatStr {
+		w.Header().Set("Content-type", storedType)
+		_, err = w.Write(data)
 		return err
 	}
-	if _, err = w.Write(data); err != nil {
+	img, err := d.decodeTile(data)
+	if err != nil {
 		return err
 	}
-	return nil
+	return dvid.WriteImageHttp(w, img, formatStr)
+}
+
+// normalizeTile returns the image of stored tile data with contrast normalized using
+// the adjustments of the Source.
+func (d *Data) normalizeTile(ctx storage.Context, req TileReq, data []byte, normalize string) (image.Image, error) {
+	src, err := d.getSource(ctx.VersionID())
+	if err != nil {
+		return nil, err
+	}
+	goImg, err := d.decodeTile(data)
+	if err != nil {
+		return nil, err
+	}
+	img, err := dvid.ImageFromGoImage(goImg, src.Values, src.Interpolable)
+	if err != nil {
+		return nil, err
+	}
+	extents, err := d.computeVoxelBounds(req.tile, req.plane, req.scale)
+	if err != nil {
+		return nil, err
+	}
+	zStep := int32(1) << req.scale
+	img, err = src.NormalizeImage(ctx.VersionID(), img, req.plane, extents.MinPoint[2], zStep, normalize)
+	if err != nil {
+		return nil, err
+	}
+	return img.Get(), nil
+}
+
+// mimeType returns the MIME type of stored tiles or an empty string if tiles must be
+// re-encoded before delivery.
+func (f Format) mimeType() string {
+	switch f {
+	case PNG:
+		return "image/png"
+	case JPG:
+		return "image/jpeg"
+	case WEBP, WEBPLossy:
+		return "image/webp"
+	default:
+		return ""
+	}
+}
+
+// negotiateTileFormat returns the tile output format ("png", "jpeg", or "webp") for a request's
+// Accept header, preferring the stored format of the tiles if it's acceptable.
+func negotiateTileFormat(accept string, stored Format) string {
+	storedFormat := "png"
+	if mimeType := stored.mimeType(); mimeType != "" {
+		storedFormat = strings.TrimPrefix(mimeType, "image/")
+	}
+	if accept == "" {
+		return storedFormat
+	}
+
+	// Get quality factors for media ranges with more specific ranges taking precedence.
+	type mediaRange struct {
+		mimeType string
+		q        float64
+	}
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mr := mediaRange{mimeType: strings.ToLower(strings.TrimSpace(params[0])), q: 1}
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					mr.q = q
+				}
+			}
+		}
+		ranges = append(ranges, mr)
+	}
+	acceptQ := func(mimeType string) float64 {
+		q, specificity := 0.0, -1
+		for _, mr := range ranges {
+			var s int
+			switch mr.mimeType {
+			case mimeType:
+				s = 2
+			case "image/*":
+				s = 1
+			case "*/*":
+				s = 0
+			default:
+				continue
+			}
+			if s > specificity {
+				q, specificity = mr.q, s
+			}
+		}
+		return q
+	}
+
+	if acceptQ("image/"+storedFormat) > 0 {
+		return storedFormat
+	}
+	best, bestQ := storedFormat, 0.0
+	for _, format := range []string{"webp", "png", "jpeg"} {
+		if q := acceptQ("image/" + format); q > bestQ {
+			best, bestQ = format, q
+		}
+	}
+	return best
 }
 
 // getTileKey returns the internal key as a hexadecimal string
@@ -1172,7 +1448,8 @@ func (d *Data) getTileKey(ctx storage.Context, w http.ResponseWriter, r *http.Re
 // getTileImage returns a 2d tile image or a placeholder, useful for further stitching before
 // delivery of a final image.
 func (d *Data) getTileImage(ctx storage.Context, req TileReq) (image.Image, error) {
-	if d.Levels == nil || len(d.Levels) == 0 {
+	levels := d.levels()
+	if len(levels) == 0 {
 		return nil, ErrNoMetadataSet
 	}
 	data, err := d.getTileData(ctx, req)
@@ -1182,16 +1459,22 @@ func (d *Data) getTileImage(ctx storage.Context, req TileReq) (image.Image, erro
 
 	if len(data) == 0 {
 		if d.Placeholder {
-			if req.scale < 0 || req.scale >= Scaling(len(d.Levels)) {
+			if req.scale < 0 || req.scale >= Scaling(len(levels)) {
 				return nil, fmt.Errorf("Could not find tile specification at given scale %d", req.scale)
 			}
 			message := fmt.Sprintf("%s Tile coord %s @ scale %d", req.plane, req.tile, req.scale)
-			return dvid.PlaceholderImage(req.plane, d.Levels[req.scale].TileSize, message)
+			return dvid.PlaceholderImage(req.plane, levels[req.scale].TileSize, message)
 		}
 		return nil, nil // Not found
 	}
 
+	return d.decodeTile(data)
+}
+
+// decodeTile returns the image for stored tile data.
+func (d *Data) decodeTile(data []byte) (image.Image, error) {
 	var goImg image.Image
+	var err error
 	switch d.Encoding {
 	case LZ4:
 		var img dvid.Image
@@ -1206,6 +1489,8 @@ func (d *Data) getTileImage(ctx storage.Context, req TileReq) (image.Image, erro
 	case JPG:
 		jpgBuffer := bytes.NewBuffer(data)
 		goImg, err = jpeg.Decode(jpgBuffer)
+	case WEBP, WEBPLossy:
+		goImg, err = dvid.DecodeWebP(bytes.NewBuffer(data))
 	default:
 		return nil, fmt.Errorf("Unknown tile encoding: %s", d.Encoding)
 	}
@@ -1234,12 +1519,18 @@ func (d *Data) getTileData(ctx storage.Context, req TileReq) ([]byte, error) {
 	if err != nil {
 		return nil, fmt.Errorf("Error trying to GET from datastore: %v", err)
 	}
+	if d.Lazy {
+		if len(data) == 0 {
+			return d.generateTile(ctx, req)
+		}
+		d.getLazyCache().touch(cachedTile{ctx.VersionID(), tk})
+	}
 	return data, nil
 }
 
 // getBlankTileData returns zero 2d tile image.
 func (d *Data) getBlankTileImage(req TileReq) (image.Image, error) {
-	levelSpec, found := d.Levels[req.scale]
+	levelSpec, found := d.levels()[req.scale]
 	if !found {
 		return nil, fmt.Errorf("Could not extract tiles for unspecified scale level %d", req.scale)
 	}
@@ -1278,10 +1569,11 @@ type outFunc func(TileReq, *dvid.Image) error
 // Construct all tiles for an image with offset and send to out function.  extractTiles assumes
 // the image and offset are in the XY plane.
 func (d *Data) extractTiles(v *imageblk.Voxels, offset dvid.Point, scale Scaling, outF outFunc) error {
-	if d.Levels == nil || scale < 0 || scale >= Scaling(len(d.Levels)) {
+	levels := d.levels()
+	if levels == nil || scale < 0 || scale >= Scaling(len(levels)) {
 		return fmt.Errorf("Bad scaling level specified: %d", scale)
 	}
-	levelSpec, found := d.Levels[scale]
+	levelSpec, found := levels[scale]
 	if !found {
 		return fmt.Errorf("No scaling specs available for scaling level %d", scale)
 	}
@@ -1330,22 +1622,7 @@ func (d *Data) putTileFunc(versionID dvid.VersionID) (outFunc, error) {
 	ctx := datastore.NewVersionedCtx(d, versionID)
 
 	return func(req TileReq, tile *dvid.Image) error {
-		var err error
-		var data []byte
-
-		switch d.Encoding {
-		case LZ4:
-			var compression dvid.Compression
-			compression, err = dvid.NewCompression(dvid.LZ4, dvid.DefaultCompression)
-			if err != nil {
-				return err
-			}
-			data, err = tile.Serialize(compression, d.Checksum())
-		case PNG:
-			data, err = tile.GetPNG()
-		case JPG:
-			data, err = tile.GetJPEG(d.Quality)
-		}
+		data, err := d.encodeTile(tile)
 		if err != nil {
 			return err
 		}
@@ -1358,6 +1635,28 @@ func (d *Data) putTileFunc(versionID dvid.VersionID) (outFunc, error) {
 	}, nil
 }
 
+// encodeTile returns the tile image encoded for storage using the data's encoding.
+func (d *Data) encodeTile(tile *dvid.Image) ([]byte, error) {
+	switch d.Encoding {
+	case LZ4:
+		compression, err := dvid.NewCompression(dvid.LZ4, dvid.DefaultCompression)
+		if err != nil {
+			return nil, err
+		}
+		return tile.Serialize(compression, d.Checksum())
+	case PNG:
+		return tile.GetPNG()
+	case JPG:
+		return tile.GetJPEG(d.Quality)
+	case WEBP:
+		return tile.GetWebP(0, true)
+	case WEBPLossy:
+		return tile.GetWebP(d.Quality, false)
+	default:
+		return nil, fmt.Errorf("Unknown tile encoding: %s", d.Encoding)
+	}
+}
+
 func (d *Data) ConstructTiles(uuidStr string, tileSpec TileSpec, request datastore.Request) error {
 	config := request.Settings()
 	uuid, versionID, err := datastore.MatchingUUID(uuidStr)
@@ -1416,7 +1715,9 @@ func (d *Data) ConstructTiles(uuidStr string, tileSpec TileSpec, request datasto
 	sizeVolume := maxTiledPt.Sub(minTiledPt).AddScalar(1)
 
 	// Save the current tile specification
+	d.Lock()
 	d.Levels = tileSpec
+	d.Unlock()
 	if err := datastore.SaveDataByUUID(uuid, d); err != nil {
 		return err
 	}
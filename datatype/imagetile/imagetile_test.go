@@ -5,8 +5,12 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"image"
+	"image/png"
 	"io"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"sync"
 	"testing"
@@ -162,7 +166,7 @@ func TestMultiscale2dRepoPersistence(t *testing.T) {
 	if !ok {
 		t.Fatalf("Can't cast imagetile data service into imagetile.Data\n")
 	}
-	oldData := *msdata
+	oldProperties := msdata.Properties
 
 	// Restart test datastore and see if datasets are still there.
 	if err = datastore.SaveDataByUUID(uuid, msdata); err != nil {
@@ -179,8 +183,8 @@ func TestMultiscale2dRepoPersistence(t *testing.T) {
 		t.Errorf("Returned new data instance 2 is not imagetile.Data\n")
 	}
 
-	if !reflect.DeepEqual(oldData.Properties, msdata2.Properties) {
-		t.Errorf("Expected properties %v, got %v\n", oldData.Properties, msdata2.Properties)
+	if !reflect.DeepEqual(oldProperties, msdata2.Properties) {
+		t.Errorf("Expected properties %v, got %v\n", oldProperties, msdata2.Properties)
 	}
 }
 
@@ -371,3 +375,271 @@ func TestTileCheck(t *testing.T) {
 	}
 
 }
+
+const testLazyMetadata = `
+{
+	"MinTileCoord": [0,0,0],
+	"MaxTileCoord": [1,1,1],
+	"Levels": {
+	    "0": {  "Resolution": [10.0, 10.0, 10.0], "TileSize": [32, 32, 32] },
+	    "1": {  "Resolution": [20.0, 20.0, 20.0], "TileSize": [32, 32, 32] }
+	}
+}
+`
+
+// getGrayTile returns the pixels of a PNG tile.
+func getGrayTile(t *testing.T, url string) []uint8 {
+	respData := server.TestHTTP(t, "GET", url, nil)
+	img, err := png.Decode(bytes.NewBuffer(respData))
+	if err != nil {
+		t.Fatalf("Unable to decode tile from %q: %v\n", url, err)
+	}
+	gray, ok := img.(*image.Gray)
+	if !ok {
+		t.Fatalf("Expected gray tile from %q, got %T\n", url, img)
+	}
+	return gray.Pix
+}
+
+func TestLazyTiles(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, v := initTestRepo()
+	makeGrayscale(uuid, t, "grayscale")
+	data := dvid.RandomBytes(64 * 64 * 64)
+	rawURL := fmt.Sprintf("%snode/%s/grayscale/raw/0_1_2/64_64_64/0_0_0", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", rawURL, bytes.NewBuffer(data))
+
+	config := dvid.NewConfig()
+	config.Set("Format", "png")
+	config.Set("Source", "grayscale")
+	config.Set("Lazy", "true")
+	config.Set("MaxLazyTiles", "2")
+	tileservice, err := datastore.NewData(uuid, mstype, "tiles", config)
+	if err != nil {
+		t.Fatalf("Unable to create imagetile instance: %v\n", err)
+	}
+	tiles, ok := tileservice.(*Data)
+	if !ok {
+		t.Fatalf("Can't cast imagetile data service into imagetile.Data\n")
+	}
+	apiStr := fmt.Sprintf("%snode/%s/tiles/", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", apiStr+"metadata", bytes.NewBufferString(testLazyMetadata))
+	server.TestHTTP(t, "POST", apiStr+"sync", bytes.NewBufferString(`{"sync": "grayscale"}`))
+
+	// A missing tile should be computed from the source voxels.
+	pix := getGrayTile(t, apiStr+"tile/xy/0/1_0_10")
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			expected := data[10*64*64+y*64+x+32]
+			if pix[y*32+x] != expected {
+				t.Fatalf("Lazy tile voxel (%d,%d) expected %d, got %d\n", x, y, expected, pix[y*32+x])
+			}
+		}
+	}
+	if pix = getGrayTile(t, apiStr+"tile/xz/1/0_5_0"); len(pix) != 32*32 {
+		t.Fatalf("Expected 32x32 lower resolution lazy tile, got %d pixels\n", len(pix))
+	}
+
+	// Writing source blocks should invalidate the intersecting tiles.
+	server.TestHTTP(t, "POST", rawURL+"?mutate=true", bytes.NewBuffer(bytes.Repeat([]byte{7}, 64*64*64)))
+	if err := datastore.BlockOnUpdating(uuid, "tiles"); err != nil {
+		t.Fatalf("Error blocking on sync of tiles: %v\n", err)
+	}
+	pix = getGrayTile(t, apiStr+"tile/xy/0/1_0_10")
+	for i, value := range pix {
+		if value != 7 {
+			t.Fatalf("Expected invalidated tile to be recomputed with value 7, got %d at pixel %d\n", value, i)
+		}
+	}
+
+	// Only the two most recently used lazy tiles should remain stored.
+	getGrayTile(t, apiStr+"tile/xy/0/0_0_10")
+	getGrayTile(t, apiStr+"tile/xy/0/0_1_10")
+	db, err := datastore.GetKeyValueDB(tiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := datastore.NewVersionedCtx(tiles, v)
+	for _, tile := range []dvid.ChunkPoint3d{{1, 0, 10}, {0, 0, 10}, {0, 1, 10}} {
+		tk, err := NewTKey(tile, dvid.XY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, err := db.Get(ctx, tk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		evicted := tile[0] == 1
+		if evicted && value != nil {
+			t.Errorf("Expected tile %s to be evicted\n", tile)
+		}
+		if !evicted && value == nil {
+			t.Errorf("Expected tile %s to be stored\n", tile)
+		}
+	}
+
+	// Invalidating voxels at negative coordinates shouldn't delete tiles at the origin.
+	batcher, err := datastore.GetKeyValueBatcher(tiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	extents := dvid.Extents3d{MinPoint: dvid.Point3d{-40, -40, 0}, MaxPoint: dvid.Point3d{-1, -1, 20}}
+	if err := tiles.invalidateTiles(v, extents, batcher); err != nil {
+		t.Fatal(err)
+	}
+	tk, err := NewTKey(dvid.ChunkPoint3d{0, 0, 10}, dvid.XY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err := db.Get(ctx, tk); err != nil || value == nil {
+		t.Errorf("Expected tile 0_0_10 to remain after invalidating negative voxels: %v\n", err)
+	}
+
+	// A tile invalidated while being generated from older source data shouldn't be stored.
+	tk, err = NewTKey(dvid.ChunkPoint3d{1, 1, 10}, dvid.XY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tile := cachedTile{v, tk}
+	gen := tiles.startTileGen(tile)
+	extents = dvid.Extents3d{MinPoint: dvid.Point3d{32, 32, 10}, MaxPoint: dvid.Point3d{40, 40, 10}}
+	if err := tiles.invalidateTiles(v, extents, batcher); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := tiles.putGeneratedTile(ctx, tk, []byte("stale tile"), gen)
+	tiles.endTileGen(tile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err := db.Get(ctx, tk); stored || err != nil || value != nil {
+		t.Errorf("Expected tile invalidated during generation to be dropped: %v\n", err)
+	}
+	if stored, err = tiles.putGeneratedTile(ctx, tk, []byte("fresh tile"), tiles.startTileGen(tile)); err != nil || !stored {
+		t.Errorf("Expected tile generated after invalidation to be stored: %v\n", err)
+	}
+	tiles.endTileGen(tile)
+	if len(tiles.tileGens) != 0 {
+		t.Errorf("Expected no tiles being generated, got %d\n", len(tiles.tileGens))
+	}
+}
+
+func TestWebPTiles(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	makeGrayscale(uuid, t, "grayscale")
+	data := dvid.RandomBytes(64 * 64 * 64)
+	rawURL := fmt.Sprintf("%snode/%s/grayscale/raw/0_1_2/64_64_64/0_0_0", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", rawURL, bytes.NewBuffer(data))
+
+	config := dvid.NewConfig()
+	config.Set("Format", "webp")
+	config.Set("Source", "grayscale")
+	config.Set("Lazy", "true")
+	if _, err := datastore.NewData(uuid, mstype, "webptiles", config); err != nil {
+		t.Fatalf("Unable to create imagetile instance: %v\n", err)
+	}
+	apiStr := fmt.Sprintf("%snode/%s/webptiles/", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", apiStr+"metadata", bytes.NewBufferString(testLazyMetadata))
+	tileURL := apiStr + "tile/xy/0/1_0_10"
+
+	getTile := func(url, accept, expectedType string) image.Image {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp := httptest.NewRecorder()
+		server.ServeSingleHTTP(resp, req)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("Bad status %d on GET %q with Accept %q: %s\n", resp.Code, url, accept, resp.Body.String())
+		}
+		if contentType := resp.Header().Get("Content-type"); contentType != expectedType {
+			t.Fatalf("Expected %s from %q with Accept %q, got %s\n", expectedType, url, accept, contentType)
+		}
+		if expectedType == "image/webp" {
+			img, err := dvid.DecodeWebP(resp.Body)
+			if err != nil {
+				t.Fatalf("Unable to decode WebP tile from %q: %v\n", url, err)
+			}
+			return img
+		}
+		img, format, err := image.Decode(resp.Body)
+		if err != nil {
+			t.Fatalf("Unable to decode tile from %q: %v\n", url, err)
+		}
+		if "image/"+format != expectedType {
+			t.Fatalf("Expected %s tile, got %s\n", expectedType, format)
+		}
+		return img
+	}
+	checkTile := func(img image.Image, tolerance int) {
+		gray, ok := img.(*image.Gray)
+		if !ok {
+			t.Fatalf("Expected gray tile, got %T\n", img)
+		}
+		for y := 0; y < 32; y++ {
+			for x := 0; x < 32; x++ {
+				expected := int(data[10*64*64+y*64+x+32])
+				diff := int(gray.Pix[y*32+x]) - expected
+				if diff < -tolerance || diff > tolerance {
+					t.Fatalf("Tile voxel (%d,%d) expected %d +/- %d, got %d\n", x, y, expected, tolerance, gray.Pix[y*32+x])
+				}
+			}
+		}
+	}
+
+	// Stored lossless WebP tiles are returned as-is unless the Accept header excludes them.
+	checkTile(getTile(tileURL, "", "image/webp"), 0)
+	checkTile(getTile(tileURL, "image/webp,image/*;q=0.8", "image/webp"), 0)
+	checkTile(getTile(tileURL, "image/png", "image/png"), 0)
+	checkTile(getTile(tileURL, "image/webp;q=0,image/jpeg;q=0.9,image/png;q=0.5", "image/jpeg"), 255)
+	checkTile(getTile(tileURL+"?format=png", "image/webp", "image/png"), 0)
+
+	// Quality re-encodes the tile with loss.
+	checkTile(getTile(tileURL+"?quality=60", "image/webp", "image/webp"), 255)
+	server.TestBadHTTP(t, "GET", tileURL+"?quality=0", nil)
+	server.TestBadHTTP(t, "GET", tileURL+"?format=gif", nil)
+
+	// Normalized tiles should match normalized images from the source.
+	grayURL := fmt.Sprintf("%snode/%s/grayscale/", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", grayURL+"adjustments?low=5&high=95", nil)
+	if err := datastore.BlockOnUpdating(uuid, "grayscale"); err != nil {
+		t.Fatalf("Error blocking on adjustments of grayscale: %v\n", err)
+	}
+	expected, err := png.Decode(bytes.NewBuffer(server.TestHTTP(t, "GET", grayURL+"raw/xy/32_32/32_0_10?normalize=true", nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	normalized := getTile(tileURL+"?normalize=true&format=png", "", "image/png").(*image.Gray)
+	if !bytes.Equal(normalized.Pix, expected.(*image.Gray).Pix) {
+		t.Fatalf("Normalized tile doesn't match normalized source image\n")
+	}
+	server.TestBadHTTP(t, "GET", tileURL+"?normalize=gamma", nil)
+
+	// Lossy WebP tiles are stored as VP8 bitstreams.
+	config = dvid.NewConfig()
+	config.Set("Format", "webp-lossy")
+	config.Set("Quality", "80")
+	config.Set("Source", "grayscale")
+	config.Set("Lazy", "true")
+	if _, err := datastore.NewData(uuid, mstype, "lossytiles", config); err != nil {
+		t.Fatalf("Unable to create imagetile instance: %v\n", err)
+	}
+	lossyURL := fmt.Sprintf("%snode/%s/lossytiles/", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", lossyURL+"metadata", bytes.NewBufferString(testLazyMetadata))
+	tile := server.TestHTTP(t, "GET", lossyURL+"tile/xy/0/1_0_10", nil)
+	if len(tile) < 16 || string(tile[12:16]) != "VP8 " {
+		t.Fatalf("Expected lossy VP8 WebP tile, got %d bytes\n", len(tile))
+	}
+	checkTile(getTile(lossyURL+"tile/xy/0/1_0_10", "image/webp", "image/webp"), 255)
+}
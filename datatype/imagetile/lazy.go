@@ -0,0 +1,346 @@
+/*
+	This file supports on-demand generation of tiles from the source imageblk.
+*/
+
+package imagetile
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/imageblk"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// cachedTile identifies a stored tile that was lazily generated.
+type cachedTile struct {
+	v  dvid.VersionID
+	tk storage.TKey
+}
+
+func (t cachedTile) key() string {
+	return fmt.Sprintf("%d:%s", t.v, string(t.tk))
+}
+
+// tileCache tracks lazily generated tiles in least recently used order so the number
+// of stored tiles can be bounded.  Only tiles generated since the server started are
+// tracked.
+type tileCache struct {
+	sync.Mutex
+	maxTiles int
+	order    *list.List // front is most recently used
+	elems    map[string]*list.Element
+}
+
+func newTileCache(maxTiles int) *tileCache {
+	return &tileCache{
+		maxTiles: maxTiles,
+		order:    list.New(),
+		elems:    make(map[string]*list.Element),
+	}
+}
+
+// add records a newly generated tile and returns any tiles that should be evicted.
+func (c *tileCache) add(tile cachedTile) (evicted []cachedTile) {
+	c.Lock()
+	defer c.Unlock()
+	if elem, found := c.elems[tile.key()]; found {
+		c.order.MoveToFront(elem)
+		return nil
+	}
+	c.elems[tile.key()] = c.order.PushFront(tile)
+	for c.maxTiles > 0 && c.order.Len() > c.maxTiles {
+		elem := c.order.Back()
+		oldest := elem.Value.(cachedTile)
+		c.order.Remove(elem)
+		delete(c.elems, oldest.key())
+		evicted = append(evicted, oldest)
+	}
+	return
+}
+
+// touch marks a tile as recently used if it is being tracked.
+func (c *tileCache) touch(tile cachedTile) {
+	c.Lock()
+	if elem, found := c.elems[tile.key()]; found {
+		c.order.MoveToFront(elem)
+	}
+	c.Unlock()
+}
+
+// remove stops tracking a tile.
+func (c *tileCache) remove(tile cachedTile) {
+	c.Lock()
+	if elem, found := c.elems[tile.key()]; found {
+		c.order.Remove(elem)
+		delete(c.elems, tile.key())
+	}
+	c.Unlock()
+}
+
+func (d *Data) getLazyCache() *tileCache {
+	d.lazyMu.Lock()
+	defer d.lazyMu.Unlock()
+	if d.lazyCache == nil {
+		d.lazyCache = newTileCache(d.MaxLazyTiles)
+	}
+	return d.lazyCache
+}
+
+// tileGen counts the invalidations of a tile while it is being generated.
+type tileGen struct {
+	gen     uint64
+	pending int // # of generations in progress
+}
+
+// startTileGen notes that a tile is being generated and returns its invalidation
+// generation.  Each call must be followed by endTileGen.
+func (d *Data) startTileGen(tile cachedTile) uint64 {
+	d.tileGenMu.Lock()
+	defer d.tileGenMu.Unlock()
+	if d.tileGens == nil {
+		d.tileGens = make(map[string]*tileGen)
+	}
+	tg, found := d.tileGens[tile.key()]
+	if !found {
+		tg = new(tileGen)
+		d.tileGens[tile.key()] = tg
+	}
+	tg.pending++
+	return tg.gen
+}
+
+func (d *Data) endTileGen(tile cachedTile) {
+	d.tileGenMu.Lock()
+	defer d.tileGenMu.Unlock()
+	if tg, found := d.tileGens[tile.key()]; found {
+		tg.pending--
+		if tg.pending <= 0 {
+			delete(d.tileGens, tile.key())
+		}
+	}
+}
+
+// invalidateTileGen advances the invalidation generation of a tile being generated.
+func (d *Data) invalidateTileGen(tile cachedTile) {
+	d.tileGenMu.Lock()
+	if tg, found := d.tileGens[tile.key()]; found {
+		tg.gen++
+	}
+	d.tileGenMu.Unlock()
+}
+
+// putGeneratedTile stores a generated tile unless the tile was invalidated after the given
+// generation, in which case it may have been computed from stale source data and false
+// is returned.
+func (d *Data) putGeneratedTile(ctx storage.Context, tk storage.TKey, data []byte, gen uint64) (bool, error) {
+	db, err := datastore.GetKeyValueDB(d)
+	if err != nil {
+		return false, err
+	}
+	tile := cachedTile{ctx.VersionID(), tk}
+	d.tileGenMu.Lock()
+	defer d.tileGenMu.Unlock()
+	if tg, found := d.tileGens[tile.key()]; found && tg.gen != gen {
+		return false, nil
+	}
+	if err := db.Put(ctx, tk, data); err != nil {
+		return false, err
+	}
+	evicted := d.getLazyCache().add(tile)
+	for _, tile := range evicted {
+		if err := db.Delete(datastore.NewVersionedCtx(d, tile.v), tile.tk); err != nil {
+			dvid.Errorf("Unable to evict lazy tile from imagetile %q: %v\n", d.DataName(), err)
+		}
+	}
+	return true, nil
+}
+
+// getSource returns the imageblk source of the tiles at the given version.
+func (d *Data) getSource(v dvid.VersionID) (*imageblk.Data, error) {
+	source, err := datastore.GetDataByVersionName(v, d.Source)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot get source %q for imagetile %q: %v", d.Source, d.DataName(), err)
+	}
+	src, ok := source.(*imageblk.Data)
+	if !ok {
+		return nil, fmt.Errorf("Cannot construct imagetile for non-voxels data: %s", d.Source)
+	}
+	return src, nil
+}
+
+// levels returns the tile specification, which may be set concurrently by metadata
+// POSTs or the first request to a lazy imagetile.
+func (d *Data) levels() TileSpec {
+	d.RLock()
+	defer d.RUnlock()
+	return d.Levels
+}
+
+// checkLevels makes sure tile specifications are available, setting a default tile spec
+// from the source for lazy imagetile that hasn't had metadata set.
+func (d *Data) checkLevels(ctx storage.Context) error {
+	if len(d.levels()) != 0 {
+		return nil
+	}
+	if !d.Lazy {
+		return ErrNoMetadataSet
+	}
+	d.lazyMu.Lock()
+	defer d.lazyMu.Unlock()
+	if len(d.levels()) != 0 {
+		return nil
+	}
+	uuid, err := datastore.UUIDFromVersion(ctx.VersionID())
+	if err != nil {
+		return err
+	}
+	tileSpec, err := d.DefaultTileSpec(string(uuid))
+	if err != nil {
+		return err
+	}
+	d.Lock()
+	d.Levels = tileSpec
+	d.Unlock()
+	return datastore.SaveDataByUUID(uuid, d)
+}
+
+// generateTile computes a missing tile from the source data, stores it, and returns the
+// encoded tile.  Tiles at lower resolution scales are downsampled from the source voxels.
+// No data is returned if the tile lies outside the source extents.  A tile invalidated
+// while it was being computed is returned but not stored.
+func (d *Data) generateTile(ctx storage.Context, req TileReq) ([]byte, error) {
+	timedLog := dvid.NewTimeLog()
+	src, err := d.getSource(ctx.VersionID())
+	if err != nil {
+		return nil, err
+	}
+	levelSpec, found := d.levels()[req.scale]
+	if !found {
+		return nil, fmt.Errorf("Could not find tile specification at given scale %d", req.scale)
+	}
+	tileW, tileH, err := req.plane.GetSize2D(levelSpec.TileSize)
+	if err != nil {
+		return nil, err
+	}
+	extents, err := d.computeVoxelBounds(req.tile, req.plane, req.scale)
+	if err != nil {
+		return nil, err
+	}
+	if src.MinPoint != nil && src.MaxPoint != nil {
+		for i := uint8(0); i < 3; i++ {
+			if extents.MaxPoint[i] < src.MinPoint.Value(i) || extents.MinPoint[i] > src.MaxPoint.Value(i) {
+				return nil, nil // tile is outside source extents
+			}
+		}
+	}
+	size := extents.MaxPoint.Sub(extents.MinPoint).AddScalar(1)
+	srcW, srcH, err := req.plane.GetSize2D(size)
+	if err != nil {
+		return nil, err
+	}
+	tk, err := NewTKeyByTileReq(req)
+	if err != nil {
+		return nil, err
+	}
+	tile := cachedTile{ctx.VersionID(), tk}
+	gen := d.startTileGen(tile)
+	defer d.endTileGen(tile)
+
+	slice, err := dvid.NewOrthogSlice(req.plane, extents.MinPoint, dvid.Point2d{srcW, srcH})
+	if err != nil {
+		return nil, err
+	}
+	vox, err := src.NewVoxels(slice, nil)
+	if err != nil {
+		return nil, err
+	}
+	img, err := src.GetImage(ctx.VersionID(), vox, "")
+	if err != nil {
+		return nil, err
+	}
+	if srcW != tileW || srcH != tileH {
+		if img, err = img.ScaleImage(int(tileW), int(tileH)); err != nil {
+			return nil, err
+		}
+	}
+	data, err := d.encodeTile(img)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := d.putGeneratedTile(ctx, tk, data, gen)
+	if err != nil {
+		return nil, err
+	}
+	if !stored {
+		timedLog.Debugf("Dropped %s tile %s @ scale %d for imagetile %q invalidated during generation", req.plane, req.tile, req.scale, d.DataName())
+		return data, nil
+	}
+	timedLog.Debugf("Generated %s tile %s @ scale %d for imagetile %q", req.plane, req.tile, req.scale, d.DataName())
+	return data, nil
+}
+
+// invalidateTiles deletes stored tiles at all scales and planes that intersect the given
+// voxel extents so they are regenerated on their next request.
+func (d *Data) invalidateTiles(v dvid.VersionID, extents dvid.Extents3d, batcher storage.KeyValueBatcher) error {
+	ctx := datastore.NewVersionedCtx(d, v)
+	batch := batcher.NewBatch(ctx)
+	cache := d.getLazyCache()
+	minPt, maxPt := extents.MinPoint, extents.MaxPoint
+	for scale, levelSpec := range d.levels() {
+		// Tile sizes in voxels double with each scale as in computeVoxelBounds().
+		mag := int32(1) << scale
+		tileSize := dvid.Point3d{levelSpec.TileSize[0] * mag, levelSpec.TileSize[1] * mag, levelSpec.TileSize[2] * mag}
+		for _, plane := range []dvid.DataShape{dvid.XY, dvid.XZ, dvid.YZ} {
+			// Tile coordinates are in tiles except along the axis orthogonal to the plane,
+			// which is in voxels.
+			var planeDim int
+			switch {
+			case plane.Equals(dvid.XY):
+				planeDim = 2
+			case plane.Equals(dvid.XZ):
+				planeDim = 1
+			default:
+				planeDim = 0
+			}
+			var tileMin, tileMax dvid.ChunkPoint3d
+			for i := 0; i < 3; i++ {
+				if i == planeDim {
+					tileMin[i], tileMax[i] = minPt[i], maxPt[i]
+				} else {
+					tileMin[i], tileMax[i] = floorDiv(minPt[i], tileSize[i]), floorDiv(maxPt[i], tileSize[i])
+				}
+				if tileMin[i] < 0 {
+					tileMin[i] = 0 // negative tile coordinates are never stored
+				}
+			}
+			for z := tileMin[2]; z <= tileMax[2]; z++ {
+				for y := tileMin[1]; y <= tileMax[1]; y++ {
+					for x := tileMin[0]; x <= tileMax[0]; x++ {
+						tk, err := NewTKey(dvid.ChunkPoint3d{x, y, z}, plane, scale)
+						if err != nil {
+							return err
+						}
+						tile := cachedTile{v, tk}
+						d.invalidateTileGen(tile)
+						batch.Delete(tk)
+						cache.remove(tile)
+					}
+				}
+			}
+		}
+	}
+	return batch.Commit()
+}
+
+// returns a / b rounded toward negative infinity.
+func floorDiv(a, b int32) int32 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
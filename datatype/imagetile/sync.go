@@ -0,0 +1,142 @@
+/*
+	This file supports invalidation of lazily generated tiles when the source changes.
+*/
+
+package imagetile
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/imageblk"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// Number of change messages we can buffer before blocking on sync channel.
+const syncBufferSize = 1000
+
+// InitDataHandlers launches goroutines to handle each imagetile instance's syncs.
+func (d *Data) InitDataHandlers() error {
+	if d.syncCh != nil || d.syncDone != nil {
+		return nil
+	}
+	d.syncCh = make(chan datastore.SyncMessage, syncBufferSize)
+	d.syncDone = make(chan *sync.WaitGroup)
+
+	// Launch handlers of sync events.
+	dvid.Infof("Launching sync event handler for data %q...\n", d.DataName())
+	go d.processEvents()
+	return nil
+}
+
+// Shutdown terminates blocks until syncs are done then terminates background goroutines processing data.
+func (d *Data) Shutdown(wg *sync.WaitGroup) {
+	if d.syncDone != nil {
+		dwg := new(sync.WaitGroup)
+		dwg.Add(1)
+		d.syncDone <- dwg
+		dwg.Wait() // Block until we are done.
+	}
+	wg.Done()
+}
+
+// GetSyncSubs implements the datastore.Syncer interface.  Returns a list of subscriptions
+// to the source imageblk's block changes.
+func (d *Data) GetSyncSubs(synced dvid.Data) (datastore.SyncSubs, error) {
+	if d.syncCh == nil {
+		if err := d.InitDataHandlers(); err != nil {
+			return nil, fmt.Errorf("unable to initialize handlers for data %q: %v\n", d.DataName(), err)
+		}
+	}
+	subs := datastore.SyncSubs{
+		datastore.SyncSub{
+			Event:  datastore.SyncEvent{synced.DataUUID(), imageblk.IngestBlockEvent},
+			Notify: d.DataUUID(),
+			Ch:     d.syncCh,
+		},
+		datastore.SyncSub{
+			Event:  datastore.SyncEvent{synced.DataUUID(), imageblk.MutateBlockEvent},
+			Notify: d.DataUUID(),
+			Ch:     d.syncCh,
+		},
+	}
+	return subs, nil
+}
+
+// If source blocks are written, delete any stored lazy tiles that intersect them.
+func (d *Data) processEvents() {
+	defer func() {
+		if e := recover(); e != nil {
+			msg := fmt.Sprintf("Panic detected on imagetile sync thread: %+v\n", e)
+			dvid.ReportPanic(msg, server.WebServer())
+		}
+	}()
+	batcher, err := datastore.GetKeyValueBatcher(d)
+	if err != nil {
+		dvid.Errorf("Exiting sync goroutine for imagetile %q after source modifications: %v\n", d.DataName(), err)
+		return
+	}
+	var stop bool
+	var wg *sync.WaitGroup
+	for {
+		select {
+		case wg = <-d.syncDone:
+			queued := len(d.syncCh)
+			if queued > 0 {
+				dvid.Infof("Received shutdown signal for %q sync events (%d in queue)\n", d.DataName(), queued)
+				stop = true
+			} else {
+				dvid.Infof("Shutting down sync event handler for instance %q...\n", d.DataName())
+				wg.Done()
+				return
+			}
+		case msg := <-d.syncCh:
+			d.StartUpdate()
+			var index *dvid.IndexZYX
+			switch delta := msg.Delta.(type) {
+			case imageblk.Block:
+				index = delta.Index
+			case imageblk.MutatedBlock:
+				index = delta.Index
+			default:
+				dvid.Criticalf("Cannot sync imagetile from block event.  Got unexpected delta: %v\n", msg)
+			}
+			if index != nil && d.Lazy {
+				if err := d.invalidateBlock(msg.Version, index, batcher); err != nil {
+					dvid.Errorf("Unable to invalidate tiles of imagetile %q for block %s: %v\n", d.DataName(), index, err)
+				}
+			}
+			d.StopUpdate()
+
+			if stop && len(d.syncCh) == 0 {
+				dvid.Infof("Shutting down sync even handler for instance %q after draining sync events.\n", d.DataName())
+				wg.Done()
+				return
+			}
+		}
+	}
+}
+
+// invalidateBlock deletes stored tiles intersecting a block of the source.
+func (d *Data) invalidateBlock(v dvid.VersionID, index *dvid.IndexZYX, batcher storage.KeyValueBatcher) error {
+	if len(d.levels()) == 0 {
+		return nil
+	}
+	src, err := d.getSource(v)
+	if err != nil {
+		return err
+	}
+	blockSize, ok := src.BlockSize().(dvid.Point3d)
+	if !ok {
+		return fmt.Errorf("source %q of imagetile %q does not have 3d blocks", d.Source, d.DataName())
+	}
+	chunkPt := dvid.ChunkPoint3d(*index)
+	extents := dvid.Extents3d{
+		MinPoint: chunkPt.MinPoint(blockSize).(dvid.Point3d),
+		MaxPoint: chunkPt.MaxPoint(blockSize).(dvid.Point3d),
+	}
+	return d.invalidateTiles(v, extents, batcher)
+}
@@ -0,0 +1,141 @@
+package labelmap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+)
+
+// GetArbitraryLabels returns a label image with arbitrary 3D orientation where each pixel
+// is the label of the nearest voxel at the given scale.  The 3d points are in real world
+// space defined by resolution, e.g., nanometer space.  If supervoxels is false, the
+// returned labels are mapped to bodies.
+func (d *Data) GetArbitraryLabels(v dvid.VersionID, tlStr, trStr, blStr, resStr string, scale uint8, supervoxels bool) (*dvid.Image, error) {
+	if scale > d.MaxDownresLevel {
+		return nil, fmt.Errorf("scale %d exceeds max downres level %d of data %q", scale, d.MaxDownresLevel, d.DataName())
+	}
+	arb, err := d.Data.NewArbSliceFromStrings(tlStr, trStr, blStr, resStr, "_")
+	if err != nil {
+		return nil, err
+	}
+	blockSize, ok := d.BlockSize().(dvid.Point3d)
+	if !ok {
+		return nil, fmt.Errorf("block size for data %q should be 3d, not: %s", d.DataName(), d.BlockSize())
+	}
+	var res [3]float64
+	for i := 0; i < 3; i++ {
+		res[i] = float64(d.Properties.VoxelSize[i]) * float64(int32(1)<<scale)
+	}
+
+	// Group the nearest voxel of each pixel by block so each block is read once.
+	type blockPts struct {
+		pts    []dvid.Point3d
+		pixels []int
+	}
+	blocks := make(map[dvid.IZYXString]*blockPts)
+	size := arb.Size()
+	var pixel int
+	for y := int32(0); y < size[1]; y++ {
+		for x := int32(0); x < size[0]; x++ {
+			pt := arb.Point(x, y)
+			var voxel dvid.Point3d
+			for i := 0; i < 3; i++ {
+				voxel[i] = int32(math.Floor(pt[i]/res[i] + 0.5))
+			}
+			izyx := voxel.Chunk(blockSize).(dvid.ChunkPoint3d).ToIZYXString()
+			bp, found := blocks[izyx]
+			if !found {
+				bp = new(blockPts)
+				blocks[izyx] = bp
+			}
+			bp.pts = append(bp.pts, voxel.PointInChunk(blockSize).(dvid.Point3d))
+			bp.pixels = append(bp.pixels, pixel)
+			pixel++
+		}
+	}
+
+	var mapping *SVMap
+	if !supervoxels {
+		if mapping, err = getMapping(d, v); err != nil {
+			return nil, err
+		}
+	}
+	data := make([]byte, int(size[0])*int(size[1])*8)
+	for izyx, bp := range blocks {
+		bcoord, err := izyx.ToChunkPoint3d()
+		if err != nil {
+			return nil, err
+		}
+		block, err := d.GetLabelBlock(v, bcoord, scale)
+		if err != nil {
+			return nil, err
+		}
+		if mapping != nil {
+			if err := modifyBlockMapping(v, block, mapping); err != nil {
+				return nil, err
+			}
+		}
+		for i, label := range block.GetPointLabels(bp.pts) {
+			binary.LittleEndian.PutUint64(data[bp.pixels[i]*8:], label)
+		}
+	}
+	return dvid.ImageFromData(size[0], size[1], data, d.Properties.Values, false)
+}
+
+func (d *Data) handleArb(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
+	// GET <api URL>/node/<UUID>/<data name>/arb/<top left>/<top right>/<bottom left>/<res>[/<format>]
+	if len(parts) < 8 {
+		server.BadRequest(w, r, "%q must be followed by top-left/top-right/bottom-left/res", parts[3])
+		return
+	}
+	if strings.ToLower(r.Method) != "get" {
+		server.BadRequest(w, r, "only GET action allowed for arb endpoint")
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+
+	queryStrings := r.URL.Query()
+	if throttle := queryStrings.Get("throttle"); throttle == "on" || throttle == "true" {
+		if server.ThrottledHTTP(w) {
+			return
+		}
+		defer server.ThrottledOpDone()
+	}
+	scale, err := getScale(queryStrings)
+	if err != nil {
+		server.BadRequest(w, r, "bad scale specified: %v", err)
+		return
+	}
+	supervoxels := queryStrings.Get("supervoxels") == "true"
+	img, err := d.GetArbitraryLabels(ctx.VersionID(), parts[4], parts[5], parts[6], parts[7], scale, supervoxels)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+
+	var formatStr string
+	if len(parts) >= 9 {
+		formatStr = parts[8]
+	}
+	if queryStrings.Get("pseudocolor") == "true" {
+		pseudoColor, err := colorImage(img)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		err = dvid.WriteImageHttp(w, pseudoColor, formatStr)
+	} else {
+		err = dvid.WriteImageHttp(w, img.Get(), formatStr)
+	}
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	timedLog.Infof("HTTP %s: Arbitrary labels (%s)", r.Method, r.URL)
+}
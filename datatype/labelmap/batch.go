@@ -0,0 +1,827 @@
+/*
+	This file supports batches of merge, cleave, and supervoxel split operations that are
+	applied in order as a unit, so other clients never see a partially applied batch in the
+	mutation log or sync notifications.
+*/
+
+package labelmap
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/downres"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/datatype/common/proto"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// BatchOp is a single mutation within a batch.  Exactly one of Merge, Cleave, or
+// SplitSupervoxel should be set.  Any zero CleavedLabel, SplitSupervoxel, or RemainSupervoxel
+// is replaced by a newly allocated label, and mutation IDs are assigned when the batch is applied.
+type BatchOp struct {
+	Merge           *labels.MergeOp
+	Cleave          *labels.CleaveOp
+	SplitSupervoxel *labels.SplitSupervoxelOp
+	SplitRLEs       dvid.RLEs // the split voxels if SplitSupervoxel is set
+}
+
+// batchOpJSON is the JSON representation of a BatchOp, which mirrors the kafka messages
+// sent for each operation type.
+type batchOpJSON struct {
+	Action             string
+	Target             uint64   `json:",omitempty"`
+	Labels             []uint64 `json:",omitempty"`
+	CleavedLabel       uint64   `json:",omitempty"`
+	CleavedSupervoxels []uint64 `json:",omitempty"`
+	Supervoxel         uint64   `json:",omitempty"`
+	SplitSupervoxel    uint64   `json:",omitempty"`
+	RemainSupervoxel   uint64   `json:",omitempty"`
+	Split              []byte   `json:",omitempty"` // binary sparse volume, base64 encoded in JSON
+	MutationID         uint64   `json:",omitempty"`
+}
+
+func (op batchOpJSON) batchOp() (bop BatchOp, err error) {
+	switch op.Action {
+	case "merge":
+		tuple := append(labels.MergeTuple{op.Target}, op.Labels...)
+		var mergeOp labels.MergeOp
+		if mergeOp, err = tuple.Op(); err != nil {
+			return
+		}
+		bop.Merge = &mergeOp
+	case "cleave":
+		bop.Cleave = &labels.CleaveOp{
+			Target:             op.Target,
+			CleavedLabel:       op.CleavedLabel,
+			CleavedSupervoxels: op.CleavedSupervoxels,
+		}
+	case "split-supervoxel":
+		bop.SplitSupervoxel = &labels.SplitSupervoxelOp{
+			Supervoxel:       op.Supervoxel,
+			SplitSupervoxel:  op.SplitSupervoxel,
+			RemainSupervoxel: op.RemainSupervoxel,
+		}
+		if bop.SplitRLEs, err = dvid.ReadRLEs(bytes.NewBuffer(op.Split)); err != nil {
+			err = fmt.Errorf("bad split sparse volume for supervoxel %d: %v", op.Supervoxel, err)
+		}
+	default:
+		err = fmt.Errorf("unknown batch action %q, must be merge, cleave, or split-supervoxel", op.Action)
+	}
+	return
+}
+
+// returns the JSON representation of an applied op without split voxels.
+func (bop BatchOp) resultJSON() batchOpJSON {
+	switch {
+	case bop.Merge != nil:
+		lbls := make([]uint64, 0, len(bop.Merge.Merged))
+		for label := range bop.Merge.Merged {
+			lbls = append(lbls, label)
+		}
+		sort.Slice(lbls, func(i, j int) bool { return lbls[i] < lbls[j] })
+		return batchOpJSON{
+			Action:     "merge",
+			Target:     bop.Merge.Target,
+			Labels:     lbls,
+			MutationID: bop.Merge.MutID,
+		}
+	case bop.Cleave != nil:
+		return batchOpJSON{
+			Action:             "cleave",
+			Target:             bop.Cleave.Target,
+			CleavedLabel:       bop.Cleave.CleavedLabel,
+			CleavedSupervoxels: bop.Cleave.CleavedSupervoxels,
+			MutationID:         bop.Cleave.MutID,
+		}
+	case bop.SplitSupervoxel != nil:
+		return batchOpJSON{
+			Action:           "split-supervoxel",
+			Supervoxel:       bop.SplitSupervoxel.Supervoxel,
+			SplitSupervoxel:  bop.SplitSupervoxel.SplitSupervoxel,
+			RemainSupervoxel: bop.SplitSupervoxel.RemainSupervoxel,
+			MutationID:       bop.SplitSupervoxel.MutID,
+		}
+	}
+	return batchOpJSON{}
+}
+
+// DecodeBatchJSON returns batch operations from a JSON list of operations.
+func DecodeBatchJSON(data []byte) ([]BatchOp, error) {
+	var jsonOps []batchOpJSON
+	if err := json.Unmarshal(data, &jsonOps); err != nil {
+		return nil, fmt.Errorf("bad batch JSON: %v", err)
+	}
+	ops := make([]BatchOp, len(jsonOps))
+	for i, jsonOp := range jsonOps {
+		var err error
+		if ops[i], err = jsonOp.batchOp(); err != nil {
+			return nil, fmt.Errorf("batch op %d: %v", i, err)
+		}
+	}
+	return ops, nil
+}
+
+// DecodeBatchProtobuf returns batch operations from a serialized proto.BatchOps.
+func DecodeBatchProtobuf(data []byte) ([]BatchOp, error) {
+	var pops proto.BatchOps
+	if err := pops.Unmarshal(data); err != nil {
+		return nil, fmt.Errorf("bad batch protobuf: %v", err)
+	}
+	ops := make([]BatchOp, len(pops.Ops))
+	for i, pop := range pops.Ops {
+		if pop.Merge != nil {
+			op := labels.MergeOp{
+				Target: pop.Merge.Target,
+				Merged: make(labels.Set, len(pop.Merge.Merged)),
+			}
+			for _, label := range pop.Merge.Merged {
+				op.Merged[label] = struct{}{}
+			}
+			ops[i].Merge = &op
+		}
+		if pop.Cleave != nil {
+			ops[i].Cleave = &labels.CleaveOp{
+				Target:             pop.Cleave.Target,
+				CleavedLabel:       pop.Cleave.Cleavedlabel,
+				CleavedSupervoxels: pop.Cleave.Cleaved,
+			}
+		}
+		if pop.Svsplit != nil {
+			ops[i].SplitSupervoxel = &labels.SplitSupervoxelOp{
+				Supervoxel:       pop.Svsplit.Supervoxel,
+				SplitSupervoxel:  pop.Svsplit.Splitlabel,
+				RemainSupervoxel: pop.Svsplit.Remainlabel,
+			}
+			var err error
+			if ops[i].SplitRLEs, err = dvid.ReadRLEs(bytes.NewBuffer(pop.Rles)); err != nil {
+				return nil, fmt.Errorf("batch op %d: bad split sparse volume for supervoxel %d: %v", i, pop.Svsplit.Supervoxel, err)
+			}
+		}
+	}
+	return ops, nil
+}
+
+// batchLog buffers mutation log messages so nothing is appended to the data instance's
+// log unless the whole batch succeeds.
+type batchLog struct {
+	storage.WriteLog
+	msgs []batchLogMsg
+}
+
+type batchLogMsg struct {
+	dataID, version dvid.UUID
+	msg             storage.LogMessage
+}
+
+func (bl *batchLog) Append(dataID, version dvid.UUID, msg storage.LogMessage) error {
+	bl.msgs = append(bl.msgs, batchLogMsg{dataID, version, msg})
+	return nil
+}
+
+func (bl *batchLog) flush() error {
+	for _, m := range bl.msgs {
+		if err := bl.WriteLog.Append(m.dataID, m.version, m.msg); err != nil {
+			return err
+		}
+	}
+	bl.msgs = nil
+	return nil
+}
+
+// batchData wraps a labelmap instance so mutation log writes go to a batch buffer.
+type batchData struct {
+	*Data
+	log *batchLog
+}
+
+// GetWriteLog implements storage.LogWritable, returning the batch buffer.
+func (bd batchData) GetWriteLog() storage.WriteLog {
+	if bd.log.WriteLog == nil {
+		return nil
+	}
+	return bd.log
+}
+
+// batchState tracks the supervoxels of each label as a batch is validated, so every
+// operation can be checked against the effects of the operations before it without
+// modifying any data.  Ops needing new labels are given placeholder labels above any
+// existing or given label, which are replaced by allocated labels once the whole batch
+// is valid.
+type batchState struct {
+	d      *Data
+	v      dvid.VersionID
+	svmap  *SVMap
+	labels map[uint64]map[uint64]uint64 // supervoxel voxel counts per label
+	mapped map[uint64]uint64            // supervoxels remapped within the batch
+
+	touchedLabels      labels.Set // labels whose index may be changed by the batch
+	touchedSupervoxels labels.Set // supervoxels whose mapping may be changed by the batch
+
+	nextPlaceholder uint64
+	newLabels       []*uint64 // op fields holding placeholders for new labels
+	givenLabels     []uint64  // labels given for cleaves and splits that may raise the max label
+}
+
+// returns a placeholder for a new label and stores it in the given op field.
+func (s *batchState) newLabel(field *uint64) uint64 {
+	*field = s.nextPlaceholder
+	s.nextPlaceholder++
+	s.newLabels = append(s.newLabels, field)
+	return *field
+}
+
+// returns the supervoxel counts for a label, loading them from the label index if the
+// label hasn't been seen in the batch yet.  The returned map is empty for non-existent labels.
+func (s *batchState) supervoxels(label uint64) (map[uint64]uint64, error) {
+	counts, found := s.labels[label]
+	if found {
+		return counts, nil
+	}
+	idx, err := GetLabelIndex(s.d, s.v, label, false)
+	if err != nil {
+		return nil, err
+	}
+	if idx == nil {
+		counts = make(map[uint64]uint64)
+	} else {
+		counts = idx.GetSupervoxelCounts()
+	}
+	s.labels[label] = counts
+	return counts, nil
+}
+
+func (s *batchState) labelOf(supervoxel uint64) uint64 {
+	if label, found := s.mapped[supervoxel]; found {
+		return label
+	}
+	if label, found := s.svmap.MappedLabel(s.v, supervoxel); found {
+		return label
+	}
+	return supervoxel
+}
+
+func (s *batchState) merge(op *labels.MergeOp) error {
+	if op.Target == 0 {
+		return fmt.Errorf("cannot merge into background label 0")
+	}
+	if len(op.Merged) == 0 {
+		return fmt.Errorf("no labels given to merge into label %d", op.Target)
+	}
+	target, err := s.supervoxels(op.Target)
+	if err != nil {
+		return err
+	}
+	if len(target) == 0 {
+		return fmt.Errorf("can't merge into a non-existent label %d", op.Target)
+	}
+	s.touchedLabels[op.Target] = struct{}{}
+	for label := range op.Merged {
+		if label == 0 {
+			return fmt.Errorf("cannot merge background label 0")
+		}
+		if label == op.Target {
+			return fmt.Errorf("cannot merge label %d into itself", label)
+		}
+		merged, err := s.supervoxels(label)
+		if err != nil {
+			return err
+		}
+		for supervoxel, count := range merged {
+			target[supervoxel] = count
+			s.mapped[supervoxel] = op.Target
+			s.touchedSupervoxels[supervoxel] = struct{}{}
+		}
+		s.labels[label] = make(map[uint64]uint64)
+		s.touchedLabels[label] = struct{}{}
+	}
+	return nil
+}
+
+func (s *batchState) cleave(op *labels.CleaveOp) error {
+	if op.Target == 0 {
+		return fmt.Errorf("cannot cleave background label 0")
+	}
+	if len(op.CleavedSupervoxels) == 0 {
+		return fmt.Errorf("no supervoxels given to cleave from label %d", op.Target)
+	}
+	target, err := s.supervoxels(op.Target)
+	if err != nil {
+		return err
+	}
+	if len(target) == 0 {
+		return fmt.Errorf("cannot cleave non-existent label %d", op.Target)
+	}
+	cleaveSet := make(labels.Set, len(op.CleavedSupervoxels))
+	for _, supervoxel := range op.CleavedSupervoxels {
+		if _, found := target[supervoxel]; !found {
+			return fmt.Errorf("cannot cleave supervoxel %d, which does not exist in label %d", supervoxel, op.Target)
+		}
+		cleaveSet[supervoxel] = struct{}{}
+	}
+	if len(cleaveSet) == len(target) {
+		return fmt.Errorf("cannot cleave all supervoxels from the label %d", op.Target)
+	}
+	if op.CleavedLabel == 0 {
+		s.newLabel(&op.CleavedLabel)
+	} else {
+		cleaved, err := s.supervoxels(op.CleavedLabel)
+		if err != nil {
+			return err
+		}
+		if len(cleaved) != 0 {
+			return fmt.Errorf("cannot cleave into existing label %d", op.CleavedLabel)
+		}
+		s.givenLabels = append(s.givenLabels, op.CleavedLabel)
+	}
+	cleaved := make(map[uint64]uint64, len(cleaveSet))
+	for supervoxel := range cleaveSet {
+		cleaved[supervoxel] = target[supervoxel]
+		delete(target, supervoxel)
+		s.mapped[supervoxel] = op.CleavedLabel
+		s.touchedSupervoxels[supervoxel] = struct{}{}
+	}
+	s.labels[op.CleavedLabel] = cleaved
+	s.touchedLabels[op.Target] = struct{}{}
+	s.touchedLabels[op.CleavedLabel] = struct{}{}
+	return nil
+}
+
+func (s *batchState) splitSupervoxel(op *labels.SplitSupervoxelOp, split dvid.RLEs) error {
+	if op.Supervoxel == 0 {
+		return fmt.Errorf("cannot split background supervoxel 0")
+	}
+	label := s.labelOf(op.Supervoxel)
+	if label == 0 {
+		return fmt.Errorf("cannot split supervoxel %d, which has been split and doesn't exist anymore", op.Supervoxel)
+	}
+	counts, err := s.supervoxels(label)
+	if err != nil {
+		return err
+	}
+	svSize, found := counts[op.Supervoxel]
+	if !found {
+		return fmt.Errorf("supervoxel %d is not in the index of its label %d", op.Supervoxel, label)
+	}
+	splitSize, _ := split.Stats()
+	if splitSize > svSize {
+		return fmt.Errorf("split volume of %d > %d of supervoxel %d", splitSize, svSize, op.Supervoxel)
+	}
+	if op.SplitSupervoxel == 0 {
+		s.newLabel(&op.SplitSupervoxel)
+	} else {
+		s.givenLabels = append(s.givenLabels, op.SplitSupervoxel)
+	}
+	if op.RemainSupervoxel == 0 {
+		s.newLabel(&op.RemainSupervoxel)
+	} else {
+		s.givenLabels = append(s.givenLabels, op.RemainSupervoxel)
+	}
+	blockSize, ok := s.d.BlockSize().(dvid.Point3d)
+	if !ok {
+		return fmt.Errorf("can't do split because block size for instance %s is not 3d: %v", s.d.DataName(), s.d.BlockSize())
+	}
+	if op.Split, err = split.Partition(blockSize); err != nil {
+		return err
+	}
+
+	delete(counts, op.Supervoxel)
+	if splitSize != 0 {
+		counts[op.SplitSupervoxel] = splitSize
+	}
+	if splitSize != svSize {
+		counts[op.RemainSupervoxel] = svSize - splitSize
+	}
+	s.mapped[op.Supervoxel] = 0
+	s.mapped[op.SplitSupervoxel] = label
+	s.mapped[op.RemainSupervoxel] = label
+	s.touchedLabels[label] = struct{}{}
+	s.touchedSupervoxels[op.Supervoxel] = struct{}{}
+	s.touchedSupervoxels[op.SplitSupervoxel] = struct{}{}
+	s.touchedSupervoxels[op.RemainSupervoxel] = struct{}{}
+	return nil
+}
+
+// returns the largest label given in the ops.
+func batchMaxLabel(ops []BatchOp) uint64 {
+	var maxLabel uint64
+	update := func(lbls ...uint64) {
+		for _, label := range lbls {
+			if label > maxLabel {
+				maxLabel = label
+			}
+		}
+	}
+	for _, op := range ops {
+		if op.Merge != nil {
+			update(op.Merge.Target)
+			for label := range op.Merge.Merged {
+				update(label)
+			}
+		}
+		if op.Cleave != nil {
+			update(op.Cleave.Target, op.Cleave.CleavedLabel)
+			update(op.Cleave.CleavedSupervoxels...)
+		}
+		if op.SplitSupervoxel != nil {
+			update(op.SplitSupervoxel.Supervoxel, op.SplitSupervoxel.SplitSupervoxel, op.SplitSupervoxel.RemainSupervoxel)
+		}
+	}
+	return maxLabel
+}
+
+// validates all ops against the label state produced by earlier ops.  Any needed new labels
+// are set to placeholders, which are reset to zero if validation fails.
+func (d *Data) validateBatch(v dvid.VersionID, ops []BatchOp) (state *batchState, err error) {
+	var svmap *SVMap
+	if svmap, err = getMapping(d, v); err != nil {
+		return
+	}
+	d.mlMu.RLock()
+	maxLabel := d.MaxRepoLabel
+	d.mlMu.RUnlock()
+	if given := batchMaxLabel(ops); given > maxLabel {
+		maxLabel = given
+	}
+	state = &batchState{
+		d:                  d,
+		v:                  v,
+		svmap:              svmap,
+		labels:             make(map[uint64]map[uint64]uint64),
+		mapped:             make(map[uint64]uint64),
+		touchedLabels:      make(labels.Set),
+		touchedSupervoxels: make(labels.Set),
+		nextPlaceholder:    maxLabel + 1,
+	}
+	defer func() {
+		if err != nil {
+			for _, field := range state.newLabels {
+				*field = 0
+			}
+			state = nil
+		}
+	}()
+	for i, op := range ops {
+		var numSet int
+		if op.Merge != nil {
+			numSet++
+			err = state.merge(op.Merge)
+		}
+		if op.Cleave != nil {
+			numSet++
+			err = state.cleave(op.Cleave)
+		}
+		if op.SplitSupervoxel != nil {
+			numSet++
+			err = state.splitSupervoxel(op.SplitSupervoxel, op.SplitRLEs)
+		}
+		if numSet != 1 {
+			err = fmt.Errorf("must have exactly one merge, cleave, or split-supervoxel operation")
+		}
+		if err != nil {
+			err = fmt.Errorf("batch op %d: %v", i, err)
+			return
+		}
+	}
+	return
+}
+
+// reserves the labels of a validated batch, raising the max label for given labels and
+// replacing placeholders with newly allocated labels.
+func (d *Data) reserveBatchLabels(state *batchState) error {
+	for _, label := range state.givenLabels {
+		if _, err := d.updateMaxLabel(state.v, label); err != nil {
+			return err
+		}
+	}
+	if len(state.newLabels) == 0 {
+		return nil
+	}
+	allocated := make(map[uint64]uint64, len(state.newLabels))
+	for _, field := range state.newLabels {
+		label, err := d.newLabel(state.v)
+		if err != nil {
+			return err
+		}
+		allocated[*field] = label
+		*field = label
+	}
+	replace := func(set labels.Set) labels.Set {
+		replaced := make(labels.Set, len(set))
+		for label := range set {
+			if newLabel, found := allocated[label]; found {
+				label = newLabel
+			}
+			replaced[label] = struct{}{}
+		}
+		return replaced
+	}
+	state.touchedLabels = replace(state.touchedLabels)
+	state.touchedSupervoxels = replace(state.touchedSupervoxels)
+	return nil
+}
+
+// batchSnapshot holds the label indices and mappings that may be changed by a batch.
+type batchSnapshot struct {
+	indices  map[uint64]*labels.Index // nil for labels without an index
+	mappings map[uint64]vmap
+}
+
+func (d *Data) snapshotBatch(state *batchState) (*batchSnapshot, error) {
+	snap := &batchSnapshot{
+		indices:  make(map[uint64]*labels.Index, len(state.touchedLabels)),
+		mappings: state.svmap.getRawMappings(state.touchedSupervoxels),
+	}
+	for label := range state.touchedLabels {
+		idx, err := GetLabelIndex(d, state.v, label, false)
+		if err != nil {
+			return nil, err
+		}
+		snap.indices[label] = idx
+	}
+	return snap, nil
+}
+
+// undoes a partially applied batch.  The original blocks are restored in reverse order
+// so blocks modified by more than one supervoxel split end up in their original state.
+func (d *Data) rollbackBatch(v dvid.VersionID, mutID0, mutID1 uint64, snap *batchSnapshot, origBlocks []*labels.PositionedBlock, downresMut *downres.Mutation) {
+	ctx := datastore.NewVersionedCtx(d, v)
+	var scale uint8
+	for i := len(origBlocks) - 1; i >= 0; i-- {
+		pb := origBlocks[i]
+		if err := d.putLabelBlock(ctx, scale, pb); err != nil {
+			dvid.Criticalf("unable to put back block %s, data %q after batch error: %v\n", pb.BCoord, d.DataName(), err)
+		}
+		if downresMut != nil {
+			if err := downresMut.BlockMutated(pb.BCoord, &(pb.Block)); err != nil {
+				dvid.Errorf("data %q publishing downres of restored block %s: %v\n", d.DataName(), pb.BCoord, err)
+			}
+		}
+	}
+	for label, idx := range snap.indices {
+		shard := label % numIndexShards
+		indexMu[shard].Lock()
+		var err error
+		if idx == nil {
+			err = deleteCachedLabelIndex(d, v, label)
+		} else {
+			err = putCachedLabelIndex(d, v, idx)
+		}
+		indexMu[shard].Unlock()
+		if err != nil {
+			dvid.Criticalf("unable to restore label %d index, data %q after batch error: %v\n", label, d.DataName(), err)
+		}
+	}
+	if svmap, err := getMapping(d, v); err != nil {
+		dvid.Criticalf("unable to restore mappings, data %q after batch error: %v\n", d.DataName(), err)
+	} else {
+		svmap.restoreRawMappings(v, snap.mappings, mutID0, mutID1)
+	}
+	if downresMut != nil {
+		if err := downresMut.Execute(); err != nil {
+			dvid.Criticalf("down-res compute after batch rollback failed for data %q: %v\n", d.DataName(), err)
+		}
+	}
+}
+
+// applies a validated supervoxel split within a batch, taking the same locks as SplitSupervoxel.
+func (d *Data) batchSplitSupervoxel(logd dvid.Data, v dvid.VersionID, op labels.SplitSupervoxelOp, info dvid.ModInfo, downresMut *downres.Mutation) (origBlocks []*labels.PositionedBlock, err error) {
+	var mapping *SVMap
+	if mapping, err = getMapping(d, v); err != nil {
+		return
+	}
+	label := op.Supervoxel
+	if mapped, found := mapping.MappedLabel(v, op.Supervoxel); found {
+		label = mapped
+	}
+	shard := label % numIndexShards
+	indexMu[shard].Lock()
+	defer indexMu[shard].Unlock()
+
+	var idx *labels.Index
+	if idx, err = getCachedLabelIndex(d, v, label); err != nil {
+		return
+	}
+	if idx == nil {
+		err = fmt.Errorf("unable to split supervoxel %d for data %q: missing label index %d", op.Supervoxel, d.DataName(), label)
+		return
+	}
+
+	d.voxelMu.Lock()
+	defer d.voxelMu.Unlock()
+
+	ctx := datastore.NewVersionedCtx(d, v)
+	_, origBlocks, err = d.splitSupervoxelLocked(logd, ctx, op, idx, info, downresMut)
+	return
+}
+
+// batchLabels returns the labels targeted by the batch ops.  For supervoxel splits, the
+// body containing the supervoxel before the batch is returned.
+func (d *Data) batchLabels(v dvid.VersionID, ops []BatchOp) ([]uint64, error) {
+	var lbls []uint64
+	for _, op := range ops {
+		switch {
+		case op.Merge != nil:
+			lbls = append(lbls, op.Merge.Target)
+			for label := range op.Merge.Merged {
+				lbls = append(lbls, label)
+			}
+		case op.Cleave != nil:
+			lbls = append(lbls, op.Cleave.Target)
+		case op.SplitSupervoxel != nil:
+			mapping, err := getMapping(d, v)
+			if err != nil {
+				return nil, err
+			}
+			label := op.SplitSupervoxel.Supervoxel
+			if mapping != nil {
+				if mapped, found := mapping.MappedLabel(v, label); found {
+					label = mapped
+				}
+			}
+			lbls = append(lbls, label)
+		}
+	}
+	return lbls, nil
+}
+
+// ApplyBatch applies an ordered list of merge, cleave, and supervoxel split operations as
+// a unit under a contiguous range of mutation IDs, the first of which is returned.  The
+// passed ops are modified to hold the assigned mutation IDs and any newly allocated labels.
+// All ops are validated before any data is changed.  If an op fails while being applied,
+// the changes of the batch are undone, and the mutation log is only written after the
+// whole batch succeeds.
+//
+// EVENTS
+//
+// labels.BatchEvent occurs once after all ops are applied and transmits a labels.DeltaBatch
+// struct with a labels.DeltaMerge, labels.CleaveOp, or labels.SplitSupervoxelOp per op.
+//
+func (d *Data) ApplyBatch(v dvid.VersionID, ops []BatchOp, info dvid.ModInfo, ifMatch LabelETags, downscale bool) (mutID uint64, err error) {
+	if len(ops) == 0 {
+		err = fmt.Errorf("no operations given in batch")
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+
+	d.StartUpdate()
+	defer d.StopUpdate()
+
+	modified, unlock, err := d.lockChangingLabels(func() ([]uint64, error) {
+		return d.batchLabels(v, ops)
+	})
+	if err != nil {
+		return
+	}
+	defer unlock()
+	if err = d.checkIfMatch(v, ifMatch, modified...); err != nil {
+		return
+	}
+	if err = d.checkBatchCheckouts(v, info.User, ops); err != nil {
+		return
+	}
+	var state *batchState
+	if state, err = d.validateBatch(v, ops); err != nil {
+		return
+	}
+	if err = d.reserveBatchLabels(state); err != nil {
+		return
+	}
+	var snap *batchSnapshot
+	if snap, err = d.snapshotBatch(state); err != nil {
+		return
+	}
+
+	mutID = d.NewMutationIDs(uint64(len(ops)))
+	lastMutID := mutID + uint64(len(ops)) - 1
+	var numSplits int
+	for i, op := range ops {
+		opMutID := mutID + uint64(i)
+		switch {
+		case op.Merge != nil:
+			op.Merge.MutID = opMutID
+		case op.Cleave != nil:
+			op.Cleave.MutID = opMutID
+		case op.SplitSupervoxel != nil:
+			op.SplitSupervoxel.MutID = opMutID
+			numSplits++
+		}
+	}
+
+	var downresMut *downres.Mutation
+	if downscale && numSplits > 0 {
+		downresMut = downres.NewMutation(d, v, mutID)
+	}
+	logd := batchData{Data: d, log: &batchLog{WriteLog: d.GetWriteLog()}}
+	var origBlocks []*labels.PositionedBlock
+	deltas := make([]interface{}, len(ops))
+	for i, op := range ops {
+		switch {
+		case op.Merge != nil:
+			deltas[i], err = d.mergeLabels(logd, v, op.Merge.MutID, *op.Merge, info)
+		case op.Cleave != nil:
+			err = d.cleaveLabel(logd, v, *op.Cleave, info)
+			deltas[i] = *op.Cleave
+		case op.SplitSupervoxel != nil:
+			var blocks []*labels.PositionedBlock
+			blocks, err = d.batchSplitSupervoxel(logd, v, *op.SplitSupervoxel, info, downresMut)
+			origBlocks = append(origBlocks, blocks...)
+			deltas[i] = *op.SplitSupervoxel
+		}
+		if err != nil {
+			err = fmt.Errorf("batch op %d failed so batch was not applied: %v", i, err)
+			d.rollbackBatch(v, mutID, lastMutID, snap, origBlocks, downresMut)
+			return
+		}
+	}
+	if err = logd.log.flush(); err != nil {
+		err = fmt.Errorf("unable to write mutation log for batch: %v", err)
+		d.rollbackBatch(v, mutID, lastMutID, snap, origBlocks, downresMut)
+		return
+	}
+
+	// send kafka batch event to instance-uuid topic now that the batch is applied
+	versionuuid, _ := datastore.UUIDFromVersion(v)
+	d.produceBatchKafkaMsg(versionuuid, mutID, ops)
+	if downresMut != nil {
+		if err = downresMut.Execute(); err != nil {
+			dvid.Criticalf("down-res compute of batch %d failed with error: %v\n", mutID, err)
+			return
+		}
+	}
+
+	if err := d.transferBatchCheckouts(v, ops); err != nil {
+		dvid.Errorf("unable to pass checkouts for batch %d: %v\n", mutID, err)
+	}
+
+	timedLog.Infof("Applied batch of %d ops, mutation ids %d-%d, data %q", len(ops), mutID, lastMutID, d.DataName())
+
+	evt := datastore.SyncEvent{Data: d.DataUUID(), Event: labels.BatchEvent}
+	delta := labels.DeltaBatch{MutID: mutID, Deltas: deltas}
+	msg := datastore.SyncMessage{Event: labels.BatchEvent, Version: v, Delta: delta}
+	if err = datastore.NotifySubscribers(evt, msg); err != nil {
+		err = fmt.Errorf("can't notify subscribers for event %v: %v", evt, err)
+		return
+	}
+
+	msginfo := map[string]interface{}{
+		"Action":     "batch-complete",
+		"MutationID": mutID,
+		"UUID":       string(versionuuid),
+		"Timestamp":  time.Now().String(),
+	}
+	jsonmsg, _ := json.Marshal(msginfo)
+	if err = d.ProduceKafkaMsg(jsonmsg); err != nil {
+		dvid.Errorf("error on sending batch complete op to kafka: %v", err)
+	}
+	return
+}
+
+// produceBatchKafkaMsg sends a kafka message describing each op of an applied batch.
+func (d *Data) produceBatchKafkaMsg(versionuuid dvid.UUID, mutID uint64, ops []BatchOp) {
+	kafkaOps := make([]map[string]interface{}, len(ops))
+	for i, op := range ops {
+		result := op.resultJSON()
+		kafkaOps[i] = map[string]interface{}{
+			"Action":     result.Action,
+			"MutationID": result.MutationID,
+		}
+		switch {
+		case op.Merge != nil:
+			kafkaOps[i]["Target"] = result.Target
+			kafkaOps[i]["Labels"] = result.Labels
+		case op.Cleave != nil:
+			kafkaOps[i]["OrigLabel"] = result.Target
+			kafkaOps[i]["CleavedLabel"] = result.CleavedLabel
+			kafkaOps[i]["CleavedSupervoxels"] = result.CleavedSupervoxels
+		case op.SplitSupervoxel != nil:
+			var splitRef string
+			splitData, err := op.SplitRLEs.MarshalBinary()
+			if err != nil {
+				dvid.Errorf("error serializing split of supervoxel %d: %v", result.Supervoxel, err)
+			} else if splitRef, err = d.PutBlob(splitData); err != nil {
+				dvid.Errorf("error storing split data: %v", err)
+			}
+			kafkaOps[i]["Supervoxel"] = result.Supervoxel
+			kafkaOps[i]["SplitSupervoxel"] = result.SplitSupervoxel
+			kafkaOps[i]["RemainSupervoxel"] = result.RemainSupervoxel
+			kafkaOps[i]["Split"] = splitRef
+		}
+	}
+	msginfo := map[string]interface{}{
+		"Action":     "batch",
+		"Ops":        kafkaOps,
+		"MutationID": mutID,
+		"UUID":       string(versionuuid),
+		"Timestamp":  time.Now().String(),
+	}
+	jsonmsg, _ := json.Marshal(msginfo)
+	if err := d.ProduceKafkaMsg(jsonmsg); err != nil {
+		dvid.Errorf("error on sending batch op to kafka: %v", err)
+	}
+}
@@ -0,0 +1,264 @@
+package labelmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// DefaultCheckoutTTL is the duration of a body checkout if none is specified.
+const DefaultCheckoutTTL = time.Hour
+
+// Checkout gives a user exclusive rights to mutate a body until it expires.
+type Checkout struct {
+	User    string
+	Expires time.Time
+}
+
+func (c Checkout) expired(now time.Time) bool {
+	return !now.Before(c.Expires)
+}
+
+// checkoutMap holds the checkouts for a version, keyed by label.
+type checkoutMap map[uint64]Checkout
+
+// getCheckouts returns the unexpired checkouts for a version, loading them from the
+// store if necessary.  Checkouts are versioned, so a child version inherits the checkouts
+// of its parent until they are changed in the child.  Expired checkouts are purged from
+// the store unless the version is locked.  The caller must hold d.checkoutMu.
+func (d *Data) getCheckouts(v dvid.VersionID) (checkoutMap, error) {
+	if d.checkouts == nil {
+		d.checkouts = make(map[dvid.VersionID]checkoutMap)
+	}
+	cm, found := d.checkouts[v]
+	if !found {
+		store, err := datastore.GetOrderedKeyValueDB(d)
+		if err != nil {
+			return nil, err
+		}
+		data, err := store.Get(datastore.NewVersionedCtx(d, v), checkoutsTKey)
+		if err != nil {
+			return nil, err
+		}
+		cm = make(checkoutMap)
+		if len(data) != 0 {
+			if err := json.Unmarshal(data, &cm); err != nil {
+				return nil, fmt.Errorf("bad stored checkouts for data %q: %v", d.DataName(), err)
+			}
+		}
+		d.checkouts[v] = cm
+	}
+	now := time.Now()
+	var purged bool
+	for label, c := range cm {
+		if c.expired(now) {
+			delete(cm, label)
+			purged = true
+		}
+	}
+	if purged {
+		locked, err := datastore.LockedVersion(v)
+		if err != nil {
+			return nil, err
+		}
+		if !locked {
+			if err := d.putCheckouts(v, cm); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return cm, nil
+}
+
+// putCheckouts persists the checkouts for a version.  The caller must hold d.checkoutMu.
+func (d *Data) putCheckouts(v dvid.VersionID, cm checkoutMap) error {
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(cm)
+	if err != nil {
+		return err
+	}
+	return store.Put(datastore.NewVersionedCtx(d, v), checkoutsTKey, data)
+}
+
+// CheckoutLabel gives the user exclusive rights to mutate a label for the given duration.
+// A user may renew a checkout it already holds, but a label checked out by another user
+// can't be checked out until that checkout is released or expires.  The label is held
+// against mutations so a checkout can't be granted between the checkout check of an
+// in-progress mutation and its completion.
+func (d *Data) CheckoutLabel(v dvid.VersionID, label uint64, user string, ttl time.Duration) (Checkout, error) {
+	if user == "" {
+		return Checkout{}, fmt.Errorf("a user must be specified to checkout label %d", label)
+	}
+	if ttl <= 0 {
+		return Checkout{}, fmt.Errorf("bad checkout duration %s for label %d", ttl, label)
+	}
+	unlock := d.lockLabels(label)
+	defer unlock()
+
+	idx, err := GetLabelIndex(d, v, label, false)
+	if err != nil {
+		return Checkout{}, err
+	}
+	if idx == nil || len(idx.Blocks) == 0 {
+		return Checkout{}, fmt.Errorf("cannot checkout non-existent label %d", label)
+	}
+
+	d.checkoutMu.Lock()
+	defer d.checkoutMu.Unlock()
+
+	cm, err := d.getCheckouts(v)
+	if err != nil {
+		return Checkout{}, err
+	}
+	if c, found := cm[label]; found && c.User != user {
+		return Checkout{}, fmt.Errorf("label %d is checked out by user %q until %s", label, c.User, c.Expires.Format(time.RFC3339))
+	}
+	c := Checkout{User: user, Expires: time.Now().Add(ttl)}
+	cm[label] = c
+	return c, d.putCheckouts(v, cm)
+}
+
+// ReleaseLabel removes the checkout held by the user on a label.
+func (d *Data) ReleaseLabel(v dvid.VersionID, label uint64, user string) error {
+	d.checkoutMu.Lock()
+	defer d.checkoutMu.Unlock()
+
+	cm, err := d.getCheckouts(v)
+	if err != nil {
+		return err
+	}
+	c, found := cm[label]
+	if !found {
+		return fmt.Errorf("label %d is not checked out", label)
+	}
+	if c.User != user {
+		return fmt.Errorf("label %d is checked out by user %q, not %q", label, c.User, user)
+	}
+	delete(cm, label)
+	return d.putCheckouts(v, cm)
+}
+
+// GetCheckouts returns the unexpired checkouts for a version keyed by label.
+func (d *Data) GetCheckouts(v dvid.VersionID) (map[uint64]Checkout, error) {
+	d.checkoutMu.Lock()
+	defer d.checkoutMu.Unlock()
+
+	cm, err := d.getCheckouts(v)
+	if err != nil {
+		return nil, err
+	}
+	checkouts := make(map[uint64]Checkout, len(cm))
+	for label, c := range cm {
+		checkouts[label] = c
+	}
+	return checkouts, nil
+}
+
+// checkCheckouts returns an error if any of the given labels are checked out by a user
+// other than the given one.  The caller must hold the labels via lockLabels, so no
+// checkout can be granted before the mutation completes.
+func (d *Data) checkCheckouts(v dvid.VersionID, user string, lbls ...uint64) error {
+	d.checkoutMu.Lock()
+	defer d.checkoutMu.Unlock()
+
+	cm, err := d.getCheckouts(v)
+	if err != nil {
+		return err
+	}
+	for _, label := range lbls {
+		if c, found := cm[label]; found && c.User != user {
+			return fmt.Errorf("label %d is checked out by user %q until %s", label, c.User, c.Expires.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// checkMergeCheckouts returns an error if any label in the merge is checked out by
+// a user other than the given one.
+func (d *Data) checkMergeCheckouts(v dvid.VersionID, user string, op labels.MergeOp) error {
+	lbls := []uint64{op.Target}
+	for label := range op.Merged {
+		lbls = append(lbls, label)
+	}
+	return d.checkCheckouts(v, user, lbls...)
+}
+
+// mergeCheckouts removes the checkouts of merged labels and passes them on to the merge
+// target if it isn't already checked out.
+func (d *Data) mergeCheckouts(v dvid.VersionID, op labels.MergeOp) error {
+	d.checkoutMu.Lock()
+	defer d.checkoutMu.Unlock()
+
+	cm, err := d.getCheckouts(v)
+	if err != nil {
+		return err
+	}
+	var changed bool
+	for label := range op.Merged {
+		c, found := cm[label]
+		if !found {
+			continue
+		}
+		delete(cm, label)
+		if tc, found := cm[op.Target]; !found || tc.Expires.Before(c.Expires) {
+			cm[op.Target] = c
+		}
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return d.putCheckouts(v, cm)
+}
+
+// copyCheckout gives a label split or cleaved off another label the same checkout.
+func (d *Data) copyCheckout(v dvid.VersionID, fromLabel, toLabel uint64) error {
+	d.checkoutMu.Lock()
+	defer d.checkoutMu.Unlock()
+
+	cm, err := d.getCheckouts(v)
+	if err != nil {
+		return err
+	}
+	c, found := cm[fromLabel]
+	if !found {
+		return nil
+	}
+	cm[toLabel] = c
+	return d.putCheckouts(v, cm)
+}
+
+// checkBatchCheckouts returns an error if any label targeted by the batch ops is checked
+// out by a user other than the given one.  For supervoxel splits, the body containing
+// the supervoxel before the batch is checked.
+func (d *Data) checkBatchCheckouts(v dvid.VersionID, user string, ops []BatchOp) error {
+	lbls, err := d.batchLabels(v, ops)
+	if err != nil {
+		return err
+	}
+	return d.checkCheckouts(v, user, lbls...)
+}
+
+// transferBatchCheckouts updates checkouts after a batch has been applied.
+func (d *Data) transferBatchCheckouts(v dvid.VersionID, ops []BatchOp) error {
+	for _, op := range ops {
+		switch {
+		case op.Merge != nil:
+			if err := d.mergeCheckouts(v, *op.Merge); err != nil {
+				return err
+			}
+		case op.Cleave != nil:
+			if err := d.copyCheckout(v, op.Cleave.Target, op.Cleave.CleavedLabel); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
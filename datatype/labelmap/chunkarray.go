@@ -0,0 +1,63 @@
+package labelmap
+
+import (
+	"fmt"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/imageblk"
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// ExportChunkedArray writes the labels at the given scale within the array bounds to the
+// array's chunk files.  If supervoxels is true, unmapped supervoxel labels are exported.
+func (d *Data) ExportChunkedArray(v dvid.VersionID, scale uint8, supervoxels bool, a *imageblk.ChunkedArray) error {
+	if scale > d.MaxDownresLevel {
+		return fmt.Errorf("scale %d exceeds max downres level %d of data %q", scale, d.MaxDownresLevel, d.DataName())
+	}
+	timedLog := dvid.NewTimeLog()
+	numChunks, err := a.Export(func(subvol *dvid.Subvolume) ([]byte, error) {
+		lbl, err := d.NewLabels(subvol, nil)
+		if err != nil {
+			return nil, err
+		}
+		return d.GetVolume(v, lbl, supervoxels, scale, "")
+	})
+	if err != nil {
+		return err
+	}
+	timedLog.Infof("Exported %d chunks of labelmap %q scale %d to %s %q", numChunks, d.DataName(), scale, a.Format, a.Dir)
+	return nil
+}
+
+// IngestChunkedArray stores the supervoxels of a uint64 chunked array through block-aligned
+// label mutations, so label indices, down-resolution scales, and syncs are updated.
+func (d *Data) IngestChunkedArray(v dvid.VersionID, a *imageblk.ChunkedArray) error {
+	if a.DataType != dvid.T_uint64 {
+		return fmt.Errorf("array %q must hold uint64 labels to ingest into labelmap %q", a.Dir, d.DataName())
+	}
+	blockSize, ok := d.BlockSize().(dvid.Point3d)
+	if !ok {
+		return fmt.Errorf("block size for data %q should be 3d, not: %s", d.DataName(), d.BlockSize())
+	}
+
+	timedLog := dvid.NewTimeLog()
+	get := func(subvol *dvid.Subvolume) ([]byte, error) {
+		lbl, err := d.NewLabels(subvol, nil)
+		if err != nil {
+			return nil, err
+		}
+		return d.GetVolume(v, lbl, true, 0, "")
+	}
+	put := func(subvol *dvid.Subvolume, data []byte) error {
+		return d.PutLabels(v, subvol, data, "", true)
+	}
+	numPuts, err := a.Ingest(blockSize, get, put)
+	if err != nil {
+		return err
+	}
+	if err := datastore.SaveDataByVersion(v, d); err != nil {
+		return err
+	}
+	timedLog.Infof("Ingested %s %q into labelmap %q using %d subvolume puts", a.Format, a.Dir, d.DataName(), numPuts)
+	return nil
+}
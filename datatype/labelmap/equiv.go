@@ -5,6 +5,7 @@ package labelmap
 import (
 	"encoding/binary"
 	"fmt"
+	"math"
 	"os"
 	"strings"
 	"sync"
@@ -95,22 +96,32 @@ func (d *Data) ingestMappings(ctx *datastore.VersionedCtx, mappings proto.Mappin
 	return labels.LogMappings(d, ctx.VersionID(), mappings)
 }
 
+// shortVersion is an SVMap-specific id for a version that has mappings.  It is
+// only held in memory since the SVMap is rebuilt from the mutation logs, which are
+// stored by version UUID, so its width can change without migrating stored data.
+type shortVersion uint32
+
+// size of a vmap entry: a 32-bit short version followed by the uint64 mapping.
+// Note that a single entry still fits in the 16-byte allocation class that the
+// earlier 9-byte entries with 8-bit short versions used.
+const vmapEntrySize = 12
+
 // versioned map entry for a given supervoxel.
-// All versions are contained where each entry is an 8-bit version id
-// followed by the uint64 mapping.  So length must be N * 9.
+// All versions are contained where each entry is a 32-bit short version id
+// followed by the uint64 mapping.  So length must be N * vmapEntrySize.
 type vmap []byte
 
 // returns the mapping for a given version given its ancestry
-func (vm vmap) value(ancestry []uint8) (label uint64, present bool) {
+func (vm vmap) value(ancestry []shortVersion) (label uint64, present bool) {
 	sz := len(vm)
 	if sz == 0 {
 		return 0, false
 	}
 	for _, vid := range ancestry {
-		for pos := 0; pos < sz; pos += 9 {
-			entryvid := uint8(vm[pos])
+		for pos := 0; pos < sz; pos += vmapEntrySize {
+			entryvid := shortVersion(binary.LittleEndian.Uint32(vm[pos : pos+4]))
 			if entryvid == vid {
-				return binary.LittleEndian.Uint64(vm[pos+1 : pos+9]), true
+				return binary.LittleEndian.Uint64(vm[pos+4 : pos+vmapEntrySize]), true
 			}
 		}
 	}
@@ -118,46 +129,47 @@ func (vm vmap) value(ancestry []uint8) (label uint64, present bool) {
 }
 
 // modify or append a new mapping given a unique version id and mapped label
-func (vm vmap) modify(vid uint8, toLabel uint64) (out vmap, changed bool) {
+func (vm vmap) modify(vid shortVersion, toLabel uint64) (out vmap, changed bool) {
 	if len(vm) == 0 {
-		out = make([]byte, 9)
-		out[0] = vid
-		binary.LittleEndian.PutUint64(out[1:], toLabel)
+		out = make([]byte, vmapEntrySize)
+		binary.LittleEndian.PutUint32(out[0:4], uint32(vid))
+		binary.LittleEndian.PutUint64(out[4:], toLabel)
 		return out, true
 	}
-	for pos := 0; pos < len(vm); pos += 9 {
-		entryvid := uint8(vm[pos])
+	for pos := 0; pos < len(vm); pos += vmapEntrySize {
+		entryvid := shortVersion(binary.LittleEndian.Uint32(vm[pos : pos+4]))
 		if entryvid == vid {
-			curLabel := binary.LittleEndian.Uint64(vm[pos+1 : pos+9])
+			curLabel := binary.LittleEndian.Uint64(vm[pos+4 : pos+vmapEntrySize])
 			if curLabel == toLabel {
 				return vm, false
 			}
 			out := make([]byte, len(vm))
 			copy(out, vm)
-			binary.LittleEndian.PutUint64(out[pos+1:pos+9], toLabel)
+			binary.LittleEndian.PutUint64(out[pos+4:pos+vmapEntrySize], toLabel)
 			return out, true
 		}
 	}
 	pos := len(vm)
-	out = make([]byte, pos+9)
+	out = make([]byte, pos+vmapEntrySize)
 	copy(out, vm)
-	out[pos] = vid
-	binary.LittleEndian.PutUint64(out[pos+1:], toLabel)
+	binary.LittleEndian.PutUint32(out[pos:pos+4], uint32(vid))
+	binary.LittleEndian.PutUint64(out[pos+4:], toLabel)
 	return out, true
 }
 
-// SVMap is a version-aware supervoxel map that tries to be memory efficient and
-// allows up to 256 versions per SVMap instance.  Splits are also cached by version.
+// SVMap is a version-aware supervoxel map that tries to be memory efficient.  The number
+// of versions per SVMap instance is only limited by the 32-bit short version ids.  Splits
+// are also cached by version.
 type SVMap struct {
-	fm          map[uint64]vmap          // forward map from supervoxel to agglomerated (body) id
-	versions    map[dvid.VersionID]uint8 // versions that have been initialized
-	versionsRev map[uint8]dvid.VersionID // reverse map for byte -> version
-	numVersions uint8
+	fm          map[uint64]vmap                 // forward map from supervoxel to agglomerated (body) id
+	versions    map[dvid.VersionID]shortVersion // versions that have been initialized
+	versionsRev map[shortVersion]dvid.VersionID // reverse map for short version -> version
+	numVersions shortVersion
 
-	ancestry   map[dvid.VersionID][]uint8 // cache of ancestry other than current version
+	ancestry   map[dvid.VersionID][]shortVersion // cache of ancestry other than current version
 	ancestryMu sync.RWMutex
 
-	splits map[uint8][]proto.SupervoxelSplitOp
+	splits map[shortVersion][]proto.SupervoxelSplitOp
 
 	sync.RWMutex
 }
@@ -184,7 +196,7 @@ func (svm *SVMap) initToVersion(d dvid.Data, v dvid.VersionID) error {
 		timedLog := dvid.NewTimeLog()
 		ch := make(chan storage.LogMessage, 100)
 		wg := new(sync.WaitGroup)
-		go func(vid uint8, ch chan storage.LogMessage, wg *sync.WaitGroup) {
+		go func(vid shortVersion, ch chan storage.LogMessage, wg *sync.WaitGroup) {
 			numMsgs := 0
 			for msg := range ch { // expects channel to be closed on completion
 				numMsgs++
@@ -251,11 +263,11 @@ func (svm *SVMap) initToVersion(d dvid.Data, v dvid.VersionID) error {
 // getAncestry returns a slice of short version ids that actually have mappings,
 // from current version to root along ancestry.  Since all ancestors are immutable,
 // we can cache the ancestor slice and check if we should add current short version id.
-func (svm *SVMap) getAncestry(v dvid.VersionID) ([]uint8, error) {
+func (svm *SVMap) getAncestry(v dvid.VersionID) ([]shortVersion, error) {
 	svm.ancestryMu.Lock()
 	defer svm.ancestryMu.Unlock()
 	if svm.ancestry == nil {
-		svm.ancestry = make(map[dvid.VersionID][]uint8)
+		svm.ancestry = make(map[dvid.VersionID][]shortVersion)
 	}
 	ancestry, found := svm.ancestry[v]
 	if !found {
@@ -273,7 +285,7 @@ func (svm *SVMap) getAncestry(v dvid.VersionID) ([]uint8, error) {
 	}
 	vid, found := svm.versions[v]
 	if found {
-		return append([]uint8{vid}, ancestry...), nil
+		return append([]shortVersion{vid}, ancestry...), nil
 	}
 	return ancestry, nil
 }
@@ -313,11 +325,11 @@ func (svm *SVMap) SupervoxelSplitsJSON(v dvid.VersionID) (string, error) {
 }
 
 // returns a short version or creates one if it didn't exist before.
-func (svm *SVMap) createShortVersion(v dvid.VersionID) (uint8, error) {
+func (svm *SVMap) createShortVersion(v dvid.VersionID) (shortVersion, error) {
 	vid, found := svm.versions[v]
 	if !found {
-		if svm.numVersions == 255 {
-			return 0, fmt.Errorf("can only have 256 active versions of data instance mapping")
+		if svm.numVersions == math.MaxUint32 {
+			return 0, fmt.Errorf("can only have %d active versions of data instance mapping", uint64(math.MaxUint32))
 		}
 		vid = svm.numVersions
 		svm.versions[v] = vid
@@ -349,7 +361,7 @@ func (svm *SVMap) exists(v dvid.VersionID) bool {
 
 // faster inner-loop version of mapping where ancestry should already be provided.
 // receiver RLock should be provided outside.
-func (svm *SVMap) mapLabel(label uint64, ancestry []uint8) (uint64, bool) {
+func (svm *SVMap) mapLabel(label uint64, ancestry []shortVersion) (uint64, bool) {
 	vm, found := svm.fm[label]
 	if !found {
 		return label, false
@@ -357,7 +369,7 @@ func (svm *SVMap) mapLabel(label uint64, ancestry []uint8) (uint64, bool) {
 	return vm.value(ancestry)
 }
 
-func (svm *SVMap) setMapping(vid uint8, from, to uint64) {
+func (svm *SVMap) setMapping(vid shortVersion, from, to uint64) {
 	vm := svm.fm[from]
 	newvm, changed := vm.modify(vid, to)
 	if changed {
@@ -365,6 +377,44 @@ func (svm *SVMap) setMapping(vid uint8, from, to uint64) {
 	}
 }
 
+// getRawMappings returns the versioned forward map entries for the given supervoxels,
+// with a nil entry for supervoxels that have no mapping.  The entries can be restored
+// via restoreRawMappings.
+func (svm *SVMap) getRawMappings(supervoxels labels.Set) map[uint64]vmap {
+	raw := make(map[uint64]vmap, len(supervoxels))
+	svm.RLock()
+	for supervoxel := range supervoxels {
+		raw[supervoxel] = svm.fm[supervoxel]
+	}
+	svm.RUnlock()
+	return raw
+}
+
+// restoreRawMappings puts back forward map entries retrieved by getRawMappings and removes
+// any supervoxel split records for the given version with mutation IDs in [mutID0, mutID1].
+func (svm *SVMap) restoreRawMappings(v dvid.VersionID, raw map[uint64]vmap, mutID0, mutID1 uint64) {
+	svm.Lock()
+	defer svm.Unlock()
+	for supervoxel, vm := range raw {
+		if vm == nil {
+			delete(svm.fm, supervoxel)
+		} else {
+			svm.fm[supervoxel] = vm
+		}
+	}
+	vid, found := svm.versions[v]
+	if !found {
+		return
+	}
+	var splits []proto.SupervoxelSplitOp
+	for _, rec := range svm.splits[vid] {
+		if rec.Mutid < mutID0 || rec.Mutid > mutID1 {
+			splits = append(splits, rec)
+		}
+	}
+	svm.splits[vid] = splits
+}
+
 // MappedLabel returns the mapped label and a boolean: true if
 // a mapping was found and false if none was found.  For faster mapping,
 // large scale transformations, e.g. block-level output, should not use this
@@ -423,7 +473,7 @@ func (svm *SVMap) MappedLabels(v dvid.VersionID, supervoxels []uint64) (mapped [
 }
 
 // does not apply lock so can be used in loops with outside locking.
-func (svm *SVMap) applyMappingToBlock(ancestry []uint8, block *labels.Block) {
+func (svm *SVMap) applyMappingToBlock(ancestry []shortVersion, block *labels.Block) {
 	for i, label := range block.Labels {
 		mapped, found := svm.mapLabel(label, ancestry)
 		if found {
@@ -462,9 +512,9 @@ func getMapping(d dvid.Data, v dvid.VersionID) (*SVMap, error) {
 	if !found {
 		m = new(SVMap)
 		m.fm = make(map[uint64]vmap)
-		m.splits = make(map[uint8][]proto.SupervoxelSplitOp)
-		m.versions = make(map[dvid.VersionID]uint8)
-		m.versionsRev = make(map[uint8]dvid.VersionID)
+		m.splits = make(map[shortVersion][]proto.SupervoxelSplitOp)
+		m.versions = make(map[dvid.VersionID]shortVersion)
+		m.versionsRev = make(map[shortVersion]dvid.VersionID)
 		iMap.maps[d.DataUUID()] = m
 	}
 	iMap.Unlock()
@@ -519,6 +569,7 @@ func addSplitToMapping(d dvid.Data, v dvid.VersionID, op labels.SplitOp) error {
 	m.Lock()
 	vid, err := m.createShortVersion(v)
 	if err != nil {
+		m.Unlock()
 		return err
 	}
 	deleteSupervoxels := make(labels.Set)
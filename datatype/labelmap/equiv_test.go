@@ -0,0 +1,53 @@
+package labelmap
+
+import (
+	"testing"
+
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+func TestSVMapManyVersions(t *testing.T) {
+	svm := new(SVMap)
+	svm.fm = make(map[uint64]vmap)
+	svm.versions = make(map[dvid.VersionID]shortVersion)
+	svm.versionsRev = make(map[shortVersion]dvid.VersionID)
+
+	// more versions than the 256 previously allowed, each remapping supervoxel 1.
+	numVersions := 1000
+	ancestry := make([]shortVersion, numVersions)
+	for i := 0; i < numVersions; i++ {
+		vid, err := svm.createShortVersion(dvid.VersionID(i + 1))
+		if err != nil {
+			t.Fatalf("unable to create short version %d: %v\n", i, err)
+		}
+		if int(vid) != i {
+			t.Fatalf("expected short version %d, got %d\n", i, vid)
+		}
+		svm.setMapping(vid, 1, uint64(100+i))
+		ancestry[numVersions-1-i] = vid
+	}
+	if vid, err := svm.createShortVersion(dvid.VersionID(10)); err != nil || vid != 9 {
+		t.Fatalf("expected existing short version 9 for version 10, got %d, %v\n", vid, err)
+	}
+	if len(svm.fm[1]) != numVersions*vmapEntrySize {
+		t.Fatalf("expected %d bytes in vmap, got %d\n", numVersions*vmapEntrySize, len(svm.fm[1]))
+	}
+	for i := 0; i < numVersions; i++ {
+		label, found := svm.mapLabel(1, ancestry[numVersions-1-i:])
+		if !found || label != uint64(100+i) {
+			t.Fatalf("expected supervoxel 1 -> %d at short version %d, got %d (found %t)\n", 100+i, i, label, found)
+		}
+	}
+	if _, found := svm.mapLabel(2, ancestry); found {
+		t.Fatalf("found mapping for unmapped supervoxel 2\n")
+	}
+
+	// modifying an existing version's entry shouldn't grow the vmap.
+	svm.setMapping(500, 1, 7)
+	if len(svm.fm[1]) != numVersions*vmapEntrySize {
+		t.Fatalf("modification of existing entry changed vmap length to %d\n", len(svm.fm[1]))
+	}
+	if label, _ := svm.mapLabel(1, ancestry[numVersions-1-500:]); label != 7 {
+		t.Fatalf("expected modified mapping to 7, got %d\n", label)
+	}
+}
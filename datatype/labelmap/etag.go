@@ -0,0 +1,146 @@
+package labelmap
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+)
+
+// Label ETags allow optimistic concurrency on bodies.  The entity tag of a label is
+// "<label>-<last mutation id>", where the mutation id is the one recorded in the label
+// index and also returned by the /lastmod endpoint.  Since the label is part of the tag,
+// a client can send the tags of all bodies it has read in one If-Match header.
+
+// labelETag returns the quoted entity tag for the given label index.
+func labelETag(label uint64, idx *labels.Index) string {
+	return fmt.Sprintf(`"%d-%d"`, label, idx.LastMutId)
+}
+
+// parseLabelETag returns the label and mutation id of an entity tag, which may be weak.
+func parseLabelETag(tag string) (label, mutID uint64, err error) {
+	tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		err = fmt.Errorf("entity tag %s is not a quoted string", tag)
+		return
+	}
+	parts := strings.Split(tag[1:len(tag)-1], "-")
+	if len(parts) != 2 {
+		err = fmt.Errorf("entity tag %s is not of form \"<label>-<mutation id>\"", tag)
+		return
+	}
+	if label, err = strconv.ParseUint(parts[0], 10, 64); err != nil {
+		err = fmt.Errorf("bad label in entity tag %s: %v", tag, err)
+		return
+	}
+	if mutID, err = strconv.ParseUint(parts[1], 10, 64); err != nil {
+		err = fmt.Errorf("bad mutation id in entity tag %s: %v", tag, err)
+	}
+	return
+}
+
+// setLabelETag sets the ETag header for the body of the given label or, if isSupervoxel
+// is true, the body containing the given supervoxel.  No header is set if the label
+// has no index.
+func (d *Data) setLabelETag(w http.ResponseWriter, v dvid.VersionID, label uint64, isSupervoxel bool) error {
+	idx, err := GetLabelIndex(d, v, label, isSupervoxel)
+	if err != nil {
+		return err
+	}
+	if idx == nil || len(idx.Blocks) == 0 {
+		return nil
+	}
+	if idx.Label != 0 {
+		label = idx.Label
+	}
+	w.Header().Set("ETag", labelETag(label, idx))
+	return nil
+}
+
+// LabelETags maps labels to the mutation ids of their entity tags as sent in an If-Match
+// header.  A nil LabelETags places no precondition on a mutation.
+type LabelETags map[uint64]uint64
+
+// ParseIfMatch returns the label entity tags of an If-Match header.  A missing header or
+// one with only "*" tags returns nil.
+func ParseIfMatch(header string) (LabelETags, error) {
+	if strings.TrimSpace(header) == "" {
+		return nil, nil
+	}
+	var tags LabelETags
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimSpace(tag) == "*" {
+			continue
+		}
+		label, mutID, err := parseLabelETag(tag)
+		if err != nil {
+			return nil, err
+		}
+		if tags == nil {
+			tags = make(LabelETags)
+		}
+		tags[label] = mutID
+	}
+	return tags, nil
+}
+
+// PreconditionError is returned by a mutation that was not applied because the labels it
+// would modify don't match the given If-Match entity tags.
+type PreconditionError struct {
+	Labels []uint64
+}
+
+func (e PreconditionError) Error() string {
+	return fmt.Sprintf("labels %v have been modified since the If-Match entity tags were issued or have no tag", e.Labels)
+}
+
+// checkIfMatch verifies the given entity tags against the current label indices and
+// returns a PreconditionError listing any tagged label that has been modified or deleted
+// since its tag was issued.  Every existing label among the given labels modified by the
+// mutation must also be tagged, since the client can't have seen its current state.
+// The caller must hold the modified labels via lockLabels.
+func (d *Data) checkIfMatch(v dvid.VersionID, tags LabelETags, modified ...uint64) error {
+	if tags == nil {
+		return nil
+	}
+	var failed []uint64
+	for label, mutID := range tags {
+		idx, err := GetLabelIndex(d, v, label, false)
+		if err != nil {
+			return err
+		}
+		if idx == nil || len(idx.Blocks) == 0 || idx.LastMutId != mutID {
+			failed = append(failed, label)
+		}
+	}
+	for _, label := range uniqueLabels(modified) {
+		if _, tagged := tags[label]; tagged {
+			continue
+		}
+		idx, err := GetLabelIndex(d, v, label, false)
+		if err != nil {
+			return err
+		}
+		if idx != nil && len(idx.Blocks) != 0 {
+			failed = append(failed, label)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return PreconditionError{Labels: uniqueLabels(failed)}
+}
+
+// preconditionFailed writes a 412 (Precondition Failed) response and returns true if
+// the error of a mutation is a PreconditionError.
+func preconditionFailed(w http.ResponseWriter, r *http.Request, err error) bool {
+	if perr, ok := err.(PreconditionError); ok {
+		server.PreconditionFailed(w, r, "%v", perr)
+		return true
+	}
+	return false
+}
@@ -34,6 +34,9 @@ const (
 
 	// Stores the single repo-wide max label for the instance.  Used for new labels on split.
 	keyRepoLabelMax = 238
+
+	// Stores the body checkouts for each version of the instance.
+	keyCheckouts = 239
 )
 
 // DescribeTKeyClass returns a string explanation of what a particular TKeyClass
@@ -52,6 +55,8 @@ func (d *Data) DescribeTKeyClass(tkc storage.TKeyClass) string {
 		return "labelmap label max key"
 	case keyRepoLabelMax:
 		return "labelmap repo label max key"
+	case keyCheckouts:
+		return "labelmap body checkouts key"
 	default:
 	}
 	return "unknown labelmap key"
@@ -60,6 +65,7 @@ func (d *Data) DescribeTKeyClass(tkc storage.TKeyClass) string {
 var (
 	maxLabelTKey     = storage.NewTKey(keyLabelMax, nil)
 	maxRepoLabelTKey = storage.NewTKey(keyRepoLabelMax, nil)
+	checkoutsTKey    = storage.NewTKey(keyCheckouts, nil)
 )
 
 // NewBlockTKey returns a TKey for a label block, which is a slice suitable for
@@ -0,0 +1,109 @@
+package labelmap
+
+import (
+	"sort"
+	"sync"
+)
+
+// labelLocks holds the labels being modified by mutations.  A mutation holds every
+// existing label it modifies from the time its preconditions, e.g., If-Match entity tags,
+// are checked until it completes, so no other mutation can change those labels in between.
+type labelLocks struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	locked map[uint64]struct{}
+}
+
+// lock blocks until none of the given labels are held, then holds all of them.  Since
+// the labels are acquired together, mutations holding overlapping sets can't deadlock.
+func (l *labelLocks) lock(lbls []uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.cond == nil {
+		l.cond = sync.NewCond(&l.mu)
+		l.locked = make(map[uint64]struct{})
+	}
+	for {
+		var busy bool
+		for _, label := range lbls {
+			if _, busy = l.locked[label]; busy {
+				break
+			}
+		}
+		if !busy {
+			break
+		}
+		l.cond.Wait()
+	}
+	for _, label := range lbls {
+		l.locked[label] = struct{}{}
+	}
+}
+
+func (l *labelLocks) unlock(lbls []uint64) {
+	l.mu.Lock()
+	for _, label := range lbls {
+		delete(l.locked, label)
+	}
+	l.mu.Unlock()
+	l.cond.Broadcast()
+}
+
+// lockLabels holds the given labels against other mutations, returning a function that
+// releases them.  Label locks must be taken before any index shard lock or d.voxelMu.
+func (d *Data) lockLabels(lbls ...uint64) (unlock func()) {
+	held := uniqueLabels(lbls)
+	d.labelLocks.lock(held)
+	return func() { d.labelLocks.unlock(held) }
+}
+
+// lockChangingLabels holds the labels returned by getLabels, which may depend on label
+// state like the supervoxel mapping.  If the labels change before they are held, e.g., a
+// concurrent merge moves a supervoxel into another body, the labels are released and
+// the new ones are held instead.
+func (d *Data) lockChangingLabels(getLabels func() ([]uint64, error)) (lbls []uint64, unlock func(), err error) {
+	if lbls, err = getLabels(); err != nil {
+		return
+	}
+	for {
+		unlock = d.lockLabels(lbls...)
+		var cur []uint64
+		if cur, err = getLabels(); err != nil {
+			unlock()
+			return
+		}
+		if containsLabels(lbls, cur) {
+			return
+		}
+		unlock()
+		lbls = cur
+	}
+}
+
+// uniqueLabels returns the sorted, deduplicated labels.
+func uniqueLabels(lbls []uint64) []uint64 {
+	sorted := make([]uint64, len(lbls))
+	copy(sorted, lbls)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	unique := sorted[:0]
+	for i, label := range sorted {
+		if i == 0 || label != sorted[i-1] {
+			unique = append(unique, label)
+		}
+	}
+	return unique
+}
+
+// containsLabels returns true if every label in sub is also in lbls.
+func containsLabels(lbls, sub []uint64) bool {
+	set := make(map[uint64]struct{}, len(lbls))
+	for _, label := range lbls {
+		set[label] = struct{}{}
+	}
+	for _, label := range sub {
+		if _, found := set[label]; !found {
+			return false
+		}
+	}
+	return true
+}
@@ -107,6 +107,56 @@ $ dvid node <UUID> <data name> composite <uint8 data name> <new rgba8 data name>
     UUID          Hexadecimal string with enough characters to uniquely identify a version node.
     data name     Name of data to add.
 	
+$ dvid node <UUID> <data name> export-zarr <dir> <bounds> [settings...]
+
+    Asynchronously writes uint64 labels within the bounds to a chunked array in a local
+    directory visible to the DVID server.  Chunks are the size of label blocks and chunks
+    that are entirely zero are not written.  The lower bound is saved as a "voxel_offset"
+    [x,y,z] attribute of the array.
+
+    Example:
+
+    $ dvid node 3f8c segmentation export-zarr /data/seg.n5/s1 0,0,0,1024,1024,512 scale=1 format=n5
+
+    Arguments:
+
+    UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+    data name     Name of labelmap instance.
+    dir           Directory of the new array.
+    bounds        Voxel bounds at the given scale in the format "x0,y0,z0,x1,y1,z1" where
+                    the upper bounds are exclusive.
+
+    Settings:
+
+    scale         Scale to export, from 0 to MaxDownresLevel (default 0).
+    format        "zarr" for zarr v2 (default) or "n5".
+    compression   "gzip" (default), "raw", or for zarr only, "zlib".  Blosc is not supported.
+    supervoxels   If "true", exports unmapped supervoxels instead of body labels.
+
+$ dvid node <UUID> <data name> ingest-zarr <dir> [offset=x,y,z]
+
+    Asynchronously stores uint64 supervoxels from a zarr v2 or N5 array in a local directory
+    visible to the DVID server.  Labels are written in block-aligned subvolumes through the
+    normal label mutation path, so label indices, down-resolution scales, and syncs are
+    updated.  Chunks without files are skipped and voxels outside the array are preserved.
+    Only zarr arrays in C order without filters and with raw, gzip, or zlib compression are
+    supported.
+
+    Example:
+
+    $ dvid node 3f8c segmentation ingest-zarr /data/seg.zarr
+
+    Arguments:
+
+    UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+    data name     Name of labelmap instance.
+    dir           Directory of the array, holding either a zarr ".zarray" or N5 "attributes.json".
+
+    Settings:
+
+    offset        Voxel coordinate of the array's first voxel.  Defaults to the "voxel_offset"
+                    attribute of the array if present or 0,0,0 otherwise.
+
 $ dvid node <UUID> <data name> dump <dump type> <file path>
 
 	Dumps the internal state of the specified version of labelmap data into a space-delimted file.
@@ -356,7 +406,10 @@ GET  <api URL>/node/<UUID>/<data name>/raw/<dims>/<size>/<offset>[/<format>][?qu
                     available in server implementation.
                     2D: "png", "jpg" (default: "png")
                         jpg allows lossy quality setting, e.g., "jpg:80"
-                    nD: uses default "octet-stream".
+                    nD: uses default "octet-stream".  3d data also accepts "tiff" for an uncompressed
+                        multi-page TIFF with one page per z, or "nrrd" for an NRRD file.  Both include
+                        the voxel offset and the voxel resolution at the requested scale, and the
+                        compression option is ignored.
 
     Query-string Options:
 
@@ -373,7 +426,7 @@ GET  <api URL>/node/<UUID>/<data name>/raw/<dims>/<size>/<offset>[/<format>][?qu
     				call right away, a 503 (Service Unavailable) status code is returned.
 
 
-POST <api URL>/node/<UUID>/<data name>/raw/0_1_2/<size>/<offset>[?queryopts]
+POST <api URL>/node/<UUID>/<data name>/raw/0_1_2/<size>/<offset>[/<format>][?queryopts]
 
     Ingests block-aligned supervoxel data using the block sizes defined for this data instance.  
     For example, if the BlockSize = 32, offset and size must be multiples of 32.
@@ -388,6 +441,9 @@ POST <api URL>/node/<UUID>/<data name>/raw/0_1_2/<size>/<offset>[?queryopts]
     data name     Name of labelmap instance.
     size          Size in voxels along each dimension specified in <dims>.
     offset        Gives coordinate of first voxel using dimensionality of data.
+    format        If omitted, the POSTed body is uint64 labels in ZYX order.  Use "tiff" or "nrrd"
+                    to POST a multi-page TIFF or NRRD file of uint64 labels with the given size.
+                    The offset in the URL is used for the write.
 
     Query-string Options:
 
@@ -427,6 +483,68 @@ GET  <api URL>/node/<UUID>/<data name>/pseudocolor/<dims>/<size>/<offset>[?query
                     are handled.  If the server can't initiate the API call right away, a 503 (Service Unavailable) 
                     status code is returned.
 
+GET  <api URL>/node/<UUID>/<data name>/arb/<top left>/<top right>/<bottom left>/<res>[/<format>][?queryopts]
+
+    Retrieves labels on an arbitrarily oriented plane using the nearest voxel for each pixel.
+    Returns an image where the top left pixel corresponds to the real world coordinate
+    (not in voxel space but in space defined by resolution, e.g., nanometer space).  The
+    real world coordinates are specified in "x_y_z" format, e.g., "20.3_11.8_109.4".
+    The resolution is used to determine the # pixels in the returned image.
+
+    Example: 
+
+    GET <api URL>/node/3f8c/segmentation/arb/100.2_90_80.7/200.2_90_80.7/100.2_190.0_80.7/10.0?pseudocolor=true
+
+    Arguments:
+
+    UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+    data name     Name of labelmap instance.
+    top left      Real world coordinate (in nanometers) of top left pixel in returned image.
+    top right     Real world coordinate of top right pixel.
+    bottom left   Real world coordinate of bottom left pixel.
+    res           The resolution/pixel that is used to calculate the returned image size in pixels.
+    format        "png" (default) or another lossless format.  Labels are returned in the same
+                    image format as 2d "raw" requests unless pseudocolor is requested.
+
+    Query-string Options:
+
+    supervoxels   If "true", returns unmapped supervoxel labels instead of body labels.
+    scale         Sample voxels from the given down-resolution scale, where the voxel size is
+                    2^scale times the scale 0 voxel size.  Real world coordinates are unchanged.
+    pseudocolor   If "true", returns an RGB image where each label is hashed to a color, which
+                    can be overlaid on grayscale from the same arbitrary plane.
+    throttle      If "true", makes sure only N compute-intense operation (all API calls that can be throttled) 
+                    are handled.  If the server can't initiate the API call right away, a 503 (Service Unavailable) 
+                    status code is returned.
+
+GET  <api URL>/node/<UUID>/<data name>/precomputed[/<encoding>]/info
+GET  <api URL>/node/<UUID>/<data name>/precomputed[/<encoding>]/<scale>/<x0>-<x1>_<y0>-<y1>_<z0>-<z1>[?queryopts]
+
+    Read-only Neuroglancer precomputed segmentation, so a viewer can use the source
+    "precomputed://<api URL>/node/<UUID>/<data name>/precomputed" for any version.
+
+    The "info" JSON is generated from the data extents, resolution, block size, and
+    MaxDownresLevel.  Each scale uses the block size as chunk size with a block-aligned
+    voxel offset.  The resolution is in nanometers, converted from the voxel size and
+    units of the data.  Chunks are returned for a scale key (0 to MaxDownresLevel) and the
+    voxel bounds of the chunk at that scale, where the upper bounds are exclusive and
+    bounds can be negative, e.g., "-64--32_0-64_0-64".
+    Chunks that are exactly one block are encoded directly from the stored block.
+
+    Example: 
+
+    GET <api URL>/node/3f8c/segmentation/precomputed/2/0-64_64-128_0-64
+
+    Arguments:
+
+    UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+    data name     Name of labelmap instance.
+    encoding      Optional chunk encoding: "compressed_segmentation" (default) or "raw".
+
+    Query-string Options:
+
+    supervoxels   If "true", returns unmapped supervoxel labels instead of body labels.
+
 GET <api URL>/node/<UUID>/<data name>/label/<coord>[?queryopts]
 
 	Returns JSON for the label at the given coordinate:
@@ -722,6 +840,15 @@ GET <api URL>/node/<UUID>/<data name>/lastmod/<label>
 	
 	Time is returned in RFC3339 string format. Returns a status code 404 (Not Found)
     if label does not exist.
+
+	The mutation id is also used for optimistic concurrency on bodies.  GET requests on
+	/index, /sparsevol, /supervoxels, and /size return an ETag header for the body of the
+	form "<label>-<mutation id>".  If the tags of the bodies read are sent in an If-Match
+	header (comma-separated if more than one) with POST requests on /merge, /cleave, /split,
+	/split-supervoxel, or /batch, the mutation is rejected with status code 412 (Precondition
+	Failed) if any of those bodies have been modified or deleted since the tags were issued,
+	or if the mutation would modify an existing body whose tag was not sent.  The tags are
+	checked while the bodies are held against concurrent mutations.
 	
     Arguments:
     UUID          Hexadecimal string with enough characters to uniquely identify a version node.
@@ -734,7 +861,8 @@ GET <api URL>/node/<UUID>/<data name>/supervoxels/<label>
 
 	[ 23, 911, ...]
 
-	Returns a status code 404 (Not Found) if label does not exist.
+	Returns a status code 404 (Not Found) if label does not exist.  The ETag header
+	identifies the current state of the body (see /lastmod).
 	
     Arguments:
     UUID          Hexadecimal string with enough characters to uniquely identify a version node.
@@ -747,7 +875,8 @@ GET <api URL>/node/<UUID>/<data name>/size/<label>[?supervoxels=true]
 
 	{ "voxels": 2314 }
 	
-	Returns a status code 404 (Not Found) if label does not exist.
+	Returns a status code 404 (Not Found) if label does not exist.  The ETag header
+	identifies the current state of the body containing the label (see /lastmod).
 	
     Arguments:
     UUID          Hexadecimal string with enough characters to uniquely identify a version node.
@@ -801,7 +930,8 @@ GET  <api URL>/node/<UUID>/<data name>/sparsevol/<label>?<options>
 	Returns a sparse volume with voxels of the given label in encoded RLE format.  The returned
 	data can be optionally compressed using the "compression" option below.
 
-	Returns a status code 404 (Not Found) if label does not exist.
+	Returns a status code 404 (Not Found) if label does not exist.  The ETag header
+	identifies the current state of the body containing the label (see /lastmod).
 	
 	The encoding has the following possible format where integers are little endian and the order
 	of data is exactly as specified below:
@@ -1174,6 +1304,114 @@ POST <api URL>/node/<UUID>/<data name>/split/<label>
 		}
 
 
+POST <api URL>/node/<UUID>/<data name>/batch[?format=protobuf]
+
+	Applies an ordered list of merge, cleave, and split-supervoxel operations as a unit.
+	All operations are checked against the label state produced by the earlier operations
+	in the list before any data is modified.  If any operation fails, none of the batch is
+	applied.  Each operation is given a mutation ID from a contiguous range and the mutation
+	log is only written after the whole batch succeeds.  A single sync notification is sent
+	to synced data instances after the batch is applied.
+
+	By default the POSTed body is a JSON list of operations:
+
+		[
+			{ "Action": "merge", "Target": 23, "Labels": [8, 9] },
+			{ "Action": "cleave", "Target": 23, "CleavedSupervoxels": [101, 102] },
+			{ "Action": "split-supervoxel", "Supervoxel": 101, "Split": "<base64 sparse volume>" }
+		]
+
+	Cleave operations can give an optional "CleavedLabel" that must not already exist, and
+	split-supervoxel operations can give optional "SplitSupervoxel" and "RemainSupervoxel"
+	labels.  New labels are allocated for any that are not given.  The "Split" value is the
+	base64 encoding of the binary sparse volume described in POST /split-supervoxel.
+
+	If "format=protobuf" is given, the body is a protobuf serialization of a BatchOps message:
+
+	message BatchOp {
+		MergeOp merge = 1;
+		CleaveOp cleave = 2;
+		SupervoxelSplitOp svsplit = 3;
+		bytes rles = 4;  // split RLEs for a supervoxel split
+	}
+
+	message BatchOps {
+		repeated BatchOp ops = 1;
+	}
+
+	where exactly one of merge, cleave, or svsplit is set for each BatchOp, and MergeOp,
+	CleaveOp, and SupervoxelSplitOp are defined in datatype/common/proto/labelops.proto.
+	Any mutation ids in the messages are ignored.
+
+	Returns the first mutation ID of the batch and the applied operations, including their
+	mutation IDs and any newly allocated labels:
+
+		{
+			"MutationID": 1000000231,
+			"Ops": [
+				{ "Action": "merge", "Target": 23, "Labels": [8, 9], "MutationID": 1000000231 },
+				{ "Action": "cleave", "Target": 23, "CleavedLabel": 2001, "CleavedSupervoxels": [101, 102], "MutationID": 1000000232 },
+				...
+			]
+		}
+
+	Kafka JSON message generated by this request after the operations are applied and the
+	mutation log is flushed:
+		{ 
+			"Action": "batch",
+			"Ops": [ <one message per operation as for the individual endpoints> ],
+			"MutationID": <first mutation id of batch>,
+			"UUID": <UUID on which batch was done>
+		}
+
+	After lower-res scales are computed and synced data are notified, the following JSON
+	message is published:
+		{ 
+			"Action": "batch-complete",
+			"MutationID": <first mutation id of batch>,
+			"UUID": <UUID on which batch was done>
+		}
+
+	POST Query-string Options:
+
+	format  "protobuf" if the body is a serialized BatchOps message, otherwise JSON.
+	downres Defaults to "true" where all lower-res scales will be computed for supervoxel
+	          splits.  Use "false" if you plan on supplying lower-res scales via POST /blocks.
+
+GET    <api URL>/node/<UUID>/<data name>/checkout/<label>
+POST   <api URL>/node/<UUID>/<data name>/checkout/<label>?u=<user>[&ttl=<seconds>]
+DELETE <api URL>/node/<UUID>/<data name>/checkout/<label>?u=<user>
+
+	Checks out a body so only the given user may mutate it (POST), releases the checkout
+	held by the user (DELETE), or returns the current checkout (GET) as JSON:
+
+	{ "User": "johndoe", "Expires": "2000-02-01T12:13:14Z" }
+
+	While a body is checked out, merge, cleave, split, split-supervoxel, and batch requests
+	touching the body are refused unless their "u" query string matches the checkout user.
+	When checked out bodies are merged, the merged body inherits the checkout, and bodies
+	cleaved or split off a checked out body get the same checkout.  A user may POST again
+	to renew a checkout it already holds.  Expired checkouts are ignored and removed.
+	Checkouts are versioned, so a child version inherits the checkouts of its parent at the
+	time the child was created.  GET returns a status code 404 (Not Found) if the body is
+	not checked out.
+
+    Arguments:
+    UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+    data name     Name of labelmap instance.
+    label     	  A 64-bit integer label id
+
+    Query-string Options:
+
+    u             The user holding the checkout.
+    ttl           The duration of the checkout in seconds.  Defaults to 3600.
+
+GET <api URL>/node/<UUID>/<data name>/checkouts
+
+	Returns JSON of all unexpired checkouts for the version keyed by label:
+
+	{ "23": { "User": "johndoe", "Expires": "2000-02-01T12:13:14Z" }, ... }
+
 GET  <api URL>/node/<UUID>/<data name>/index/<label>
 POST <api URL>/node/<UUID>/<data name>/index/<label>
 
@@ -1181,7 +1419,8 @@ POST <api URL>/node/<UUID>/<data name>/index/<label>
 	for a label.  Typically, these indices are computed on-the-fly during ingestion of
 	of blocks of label voxels.  If there are cluster systems capable of computing label
 	blocks, indices, and affinities directly, though, it's more efficient to simply POST
-	them into dvid.
+	them into dvid.  A GET returns an ETag header identifying the current state of the
+	label (see /lastmod).
 
 	The returned (GET) or sent (POST) protobuf serialization of a LabelIndex message is defined by:
 
@@ -1199,6 +1438,61 @@ POST <api URL>/node/<UUID>/<data name>/index/<label>
 
 	If the blocks map is empty on a POST, the label index is deleted.
 	
+GET  <api URL>/node/<UUID>/<data name>/reindex
+POST <api URL>/node/<UUID>/<data name>/reindex[?labels=<label1>,<label2>,...][&roi=<roiname>,<uuid>][&verify=true]
+
+	The POST starts a background job that scans the scale 0 label blocks, recomputes the
+	label indices (blocks per supervoxel and their voxel count), and compares them with the
+	stored indices.  Mismatched indices are replaced with the recomputed ones unless "verify"
+	is "true", in which case the mismatches are only reported.  Without "labels" or "roi"
+	options, all blocks and label indices are checked, which could require a lot of memory
+	for large volumes.  If "labels" are given without an "roi", only the blocks in their
+	stored indices and connected blocks containing the labels are scanned, so a label whose
+	index is missing entirely requires an "roi" or a full scan.  Any block that can't be 
+	decoded aborts the job before any index is repaired.  Repaired indices get a new mutation
+	id and a label size change is sent to synced data.  A label whose index was modified by a
+	mutation after the job started is not compared or repaired since its recomputed index may
+	be stale; it is reported as a mismatch with "Changed" true.  Only one job can run at a time.
+
+	The GET returns the status of the last job as JSON:
+
+	{
+		"UUID": "28841c8277e044a7b187dda03e18da13",
+		"Labels": [23, 911],
+		"ROI": "myroi,28841c",
+		"Verify": true,
+		"Running": false,
+		"Started": "2000-02-01T12:13:14Z",
+		"Finished": "2000-02-01T12:20:14Z",
+		"BlocksScanned": 83718,
+		"LabelsChecked": 2,
+		"Mismatches": [
+			{
+				"Label": 23,
+				"StoredVoxels": 18381,
+				"ComputedVoxels": 18399,
+				"MissingBlocks": 1,
+				"ExtraBlocks": 0,
+				"CountBlocks": 2,
+				"Repaired": false,
+				"Changed": false
+			}
+		]
+	}
+
+	Mismatches are given only within the ROI if one was specified.  MissingBlocks are blocks
+	containing the label that weren't in the stored index, ExtraBlocks are blocks in the
+	stored index without the label, and CountBlocks are blocks whose supervoxel counts differ.
+	Any error that stopped the job is given in an "Error" property.  Returns a status code 
+	404 (Not Found) if no job has been run since the server started.
+
+    POST Query-string Options:
+
+    labels        Comma-separated list of labels (bodies) whose indices should be checked.
+    roi           Limits the check to blocks within the ROI given as "<roiname>,<uuid>".
+                  The ROI must have the same block size as the labelmap.
+    verify        If "true", only reports mismatches without repairing the indices.
+
 POST <api URL>/node/<UUID>/<data name>/indices
 
 	Allows bulk storage of indices (blocks per supervoxel and their voxel count) for any
@@ -1431,6 +1725,14 @@ type Data struct {
 	mlMu sync.RWMutex // For atomic access of MaxLabel and MaxRepoLabel
 
 	voxelMu sync.Mutex // Only allow voxel-level label mutation ops sequentially.
+
+	labelLocks labelLocks // labels held by in-progress mutations
+
+	checkouts  map[dvid.VersionID]checkoutMap // cached body checkouts per version
+	checkoutMu sync.Mutex
+
+	reindexJob *ReindexJob // status of last reindex job
+	reindexMu  sync.Mutex
 }
 
 // GetMaxDownresLevel returns the number of down-res levels, where level 0 = high-resolution
@@ -2664,6 +2966,51 @@ func (d *Data) DoRPC(req datastore.Request, reply *datastore.Response) error {
 		}
 		return d.createComposite(req, reply)
 
+	case "export-zarr":
+		blockSize, ok := d.BlockSize().(dvid.Point3d)
+		if !ok {
+			return fmt.Errorf("block size for data %q should be 3d, not: %s", d.DataName(), d.BlockSize())
+		}
+		uuid, v, scale, a, err := imageblk.ParseExportCommand(req, dvid.T_uint64, blockSize)
+		if err != nil {
+			return err
+		}
+		if scale > d.MaxDownresLevel {
+			return fmt.Errorf("scale %d exceeds max downres level %d of data %q", scale, d.MaxDownresLevel, d.DataName())
+		}
+		supervoxels, _, err := req.Settings().GetBool("supervoxels")
+		if err != nil {
+			return err
+		}
+		if err = datastore.AddToNodeLog(uuid, []string{req.Command.String()}); err != nil {
+			return err
+		}
+		reply.Text = fmt.Sprintf("Exporting labelmap %q @ node %s to %s %q...\n", d.DataName(), uuid, a.Format, a.Dir)
+		go func() {
+			if err := d.ExportChunkedArray(v, scale, supervoxels, a); err != nil {
+				dvid.Errorf("Cannot export labelmap %q @ node %s to %q: %v\n", d.DataName(), uuid, a.Dir, err)
+			}
+		}()
+		return nil
+
+	case "ingest-zarr":
+		uuid, v, a, err := imageblk.ParseIngestCommand(req, dvid.T_uint64)
+		if err != nil {
+			return err
+		}
+		if err = datastore.AddToNodeLog(uuid, []string{req.Command.String()}); err != nil {
+			return err
+		}
+		reply.Text = fmt.Sprintf("Ingesting %s %q into labelmap %q @ node %s...\n", a.Format, a.Dir, d.DataName(), uuid)
+		d.StartUpdate()
+		go func() {
+			defer d.StopUpdate()
+			if err := d.IngestChunkedArray(v, a); err != nil {
+				dvid.Errorf("Cannot ingest %q into labelmap %q @ node %s: %v\n", a.Dir, d.DataName(), uuid, err)
+			}
+		}()
+		return nil
+
 	case "dump":
 		if len(req.Command) < 6 {
 			return fmt.Errorf("poorly formatted dump command.  See command-line help")
@@ -3056,7 +3403,7 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 	// Prevent use of APIs that require IndexedLabels when it is not set.
 	if !d.IndexedLabels {
 		switch parts[3] {
-		case "sparsevol", "sparsevol-by-point", "sparsevol-coarse", "maxlabel", "nextlabel", "split-supervoxel", "cleave", "merge":
+		case "sparsevol", "sparsevol-by-point", "sparsevol-coarse", "maxlabel", "nextlabel", "split-supervoxel", "cleave", "merge", "batch", "checkout", "checkouts", "reindex":
 			server.BadRequest(w, r, "data %q is not label indexed (IndexedLabels=false): %q endpoint is not supported", d.DataName(), parts[3])
 			return
 		}
@@ -3156,6 +3503,12 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 	case "raw", "isotropic":
 		d.handleDataRequest(ctx, w, r, parts)
 
+	case "arb":
+		d.handleArb(ctx, w, r, parts)
+
+	case "precomputed":
+		d.handlePrecomputed(ctx, w, r, parts)
+
 	// endpoints after this must have data instance IndexedLabels = true
 
 	case "lastmod":
@@ -3203,6 +3556,18 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 	case "merge":
 		d.handleMerge(ctx, w, r, parts)
 
+	case "batch":
+		d.handleBatch(ctx, w, r)
+
+	case "checkout":
+		d.handleCheckout(ctx, w, r, parts)
+
+	case "checkouts":
+		d.handleCheckouts(ctx, w, r)
+
+	case "reindex":
+		d.handleReindex(ctx, w, r)
+
 	case "index":
 		d.handleIndex(ctx, w, r, parts)
 
@@ -3515,6 +3880,7 @@ func (d *Data) handleIndex(ctx *datastore.VersionedCtx, w http.ResponseWriter, r
 			server.BadRequest(w, r, err)
 			return
 		}
+		w.Header().Set("ETag", labelETag(label, idx))
 		w.Header().Set("Content-type", "application/octet-stream")
 		n, err := w.Write(serialization)
 		if err != nil {
@@ -3794,7 +4160,17 @@ func (d *Data) handleDataRequest(ctx *datastore.VersionedCtx, w http.ResponseWri
 				server.BadRequest(w, r, err)
 				return
 			}
-			if err := sendBinaryData(compression, data, subvol, w); err != nil {
+			if len(parts) >= 8 && dvid.IsVolumeFormat(parts[7]) {
+				meta, err := d.VolumeMetadata(subvol, scale)
+				if err != nil {
+					server.BadRequest(w, r, err)
+					return
+				}
+				if err := dvid.WriteVolumeHTTP(w, parts[7], meta, data); err != nil {
+					server.BadRequest(w, r, err)
+					return
+				}
+			} else if err := sendBinaryData(compression, data, subvol, w); err != nil {
 				server.BadRequest(w, r, err)
 				return
 			}
@@ -3803,8 +4179,13 @@ func (d *Data) handleDataRequest(ctx *datastore.VersionedCtx, w http.ResponseWri
 				server.BadRequest(w, r, "can only POST 'raw' not 'isotropic' images")
 				return
 			}
-			estsize := subvol.NumVoxels() * 8
-			data, err := GetBinaryData(compression, r.Body, estsize)
+			var data []byte
+			if len(parts) >= 8 && dvid.IsVolumeFormat(parts[7]) {
+				data, err = d.ReadVolumeFormat(parts[7], r.Body, subvol)
+			} else {
+				estsize := subvol.NumVoxels() * 8
+				data, err = GetBinaryData(compression, r.Body, estsize)
+			}
 			if err != nil {
 				server.BadRequest(w, r, err)
 				return
@@ -3855,6 +4236,96 @@ func (d *Data) GetSupervoxels(v dvid.VersionID, label uint64) (labels.Set, error
 	return idx.GetSupervoxels(), nil
 }
 
+// GetLabelBlockIndices returns the blocks at the given scale that contain the label, or
+// just the given supervoxel if isSupervoxel is true.  Returns nil if the label isn't found.
+func (d *Data) GetLabelBlockIndices(v dvid.VersionID, label uint64, scale uint8, isSupervoxel bool) (dvid.IZYXSlice, error) {
+	if isSupervoxel {
+		blocks, err := GetSupervoxelBlocks(d, v, label)
+		if err != nil || len(blocks) == 0 {
+			return nil, err
+		}
+		return blocks.Downres(scale)
+	}
+	idx, err := GetLabelIndex(d, v, label, false)
+	if err != nil {
+		return nil, err
+	}
+	return idx.GetProcessedBlockIndices(scale, dvid.Bounds{})
+}
+
+// GetLabelBlockVoxels returns the number of voxels of the label in each scale 0 block
+// containing the label.  Returns nil if the label isn't found.
+func (d *Data) GetLabelBlockVoxels(v dvid.VersionID, label uint64) (map[dvid.IZYXString]uint64, error) {
+	idx, err := GetLabelIndex(d, v, label, false)
+	if err != nil || idx == nil {
+		return nil, err
+	}
+	counts := make(map[dvid.IZYXString]uint64, len(idx.Blocks))
+	for zyx, svc := range idx.Blocks {
+		if svc == nil {
+			continue
+		}
+		var numVoxels uint64
+		for _, count := range svc.Counts {
+			numVoxels += uint64(count)
+		}
+		if numVoxels != 0 {
+			counts[labels.BlockIndexToIZYXString(zyx)] = numVoxels
+		}
+	}
+	return counts, nil
+}
+
+// GetLabelSubBlockVoxels returns the number of voxels of the label in each sub-block of the
+// given size that intersects the given scale 0 blocks.  Sub-blocks are keyed by their
+// coordinate in units of the sub-block size, which allows counting voxels in regions that
+// don't align with label blocks, e.g., finer ROI blocks.
+func (d *Data) GetLabelSubBlockVoxels(v dvid.VersionID, label uint64, blocks dvid.IZYXSlice, subSize dvid.Point3d) (map[dvid.IZYXString]uint64, error) {
+	for i := 0; i < 3; i++ {
+		if subSize[i] <= 0 {
+			return nil, fmt.Errorf("bad sub-block size %s for label %d voxel counts", subSize, label)
+		}
+	}
+	idx, err := GetLabelIndex(d, v, label, false)
+	if err != nil || idx == nil {
+		return nil, err
+	}
+	ctx := datastore.NewVersionedCtx(d, v)
+	counts := make(map[dvid.IZYXString]uint64)
+	for _, izyx := range blocks {
+		bcoord, err := izyx.ToChunkPoint3d()
+		if err != nil {
+			return nil, err
+		}
+		svc, found := idx.Blocks[labels.EncodeBlockIndex(bcoord[0], bcoord[1], bcoord[2])]
+		if !found || svc == nil || len(svc.Counts) == 0 {
+			continue
+		}
+		pb, err := d.getLabelBlock(ctx, 0, izyx)
+		if err != nil {
+			return nil, err
+		}
+		if pb == nil {
+			return nil, fmt.Errorf("label %d index has block %s that is not stored", label, bcoord)
+		}
+		blockData, size := pb.MakeLabelVolume()
+		offset := dvid.Point3d{bcoord[0] * size[0], bcoord[1] * size[1], bcoord[2] * size[2]}
+		var i int
+		for z := int32(0); z < size[2]; z++ {
+			for y := int32(0); y < size[1]; y++ {
+				for x := int32(0); x < size[0]; x, i = x+1, i+8 {
+					if _, inLabel := svc.Counts[binary.LittleEndian.Uint64(blockData[i:i+8])]; !inLabel {
+						continue
+					}
+					pt := dvid.Point3d{offset[0] + x, offset[1] + y, offset[2] + z}
+					counts[pt.Chunk(subSize).(dvid.ChunkPoint3d).ToIZYXString()]++
+				}
+			}
+		}
+	}
+	return counts, nil
+}
+
 func (d *Data) handleSupervoxels(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
 	// GET <api URL>/node/<UUID>/<data name>/supervoxels/<label>
 	if len(parts) < 5 {
@@ -3881,6 +4352,10 @@ func (d *Data) handleSupervoxels(ctx *datastore.VersionedCtx, w http.ResponseWri
 	if len(supervoxels) == 0 {
 		w.WriteHeader(http.StatusNotFound)
 	} else {
+		if err := d.setLabelETag(w, ctx.VersionID(), label, false); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
 		w.Header().Set("Content-type", "application/json")
 		fmt.Fprintf(w, "[")
 		i := 0
@@ -3963,6 +4438,10 @@ func (d *Data) handleSize(ctx *datastore.VersionedCtx, w http.ResponseWriter, r
 	if size == 0 {
 		w.WriteHeader(http.StatusNotFound)
 	} else {
+		if err := d.setLabelETag(w, ctx.VersionID(), label, isSupervoxel); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
 		w.Header().Set("Content-type", "application/json")
 		fmt.Fprintf(w, `{"voxels": %d}`, size)
 	}
@@ -4115,6 +4594,10 @@ func (d *Data) handleSparsevol(ctx *datastore.VersionedCtx, w http.ResponseWrite
 	timedLog := dvid.NewTimeLog()
 	switch strings.ToLower(r.Method) {
 	case "get":
+		if err := d.setLabelETag(w, ctx.VersionID(), label, isSupervoxel); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
 		w.Header().Set("Content-type", "application/octet-stream")
 
 		var found bool
@@ -4137,6 +4620,10 @@ func (d *Data) handleSparsevol(ctx *datastore.VersionedCtx, w http.ResponseWrite
 		}
 
 	case "head":
+		if err := d.setLabelETag(w, ctx.VersionID(), label, isSupervoxel); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
 		w.Header().Set("Content-type", "text/html")
 		found, err := d.FoundSparseVol(ctx, label, b, isSupervoxel)
 		if err != nil {
@@ -4451,8 +4938,16 @@ func (d *Data) handleSplitSupervoxel(ctx *datastore.VersionedCtx, w http.Respons
 		server.BadRequest(w, r, "Label 0 is protected background value and cannot be used as split target\n")
 		return
 	}
+	ifMatch, err := ParseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
+		server.BadRequest(w, r, "bad If-Match header: %v", err)
+		return
+	}
 	info := dvid.GetModInfo(r)
-	splitSupervoxel, remainSupervoxel, mutID, err := d.SplitSupervoxel(ctx.VersionID(), supervoxel, split, remain, r.Body, info, downscale)
+	splitSupervoxel, remainSupervoxel, mutID, err := d.SplitSupervoxel(ctx.VersionID(), supervoxel, split, remain, r.Body, info, ifMatch, downscale)
+	if preconditionFailed(w, r, err) {
+		return
+	}
 	if err != nil {
 		server.BadRequest(w, r, fmt.Sprintf("split supervoxel %d -> %d, %d: %v", supervoxel, splitSupervoxel, remainSupervoxel, err))
 		return
@@ -4484,8 +4979,16 @@ func (d *Data) handleCleave(ctx *datastore.VersionedCtx, w http.ResponseWriter,
 		server.BadRequest(w, r, "Label 0 is protected background value and cannot be used as cleave target\n")
 		return
 	}
+	ifMatch, err := ParseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
+		server.BadRequest(w, r, "bad If-Match header: %v", err)
+		return
+	}
 	modInfo := dvid.GetModInfo(r)
-	cleaveLabel, mutID, err := d.CleaveLabel(ctx.VersionID(), label, modInfo, r.Body)
+	cleaveLabel, mutID, err := d.CleaveLabel(ctx.VersionID(), label, modInfo, ifMatch, r.Body)
+	if preconditionFailed(w, r, err) {
+		return
+	}
 	if err != nil {
 		server.BadRequest(w, r, err)
 		return
@@ -4517,8 +5020,16 @@ func (d *Data) handleSplit(ctx *datastore.VersionedCtx, w http.ResponseWriter, r
 		server.BadRequest(w, r, "Label 0 is protected background value and cannot be used as sparse volume.\n")
 		return
 	}
+	ifMatch, err := ParseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
+		server.BadRequest(w, r, "bad If-Match header: %v", err)
+		return
+	}
 	info := dvid.GetModInfo(r)
-	toLabel, mutID, err := d.SplitLabels(ctx.VersionID(), fromLabel, r.Body, info)
+	toLabel, mutID, err := d.SplitLabels(ctx.VersionID(), fromLabel, r.Body, info, ifMatch)
+	if preconditionFailed(w, r, err) {
+		return
+	}
 	if err != nil {
 		server.BadRequest(w, r, fmt.Sprintf("split label %d: %v", fromLabel, err))
 		return
@@ -4552,8 +5063,16 @@ func (d *Data) handleMerge(ctx *datastore.VersionedCtx, w http.ResponseWriter, r
 		server.BadRequest(w, r, err)
 		return
 	}
+	ifMatch, err := ParseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
+		server.BadRequest(w, r, "bad If-Match header: %v", err)
+		return
+	}
 	info := dvid.GetModInfo(r)
-	mutID, err := d.MergeLabels(ctx.VersionID(), mergeOp, info)
+	mutID, err := d.MergeLabels(ctx.VersionID(), mergeOp, info, ifMatch)
+	if preconditionFailed(w, r, err) {
+		return
+	}
 	if err != nil {
 		server.BadRequest(w, r, fmt.Sprintf("Error on merge: %v", err))
 		return
@@ -4564,6 +5083,213 @@ func (d *Data) handleMerge(ctx *datastore.VersionedCtx, w http.ResponseWriter, r
 	timedLog.Infof("HTTP merge request (%s)", r.URL)
 }
 
+func (d *Data) handleBatch(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request) {
+	// POST <api URL>/node/<UUID>/<data name>/batch[?format=protobuf]
+	if strings.ToLower(r.Method) != "post" {
+		server.BadRequest(w, r, "Batch requests must be POST actions.")
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+
+	queryStrings := r.URL.Query()
+	downscale := true
+	if queryStrings.Get("downres") == "false" {
+		downscale = false
+	}
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		server.BadRequest(w, r, "Bad POSTed data for batch: %v", err)
+		return
+	}
+	var ops []BatchOp
+	switch queryStrings.Get("format") {
+	case "", "json":
+		ops, err = DecodeBatchJSON(data)
+	case "protobuf":
+		ops, err = DecodeBatchProtobuf(data)
+	default:
+		server.BadRequest(w, r, "unknown batch format %q, must be json or protobuf", queryStrings.Get("format"))
+		return
+	}
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	ifMatch, err := ParseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
+		server.BadRequest(w, r, "bad If-Match header: %v", err)
+		return
+	}
+	info := dvid.GetModInfo(r)
+	mutID, err := d.ApplyBatch(ctx.VersionID(), ops, info, ifMatch, downscale)
+	if preconditionFailed(w, r, err) {
+		return
+	}
+	if err != nil {
+		server.BadRequest(w, r, fmt.Sprintf("Error on batch: %v", err))
+		return
+	}
+	results := make([]batchOpJSON, len(ops))
+	for i, op := range ops {
+		results[i] = op.resultJSON()
+	}
+	jsonBytes, err := json.Marshal(struct {
+		MutationID uint64
+		Ops        []batchOpJSON
+	}{mutID, results})
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(jsonBytes))
+
+	timedLog.Infof("HTTP batch of %d ops request (%s)", len(ops), r.URL)
+}
+
+func (d *Data) handleCheckout(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
+	// GET    <api URL>/node/<UUID>/<data name>/checkout/<label>
+	// POST   <api URL>/node/<UUID>/<data name>/checkout/<label>?u=<user>[&ttl=<seconds>]
+	// DELETE <api URL>/node/<UUID>/<data name>/checkout/<label>?u=<user>
+	if len(parts) < 5 {
+		server.BadRequest(w, r, "DVID requires label to follow 'checkout' command")
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+
+	label, err := strconv.ParseUint(parts[4], 10, 64)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	if label == 0 {
+		server.BadRequest(w, r, "Label 0 is protected background value and cannot be checked out\n")
+		return
+	}
+	user := dvid.GetModInfo(r).User
+
+	var checkout Checkout
+	switch strings.ToLower(r.Method) {
+	case "get":
+		checkouts, err := d.GetCheckouts(ctx.VersionID())
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		var found bool
+		if checkout, found = checkouts[label]; !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+	case "post":
+		ttl := DefaultCheckoutTTL
+		if ttlStr := r.URL.Query().Get("ttl"); ttlStr != "" {
+			seconds, err := strconv.ParseUint(ttlStr, 10, 32)
+			if err != nil {
+				server.BadRequest(w, r, "bad ttl query string provided: %s", ttlStr)
+				return
+			}
+			ttl = time.Duration(seconds) * time.Second
+		}
+		if checkout, err = d.CheckoutLabel(ctx.VersionID(), label, user, ttl); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+	case "delete":
+		if err := d.ReleaseLabel(ctx.VersionID(), label, user); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		timedLog.Infof("HTTP DELETE checkout of label %d by user %q (%s)", label, user, r.URL)
+		return
+	default:
+		server.BadRequest(w, r, "only GET, POST, or DELETE actions allowed for /checkout endpoint")
+		return
+	}
+	jsonBytes, err := json.Marshal(checkout)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(jsonBytes))
+
+	timedLog.Infof("HTTP %s checkout of label %d (%s)", r.Method, label, r.URL)
+}
+
+func (d *Data) handleCheckouts(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request) {
+	// GET <api URL>/node/<UUID>/<data name>/checkouts
+	if strings.ToLower(r.Method) != "get" {
+		server.BadRequest(w, r, "only GET action allowed for /checkouts endpoint")
+		return
+	}
+	timedLog := dvid.NewTimeLog()
+
+	checkouts, err := d.GetCheckouts(ctx.VersionID())
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	jsonBytes, err := json.Marshal(checkouts)
+	if err != nil {
+		server.BadRequest(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, string(jsonBytes))
+
+	timedLog.Infof("HTTP GET checkouts (%s)", r.URL)
+}
+
+func (d *Data) handleReindex(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request) {
+	// GET  <api URL>/node/<UUID>/<data name>/reindex
+	// POST <api URL>/node/<UUID>/<data name>/reindex[?labels=...][&roi=...][&verify=true]
+	timedLog := dvid.NewTimeLog()
+
+	switch strings.ToLower(r.Method) {
+	case "get":
+		job := d.GetReindexJob()
+		if job == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		jsonBytes, err := json.Marshal(job)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, string(jsonBytes))
+
+	case "post":
+		queryStrings := r.URL.Query()
+		var lbls []uint64
+		if labelsStr := queryStrings.Get("labels"); labelsStr != "" {
+			for _, labelStr := range strings.Split(labelsStr, ",") {
+				label, err := strconv.ParseUint(strings.TrimSpace(labelStr), 10, 64)
+				if err != nil {
+					server.BadRequest(w, r, "bad label %q in labels query string: %v", labelStr, err)
+					return
+				}
+				if label != 0 {
+					lbls = append(lbls, label)
+				}
+			}
+		}
+		verify := queryStrings.Get("verify") == "true"
+		if err := d.StartReindex(ctx.VersionID(), lbls, queryStrings.Get("roi"), verify, dvid.GetModInfo(r)); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+
+	default:
+		server.BadRequest(w, r, "only GET or POST action allowed for /reindex endpoint")
+		return
+	}
+
+	timedLog.Infof("HTTP %s reindex (%s)", r.Method, r.URL)
+}
+
 // --------- Other functions on labelmap Data -----------------
 
 // GetLabelBlock returns a compressed label Block of the given block coordinate.
@@ -4710,7 +5436,7 @@ func (d *Data) GetLabelPoints(v dvid.VersionID, pts []dvid.Point3d, scale uint8,
 
 	// Get mapping.
 	var mapping *SVMap
-	var ancestry []uint8
+	var ancestry []shortVersion
 	if !useSupervoxels {
 		if mapping, err = getMapping(d, v); err != nil {
 			return nil, err
@@ -4786,7 +5512,7 @@ func (d *Data) GetLabelPointsInSupervoxels(v dvid.VersionID, pts []dvid.Point3d,
 	// Get labels covered and selected supervoxels in each to check.
 	labelSupervoxels := make(map[uint64]labels.Set)
 	var mapping *SVMap
-	var ancestry []uint8
+	var ancestry []shortVersion
 	if mapping, err = getMapping(d, v); err != nil {
 		return nil, err
 	}
@@ -20,6 +20,7 @@ import (
 	"github.com/janelia-flyem/dvid/datastore"
 	"github.com/janelia-flyem/dvid/datatype/common/downres"
 	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/datatype/roi"
 	"github.com/janelia-flyem/dvid/dvid"
 	"github.com/janelia-flyem/dvid/server"
 	lz4 "github.com/janelia-flyem/go/golz4-updated"
@@ -2081,3 +2082,133 @@ func TestLabels(t *testing.T) {
 func TestLabelsUnindexed(t *testing.T) {
 	testLabels(t, false)
 }
+
+func TestROIFromLabels(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+	vol := newTestVolume(128, 128, 128)
+	vol.addSubvol(dvid.Point3d{0, 0, 0}, dvid.Point3d{40, 32, 32}, 1)
+	vol.addSubvol(dvid.Point3d{64, 64, 64}, dvid.Point3d{64, 64, 32}, 2)
+	vol.put(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	server.CreateTestInstance(t, uuid, "roi", "bodyroi", dvid.Config{})
+	config.Set("BlockSize", "64,64,64")
+	server.CreateTestInstance(t, uuid, "roi", "bigroi", config)
+
+	testROI := func(name, query, labelsJSON string, expected []dvid.Span) {
+		url := fmt.Sprintf("%snode/%s/%s/from-labels/labels%s", server.WebAPIPath, uuid, name, query)
+		server.TestHTTP(t, "POST", url, strings.NewReader(labelsJSON))
+		url = fmt.Sprintf("%snode/%s/%s/roi", server.WebAPIPath, uuid, name)
+		var spans []dvid.Span
+		if err := json.Unmarshal(server.TestHTTP(t, "GET", url, nil), &spans); err != nil {
+			t.Fatalf("Error on getting back JSON from roi GET: %v\n", err)
+		}
+		if !reflect.DeepEqual(spans, expected) {
+			t.Fatalf("Bad ROI %q from labels %s%s\nExpected:\n%v\nReturned:\n%v\n", name, labelsJSON, query, expected, spans)
+		}
+	}
+	testROI("bodyroi", "", "[1, 2]", []dvid.Span{{0, 0, 0, 1}, {2, 2, 2, 3}, {2, 3, 2, 3}})
+	testROI("bodyroi", "", "[2]", []dvid.Span{{2, 2, 2, 3}, {2, 3, 2, 3}})
+	testROI("bodyroi", "?supervoxels=true", "[1]", []dvid.Span{{0, 0, 0, 1}})
+	testROI("bigroi", "?scale=1", "[1, 2]", []dvid.Span{{0, 0, 0, 0}, {1, 1, 1, 1}})
+
+	badURL := fmt.Sprintf("%snode/%s/bodyroi/from-labels/labels", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "POST", badURL+"?scale=1", strings.NewReader("[1]"))
+	server.TestBadHTTP(t, "POST", badURL, strings.NewReader("[0]"))
+	server.TestBadHTTP(t, "POST", badURL, strings.NewReader("1, 2"))
+	server.TestBadHTTP(t, "GET", badURL, nil)
+	server.TestBadHTTP(t, "POST", fmt.Sprintf("%snode/%s/bodyroi/from-labels/bigroi", server.WebAPIPath, uuid), strings.NewReader("[1]"))
+}
+
+func TestROIOverlap(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+	vol := newTestVolume(128, 128, 128)
+	vol.addSubvol(dvid.Point3d{0, 0, 0}, dvid.Point3d{40, 32, 32}, 1)
+	vol.addSubvol(dvid.Point3d{64, 64, 64}, dvid.Point3d{64, 64, 32}, 2)
+	vol.put(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	// Default 64 voxel label blocks are coarser than default 32 voxel ROI blocks.
+	var config64 dvid.Config
+	config64.Set("VoxelSize", "8,8,40")
+	config64.Set("VoxelUnits", "nanometers")
+	server.CreateTestInstance(t, uuid, "labelmap", "labels64", config64)
+	vol.put(t, uuid, "labels64")
+	if err := datastore.BlockOnUpdating(uuid, "labels64"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	server.CreateTestInstance(t, uuid, "roi", "smallroi", dvid.Config{})
+	config.Set("BlockSize", "64,64,64")
+	server.CreateTestInstance(t, uuid, "roi", "bigroi", config)
+	config.Set("BlockSize", "48,48,48")
+	server.CreateTestInstance(t, uuid, "roi", "oddroi", config)
+	roiURL := fmt.Sprintf("%snode/%s/smallroi/roi", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", roiURL, strings.NewReader("[[0,0,1,1],[2,2,2,2]]"))
+	roiURL = fmt.Sprintf("%snode/%s/bigroi/roi", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", roiURL, strings.NewReader("[[0,0,0,0]]"))
+	roiURL = fmt.Sprintf("%snode/%s/oddroi/roi", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", roiURL, strings.NewReader("[[1,1,1,1]]"))
+
+	testOverlapLabels := func(name, labelName, query, expected string) {
+		url := fmt.Sprintf("%snode/%s/%s/overlap/%s?%s", server.WebAPIPath, uuid, name, labelName, query)
+		got := string(server.TestHTTP(t, "GET", url, nil))
+		if got != expected {
+			t.Fatalf("Bad overlap from %s\nExpected: %s\nReturned: %s\n", url, expected, got)
+		}
+	}
+	testOverlapLabels("smallroi", "labels64", "labels=1,2,3", `[{"Label":1,"Voxels":8192},{"Label":2,"Voxels":32768},{"Label":3,"Voxels":0}]`)
+	testOverlapLabels("bigroi", "labels64", "labels=1,2", `[{"Label":1,"Voxels":40960},{"Label":2,"Voxels":0}]`)
+	testOverlapLabels("oddroi", "labels64", "labels=1,2", `[{"Label":1,"Voxels":0},{"Label":2,"Voxels":32768}]`)
+	testOverlapLabels("oddroi", "labels", "labels=1,2", `[{"Label":1,"Voxels":0},{"Label":2,"Voxels":32768}]`)
+
+	testOverlap := func(name, query, expected string) {
+		url := fmt.Sprintf("%snode/%s/%s/overlap/labels?%s", server.WebAPIPath, uuid, name, query)
+		got := string(server.TestHTTP(t, "GET", url, nil))
+		if got != expected {
+			t.Fatalf("Bad overlap from %s\nExpected: %s\nReturned: %s\n", url, expected, got)
+		}
+	}
+	testOverlap("smallroi", "labels=1,2,3", `[{"Label":1,"Voxels":8192},{"Label":2,"Voxels":32768},{"Label":3,"Voxels":0}]`)
+	testOverlap("smallroi", "labels=1,2&scale=0", `[{"Label":1,"Blocks":1},{"Label":2,"Blocks":1}]`)
+	testOverlap("bigroi", "labels=1,2", `[{"Label":1,"Voxels":40960},{"Label":2,"Voxels":0}]`)
+	testOverlap("bigroi", "labels=1,2&scale=1", `[{"Label":1,"Blocks":1},{"Label":2,"Blocks":0}]`)
+
+	badURL := fmt.Sprintf("%snode/%s/smallroi/overlap/labels", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", badURL, nil)
+	server.TestBadHTTP(t, "GET", badURL+"?labels=1,a", nil)
+	server.TestBadHTTP(t, "GET", badURL+"?labels=1&scale=1", nil)
+	server.TestBadHTTP(t, "GET", fmt.Sprintf("%snode/%s/oddroi/overlap/labels?labels=1&scale=0", server.WebAPIPath, uuid), nil)
+	server.TestBadHTTP(t, "GET", fmt.Sprintf("%snode/%s/smallroi/overlap/bigroi?labels=1", server.WebAPIPath, uuid), nil)
+
+	// ROI stats can use the resolution of a label instance.
+	statsURL := fmt.Sprintf("%snode/%s/smallroi/stats", server.WebAPIPath, uuid)
+	var stats roi.Stats
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", statsURL+"?resolution=labels64", nil), &stats); err != nil {
+		t.Fatalf("Bad stats response: %v\n", err)
+	}
+	if !stats.VoxelSize.Equals(dvid.NdFloat32{8, 8, 40}) || stats.VoxelUnits != "nanometers" || stats.Volume != 2*32*32*32*8*8*40 {
+		t.Fatalf("Bad stats using labelmap resolution: %v\n", stats)
+	}
+	server.TestBadHTTP(t, "GET", statsURL+"?resolution=missing", nil)
+}
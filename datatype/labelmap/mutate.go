@@ -42,12 +42,25 @@ type sizeChange struct {
 //
 // labels.MergeEndEvent occurs at end of merge and transmits labels.DeltaMergeEnd struct.
 //
-func (d *Data) MergeLabels(v dvid.VersionID, op labels.MergeOp, info dvid.ModInfo) (mutID uint64, err error) {
+func (d *Data) MergeLabels(v dvid.VersionID, op labels.MergeOp, info dvid.ModInfo, ifMatch LabelETags) (mutID uint64, err error) {
 	dvid.Debugf("Merging %s into label %d ...\n", op.Merged, op.Target)
 
 	d.StartUpdate()
 	defer d.StopUpdate()
 
+	modified := []uint64{op.Target}
+	for label := range op.Merged {
+		modified = append(modified, label)
+	}
+	unlock := d.lockLabels(modified...)
+	defer unlock()
+	if err = d.checkIfMatch(v, ifMatch, modified...); err != nil {
+		return
+	}
+	if err = d.checkMergeCheckouts(v, info.User, op); err != nil {
+		return
+	}
+
 	timedLog := dvid.NewTimeLog()
 	mutID = d.NewMutationID()
 
@@ -79,6 +92,45 @@ func (d *Data) MergeLabels(v dvid.VersionID, op labels.MergeOp, info dvid.ModInf
 		return
 	}
 
+	var delta labels.DeltaMerge
+	if delta, err = d.mergeLabels(d, v, mutID, op, info); err != nil {
+		return
+	}
+	if err := d.mergeCheckouts(v, op); err != nil {
+		dvid.Errorf("unable to pass checkouts of merged labels %s to label %d: %v\n", op.Merged, op.Target, err)
+	}
+
+	evt = datastore.SyncEvent{d.DataUUID(), labels.MergeBlockEvent}
+	msg = datastore.SyncMessage{labels.MergeBlockEvent, v, delta}
+	if err = datastore.NotifySubscribers(evt, msg); err != nil {
+		err = fmt.Errorf("can't notify subscribers for event %v: %v\n", evt, err)
+		return
+	}
+
+	evt = datastore.SyncEvent{d.DataUUID(), labels.MergeEndEvent}
+	msg = datastore.SyncMessage{labels.MergeEndEvent, v, labels.DeltaMergeEnd{delta.MergeOp}}
+	if err := datastore.NotifySubscribers(evt, msg); err != nil {
+		dvid.Criticalf("can't notify subscribers for event %v: %v\n", evt, err)
+	}
+
+	timedLog.Infof("Merged %s -> %d, data %q, resulting in %d blocks", delta.Merged, delta.Target, d.DataName(), len(delta.Blocks))
+
+	// send kafka merge complete event to instance-uuid topic
+	msginfo = map[string]interface{}{
+		"Action":     "merge-complete",
+		"MutationID": mutID,
+		"UUID":       string(versionuuid),
+		"Timestamp":  time.Now().String(),
+	}
+	jsonmsg, _ = json.Marshal(msginfo)
+	err = d.ProduceKafkaMsg(jsonmsg)
+	return
+}
+
+// mergeLabels does the index and mapping changes for a merge without sending kafka
+// messages or sync events.  Mutation log entries are written through logd, which is
+// normally the receiver but can buffer entries when the merge is part of a batch.
+func (d *Data) mergeLabels(logd dvid.Data, v dvid.VersionID, mutID uint64, op labels.MergeOp, info dvid.ModInfo) (delta labels.DeltaMerge, err error) {
 	// Get all the affected blocks in the merge.
 	var targetIdx, mergeIdx *labels.Index
 	if targetIdx, err = GetLabelIndex(d, v, op.Target, false); err != nil {
@@ -94,11 +146,11 @@ func (d *Data) MergeLabels(v dvid.VersionID, op labels.MergeOp, info dvid.ModInf
 		return
 	}
 
-	if err = addMergeToMapping(d, v, mutID, op.Target, mergeIdx); err != nil {
+	if err = addMergeToMapping(logd, v, mutID, op.Target, mergeIdx); err != nil {
 		return
 	}
 
-	delta := labels.DeltaMerge{
+	delta = labels.DeltaMerge{
 		MergeOp:      op,
 		TargetVoxels: targetIdx.NumVoxels(),
 		MergedVoxels: mergeIdx.NumVoxels(),
@@ -118,37 +170,13 @@ func (d *Data) MergeLabels(v dvid.VersionID, op labels.MergeOp, info dvid.ModInf
 	for merged := range delta.Merged {
 		DeleteLabelIndex(d, v, merged)
 	}
-	if err = labels.LogMerge(d, v, op); err != nil {
+	if err = labels.LogMerge(logd, v, op); err != nil {
 		return
 	}
 
 	dvid.Infof("merged label %d: supervoxels %v, %d blocks\n", op.Target, mergeIdx.GetSupervoxels(), len(mergeIdx.Blocks))
 
 	delta.Blocks = targetIdx.GetBlockIndices()
-	evt = datastore.SyncEvent{d.DataUUID(), labels.MergeBlockEvent}
-	msg = datastore.SyncMessage{labels.MergeBlockEvent, v, delta}
-	if err = datastore.NotifySubscribers(evt, msg); err != nil {
-		err = fmt.Errorf("can't notify subscribers for event %v: %v\n", evt, err)
-		return
-	}
-
-	evt = datastore.SyncEvent{d.DataUUID(), labels.MergeEndEvent}
-	msg = datastore.SyncMessage{labels.MergeEndEvent, v, labels.DeltaMergeEnd{delta.MergeOp}}
-	if err := datastore.NotifySubscribers(evt, msg); err != nil {
-		dvid.Criticalf("can't notify subscribers for event %v: %v\n", evt, err)
-	}
-
-	timedLog.Infof("Merged %s -> %d, data %q, resulting in %d blocks", delta.Merged, delta.Target, d.DataName(), len(delta.Blocks))
-
-	// send kafka merge complete event to instance-uuid topic
-	msginfo = map[string]interface{}{
-		"Action":     "merge-complete",
-		"MutationID": mutID,
-		"UUID":       string(versionuuid),
-		"Timestamp":  time.Now().String(),
-	}
-	jsonmsg, _ = json.Marshal(msginfo)
-	err = d.ProduceKafkaMsg(jsonmsg)
 	return
 }
 
@@ -159,11 +187,19 @@ func (d *Data) MergeLabels(v dvid.VersionID, op labels.MergeOp, info dvid.ModInf
 // given a new label or the one optionally supplied via the "cleavelabel" query string.
 // A cleave label can be specified via the "toLabel" parameter, which if 0 will have an
 // automatic label ID selected for the cleaved body.
-func (d *Data) CleaveLabel(v dvid.VersionID, label uint64, info dvid.ModInfo, r io.ReadCloser) (cleaveLabel, mutID uint64, err error) {
+func (d *Data) CleaveLabel(v dvid.VersionID, label uint64, info dvid.ModInfo, ifMatch LabelETags, r io.ReadCloser) (cleaveLabel, mutID uint64, err error) {
 	if r == nil {
 		err = fmt.Errorf("no cleave supervoxels JSON was POSTed")
 		return
 	}
+	unlock := d.lockLabels(label)
+	defer unlock()
+	if err = d.checkIfMatch(v, ifMatch, label); err != nil {
+		return
+	}
+	if err = d.checkCheckouts(v, info.User, label); err != nil {
+		return
+	}
 
 	cleaveLabel, err = d.newLabel(v)
 	if err != nil {
@@ -213,14 +249,11 @@ func (d *Data) CleaveLabel(v dvid.VersionID, label uint64, info dvid.ModInfo, r
 		CleavedLabel:       cleaveLabel,
 		CleavedSupervoxels: cleaveSupervoxels,
 	}
-	if err = CleaveIndex(d, v, op, info); err != nil {
+	if err = d.cleaveLabel(d, v, op, info); err != nil {
 		return
 	}
-	if err = addCleaveToMapping(d, v, op); err != nil {
-		return
-	}
-	if err = labels.LogCleave(d, v, op); err != nil {
-		return
+	if err := d.copyCheckout(v, label, cleaveLabel); err != nil {
+		dvid.Errorf("unable to pass checkout of label %d to cleaved label %d: %v\n", label, cleaveLabel, err)
 	}
 
 	// notify syncs after processing because downstream sync might rely on changes
@@ -244,6 +277,18 @@ func (d *Data) CleaveLabel(v dvid.VersionID, label uint64, info dvid.ModInfo, r
 	return
 }
 
+// cleaveLabel does the index and mapping changes for a cleave without sending kafka
+// messages or sync events.  Mutation log entries are written through logd.
+func (d *Data) cleaveLabel(logd dvid.Data, v dvid.VersionID, op labels.CleaveOp, info dvid.ModInfo) error {
+	if err := CleaveIndex(d, v, op, info); err != nil {
+		return err
+	}
+	if err := addCleaveToMapping(logd, v, op); err != nil {
+		return err
+	}
+	return labels.LogCleave(logd, v, op)
+}
+
 // created while iterating over all split RLEs and computing what the
 // split supervoxels should be and the # voxels split for each supervoxel per block.
 type blockSplitsMap map[uint64]map[uint64]labels.SVSplitCount
@@ -499,9 +544,18 @@ func getAffectedBlocks(idx *labels.Index, svsplit *labels.SVSplitMap) (affectedB
 // to submit for relabeling the smaller portion of any split.  It is assumed that the given split
 // voxels are within the fromLabel set of voxels and will generate unspecified behavior if this is
 // not the case.
-func (d *Data) SplitLabels(v dvid.VersionID, fromLabel uint64, r io.ReadCloser, info dvid.ModInfo) (toLabel, mutID uint64, err error) {
+func (d *Data) SplitLabels(v dvid.VersionID, fromLabel uint64, r io.ReadCloser, info dvid.ModInfo, ifMatch LabelETags) (toLabel, mutID uint64, err error) {
 	timedLog := dvid.NewTimeLog()
 
+	unlock := d.lockLabels(fromLabel)
+	defer unlock()
+	if err = d.checkIfMatch(v, ifMatch, fromLabel); err != nil {
+		return
+	}
+	if err = d.checkCheckouts(v, info.User, fromLabel); err != nil {
+		return
+	}
+
 	// Create a new label id for this version that will persist to store
 	toLabel, err = d.newLabel(v)
 	if err != nil {
@@ -635,6 +689,9 @@ func (d *Data) SplitLabels(v dvid.VersionID, fromLabel uint64, r io.ReadCloser,
 	if err = downresMut.Execute(); err != nil {
 		return
 	}
+	if err := d.copyCheckout(v, fromLabel, toLabel); err != nil {
+		dvid.Errorf("unable to pass checkout of label %d to split label %d: %v\n", fromLabel, toLabel, err)
+	}
 
 	timedLog.Debugf("completed labelmap split (%d affected, %d split blocks) of %d -> %d", len(affectedBlocks), len(splitmap), fromLabel, toLabel)
 
@@ -669,7 +726,7 @@ func (d *Data) SplitLabels(v dvid.VersionID, fromLabel uint64, r io.ReadCloser,
 // The input is a binary sparse volume and should be totally contained by the given supervoxel.
 // The first returned label is assigned to the split voxels while the second returned label is
 // assigned to the remainder voxels.
-func (d *Data) SplitSupervoxel(v dvid.VersionID, svlabel, splitlabel, remainlabel uint64, r io.ReadCloser, info dvid.ModInfo, downscale bool) (splitSupervoxel, remainSupervoxel, mutID uint64, err error) {
+func (d *Data) SplitSupervoxel(v dvid.VersionID, svlabel, splitlabel, remainlabel uint64, r io.ReadCloser, info dvid.ModInfo, ifMatch LabelETags, downscale bool) (splitSupervoxel, remainSupervoxel, mutID uint64, err error) {
 	timedLog := dvid.NewTimeLog()
 
 	// Create new labels for this split that will persist to store
@@ -702,20 +759,32 @@ func (d *Data) SplitSupervoxel(v dvid.VersionID, svlabel, splitlabel, remainlabe
 		dvid.Infof("split on supervoxel %d -> %d was given split size of 0\n", svlabel, remainlabel)
 	}
 
-	// read parent label index and do simple check on split size
-	var mapping *SVMap
-	mapping, err = getMapping(d, v)
+	// hold the label containing the supervoxel, then read its index and do simple check on split size
+	held, unlock, err := d.lockChangingLabels(func() ([]uint64, error) {
+		mapping, err := getMapping(d, v)
+		if err != nil {
+			return nil, err
+		}
+		if mapping != nil {
+			if mapped, found := mapping.MappedLabel(v, svlabel); found {
+				if mapped == 0 {
+					return nil, fmt.Errorf("cannot get label for supervoxel %d, which has been split and doesn't exist anymore", svlabel)
+				}
+				return []uint64{mapped}, nil
+			}
+		}
+		return []uint64{svlabel}, nil
+	})
 	if err != nil {
 		return
 	}
-	label := svlabel
-	if mapping != nil {
-		if mapped, found := mapping.MappedLabel(v, svlabel); found {
-			if mapped == 0 {
-				err = fmt.Errorf("cannot get label for supervoxel %d, which has been split and doesn't exist anymore", svlabel)
-			}
-			label = mapped
-		}
+	defer unlock()
+	label := held[0]
+	if err = d.checkIfMatch(v, ifMatch, label); err != nil {
+		return
+	}
+	if err = d.checkCheckouts(v, info.User, label); err != nil {
+		return
 	}
 	shard := label % numIndexShards
 	indexMu[shard].Lock()
@@ -798,7 +867,47 @@ func (d *Data) SplitSupervoxel(v dvid.VersionID, svlabel, splitlabel, remainlabe
 		downresMut = downres.NewMutation(d, v, mutID)
 	}
 
+	ctx := datastore.NewVersionedCtx(d, v)
 	var splitblks dvid.IZYXSlice
+	if splitblks, _, err = d.splitSupervoxelLocked(d, ctx, op, idx, info, downresMut); err != nil {
+		return
+	}
+
+	if downresMut != nil {
+		if err = downresMut.Execute(); err != nil {
+			dvid.Criticalf("down-res compute of supervoxel split %d failed with error: %v\n", svlabel, err)
+			dvid.Criticalf("down-res error can lead to sync issue between scale 0 and higher affecting these blocks: %s\n", splitblks)
+			return
+		}
+	}
+
+	timedLog.Debugf("labelmap supervoxel %d split complete (%d blocks split)", op.Supervoxel, len(op.Split))
+
+	evt := datastore.SyncEvent{d.DataUUID(), labels.SupervoxelSplitEvent}
+	msg := datastore.SyncMessage{labels.SupervoxelSplitEvent, v, op}
+	if err := datastore.NotifySubscribers(evt, msg); err != nil {
+		dvid.Errorf("can't notify subscribers for event %v: %v\n", evt, err)
+	}
+
+	msginfo = map[string]interface{}{
+		"Action":     "split-supervoxel-complete",
+		"MutationID": mutID,
+		"UUID":       string(versionuuid),
+		"Timestamp":  time.Now().String(),
+	}
+	jsonmsg, _ = json.Marshal(msginfo)
+	if err = d.ProduceKafkaMsg(jsonmsg); err != nil {
+		dvid.Errorf("error on sending split complete op to kafka: %v", err)
+	}
+	return
+}
+
+// splitSupervoxelLocked relabels the scale 0 blocks and modifies the index and mapping for
+// a supervoxel split without sending kafka messages or sync events.  The caller must hold
+// the index shard lock for the supervoxel's label and the voxel mutex.  The original blocks
+// are returned so callers can restore them if later processing fails.
+func (d *Data) splitSupervoxelLocked(logd dvid.Data, ctx *datastore.VersionedCtx, op labels.SplitSupervoxelOp, idx *labels.Index, info dvid.ModInfo, downresMut *downres.Mutation) (splitblks dvid.IZYXSlice, origBlocks []*labels.PositionedBlock, err error) {
+	v := ctx.VersionID()
 	if splitblks, err = d.splitSupervoxelIndex(v, info, op, idx); err != nil {
 		return
 	}
@@ -806,15 +915,17 @@ func (d *Data) SplitSupervoxel(v dvid.VersionID, svlabel, splitlabel, remainlabe
 	getLog := dvid.NewTimeLog()
 	blockCh := make(chan *labels.PositionedBlock, len(splitblks))
 	errCh := make(chan error, len(splitblks))
-	ctx := datastore.NewVersionedCtx(d, v)
 
 	numHandlers := 16
 	for i := 0; i < numHandlers; i++ {
 		go d.splitSupervoxelThread(ctx, downresMut, op, idx.Blocks, blockCh, errCh)
 	}
 
-	origBlocks := make([]*labels.PositionedBlock, len(splitblks))
+	origBlocks = make([]*labels.PositionedBlock, len(splitblks))
 	var numBlocks int
+	defer func() {
+		origBlocks = origBlocks[:numBlocks]
+	}()
 	var scale uint8
 	for _, izyx := range splitblks {
 		var pb *labels.PositionedBlock
@@ -824,7 +935,7 @@ func (d *Data) SplitSupervoxel(v dvid.VersionID, svlabel, splitlabel, remainlabe
 			return
 		}
 		if pb == nil {
-			dvid.Errorf("supervoxel split of %d: block %s should have been split but was nil\n", svlabel, izyx)
+			dvid.Errorf("supervoxel split of %d: block %s should have been split but was nil\n", op.Supervoxel, izyx)
 			continue
 		}
 		origBlocks[numBlocks] = pb
@@ -833,7 +944,7 @@ func (d *Data) SplitSupervoxel(v dvid.VersionID, svlabel, splitlabel, remainlabe
 	}
 
 	// Wait for all blocks in supervoxel to be relabeled before returning.
-	getLog.Debugf("supervoxel split of %d: got %d blocks", svlabel, numBlocks)
+	getLog.Debugf("supervoxel split of %d: got %d blocks", op.Supervoxel, numBlocks)
 	var numErr int
 	for i := 0; i < numBlocks; i++ {
 		processErr := <-errCh
@@ -844,14 +955,16 @@ func (d *Data) SplitSupervoxel(v dvid.VersionID, svlabel, splitlabel, remainlabe
 	}
 	close(blockCh)
 	if err != nil {
-		err = fmt.Errorf("supervoxel split of %d: %d errors, last one: %v", svlabel, numErr, err)
+		err = fmt.Errorf("supervoxel split of %d: %d errors, last one: %v", op.Supervoxel, numErr, err)
 		d.restoreOldBlocks(ctx, numBlocks, origBlocks)
 		return
 	}
-	if err = addSupervoxelSplitToMapping(d, v, op); err != nil {
+	if err = addSupervoxelSplitToMapping(logd, v, op); err != nil {
+		d.restoreOldBlocks(ctx, numBlocks, origBlocks)
 		return
 	}
-	if err = labels.LogSupervoxelSplit(d, v, op); err != nil {
+	if err = labels.LogSupervoxelSplit(logd, v, op); err != nil {
+		d.restoreOldBlocks(ctx, numBlocks, origBlocks)
 		return
 	}
 	// store the new split index
@@ -860,33 +973,6 @@ func (d *Data) SplitSupervoxel(v dvid.VersionID, svlabel, splitlabel, remainlabe
 		err = fmt.Errorf("split supervoxel index for data %q, supervoxel %d: %v", d.DataName(), op.Supervoxel, err)
 		return
 	}
-
-	if downresMut != nil {
-		if err = downresMut.Execute(); err != nil {
-			dvid.Criticalf("down-res compute of supervoxel split %d failed with error: %v\n", svlabel, err)
-			dvid.Criticalf("down-res error can lead to sync issue between scale 0 and higher affecting these blocks: %s\n", splitblks)
-			return
-		}
-	}
-
-	timedLog.Debugf("labelmap supervoxel %d split complete (%d blocks split)", op.Supervoxel, len(op.Split))
-
-	evt := datastore.SyncEvent{d.DataUUID(), labels.SupervoxelSplitEvent}
-	msg := datastore.SyncMessage{labels.SupervoxelSplitEvent, v, op}
-	if err := datastore.NotifySubscribers(evt, msg); err != nil {
-		dvid.Errorf("can't notify subscribers for event %v: %v\n", evt, err)
-	}
-
-	msginfo = map[string]interface{}{
-		"Action":     "split-supervoxel-complete",
-		"MutationID": mutID,
-		"UUID":       string(versionuuid),
-		"Timestamp":  time.Now().String(),
-	}
-	jsonmsg, _ = json.Marshal(msginfo)
-	if err = d.ProduceKafkaMsg(jsonmsg); err != nil {
-		dvid.Errorf("error on sending split complete op to kafka: %v", err)
-	}
 	return
 }
 
@@ -6,9 +6,14 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"image"
+	_ "image/png"
 	"io"
+	"io/ioutil"
 	"math/rand"
 	"net/http"
+	"net/http/httptest"
+	"os"
 	"reflect"
 	"runtime"
 	"strings"
@@ -20,6 +25,7 @@ import (
 	"github.com/janelia-flyem/dvid/datatype/common/downres"
 	"github.com/janelia-flyem/dvid/datatype/common/labels"
 	"github.com/janelia-flyem/dvid/datatype/common/proto"
+	"github.com/janelia-flyem/dvid/datatype/imageblk"
 	"github.com/janelia-flyem/dvid/dvid"
 	"github.com/janelia-flyem/dvid/server"
 
@@ -424,6 +430,30 @@ func (b testBody) isDeleted(t *testing.T, encoding []byte, bspan dvid.Span) bool
 	return true
 }
 
+// returns the binary sparse volume encoding of the body as used for split requests.
+func (b testBody) sparseVol(t *testing.T) []byte {
+	numspans := len(b.voxelSpans)
+	rles := make(dvid.RLEs, numspans)
+	for i, span := range b.voxelSpans {
+		start := dvid.Point3d{span[2], span[1], span[0]}
+		length := span[3] - span[2] + 1
+		rles[i] = dvid.NewRLE(start, length)
+	}
+	buf := new(bytes.Buffer)
+	buf.WriteByte(dvid.EncodingBinary)
+	binary.Write(buf, binary.LittleEndian, uint8(3))         // # of dimensions
+	binary.Write(buf, binary.LittleEndian, byte(0))          // dimension of run (X = 0)
+	buf.WriteByte(byte(0))                                   // reserved for later
+	binary.Write(buf, binary.LittleEndian, uint32(0))        // Placeholder for # voxels
+	binary.Write(buf, binary.LittleEndian, uint32(numspans)) // Placeholder for # spans
+	rleBytes, err := rles.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Unable to serialize RLEs: %v\n", err)
+	}
+	buf.Write(rleBytes)
+	return buf.Bytes()
+}
+
 func checkSpans(t *testing.T, encoding []byte, minx, maxx int32) {
 	// Get to the  # spans and RLE in encoding
 	spansEncoding := encoding[8:]
@@ -2135,6 +2165,576 @@ func TestMergeCleave(t *testing.T) {
 	dvid.Infof("storage details: %s\n", stats)
 }
 
+func TestBatchResultSortedLabels(t *testing.T) {
+	merged := make(labels.Set)
+	for label := uint64(1); label <= 50; label++ {
+		merged[label*7%51] = struct{}{}
+	}
+	op := BatchOp{Merge: &labels.MergeOp{Target: 100, Merged: merged}}
+	result := op.resultJSON()
+	if len(result.Labels) != len(merged) {
+		t.Fatalf("expected %d merged labels, got %v\n", len(merged), result.Labels)
+	}
+	for i := 1; i < len(result.Labels); i++ {
+		if result.Labels[i-1] >= result.Labels[i] {
+			t.Fatalf("expected sorted merged labels, got %v\n", result.Labels)
+		}
+	}
+}
+
+func TestBatchMutations(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+	expected := createLabelTestVolume(t, uuid, "labels")
+
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	// batch that fails on last op should leave labels untouched.
+	reqStr := fmt.Sprintf("%snode/%s/labels/batch", server.WebAPIPath, uuid)
+	badBatch := `[
+		{"Action": "merge", "Target": 4, "Labels": [1]},
+		{"Action": "cleave", "Target": 4, "CleavedSupervoxels": [99]}
+	]`
+	server.TestBadHTTP(t, "POST", reqStr, bytes.NewBufferString(badBatch))
+	badBatch = `[
+		{"Action": "merge", "Target": 4, "Labels": [3]},
+		{"Action": "cleave", "Target": 4, "CleavedSupervoxels": [3, 4]}
+	]`
+	server.TestBadHTTP(t, "POST", reqStr, bytes.NewBufferString(badBatch))
+
+	// a failed batch shouldn't allocate labels for its valid ops.
+	badBatch = `[
+		{"Action": "merge", "Target": 4, "Labels": [2, 3]},
+		{"Action": "cleave", "Target": 4, "CleavedSupervoxels": [3]},
+		{"Action": "cleave", "Target": 4, "CleavedLabel": 20, "CleavedSupervoxels": [2]},
+		{"Action": "cleave", "Target": 4, "CleavedSupervoxels": [99]}
+	]`
+	server.TestBadHTTP(t, "POST", reqStr, bytes.NewBufferString(badBatch))
+	maxLabelResp := server.TestHTTP(t, "GET", fmt.Sprintf("%snode/%s/labels/maxlabel", server.WebAPIPath, uuid), nil)
+	if string(maxLabelResp) != `{"maxlabel": 4}` {
+		t.Errorf("bad max label after failed batch: %s\n", string(maxLabelResp))
+	}
+
+	retrieved := newTestVolume(128, 128, 128)
+	retrieved.get(t, uuid, "labels", false)
+	if err := retrieved.equals(expected); err != nil {
+		t.Fatalf("label volume changed after failed batch: %v\n", err)
+	}
+
+	// merge 3 into 4, cleave it back out into a new label, and merge that into 2.
+	batch := `[
+		{"Action": "merge", "Target": 4, "Labels": [3]},
+		{"Action": "cleave", "Target": 4, "CleavedSupervoxels": [3]},
+		{"Action": "merge", "Target": 2, "Labels": [5]}
+	]`
+	r := server.TestHTTP(t, "POST", reqStr+"?u=mrsmith", bytes.NewBufferString(batch))
+	var result struct {
+		MutationID uint64
+		Ops        []struct {
+			Action       string
+			CleavedLabel uint64
+			MutationID   uint64
+		}
+	}
+	if err := json.Unmarshal(r, &result); err != nil {
+		t.Fatalf("unable to parse batch response %q: %v\n", string(r), err)
+	}
+	if len(result.Ops) != 3 {
+		t.Fatalf("expected 3 ops in batch response, got: %s\n", string(r))
+	}
+	if result.Ops[1].CleavedLabel != 5 {
+		t.Errorf("expected cleaved label 5, got %d\n", result.Ops[1].CleavedLabel)
+	}
+	for i, op := range result.Ops {
+		if op.MutationID != result.MutationID+uint64(i) {
+			t.Errorf("expected op %d to have mutation id %d, got %d\n", i, result.MutationID+uint64(i), op.MutationID)
+		}
+	}
+
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	reqStr = fmt.Sprintf("%snode/%s/labels/lastmod/2", server.WebAPIPath, uuid)
+	r = server.TestHTTP(t, "GET", reqStr, nil)
+	var infoVal struct {
+		MutID uint64 `json:"mutation id"`
+		User  string `json:"last mod user"`
+	}
+	if err := json.Unmarshal(r, &infoVal); err != nil {
+		t.Fatalf("unable to get mod info for label 2: %v", err)
+	}
+	if infoVal.MutID != result.MutationID+2 || infoVal.User != "mrsmith" {
+		t.Errorf("unexpected last mod info for label 2: %v\n", infoVal)
+	}
+
+	reqStr = fmt.Sprintf("%snode/%s/labels/sparsevol/3", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", reqStr, nil)
+	reqStr = fmt.Sprintf("%snode/%s/labels/sparsevol/5", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", reqStr, nil)
+
+	retrieved.get(t, uuid, "labels", false)
+	expected.addBody(body3, 2)
+	if err := retrieved.equals(expected); err != nil {
+		t.Errorf("label volume after batch not equal to expected volume: %v\n", err)
+	}
+	retrieved.get(t, uuid, "labels", true)
+	expected.addBody(body3, 3)
+	if err := retrieved.equals(expected); err != nil {
+		t.Errorf("supervoxel volume after batch not equal to expected volume: %v\n", err)
+	}
+
+	// protobuf batch: merge 4 into 1, split supervoxel 4 entirely, then cleave the split supervoxel off.
+	sv4 := body4.sparseVol(t)
+	pbatch := proto.BatchOps{
+		Ops: []*proto.BatchOp{
+			{Merge: &proto.MergeOp{Target: 1, Merged: []uint64{4}}},
+			{Svsplit: &proto.SupervoxelSplitOp{Supervoxel: 4, Splitlabel: 10, Remainlabel: 11}, Rles: sv4},
+			{Cleave: &proto.CleaveOp{Target: 1, Cleaved: []uint64{10}}},
+		},
+	}
+	serialization, err := pbatch.Marshal()
+	if err != nil {
+		t.Fatalf("unable to serialize batch: %v\n", err)
+	}
+	reqStr = fmt.Sprintf("%snode/%s/labels/batch?format=protobuf", server.WebAPIPath, uuid)
+	r = server.TestHTTP(t, "POST", reqStr, bytes.NewBuffer(serialization))
+	if err := json.Unmarshal(r, &result); err != nil {
+		t.Fatalf("unable to parse batch response %q: %v\n", string(r), err)
+	}
+	if len(result.Ops) != 3 || result.Ops[2].CleavedLabel != 12 {
+		t.Fatalf("expected cleave into label 12, got response: %s\n", string(r))
+	}
+	if err := downres.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on update for labels: %v\n", err)
+	}
+	retrieved.get(t, uuid, "labels", false)
+	expected.addBody(body1, 1)
+	expected.addBody(body2, 2)
+	expected.addBody(body3, 2)
+	expected.addBody(body4, 12)
+	if err := retrieved.equals(expected); err != nil {
+		t.Errorf("label volume after protobuf batch not equal to expected volume: %v\n", err)
+	}
+	retrieved.get(t, uuid, "labels", true)
+	expected.addBody(body2, 2)
+	expected.addBody(body3, 3)
+	expected.addBody(body4, 10)
+	if err := retrieved.equals(expected); err != nil {
+		t.Errorf("supervoxel volume after protobuf batch not equal to expected volume: %v\n", err)
+	}
+}
+
+func TestLabelETags(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+	createLabelTestVolume(t, uuid, "labels")
+
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	getETag := func(endpoint string) string {
+		reqStr := fmt.Sprintf("%snode/%s/labels/%s", server.WebAPIPath, uuid, endpoint)
+		resp := server.TestHTTPResponse(t, "GET", reqStr, nil)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("bad response (%d) to GET %q\n", resp.Code, reqStr)
+		}
+		return resp.Header().Get("ETag")
+	}
+	mutate := func(endpoint, ifMatch, body string) int {
+		reqStr := fmt.Sprintf("%snode/%s/labels/%s", server.WebAPIPath, uuid, endpoint)
+		req, err := http.NewRequest("POST", reqStr, bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("unable to create request %q: %v\n", reqStr, err)
+		}
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		resp := httptest.NewRecorder()
+		server.ServeSingleHTTP(resp, req)
+		return resp.Code
+	}
+
+	tag4 := getETag("size/4")
+	if tag4 != `"4-0"` {
+		t.Fatalf("expected ETag \"4-0\" for unmodified label 4, got %s\n", tag4)
+	}
+	if tag := getETag("sparsevol/4"); tag != tag4 {
+		t.Fatalf("expected sparsevol ETag %s, got %s\n", tag4, tag)
+	}
+	tag3 := getETag("supervoxels/3")
+	if tag := getETag("index/3"); tag != tag3 {
+		t.Fatalf("expected index ETag %s, got %s\n", tag3, tag)
+	}
+
+	if code := mutate("merge", "bad tag", "[4, 3]"); code != http.StatusBadRequest {
+		t.Fatalf("expected bad request for malformed If-Match, got %d\n", code)
+	}
+	if code := mutate("merge", tag4+", "+tag3, "[4, 3]"); code != http.StatusOK {
+		t.Fatalf("expected merge with current ETags to succeed, got %d\n", code)
+	}
+
+	// supervoxel 3 is now in body 4, which has a new ETag.
+	newTag4 := getETag("size/3?supervoxels=true")
+	if newTag4 == tag4 || !strings.HasPrefix(newTag4, `"4-`) {
+		t.Fatalf("expected new ETag for body 4 after merge, got %s\n", newTag4)
+	}
+	if tag := getETag("size/4"); tag != newTag4 {
+		t.Fatalf("expected ETag %s for body 4, got %s\n", newTag4, tag)
+	}
+
+	// stale ETags, including one for the merged label 3, should be rejected.
+	if code := mutate("cleave/4", tag4, "[3]"); code != http.StatusPreconditionFailed {
+		t.Fatalf("expected cleave with stale ETag to fail with 412, got %d\n", code)
+	}
+	if code := mutate("cleave/4", newTag4+","+tag3, "[3]"); code != http.StatusPreconditionFailed {
+		t.Fatalf("expected cleave with ETag of deleted label to fail with 412, got %d\n", code)
+	}
+	if code := mutate("cleave/4", newTag4, "[3]"); code != http.StatusOK {
+		t.Fatalf("expected cleave with current ETag to succeed, got %d\n", code)
+	}
+	if code := mutate("merge", newTag4, "[4, 1]"); code != http.StatusPreconditionFailed {
+		t.Fatalf("expected merge with stale ETag to fail with 412, got %d\n", code)
+	}
+
+	// every existing label modified by a mutation must be tagged.
+	curTag4 := getETag("size/4")
+	if code := mutate("merge", curTag4, "[4, 1]"); code != http.StatusPreconditionFailed {
+		t.Fatalf("expected merge without ETag for merged label 1 to fail with 412, got %d\n", code)
+	}
+	if code := mutate("merge", curTag4+","+getETag("size/1"), "[4, 1]"); code != http.StatusOK {
+		t.Fatalf("expected merge with ETags of all modified labels to succeed, got %d\n", code)
+	}
+	if code := mutate("merge", "*", "[4, 2]"); code != http.StatusOK {
+		t.Fatalf("expected merge with If-Match * to succeed, got %d\n", code)
+	}
+}
+
+func TestBodyCheckouts(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+	createLabelTestVolume(t, uuid, "labels")
+
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	apiStr := fmt.Sprintf("%snode/%s/labels/", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "POST", apiStr+"checkout/4", nil)
+	server.TestBadHTTP(t, "POST", apiStr+"checkout/100?u=alice", nil)
+	server.TestHTTP(t, "POST", apiStr+"checkout/4?u=alice&ttl=600", nil)
+	server.TestBadHTTP(t, "POST", apiStr+"checkout/4?u=bob", nil)
+	server.TestHTTP(t, "POST", apiStr+"checkout/4?u=alice", nil)
+
+	var checkout Checkout
+	r := server.TestHTTP(t, "GET", apiStr+"checkout/4", nil)
+	if err := json.Unmarshal(r, &checkout); err != nil {
+		t.Fatalf("unable to parse checkout %q: %v\n", string(r), err)
+	}
+	if checkout.User != "alice" || checkout.Expires.Before(time.Now().Add(50*time.Minute)) {
+		t.Fatalf("unexpected checkout of label 4: %v\n", checkout)
+	}
+	resp := server.TestHTTPResponse(t, "GET", apiStr+"checkout/3", nil)
+	if resp.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for label 3 that isn't checked out, got %d\n", resp.Code)
+	}
+
+	// only alice can mutate label 4 and the merged body inherits the checkout.
+	server.TestBadHTTP(t, "POST", apiStr+"merge?u=bob", bytes.NewBufferString("[3, 4]"))
+	server.TestBadHTTP(t, "POST", apiStr+"merge", bytes.NewBufferString("[3, 4]"))
+	server.TestHTTP(t, "POST", apiStr+"merge?u=alice", bytes.NewBufferString("[3, 4]"))
+	var checkouts map[uint64]Checkout
+	r = server.TestHTTP(t, "GET", apiStr+"checkouts", nil)
+	if err := json.Unmarshal(r, &checkouts); err != nil {
+		t.Fatalf("unable to parse checkouts %q: %v\n", string(r), err)
+	}
+	if len(checkouts) != 1 || checkouts[3].User != "alice" {
+		t.Fatalf("expected only label 3 checked out by alice after merge, got %v\n", checkouts)
+	}
+
+	// cleaved bodies get the same checkout.
+	server.TestBadHTTP(t, "POST", apiStr+"cleave/3?u=bob", bytes.NewBufferString("[4]"))
+	r = server.TestHTTP(t, "POST", apiStr+"cleave/3?u=alice", bytes.NewBufferString("[4]"))
+	var cleaveResp struct {
+		CleavedLabel uint64
+	}
+	if err := json.Unmarshal(r, &cleaveResp); err != nil {
+		t.Fatalf("unable to parse cleave response %q: %v\n", string(r), err)
+	}
+	r = server.TestHTTP(t, "GET", apiStr+"checkouts", nil)
+	if err := json.Unmarshal(r, &checkouts); err != nil {
+		t.Fatalf("unable to parse checkouts %q: %v\n", string(r), err)
+	}
+	if len(checkouts) != 2 || checkouts[3].User != "alice" || checkouts[cleaveResp.CleavedLabel].User != "alice" {
+		t.Fatalf("expected labels 3 and %d checked out by alice after cleave, got %v\n", cleaveResp.CleavedLabel, checkouts)
+	}
+
+	// batches touching checked out bodies are refused for other users.
+	batch := `[{"Action": "merge", "Target": 1, "Labels": [3]}]`
+	server.TestBadHTTP(t, "POST", apiStr+"batch?u=bob", bytes.NewBufferString(batch))
+
+	// release requires the holder.
+	server.TestBadHTTP(t, "DELETE", apiStr+"checkout/3?u=bob", nil)
+	server.TestHTTP(t, "DELETE", apiStr+"checkout/3?u=alice", nil)
+	server.TestBadHTTP(t, "DELETE", apiStr+"checkout/3?u=alice", nil)
+	server.TestHTTP(t, "POST", apiStr+"batch?u=bob", bytes.NewBufferString(batch))
+
+	// child versions inherit checkouts, and expired checkouts are purged from the store.
+	server.TestHTTP(t, "POST", apiStr+"checkout/1?u=alice", nil)
+	server.TestHTTP(t, "POST", apiStr+"checkout/2?u=alice&ttl=1", nil)
+	commitReq := fmt.Sprintf("%snode/%s/commit", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", commitReq, bytes.NewBufferString(`{"note": "checkouts"}`))
+	newVersionReq := fmt.Sprintf("%snode/%s/newversion", server.WebAPIPath, uuid)
+	var newVersion struct {
+		Child string `json:"child"`
+	}
+	if err := json.Unmarshal(server.TestHTTP(t, "POST", newVersionReq, nil), &newVersion); err != nil {
+		t.Fatalf("unable to parse newversion response: %v\n", err)
+	}
+	child := dvid.UUID(newVersion.Child)
+	childStr := fmt.Sprintf("%snode/%s/labels/", server.WebAPIPath, child)
+
+	time.Sleep(1100 * time.Millisecond)
+	r = server.TestHTTP(t, "GET", childStr+"checkouts", nil)
+	checkouts = nil
+	if err := json.Unmarshal(r, &checkouts); err != nil {
+		t.Fatalf("unable to parse checkouts %q: %v\n", string(r), err)
+	}
+	if checkouts[1].User != "alice" {
+		t.Fatalf("expected child version to inherit checkout of label 1, got %v\n", checkouts)
+	}
+	if _, found := checkouts[2]; found {
+		t.Fatalf("expected expired checkout of label 2 to be purged, got %v\n", checkouts)
+	}
+	server.TestBadHTTP(t, "POST", childStr+"merge?u=bob", bytes.NewBufferString("[1, 2]"))
+
+	d, err := GetByUUIDName(child, "labels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	childV, err := datastore.VersionFromUUID(child)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := store.Get(datastore.NewVersionedCtx(d, childV), checkoutsTKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := make(checkoutMap)
+	if err := json.Unmarshal(data, &stored); err != nil {
+		t.Fatalf("unable to parse stored checkouts %q: %v\n", string(data), err)
+	}
+	if _, found := stored[2]; found || stored[1].User != "alice" {
+		t.Fatalf("expected stored child checkouts without expired label 2, got %v\n", stored)
+	}
+}
+
+func TestReindexLabels(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, v := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+	createLabelTestVolume(t, uuid, "labels")
+
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	d, err := GetByUUIDName(uuid, "labels")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	getIndex := func(label uint64) *labels.Index {
+		idx, err := GetLabelIndex(d, v, label, false)
+		if err != nil {
+			t.Fatalf("unable to get index for label %d: %v\n", label, err)
+		}
+		return idx
+	}
+	reindex := func(query string) *ReindexJob {
+		reqStr := fmt.Sprintf("%snode/%s/labels/reindex%s", server.WebAPIPath, uuid, query)
+		server.TestHTTP(t, "POST", reqStr, nil)
+		if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+			t.Fatalf("Error blocking on reindex of labels: %v\n", err)
+		}
+		reqStr = fmt.Sprintf("%snode/%s/labels/reindex", server.WebAPIPath, uuid)
+		var job ReindexJob
+		if err := json.Unmarshal(server.TestHTTP(t, "GET", reqStr, nil), &job); err != nil {
+			t.Fatalf("unable to decode reindex job: %v\n", err)
+		}
+		if job.Running || job.Error != "" {
+			t.Fatalf("bad reindex job status: %v\n", job)
+		}
+		return &job
+	}
+
+	if job := reindex("?verify=true"); len(job.Mismatches) != 0 {
+		t.Fatalf("expected no mismatches on freshly ingested labels, got %v\n", job.Mismatches)
+	}
+
+	// corrupt the index of label 4 by dropping a block and delete the index of label 2.
+	orig4 := getIndex(4)
+	orig2 := getIndex(2)
+	corrupt := getIndex(4)
+	for block := range corrupt.Blocks {
+		delete(corrupt.Blocks, block)
+		break
+	}
+	if err := PutLabelIndex(d, v, 4, corrupt); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteLabelIndex(d, v, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	// a labels-limited job scans blocks connected to the stored index, finding the dropped
+	// block of label 4.
+	job := reindex("?verify=true&labels=4")
+	if len(job.Mismatches) != 1 || job.LabelsChecked != 1 || job.Mismatches[0].Label != 4 {
+		t.Fatalf("expected 1 mismatch for label 4 from labels verify, got %v\n", job)
+	}
+	if m := job.Mismatches[0]; m.Repaired || m.MissingBlocks != 1 {
+		t.Fatalf("bad mismatch from labels verify: %v\n", m)
+	}
+	labelsScanned := job.BlocksScanned
+	job = reindex("?verify=true")
+	if len(job.Mismatches) != 2 {
+		t.Fatalf("expected 2 mismatches from verify, got %v\n", job)
+	}
+	if labelsScanned >= job.BlocksScanned {
+		t.Fatalf("labels verify scanned %d blocks, full verify %d\n", labelsScanned, job.BlocksScanned)
+	}
+	for _, m := range job.Mismatches {
+		if m.Repaired || m.MissingBlocks == 0 {
+			t.Fatalf("bad mismatch from verify: %v\n", m)
+		}
+	}
+	if idx := getIndex(2); idx != nil && len(idx.Blocks) != 0 {
+		t.Fatalf("verify should not have repaired index of label 2\n")
+	}
+
+	job = reindex("?u=fixer")
+	if len(job.Mismatches) != 2 {
+		t.Fatalf("expected 2 mismatches from rebuild, got %v\n", job)
+	}
+	for _, m := range job.Mismatches {
+		if !m.Repaired {
+			t.Fatalf("expected mismatch to be repaired: %v\n", m)
+		}
+		if idx := getIndex(m.Label); idx.LastModUser != "fixer" || idx.LastMutId <= orig4.LastMutId {
+			t.Fatalf("repaired index of label %d has bad mutation info: %d, %q\n", m.Label, idx.LastMutId, idx.LastModUser)
+		}
+	}
+	for label, orig := range map[uint64]*labels.Index{2: orig2, 4: orig4} {
+		idx := getIndex(label)
+		if idx == nil || idx.NumVoxels() != orig.NumVoxels() || len(idx.Blocks) != len(orig.Blocks) {
+			t.Fatalf("rebuilt index for label %d doesn't match original\n", label)
+		}
+	}
+	if job := reindex("?verify=true"); len(job.Mismatches) != 0 {
+		t.Fatalf("expected no mismatches after rebuild, got %v\n", job.Mismatches)
+	}
+
+	// a label mutated after its index was noted by a job isn't repaired from stale blocks.
+	noted := getIndex(4).LastMutId
+	computed, err := d.computeIndices(v, []uint64{4}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mutated := getIndex(4)
+	for block := range mutated.Blocks {
+		delete(mutated.Blocks, block)
+		break
+	}
+	mutated.LastMutId = d.NewMutationID()
+	if err := PutLabelIndex(d, v, 4, mutated); err != nil {
+		t.Fatal(err)
+	}
+	m, err := d.reindexLabel(v, 4, computed[4], nil, false, d.NewMutationID(), dvid.ModInfo{}, noted, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m == nil || !m.Changed || m.Repaired {
+		t.Fatalf("expected changed label 4 to be skipped, got %v\n", m)
+	}
+	if idx := getIndex(4); len(idx.Blocks) != len(mutated.Blocks) || idx.LastMutId != mutated.LastMutId {
+		t.Fatalf("reindex overwrote index of label 4 changed during the job\n")
+	}
+	m, err = d.reindexLabel(v, 4, computed[4], nil, false, d.NewMutationID(), dvid.ModInfo{}, mutated.LastMutId, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m == nil || m.Changed || !m.Repaired {
+		t.Fatalf("expected unchanged label 4 to be repaired, got %v\n", m)
+	}
+	if idx := getIndex(4); len(idx.Blocks) != len(orig4.Blocks) {
+		t.Fatalf("repaired index of label 4 doesn't match original\n")
+	}
+
+	// an undecodable block aborts the repair before any index is modified.
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var badBlock dvid.IZYXString
+	for zyx := range orig4.Blocks {
+		badBlock = labels.BlockIndexToIZYXString(zyx)
+		break
+	}
+	ctx := datastore.NewVersionedCtx(d, v)
+	if err := store.Put(ctx, NewBlockTKeyByCoord(0, badBlock), []byte("not a block")); err != nil {
+		t.Fatal(err)
+	}
+	reqStr := fmt.Sprintf("%snode/%s/labels/reindex", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", reqStr, nil)
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on reindex of labels: %v\n", err)
+	}
+	var badJob ReindexJob
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", reqStr, nil), &badJob); err != nil {
+		t.Fatalf("unable to decode reindex job: %v\n", err)
+	}
+	if badJob.Error == "" || len(badJob.Mismatches) != 0 {
+		t.Fatalf("expected reindex with undecodable block to abort, got %v\n", badJob)
+	}
+	if idx := getIndex(4); idx == nil || len(idx.Blocks) != len(orig4.Blocks) {
+		t.Fatalf("aborted reindex modified index of label 4\n")
+	}
+}
+
 func TestMultiscaleMergeCleave(t *testing.T) {
 	testConfig := server.TestConfig{CacheSize: map[string]int{"labelmap": 10}}
 	// var testConfig server.TestConfig
@@ -4427,3 +5027,226 @@ var (
 		body1, body2, body3, body4, bodysplit, body6, body7,
 	}
 )
+
+func TestPrecomputed(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+	createLabelTestVolume(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	mergeJSON(`[2, 3]`).send(t, uuid, "labels")
+
+	reqStr := fmt.Sprintf("%snode/%s/labels/precomputed/info", server.WebAPIPath, uuid)
+	var info imageblk.PrecomputedInfo
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", reqStr, nil), &info); err != nil {
+		t.Fatalf("unable to decode precomputed info: %v\n", err)
+	}
+	if info.VolumeType != "segmentation" || info.DataType != "uint64" || len(info.Scales) != 1 {
+		t.Fatalf("bad precomputed info: %v\n", info)
+	}
+	scale := info.Scales[0]
+	if scale.Encoding != imageblk.PrecomputedCompSeg || scale.CompressedSegmentationBlockSize == nil ||
+		*scale.CompressedSegmentationBlockSize != [3]int32{8, 8, 8} || scale.Size != [3]int32{128, 128, 128} {
+		t.Fatalf("bad precomputed scale 0: %v\n", scale)
+	}
+
+	// chunks should match the compressed labels read through the raw endpoint.
+	testChunk := func(chunk, query string, offset, size dvid.Point3d) {
+		reqStr := fmt.Sprintf("%snode/%s/labels/precomputed/0/%s%s", server.WebAPIPath, uuid, chunk, query)
+		got := server.TestHTTP(t, "GET", reqStr, nil)
+		reqStr = fmt.Sprintf("%snode/%s/labels/raw/0_1_2/%d_%d_%d/%d_%d_%d%s", server.WebAPIPath, uuid,
+			size[0], size[1], size[2], offset[0], offset[1], offset[2], query)
+		var buf bytes.Buffer
+		if err := labels.WriteGoogleCompressedVolume(&buf, server.TestHTTP(t, "GET", reqStr, nil), size); err != nil {
+			t.Fatalf("unable to compress chunk %s: %v\n", chunk, err)
+		}
+		if !bytes.Equal(got, buf.Bytes()) {
+			t.Errorf("bad precomputed chunk %s%s\n", chunk, query)
+		}
+	}
+	testChunk("32-64_32-64_32-64", "", dvid.Point3d{32, 32, 32}, dvid.Point3d{32, 32, 32})
+	testChunk("32-64_32-64_32-64", "?supervoxels=true", dvid.Point3d{32, 32, 32}, dvid.Point3d{32, 32, 32})
+	testChunk("10-50_20-41_30-35", "", dvid.Point3d{10, 20, 30}, dvid.Point3d{40, 21, 5})
+
+	reqStr = fmt.Sprintf("%snode/%s/labels/precomputed/raw/0/0-64_0-64_0-64", server.WebAPIPath, uuid)
+	got := server.TestHTTP(t, "GET", reqStr, nil)
+	reqStr = fmt.Sprintf("%snode/%s/labels/raw/0_1_2/64_64_64/0_0_0", server.WebAPIPath, uuid)
+	if expected := server.TestHTTP(t, "GET", reqStr, nil); !bytes.Equal(got, expected) {
+		t.Errorf("bad precomputed raw chunk\n")
+	}
+
+	reqStr = fmt.Sprintf("%snode/%s/labels/precomputed/1/0-32_0-32_0-32", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", reqStr, nil)
+}
+
+func TestChunkedArrayRoundTrip(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, v := initTestRepo()
+	var config dvid.Config
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+	server.CreateTestInstance(t, uuid, "labelmap", "ingested", config)
+	createLabelTestVolume(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	d, err := GetByUUIDName(uuid, "labels")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "dvid-labels-n5")
+	if err != nil {
+		t.Fatalf("unable to create temp dir: %v\n", err)
+	}
+	defer os.RemoveAll(dir)
+	a, err := imageblk.CreateChunkedArray(dir, imageblk.FormatN5, dvid.T_uint64, dvid.Point3d{128, 128, 128},
+		dvid.Point3d{64, 64, 64}, dvid.Point3d{0, 0, 0}, imageblk.ChunkGzip)
+	if err != nil {
+		t.Fatalf("unable to create N5 array: %v\n", err)
+	}
+	if err := d.ExportChunkedArray(v, 0, true, a); err != nil {
+		t.Fatalf("unable to export labels: %v\n", err)
+	}
+
+	// ingest through RPC and wait for the ingestion to finish.
+	var reply datastore.Response
+	cmd := dvid.Command{"node", string(uuid), "ingested", "ingest-zarr", dir}
+	d2, err := GetByUUIDName(uuid, "ingested")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d2.DoRPC(datastore.Request{Command: cmd}, &reply); err != nil {
+		t.Fatalf("unable to ingest N5 labels: %v\n", err)
+	}
+	if err := datastore.BlockOnUpdating(uuid, "ingested"); err != nil {
+		t.Fatalf("Error blocking on ingest of labels: %v\n", err)
+	}
+
+	reqStr := fmt.Sprintf("%snode/%s/labels/raw/0_1_2/128_128_128/0_0_0", server.WebAPIPath, uuid)
+	expected := server.TestHTTP(t, "GET", reqStr, nil)
+	reqStr = fmt.Sprintf("%snode/%s/ingested/raw/0_1_2/128_128_128/0_0_0", server.WebAPIPath, uuid)
+	if got := server.TestHTTP(t, "GET", reqStr, nil); !bytes.Equal(got, expected) {
+		t.Fatalf("ingested labels don't match exported labels\n")
+	}
+	for _, label := range []uint64{1, 2, 3, 4} {
+		reqStr = fmt.Sprintf("%snode/%s/labels/size/%d", server.WebAPIPath, uuid, label)
+		expected := server.TestHTTP(t, "GET", reqStr, nil)
+		reqStr = fmt.Sprintf("%snode/%s/ingested/size/%d", server.WebAPIPath, uuid, label)
+		if got := server.TestHTTP(t, "GET", reqStr, nil); !bytes.Equal(got, expected) {
+			t.Errorf("label %d index size after ingest %s, expected %s\n", label, got, expected)
+		}
+	}
+}
+
+func TestArbitraryLabels(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, v := initTestRepo()
+	var config dvid.Config
+	config.Set("MaxDownresLevel", "1")
+	config.Set("BlockSize", "32,32,32")
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", config)
+	createLabelTestVolume(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+	mergeJSON(`[2, 3]`).send(t, uuid, "labels")
+	d, err := GetByUUIDName(uuid, "labels")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an axis-aligned arbitrary plane should match the corresponding xy slice, where the
+	// default voxel size is 8 nm.
+	for _, tc := range []struct {
+		scale       uint8
+		supervoxels bool
+		voxelSize   int
+		sliceSize   int
+	}{
+		{0, false, 8, 128},
+		{0, true, 8, 128},
+		{1, false, 16, 64},
+	} {
+		z := 40 * tc.voxelSize
+		end := (tc.sliceSize - 1) * tc.voxelSize
+		img, err := d.GetArbitraryLabels(v, fmt.Sprintf("0_0_%d", z), fmt.Sprintf("%d_0_%d", end, z),
+			fmt.Sprintf("0_%d_%d", end, z), fmt.Sprintf("%d", tc.voxelSize), tc.scale, tc.supervoxels)
+		if err != nil {
+			t.Fatalf("unable to get arbitrary labels: %v\n", err)
+		}
+		reqStr := fmt.Sprintf("%snode/%s/labels/raw/0_1_2/%d_%d_1/0_0_40?scale=%d&supervoxels=%t", server.WebAPIPath,
+			uuid, tc.sliceSize, tc.sliceSize, tc.scale, tc.supervoxels)
+		expected := server.TestHTTP(t, "GET", reqStr, nil)
+		if !bytes.Equal(img.Data(), expected) {
+			t.Errorf("arbitrary labels at scale %d, supervoxels %t don't match xy slice\n", tc.scale, tc.supervoxels)
+		}
+	}
+
+	reqStr := fmt.Sprintf("%snode/%s/labels/arb/0_0_320/1016_0_320/0_1016_320/8?pseudocolor=true", server.WebAPIPath, uuid)
+	img, _, err := image.Decode(bytes.NewReader(server.TestHTTP(t, "GET", reqStr, nil)))
+	if err != nil {
+		t.Fatalf("unable to decode pseudocolor arbitrary image: %v\n", err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != 128 || bounds.Dy() != 128 {
+		t.Errorf("expected 128 x 128 pseudocolor image, got %d x %d\n", bounds.Dx(), bounds.Dy())
+	}
+	reqStr = fmt.Sprintf("%snode/%s/labels/arb/0_0_320/1016_0_320/0_1016_320/8?scale=2", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", reqStr, nil)
+}
+
+func TestLabelsVolumeFormats(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "labelmap", "labels", dvid.Config{})
+	server.CreateTestInstance(t, uuid, "labelmap", "ingested", dvid.Config{})
+	createLabelTestVolume(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	apiStr := fmt.Sprintf("%snode/%s/labels/raw/0_1_2/128_128_128/0_0_0", server.WebAPIPath, uuid)
+	expected := server.TestHTTP(t, "GET", apiStr, nil)
+	for _, format := range []string{dvid.VolumeTIFF, dvid.VolumeNRRD} {
+		returned := server.TestHTTP(t, "GET", apiStr+"/"+format, nil)
+		meta, data, err := dvid.ReadVolume(format, bytes.NewBuffer(returned), nil)
+		if err != nil {
+			t.Fatalf("unable to read returned %s: %v\n", format, err)
+		}
+		if err := meta.CheckVolume(dvid.T_uint64, 1, dvid.Point3d{128, 128, 128}); err != nil {
+			t.Fatalf("bad returned %s: %v\n", format, err)
+		}
+		if !bytes.Equal(data, expected) {
+			t.Fatalf("returned %s doesn't match raw labels\n", format)
+		}
+
+		ingestStr := fmt.Sprintf("%snode/%s/ingested/raw/0_1_2/128_128_128/0_0_0", server.WebAPIPath, uuid)
+		server.TestHTTP(t, "POST", ingestStr+"/"+format, bytes.NewBuffer(returned))
+		if err := datastore.BlockOnUpdating(uuid, "ingested"); err != nil {
+			t.Fatalf("Error blocking on sync of ingested: %v\n", err)
+		}
+		if ingested := server.TestHTTP(t, "GET", ingestStr, nil); !bytes.Equal(ingested, expected) {
+			t.Fatalf("labels POSTed as %s not returned\n", format)
+		}
+	}
+}
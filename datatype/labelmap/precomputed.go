@@ -0,0 +1,106 @@
+package labelmap
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/datatype/imageblk"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+)
+
+// handlePrecomputed serves a read-only Neuroglancer precomputed segmentation volume.
+func (d *Data) handlePrecomputed(ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request, parts []string) {
+	// GET <api URL>/node/<UUID>/<data name>/precomputed[/<encoding>]/info
+	// GET <api URL>/node/<UUID>/<data name>/precomputed[/<encoding>]/<scale>/<x0>-<x1>_<y0>-<y1>_<z0>-<z1>
+	timedLog := dvid.NewTimeLog()
+
+	if strings.ToLower(r.Method) != "get" {
+		server.BadRequest(w, r, "only GET action allowed for precomputed endpoint")
+		return
+	}
+	encoding := imageblk.PrecomputedCompSeg
+	path := parts[4:]
+	if len(path) > 0 && (path[0] == imageblk.PrecomputedRaw || path[0] == imageblk.PrecomputedCompSeg) {
+		encoding = path[0]
+		path = path[1:]
+	}
+	supervoxels := r.URL.Query().Get("supervoxels") == "true"
+
+	switch {
+	case len(path) == 1 && path[0] == "info":
+		info, err := d.Data.PrecomputedInfo(ctx, "segmentation", encoding, d.MaxDownresLevel)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if err := imageblk.WritePrecomputedInfo(w, info); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+
+	case len(path) == 2:
+		scale, subvol, err := imageblk.ParsePrecomputedChunk(path[0], path[1], d.MaxDownresLevel)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-type", "application/octet-stream")
+		if err := d.writePrecomputedChunk(ctx.VersionID(), w, subvol, scale, encoding, supervoxels); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+
+	default:
+		server.BadRequest(w, r, "precomputed endpoint must be followed by \"info\" or <scale>/<chunk>")
+		return
+	}
+	timedLog.Infof("HTTP GET precomputed (%s)", r.URL)
+}
+
+// writePrecomputedChunk writes the labels within a subvolume at the given scale using a
+// precomputed encoding.  Chunks that are exactly one block are encoded directly from the
+// stored block without expanding through a label volume.
+func (d *Data) writePrecomputedChunk(v dvid.VersionID, w http.ResponseWriter, subvol *dvid.Subvolume, scale uint8, encoding string, supervoxels bool) error {
+	blockSize, ok := d.BlockSize().(dvid.Point3d)
+	if !ok {
+		return fmt.Errorf("block size for data %q should be 3d, not: %s", d.DataName(), d.BlockSize())
+	}
+	offset := subvol.StartPoint().(dvid.Point3d)
+	size := subvol.Size().(dvid.Point3d)
+	if encoding == imageblk.PrecomputedCompSeg && size.Equals(blockSize) &&
+		offset[0]%blockSize[0] == 0 && offset[1]%blockSize[1] == 0 && offset[2]%blockSize[2] == 0 {
+		bcoord := offset.Chunk(blockSize).(dvid.ChunkPoint3d)
+		block, err := d.GetLabelBlock(v, bcoord, scale)
+		if err != nil {
+			return err
+		}
+		if !supervoxels {
+			mapping, err := getMapping(d, v)
+			if err != nil {
+				return err
+			}
+			if err := modifyBlockMapping(v, block, mapping); err != nil {
+				return err
+			}
+		}
+		return block.WriteGoogleCompression(w)
+	}
+
+	lbl, err := d.NewLabels(subvol, nil)
+	if err != nil {
+		return err
+	}
+	data, err := d.GetVolume(v, lbl, supervoxels, scale, "")
+	if err != nil {
+		return err
+	}
+	if encoding == imageblk.PrecomputedRaw {
+		_, err = w.Write(data)
+		return err
+	}
+	return labels.WriteGoogleCompressedVolume(w, data, size)
+}
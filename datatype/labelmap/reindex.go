@@ -0,0 +1,613 @@
+package labelmap
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/common/labels"
+	"github.com/janelia-flyem/dvid/datatype/common/proto"
+	"github.com/janelia-flyem/dvid/datatype/roi"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// IndexMismatch describes the differences between a stored label index and the index
+// recomputed from the scale 0 label blocks, limited to any ROI of the reindex job.
+type IndexMismatch struct {
+	Label          uint64
+	StoredVoxels   uint64
+	ComputedVoxels uint64
+	MissingBlocks  int  // # blocks with the label that aren't in the stored index
+	ExtraBlocks    int  // # blocks in the stored index that don't have the label
+	CountBlocks    int  // # blocks where supervoxel counts differ
+	Repaired       bool // true if the stored index was replaced by the computed one
+	Changed        bool // true if the label was mutated during the job, so it wasn't compared
+}
+
+// ReindexJob gives the status of a background verification or rebuild of label indices.
+type ReindexJob struct {
+	UUID          dvid.UUID
+	Labels        []uint64 `json:",omitempty"`
+	ROI           string   `json:",omitempty"`
+	Verify        bool
+	Running       bool
+	Started       string
+	Finished      string `json:",omitempty"`
+	BlocksScanned uint64
+	LabelsChecked int
+	Mismatches    []IndexMismatch
+	Error         string `json:",omitempty"`
+}
+
+// GetReindexJob returns a copy of the status of the last reindex job or nil if none
+// has been run since the server started.
+func (d *Data) GetReindexJob() *ReindexJob {
+	d.reindexMu.Lock()
+	defer d.reindexMu.Unlock()
+	if d.reindexJob == nil {
+		return nil
+	}
+	job := *d.reindexJob
+	job.Mismatches = make([]IndexMismatch, len(d.reindexJob.Mismatches))
+	copy(job.Mismatches, d.reindexJob.Mismatches)
+	return &job
+}
+
+// StartReindex launches a background job that scans the scale 0 label blocks, recomputes
+// the label indices, and compares them to the stored indices.  The job can be limited to
+// a set of labels and/or the blocks within an ROI given by "<roiname>,<uuid>".  If labels
+// are given without an ROI, only the blocks of their stored indices and any connected
+// blocks containing the labels are scanned.  Unless verify is true, mismatched indices are
+// replaced by the recomputed ones.  Labels mutated after the job starts are reported as
+// changed and left alone since their recomputed indices may be stale.  Only one job can
+// run at a time per data instance and its status is available via GetReindexJob.
+func (d *Data) StartReindex(v dvid.VersionID, lbls []uint64, roiSpec string, verify bool, info dvid.ModInfo) error {
+	uuid, err := datastore.UUIDFromVersion(v)
+	if err != nil {
+		return err
+	}
+	var blocks map[dvid.IZYXString]struct{}
+	var spans []dvid.Span
+	if roiSpec != "" {
+		if blocks, spans, err = d.getROIBlocks(roiSpec); err != nil {
+			return err
+		}
+	}
+
+	d.reindexMu.Lock()
+	if d.reindexJob != nil && d.reindexJob.Running {
+		d.reindexMu.Unlock()
+		return fmt.Errorf("reindex job for data %q already running", d.DataName())
+	}
+	d.reindexJob = &ReindexJob{
+		UUID:    uuid,
+		Labels:  lbls,
+		ROI:     roiSpec,
+		Verify:  verify,
+		Running: true,
+		Started: time.Now().Format(time.RFC3339),
+	}
+	d.reindexMu.Unlock()
+
+	d.StartUpdate()
+	go func() {
+		err := d.reindex(v, lbls, blocks, spans, verify, info)
+		d.reindexMu.Lock()
+		d.reindexJob.Running = false
+		d.reindexJob.Finished = time.Now().Format(time.RFC3339)
+		if err != nil {
+			d.reindexJob.Error = err.Error()
+		}
+		d.reindexMu.Unlock()
+		d.StopUpdate()
+		if err != nil {
+			dvid.Errorf("reindex of data %q failed: %v\n", d.DataName(), err)
+		}
+	}()
+	return nil
+}
+
+// returns the set of blocks within the given ROI, which must have the same block size
+// as the labelmap, along with its spans.
+func (d *Data) getROIBlocks(roiSpec string) (map[dvid.IZYXString]struct{}, []dvid.Span, error) {
+	roiData, roiV, found, err := roi.DataBySpec(roiSpec)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !found {
+		return nil, nil, fmt.Errorf("unable to find ROI %q", roiSpec)
+	}
+	blockSize, ok := d.BlockSize().(dvid.Point3d)
+	if !ok || !roiData.BlockSize.Equals(blockSize) {
+		return nil, nil, fmt.Errorf("ROI %q block size %s must match labelmap %q block size %s", roiSpec, roiData.BlockSize, d.DataName(), d.BlockSize())
+	}
+	spans, err := roiData.GetSpans(roiV)
+	if err != nil {
+		return nil, nil, err
+	}
+	blocks := make(map[dvid.IZYXString]struct{})
+	for _, span := range spans {
+		for x := span[2]; x <= span[3]; x++ {
+			blocks[dvid.ChunkPoint3d{x, span[1], span[0]}.ToIZYXString()] = struct{}{}
+		}
+	}
+	return blocks, spans, nil
+}
+
+func (d *Data) reindex(v dvid.VersionID, lbls []uint64, roiBlocks map[dvid.IZYXString]struct{}, spans []dvid.Span, verify bool, info dvid.ModInfo) error {
+	timedLog := dvid.NewTimeLog()
+
+	// determine the labels to compare, which are either the given labels or all labels
+	// with blocks, recomputed or stored, in the scanned region.  The last mutation of each
+	// stored index is noted before the scan so labels changed during the job can be skipped.
+	toCheck := make(labels.Set)
+	lastMutIDs := make(map[uint64]uint64)
+	if len(lbls) != 0 {
+		for _, label := range lbls {
+			toCheck[label] = struct{}{}
+			idx, err := GetLabelIndex(d, v, label, false)
+			if err != nil {
+				return err
+			}
+			if idx != nil {
+				lastMutIDs[label] = idx.LastMutId
+			}
+		}
+	} else if err := d.addStoredLabels(v, roiBlocks, toCheck, lastMutIDs); err != nil {
+		return err
+	}
+
+	computed, err := d.computeIndices(v, lbls, spans)
+	if err != nil {
+		return err
+	}
+	if len(lbls) == 0 {
+		for label := range computed {
+			toCheck[label] = struct{}{}
+		}
+	}
+	sorted := make([]uint64, 0, len(toCheck))
+	for label := range toCheck {
+		sorted = append(sorted, label)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	// all computed indices are complete before any are written, so repairs use a single
+	// mutation ID for the job.
+	var mutID uint64
+	if !verify {
+		mutID = d.NewMutationID()
+	}
+	var numMismatches int
+	for _, label := range sorted {
+		lastMutID, hadIndex := lastMutIDs[label]
+		mismatch, err := d.reindexLabel(v, label, computed[label], roiBlocks, verify, mutID, info, lastMutID, hadIndex)
+		if err != nil {
+			return err
+		}
+		d.reindexMu.Lock()
+		d.reindexJob.LabelsChecked++
+		if mismatch != nil {
+			d.reindexJob.Mismatches = append(d.reindexJob.Mismatches, *mismatch)
+		}
+		d.reindexMu.Unlock()
+		if mismatch != nil {
+			numMismatches++
+		}
+	}
+	timedLog.Infof("Reindex (verify %t) of data %q checked %d labels and found %d mismatched indices", verify, d.DataName(), len(sorted), numMismatches)
+	return nil
+}
+
+// computeIndices scans the scale 0 blocks, either all blocks or those within the given
+// spans, and returns the label indices computed from them.  If labels are given, only
+// their indices are computed, and without spans only the blocks connected to their stored
+// indices are scanned.  Any block that can't be decoded aborts the scan with an error.
+func (d *Data) computeIndices(v dvid.VersionID, lbls []uint64, spans []dvid.Span) (map[uint64]*labels.Index, error) {
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return nil, err
+	}
+	svmap, err := getMapping(d, v)
+	if err != nil {
+		return nil, err
+	}
+	ancestry, err := svmap.getAncestry(v)
+	if err != nil {
+		return nil, err
+	}
+	indexer := &blockIndexer{
+		d:        d,
+		svmap:    svmap,
+		ancestry: ancestry,
+		computed: make(map[uint64]*labels.Index),
+	}
+	if len(lbls) != 0 {
+		indexer.filter = make(labels.Set, len(lbls))
+		for _, label := range lbls {
+			indexer.filter[label] = struct{}{}
+		}
+		if len(spans) == 0 {
+			if err := d.computeConnectedIndices(v, indexer); err != nil {
+				return nil, err
+			}
+			return indexer.computed, nil
+		}
+	}
+
+	var scanErr error
+	var errMu sync.Mutex
+	getScanErr := func() error {
+		errMu.Lock()
+		defer errMu.Unlock()
+		return scanErr
+	}
+	wg := new(sync.WaitGroup)
+	chunkCh := make(chan *storage.Chunk, 100)
+	for i := 0; i < 8; i++ {
+		go func() {
+			for c := range chunkCh {
+				if _, err := indexer.indexBlock(c.K, c.V); err != nil {
+					errMu.Lock()
+					if scanErr == nil {
+						scanErr = err
+					}
+					errMu.Unlock()
+				}
+				wg.Done()
+			}
+		}()
+	}
+
+	ctx := datastore.NewVersionedCtx(d, v)
+	chunkOp := &storage.ChunkOp{Wg: wg}
+	processFunc := func(c *storage.Chunk) error {
+		if c == nil {
+			wg.Done()
+			return fmt.Errorf("received nil chunk in reindex for data %q", d.DataName())
+		}
+		if err := getScanErr(); err != nil {
+			wg.Done()
+			return err
+		}
+		if c.V == nil {
+			wg.Done()
+			return nil
+		}
+		d.reindexMu.Lock()
+		d.reindexJob.BlocksScanned++
+		d.reindexMu.Unlock()
+		chunkCh <- c
+		return nil
+	}
+	if len(spans) == 0 {
+		begTKey := NewBlockTKeyByCoord(0, dvid.MinIndexZYX.ToIZYXString())
+		endTKey := NewBlockTKeyByCoord(0, dvid.MaxIndexZYX.ToIZYXString())
+		err = store.ProcessRange(ctx, begTKey, endTKey, chunkOp, processFunc)
+	} else {
+		for _, span := range spans {
+			begTKey := NewBlockTKeyByCoord(0, dvid.ChunkPoint3d{span[2], span[1], span[0]}.ToIZYXString())
+			endTKey := NewBlockTKeyByCoord(0, dvid.ChunkPoint3d{span[3], span[1], span[0]}.ToIZYXString())
+			if err = store.ProcessRange(ctx, begTKey, endTKey, chunkOp, processFunc); err != nil {
+				break
+			}
+		}
+	}
+	wg.Wait()
+	close(chunkCh)
+	if scanErr != nil {
+		return nil, fmt.Errorf("aborted reindex of data %q: %v", d.DataName(), scanErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return indexer.computed, nil
+}
+
+// computeConnectedIndices computes the indices of the indexer's labels by scanning the
+// blocks of their stored indices and, since bodies are connected, any neighboring blocks
+// found to contain the labels.  A label without a stored index has no blocks to start
+// from, so finding its blocks requires a scan of all blocks or an ROI.
+func (d *Data) computeConnectedIndices(v dvid.VersionID, indexer *blockIndexer) error {
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	ctx := datastore.NewVersionedCtx(d, v)
+
+	visited := make(map[dvid.IZYXString]struct{})
+	var queue []dvid.IZYXString
+	enqueue := func(izyx dvid.IZYXString) {
+		if _, found := visited[izyx]; !found {
+			visited[izyx] = struct{}{}
+			queue = append(queue, izyx)
+		}
+	}
+	for label := range indexer.filter {
+		idx, err := GetLabelIndex(d, v, label, false)
+		if err != nil {
+			return err
+		}
+		if idx == nil {
+			continue
+		}
+		for zyx := range idx.Blocks {
+			enqueue(labels.BlockIndexToIZYXString(zyx))
+		}
+	}
+	for len(queue) != 0 {
+		izyx := queue[0]
+		queue = queue[1:]
+		tk := NewBlockTKeyByCoord(0, izyx)
+		data, err := store.Get(ctx, tk)
+		if err != nil {
+			return fmt.Errorf("aborted reindex of data %q: unable to read block %s: %v", d.DataName(), izyx, err)
+		}
+		if data == nil {
+			continue
+		}
+		d.reindexMu.Lock()
+		d.reindexJob.BlocksScanned++
+		d.reindexMu.Unlock()
+		hasLabel, err := indexer.indexBlock(tk, data)
+		if err != nil {
+			return fmt.Errorf("aborted reindex of data %q: %v", d.DataName(), err)
+		}
+		if !hasLabel {
+			continue
+		}
+		bcoord, err := izyx.ToChunkPoint3d()
+		if err != nil {
+			return err
+		}
+		for dz := int32(-1); dz <= 1; dz++ {
+			for dy := int32(-1); dy <= 1; dy++ {
+				for dx := int32(-1); dx <= 1; dx++ {
+					if dx != 0 || dy != 0 || dz != 0 {
+						enqueue(dvid.ChunkPoint3d{bcoord[0] + dx, bcoord[1] + dy, bcoord[2] + dz}.ToIZYXString())
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// blockIndexer accumulates label indices from scale 0 label blocks.
+type blockIndexer struct {
+	d        *Data
+	svmap    *SVMap
+	ancestry []shortVersion
+	filter   labels.Set // if non-nil, only these labels are indexed
+
+	mu       sync.Mutex
+	computed map[uint64]*labels.Index
+}
+
+// adds the supervoxel counts of a label block to the computed indices, returning true
+// if the block has any of the indexed labels.
+func (b *blockIndexer) indexBlock(tk storage.TKey, value []byte) (hasLabel bool, err error) {
+	scale, idx, err := DecodeBlockTKey(tk)
+	if err != nil {
+		return false, err
+	}
+	if scale != 0 {
+		return false, fmt.Errorf("unexpected scale %d block during reindex", scale)
+	}
+	data, _, err := dvid.DeserializeData(value, true)
+	if err != nil {
+		return false, fmt.Errorf("unable to deserialize block %s: %v", idx, err)
+	}
+	var block labels.Block
+	if err := block.UnmarshalBinary(data); err != nil {
+		return false, fmt.Errorf("unable to unmarshal block %s: %v", idx, err)
+	}
+	bx, by, bz := idx.Unpack()
+	zyx := labels.EncodeBlockIndex(bx, by, bz)
+	counts := block.CalcNumLabels(nil)
+
+	b.svmap.RLock()
+	bodies := make(map[uint64]uint64, len(counts))
+	for supervoxel := range counts {
+		if supervoxel == 0 {
+			continue
+		}
+		label, found := b.svmap.mapLabel(supervoxel, b.ancestry)
+		if !found {
+			label = supervoxel
+		}
+		bodies[supervoxel] = label
+	}
+	b.svmap.RUnlock()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for supervoxel, label := range bodies {
+		if label == 0 {
+			dvid.Errorf("block %s of data %q has supervoxel %d that has been split\n", idx, b.d.DataName(), supervoxel)
+			continue
+		}
+		if b.filter != nil {
+			if _, found := b.filter[label]; !found {
+				continue
+			}
+		}
+		hasLabel = true
+		lidx, found := b.computed[label]
+		if !found {
+			lidx = newEmptyIndex(label)
+			b.computed[label] = lidx
+		}
+		svc, found := lidx.Blocks[zyx]
+		if !found {
+			svc = &proto.SVCount{Counts: make(map[uint64]uint32)}
+			lidx.Blocks[zyx] = svc
+		}
+		svc.Counts[supervoxel] = uint32(counts[supervoxel])
+	}
+	return hasLabel, nil
+}
+
+// adds all labels with stored indices that have blocks in the given set of blocks or,
+// if no blocks are given, all labels with stored indices.  The last mutation ID of each
+// added label's index is recorded in lastMutIDs.
+func (d *Data) addStoredLabels(v dvid.VersionID, roiBlocks map[dvid.IZYXString]struct{}, toCheck labels.Set, lastMutIDs map[uint64]uint64) error {
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	ctx := datastore.NewVersionedCtx(d, v)
+	begTKey := NewLabelIndexTKey(0)
+	endTKey := NewLabelIndexTKey(math.MaxUint64)
+	return store.ProcessRange(ctx, begTKey, endTKey, &storage.ChunkOp{}, func(c *storage.Chunk) error {
+		if c == nil || c.V == nil {
+			return nil
+		}
+		label, err := DecodeLabelIndexTKey(c.K)
+		if err != nil {
+			return err
+		}
+		data, _, err := dvid.DeserializeData(c.V, true)
+		if err != nil {
+			return fmt.Errorf("unable to deserialize label %d index: %v", label, err)
+		}
+		idx := new(labels.Index)
+		if err := idx.Unmarshal(data); err != nil {
+			return fmt.Errorf("unable to unmarshal label %d index: %v", label, err)
+		}
+		inROI := roiBlocks == nil
+		for zyx := range idx.Blocks {
+			if inROI {
+				break
+			}
+			_, inROI = roiBlocks[labels.BlockIndexToIZYXString(zyx)]
+		}
+		if inROI {
+			toCheck[label] = struct{}{}
+			lastMutIDs[label] = idx.LastMutId
+		}
+		return nil
+	})
+}
+
+// reindexLabel compares the stored index of a label with the computed one within any
+// given ROI blocks, returning nil if they match.  Unless verify is true, a mismatched
+// index is replaced in the ROI blocks by the computed one, marked with the given mutation,
+// and subscribers are notified of the label's size change.  If the stored index no longer
+// has the last mutation ID or existence noted before the block scan, the label was mutated
+// during the job and is reported as changed without comparison.
+func (d *Data) reindexLabel(v dvid.VersionID, label uint64, computed *labels.Index, roiBlocks map[dvid.IZYXString]struct{}, verify bool, mutID uint64, info dvid.ModInfo, lastMutID uint64, hadIndex bool) (*IndexMismatch, error) {
+	inRegion := func(zyx uint64) bool {
+		if roiBlocks == nil {
+			return true
+		}
+		_, found := roiBlocks[labels.BlockIndexToIZYXString(zyx)]
+		return found
+	}
+	if computed == nil {
+		computed = newEmptyIndex(label)
+	}
+
+	unlock := d.lockLabels(label)
+	defer unlock()
+	shard := label % numIndexShards
+	indexMu[shard].Lock()
+	defer indexMu[shard].Unlock()
+
+	stored, err := getCachedLabelIndex(d, v, label)
+	if err != nil {
+		return nil, err
+	}
+	if (stored != nil) != hadIndex || (stored != nil && stored.LastMutId != lastMutID) {
+		return &IndexMismatch{Label: label, Changed: true}, nil
+	}
+	if stored == nil {
+		stored = newEmptyIndex(label)
+	}
+
+	mismatch := IndexMismatch{Label: label}
+	for zyx, svc := range stored.Blocks {
+		if !inRegion(zyx) {
+			continue
+		}
+		for _, count := range svc.GetCounts() {
+			mismatch.StoredVoxels += uint64(count)
+		}
+		csvc, found := computed.Blocks[zyx]
+		if !found {
+			mismatch.ExtraBlocks++
+		} else if !svCountsEqual(svc, csvc) {
+			mismatch.CountBlocks++
+		}
+	}
+	for zyx, csvc := range computed.Blocks {
+		for _, count := range csvc.Counts {
+			mismatch.ComputedVoxels += uint64(count)
+		}
+		if _, found := stored.Blocks[zyx]; !found {
+			mismatch.MissingBlocks++
+		}
+	}
+	if mismatch.ExtraBlocks == 0 && mismatch.MissingBlocks == 0 && mismatch.CountBlocks == 0 {
+		return nil, nil
+	}
+	if verify {
+		return &mismatch, nil
+	}
+
+	oldSize := stored.NumVoxels()
+	for zyx := range stored.Blocks {
+		if inRegion(zyx) {
+			delete(stored.Blocks, zyx)
+		}
+	}
+	for zyx, csvc := range computed.Blocks {
+		stored.Blocks[zyx] = csvc
+	}
+	stored.LastMutId = mutID
+	stored.LastModUser = info.User
+	stored.LastModTime = info.Time
+	stored.LastModApp = info.App
+	if len(stored.Blocks) == 0 {
+		err = deleteCachedLabelIndex(d, v, label)
+	} else {
+		err = putCachedLabelIndex(d, v, stored)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to repair label %d index: %v", label, err)
+	}
+	mismatch.Repaired = true
+
+	delta := labels.DeltaReplaceSize{Label: label, OldSize: oldSize, NewSize: stored.NumVoxels()}
+	evt := datastore.SyncEvent{d.DataUUID(), labels.ChangeSizeEvent}
+	msg := datastore.SyncMessage{labels.ChangeSizeEvent, v, delta}
+	if err := datastore.NotifySubscribers(evt, msg); err != nil {
+		dvid.Errorf("unable to notify subscribers of repaired label %d index in data %q: %v\n", label, d.DataName(), err)
+	}
+	return &mismatch, nil
+}
+
+func svCountsEqual(svc1, svc2 *proto.SVCount) bool {
+	counts1, counts2 := svc1.GetCounts(), svc2.GetCounts()
+	if len(counts1) != len(counts2) {
+		return false
+	}
+	for supervoxel, count := range counts1 {
+		if count2, found := counts2[supervoxel]; !found || count2 != count {
+			return false
+		}
+	}
+	return true
+}
+
+// returns an empty label index with initialized block map.
+func newEmptyIndex(label uint64) *labels.Index {
+	idx := new(labels.Index)
+	idx.Label = label
+	idx.Blocks = make(map[uint64]*proto.SVCount)
+	return idx
+}
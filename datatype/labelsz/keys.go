@@ -93,6 +93,50 @@ func StringToIndexType(s string) IndexType {
 	}
 }
 
+// Custom annotation element kinds are indexed starting at this index type, offset by
+// the kind's position among the custom kinds of the synced annotation instance.
+const firstCustomIndex IndexType = 64
+
+// returns the index type for an element kind, where custom kinds require the synced annotations.
+func elementIndexType(annot *annotation.Data, e annotation.ElementType) IndexType {
+	if !e.IsCustom() {
+		return elementToIndexType(e)
+	}
+	if annot == nil {
+		return UnknownIndex
+	}
+	pos, found := annot.ElementKindIndex(e.String())
+	if !found || pos > 255-int(firstCustomIndex) {
+		return UnknownIndex
+	}
+	return firstCustomIndex + IndexType(pos)
+}
+
+// stringToIndexType converts a string to an IndexType, including custom element kinds
+// of the synced annotations.
+func (d *Data) stringToIndexType(s string) IndexType {
+	if i := StringToIndexType(s); i != UnknownIndex {
+		return i
+	}
+	annot := d.GetSyncedAnnotation()
+	if annot == nil {
+		return UnknownIndex
+	}
+	return elementIndexType(annot, annotation.StringToElementType(s))
+}
+
+// indexTypeName returns the name of an IndexType, including custom element kinds.
+func (d *Data) indexTypeName(i IndexType) string {
+	if i >= firstCustomIndex {
+		if annot := d.GetSyncedAnnotation(); annot != nil {
+			if name, found := annot.CustomElementKind(int(i - firstCustomIndex)); found {
+				return name
+			}
+		}
+	}
+	return i.String()
+}
+
 func elementToIndexType(e annotation.ElementType) (i IndexType) {
 	switch e {
 	case annotation.PostSyn:
@@ -119,8 +163,8 @@ func (il indexedLabel) String() string {
 	return fmt.Sprintf("[label %d, index %s]", label, i.String())
 }
 
-func toIndexedLabel(e annotation.ElementPos) indexedLabel {
-	return newIndexedLabel(elementToIndexType(e.Kind), e.Label)
+func toIndexedLabel(annot *annotation.Data, e annotation.ElementPos) indexedLabel {
+	return newIndexedLabel(elementIndexType(annot, e.Kind), e.Label)
 }
 
 func newIndexedLabel(i IndexType, label uint64) indexedLabel {
@@ -128,7 +128,8 @@ POST <api URL>/node/<UUID>/<data name>/sync?<options>
 GET <api URL>/node/<UUID>/<data name>/count/<label>/<index type>
 
 	Returns the count of the given annotation element type for the given label.
-	The index type may be any annotation element type ("PostSyn", "PreSyn", "Gap", "Note"),
+	The index type may be any annotation element type ("PostSyn", "PreSyn", "Gap", "Note",
+	or a custom kind registered with the synced annotations),
 	the catch-all for synapses "AllSyn", or the number of voxels "Voxels".
 
 	For synapse indexing, the labelsz data instance must be synced with an annotations instance.
@@ -164,7 +165,8 @@ GET <api URL>/node/<UUID>/<data name>/counts/<index type>
 GET <api URL>/node/<UUID>/<data name>/top/<N>/<index type>
 
 	Returns a list of the top N labels with respect to number of the specified index type.
-	The index type may be any annotation element type ("PostSyn", "PreSyn", "Gap", "Note"),
+	The index type may be any annotation element type ("PostSyn", "PreSyn", "Gap", "Note",
+	or a custom kind registered with the synced annotations),
 	the catch-all for synapses "AllSyn", or the number of voxels "Voxels".
 
 	For synapse indexing, the labelsz data instance must be synced with an annotations instance.
@@ -185,7 +187,8 @@ GET <api URL>/node/<UUID>/<data name>/threshold/<T>/<index type>[?<options>]
 	largest labels with # given element types >= T.  If there are more than 10,000 labels,
 	you can access the next 10,000 by including "?offset=10001".
 
-	The index type may be any annotation element type ("PostSyn", "PreSyn", "Gap", "Note"),
+	The index type may be any annotation element type ("PostSyn", "PreSyn", "Gap", "Note",
+	or a custom kind registered with the synced annotations),
 	the catch-all for synapses "AllSyn", or the number of voxels "Voxels".
 
 	For synapse indexing, the labelsz data instance must be synced with an annotations instance.
@@ -432,7 +435,7 @@ func (d *Data) SendCountsByElementType(w http.ResponseWriter, ctx *datastore.Ver
 			}
 			count = binary.LittleEndian.Uint32(val)
 		}
-		if _, err := fmt.Fprintf(w, `{"Label":%d,%q:%d}`, label, idxType, count); err != nil {
+		if _, err := fmt.Fprintf(w, `{"Label":%d,%q:%d}`, label, d.indexTypeName(idxType), count); err != nil {
 			continue
 		}
 		if i != numLabels-1 {
@@ -685,7 +688,7 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 			server.BadRequest(w, r, err)
 			return
 		}
-		idxType := StringToIndexType(parts[5])
+		idxType := d.stringToIndexType(parts[5])
 		if idxType == UnknownIndex {
 			server.BadRequest(w, r, fmt.Errorf("unknown index type specified (%q)", parts[5]))
 			return
@@ -696,7 +699,7 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 			return
 		}
 		w.Header().Set("Content-type", "application/json")
-		jsonStr := fmt.Sprintf(`{"Label":%d,%q:%d}`, label, idxType, count)
+		jsonStr := fmt.Sprintf(`{"Label":%d,%q:%d}`, label, d.indexTypeName(idxType), count)
 		if _, err := io.WriteString(w, jsonStr); err != nil {
 			server.BadRequest(w, r, err)
 			return
@@ -717,7 +720,7 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 			server.BadRequest(w, r, "Must include element type after 'counts' endpoint.")
 			return
 		}
-		idxType := StringToIndexType(parts[4])
+		idxType := d.stringToIndexType(parts[4])
 		if idxType == UnknownIndex {
 			server.BadRequest(w, r, fmt.Errorf("unknown index type specified (%q)", parts[4]))
 			return
@@ -747,7 +750,7 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 			server.BadRequest(w, r, err)
 			return
 		}
-		i := StringToIndexType(parts[5])
+		i := d.stringToIndexType(parts[5])
 		if i == UnknownIndex {
 			server.BadRequest(w, r, fmt.Errorf("unknown index type specified (%q)", parts[5]))
 			return
@@ -784,7 +787,7 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 			return
 		}
 		minSize := uint32(t)
-		i := StringToIndexType(parts[5])
+		i := d.stringToIndexType(parts[5])
 		if i == UnknownIndex {
 			server.BadRequest(w, r, fmt.Errorf("unknown index type specified (%q)", parts[5]))
 			return
@@ -888,11 +891,21 @@ func (d *Data) resync(ctx *datastore.VersionedCtx) {
 		for i := IndexType(0); i < AllSyn; i++ {
 			indexMap[i] = 0
 		}
+		customMap := make(map[IndexType]uint32)
 		for _, elem := range elems {
 			if d.inROI(elem.Pos) {
-				indexMap[elementToIndexType(elem.Kind)]++
+				if i := elementIndexType(annot, elem.Kind); i < AllSyn {
+					indexMap[i]++
+				} else {
+					customMap[i]++
+				}
 			}
 		}
+		for i, count := range customMap {
+			binary.LittleEndian.PutUint32(buf, count)
+			store.Put(ctx, NewTypeLabelTKey(i, label), buf)
+			store.Put(ctx, NewTypeSizeLabelTKey(i, count, label), nil)
+		}
 		var allsyn uint32
 		for i := IndexType(0); i < AllSyn; i++ {
 			if indexMap[i] > 0 {
@@ -814,3 +814,68 @@ func TestLabelmap(t *testing.T) {
 		t.Errorf("Got back incorrect post-merge PreSyn noroi count of label 20: %s\n", string(retData))
 	}
 }
+
+func checkCustomKinds(t *testing.T, uuid dvid.UUID) {
+	if err := datastore.BlockOnUpdating(uuid, "sizes"); err != nil {
+		t.Fatalf("Error blocking on sync of sizes labelsz: %v\n", err)
+	}
+	url := fmt.Sprintf("%snode/%s/sizes/top/3/Mito", server.WebAPIPath, uuid)
+	data := server.TestHTTP(t, "GET", url, nil)
+	if string(data) != `[{"Label":100,"Size":3},{"Label":200,"Size":1}]` {
+		t.Errorf("Got back incorrect Mito ranking:\n%v\n", string(data))
+	}
+	url = fmt.Sprintf("%snode/%s/sizes/count/300/SomaCenter", server.WebAPIPath, uuid)
+	data = server.TestHTTP(t, "GET", url, nil)
+	if string(data) != `{"Label":300,"SomaCenter":1}` {
+		t.Errorf("Got back incorrect SomaCenter count for label 300:\n%v\n", string(data))
+	}
+	url = fmt.Sprintf("%snode/%s/sizes/counts/Mito", server.WebAPIPath, uuid)
+	data = server.TestHTTP(t, "GET", url, strings.NewReader("[100,300]"))
+	if string(data) != `[{"Label":100,"Mito":3},{"Label":300,"Mito":0}]` {
+		t.Errorf("Got back incorrect Mito counts:\n%v\n", string(data))
+	}
+	url = fmt.Sprintf("%snode/%s/sizes/count/100/AllSyn", server.WebAPIPath, uuid)
+	data = server.TestHTTP(t, "GET", url, nil)
+	if string(data) != `{"Label":100,"AllSyn":1}` {
+		t.Errorf("Got back incorrect AllSyn count for label 100:\n%v\n", string(data))
+	}
+	server.TestBadHTTP(t, "GET", fmt.Sprintf("%snode/%s/sizes/count/100/Golgi", server.WebAPIPath, uuid), nil)
+}
+
+func TestCustomKinds(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := datastore.NewTestRepo()
+	var config dvid.Config
+	server.CreateTestInstance(t, uuid, "labelblk", "labels", config)
+	_ = createLabelTestVolume(t, uuid, "labels")
+	if err := datastore.BlockOnUpdating(uuid, "labels"); err != nil {
+		t.Fatalf("Error blocking on sync of labels: %v\n", err)
+	}
+
+	config.Set("ElementKinds", "Mito,SomaCenter")
+	server.CreateTestInstance(t, uuid, "annotation", "mysynapses", config)
+	server.CreateTestSync(t, uuid, "mysynapses", "labels")
+	server.CreateTestInstance(t, uuid, "labelsz", "sizes", dvid.Config{})
+	server.CreateTestSync(t, uuid, "sizes", "mysynapses")
+
+	elemsJSON := `[
+		{"Pos":[10,10,10],"Kind":"Mito"},
+		{"Pos":[20,10,10],"Kind":"Mito"},
+		{"Pos":[30,10,10],"Kind":"Mito"},
+		{"Pos":[40,10,10],"Kind":"PreSyn"},
+		{"Pos":[80,10,10],"Kind":"Mito"},
+		{"Pos":[80,10,80],"Kind":"SomaCenter"}
+	]`
+	url := fmt.Sprintf("%snode/%s/mysynapses/elements", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", url, strings.NewReader(elemsJSON))
+	checkCustomKinds(t, uuid)
+
+	// Reload should give the same counts.
+	url = fmt.Sprintf("%snode/%s/sizes/reload", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", url, nil)
+	checkCustomKinds(t, uuid)
+}
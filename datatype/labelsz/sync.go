@@ -152,10 +152,11 @@ func (d *Data) modifyElements(ctx *datastore.VersionedCtx, delta annotation.Delt
 	var diagnostic string
 	successful := true
 
+	annot := d.GetSyncedAnnotation()
 	mods := make(map[indexedLabel]int32)
 	for _, elemPos := range delta.Add {
 		if d.inROI(elemPos.Pos) {
-			i := toIndexedLabel(elemPos)
+			i := toIndexedLabel(annot, elemPos)
 			mods[i]++
 			if elemPos.Kind.IsSynaptic() {
 				i = newIndexedLabel(AllSyn, elemPos.Label)
@@ -165,7 +166,7 @@ func (d *Data) modifyElements(ctx *datastore.VersionedCtx, delta annotation.Delt
 	}
 	for _, elemPos := range delta.Del {
 		if d.inROI(elemPos.Pos) {
-			i := toIndexedLabel(elemPos)
+			i := toIndexedLabel(annot, elemPos)
 			mods[i]--
 			if elemPos.Kind.IsSynaptic() {
 				i = newIndexedLabel(AllSyn, elemPos.Label)
@@ -0,0 +1,61 @@
+/*
+	This file supports keyspaces for multichannel block data types.
+*/
+
+package multichan
+
+import (
+	"fmt"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+const (
+	// keyUnknown should never be used and is a check for corrupt or incorrectly set keys
+	keyUnknown storage.TKeyClass = iota
+
+	// reserved type-specific key for metadata
+	keyProperties = datastore.PropertyTKeyClass
+
+	// key class for a channel's block, where the block coordinate is prefixed by the
+	// channel byte so each channel's blocks are contiguous in key space.
+	keyChannelBlock = 41
+)
+
+// DescribeTKeyClass returns a string explanation of what a particular TKeyClass
+// is used for.  Implements the datastore.TKeyClassDescriber interface.
+func (d *Data) DescribeTKeyClass(tkc storage.TKeyClass) string {
+	switch tkc {
+	case keyProperties:
+		return "multichan properties key"
+	case keyChannelBlock:
+		return "multichan channel + block coord key"
+	default:
+		return "unknown multichan key"
+	}
+}
+
+// NewBlockTKey returns a TKey for a block coord of the given channel.
+func NewBlockTKey(channel uint8, izyx dvid.IZYXString) storage.TKey {
+	buf := make([]byte, 1+len(izyx))
+	buf[0] = channel
+	copy(buf[1:], izyx)
+	return storage.NewTKey(keyChannelBlock, buf)
+}
+
+// DecodeBlockTKey returns the channel and block coord from a channel block key.
+func DecodeBlockTKey(tk storage.TKey) (channel uint8, izyx dvid.IZYXString, err error) {
+	var ibytes []byte
+	if ibytes, err = tk.ClassBytes(keyChannelBlock); err != nil {
+		return
+	}
+	if len(ibytes) != 13 {
+		err = fmt.Errorf("expected 13 bytes for channel block key, got %d bytes", len(ibytes))
+		return
+	}
+	channel = ibytes[0]
+	izyx = dvid.IZYXString(ibytes[1:])
+	return
+}
@@ -0,0 +1,606 @@
+/*
+	Package multichan implements DVID support for image blocks with an arbitrary number of
+	channels, each of which can be uint8, uint16, or float32.  Unlike multichan16, which is
+	tied to V3D Raw ingestion and addresses channels by data name suffix, channels are selected
+	through query strings and each channel's blocks are stored separately so a channel can be
+	read or written without touching the others.
+*/
+package multichan
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+const (
+	Version  = "0.1"
+	RepoURL  = "github.com/janelia-flyem/dvid/datatype/multichan"
+	TypeName = "multichan"
+
+	// DefaultBlockSize is the default size along each dimension of a block.
+	DefaultBlockSize = 32
+
+	DefaultRes   float32 = 8
+	DefaultUnits         = "nanometers"
+)
+
+const helpMessage = `
+API for multichannel image block datatype (github.com/janelia-flyem/dvid/datatype/multichan)
+============================================================================================
+
+Command-line:
+
+$ dvid repo <UUID> new multichan <data name> <settings...>
+
+	Adds newly named multichannel data to repo with specified UUID.
+
+	Example:
+
+	$ dvid repo 3f8c new multichan lightsheet Channels=uint16,uint16,float32 ChannelNames=gfp,rfp,prob
+
+    Arguments:
+
+    UUID           Hexadecimal string with enough characters to uniquely identify a version node.
+    data name      Name of data to create, e.g., "lightsheet"
+    settings       Configuration settings in "key=value" format separated by spaces.
+
+    Configuration Settings (case-insensitive keys)
+
+    Channels       Comma-separated list of channel types, each "uint8", "uint16", or "float32".
+                     (default: "uint16", a single 16-bit channel)
+    ChannelNames   Optional comma-separated list of channel names.
+    BlockSize      Size in voxels  (default: %d,%d,%d)
+    VoxelSize      Voxel resolution in "x,y,z" format (default: %f,%f,%f)
+    VoxelUnits     Resolution units (default: "nanometers")
+
+    ------------------
+
+HTTP API (Level 2 REST):
+
+GET  <api URL>/node/<UUID>/<data name>/help
+
+	Returns data-specific help message.
+
+
+GET  <api URL>/node/<UUID>/<data name>/info
+
+    Retrieves JSON with configuration settings including the channels.
+
+    Arguments:
+
+    UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+    data name     Name of multichan data.
+
+
+GET  <api URL>/node/<UUID>/<data name>/channels
+POST <api URL>/node/<UUID>/<data name>/channels
+
+    Retrieves or sets the per-channel name and display settings used for composite images.
+    The JSON is a list with one object per channel:
+
+    [
+        {"Name": "gfp", "Type": "uint16", "Color": "00ff00", "Min": 100, "Max": 4000},
+        {"Name": "rfp", "Type": "uint16", "Color": "ff00ff", "Min": 0, "Max": 0},
+        ...
+    ]
+
+    Color is a hex RGB string.  Min and Max give the value range mapped from black to the
+    channel color; if Max is not greater than Min, the range of values in each requested
+    image is used.  The channel type cannot be changed, so "Type" can be omitted on POST.
+
+
+GET  <api URL>/node/<UUID>/<data name>/raw/<dims>/<size>/<offset>[/<format>][?queryopts]
+POST <api URL>/node/<UUID>/<data name>/raw/0_1_2/<size>/<offset>[?queryopts]
+
+    Retrieves 2d images or 3d subvolumes of selected channels, or stores 3d subvolumes.
+
+    Example:
+
+    GET <api URL>/node/3f8c/lightsheet/raw/xy/512_256/0_0_100/jpg:80?channels=0,2
+
+    Returns an XY composite image of channels 0 and 2 with width (x) of 512 voxels and
+    height (y) of 256 voxels with offset (0,0,100) in JPG format with quality 80.
+
+    For 2d requests, a single selected channel is returned as a grayscale image of its native
+    type unless "composite" is "true".  Otherwise, each selected channel is scaled by its range
+    and added in its color to produce an RGB image.
+
+    For 3d requests, the "Content-type" is "application/octet-stream" and the selected channels
+    are returned or stored in one of two layouts, each with little-endian values of the
+    channel's type:
+
+        planar       Each channel's voxels in ZYX order (X iterates most rapidly), one
+                       channel after another in the order selected.
+        interleaved  Voxels in ZYX order where each voxel has the values of the selected
+                       channels in order.
+
+    POSTed subvolumes need not be block-aligned.  Only the selected channels are modified.
+
+    Arguments:
+
+    UUID          Hexadecimal string with enough characters to uniquely identify a version node.
+    data name     Name of data.
+    dims          The axes of data extraction in form "i_j_k,..."  Example: "0_2" can be XZ.
+                    Slice strings ("xy", "xz", or "yz") are also accepted.
+    size          Size in voxels along each dimension specified in <dims>.
+    offset        Gives coordinate of first voxel using dimensionality of data.
+    format        2D: "png", "jpg" (default: "png")
+                    jpg allows lossy quality setting, e.g., "jpg:80"
+
+    Query-string Options:
+
+    channels      Comma-separated list of channel indices, e.g., "0,2".  (default: all channels)
+    layout        For 3d requests, "planar" (default) or "interleaved".
+    composite     For 2d requests, if "true" returns an RGB composite even for one channel.
+    colors        Comma-separated hex RGB colors for each selected channel in a composite,
+                    e.g., "ff0000,00ff00".  Overrides the stored channel colors.
+    ranges        Comma-separated "min:max" value ranges for each selected channel in a composite,
+                    e.g., "0:4000,:1.5" where an empty min or max is set from the image values.
+                    Overrides the stored channel ranges.
+    colormap      For a single non-composite channel, "gray" or "viridis" to write a colormapped
+                    image using "min" and "max" query options as the value range.
+`
+
+func init() {
+	datastore.Register(NewType())
+
+	// Need to register types that will be used to fulfill interfaces.
+	gob.Register(&Type{})
+	gob.Register(&Data{})
+}
+
+// Type embeds the datastore's Type to create a unique type for multichannel functions.
+type Type struct {
+	datastore.Type
+}
+
+// NewType returns a pointer to a new multichan Type with default values set.
+func NewType() *Type {
+	dtype := new(Type)
+	dtype.Type = datastore.Type{
+		Name:    TypeName,
+		URL:     RepoURL,
+		Version: Version,
+		Requirements: &storage.Requirements{
+			Batcher: true,
+		},
+	}
+	return dtype
+}
+
+// --- TypeService interface ---
+
+// NewDataService returns a pointer to new multichan data with default values.
+func (dtype *Type) NewDataService(uuid dvid.UUID, id dvid.InstanceID, name dvid.InstanceName, c dvid.Config) (datastore.DataService, error) {
+	basedata, err := datastore.NewDataService(dtype, uuid, id, name, c)
+	if err != nil {
+		return nil, err
+	}
+	var p Properties
+	p.setDefault()
+	if err := p.setByConfig(c); err != nil {
+		return nil, err
+	}
+	return &Data{Data: basedata, Properties: p}, nil
+}
+
+func (dtype *Type) Help() string {
+	return fmt.Sprintf(helpMessage, DefaultBlockSize, DefaultBlockSize, DefaultBlockSize,
+		DefaultRes, DefaultRes, DefaultRes)
+}
+
+// Channel describes the value type and display settings of one channel.
+type Channel struct {
+	Name string
+
+	// Type is "uint8", "uint16", or "float32".
+	Type string
+
+	// Color is the hex RGB color, e.g., "ff0000", used for this channel in composites.
+	Color string
+
+	// Min and Max give the range of values mapped from black to Color in composites.
+	// If Max <= Min, the range of values in the requested image is used.
+	Min, Max float64
+}
+
+// DataValue returns the DVID value description for the channel.
+func (c Channel) DataValue() (dvid.DataValue, error) {
+	t, err := channelDataType(c.Type)
+	if err != nil {
+		return dvid.DataValue{}, err
+	}
+	return dvid.DataValue{T: t, Label: c.Name}, nil
+}
+
+func channelDataType(s string) (dvid.DataType, error) {
+	switch s {
+	case "uint8":
+		return dvid.T_uint8, nil
+	case "uint16":
+		return dvid.T_uint16, nil
+	case "float32":
+		return dvid.T_float32, nil
+	default:
+		return 0, fmt.Errorf("channel type must be \"uint8\", \"uint16\", or \"float32\", not %q", s)
+	}
+}
+
+// defaultColors are assigned to channels in order when creating new data.
+var defaultColors = []string{"ff0000", "00ff00", "0000ff", "ff00ff", "00ffff", "ffff00", "ffffff"}
+
+// Properties are additional properties for multichannel data instances beyond those
+// in standard datastore.Data.   These will be persisted to metadata storage.
+type Properties struct {
+	Channels []Channel
+
+	BlockSize dvid.Point3d
+
+	dvid.Resolution
+}
+
+func (p *Properties) setDefault() {
+	p.Channels = []Channel{{Name: "0", Type: "uint16", Color: defaultColors[0]}}
+	p.BlockSize = dvid.Point3d{DefaultBlockSize, DefaultBlockSize, DefaultBlockSize}
+	p.Resolution.VoxelSize = dvid.NdFloat32{DefaultRes, DefaultRes, DefaultRes}
+	p.Resolution.VoxelUnits = dvid.NdString{DefaultUnits, DefaultUnits, DefaultUnits}
+}
+
+// setByConfig sets properties based on type-specific keywords in the configuration.
+// Any property not described in the config is left as is.
+func (p *Properties) setByConfig(config dvid.Config) error {
+	s, found, err := config.GetString("Channels")
+	if err != nil {
+		return err
+	}
+	if found {
+		types := strings.Split(s, ",")
+		if len(types) > 256 {
+			return fmt.Errorf("multichan data can have at most 256 channels, not %d", len(types))
+		}
+		p.Channels = make([]Channel, len(types))
+		for i, t := range types {
+			t = strings.ToLower(strings.TrimSpace(t))
+			if _, err := channelDataType(t); err != nil {
+				return err
+			}
+			p.Channels[i] = Channel{
+				Name:  fmt.Sprintf("%d", i),
+				Type:  t,
+				Color: defaultColors[i%len(defaultColors)],
+			}
+		}
+	}
+	s, found, err = config.GetString("ChannelNames")
+	if err != nil {
+		return err
+	}
+	if found {
+		names := strings.Split(s, ",")
+		if len(names) != len(p.Channels) {
+			return fmt.Errorf("got %d channel names for %d channels", len(names), len(p.Channels))
+		}
+		for i, name := range names {
+			p.Channels[i].Name = strings.TrimSpace(name)
+		}
+	}
+	s, found, err = config.GetString("BlockSize")
+	if err != nil {
+		return err
+	}
+	if found {
+		pt, err := dvid.StringToPoint(s, ",")
+		if err != nil {
+			return err
+		}
+		if pt.NumDims() != 3 {
+			return fmt.Errorf("BlockSize must be 3d, not %dd", pt.NumDims())
+		}
+		p.BlockSize, _ = pt.(dvid.Point3d)
+	}
+	s, found, err = config.GetString("VoxelSize")
+	if err != nil {
+		return err
+	}
+	if found {
+		if p.Resolution.VoxelSize, err = dvid.StringToNdFloat32(s, ","); err != nil {
+			return err
+		}
+	}
+	s, found, err = config.GetString("VoxelUnits")
+	if err != nil {
+		return err
+	}
+	if found {
+		if p.Resolution.VoxelUnits, err = dvid.StringToNdString(s, ","); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Data embeds the datastore's Data and extends it with multichannel properties.
+type Data struct {
+	*datastore.Data
+	Properties
+
+	// serializes read-modify-write of partially covered blocks.
+	sync.Mutex
+}
+
+// CopyPropertiesFrom copies the data instance-specific properties from a given
+// data instance into the receiver's properties.  Fulfills the datastore.PropertyCopier interface.
+func (d *Data) CopyPropertiesFrom(src datastore.DataService, fs storage.FilterSpec) error {
+	d2, ok := src.(*Data)
+	if !ok {
+		return fmt.Errorf("unable to copy properties from non-multichan data %q", src.DataName())
+	}
+	d.Properties.Channels = make([]Channel, len(d2.Properties.Channels))
+	copy(d.Properties.Channels, d2.Properties.Channels)
+	d.Properties.BlockSize = d2.Properties.BlockSize
+	d.Properties.Resolution = d2.Properties.Resolution
+	return nil
+}
+
+// Equals returns true if the data instance and its properties are identical.
+func (d *Data) Equals(d2 *Data) bool {
+	if !d.Data.Equals(d2.Data) || !reflect.DeepEqual(d.Properties, d2.Properties) {
+		return false
+	}
+	return true
+}
+
+// GetByUUIDName returns a pointer to multichan data given a version (UUID) and data name.
+func GetByUUIDName(uuid dvid.UUID, name dvid.InstanceName) (*Data, error) {
+	source, err := datastore.GetDataByUUIDName(uuid, name)
+	if err != nil {
+		return nil, err
+	}
+	data, ok := source.(*Data)
+	if !ok {
+		return nil, fmt.Errorf("Instance '%s' is not a multichan datatype!", name)
+	}
+	return data, nil
+}
+
+func (d *Data) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Base     *datastore.Data
+		Extended Properties
+	}{
+		d.Data,
+		d.Properties,
+	})
+}
+
+func (d *Data) GobDecode(b []byte) error {
+	buf := bytes.NewBuffer(b)
+	dec := gob.NewDecoder(buf)
+	if err := dec.Decode(&(d.Data)); err != nil {
+		return err
+	}
+	if err := dec.Decode(&(d.Properties)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (d *Data) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	if err := enc.Encode(d.Data); err != nil {
+		return nil, err
+	}
+	if err := enc.Encode(d.Properties); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SetChannels updates the names and display settings of the channels.  The number and
+// types of channels cannot be changed.
+func (d *Data) SetChannels(channels []Channel) error {
+	if len(channels) != len(d.Channels) {
+		return fmt.Errorf("data %q has %d channels, got settings for %d channels", d.DataName(), len(d.Channels), len(channels))
+	}
+	for i, c := range channels {
+		if c.Type == "" {
+			channels[i].Type = d.Channels[i].Type
+		} else if c.Type != d.Channels[i].Type {
+			return fmt.Errorf("channel %d has type %q and can't be changed to %q", i, d.Channels[i].Type, c.Type)
+		}
+		if _, err := parseColor(c.Color); err != nil {
+			return fmt.Errorf("channel %d: %v", i, err)
+		}
+	}
+	d.Channels = channels
+	return nil
+}
+
+// --- DataService interface ---
+
+func (d *Data) Help() string {
+	return fmt.Sprintf(helpMessage, DefaultBlockSize, DefaultBlockSize, DefaultBlockSize,
+		DefaultRes, DefaultRes, DefaultRes)
+}
+
+// DoRPC acts as a switchboard for RPC commands.
+func (d *Data) DoRPC(request datastore.Request, reply *datastore.Response) error {
+	return fmt.Errorf("Unknown command.  Data '%s' [%s] does not support '%s' command.",
+		d.DataName(), d.TypeName(), request.TypeCommand())
+}
+
+// ServeHTTP handles all incoming HTTP requests for this data.
+func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request) (activity map[string]interface{}) {
+	timedLog := dvid.NewTimeLog()
+
+	// Get the action (GET, POST)
+	action := strings.ToLower(r.Method)
+	switch action {
+	case "get":
+	case "post":
+	default:
+		server.BadRequest(w, r, "multichan data can only handle GET or POST HTTP verbs")
+		return
+	}
+
+	// Break URL request into arguments
+	url := r.URL.Path[len(server.WebAPIPath):]
+	parts := strings.Split(url, "/")
+	if len(parts[len(parts)-1]) == 0 {
+		parts = parts[:len(parts)-1]
+	}
+	if len(parts) < 4 {
+		server.BadAPIRequest(w, r, d)
+		return
+	}
+
+	switch parts[3] {
+	case "help":
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintln(w, d.Help())
+
+	case "info":
+		jsonBytes, err := d.MarshalJSON()
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, string(jsonBytes))
+
+	case "channels":
+		if action == "get" {
+			jsonBytes, err := json.Marshal(d.Channels)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, string(jsonBytes))
+			return
+		}
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		var channels []Channel
+		if err := json.Unmarshal(data, &channels); err != nil {
+			server.BadRequest(w, r, "unable to parse channels JSON: %v", err)
+			return
+		}
+		if err := d.SetChannels(channels); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if err := datastore.SaveDataByUUID(uuid, d); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		timedLog.Infof("HTTP POST channels for data %q", d.DataName())
+
+	case "raw":
+		// GET  <api URL>/node/<UUID>/<data name>/raw/<dims>/<size>/<offset>[/<format>]
+		// POST <api URL>/node/<UUID>/<data name>/raw/0_1_2/<size>/<offset>
+		if len(parts) < 7 {
+			server.BadRequest(w, r, "%q must be followed by shape/size/offset", parts[3])
+			return
+		}
+		queryStrings := r.URL.Query()
+		selected, err := d.parseChannels(queryStrings.Get("channels"))
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		shapeStr, sizeStr, offsetStr := parts[4], parts[5], parts[6]
+		planeStr := dvid.DataShapeString(shapeStr)
+		plane, err := planeStr.DataShape()
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		switch plane.ShapeDimensions() {
+		case 2:
+			if action != "get" {
+				server.BadRequest(w, r, "DVID does not yet support POST of 2d images into multichan data")
+				return
+			}
+			slice, err := dvid.NewSliceFromStrings(planeStr, offsetStr, sizeStr, "_")
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			img, err := d.GetImage(ctx.VersionID(), slice, selected, queryStrings)
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			var formatStr string
+			if len(parts) >= 8 {
+				formatStr = parts[7]
+			}
+			if err := dvid.WriteImageHttp(w, img, formatStr); err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			timedLog.Infof("HTTP %s: %s channels %v (%s)", r.Method, plane, selected, r.URL)
+
+		case 3:
+			subvol, err := dvid.NewSubvolumeFromStrings(offsetStr, sizeStr, "_")
+			if err != nil {
+				server.BadRequest(w, r, err)
+				return
+			}
+			layout := queryStrings.Get("layout")
+			switch layout {
+			case "", LayoutPlanar, LayoutInterleaved:
+			default:
+				server.BadRequest(w, r, "layout must be %q or %q, not %q", LayoutPlanar, LayoutInterleaved, layout)
+				return
+			}
+			if action == "get" {
+				data, err := d.GetVolume(ctx.VersionID(), subvol, selected, layout)
+				if err != nil {
+					server.BadRequest(w, r, err)
+					return
+				}
+				w.Header().Set("Content-type", "application/octet-stream")
+				if _, err = w.Write(data); err != nil {
+					server.BadRequest(w, r, err)
+					return
+				}
+			} else {
+				data, err := ioutil.ReadAll(r.Body)
+				if err != nil {
+					server.BadRequest(w, r, err)
+					return
+				}
+				if err := d.PutVolume(ctx.VersionID(), subvol, selected, layout, data); err != nil {
+					server.BadRequest(w, r, err)
+					return
+				}
+			}
+			timedLog.Infof("HTTP %s: %s channels %v (%s)", r.Method, subvol, selected, r.URL)
+
+		default:
+			server.BadRequest(w, r, "DVID currently supports shapes of only 2 and 3 dimensions")
+		}
+
+	default:
+		server.BadAPIRequest(w, r, d)
+	}
+	return
+}
@@ -0,0 +1,259 @@
+package multichan
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/png"
+	"log"
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/server"
+)
+
+var (
+	dtype  datastore.TypeService
+	testMu sync.Mutex
+)
+
+// Sets package-level testRepo and TestVersionID
+func initTestRepo() (dvid.UUID, dvid.VersionID) {
+	testMu.Lock()
+	defer testMu.Unlock()
+	if dtype == nil {
+		var err error
+		dtype, err = datastore.TypeServiceByName(TypeName)
+		if err != nil {
+			log.Fatalf("Can't get multichan type: %v\n", err)
+		}
+	}
+	return datastore.NewTestRepo()
+}
+
+// makeChannels returns planar test data for a uint8, uint16, and float32 channel where
+// each voxel value is derived from its index.
+func makeChannels(numVoxels int) (c0, c1, c2 []byte) {
+	c0 = make([]byte, numVoxels)
+	c1 = make([]byte, numVoxels*2)
+	c2 = make([]byte, numVoxels*4)
+	for i := 0; i < numVoxels; i++ {
+		c0[i] = uint8(i % 251)
+		binary.LittleEndian.PutUint16(c1[i*2:i*2+2], uint16(i*3))
+		binary.LittleEndian.PutUint32(c2[i*4:i*4+4], math.Float32bits(float32(i)*0.5))
+	}
+	return
+}
+
+func TestMultichanRoundTrip(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("Channels", "uint8,uint16,float32")
+	config.Set("ChannelNames", "dapi,gfp,prob")
+	config.Set("BlockSize", "16,16,16")
+	server.CreateTestInstance(t, uuid, TypeName, "lm", config)
+
+	// Check the info.
+	apiStr := fmt.Sprintf("%snode/%s/lm/channels", server.WebAPIPath, uuid)
+	var channels []Channel
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", apiStr, nil), &channels); err != nil {
+		t.Fatalf("unable to parse channels: %v\n", err)
+	}
+	if len(channels) != 3 || channels[1].Name != "gfp" || channels[2].Type != "float32" {
+		t.Fatalf("bad channels: %v\n", channels)
+	}
+
+	// POST planar non-block-aligned subvolume of all channels.
+	numVoxels := 20 * 18 * 10
+	c0, c1, c2 := makeChannels(numVoxels)
+	var planar []byte
+	planar = append(planar, c0...)
+	planar = append(planar, c1...)
+	planar = append(planar, c2...)
+	apiStr = fmt.Sprintf("%snode/%s/lm/raw/0_1_2/20_18_10/5_7_9", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", apiStr, bytes.NewBuffer(planar))
+
+	data := server.TestHTTP(t, "GET", apiStr, nil)
+	if !bytes.Equal(data, planar) {
+		t.Fatalf("planar GET of %d bytes doesn't match POST of %d bytes\n", len(data), len(planar))
+	}
+
+	// Channel selection in interleaved layout.
+	data = server.TestHTTP(t, "GET", apiStr+"?channels=2,0&layout=interleaved", nil)
+	if len(data) != numVoxels*5 {
+		t.Fatalf("expected %d bytes for interleaved channels, got %d\n", numVoxels*5, len(data))
+	}
+	for i := 0; i < numVoxels; i++ {
+		if !bytes.Equal(data[i*5:i*5+4], c2[i*4:i*4+4]) || data[i*5+4] != c0[i] {
+			t.Fatalf("bad interleaved voxel %d: %v\n", i, data[i*5:i*5+5])
+		}
+	}
+
+	// Voxels outside the POSTed subvolume but in the same blocks are zero.
+	apiStr = fmt.Sprintf("%snode/%s/lm/raw/0_1_2/2_1_1/3_7_9?channels=1", server.WebAPIPath, uuid)
+	data = server.TestHTTP(t, "GET", apiStr, nil)
+	if !bytes.Equal(data, []byte{0, 0, 0, 0}) {
+		t.Errorf("expected zero voxels outside POST, got %v\n", data)
+	}
+
+	// POST interleaved data for channel 1 only into part of the volume.
+	update := make([]byte, 4*4*2*2)
+	for i := 0; i < 4*4*2; i++ {
+		binary.LittleEndian.PutUint16(update[i*2:i*2+2], 60000)
+	}
+	apiStr = fmt.Sprintf("%snode/%s/lm/raw/0_1_2/4_4_2/6_8_10?channels=1&layout=interleaved", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", apiStr, bytes.NewBuffer(update))
+	apiStr = fmt.Sprintf("%snode/%s/lm/raw/0_1_2/20_18_10/5_7_9", server.WebAPIPath, uuid)
+	data = server.TestHTTP(t, "GET", apiStr, nil)
+	if !bytes.Equal(data[:numVoxels], c0) {
+		t.Errorf("channel 0 modified by POST to channel 1\n")
+	}
+	if !bytes.Equal(data[numVoxels*3:], c2) {
+		t.Errorf("channel 2 modified by POST to channel 1\n")
+	}
+	got1 := data[numVoxels : numVoxels*3]
+	for z := 0; z < 10; z++ {
+		for y := 0; y < 18; y++ {
+			for x := 0; x < 20; x++ {
+				i := z*20*18 + y*20 + x
+				value := binary.LittleEndian.Uint16(got1[i*2 : i*2+2])
+				inside := x >= 1 && x < 5 && y >= 1 && y < 5 && z >= 1 && z < 3
+				if inside && value != 60000 {
+					t.Fatalf("expected updated value at (%d,%d,%d), got %d\n", x, y, z, value)
+				}
+				if !inside && value != uint16(i*3) {
+					t.Fatalf("expected original value at (%d,%d,%d), got %d\n", x, y, z, value)
+				}
+			}
+		}
+	}
+
+	// Bad requests.
+	server.TestBadHTTP(t, "GET", apiStr+"?channels=3", nil)
+	server.TestBadHTTP(t, "GET", apiStr+"?channels=1,1", nil)
+	server.TestBadHTTP(t, "GET", apiStr+"?layout=tiled", nil)
+	server.TestBadHTTP(t, "POST", apiStr, bytes.NewBuffer(planar[:100]))
+}
+
+func TestMultichanImages(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	config := dvid.NewConfig()
+	config.Set("Channels", "uint16,float32")
+	server.CreateTestInstance(t, uuid, TypeName, "lm", config)
+
+	// Channel 0 is 1000 everywhere, channel 1 varies from 0 to 1 along x.
+	numVoxels := 32 * 32 * 32
+	c0 := make([]byte, numVoxels*2)
+	c1 := make([]byte, numVoxels*4)
+	for i := 0; i < numVoxels; i++ {
+		binary.LittleEndian.PutUint16(c0[i*2:i*2+2], 1000)
+		binary.LittleEndian.PutUint32(c1[i*4:i*4+4], math.Float32bits(float32(i%32)/31))
+	}
+	apiStr := fmt.Sprintf("%snode/%s/lm/raw/0_1_2/32_32_32/0_0_0", server.WebAPIPath, uuid)
+	server.TestHTTP(t, "POST", apiStr, bytes.NewBuffer(append(c0, c1...)))
+
+	// Single native channel.
+	apiStr = fmt.Sprintf("%snode/%s/lm/raw/xy/32_32/0_0_5/png?channels=0", server.WebAPIPath, uuid)
+	img, _, err := image.Decode(bytes.NewBuffer(server.TestHTTP(t, "GET", apiStr, nil)))
+	if err != nil {
+		t.Fatalf("unable to decode single channel image: %v\n", err)
+	}
+	gray16, ok := img.(*image.Gray16)
+	if !ok {
+		t.Fatalf("expected 16-bit grayscale image, got %T\n", img)
+	}
+	if gray16.Gray16At(3, 4).Y != 1000 {
+		t.Errorf("expected 1000 in single channel image, got %d\n", gray16.Gray16At(3, 4).Y)
+	}
+
+	// Composite with stored colors (red, green) and explicit ranges.
+	apiStr = fmt.Sprintf("%snode/%s/lm/raw/xy/32_32/0_0_5/png?ranges=0:2000,0:1", server.WebAPIPath, uuid)
+	img, _, err = image.Decode(bytes.NewBuffer(server.TestHTTP(t, "GET", apiStr, nil)))
+	if err != nil {
+		t.Fatalf("unable to decode composite image: %v\n", err)
+	}
+	r, g, b, _ := img.At(0, 10).RGBA()
+	if r>>8 != 128 || g>>8 != 0 || b>>8 != 0 {
+		t.Errorf("expected (128,0,0) at left of composite, got (%d,%d,%d)\n", r>>8, g>>8, b>>8)
+	}
+	r, g, b, _ = img.At(31, 10).RGBA()
+	if r>>8 != 128 || g>>8 != 255 || b>>8 != 0 {
+		t.Errorf("expected (128,255,0) at right of composite, got (%d,%d,%d)\n", r>>8, g>>8, b>>8)
+	}
+
+	// Store display settings and override color by query.
+	apiStr = fmt.Sprintf("%snode/%s/lm/channels", server.WebAPIPath, uuid)
+	settings := `[{"Name":"gfp","Color":"00ff00","Min":0,"Max":1000},{"Name":"prob","Color":"0000ff"}]`
+	server.TestHTTP(t, "POST", apiStr, bytes.NewBufferString(settings))
+	server.TestBadHTTP(t, "POST", apiStr, bytes.NewBufferString(`[{"Name":"gfp","Color":"00ff00"}]`))
+	server.TestBadHTTP(t, "POST", apiStr, bytes.NewBufferString(`[{"Type":"uint8","Color":"00ff00"},{"Color":"0000ff"}]`))
+
+	apiStr = fmt.Sprintf("%snode/%s/lm/raw/xy/32_32/0_0_5/png?channels=1,0&colors=ff0000,0000ff", server.WebAPIPath, uuid)
+	img, _, err = image.Decode(bytes.NewBuffer(server.TestHTTP(t, "GET", apiStr, nil)))
+	if err != nil {
+		t.Fatalf("unable to decode composite image: %v\n", err)
+	}
+	r, g, b, _ = img.At(31, 0).RGBA()
+	if r>>8 != 255 || g>>8 != 0 || b>>8 != 255 {
+		t.Errorf("expected (255,0,255) at right of composite, got (%d,%d,%d)\n", r>>8, g>>8, b>>8)
+	}
+
+	apiStr = fmt.Sprintf("%snode/%s/lm/raw/xy/32_32/0_0_5/png?colors=ff0000", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", apiStr, nil)
+	apiStr = fmt.Sprintf("%snode/%s/lm/raw/xy/32_32/0_0_5/png?ranges=0-1,0:1", server.WebAPIPath, uuid)
+	server.TestBadHTTP(t, "GET", apiStr, nil)
+}
+
+func TestMultichanRepoPersistence(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+
+	config := dvid.NewConfig()
+	config.Set("Channels", "uint8,float32")
+	config.Set("VoxelSize", "4,4,40")
+	dataservice, err := datastore.NewData(uuid, dtype, "mymultichan", config)
+	if err != nil {
+		t.Fatalf("Unable to create multichan instance: %v\n", err)
+	}
+	mcdata, ok := dataservice.(*Data)
+	if !ok {
+		t.Fatalf("Can't cast multichan data service into multichan.Data\n")
+	}
+	if err = datastore.SaveDataByUUID(uuid, mcdata); err != nil {
+		t.Fatalf("Unable to save repo during multichan persistence test: %v\n", err)
+	}
+	datastore.CloseReopenTest()
+
+	mcdata2, err := GetByUUIDName(uuid, "mymultichan")
+	if err != nil {
+		t.Fatalf("Can't get multichan instance from reloaded test db: %v\n", err)
+	}
+	if !mcdata.Equals(mcdata2) {
+		t.Errorf("Expected %v, got %v\n", mcdata.Properties, mcdata2.Properties)
+	}
+
+	config = dvid.NewConfig()
+	config.Set("Channels", "uint8,int64")
+	if _, err := datastore.NewData(uuid, dtype, "badmultichan", config); err == nil {
+		t.Errorf("Expected error creating multichan with unsupported channel type\n")
+	}
+}
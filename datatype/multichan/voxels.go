@@ -0,0 +1,505 @@
+/*
+	This file handles reading and writing of channel voxels and composite rendering.
+*/
+
+package multichan
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/datatype/imageblk"
+	"github.com/janelia-flyem/dvid/dvid"
+	"github.com/janelia-flyem/dvid/storage"
+)
+
+// Layouts of multichannel 3d data in HTTP requests.
+const (
+	LayoutPlanar      = "planar"
+	LayoutInterleaved = "interleaved"
+)
+
+// parseChannels returns the channel indices in a comma-separated string or all channels
+// if the string is empty.
+func (d *Data) parseChannels(s string) ([]int, error) {
+	if s == "" {
+		selected := make([]int, len(d.Channels))
+		for i := range selected {
+			selected[i] = i
+		}
+		return selected, nil
+	}
+	var selected []int
+	used := make(map[int]bool)
+	for _, str := range strings.Split(s, ",") {
+		c, err := strconv.Atoi(strings.TrimSpace(str))
+		if err != nil {
+			return nil, fmt.Errorf("bad channel %q: %v", str, err)
+		}
+		if c < 0 || c >= len(d.Channels) {
+			return nil, fmt.Errorf("channel %d is outside data %q channels 0 to %d", c, d.DataName(), len(d.Channels)-1)
+		}
+		if used[c] {
+			return nil, fmt.Errorf("channel %d selected more than once", c)
+		}
+		used[c] = true
+		selected = append(selected, c)
+	}
+	return selected, nil
+}
+
+// parseColor returns the RGB components of a hex color string like "ff00ff" or "#ff00ff".
+func parseColor(s string) ([3]uint8, error) {
+	var rgb [3]uint8
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "#"))
+	if err != nil || len(b) != 3 {
+		return rgb, fmt.Errorf("color must be a 6 digit hex RGB string, not %q", s)
+	}
+	copy(rgb[:], b)
+	return rgb, nil
+}
+
+// newChannelVoxels returns empty voxels of a geometry for the given channel.
+func (d *Data) newChannelVoxels(geom dvid.Geometry, channel int) (*imageblk.Voxels, error) {
+	value, err := d.Channels[channel].DataValue()
+	if err != nil {
+		return nil, err
+	}
+	values := dvid.DataValues{value}
+	bytesPerVoxel := values.BytesPerElement()
+	stride := geom.Size().Value(0) * bytesPerVoxel
+	data := make([]byte, geom.NumVoxels()*int64(bytesPerVoxel))
+	return imageblk.NewVoxels(geom, values, data, stride), nil
+}
+
+// blockRange returns the first and last block coordinates intersecting a geometry.
+func (d *Data) blockRange(geom dvid.Geometry) (begBlock, endBlock dvid.ChunkPoint3d, err error) {
+	begVoxel, ok := geom.StartPoint().(dvid.Chunkable)
+	if !ok {
+		err = fmt.Errorf("geometry %s start point is not chunkable", geom)
+		return
+	}
+	endVoxel, ok := geom.EndPoint().(dvid.Chunkable)
+	if !ok {
+		err = fmt.Errorf("geometry %s end point is not chunkable", geom)
+		return
+	}
+	begBlock = begVoxel.Chunk(d.BlockSize).(dvid.ChunkPoint3d)
+	endBlock = endVoxel.Chunk(d.BlockSize).(dvid.ChunkPoint3d)
+	return
+}
+
+// blockBytes returns the number of bytes in a block of the given channel.
+func (d *Data) blockBytes(channel int) int {
+	t, _ := channelDataType(d.Channels[channel].Type)
+	return int(d.BlockSize.Prod()) * int(dvid.DataTypeBytes(t))
+}
+
+// GetChannelVoxels copies a channel's stored blocks into the given voxels, leaving
+// voxels in absent blocks as zero.
+func (d *Data) GetChannelVoxels(v dvid.VersionID, channel int, vox *imageblk.Voxels) error {
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	ctx := datastore.NewVersionedCtx(d, v)
+	begBlock, endBlock, err := d.blockRange(vox)
+	if err != nil {
+		return err
+	}
+	numBytes := d.blockBytes(channel)
+	for z := begBlock[2]; z <= endBlock[2]; z++ {
+		for y := begBlock[1]; y <= endBlock[1]; y++ {
+			begTKey := NewBlockTKey(uint8(channel), dvid.ChunkPoint3d{begBlock[0], y, z}.ToIZYXString())
+			endTKey := NewBlockTKey(uint8(channel), dvid.ChunkPoint3d{endBlock[0], y, z}.ToIZYXString())
+			kvs, err := store.GetRange(ctx, begTKey, endTKey)
+			if err != nil {
+				return err
+			}
+			for _, kv := range kvs {
+				_, izyx, err := DecodeBlockTKey(kv.K)
+				if err != nil {
+					return err
+				}
+				blockData, _, err := dvid.DeserializeData(kv.V, true)
+				if err != nil {
+					return fmt.Errorf("unable to deserialize block %s of channel %d: %v", izyx, channel, err)
+				}
+				if len(blockData) != numBytes {
+					return fmt.Errorf("block %s of channel %d has %d bytes, expected %d", izyx, channel, len(blockData), numBytes)
+				}
+				block := &storage.TKeyValue{K: imageblk.NewTKeyByCoord(izyx), V: blockData}
+				if err := vox.ReadBlock(block, d.BlockSize, 0); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// PutChannelVoxels writes voxels into a channel's blocks.  Blocks only partially covered
+// by the voxels are read and modified.
+func (d *Data) PutChannelVoxels(v dvid.VersionID, channel int, vox *imageblk.Voxels) error {
+	store, err := datastore.GetOrderedKeyValueDB(d)
+	if err != nil {
+		return err
+	}
+	batcher, err := datastore.GetKeyValueBatcher(d)
+	if err != nil {
+		return err
+	}
+	ctx := datastore.NewVersionedCtx(d, v)
+	begBlock, endBlock, err := d.blockRange(vox)
+	if err != nil {
+		return err
+	}
+	startPt := vox.StartPoint().(dvid.Point3d)
+	endPt := vox.EndPoint().(dvid.Point3d)
+	numBytes := d.blockBytes(channel)
+
+	d.Lock()
+	defer d.Unlock()
+
+	batch := batcher.NewBatch(ctx)
+	var numPuts int
+	for z := begBlock[2]; z <= endBlock[2]; z++ {
+		for y := begBlock[1]; y <= endBlock[1]; y++ {
+			for x := begBlock[0]; x <= endBlock[0]; x++ {
+				chunkPt := dvid.ChunkPoint3d{x, y, z}
+				izyx := chunkPt.ToIZYXString()
+				tk := NewBlockTKey(uint8(channel), izyx)
+
+				// Only need prior block data if voxels don't cover the whole block.
+				minVoxel := chunkPt.MinPoint(d.BlockSize).(dvid.Point3d)
+				maxVoxel := chunkPt.MaxPoint(d.BlockSize).(dvid.Point3d)
+				var blockData []byte
+				if startPt[0] > minVoxel[0] || startPt[1] > minVoxel[1] || startPt[2] > minVoxel[2] ||
+					endPt[0] < maxVoxel[0] || endPt[1] < maxVoxel[1] || endPt[2] < maxVoxel[2] {
+					serialization, err := store.Get(ctx, tk)
+					if err != nil {
+						return err
+					}
+					if serialization != nil {
+						if blockData, _, err = dvid.DeserializeData(serialization, true); err != nil {
+							return fmt.Errorf("unable to deserialize block %s of channel %d: %v", izyx, channel, err)
+						}
+						if len(blockData) != numBytes {
+							return fmt.Errorf("block %s of channel %d has %d bytes, expected %d", izyx, channel, len(blockData), numBytes)
+						}
+					}
+				}
+				if blockData == nil {
+					blockData = make([]byte, numBytes)
+				}
+				block := &storage.TKeyValue{K: imageblk.NewTKeyByCoord(izyx), V: blockData}
+				if err := vox.WriteBlock(block, d.BlockSize); err != nil {
+					return err
+				}
+				serialization, err := dvid.SerializeData(blockData, d.Compression(), d.Checksum())
+				if err != nil {
+					return err
+				}
+				batch.Put(tk, serialization)
+
+				numPuts++
+				if numPuts%imageblk.KVWriteSize == 0 {
+					if err := batch.Commit(); err != nil {
+						return fmt.Errorf("error on batch write of channel %d blocks: %v", channel, err)
+					}
+					batch = batcher.NewBatch(ctx)
+				}
+			}
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		return fmt.Errorf("error on batch write of channel %d blocks: %v", channel, err)
+	}
+	return nil
+}
+
+// GetVolume returns the selected channels of a subvolume in the given layout.
+func (d *Data) GetVolume(v dvid.VersionID, subvol *dvid.Subvolume, selected []int, layout string) ([]byte, error) {
+	channelData := make([][]byte, len(selected))
+	for i, c := range selected {
+		vox, err := d.newChannelVoxels(subvol, c)
+		if err != nil {
+			return nil, err
+		}
+		if err := d.GetChannelVoxels(v, c, vox); err != nil {
+			return nil, err
+		}
+		channelData[i] = vox.Data()
+	}
+	if layout == LayoutInterleaved {
+		return d.interleave(channelData, selected, subvol.NumVoxels()), nil
+	}
+	var size int
+	for _, data := range channelData {
+		size += len(data)
+	}
+	out := make([]byte, 0, size)
+	for _, data := range channelData {
+		out = append(out, data...)
+	}
+	return out, nil
+}
+
+// PutVolume stores the selected channels of a subvolume given data in the given layout.
+func (d *Data) PutVolume(v dvid.VersionID, subvol *dvid.Subvolume, selected []int, layout string, data []byte) error {
+	numVoxels := subvol.NumVoxels()
+	var expected int64
+	for _, c := range selected {
+		expected += numVoxels * int64(d.valueBytes(c))
+	}
+	if int64(len(data)) != expected {
+		return fmt.Errorf("expected %d bytes for %d channels of subvolume %s, got %d bytes", expected, len(selected), subvol, len(data))
+	}
+	var channelData [][]byte
+	if layout == LayoutInterleaved {
+		channelData = d.deinterleave(data, selected, numVoxels)
+	} else {
+		var beg int64
+		for _, c := range selected {
+			end := beg + numVoxels*int64(d.valueBytes(c))
+			channelData = append(channelData, data[beg:end])
+			beg = end
+		}
+	}
+	for i, c := range selected {
+		vox, err := d.newChannelVoxels(subvol, c)
+		if err != nil {
+			return err
+		}
+		vox.SetData(channelData[i])
+		if err := d.PutChannelVoxels(v, c, vox); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// valueBytes returns the number of bytes per voxel for a channel.
+func (d *Data) valueBytes(channel int) int {
+	t, _ := channelDataType(d.Channels[channel].Type)
+	return int(dvid.DataTypeBytes(t))
+}
+
+// interleave combines planar channel data into voxels with consecutive channel values.
+func (d *Data) interleave(channelData [][]byte, selected []int, numVoxels int64) []byte {
+	var voxelBytes int
+	for _, c := range selected {
+		voxelBytes += d.valueBytes(c)
+	}
+	out := make([]byte, numVoxels*int64(voxelBytes))
+	var offset int
+	for i, c := range selected {
+		nbytes := d.valueBytes(c)
+		src := channelData[i]
+		for n := int64(0); n < numVoxels; n++ {
+			dst := int(n)*voxelBytes + offset
+			copy(out[dst:dst+nbytes], src[int(n)*nbytes:int(n+1)*nbytes])
+		}
+		offset += nbytes
+	}
+	return out
+}
+
+// deinterleave splits voxels with consecutive channel values into planar channel data.
+func (d *Data) deinterleave(data []byte, selected []int, numVoxels int64) [][]byte {
+	var voxelBytes int
+	for _, c := range selected {
+		voxelBytes += d.valueBytes(c)
+	}
+	channelData := make([][]byte, len(selected))
+	var offset int
+	for i, c := range selected {
+		nbytes := d.valueBytes(c)
+		dst := make([]byte, numVoxels*int64(nbytes))
+		for n := int64(0); n < numVoxels; n++ {
+			src := int(n)*voxelBytes + offset
+			copy(dst[int(n)*nbytes:int(n+1)*nbytes], data[src:src+nbytes])
+		}
+		channelData[i] = dst
+		offset += nbytes
+	}
+	return channelData
+}
+
+// GetImage returns a 2d image of the selected channels.  A single channel is returned in
+// its native type unless a composite is requested via the "composite" query option.
+func (d *Data) GetImage(v dvid.VersionID, slice dvid.Geometry, selected []int, queryStrings url.Values) (image.Image, error) {
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no channels selected for image")
+	}
+	if len(selected) == 1 && queryStrings.Get("composite") != "true" {
+		vox, err := d.newChannelVoxels(slice, selected[0])
+		if err != nil {
+			return nil, err
+		}
+		if err := d.GetChannelVoxels(v, selected[0], vox); err != nil {
+			return nil, err
+		}
+		img, err := vox.GetImage2d()
+		if err != nil {
+			return nil, err
+		}
+		colormap := queryStrings.Get("colormap")
+		if colormap == "" {
+			return img.Get(), nil
+		}
+		minVal, maxVal := math.NaN(), math.NaN()
+		if s := queryStrings.Get("min"); s != "" {
+			if minVal, err = strconv.ParseFloat(s, 64); err != nil {
+				return nil, fmt.Errorf("bad colormap min %q: %v", s, err)
+			}
+		}
+		if s := queryStrings.Get("max"); s != "" {
+			if maxVal, err = strconv.ParseFloat(s, 64); err != nil {
+				return nil, fmt.Errorf("bad colormap max %q: %v", s, err)
+			}
+		}
+		return dvid.ColormapImage(img, colormap, minVal, maxVal)
+	}
+
+	// Get the display settings for each selected channel.
+	colors := make([][3]uint8, len(selected))
+	ranges := make([][2]float64, len(selected))
+	for i, c := range selected {
+		rgb, err := parseColor(d.Channels[c].Color)
+		if err != nil {
+			return nil, err
+		}
+		colors[i] = rgb
+		if d.Channels[c].Max > d.Channels[c].Min {
+			ranges[i] = [2]float64{d.Channels[c].Min, d.Channels[c].Max}
+		} else {
+			ranges[i] = [2]float64{math.NaN(), math.NaN()}
+		}
+	}
+	if s := queryStrings.Get("colors"); s != "" {
+		colorStrs := strings.Split(s, ",")
+		if len(colorStrs) != len(selected) {
+			return nil, fmt.Errorf("got %d colors for %d selected channels", len(colorStrs), len(selected))
+		}
+		for i, colorStr := range colorStrs {
+			rgb, err := parseColor(colorStr)
+			if err != nil {
+				return nil, err
+			}
+			colors[i] = rgb
+		}
+	}
+	if s := queryStrings.Get("ranges"); s != "" {
+		rangeStrs := strings.Split(s, ",")
+		if len(rangeStrs) != len(selected) {
+			return nil, fmt.Errorf("got %d ranges for %d selected channels", len(rangeStrs), len(selected))
+		}
+		for i, rangeStr := range rangeStrs {
+			minmax := strings.Split(rangeStr, ":")
+			if len(minmax) != 2 {
+				return nil, fmt.Errorf("channel range must be in \"min:max\" format, not %q", rangeStr)
+			}
+			for j := 0; j < 2; j++ {
+				ranges[i][j] = math.NaN()
+				if minmax[j] == "" {
+					continue
+				}
+				val, err := strconv.ParseFloat(minmax[j], 64)
+				if err != nil {
+					return nil, fmt.Errorf("bad channel range %q: %v", rangeStr, err)
+				}
+				ranges[i][j] = val
+			}
+		}
+	}
+
+	size := slice.Size()
+	width, height := int(size.Value(0)), int(size.Value(1))
+	sums := make([][3]float64, width*height)
+	for i, c := range selected {
+		vox, err := d.newChannelVoxels(slice, c)
+		if err != nil {
+			return nil, err
+		}
+		if err := d.GetChannelVoxels(v, c, vox); err != nil {
+			return nil, err
+		}
+		values := channelValues(vox.Data(), d.Channels[c].Type)
+		minVal, maxVal := valueRange(values, ranges[i][0], ranges[i][1])
+		for n, val := range values {
+			if math.IsNaN(val) {
+				continue
+			}
+			var f float64
+			if maxVal > minVal {
+				f = math.Max(0, math.Min(1, (val-minVal)/(maxVal-minVal)))
+			} else if val >= maxVal {
+				f = 1
+			}
+			for k := 0; k < 3; k++ {
+				sums[n][k] += f * float64(colors[i][k])
+			}
+		}
+	}
+	composite := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for n, sum := range sums {
+		for k := 0; k < 3; k++ {
+			composite.Pix[4*n+k] = uint8(math.Min(255, sum[k]+0.5))
+		}
+		composite.Pix[4*n+3] = 255
+	}
+	return composite, nil
+}
+
+// channelValues returns the little-endian values of a channel type as float64.
+func channelValues(data []byte, channelType string) []float64 {
+	var values []float64
+	switch channelType {
+	case "uint8":
+		values = make([]float64, len(data))
+		for i, b := range data {
+			values[i] = float64(b)
+		}
+	case "uint16":
+		values = make([]float64, len(data)/2)
+		for i := range values {
+			values[i] = float64(binary.LittleEndian.Uint16(data[i*2 : i*2+2]))
+		}
+	case "float32":
+		values = make([]float64, len(data)/4)
+		for i := range values {
+			values[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(data[i*4 : i*4+4])))
+		}
+	}
+	return values
+}
+
+// valueRange returns the given min and max, setting either from the values if NaN.
+func valueRange(values []float64, minVal, maxVal float64) (float64, float64) {
+	if !math.IsNaN(minVal) && !math.IsNaN(maxVal) {
+		return minVal, maxVal
+	}
+	imgMin, imgMax := math.Inf(1), math.Inf(-1)
+	for _, val := range values {
+		if math.IsNaN(val) {
+			continue
+		}
+		imgMin = math.Min(imgMin, val)
+		imgMax = math.Max(imgMax, val)
+	}
+	if math.IsNaN(minVal) {
+		minVal = imgMin
+	}
+	if math.IsNaN(maxVal) {
+		maxVal = imgMax
+	}
+	return minVal, maxVal
+}
@@ -0,0 +1,398 @@
+/*
+	This file supports ROI set operations and morphology over sorted span lists.
+*/
+
+package roi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+const (
+	// MaxMorphologySize is the largest structuring element size, in blocks, for dilation and erosion.
+	MaxMorphologySize = 32
+
+	// MaxDilationSpans is the largest number of spans a dilation may produce in each pass.
+	MaxDilationSpans = 1 << 22
+
+	// MaxExprDepth is the deepest nesting of operations in an ROI expression.
+	MaxExprDepth = 16
+)
+
+// UnionSpans returns the normalized spans covering blocks in any of the given span lists.
+func UnionSpans(spanLists ...dvid.Spans) dvid.Spans {
+	var all dvid.Spans
+	for _, spans := range spanLists {
+		all = append(all, spans...)
+	}
+	return all.Normalize()
+}
+
+// IntersectSpans returns the normalized spans covering blocks in both a and b.
+func IntersectSpans(a, b dvid.Spans) dvid.Spans {
+	return combineRows(a.Normalize(), b.Normalize(), true, intersectRow)
+}
+
+// SubtractSpans returns the normalized spans covering blocks in a but not in b.
+func SubtractSpans(a, b dvid.Spans) dvid.Spans {
+	return combineRows(a.Normalize(), b.Normalize(), false, subtractRow)
+}
+
+// DilateSpans returns the spans dilated by a cubic structuring element that extends
+// n blocks in each direction.  An error is returned if a dilation pass would produce more
+// than MaxDilationSpans spans.
+func DilateSpans(spans dvid.Spans, n int32) (dvid.Spans, error) {
+	norm := spans.Normalize()
+	if n <= 0 || len(norm) == 0 {
+		return norm, nil
+	}
+	// The cubic element is separable, so dilate along x, then y, then z.
+	numSpans := len(norm) * int(2*n+1)
+	if numSpans > MaxDilationSpans {
+		return nil, fmt.Errorf("dilation of %d spans by %d blocks exceeds the limit of %d spans", len(norm), n, MaxDilationSpans)
+	}
+	grown := make(dvid.Spans, 0, numSpans)
+	for _, span := range norm {
+		for dy := -n; dy <= n; dy++ {
+			grown = append(grown, dvid.Span{span[0], span[1] + dy, span[2] - n, span[3] + n})
+		}
+	}
+	norm = grown.Normalize()
+	numSpans = len(norm) * int(2*n+1)
+	if numSpans > MaxDilationSpans {
+		return nil, fmt.Errorf("dilation of %d spans by %d blocks exceeds the limit of %d spans", len(norm), n, MaxDilationSpans)
+	}
+	grown = make(dvid.Spans, 0, numSpans)
+	for _, span := range norm {
+		for dz := -n; dz <= n; dz++ {
+			grown = append(grown, dvid.Span{span[0] + dz, span[1], span[2], span[3]})
+		}
+	}
+	return grown.Normalize(), nil
+}
+
+// ErodeSpans returns the spans eroded by a cubic structuring element that extends
+// n blocks in each direction, i.e., only blocks whose neighborhood is entirely within
+// the spans remain.
+func ErodeSpans(spans dvid.Spans, n int32) dvid.Spans {
+	norm := spans.Normalize()
+	if n <= 0 || len(norm) == 0 {
+		return norm
+	}
+	shrunk := make(dvid.Spans, 0, len(norm))
+	for _, span := range norm {
+		if span[3]-span[2] >= 2*n {
+			shrunk = append(shrunk, dvid.Span{span[0], span[1], span[2] + n, span[3] - n})
+		}
+	}
+	return erodeRows(erodeRows(shrunk, n, 0, 1), n, 1, 0)
+}
+
+type rowKey [2]int32 // z, y
+
+// returns the spans of each (z, y) row of normalized spans in sorted order.
+func spanRows(spans dvid.Spans) (keys []rowKey, rows map[rowKey]dvid.Spans) {
+	rows = make(map[rowKey]dvid.Spans)
+	for i := 0; i < len(spans); {
+		j := i + 1
+		for j < len(spans) && spans[j][0] == spans[i][0] && spans[j][1] == spans[i][1] {
+			j++
+		}
+		key := rowKey{spans[i][0], spans[i][1]}
+		keys = append(keys, key)
+		rows[key] = spans[i:j]
+		i = j
+	}
+	return
+}
+
+// erodes normalized spans along z (dz = 1) or y (dy = 1) by intersecting each row with
+// its neighboring rows.
+func erodeRows(spans dvid.Spans, n, dz, dy int32) dvid.Spans {
+	keys, rows := spanRows(spans)
+	eroded := dvid.Spans{}
+	for _, key := range keys {
+		result := rows[key]
+		for d := -n; d <= n && len(result) != 0; d++ {
+			if d == 0 {
+				continue
+			}
+			other, found := rows[rowKey{key[0] + d*dz, key[1] + d*dy}]
+			if !found {
+				result = nil
+				break
+			}
+			result = intersectRow(result, other)
+		}
+		eroded = append(eroded, result...)
+	}
+	return eroded
+}
+
+// combines rows of normalized spans a and b, where rows only in a are kept unless
+// both are required.
+func combineRows(a, b dvid.Spans, both bool, op func(a, b dvid.Spans) dvid.Spans) dvid.Spans {
+	aKeys, aRows := spanRows(a)
+	_, bRows := spanRows(b)
+	result := dvid.Spans{}
+	for _, key := range aKeys {
+		bRow, found := bRows[key]
+		if !found {
+			if !both {
+				result = append(result, aRows[key]...)
+			}
+			continue
+		}
+		result = append(result, op(aRows[key], bRow)...)
+	}
+	return result
+}
+
+// returns the intersection of two sorted, non-overlapping spans within a row using
+// the row of a.
+func intersectRow(a, b dvid.Spans) dvid.Spans {
+	var result dvid.Spans
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		x0, x1 := a[i][2], a[i][3]
+		if b[j][2] > x0 {
+			x0 = b[j][2]
+		}
+		if b[j][3] < x1 {
+			x1 = b[j][3]
+		}
+		if x0 <= x1 {
+			result = append(result, dvid.Span{a[i][0], a[i][1], x0, x1})
+		}
+		if a[i][3] < b[j][3] {
+			i++
+		} else {
+			j++
+		}
+	}
+	return result
+}
+
+// returns the spans of a row not covered by sorted, non-overlapping spans of b.
+func subtractRow(a, b dvid.Spans) dvid.Spans {
+	var result dvid.Spans
+	j := 0
+	for _, span := range a {
+		x0 := span[2]
+		for j < len(b) && b[j][3] < x0 {
+			j++
+		}
+		for k := j; k < len(b) && b[k][2] <= span[3]; k++ {
+			if b[k][2] > x0 {
+				result = append(result, dvid.Span{span[0], span[1], x0, b[k][2] - 1})
+			}
+			if b[k][3]+1 > x0 {
+				x0 = b[k][3] + 1
+			}
+		}
+		if x0 <= span[3] {
+			result = append(result, dvid.Span{span[0], span[1], x0, span[3]})
+		}
+	}
+	return result
+}
+
+// roiExpr is a parsed ROI compute expression.  Either name is set for an ROI operand
+// or op is set with its arguments.
+type roiExpr struct {
+	name dvid.InstanceName
+	op   string
+	args []*roiExpr
+	size int32 // structuring element size for dilate and erode
+}
+
+type exprParser struct {
+	tokens []string
+	pos    int
+	depth  int // nesting depth of the operation being parsed
+}
+
+func tokenizeExpr(s string) []string {
+	var tokens []string
+	var cur strings.Builder
+	flush := func() {
+		if cur.Len() != 0 {
+			tokens = append(tokens, cur.String())
+			cur.Reset()
+		}
+	}
+	for _, c := range s {
+		switch c {
+		case '(', ')', ',':
+			flush()
+			tokens = append(tokens, string(c))
+		case ' ', '\t', '\n', '\r':
+			flush()
+		default:
+			cur.WriteRune(c)
+		}
+	}
+	flush()
+	return tokens
+}
+
+func (p *exprParser) next() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	tok := p.tokens[p.pos]
+	p.pos++
+	return tok
+}
+
+func (p *exprParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) expect(tok string) error {
+	if got := p.next(); got != tok {
+		return fmt.Errorf("expected %q in ROI expression, got %q", tok, got)
+	}
+	return nil
+}
+
+func (p *exprParser) parse() (*roiExpr, error) {
+	tok := p.next()
+	switch tok {
+	case "", "(", ")", ",":
+		return nil, fmt.Errorf("expected ROI name or operation in ROI expression, got %q", tok)
+	}
+	if p.peek() != "(" {
+		return &roiExpr{name: dvid.InstanceName(tok)}, nil
+	}
+	p.next()
+	if p.depth++; p.depth > MaxExprDepth {
+		return nil, fmt.Errorf("ROI expression nests operations more than %d deep", MaxExprDepth)
+	}
+	defer func() { p.depth-- }()
+	expr := &roiExpr{op: strings.ToLower(tok)}
+	switch expr.op {
+	case "union", "intersect", "subtract":
+		for {
+			arg, err := p.parse()
+			if err != nil {
+				return nil, err
+			}
+			expr.args = append(expr.args, arg)
+			if p.peek() != "," {
+				break
+			}
+			p.next()
+		}
+		if len(expr.args) < 2 {
+			return nil, fmt.Errorf("%s in ROI expression requires at least 2 arguments", expr.op)
+		}
+	case "dilate", "erode":
+		arg, err := p.parse()
+		if err != nil {
+			return nil, err
+		}
+		expr.args = []*roiExpr{arg}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		sizeStr := p.next()
+		size, err := strconv.ParseInt(sizeStr, 10, 32)
+		if err != nil || size < 0 || size > MaxMorphologySize {
+			return nil, fmt.Errorf("%s in ROI expression requires size from 0 to %d blocks, got %q", expr.op, MaxMorphologySize, sizeStr)
+		}
+		expr.size = int32(size)
+	default:
+		return nil, fmt.Errorf("unknown operation %q in ROI expression", tok)
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return expr, nil
+}
+
+func parseROIExpr(s string) (*roiExpr, error) {
+	p := &exprParser{tokens: tokenizeExpr(s)}
+	expr, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q after end of ROI expression", p.peek())
+	}
+	return expr, nil
+}
+
+// evaluates the expression using ROI instances at the given version with the given block size.
+func (e *roiExpr) eval(v dvid.VersionID, blockSize dvid.Point3d) (dvid.Spans, error) {
+	if e.op == "" {
+		data, err := datastore.GetDataByVersionName(v, e.name)
+		if err != nil {
+			return nil, err
+		}
+		d, ok := data.(*Data)
+		if !ok {
+			return nil, fmt.Errorf("data instance %q in ROI expression is not an ROI", e.name)
+		}
+		if !d.BlockSize.Equals(blockSize) {
+			return nil, fmt.Errorf("ROI %q has block size %s, not %s", e.name, d.BlockSize, blockSize)
+		}
+		d.RLock()
+		spans, err := d.GetSpans(v)
+		d.RUnlock()
+		return dvid.Spans(spans), err
+	}
+	args := make([]dvid.Spans, len(e.args))
+	for i, arg := range e.args {
+		spans, err := arg.eval(v, blockSize)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = spans
+	}
+	switch e.op {
+	case "union":
+		return UnionSpans(args...), nil
+	case "intersect":
+		result := args[0]
+		for _, spans := range args[1:] {
+			result = IntersectSpans(result, spans)
+		}
+		return result, nil
+	case "subtract":
+		return SubtractSpans(args[0], UnionSpans(args[1:]...)), nil
+	case "dilate":
+		return DilateSpans(args[0], e.size)
+	case "erode":
+		return ErodeSpans(args[0], e.size), nil
+	default:
+		return nil, fmt.Errorf("unknown operation %q in ROI expression", e.op)
+	}
+}
+
+// Compute evaluates an expression over ROI instances at the given version and replaces
+// this ROI's spans with the result.  Expressions nest the operations union(a, b, ...),
+// intersect(a, b, ...), subtract(a, b, ...), dilate(a, n), and erode(a, n), where operands
+// are ROI names or nested operations and n is the structuring element size in blocks.
+// This ROI may appear in its own expression.
+func (d *Data) Compute(v dvid.VersionID, exprStr string) (dvid.Spans, error) {
+	expr, err := parseROIExpr(exprStr)
+	if err != nil {
+		return nil, err
+	}
+	spans, err := expr.eval(v, d.BlockSize)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.PutSpans(v, spans, true); err != nil {
+		return nil, err
+	}
+	return spans, nil
+}
@@ -0,0 +1,364 @@
+/*
+	This file supports creating ROIs from the blocks of labels and from closed surface meshes.
+*/
+
+package roi
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// MaxMeshBlocks is the maximum number of blocks that can be tested for a mesh, either as
+// (y, z) rows crossing its bounds or as blocks within the bounds of its triangles.
+const MaxMeshBlocks = 1 << 26
+
+// labelBlocksType is label data that can return the blocks of a label at a given scale,
+// e.g., labelmap instances via their label indices.
+type labelBlocksType interface {
+	GetLabelBlockIndices(v dvid.VersionID, label uint64, scale uint8, isSupervoxel bool) (dvid.IZYXSlice, error)
+	BlockSize() dvid.Point
+}
+
+// returns normalized spans covering the given blocks.
+func blocksToSpans(blocks dvid.IZYXSlice) (dvid.Spans, error) {
+	sorted := make(dvid.IZYXSlice, len(blocks))
+	copy(sorted, blocks)
+	sort.Sort(sorted)
+	spans := make(dvid.Spans, 0, len(sorted))
+	for _, izyx := range sorted {
+		bcoord, err := izyx.ToChunkPoint3d()
+		if err != nil {
+			return nil, err
+		}
+		n := len(spans)
+		if n != 0 && spans[n-1][0] == bcoord[2] && spans[n-1][1] == bcoord[1] && spans[n-1][3]+1 >= bcoord[0] {
+			if bcoord[0] > spans[n-1][3] {
+				spans[n-1][3] = bcoord[0]
+			}
+			continue
+		}
+		spans = append(spans, dvid.Span{bcoord[2], bcoord[1], bcoord[0], bcoord[0]})
+	}
+	return spans.Normalize(), nil
+}
+
+// FromLabels replaces this ROI with the blocks containing any of the given labels in the
+// named label instance at the given scale.  If supervoxels is true, the labels are
+// supervoxel ids.  The ROI block size must equal the label block size at that scale.
+func (d *Data) FromLabels(v dvid.VersionID, labelName dvid.InstanceName, lbls []uint64, scale uint8, supervoxels bool) (dvid.Spans, error) {
+	if scale > 31 {
+		return nil, fmt.Errorf("bad scale %d for ROI from labels", scale)
+	}
+	data, err := datastore.GetDataByVersionName(v, labelName)
+	if err != nil {
+		return nil, err
+	}
+	labelData, ok := data.(labelBlocksType)
+	if !ok {
+		return nil, fmt.Errorf("data instance %q does not support retrieval of label blocks", labelName)
+	}
+	labelBlockSize, ok := labelData.BlockSize().(dvid.Point3d)
+	if !ok {
+		return nil, fmt.Errorf("data instance %q does not have 3d blocks", labelName)
+	}
+	scaledSize := dvid.Point3d{labelBlockSize[0] << scale, labelBlockSize[1] << scale, labelBlockSize[2] << scale}
+	if !scaledSize.Equals(d.BlockSize) {
+		return nil, fmt.Errorf("ROI %q block size %s does not match %q block size %s at scale %d", d.DataName(), d.BlockSize, labelName, scaledSize, scale)
+	}
+
+	timedLog := dvid.NewTimeLog()
+	var blocks dvid.IZYXSlice
+	for _, label := range lbls {
+		if label == 0 {
+			return nil, fmt.Errorf("label 0 is background and cannot be used to create ROI %q", d.DataName())
+		}
+		labelBlocks, err := labelData.GetLabelBlockIndices(v, label, scale, supervoxels)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, labelBlocks...)
+	}
+	spans, err := blocksToSpans(blocks)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.PutSpans(v, spans, true); err != nil {
+		return nil, err
+	}
+	timedLog.Infof("Created ROI %q with %d spans from %d labels of %q", d.DataName(), len(spans), len(lbls), labelName)
+	return spans, nil
+}
+
+// Range of mesh vertex coordinates in blocks, which leaves room for the blocks around them
+// to be addressed with int32 block coordinates.
+const (
+	minMeshCoord = math.MinInt32 + 2
+	maxMeshCoord = math.MaxInt32 - 2
+)
+
+type vec3 [3]float64
+
+func (a vec3) sub(b vec3) vec3 {
+	return vec3{a[0] - b[0], a[1] - b[1], a[2] - b[2]}
+}
+
+func (a vec3) cross(b vec3) vec3 {
+	return vec3{a[1]*b[2] - a[2]*b[1], a[2]*b[0] - a[0]*b[2], a[0]*b[1] - a[1]*b[0]}
+}
+
+func (a vec3) dot(b vec3) float64 {
+	return a[0]*b[0] + a[1]*b[1] + a[2]*b[2]
+}
+
+type triangle [3]vec3
+
+func (tri triangle) bounds() (min, max vec3) {
+	min, max = tri[0], tri[0]
+	for _, v := range tri[1:] {
+		for i := 0; i < 3; i++ {
+			min[i] = math.Min(min[i], v[i])
+			max[i] = math.Max(max[i], v[i])
+		}
+	}
+	return
+}
+
+// readOBJ returns the triangles of a Wavefront OBJ mesh, where polygonal faces are split
+// into triangle fans and vertex coordinates are divided by the given scale.
+func readOBJ(r io.Reader, scale vec3) ([]triangle, error) {
+	var verts []vec3
+	var tris []triangle
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "v":
+			if len(fields) < 4 {
+				return nil, fmt.Errorf("vertex on OBJ line %d needs 3 coordinates", line)
+			}
+			var v vec3
+			for i := 0; i < 3; i++ {
+				coord, err := strconv.ParseFloat(fields[i+1], 64)
+				if err != nil {
+					return nil, fmt.Errorf("bad vertex coordinate on OBJ line %d: %v", line, err)
+				}
+				v[i] = coord / scale[i]
+				if math.IsNaN(v[i]) || v[i] < minMeshCoord || v[i] > maxMeshCoord {
+					return nil, fmt.Errorf("vertex coordinate %q on OBJ line %d is not finite or is outside the block range", fields[i+1], line)
+				}
+			}
+			verts = append(verts, v)
+		case "f":
+			if len(fields) < 4 {
+				return nil, fmt.Errorf("face on OBJ line %d needs at least 3 vertices", line)
+			}
+			face := make([]vec3, len(fields)-1)
+			for i, field := range fields[1:] {
+				ref := strings.SplitN(field, "/", 2)[0]
+				index, err := strconv.Atoi(ref)
+				if err != nil {
+					return nil, fmt.Errorf("bad face vertex %q on OBJ line %d", field, line)
+				}
+				if index < 0 {
+					index += len(verts) + 1
+				}
+				if index < 1 || index > len(verts) {
+					return nil, fmt.Errorf("face vertex %d on OBJ line %d is not a prior vertex", index, line)
+				}
+				face[i] = verts[index-1]
+			}
+			for i := 2; i < len(face); i++ {
+				tris = append(tris, triangle{face[0], face[i-1], face[i]})
+			}
+		default:
+			// Normals, texture coordinates, groups, and materials are not needed.
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return tris, nil
+}
+
+// returns true if the triangle is not separated from the box along the axis.  Triangles
+// only touching the box boundary are separated, so surfaces lying on block faces don't add
+// blocks outside the surface.
+func overlapOnAxis(axis vec3, v0, v1, v2, half vec3) bool {
+	p0, p1, p2 := axis.dot(v0), axis.dot(v1), axis.dot(v2)
+	r := half[0]*math.Abs(axis[0]) + half[1]*math.Abs(axis[1]) + half[2]*math.Abs(axis[2])
+	return math.Min(p0, math.Min(p1, p2)) < r && math.Max(p0, math.Max(p1, p2)) > -r
+}
+
+// triBoxOverlap returns true if the triangle intersects the interior of the axis-aligned box
+// using the separating axis theorem.
+func triBoxOverlap(center, half vec3, tri triangle) bool {
+	v0, v1, v2 := tri[0].sub(center), tri[1].sub(center), tri[2].sub(center)
+	for i := 0; i < 3; i++ {
+		if math.Min(v0[i], math.Min(v1[i], v2[i])) >= half[i] || math.Max(v0[i], math.Max(v1[i], v2[i])) <= -half[i] {
+			return false
+		}
+	}
+	edges := [3]vec3{v1.sub(v0), v2.sub(v1), v0.sub(v2)}
+	for _, edge := range edges {
+		for i := 0; i < 3; i++ {
+			var unit vec3
+			unit[i] = 1
+			axis := unit.cross(edge)
+			if axis != (vec3{}) && !overlapOnAxis(axis, v0, v1, v2, half) {
+				return false
+			}
+		}
+	}
+	normal := edges[0].cross(edges[1])
+	r := half[0]*math.Abs(normal[0]) + half[1]*math.Abs(normal[1]) + half[2]*math.Abs(normal[2])
+	return math.Abs(normal.dot(v0)) < r
+}
+
+// Offsets of rays from block centers so rays don't pass exactly through mesh vertices or edges.
+const (
+	rayOffsetY = 1.234567e-7
+	rayOffsetZ = 2.345678e-7
+)
+
+// returns the x coordinate where the ray parallel to x at (y, z) crosses the triangle.
+func rayCrossing(tri triangle, y, z float64) (float64, bool) {
+	a, b, c := tri[0], tri[1], tri[2]
+	det := (b[1]-a[1])*(c[2]-a[2]) - (c[1]-a[1])*(b[2]-a[2])
+	if det == 0 {
+		return 0, false
+	}
+	u := ((y-a[1])*(c[2]-a[2]) - (c[1]-a[1])*(z-a[2])) / det
+	w := ((b[1]-a[1])*(z-a[2]) - (y-a[1])*(b[2]-a[2])) / det
+	if u < 0 || w < 0 || u+w > 1 {
+		return 0, false
+	}
+	return a[0] + u*(b[0]-a[0]) + w*(c[0]-a[0]), true
+}
+
+// meshToSpans returns the spans of blocks that intersect the surface of a closed mesh or
+// have centers inside it.  Triangles are given in block coordinates.
+func meshToSpans(tris []triangle) (dvid.Spans, error) {
+	if len(tris) == 0 {
+		return dvid.Spans{}, nil
+	}
+	var spans dvid.Spans
+
+	// Add blocks crossing the surface.
+	half := vec3{0.5, 0.5, 0.5}
+	var numTested int64
+	for _, tri := range tris {
+		min, max := tri.bounds()
+		var beg, end [3]int32
+		numBlocks := int64(1)
+		for i := 0; i < 3; i++ {
+			beg[i], end[i] = int32(math.Floor(min[i])), int32(math.Floor(max[i]))
+			numBlocks *= int64(end[i]) - int64(beg[i]) + 1
+			if numBlocks > MaxMeshBlocks {
+				return nil, fmt.Errorf("mesh surface crosses more than %d blocks", MaxMeshBlocks)
+			}
+		}
+		numTested += numBlocks
+		if numTested > MaxMeshBlocks {
+			return nil, fmt.Errorf("mesh surface crosses more than %d blocks", MaxMeshBlocks)
+		}
+		for z := beg[2]; z <= end[2]; z++ {
+			for y := beg[1]; y <= end[1]; y++ {
+				for x := beg[0]; x <= end[0]; x++ {
+					center := vec3{float64(x) + 0.5, float64(y) + 0.5, float64(z) + 0.5}
+					if triBoxOverlap(center, half, tri) {
+						spans = append(spans, dvid.Span{z, y, x, x})
+					}
+				}
+			}
+		}
+	}
+
+	// Add blocks with centers inside the mesh by casting a ray along x through the block
+	// centers of each (y, z) row and pairing surface crossings.
+	rows := make(map[[2]int32][]int) // (z, y) row -> triangle indices
+	numTested = 0
+	for i, tri := range tris {
+		min, max := tri.bounds()
+		begY, endY := int32(math.Ceil(min[1]-0.5)), int32(math.Floor(max[1]-0.5))
+		begZ, endZ := int32(math.Ceil(min[2]-0.5)), int32(math.Floor(max[2]-0.5))
+		if begY > endY || begZ > endZ {
+			continue
+		}
+		numY, numZ := int64(endY)-int64(begY)+1, int64(endZ)-int64(begZ)+1
+		if numY > MaxMeshBlocks || numZ > MaxMeshBlocks {
+			return nil, fmt.Errorf("mesh spans more than %d block rows", MaxMeshBlocks)
+		}
+		numTested += numY * numZ
+		if numTested > MaxMeshBlocks {
+			return nil, fmt.Errorf("mesh spans more than %d block rows", MaxMeshBlocks)
+		}
+		for z := begZ; z <= endZ; z++ {
+			for y := begY; y <= endY; y++ {
+				key := [2]int32{z, y}
+				rows[key] = append(rows[key], i)
+			}
+		}
+	}
+	for key, triIndices := range rows {
+		z, y := key[0], key[1]
+		rayY, rayZ := float64(y)+0.5+rayOffsetY, float64(z)+0.5+rayOffsetZ
+		var crossings []float64
+		for _, i := range triIndices {
+			if x, crossed := rayCrossing(tris[i], rayY, rayZ); crossed {
+				crossings = append(crossings, x)
+			}
+		}
+		sort.Float64s(crossings)
+		for i := 1; i < len(crossings); i += 2 {
+			x0, x1 := int32(math.Ceil(crossings[i-1]-0.5)), int32(math.Floor(crossings[i]-0.5))
+			if x0 <= x1 {
+				spans = append(spans, dvid.Span{z, y, x0, x1})
+			}
+		}
+	}
+	return spans.Normalize(), nil
+}
+
+// FromMesh replaces this ROI with the blocks covered by a closed surface mesh in Wavefront
+// OBJ format.  Vertex coordinates are divided by the given voxel size to get voxel
+// coordinates.  A block is included if the surface crosses it or its center is inside
+// the surface.
+func (d *Data) FromMesh(v dvid.VersionID, r io.Reader, voxelSize dvid.NdFloat32) (dvid.Spans, error) {
+	if len(voxelSize) != 3 {
+		return nil, fmt.Errorf("voxel size for mesh must be 3d, got %v", voxelSize)
+	}
+	var scale vec3
+	for i := 0; i < 3; i++ {
+		if !(voxelSize[i] > 0) {
+			return nil, fmt.Errorf("voxel size for mesh must be positive, got %v", voxelSize)
+		}
+		scale[i] = float64(voxelSize[i]) * float64(d.BlockSize[i])
+	}
+	timedLog := dvid.NewTimeLog()
+	tris, err := readOBJ(r, scale)
+	if err != nil {
+		return nil, err
+	}
+	spans, err := meshToSpans(tris)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.PutSpans(v, spans, true); err != nil {
+		return nil, err
+	}
+	timedLog.Infof("Created ROI %q with %d spans from mesh with %d triangles", d.DataName(), len(spans), len(tris))
+	return spans, nil
+}
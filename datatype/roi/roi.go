@@ -133,6 +133,52 @@ GET <api URL>/node/<UUID>/<data name>/mask/0_1_2/<size>/<offset>
 	has size 512 x 512 x 256 voxels and an offset of (100, 200, 300).
 
 
+GET <api URL>/node/<UUID>/<data name>/stats[?<options>]
+
+	Returns JSON with the number of blocks and voxels in the ROI, the volume in physical
+	units, and the bounding box and centroid of the ROI in voxel coordinates:
+
+	{
+		"NumBlocks": 6,
+		"NumVoxels": 196608,
+		"Volume": 100663296,
+		"VoxelSize": [8, 8, 8],
+		"VoxelUnits": "nanometers",
+		"MinBlock": [1, 1, 1],
+		"MaxBlock": [3, 2, 1],
+		"MinPoint": [32, 32, 32],
+		"MaxPoint": [127, 95, 63],
+		"Centroid": [79.5, 63.5, 47.5]
+	}
+
+	The bounds and centroid are omitted for an empty ROI.
+
+	The voxel size and units default to the resolution of the instance named by the
+	"resolution" option or, if not given, of the first synced instance with a resolution.
+	Without either, the voxel size is "1_1_1" in "voxels".
+
+	Query-string Options:
+
+	resolution    Name of a data instance, e.g., a labelmap, whose resolution is used.
+	voxelsize     Size of a voxel in physical units, e.g., "8_8_8".
+	units         Name of the physical units, e.g., "nanometers".
+
+GET <api URL>/node/<UUID>/<data name>/overlap/<label data name>?labels=<label list>[&<options>]
+
+	Returns JSON with the number of voxels of each label within the ROI using the label
+	indices of the given labelmap instance.  The labels are given as a comma-separated list,
+	e.g., "labels=23,1045,8".  If the ROI block size is not a multiple of the label block
+	size, e.g., 32 voxel ROI blocks and 64 voxel label blocks, the voxels of label blocks
+	straddling the ROI boundary are counted from the label block data, which is slower.
+
+	[{"Label": 23, "Voxels": 83021}, {"Label": 1045, "Voxels": 0}, {"Label": 8, "Voxels": 1227}]
+
+	Query-string Options:
+
+	scale         If given, returns the number of label blocks at this scale within the ROI
+	                as "Blocks" instead of "Voxels".  The ROI block size must be a multiple
+	                of the label block size at that scale.
+
 POST <api URL>/node/<UUID>/<data name>/ptquery
 
 	Determines whether a list of 3d points (voxel coordinates) in JSON format sent by POST is within 
@@ -159,17 +205,57 @@ GET <api URL>/node/<UUID>/<data name>/partition?batchsize=8
     optimized   If "true" or "on", partioning returns non-fixed sized subvolumes where the coverage
                   is better in terms of subvolumes having more active blocks.
 
-TODO (API endpoints that are planned in near future)
+POST <api URL>/node/<UUID>/<data name>/compute
 
-GET  <api URL>/node/<UUID>/<data name>/erode/<element size>
+	Replaces this ROI with the result of an expression over ROI instances at the same version.
+	The POSTed body is the expression as plain text, where operands are ROI names and
+	operations can be nested:
 
-    Returns a ROI that has been eroded with a cubic structuring element of the given size.
+	union(a, b, ...)       Blocks in any of the arguments.
+	intersect(a, b, ...)   Blocks in all of the arguments.
+	subtract(a, b, ...)    Blocks in the first argument but not in any other.
+	dilate(a, n)           Dilation by a cubic structuring element extending n blocks.
+	erode(a, n)            Erosion by a cubic structuring element extending n blocks.
 
-    Example: 
+	All ROIs in the expression must have the same block size as this ROI, which may itself
+	appear in the expression.  The size n can be at most %d blocks, operations can be nested
+	at most %d deep, and each dilation pass can produce at most %d spans.  Returns JSON with
+	the number of spans and blocks in the new ROI:
 
-    GET <api URL>/node/3f8c/medulla/erode/1
+	{ "NumSpans": 1234, "NumBlocks": 5678 }
+
+	Example:
 
-    This returns JSON for an ROI that has been eroded by 1 block.
+	POST <api URL>/node/3f8c/medulla-core/compute
+
+	subtract(medulla, dilate(layer10, 2))
+
+	This sets "medulla-core" to all medulla blocks at least 3 blocks from layer10.
+
+POST <api URL>/node/<UUID>/<data name>/from-labels/<label data name>[?<options>]
+
+	Replaces this ROI with all blocks containing any of the labels in the POSTed JSON array,
+	e.g., [23, 1045, 8], using the label indices of the given labelmap instance.  The ROI block
+	size must equal the label block size at the chosen scale, e.g., a 64x64x64 ROI block size
+	for scale 1 of a labelmap with 32x32x32 blocks.  Returns the same JSON as /compute.
+
+	Query-string Options:
+
+	scale         Scale of the label blocks where each level has 1/2 resolution (default 0).
+	supervoxels   If "true", the POSTed labels are supervoxel ids.
+
+POST <api URL>/node/<UUID>/<data name>/from-mesh[?<options>]
+
+	Replaces this ROI with the blocks covered by the closed surface mesh in the POSTed
+	Wavefront OBJ data.  Only vertex ("v") and face ("f") lines are used, and polygonal faces
+	are split into triangles.  A block is included if the surface crosses it or its center
+	is inside the surface.  Returns the same JSON as /compute.
+
+	Query-string Options:
+
+	voxelsize     Size of a voxel in mesh units, e.g., "8_8_8" for a mesh in nanometers at
+	                8 nm resolution.  Vertex coordinates are divided by this size to get
+	                voxel coordinates (default "1_1_1").
 
 `
 
@@ -233,7 +319,7 @@ func (dtype *Type) NewDataService(uuid dvid.UUID, id dvid.InstanceID, name dvid.
 }
 
 func (dtype *Type) Help() string {
-	return fmt.Sprintf(HelpMessage, DefaultBlockSize)
+	return fmt.Sprintf(HelpMessage, DefaultBlockSize, MaxMorphologySize, MaxExprDepth, MaxDilationSpans)
 }
 
 // Properties are additional properties for keyvalue data instances beyond those
@@ -1298,7 +1384,7 @@ func (d *Data) SimplePartition(ctx storage.Context, batchsize int32) ([]byte, er
 // --- DataService interface ---
 
 func (d *Data) Help() string {
-	return fmt.Sprintf(HelpMessage, DefaultBlockSize)
+	return fmt.Sprintf(HelpMessage, DefaultBlockSize, MaxMorphologySize, MaxExprDepth, MaxDilationSpans)
 }
 
 // DoRPC acts as a switchboard for RPC commands.
@@ -1307,6 +1393,20 @@ func (d *Data) DoRPC(request datastore.Request, reply *datastore.Response) error
 		d.DataName(), d.TypeName(), request.TypeCommand())
 }
 
+// writes JSON with the number of spans and blocks in an ROI.
+func writeSpanCounts(w http.ResponseWriter, spans dvid.Spans) error {
+	jsonBytes, err := json.Marshal(struct {
+		NumSpans  int
+		NumBlocks uint64
+	}{len(spans), spans.Count()})
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(jsonBytes)
+	return err
+}
+
 // ServeHTTP handles all incoming HTTP requests for this data.
 func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.ResponseWriter, r *http.Request) (activity map[string]interface{}) {
 	timedLog := dvid.NewTimeLog()
@@ -1378,6 +1478,165 @@ func (d *Data) ServeHTTP(uuid dvid.UUID, ctx *datastore.VersionedCtx, w http.Res
 			}
 			comment = fmt.Sprintf("HTTP DELETE ROI %q", d.DataName())
 		}
+	case "compute":
+		if method != "post" {
+			server.BadRequest(w, r, "compute only supports POST request")
+			return
+		}
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		spans, err := d.Compute(ctx.VersionID(), string(data))
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if err := writeSpanCounts(w, spans); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		comment = fmt.Sprintf("HTTP POST compute ROI %q from %q: %d spans", d.DataName(), string(data), len(spans))
+	case "from-labels":
+		if method != "post" {
+			server.BadRequest(w, r, "from-labels only supports POST request")
+			return
+		}
+		if len(parts) < 5 {
+			server.BadRequest(w, r, "from-labels must be followed by label instance name")
+			return
+		}
+		labelName := dvid.InstanceName(parts[4])
+		queryStrings := r.URL.Query()
+		var scale uint64
+		if scaleStr := queryStrings.Get("scale"); scaleStr != "" {
+			var err error
+			if scale, err = strconv.ParseUint(scaleStr, 10, 8); err != nil {
+				server.BadRequest(w, r, "bad scale specified: %v", err)
+				return
+			}
+		}
+		supervoxels := queryStrings.Get("supervoxels") == "true"
+		var lbls []uint64
+		if err := json.NewDecoder(r.Body).Decode(&lbls); err != nil {
+			server.BadRequest(w, r, "expected JSON array of labels in POST body: %v", err)
+			return
+		}
+		spans, err := d.FromLabels(ctx.VersionID(), labelName, lbls, uint8(scale), supervoxels)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if err := writeSpanCounts(w, spans); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		comment = fmt.Sprintf("HTTP POST ROI %q from %d labels of %q: %d spans", d.DataName(), len(lbls), labelName, len(spans))
+	case "from-mesh":
+		if method != "post" {
+			server.BadRequest(w, r, "from-mesh only supports POST request")
+			return
+		}
+		voxelSize := dvid.NdFloat32{1, 1, 1}
+		if voxelSizeStr := r.URL.Query().Get("voxelsize"); voxelSizeStr != "" {
+			var err error
+			if voxelSize, err = dvid.StringToNdFloat32(voxelSizeStr, "_"); err != nil {
+				server.BadRequest(w, r, "bad voxelsize specified: %v", err)
+				return
+			}
+		}
+		spans, err := d.FromMesh(ctx.VersionID(), r.Body, voxelSize)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if err := writeSpanCounts(w, spans); err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		comment = fmt.Sprintf("HTTP POST ROI %q from mesh: %d spans", d.DataName(), len(spans))
+	case "stats":
+		if method != "get" {
+			server.BadRequest(w, r, "stats only supports GET request")
+			return
+		}
+		queryStrings := r.URL.Query()
+		resName := dvid.InstanceName(queryStrings.Get("resolution"))
+		voxelSize, units, err := d.defaultResolution(ctx.VersionID(), resName)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		if voxelSizeStr := queryStrings.Get("voxelsize"); voxelSizeStr != "" {
+			if voxelSize, err = dvid.StringToNdFloat32(voxelSizeStr, "_"); err != nil {
+				server.BadRequest(w, r, "bad voxelsize specified: %v", err)
+				return
+			}
+		}
+		if unitsStr := queryStrings.Get("units"); unitsStr != "" {
+			units = unitsStr
+		}
+		stats, err := d.GetStats(ctx.VersionID(), voxelSize, units)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		jsonBytes, err := json.Marshal(stats)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, string(jsonBytes))
+		comment = fmt.Sprintf("HTTP GET stats for ROI %q: %d blocks", d.DataName(), stats.NumBlocks)
+	case "overlap":
+		if method != "get" {
+			server.BadRequest(w, r, "overlap only supports GET request")
+			return
+		}
+		if len(parts) < 5 {
+			server.BadRequest(w, r, "overlap must be followed by label instance name")
+			return
+		}
+		labelName := dvid.InstanceName(parts[4])
+		queryStrings := r.URL.Query()
+		labelsStr := queryStrings.Get("labels")
+		if labelsStr == "" {
+			server.BadRequest(w, r, "overlap requires 'labels' query string with comma-separated labels")
+			return
+		}
+		var lbls []uint64
+		for _, labelStr := range strings.Split(labelsStr, ",") {
+			label, err := strconv.ParseUint(strings.TrimSpace(labelStr), 10, 64)
+			if err != nil {
+				server.BadRequest(w, r, "bad label %q in 'labels' query string: %v", labelStr, err)
+				return
+			}
+			lbls = append(lbls, label)
+		}
+		scale := -1
+		if scaleStr := queryStrings.Get("scale"); scaleStr != "" {
+			scale64, err := strconv.ParseUint(scaleStr, 10, 8)
+			if err != nil {
+				server.BadRequest(w, r, "bad scale specified: %v", err)
+				return
+			}
+			scale = int(scale64)
+		}
+		overlaps, err := d.GetLabelOverlap(ctx.VersionID(), labelName, lbls, scale)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		jsonBytes, err := json.Marshal(overlaps)
+		if err != nil {
+			server.BadRequest(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, string(jsonBytes))
+		comment = fmt.Sprintf("HTTP GET overlap of %d labels of %q with ROI %q", len(lbls), labelName, d.DataName())
 	case "mask":
 		if method != "get" {
 			server.BadRequest(w, r, "ROI mask only supports GET")
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math/rand"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
@@ -972,3 +973,311 @@ func TestROIRepoPersistence(t *testing.T) {
 		t.Errorf("Expected %v, got %v\n", oldData, *roi2new)
 	}
 }
+
+// returns the set of blocks covered by spans.
+func spanBlocks(spans dvid.Spans) map[dvid.ChunkPoint3d]struct{} {
+	blocks := make(map[dvid.ChunkPoint3d]struct{})
+	for _, span := range spans {
+		for x := span[2]; x <= span[3]; x++ {
+			blocks[dvid.ChunkPoint3d{x, span[1], span[0]}] = struct{}{}
+		}
+	}
+	return blocks
+}
+
+// returns the blocks whose cubic neighborhood of size n intersects (dilate) or is within
+// (erode) the given blocks, checking every block in the given bounds.
+func morphBlocks(blocks map[dvid.ChunkPoint3d]struct{}, n int32, dilate bool, min, max int32) map[dvid.ChunkPoint3d]struct{} {
+	result := make(map[dvid.ChunkPoint3d]struct{})
+	for z := min; z <= max; z++ {
+		for y := min; y <= max; y++ {
+			for x := min; x <= max; x++ {
+				var numIn, numTotal int
+				for dz := -n; dz <= n; dz++ {
+					for dy := -n; dy <= n; dy++ {
+						for dx := -n; dx <= n; dx++ {
+							numTotal++
+							if _, found := blocks[dvid.ChunkPoint3d{x + dx, y + dy, z + dz}]; found {
+								numIn++
+							}
+						}
+					}
+				}
+				if (dilate && numIn > 0) || (!dilate && numIn == numTotal) {
+					result[dvid.ChunkPoint3d{x, y, z}] = struct{}{}
+				}
+			}
+		}
+	}
+	return result
+}
+
+func checkSpanBlocks(t *testing.T, op string, spans dvid.Spans, expected map[dvid.ChunkPoint3d]struct{}) {
+	if !reflect.DeepEqual(spans, spans.Normalize()) {
+		t.Fatalf("%s returned spans that are not normalized: %v\n", op, spans)
+	}
+	got := spanBlocks(spans)
+	if len(got) != len(expected) {
+		t.Fatalf("%s returned %d blocks, expected %d\n", op, len(got), len(expected))
+	}
+	for block := range expected {
+		if _, found := got[block]; !found {
+			t.Fatalf("%s did not return expected block %s\n", op, block)
+		}
+	}
+}
+
+func TestSpanOps(t *testing.T) {
+	rand.Seed(17)
+	randomSpans := func() dvid.Spans {
+		var spans dvid.Spans
+		for i := 0; i < 60; i++ {
+			x0 := rand.Int31n(12)
+			spans = append(spans, dvid.Span{rand.Int31n(6), rand.Int31n(6), x0, x0 + rand.Int31n(6)})
+		}
+		return spans
+	}
+	for trial := 0; trial < 10; trial++ {
+		a, b := randomSpans(), randomSpans()
+		aBlocks, bBlocks := spanBlocks(a), spanBlocks(b)
+
+		union := make(map[dvid.ChunkPoint3d]struct{})
+		intersect := make(map[dvid.ChunkPoint3d]struct{})
+		subtract := make(map[dvid.ChunkPoint3d]struct{})
+		for block := range aBlocks {
+			union[block] = struct{}{}
+			if _, found := bBlocks[block]; found {
+				intersect[block] = struct{}{}
+			} else {
+				subtract[block] = struct{}{}
+			}
+		}
+		for block := range bBlocks {
+			union[block] = struct{}{}
+		}
+		checkSpanBlocks(t, "union", UnionSpans(a, b), union)
+		checkSpanBlocks(t, "intersect", IntersectSpans(a, b), intersect)
+		checkSpanBlocks(t, "subtract", SubtractSpans(a, b), subtract)
+		for n := int32(0); n <= 2; n++ {
+			dilated, err := DilateSpans(a, n)
+			if err != nil {
+				t.Fatalf("error dilating by %d: %v\n", n, err)
+			}
+			checkSpanBlocks(t, "dilate", dilated, morphBlocks(aBlocks, n, true, -3, 20))
+			checkSpanBlocks(t, "erode", ErodeSpans(a, n), morphBlocks(aBlocks, n, false, -3, 20))
+		}
+	}
+
+	// Dilations producing too many spans are rejected.
+	many := make(dvid.Spans, MaxDilationSpans/(2*MaxMorphologySize+1)+1)
+	for i := range many {
+		many[i] = dvid.Span{int32(i), 0, 0, 0}
+	}
+	if _, err := DilateSpans(many, MaxMorphologySize); err == nil {
+		t.Errorf("expected error dilating %d spans by %d\n", len(many), MaxMorphologySize)
+	}
+}
+
+func TestROICompute(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "roi", "medulla", dvid.Config{})
+	server.CreateTestInstance(t, uuid, "roi", "layer", dvid.Config{})
+	server.CreateTestInstance(t, uuid, "roi", "result", dvid.Config{})
+	var config dvid.Config
+	config.Set("BlockSize", "64,64,64")
+	server.CreateTestInstance(t, uuid, "roi", "bigblocks", config)
+
+	medulla := []dvid.Span{{10, 10, 0, 9}, {10, 11, 0, 9}, {10, 12, 0, 9}, {11, 10, 0, 9}, {11, 11, 0, 9}, {11, 12, 0, 9}, {12, 10, 0, 9}, {12, 11, 0, 9}, {12, 12, 0, 9}}
+	layer := []dvid.Span{{11, 11, 4, 5}, {20, 20, 0, 1}}
+	server.TestHTTP(t, "POST", fmt.Sprintf("%snode/%s/medulla/roi", server.WebAPIPath, uuid), getSpansJSON(medulla))
+	server.TestHTTP(t, "POST", fmt.Sprintf("%snode/%s/layer/roi", server.WebAPIPath, uuid), getSpansJSON(layer))
+
+	computeURL := fmt.Sprintf("%snode/%s/result/compute", server.WebAPIPath, uuid)
+	roiURL := fmt.Sprintf("%snode/%s/result/roi", server.WebAPIPath, uuid)
+	testCompute := func(expr string, expected []dvid.Span) {
+		server.TestHTTP(t, "POST", computeURL, bytes.NewBufferString(expr))
+		spans, err := putSpansJSON(server.TestHTTP(t, "GET", roiURL, nil))
+		if err != nil {
+			t.Fatalf("Error on getting back JSON from roi GET: %v\n", err)
+		}
+		if len(spans) == 0 && len(expected) == 0 {
+			return
+		}
+		if !reflect.DeepEqual(spans, expected) {
+			t.Fatalf("Bad compute of %q\nExpected:\n%v\nReturned:\n%v\n", expr, expected, spans)
+		}
+	}
+	testCompute("union(medulla, layer)", append(medulla[:4:4], dvid.Span{11, 11, 0, 9}, dvid.Span{11, 12, 0, 9}, dvid.Span{12, 10, 0, 9}, dvid.Span{12, 11, 0, 9}, dvid.Span{12, 12, 0, 9}, dvid.Span{20, 20, 0, 1}))
+	testCompute("intersect(medulla, layer)", []dvid.Span{{11, 11, 4, 5}})
+	testCompute("subtract(medulla, layer)", []dvid.Span{{10, 10, 0, 9}, {10, 11, 0, 9}, {10, 12, 0, 9}, {11, 10, 0, 9}, {11, 11, 0, 3}, {11, 11, 6, 9}, {11, 12, 0, 9}, {12, 10, 0, 9}, {12, 11, 0, 9}, {12, 12, 0, 9}})
+	testCompute("erode(medulla, 1)", []dvid.Span{{11, 11, 1, 8}})
+	testCompute("subtract(erode(medulla, 1), dilate(layer, 1))", []dvid.Span{{11, 11, 1, 2}, {11, 11, 7, 8}})
+	testCompute("dilate(intersect(medulla, layer), 1)", []dvid.Span{
+		{10, 10, 3, 6}, {10, 11, 3, 6}, {10, 12, 3, 6},
+		{11, 10, 3, 6}, {11, 11, 3, 6}, {11, 12, 3, 6},
+		{12, 10, 3, 6}, {12, 11, 3, 6}, {12, 12, 3, 6},
+	})
+
+	// The computed ROI can be used in its own expression.
+	testCompute("erode(result, 1)", []dvid.Span{{11, 11, 4, 5}})
+	testCompute("subtract(result, layer)", nil)
+
+	server.TestBadHTTP(t, "GET", computeURL, nil)
+	server.TestBadHTTP(t, "POST", computeURL, bytes.NewBufferString("union(medulla)"))
+	server.TestBadHTTP(t, "POST", computeURL, bytes.NewBufferString("union(medulla, layer"))
+	server.TestBadHTTP(t, "POST", computeURL, bytes.NewBufferString("xor(medulla, layer)"))
+	server.TestBadHTTP(t, "POST", computeURL, bytes.NewBufferString("dilate(medulla, -1)"))
+	server.TestBadHTTP(t, "POST", computeURL, bytes.NewBufferString("dilate(medulla, 1000)"))
+	server.TestBadHTTP(t, "POST", computeURL, bytes.NewBufferString(fmt.Sprintf("dilate(medulla, %d)", MaxMorphologySize+1)))
+	nested := "medulla"
+	for i := 0; i < MaxExprDepth; i++ {
+		nested = "erode(" + nested + ", 0)"
+	}
+	server.TestHTTP(t, "POST", computeURL, bytes.NewBufferString(nested))
+	server.TestBadHTTP(t, "POST", computeURL, bytes.NewBufferString("erode("+nested+", 0)"))
+	server.TestBadHTTP(t, "POST", computeURL, bytes.NewBufferString("union(medulla, missing)"))
+	server.TestBadHTTP(t, "POST", computeURL, bytes.NewBufferString("union(medulla, bigblocks)"))
+	server.TestBadHTTP(t, "POST", computeURL, bytes.NewBufferString("medulla layer"))
+}
+
+// returns OBJ data for a box with the given corners.
+func boxOBJ(min, max [3]float64) string {
+	var obj string
+	for i := 0; i < 8; i++ {
+		pt := min
+		for axis := 0; axis < 3; axis++ {
+			if i&(1<<uint(axis)) != 0 {
+				pt[axis] = max[axis]
+			}
+		}
+		obj += fmt.Sprintf("v %g %g %g\n", pt[0], pt[1], pt[2])
+	}
+	obj += "vn 0 0 1\n"
+	obj += "f 1 3 4 2\nf 5 6 8 7\nf 1 2 6 5\nf 3 7 8 4\nf 1 5 7 3\nf 2 4 8 6\n"
+	return obj
+}
+
+func TestROIFromMesh(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "roi", "meshroi", dvid.Config{})
+	meshURL := fmt.Sprintf("%snode/%s/meshroi/from-mesh", server.WebAPIPath, uuid)
+	roiURL := fmt.Sprintf("%snode/%s/meshroi/roi", server.WebAPIPath, uuid)
+	testMesh := func(url, obj string, expected []dvid.Span, numBlocks uint64) {
+		respData := server.TestHTTP(t, "POST", url, bytes.NewBufferString(obj))
+		var resp struct {
+			NumSpans  int
+			NumBlocks uint64
+		}
+		if err := json.Unmarshal(respData, &resp); err != nil {
+			t.Fatalf("Bad response from mesh POST: %s\n", string(respData))
+		}
+		if resp.NumSpans != len(expected) || resp.NumBlocks != numBlocks {
+			t.Fatalf("Expected %d spans and %d blocks from mesh, got %s\n", len(expected), numBlocks, string(respData))
+		}
+		spans, err := putSpansJSON(server.TestHTTP(t, "GET", roiURL, nil))
+		if err != nil {
+			t.Fatalf("Error on getting back JSON from roi GET: %v\n", err)
+		}
+		if !reflect.DeepEqual(spans, expected) {
+			t.Fatalf("Bad ROI from mesh\nExpected:\n%v\nReturned:\n%v\n", expected, spans)
+		}
+	}
+
+	// Box faces on block boundaries only cover the blocks inside.
+	box := boxOBJ([3]float64{32, 32, 32}, [3]float64{128, 96, 64})
+	expected := []dvid.Span{{1, 1, 1, 3}, {1, 2, 1, 3}}
+	testMesh(meshURL, box, expected, 6)
+
+	// Coordinates are scaled by voxel size.
+	box = boxOBJ([3]float64{256, 256, 256}, [3]float64{1024, 768, 512})
+	testMesh(meshURL+"?voxelsize=8_8_8", box, expected, 6)
+
+	// Surfaces within a block or crossing blocks add those blocks.
+	testMesh(meshURL, boxOBJ([3]float64{5, 5, 5}, [3]float64{10, 10, 10}), []dvid.Span{{0, 0, 0, 0}}, 1)
+	testMesh(meshURL, boxOBJ([3]float64{20, 40, 70}, [3]float64{100, 50, 80}), []dvid.Span{{2, 1, 0, 3}}, 4)
+
+	// A larger box has interior blocks without surface crossings.
+	testMesh(meshURL, boxOBJ([3]float64{-10, -10, -10}, [3]float64{100, 100, 100}), []dvid.Span{
+		{-1, -1, -1, 3}, {-1, 0, -1, 3}, {-1, 1, -1, 3}, {-1, 2, -1, 3}, {-1, 3, -1, 3},
+		{0, -1, -1, 3}, {0, 0, -1, 3}, {0, 1, -1, 3}, {0, 2, -1, 3}, {0, 3, -1, 3},
+		{1, -1, -1, 3}, {1, 0, -1, 3}, {1, 1, -1, 3}, {1, 2, -1, 3}, {1, 3, -1, 3},
+		{2, -1, -1, 3}, {2, 0, -1, 3}, {2, 1, -1, 3}, {2, 2, -1, 3}, {2, 3, -1, 3},
+		{3, -1, -1, 3}, {3, 0, -1, 3}, {3, 1, -1, 3}, {3, 2, -1, 3}, {3, 3, -1, 3},
+	}, 125)
+
+	server.TestBadHTTP(t, "GET", meshURL, nil)
+	server.TestBadHTTP(t, "POST", meshURL+"?voxelsize=8_8", bytes.NewBufferString(box))
+	server.TestBadHTTP(t, "POST", meshURL+"?voxelsize=0_8_8", bytes.NewBufferString(box))
+	server.TestBadHTTP(t, "POST", meshURL, bytes.NewBufferString("v 1 2\n"))
+	server.TestBadHTTP(t, "POST", meshURL, bytes.NewBufferString("v 1 2 3\nv 4 5 6\nv 7 8 9\nf 1 2 4\n"))
+	server.TestBadHTTP(t, "POST", meshURL, bytes.NewBufferString("v 1 2 3\nf 1 a 1\n"))
+
+	// non-finite or out of range coordinates and huge triangles are rejected quickly.
+	for _, coord := range []string{"NaN", "Inf", "-Inf", "-3e12", "1e300"} {
+		obj := fmt.Sprintf("v %s 0 0\nv 0 1 0\nv 0 0 1\nf 1 2 3\n", coord)
+		server.TestBadHTTP(t, "POST", meshURL, bytes.NewBufferString(obj))
+	}
+	for _, obj := range []string{
+		"v -2e9 0 0\nv 2e9 0 0\nv 0 1 0\nf 1 2 3\n",
+		"v 0 -2e9 0\nv 0 2e9 0\nv 0 0 2e9\nf 1 2 3\n",
+	} {
+		tris, err := readOBJ(bytes.NewBufferString(obj), vec3{1, 1, 1})
+		if err != nil {
+			t.Fatalf("unable to read huge triangle: %v\n", err)
+		}
+		if _, err := meshToSpans(tris); err == nil {
+			t.Fatalf("expected error for huge triangle %q\n", obj)
+		}
+	}
+}
+
+func TestROIStats(t *testing.T) {
+	if err := server.OpenTest(); err != nil {
+		t.Fatalf("can't open test server: %v\n", err)
+	}
+	defer server.CloseTest()
+
+	uuid, _ := initTestRepo()
+	server.CreateTestInstance(t, uuid, "roi", "statsroi", dvid.Config{})
+	statsURL := fmt.Sprintf("%snode/%s/statsroi/stats", server.WebAPIPath, uuid)
+
+	var stats Stats
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", statsURL, nil), &stats); err != nil {
+		t.Fatalf("Bad stats response: %v\n", err)
+	}
+	if stats.NumBlocks != 0 || stats.Volume != 0 || stats.VoxelUnits != "voxels" || stats.MinPoint != nil || stats.Centroid != nil {
+		t.Fatalf("Bad stats for empty ROI: %v\n", stats)
+	}
+
+	// Overlapping spans should only be counted once.
+	spans := []dvid.Span{{1, 1, 1, 3}, {1, 2, 1, 2}, {1, 2, 2, 3}}
+	server.TestHTTP(t, "POST", fmt.Sprintf("%snode/%s/statsroi/roi", server.WebAPIPath, uuid), getSpansJSON(spans))
+	if err := json.Unmarshal(server.TestHTTP(t, "GET", statsURL+"?voxelsize=8_8_8&units=nanometers", nil), &stats); err != nil {
+		t.Fatalf("Bad stats response: %v\n", err)
+	}
+	if stats.NumBlocks != 6 || stats.NumVoxels != 6*32*32*32 || stats.Volume != 6*32*32*32*512 || stats.VoxelUnits != "nanometers" {
+		t.Fatalf("Bad stats for ROI: %v\n", stats)
+	}
+	if *stats.MinBlock != (dvid.ChunkPoint3d{1, 1, 1}) || *stats.MaxBlock != (dvid.ChunkPoint3d{3, 2, 1}) {
+		t.Fatalf("Bad block bounds for ROI: %s -> %s\n", *stats.MinBlock, *stats.MaxBlock)
+	}
+	if *stats.MinPoint != (dvid.Point3d{32, 32, 32}) || *stats.MaxPoint != (dvid.Point3d{127, 95, 63}) {
+		t.Fatalf("Bad voxel bounds for ROI: %s -> %s\n", *stats.MinPoint, *stats.MaxPoint)
+	}
+	if *stats.Centroid != [3]float64{79.5, 63.5, 47.5} {
+		t.Fatalf("Bad centroid for ROI: %v\n", *stats.Centroid)
+	}
+
+	server.TestBadHTTP(t, "POST", statsURL, nil)
+	server.TestBadHTTP(t, "GET", statsURL+"?voxelsize=8_8", nil)
+}
@@ -0,0 +1,351 @@
+/*
+	This file supports ROI statistics and the overlap of labels with an ROI.
+*/
+
+package roi
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/janelia-flyem/dvid/datastore"
+	"github.com/janelia-flyem/dvid/dvid"
+)
+
+// Stats gives the size and extent of an ROI.  Points and the centroid are in voxel
+// coordinates, and bounds are empty if the ROI has no blocks.
+type Stats struct {
+	NumBlocks  uint64
+	NumVoxels  uint64
+	Volume     float64 // NumVoxels times the volume of a voxel
+	VoxelSize  dvid.NdFloat32
+	VoxelUnits string
+
+	MinBlock *dvid.ChunkPoint3d `json:",omitempty"`
+	MaxBlock *dvid.ChunkPoint3d `json:",omitempty"`
+	MinPoint *dvid.Point3d      `json:",omitempty"` // inclusive voxel bounds
+	MaxPoint *dvid.Point3d      `json:",omitempty"`
+	Centroid *[3]float64        `json:",omitempty"` // mean voxel position of all blocks
+}
+
+// GetStats returns the block count, volume, bounds, and centroid of the ROI where the
+// volume uses the given voxel size and units.
+func (d *Data) GetStats(v dvid.VersionID, voxelSize dvid.NdFloat32, voxelUnits string) (*Stats, error) {
+	if len(voxelSize) != 3 {
+		return nil, fmt.Errorf("voxel size for ROI stats must be 3d, got %v", voxelSize)
+	}
+	d.RLock()
+	spans, err := d.GetSpans(v)
+	d.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	spans = dvid.Spans(spans).Normalize()
+	stats := &Stats{VoxelSize: voxelSize, VoxelUnits: voxelUnits}
+	var minBlock, maxBlock dvid.ChunkPoint3d
+	var sum [3]float64
+	for i, span := range spans {
+		z, y, x0, x1 := span.Unpack()
+		if i == 0 {
+			minBlock = dvid.ChunkPoint3d{x0, y, z}
+			maxBlock = minBlock
+		}
+		for axis, coord := range [3]int32{x0, y, z} {
+			if coord < minBlock[axis] {
+				minBlock[axis] = coord
+			}
+		}
+		for axis, coord := range [3]int32{x1, y, z} {
+			if coord > maxBlock[axis] {
+				maxBlock[axis] = coord
+			}
+		}
+		n := float64(x1 - x0 + 1)
+		sum[0] += n * (float64(x0) + float64(x1)) / 2
+		sum[1] += n * float64(y)
+		sum[2] += n * float64(z)
+		stats.NumBlocks += uint64(x1 - x0 + 1)
+	}
+	stats.NumVoxels = stats.NumBlocks * uint64(d.BlockSize.Prod())
+	stats.Volume = float64(stats.NumVoxels) * float64(voxelSize[0]) * float64(voxelSize[1]) * float64(voxelSize[2])
+	if stats.NumBlocks == 0 {
+		return stats, nil
+	}
+
+	bs := d.BlockSize
+	minPoint := dvid.Point3d{minBlock[0] * bs[0], minBlock[1] * bs[1], minBlock[2] * bs[2]}
+	maxPoint := dvid.Point3d{(maxBlock[0]+1)*bs[0] - 1, (maxBlock[1]+1)*bs[1] - 1, (maxBlock[2]+1)*bs[2] - 1}
+	var centroid [3]float64
+	for axis := 0; axis < 3; axis++ {
+		blockCentroid := sum[axis] / float64(stats.NumBlocks)
+		centroid[axis] = (blockCentroid+0.5)*float64(bs[axis]) - 0.5
+	}
+	stats.MinBlock, stats.MaxBlock = &minBlock, &maxBlock
+	stats.MinPoint, stats.MaxPoint = &minPoint, &maxPoint
+	stats.Centroid = &centroid
+	return stats, nil
+}
+
+// resolutionType is data with a voxel resolution, e.g., label or image data.
+type resolutionType interface {
+	Resolution() dvid.Resolution
+}
+
+// returns the voxel size and units of the named instance or, if no name is given, of the
+// first synced instance with a resolution.  If there is no such instance, the voxel size is
+// 1_1_1 in "voxels".
+func (d *Data) defaultResolution(v dvid.VersionID, name dvid.InstanceName) (dvid.NdFloat32, string, error) {
+	var sources []datastore.DataService
+	if name != "" {
+		data, err := datastore.GetDataByVersionName(v, name)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, ok := data.(resolutionType); !ok {
+			return nil, "", fmt.Errorf("data instance %q does not have a resolution", name)
+		}
+		sources = append(sources, data)
+	} else {
+		var synced []dvid.UUID
+		for dataUUID := range d.SyncedData() {
+			synced = append(synced, dataUUID)
+		}
+		sort.Slice(synced, func(i, j int) bool { return synced[i] < synced[j] })
+		for _, dataUUID := range synced {
+			data, err := datastore.GetDataByDataUUID(dataUUID)
+			if err != nil {
+				return nil, "", err
+			}
+			sources = append(sources, data)
+		}
+	}
+	for _, data := range sources {
+		res, ok := data.(resolutionType)
+		if !ok {
+			continue
+		}
+		resolution := res.Resolution()
+		if len(resolution.VoxelSize) != 3 {
+			continue
+		}
+		units := "voxels"
+		if len(resolution.VoxelUnits) != 0 {
+			units = resolution.VoxelUnits[0]
+		}
+		return resolution.VoxelSize, units, nil
+	}
+	return dvid.NdFloat32{1, 1, 1}, "voxels", nil
+}
+
+// labelVoxelsType is label data that can return the number of voxels of a label in
+// each of its blocks, e.g., labelmap instances via their label indices, and within
+// sub-blocks of those blocks.
+type labelVoxelsType interface {
+	labelBlocksType
+	GetLabelBlockVoxels(v dvid.VersionID, label uint64) (map[dvid.IZYXString]uint64, error)
+	GetLabelSubBlockVoxels(v dvid.VersionID, label uint64, blocks dvid.IZYXSlice, subSize dvid.Point3d) (map[dvid.IZYXString]uint64, error)
+}
+
+// LabelOverlap gives the number of voxels, or blocks at a scale, of a label within an ROI.
+type LabelOverlap struct {
+	Label  uint64
+	Voxels *uint64 `json:",omitempty"`
+	Blocks *uint64 `json:",omitempty"`
+}
+
+// returns true if the block is within the normalized spans.
+func spansInclude(spans dvid.Spans, block dvid.ChunkPoint3d) bool {
+	x, y, z := block[0], block[1], block[2]
+	i := sort.Search(len(spans), func(i int) bool {
+		s := spans[i]
+		if s[0] != z {
+			return s[0] > z
+		}
+		if s[1] != y {
+			return s[1] > y
+		}
+		return s[3] >= x
+	})
+	return i < len(spans) && spans[i][0] == z && spans[i][1] == y && spans[i][2] <= x
+}
+
+// returns the factor from label blocks to ROI blocks along each axis.
+func blockFactor(roiSize, labelSize dvid.Point3d) (factor dvid.Point3d, err error) {
+	for i := 0; i < 3; i++ {
+		if labelSize[i] <= 0 || roiSize[i]%labelSize[i] != 0 {
+			err = fmt.Errorf("ROI block size %s must be a multiple of label block size %s", roiSize, labelSize)
+			return
+		}
+		factor[i] = roiSize[i] / labelSize[i]
+	}
+	return
+}
+
+// returns the number of the given label blocks within the ROI spans.
+func countBlocksInSpans(spans dvid.Spans, factor dvid.Point3d, blocks map[dvid.IZYXString]uint64) (uint64, error) {
+	var total uint64
+	for izyx, count := range blocks {
+		bcoord, err := izyx.ToChunkPoint3d()
+		if err != nil {
+			return 0, err
+		}
+		roiBlock := dvid.ChunkPoint3d{
+			floorDiv(bcoord[0], factor[0]),
+			floorDiv(bcoord[1], factor[1]),
+			floorDiv(bcoord[2], factor[2]),
+		}
+		if spansInclude(spans, roiBlock) {
+			total += count
+		}
+	}
+	return total, nil
+}
+
+func floorDiv(a, b int32) int32 {
+	q := a / b
+	if a%b != 0 && a < 0 {
+		q--
+	}
+	return q
+}
+
+// returns the number of voxels of a label within the ROI spans when ROI blocks don't align
+// with the label blocks.  Label blocks entirely within or outside the ROI use their voxel
+// counts, while the voxels of label blocks straddling the ROI boundary are counted per ROI
+// block from the label block data.
+func countVoxelsInSpans(v dvid.VersionID, labelData labelVoxelsType, label uint64, spans dvid.Spans, roiSize, labelSize dvid.Point3d, blocks map[dvid.IZYXString]uint64) (uint64, error) {
+	var total uint64
+	var partial dvid.IZYXSlice
+	for izyx, count := range blocks {
+		bcoord, err := izyx.ToChunkPoint3d()
+		if err != nil {
+			return 0, err
+		}
+		var begRoi, endRoi dvid.ChunkPoint3d
+		for i := 0; i < 3; i++ {
+			lo := int64(bcoord[i]) * int64(labelSize[i])
+			hi := lo + int64(labelSize[i]) - 1
+			begRoi[i] = int32(floorDiv64(lo, int64(roiSize[i])))
+			endRoi[i] = int32(floorDiv64(hi, int64(roiSize[i])))
+		}
+		var numRoi, numIn int64
+		for z := begRoi[2]; z <= endRoi[2]; z++ {
+			for y := begRoi[1]; y <= endRoi[1]; y++ {
+				for x := begRoi[0]; x <= endRoi[0]; x++ {
+					numRoi++
+					if spansInclude(spans, dvid.ChunkPoint3d{x, y, z}) {
+						numIn++
+					}
+				}
+			}
+		}
+		switch numIn {
+		case 0:
+		case numRoi:
+			total += count
+		default:
+			partial = append(partial, izyx)
+		}
+	}
+	if len(partial) == 0 {
+		return total, nil
+	}
+	subCounts, err := labelData.GetLabelSubBlockVoxels(v, label, partial, roiSize)
+	if err != nil {
+		return 0, err
+	}
+	for izyx, count := range subCounts {
+		roiBlock, err := izyx.ToChunkPoint3d()
+		if err != nil {
+			return 0, err
+		}
+		if spansInclude(spans, roiBlock) {
+			total += count
+		}
+	}
+	return total, nil
+}
+
+func floorDiv64(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && a < 0 {
+		q--
+	}
+	return q
+}
+
+// GetLabelOverlap returns the number of voxels of each label within the ROI using the
+// label indices of the named label instance, reading label blocks that straddle the ROI
+// boundary if the ROI block size isn't a multiple of the label block size.  If scale is
+// non-negative, the number of label blocks at that scale within the ROI is returned
+// instead, which requires the ROI block size to be a multiple of the label block size at
+// that scale.
+func (d *Data) GetLabelOverlap(v dvid.VersionID, labelName dvid.InstanceName, lbls []uint64, scale int) ([]LabelOverlap, error) {
+	if scale > 31 {
+		return nil, fmt.Errorf("bad scale %d for label overlap", scale)
+	}
+	data, err := datastore.GetDataByVersionName(v, labelName)
+	if err != nil {
+		return nil, err
+	}
+	labelData, ok := data.(labelVoxelsType)
+	if !ok {
+		return nil, fmt.Errorf("data instance %q does not support label overlap", labelName)
+	}
+	labelBlockSize, ok := labelData.BlockSize().(dvid.Point3d)
+	if !ok {
+		return nil, fmt.Errorf("data instance %q does not have 3d blocks", labelName)
+	}
+	if scale > 0 {
+		labelBlockSize = dvid.Point3d{labelBlockSize[0] << uint(scale), labelBlockSize[1] << uint(scale), labelBlockSize[2] << uint(scale)}
+	}
+	factor, err := blockFactor(d.BlockSize, labelBlockSize)
+	aligned := err == nil
+	if !aligned && scale >= 0 {
+		return nil, err
+	}
+	d.RLock()
+	roiSpans, err := d.GetSpans(v)
+	d.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	spans := dvid.Spans(roiSpans).Normalize()
+
+	timedLog := dvid.NewTimeLog()
+	overlaps := make([]LabelOverlap, len(lbls))
+	for i, label := range lbls {
+		overlaps[i].Label = label
+		var blocks map[dvid.IZYXString]uint64
+		if scale < 0 {
+			if blocks, err = labelData.GetLabelBlockVoxels(v, label); err != nil {
+				return nil, err
+			}
+		} else {
+			indices, err := labelData.GetLabelBlockIndices(v, label, uint8(scale), false)
+			if err != nil {
+				return nil, err
+			}
+			blocks = make(map[dvid.IZYXString]uint64, len(indices))
+			for _, izyx := range indices {
+				blocks[izyx] = 1
+			}
+		}
+		var count uint64
+		if aligned {
+			count, err = countBlocksInSpans(spans, factor, blocks)
+		} else {
+			count, err = countVoxelsInSpans(v, labelData, label, spans, d.BlockSize, labelBlockSize, blocks)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if scale < 0 {
+			overlaps[i].Voxels = &count
+		} else {
+			overlaps[i].Blocks = &count
+		}
+	}
+	timedLog.Infof("Computed overlap of %d labels of %q with ROI %q", len(lbls), labelName, d.DataName())
+	return overlaps, nil
+}
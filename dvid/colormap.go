@@ -0,0 +1,182 @@
+/*
+	This file supports conversion of single-channel images with values of any data type,
+	e.g., float32 or uint16, into 8-bit images viewable in browsers.
+*/
+
+package dvid
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"math"
+)
+
+// Colormaps for converting single-channel images into displayable images.
+const (
+	ColormapGray    = "gray"
+	ColormapViridis = "viridis"
+)
+
+// viridisStops are evenly spaced colors of the viridis colormap between which colors
+// are linearly interpolated.
+var viridisStops = [][3]float64{
+	{68, 1, 84},
+	{72, 40, 120},
+	{62, 73, 137},
+	{49, 104, 142},
+	{38, 130, 142},
+	{31, 158, 137},
+	{53, 183, 121},
+	{110, 206, 88},
+	{253, 231, 37},
+}
+
+// ValidColormap returns an error if the colormap name is not supported.
+func ValidColormap(colormap string) error {
+	switch colormap {
+	case ColormapGray, ColormapViridis:
+		return nil
+	}
+	return fmt.Errorf("colormap must be %q or %q, not %q", ColormapGray, ColormapViridis, colormap)
+}
+
+// Values returns the pixel values of a single-channel image as float64 in row-major order.
+func (img *Image) Values() ([]float64, error) {
+	if img == nil {
+		return nil, fmt.Errorf("can't get values of nil DVID image")
+	}
+	if img.DataFormat.ValuesPerElement() != 1 {
+		return nil, fmt.Errorf("can only get values of single-channel images, not %d channels", img.DataFormat.ValuesPerElement())
+	}
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	var pix []uint8
+	var stride int
+	switch img.Which {
+	case 0:
+		pix, stride = img.Gray.Pix, img.Gray.Stride
+	case 1:
+		pix, stride = img.Gray16.Pix, img.Gray16.Stride
+	case 2:
+		pix, stride = img.NRGBA.Pix, img.NRGBA.Stride
+	case 3:
+		pix, stride = img.NRGBA64.Pix, img.NRGBA64.Stride
+	default:
+		return nil, fmt.Errorf("unknown image type %d", img.Which)
+	}
+
+	// Gray16 pixels are big-endian while other multi-byte values are stored as little-endian.
+	var decode func(b []byte) float64
+	t := img.DataFormat[0].T
+	switch t {
+	case T_uint8:
+		decode = func(b []byte) float64 { return float64(b[0]) }
+	case T_int8:
+		decode = func(b []byte) float64 { return float64(int8(b[0])) }
+	case T_uint16:
+		decode = func(b []byte) float64 { return float64(binary.BigEndian.Uint16(b)) }
+	case T_int16:
+		decode = func(b []byte) float64 { return float64(int16(binary.BigEndian.Uint16(b))) }
+	case T_uint32:
+		decode = func(b []byte) float64 { return float64(binary.LittleEndian.Uint32(b)) }
+	case T_int32:
+		decode = func(b []byte) float64 { return float64(int32(binary.LittleEndian.Uint32(b))) }
+	case T_uint64:
+		decode = func(b []byte) float64 { return float64(binary.LittleEndian.Uint64(b)) }
+	case T_int64:
+		decode = func(b []byte) float64 { return float64(int64(binary.LittleEndian.Uint64(b))) }
+	case T_float32:
+		decode = func(b []byte) float64 { return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))) }
+	case T_float64:
+		decode = func(b []byte) float64 { return math.Float64frombits(binary.LittleEndian.Uint64(b)) }
+	default:
+		return nil, fmt.Errorf("can't get values for data type %d", t)
+	}
+	bytesPerValue := int(DataTypeBytes(t))
+	values := make([]float64, 0, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := y*stride + x*bytesPerValue
+			values = append(values, decode(pix[i:i+bytesPerValue]))
+		}
+	}
+	return values, nil
+}
+
+// ColormapImage returns an 8-bit image of a single-channel image with values of any data type,
+// mapping values from minVal to maxVal onto the colormap.  If minVal and maxVal are both NaN,
+// the range of image values is used, and if only one is NaN, it is set from the image values.
+// The "gray" colormap returns an *image.Gray, while "viridis" returns an *image.NRGBA where
+// NaN values are transparent.
+func ColormapImage(img *Image, colormap string, minVal, maxVal float64) (image.Image, error) {
+	if err := ValidColormap(colormap); err != nil {
+		return nil, err
+	}
+	values, err := img.Values()
+	if err != nil {
+		return nil, err
+	}
+	if math.IsNaN(minVal) || math.IsNaN(maxVal) {
+		imgMin, imgMax := math.Inf(1), math.Inf(-1)
+		for _, v := range values {
+			if math.IsNaN(v) {
+				continue
+			}
+			imgMin = math.Min(imgMin, v)
+			imgMax = math.Max(imgMax, v)
+		}
+		if math.IsNaN(minVal) {
+			minVal = imgMin
+		}
+		if math.IsNaN(maxVal) {
+			maxVal = imgMax
+		}
+	}
+	bounds := img.Bounds()
+	rect := image.Rect(0, 0, bounds.Dx(), bounds.Dy())
+
+	// normalized returns value scaled to [0,1] or NaN.
+	normalized := func(v float64) float64 {
+		if math.IsNaN(v) {
+			return v
+		}
+		if maxVal <= minVal || math.IsInf(minVal, 0) || math.IsInf(maxVal, 0) {
+			if v >= maxVal {
+				return 1
+			}
+			return 0
+		}
+		return math.Max(0, math.Min(1, (v-minVal)/(maxVal-minVal)))
+	}
+
+	if colormap == ColormapGray {
+		gray := image.NewGray(rect)
+		for i, v := range values {
+			if f := normalized(v); !math.IsNaN(f) {
+				gray.Pix[i] = uint8(f*255 + 0.5)
+			}
+		}
+		return gray, nil
+	}
+	rgba := image.NewNRGBA(rect)
+	numStops := len(viridisStops)
+	for i, v := range values {
+		f := normalized(v)
+		if math.IsNaN(f) {
+			continue
+		}
+		pos := f * float64(numStops-1)
+		stop := int(pos)
+		if stop >= numStops-1 {
+			stop = numStops - 2
+		}
+		frac := pos - float64(stop)
+		for c := 0; c < 3; c++ {
+			lo, hi := viridisStops[stop][c], viridisStops[stop+1][c]
+			rgba.Pix[4*i+c] = uint8(lo + frac*(hi-lo) + 0.5)
+		}
+		rgba.Pix[4*i+3] = 255
+	}
+	return rgba, nil
+}
@@ -0,0 +1,129 @@
+package dvid
+
+import (
+	"encoding/binary"
+	"image"
+	"math"
+	"testing"
+)
+
+func makeFloat32Image(width, height int, values []float32) *Image {
+	nrgba := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for i, v := range values {
+		binary.LittleEndian.PutUint32(nrgba.Pix[i*4:i*4+4], math.Float32bits(v))
+	}
+	return &Image{
+		DataFormat:   DataValues{{T: T_float32, Label: "float32"}},
+		Interpolable: true,
+		Which:        2,
+		NRGBA:        nrgba,
+	}
+}
+
+func TestColormapImage(t *testing.T) {
+	nan := float32(math.NaN())
+	img := makeFloat32Image(3, 2, []float32{-1.5, 0, 1.5, 3, 10, nan})
+
+	values, err := img.Values()
+	if err != nil {
+		t.Fatalf("error getting values: %v", err)
+	}
+	if len(values) != 6 || values[0] != -1.5 || values[4] != 10 || !math.IsNaN(values[5]) {
+		t.Fatalf("bad float32 values: %v", values)
+	}
+
+	// Explicit range with clamping.
+	goImg, err := ColormapImage(img, ColormapGray, 0, 3)
+	if err != nil {
+		t.Fatalf("error colormapping: %v", err)
+	}
+	gray, ok := goImg.(*image.Gray)
+	if !ok {
+		t.Fatalf("expected gray image, got %T", goImg)
+	}
+	expected := []uint8{0, 0, 128, 255, 255, 0}
+	for i, v := range expected {
+		if gray.Pix[i] != v {
+			t.Errorf("gray pixel %d: expected %d, got %d", i, v, gray.Pix[i])
+		}
+	}
+
+	// Auto range ignores NaN.
+	goImg, err = ColormapImage(img, ColormapViridis, math.NaN(), math.NaN())
+	if err != nil {
+		t.Fatalf("error colormapping: %v", err)
+	}
+	rgba, ok := goImg.(*image.NRGBA)
+	if !ok {
+		t.Fatalf("expected NRGBA image, got %T", goImg)
+	}
+	if rgba.Pix[0] != 68 || rgba.Pix[1] != 1 || rgba.Pix[2] != 84 || rgba.Pix[3] != 255 {
+		t.Errorf("expected minimum value to be first viridis color, got %v", rgba.Pix[0:4])
+	}
+	if rgba.Pix[16] != 253 || rgba.Pix[17] != 231 || rgba.Pix[18] != 37 {
+		t.Errorf("expected maximum value to be last viridis color, got %v", rgba.Pix[16:20])
+	}
+	if rgba.Pix[23] != 0 {
+		t.Errorf("expected NaN pixel to be transparent, got alpha %d", rgba.Pix[23])
+	}
+
+	if _, err := ColormapImage(img, "jet", 0, 1); err == nil {
+		t.Errorf("expected error for unknown colormap")
+	}
+}
+
+func TestColormapUint16(t *testing.T) {
+	gray16 := image.NewGray16(image.Rect(0, 0, 2, 1))
+	binary.BigEndian.PutUint16(gray16.Pix[0:2], 1000)
+	binary.BigEndian.PutUint16(gray16.Pix[2:4], 3000)
+	img := &Image{
+		DataFormat: DataValues{{T: T_uint16, Label: "uint16"}},
+		Which:      1,
+		Gray16:     gray16,
+	}
+	goImg, err := ColormapImage(img, ColormapGray, math.NaN(), math.NaN())
+	if err != nil {
+		t.Fatalf("error colormapping: %v", err)
+	}
+	gray := goImg.(*image.Gray)
+	if gray.Pix[0] != 0 || gray.Pix[1] != 255 {
+		t.Errorf("expected auto-ranged uint16 to span 0 to 255, got %v", gray.Pix)
+	}
+}
+
+func TestInterpolateFloat32(t *testing.T) {
+	nan := float32(math.NaN())
+	img := makeFloat32Image(4, 2, []float32{
+		1, 3, 10, nan,
+		5, 7, nan, nan,
+	})
+	goImg, err := img.InterpolateImage(2, 1)
+	if err != nil {
+		t.Fatalf("error interpolating: %v", err)
+	}
+	dst, ok := goImg.(*image.NRGBA)
+	if !ok {
+		t.Fatalf("expected NRGBA image, got %T", goImg)
+	}
+	if bounds := dst.Bounds(); bounds.Dx() != 2 || bounds.Dy() != 1 {
+		t.Fatalf("bad interpolated size: %v", bounds)
+	}
+	v0 := math.Float32frombits(binary.LittleEndian.Uint32(dst.Pix[0:4]))
+	v1 := math.Float32frombits(binary.LittleEndian.Uint32(dst.Pix[4:8]))
+	if v0 != 4 {
+		t.Errorf("expected average of 4, got %f", v0)
+	}
+	if v1 != 10 {
+		t.Errorf("expected NaN values to be ignored giving 10, got %f", v1)
+	}
+
+	allNaN := makeFloat32Image(2, 2, []float32{nan, nan, nan, nan})
+	goImg, err = allNaN.InterpolateImage(1, 1)
+	if err != nil {
+		t.Fatalf("error interpolating: %v", err)
+	}
+	v := math.Float32frombits(binary.LittleEndian.Uint32(goImg.(*image.NRGBA).Pix[0:4]))
+	if !math.IsNaN(float64(v)) {
+		t.Errorf("expected NaN from all-NaN source, got %f", v)
+	}
+}
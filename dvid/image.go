@@ -25,6 +25,7 @@ import (
 	"image/draw"
 	"image/jpeg"
 	"image/png"
+	"math"
 	"net/http"
 	"os"
 	"reflect"
@@ -781,6 +782,9 @@ func (img *Image) InterpolateImage(dstW, dstH int) (image.Image, error) {
 		case 2:
 			return interpolate1x16(img.Gray16, dstW, dstH), nil
 		case 4:
+			if img.DataFormat[0].T == T_float32 {
+				return interpolate1xFloat32(img.NRGBA, dstW, dstH), nil
+			}
 			return interpolate1x32(img.NRGBA, dstW, dstH), nil
 		case 8:
 			return interpolate1x64(img.NRGBA64, dstW, dstH), nil
@@ -948,6 +952,71 @@ func interpolate1x16(src *image.Gray16, dstW, dstH int) image.Image {
 	return dst
 }
 
+// Interpolate little-endian float32/pixel images stored as NRGBA.  NaN pixels are
+// ignored, and destination pixels covering only NaN pixels are NaN.
+func interpolate1xFloat32(src *image.NRGBA, dstW, dstH int) image.Image {
+	srcRect := src.Bounds()
+	srcW := srcRect.Dx()
+	srcH := srcRect.Dy()
+
+	ww, hh := uint64(dstW), uint64(dstH)
+	dx, dy := uint64(srcW), uint64(srcH)
+
+	sum, weights := make([]float64, dstW*dstH), make([]uint64, dstW*dstH)
+	for y := 0; y < srcH; y++ {
+		pixOffset := src.PixOffset(0, y)
+		for x := 0; x < srcW; x++ {
+			// Get the source pixel.
+			val := float64(math.Float32frombits(binary.LittleEndian.Uint32(src.Pix[pixOffset+0 : pixOffset+4])))
+			pixOffset += 4
+			if math.IsNaN(val) {
+				continue
+			}
+
+			// Spread the source pixel over 1 or more destination rows.
+			py := uint64(y) * hh
+			for remy := hh; remy > 0; {
+				qy := dy - (py % dy)
+				if qy > remy {
+					qy = remy
+				}
+				// Spread the source pixel over 1 or more destination columns.
+				px := uint64(x) * ww
+				index := (py/dy)*ww + (px / dx)
+				for remx := ww; remx > 0; {
+					qx := dx - (px % dx)
+					if qx > remx {
+						qx = remx
+					}
+					qxy := qx * qy
+					sum[index] += val * float64(qxy)
+					weights[index] += qxy
+					index++
+					px += qx
+					remx -= qx
+				}
+				py += qy
+				remy -= qy
+			}
+		}
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dstW, dstH))
+	index := 0
+	for y := 0; y < dstH; y++ {
+		pixOffset := dst.PixOffset(0, y)
+		for x := 0; x < dstW; x++ {
+			val := float32(math.NaN())
+			if weights[index] != 0 {
+				val = float32(sum[index] / float64(weights[index]))
+			}
+			binary.LittleEndian.PutUint32(dst.Pix[pixOffset+0:pixOffset+4], math.Float32bits(val))
+			pixOffset += 4
+			index++
+		}
+	}
+	return dst
+}
+
 // Interpolate uint32/pixel images.
 func interpolate1x32(src *image.NRGBA, dstW, dstH int) image.Image {
 	srcRect := src.Bounds()
@@ -1388,6 +1457,16 @@ func WriteImageHttp(w http.ResponseWriter, img image.Image, formatStr string) er
 		if err = bmp.Encode(w, img); err != nil {
 			return err
 		}
+	case "webp":
+		// WebP is lossless unless a quality is given.
+		quality := 100
+		if len(format) > 1 {
+			quality = compression
+		}
+		w.Header().Set("Content-type", "image/webp")
+		if err = EncodeWebP(w, img, quality); err != nil {
+			return err
+		}
 	default:
 		return fmt.Errorf("Illegal image format requested: %s", format[0])
 	}
@@ -0,0 +1,697 @@
+/*
+	This file supports self-describing file formats for 3d subvolumes.
+*/
+
+package dvid
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Self-describing formats for 3d subvolumes.
+const (
+	VolumeTIFF = "tiff" // multi-page TIFF with one page per z
+	VolumeNRRD = "nrrd"
+)
+
+// VolumeMetadata describes a 3d subvolume of little-endian voxels in ZYX order, where
+// channels of a voxel are interleaved.
+type VolumeMetadata struct {
+	Type        DataType
+	NumChannels int32
+	Size        Point3d
+	Offset      Point3d
+	Resolution
+}
+
+// IsVolumeFormat returns true if the format string is a self-describing volume format.
+func IsVolumeFormat(format string) bool {
+	switch strings.ToLower(format) {
+	case VolumeTIFF, "tif", VolumeNRRD:
+		return true
+	}
+	return false
+}
+
+func (m VolumeMetadata) numBytes() int64 {
+	return m.Size.Prod() * int64(m.NumChannels) * int64(DataTypeBytes(m.Type))
+}
+
+// WriteVolumeHTTP writes a subvolume to an HTTP response in the given self-describing format.
+func WriteVolumeHTTP(w http.ResponseWriter, format string, meta VolumeMetadata, data []byte) error {
+	switch strings.ToLower(format) {
+	case VolumeTIFF, "tif":
+		w.Header().Set("Content-type", "image/tiff")
+		return WriteTIFFVolume(w, meta, data)
+	case VolumeNRRD:
+		w.Header().Set("Content-type", "application/octet-stream")
+		return WriteNRRDVolume(w, meta, data)
+	default:
+		return fmt.Errorf("unknown volume format %q", format)
+	}
+}
+
+// MaxVolumeBytes is the largest subvolume that will be read from a self-describing format
+// when the expected subvolume isn't given.
+const MaxVolumeBytes = 1 << 32
+
+// ReadVolume reads a subvolume in the given self-describing format.  If expected is
+// non-nil, a header whose type, channels, or size doesn't match the expected subvolume is
+// rejected before any voxel data is allocated.
+func ReadVolume(format string, r io.Reader, expected *VolumeMetadata) (VolumeMetadata, []byte, error) {
+	switch strings.ToLower(format) {
+	case VolumeTIFF, "tif":
+		return ReadTIFFVolume(r, expected)
+	case VolumeNRRD:
+		return ReadNRRDVolume(r, expected)
+	default:
+		return VolumeMetadata{}, nil, fmt.Errorf("unknown volume format %q", format)
+	}
+}
+
+// returns the product of non-negative factors, or false if any factor is negative or the
+// product exceeds the limit.
+func boundedProduct(limit int64, factors ...int64) (int64, bool) {
+	prod := int64(1)
+	for _, f := range factors {
+		if f < 0 || (f != 0 && prod > limit/f) {
+			return 0, false
+		}
+		prod *= f
+	}
+	return prod, true
+}
+
+// returns the maximum number of voxel bytes allowed for a read subvolume.
+func maxVolumeBytes(expected *VolumeMetadata) int64 {
+	if expected == nil {
+		return MaxVolumeBytes
+	}
+	return expected.numBytes()
+}
+
+// CheckVolume returns an error if a read subvolume doesn't have the expected type,
+// number of channels, and size.
+func (m VolumeMetadata) CheckVolume(t DataType, numChannels int32, size Point3d) error {
+	if m.Type != t || m.NumChannels != numChannels {
+		return fmt.Errorf("volume has %d channels of type %d, expected %d channels of type %d", m.NumChannels, m.Type, numChannels, t)
+	}
+	if !m.Size.Equals(size) {
+		return fmt.Errorf("volume has size %s, expected %s", m.Size, size)
+	}
+	return nil
+}
+
+// ---- TIFF
+
+const (
+	tiffShort    = 3
+	tiffLong     = 4
+	tiffASCII    = 2
+	tiffMaxBytes = math.MaxUint32
+)
+
+// tiffDescription is the JSON kept in the ImageDescription tag of the first page.
+type tiffDescription struct {
+	Offset     []int32   `json:"offset"`
+	VoxelSize  []float32 `json:"voxel_size,omitempty"`
+	VoxelUnits []string  `json:"voxel_units,omitempty"`
+}
+
+type tiffEntry struct {
+	tag    uint16
+	typ    uint16
+	values []uint32 // SHORT or LONG values
+	ascii  []byte
+}
+
+func tiffSampleFormat(t DataType) uint32 {
+	switch t {
+	case T_int8, T_int16, T_int32, T_int64:
+		return 2
+	case T_float32, T_float64:
+		return 3
+	default:
+		return 1
+	}
+}
+
+// WriteTIFFVolume writes a subvolume as uncompressed multi-page little-endian TIFF, one
+// page per z.  The offset and resolution are written as JSON in the ImageDescription of
+// the first page.
+func WriteTIFFVolume(w io.Writer, meta VolumeMetadata, data []byte) error {
+	if int64(len(data)) != meta.numBytes() {
+		return fmt.Errorf("expected %d bytes for volume of size %s, got %d", meta.numBytes(), meta.Size, len(data))
+	}
+	if int64(len(data))+int64(meta.Size[2])*1024 > tiffMaxBytes {
+		return fmt.Errorf("volume of %d bytes is too large for TIFF", len(data))
+	}
+	description, err := json.Marshal(tiffDescription{
+		Offset:     []int32{meta.Offset[0], meta.Offset[1], meta.Offset[2]},
+		VoxelSize:  meta.VoxelSize,
+		VoxelUnits: meta.VoxelUnits,
+	})
+	if err != nil {
+		return err
+	}
+	description = append(description, 0)
+	if len(description)%2 != 0 {
+		description = append(description, 0)
+	}
+
+	bits := uint32(DataTypeBytes(meta.Type)) * 8
+	channels := uint32(meta.NumChannels)
+	repeat := func(v uint32) []uint32 {
+		values := make([]uint32, channels)
+		for i := range values {
+			values[i] = v
+		}
+		return values
+	}
+	photometric := uint32(1)
+	if channels >= 3 && meta.Type == T_uint8 {
+		photometric = 2
+	}
+	pageBytes := uint32(meta.Size[0]) * uint32(meta.Size[1]) * channels * bits / 8
+	pagePadding := pageBytes % 2
+
+	// header, then description, then for each page its data followed by its IFD.
+	pos := uint32(8 + len(description))
+	header := []byte{'I', 'I', 42, 0, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint32(header[4:], pos+pageBytes+pagePadding)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(description); err != nil {
+		return err
+	}
+
+	for z := int32(0); z < meta.Size[2]; z++ {
+		entries := []tiffEntry{
+			{tag: 256, typ: tiffLong, values: []uint32{uint32(meta.Size[0])}},
+			{tag: 257, typ: tiffLong, values: []uint32{uint32(meta.Size[1])}},
+			{tag: 258, typ: tiffShort, values: repeat(bits)},
+			{tag: 259, typ: tiffShort, values: []uint32{1}},
+			{tag: 262, typ: tiffShort, values: []uint32{photometric}},
+		}
+		if z == 0 {
+			entries = append(entries, tiffEntry{tag: 270, typ: tiffASCII, values: []uint32{8}, ascii: description})
+		}
+		entries = append(entries,
+			tiffEntry{tag: 273, typ: tiffLong, values: []uint32{pos}},
+			tiffEntry{tag: 277, typ: tiffShort, values: []uint32{channels}},
+			tiffEntry{tag: 278, typ: tiffLong, values: []uint32{uint32(meta.Size[1])}},
+			tiffEntry{tag: 279, typ: tiffLong, values: []uint32{pageBytes}},
+			tiffEntry{tag: 284, typ: tiffShort, values: []uint32{1}},
+		)
+		if photometric == 2 && channels > 3 {
+			entries = append(entries, tiffEntry{tag: 338, typ: tiffShort, values: repeat(2)[:channels-3]})
+		}
+		entries = append(entries, tiffEntry{tag: 339, typ: tiffShort, values: repeat(tiffSampleFormat(meta.Type))})
+
+		page := data[int64(z)*int64(pageBytes) : int64(z+1)*int64(pageBytes)]
+		if _, err := w.Write(page); err != nil {
+			return err
+		}
+		if pagePadding != 0 {
+			if _, err := w.Write([]byte{0}); err != nil {
+				return err
+			}
+		}
+		ifdPos := pos + pageBytes + pagePadding
+		ifd := tiffIFD(entries, ifdPos)
+		nextPos := ifdPos + uint32(len(ifd))
+		if z == meta.Size[2]-1 {
+			binary.LittleEndian.PutUint32(ifd[2+12*len(entries):], 0)
+		} else {
+			binary.LittleEndian.PutUint32(ifd[2+12*len(entries):], nextPos+pageBytes+pagePadding)
+		}
+		if _, err := w.Write(ifd); err != nil {
+			return err
+		}
+		pos = nextPos
+	}
+	return nil
+}
+
+// tiffIFD returns an IFD starting at the given file position with any values that don't
+// fit in an entry written after the IFD.  The next IFD offset is left zero.
+func tiffIFD(entries []tiffEntry, ifdPos uint32) []byte {
+	ifdLen := 2 + 12*len(entries) + 4
+	ifd := make([]byte, ifdLen)
+	binary.LittleEndian.PutUint16(ifd, uint16(len(entries)))
+	var extra []byte
+	for i, entry := range entries {
+		e := ifd[2+12*i:]
+		binary.LittleEndian.PutUint16(e[0:], entry.tag)
+		binary.LittleEndian.PutUint16(e[2:], entry.typ)
+		if entry.typ == tiffASCII {
+			// ASCII values are written separately and referenced by offset.
+			binary.LittleEndian.PutUint32(e[4:], uint32(len(entry.ascii)))
+			binary.LittleEndian.PutUint32(e[8:], entry.values[0])
+			continue
+		}
+		binary.LittleEndian.PutUint32(e[4:], uint32(len(entry.values)))
+		var valueBytes []byte
+		for _, v := range entry.values {
+			if entry.typ == tiffShort {
+				valueBytes = append(valueBytes, byte(v), byte(v>>8))
+			} else {
+				valueBytes = append(valueBytes, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+			}
+		}
+		if len(valueBytes) <= 4 {
+			copy(e[8:12], valueBytes)
+		} else {
+			binary.LittleEndian.PutUint32(e[8:], ifdPos+uint32(ifdLen+len(extra)))
+			extra = append(extra, valueBytes...)
+		}
+	}
+	return append(ifd, extra...)
+}
+
+// ReadTIFFVolume reads an uncompressed multi-page TIFF where each page is a z slice of
+// identical size and sample layout.  Any offset and resolution written by WriteTIFFVolume
+// are returned in the metadata.  If expected is non-nil, the TIFF must match its type,
+// channels, and size.
+func ReadTIFFVolume(r io.Reader, expected *VolumeMetadata) (meta VolumeMetadata, data []byte, err error) {
+	var file []byte
+	if file, err = ioutil.ReadAll(r); err != nil {
+		return
+	}
+	if len(file) < 8 {
+		err = fmt.Errorf("TIFF file too short")
+		return
+	}
+	fileLen := int64(len(file))
+	var order binary.ByteOrder
+	switch string(file[0:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		err = fmt.Errorf("bad TIFF byte order marker %q", file[0:2])
+		return
+	}
+	if order.Uint16(file[2:4]) != 42 {
+		err = fmt.Errorf("only classic TIFF files are supported")
+		return
+	}
+
+	maxBytes := maxVolumeBytes(expected)
+	var totalBytes, pageBytes int64
+	var pages [][]byte
+	var width, height, channels, bits, sampleFormat uint32
+	visited := make(map[int64]struct{})
+	ifdPos := int64(order.Uint32(file[4:8]))
+	for ifdPos != 0 {
+		if _, found := visited[ifdPos]; found {
+			err = fmt.Errorf("TIFF IFD at %d is referenced more than once", ifdPos)
+			return
+		}
+		visited[ifdPos] = struct{}{}
+		if ifdPos+2 > fileLen {
+			err = fmt.Errorf("bad TIFF IFD offset %d", ifdPos)
+			return
+		}
+		numEntries := int64(order.Uint16(file[ifdPos:]))
+		if ifdPos+2+12*numEntries+4 > fileLen {
+			err = fmt.Errorf("truncated TIFF IFD at %d", ifdPos)
+			return
+		}
+		tags := make(map[uint16][]uint32)
+		for i := int64(0); i < numEntries; i++ {
+			e := file[ifdPos+2+12*i:]
+			tag, typ, count := order.Uint16(e[0:]), order.Uint16(e[2:]), int64(order.Uint32(e[4:]))
+			if tag == 270 && len(pages) == 0 {
+				offset := int64(order.Uint32(e[8:]))
+				if count > 4 && offset+count <= fileLen {
+					desc := bytes.TrimRight(file[offset:offset+count], "\x00")
+					var td tiffDescription
+					if json.Unmarshal(desc, &td) == nil && len(td.Offset) == 3 {
+						meta.Offset = Point3d{td.Offset[0], td.Offset[1], td.Offset[2]}
+						meta.VoxelSize = td.VoxelSize
+						meta.VoxelUnits = td.VoxelUnits
+					}
+				}
+				continue
+			}
+			var size int64
+			switch typ {
+			case tiffShort:
+				size = 2
+			case tiffLong:
+				size = 4
+			default:
+				continue
+			}
+			valueBytes := e[8:12]
+			if size*count > 4 {
+				offset := int64(order.Uint32(e[8:]))
+				if offset+size*count > fileLen {
+					err = fmt.Errorf("bad TIFF tag %d value offset", tag)
+					return
+				}
+				valueBytes = file[offset : offset+size*count]
+			}
+			values := make([]uint32, count)
+			for j := range values {
+				if size == 2 {
+					values[j] = uint32(order.Uint16(valueBytes[2*j:]))
+				} else {
+					values[j] = order.Uint32(valueBytes[4*j:])
+				}
+			}
+			tags[tag] = values
+		}
+		get := func(tag uint16, defaultValue uint32) uint32 {
+			if values, found := tags[tag]; found && len(values) > 0 {
+				return values[0]
+			}
+			return defaultValue
+		}
+		if get(259, 1) != 1 {
+			err = fmt.Errorf("only uncompressed TIFF files are supported")
+			return
+		}
+		if get(284, 1) != 1 {
+			err = fmt.Errorf("only contiguous planar configuration TIFF files are supported")
+			return
+		}
+		w, h, c, b, sf := get(256, 0), get(257, 0), get(277, 1), get(258, 1), get(339, 1)
+		if len(pages) == 0 {
+			width, height, channels, bits, sampleFormat = w, h, c, b, sf
+			if meta.Type, err = tiffDataType(sampleFormat, bits); err != nil {
+				return
+			}
+			if width > math.MaxInt32 || height > math.MaxInt32 || channels == 0 || channels > math.MaxInt32 {
+				err = fmt.Errorf("bad TIFF page size %d x %d with %d channels", width, height, channels)
+				return
+			}
+			if expected != nil {
+				if err = checkVolumeLayout(meta.Type, int32(channels), int64(width), int64(height), expected); err != nil {
+					return
+				}
+			}
+			var ok bool
+			if pageBytes, ok = boundedProduct(maxBytes, int64(width), int64(height), int64(channels), int64(bits/8)); !ok {
+				err = fmt.Errorf("TIFF page of %d x %d with %d channels exceeds %d bytes", width, height, channels, maxBytes)
+				return
+			}
+		} else if w != width || h != height || c != channels || b != bits || sf != sampleFormat {
+			err = fmt.Errorf("TIFF page %d has different size or sample layout than first page", len(pages))
+			return
+		}
+		if expected != nil && int32(len(pages)) >= expected.Size[2] {
+			err = fmt.Errorf("TIFF has more than the expected %d pages", expected.Size[2])
+			return
+		}
+		if totalBytes += pageBytes; totalBytes > maxBytes {
+			err = fmt.Errorf("TIFF volume exceeds %d bytes", maxBytes)
+			return
+		}
+		offsets, counts := tags[273], tags[279]
+		if len(offsets) != len(counts) {
+			err = fmt.Errorf("TIFF page %d has mismatched strip offsets and byte counts", len(pages))
+			return
+		}
+		var stripBytes int64
+		for i := range offsets {
+			offset, count := int64(offsets[i]), int64(counts[i])
+			if offset+count > fileLen {
+				err = fmt.Errorf("TIFF page %d strip %d is out of bounds", len(pages), i)
+				return
+			}
+			stripBytes += count
+		}
+		if stripBytes < pageBytes {
+			err = fmt.Errorf("TIFF page %d has %d bytes, expected %d", len(pages), stripBytes, pageBytes)
+			return
+		}
+		page := make([]byte, 0, stripBytes)
+		for i := range offsets {
+			offset, count := int64(offsets[i]), int64(counts[i])
+			page = append(page, file[offset:offset+count]...)
+		}
+		pages = append(pages, page[:pageBytes])
+		ifdPos = int64(order.Uint32(file[ifdPos+2+12*numEntries:]))
+	}
+	if len(pages) == 0 {
+		err = fmt.Errorf("TIFF file has no pages")
+		return
+	}
+	if expected != nil && int32(len(pages)) != expected.Size[2] {
+		err = fmt.Errorf("TIFF has %d pages, expected %d", len(pages), expected.Size[2])
+		return
+	}
+	meta.NumChannels = int32(channels)
+	meta.Size = Point3d{int32(width), int32(height), int32(len(pages))}
+	data = bytes.Join(pages, nil)
+	if order == binary.BigEndian {
+		swapBytes(data, int(bits/8))
+	}
+	return
+}
+
+// returns the data type for a TIFF sample format and bits per sample.
+func tiffDataType(sampleFormat, bits uint32) (DataType, error) {
+	switch {
+	case sampleFormat == 1 && bits == 8:
+		return T_uint8, nil
+	case sampleFormat == 2 && bits == 8:
+		return T_int8, nil
+	case sampleFormat == 1 && bits == 16:
+		return T_uint16, nil
+	case sampleFormat == 2 && bits == 16:
+		return T_int16, nil
+	case sampleFormat == 1 && bits == 32:
+		return T_uint32, nil
+	case sampleFormat == 2 && bits == 32:
+		return T_int32, nil
+	case sampleFormat == 1 && bits == 64:
+		return T_uint64, nil
+	case sampleFormat == 2 && bits == 64:
+		return T_int64, nil
+	case sampleFormat == 3 && bits == 32:
+		return T_float32, nil
+	case sampleFormat == 3 && bits == 64:
+		return T_float64, nil
+	default:
+		return T_uint8, fmt.Errorf("unsupported TIFF sample format %d with %d bits", sampleFormat, bits)
+	}
+}
+
+// returns an error if a volume header's type, channels, or x and y size don't match the
+// expected subvolume.
+func checkVolumeLayout(t DataType, numChannels int32, nx, ny int64, expected *VolumeMetadata) error {
+	if t != expected.Type || numChannels != expected.NumChannels {
+		return fmt.Errorf("volume has %d channels of type %d, expected %d channels of type %d", numChannels, t, expected.NumChannels, expected.Type)
+	}
+	if nx != int64(expected.Size[0]) || ny != int64(expected.Size[1]) {
+		return fmt.Errorf("volume has x, y size %d x %d, expected %d x %d", nx, ny, expected.Size[0], expected.Size[1])
+	}
+	return nil
+}
+
+// swapBytes reverses the byte order of each element in place.
+func swapBytes(data []byte, elemBytes int) {
+	if elemBytes <= 1 {
+		return
+	}
+	for i := 0; i+elemBytes <= len(data); i += elemBytes {
+		for j, k := i, i+elemBytes-1; j < k; j, k = j+1, k-1 {
+			data[j], data[k] = data[k], data[j]
+		}
+	}
+}
+
+// ---- NRRD
+
+var nrrdTypes = map[DataType]string{
+	T_uint8:   "uint8",
+	T_int8:    "int8",
+	T_uint16:  "uint16",
+	T_int16:   "int16",
+	T_uint32:  "uint32",
+	T_int32:   "int32",
+	T_uint64:  "uint64",
+	T_int64:   "int64",
+	T_float32: "float",
+	T_float64: "double",
+}
+
+// nrrdTypeAliases maps the type names allowed by the NRRD specification to data types.
+var nrrdTypeAliases = map[string]DataType{
+	"signed char": T_int8, "int8": T_int8, "int8_t": T_int8,
+	"uchar": T_uint8, "unsigned char": T_uint8, "uint8": T_uint8, "uint8_t": T_uint8,
+	"short": T_int16, "short int": T_int16, "signed short": T_int16, "signed short int": T_int16, "int16": T_int16, "int16_t": T_int16,
+	"ushort": T_uint16, "unsigned short": T_uint16, "unsigned short int": T_uint16, "uint16": T_uint16, "uint16_t": T_uint16,
+	"int": T_int32, "signed int": T_int32, "int32": T_int32, "int32_t": T_int32,
+	"uint": T_uint32, "unsigned int": T_uint32, "uint32": T_uint32, "uint32_t": T_uint32,
+	"longlong": T_int64, "long long": T_int64, "long long int": T_int64, "signed long long": T_int64,
+	"signed long long int": T_int64, "int64": T_int64, "int64_t": T_int64,
+	"ulonglong": T_uint64, "unsigned long long": T_uint64, "unsigned long long int": T_uint64, "uint64": T_uint64, "uint64_t": T_uint64,
+	"float": T_float32, "double": T_float64,
+}
+
+// WriteNRRDVolume writes a subvolume as an NRRD file with raw little-endian data.  The
+// voxel size is written as space directions, the offset as the space origin in physical
+// units, and the voxel offset as the "dvid offset" key/value pair.
+func WriteNRRDVolume(w io.Writer, meta VolumeMetadata, data []byte) error {
+	if int64(len(data)) != meta.numBytes() {
+		return fmt.Errorf("expected %d bytes for volume of size %s, got %d", meta.numBytes(), meta.Size, len(data))
+	}
+	typeName, found := nrrdTypes[meta.Type]
+	if !found {
+		return fmt.Errorf("data type %d not supported by NRRD", meta.Type)
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "NRRD0004\n# Written by DVID\ntype: %s\n", typeName)
+	var channelSize, channelKind, channelDir string
+	dimension := 3
+	if meta.NumChannels > 1 {
+		dimension = 4
+		channelSize = fmt.Sprintf("%d ", meta.NumChannels)
+		channelKind = "vector "
+		channelDir = "none "
+	}
+	fmt.Fprintf(&buf, "dimension: %d\n", dimension)
+	fmt.Fprintf(&buf, "sizes: %s%d %d %d\n", channelSize, meta.Size[0], meta.Size[1], meta.Size[2])
+	fmt.Fprintf(&buf, "kinds: %sdomain domain domain\n", channelKind)
+	if len(meta.VoxelSize) == 3 {
+		vs := meta.VoxelSize
+		fmt.Fprintf(&buf, "space dimension: 3\n")
+		fmt.Fprintf(&buf, "space directions: %s(%g,0,0) (0,%g,0) (0,0,%g)\n", channelDir, vs[0], vs[1], vs[2])
+		fmt.Fprintf(&buf, "space origin: (%g,%g,%g)\n", float64(meta.Offset[0])*float64(vs[0]),
+			float64(meta.Offset[1])*float64(vs[1]), float64(meta.Offset[2])*float64(vs[2]))
+		if len(meta.VoxelUnits) == 3 {
+			fmt.Fprintf(&buf, "space units: %q %q %q\n", meta.VoxelUnits[0], meta.VoxelUnits[1], meta.VoxelUnits[2])
+		}
+	}
+	fmt.Fprintf(&buf, "encoding: raw\nendian: little\n")
+	fmt.Fprintf(&buf, "dvid offset:=%d %d %d\n\n", meta.Offset[0], meta.Offset[1], meta.Offset[2])
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// ReadNRRDVolume reads an NRRD file with attached raw or gzip encoded data.  The voxel offset
+// is read from a "dvid offset" key/value pair if present.  If expected is non-nil, the NRRD
+// must match its type, channels, and size.
+func ReadNRRDVolume(r io.Reader, expected *VolumeMetadata) (meta VolumeMetadata, data []byte, err error) {
+	br := bufio.NewReader(r)
+	var magic string
+	if magic, err = br.ReadString('\n'); err != nil {
+		return
+	}
+	if !strings.HasPrefix(magic, "NRRD000") {
+		err = fmt.Errorf("bad NRRD magic %q", strings.TrimSpace(magic))
+		return
+	}
+	fields := make(map[string]string)
+	keyvalues := make(map[string]string)
+	for {
+		var line string
+		if line, err = br.ReadString('\n'); err != nil {
+			err = fmt.Errorf("NRRD header not terminated by blank line: %v", err)
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.Index(line, ":="); i >= 0 {
+			keyvalues[line[:i]] = line[i+2:]
+		} else if i := strings.Index(line, ": "); i >= 0 {
+			fields[strings.ToLower(line[:i])] = strings.TrimSpace(line[i+2:])
+		}
+	}
+
+	var found bool
+	if meta.Type, found = nrrdTypeAliases[fields["type"]]; !found {
+		err = fmt.Errorf("unsupported NRRD type %q", fields["type"])
+		return
+	}
+	if _, found = fields["data file"]; found {
+		err = fmt.Errorf("detached NRRD data files are not supported")
+		return
+	}
+	var sizes []int32
+	for _, s := range strings.Fields(fields["sizes"]) {
+		var size int64
+		if size, err = strconv.ParseInt(s, 10, 32); err != nil || size <= 0 {
+			err = fmt.Errorf("bad NRRD sizes %q", fields["sizes"])
+			return
+		}
+		sizes = append(sizes, int32(size))
+	}
+	switch len(sizes) {
+	case 3:
+		meta.NumChannels = 1
+	case 4:
+		meta.NumChannels = sizes[0]
+		sizes = sizes[1:]
+	default:
+		err = fmt.Errorf("NRRD must have 3 dimensions or 4 with channels first, got sizes %q", fields["sizes"])
+		return
+	}
+	meta.Size = Point3d{sizes[0], sizes[1], sizes[2]}
+	if expected != nil {
+		if err = meta.CheckVolume(expected.Type, expected.NumChannels, expected.Size); err != nil {
+			return
+		}
+	}
+	maxBytes := maxVolumeBytes(expected)
+	numBytes, ok := boundedProduct(maxBytes, int64(meta.Size[0]), int64(meta.Size[1]), int64(meta.Size[2]),
+		int64(meta.NumChannels), int64(DataTypeBytes(meta.Type)))
+	if !ok {
+		err = fmt.Errorf("NRRD volume of size %s with %d channels exceeds %d bytes", meta.Size, meta.NumChannels, maxBytes)
+		return
+	}
+	if offsetStr, found := keyvalues["dvid offset"]; found {
+		if meta.Offset, err = StringToPoint3d(strings.TrimSpace(offsetStr), " "); err != nil {
+			return
+		}
+	}
+
+	var body io.Reader = br
+	switch fields["encoding"] {
+	case "raw":
+	case "gzip", "gz":
+		var zr *gzip.Reader
+		if zr, err = gzip.NewReader(br); err != nil {
+			return
+		}
+		defer zr.Close()
+		body = zr
+	default:
+		err = fmt.Errorf("unsupported NRRD encoding %q", fields["encoding"])
+		return
+	}
+	data = make([]byte, numBytes)
+	if _, err = io.ReadFull(body, data); err != nil {
+		err = fmt.Errorf("unable to read %d bytes of NRRD data: %v", len(data), err)
+		return
+	}
+	if fields["endian"] == "big" {
+		swapBytes(data, int(DataTypeBytes(meta.Type)))
+	}
+	return
+}
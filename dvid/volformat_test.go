@@ -0,0 +1,135 @@
+package dvid
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestVolumeFormatRoundTrip(t *testing.T) {
+	tests := []VolumeMetadata{
+		{Type: T_uint8, NumChannels: 1, Size: Point3d{5, 3, 4}, Offset: Point3d{10, 20, 30}},
+		{Type: T_uint16, NumChannels: 1, Size: Point3d{4, 4, 2}, Offset: Point3d{0, -8, 16}},
+		{Type: T_uint64, NumChannels: 1, Size: Point3d{3, 2, 3}, Offset: Point3d{64, 0, 32}},
+		{Type: T_float32, NumChannels: 1, Size: Point3d{2, 2, 2}},
+		{Type: T_uint8, NumChannels: 4, Size: Point3d{3, 3, 3}, Offset: Point3d{1, 2, 3}},
+	}
+	for _, meta := range tests {
+		meta.VoxelSize = NdFloat32{8, 8, 40}
+		meta.VoxelUnits = NdString{"nanometers", "nanometers", "nanometers"}
+		data := make([]byte, meta.numBytes())
+		for i := range data {
+			data[i] = byte(i*7 + 3)
+		}
+		for _, format := range []string{VolumeTIFF, VolumeNRRD} {
+			var buf bytes.Buffer
+			switch format {
+			case VolumeTIFF:
+				if err := WriteTIFFVolume(&buf, meta, data); err != nil {
+					t.Fatalf("error writing TIFF for %v: %v", meta, err)
+				}
+			case VolumeNRRD:
+				if err := WriteNRRDVolume(&buf, meta, data); err != nil {
+					t.Fatalf("error writing NRRD for %v: %v", meta, err)
+				}
+			}
+			got, gotData, err := ReadVolume(format, &buf, nil)
+			if err != nil {
+				t.Fatalf("error reading %s for %v: %v", format, meta, err)
+			}
+			if !bytes.Equal(gotData, data) {
+				t.Fatalf("%s round trip of %v returned different data", format, meta)
+			}
+			if err := got.CheckVolume(meta.Type, meta.NumChannels, meta.Size); err != nil {
+				t.Fatalf("%s round trip: %v", format, err)
+			}
+			if !got.Offset.Equals(meta.Offset) {
+				t.Errorf("%s round trip expected offset %s, got %s", format, meta.Offset, got.Offset)
+			}
+			if format == VolumeTIFF && !reflect.DeepEqual(got.Resolution, meta.Resolution) {
+				t.Errorf("TIFF round trip expected resolution %v, got %v", meta.Resolution, got.Resolution)
+			}
+		}
+	}
+}
+
+func TestReadNRRDBigEndian(t *testing.T) {
+	header := "NRRD0004\ntype: unsigned short\ndimension: 3\nsizes: 2 1 1\nencoding: raw\nendian: big\ndvid offset:=4 5 6\n\n"
+	meta, data, err := ReadNRRDVolume(bytes.NewBufferString(header+"\x01\x02\x03\x04"), nil)
+	if err != nil {
+		t.Fatalf("error reading NRRD: %v", err)
+	}
+	if meta.Type != T_uint16 || !meta.Size.Equals(Point3d{2, 1, 1}) || !meta.Offset.Equals(Point3d{4, 5, 6}) {
+		t.Fatalf("bad NRRD metadata: %v", meta)
+	}
+	if !bytes.Equal(data, []byte{2, 1, 4, 3}) {
+		t.Fatalf("expected big-endian data to be swapped, got %v", data)
+	}
+}
+
+func TestReadVolumeBounds(t *testing.T) {
+	expected := &VolumeMetadata{Type: T_uint8, NumChannels: 1, Size: Point3d{4, 4, 2}}
+	nrrd := func(typ, sizes string) *bytes.Buffer {
+		return bytes.NewBufferString("NRRD0004\ntype: " + typ + "\ndimension: 3\nsizes: " + sizes + "\nencoding: raw\n\n")
+	}
+	for _, sizes := range []string{"2000000000 2000000000 2000000000", "-1 4 4", "0 4 2", "4294967297 1 1"} {
+		if _, _, err := ReadNRRDVolume(nrrd("uint8", sizes), nil); err == nil {
+			t.Errorf("expected error for NRRD sizes %q", sizes)
+		}
+	}
+	if _, _, err := ReadNRRDVolume(nrrd("uint8", "4 4 3"), expected); err == nil {
+		t.Errorf("expected error for NRRD with size different from expected")
+	}
+	if _, _, err := ReadNRRDVolume(nrrd("uint16", "4 4 2"), expected); err == nil {
+		t.Errorf("expected error for NRRD with type different from expected")
+	}
+
+	meta := VolumeMetadata{Type: T_uint8, NumChannels: 1, Size: Point3d{4, 4, 2}}
+	var buf bytes.Buffer
+	if err := WriteTIFFVolume(&buf, meta, make([]byte, meta.numBytes())); err != nil {
+		t.Fatalf("error writing TIFF: %v", err)
+	}
+	tiff := buf.Bytes()
+	if _, _, err := ReadTIFFVolume(bytes.NewBuffer(tiff), expected); err != nil {
+		t.Fatalf("error reading expected TIFF: %v", err)
+	}
+	if _, _, err := ReadTIFFVolume(bytes.NewBuffer(tiff), &VolumeMetadata{Type: T_uint8, NumChannels: 1, Size: Point3d{4, 4, 1}}); err == nil {
+		t.Errorf("expected error for TIFF with more pages than expected")
+	}
+	if _, _, err := ReadTIFFVolume(bytes.NewBuffer(tiff), &VolumeMetadata{Type: T_uint16, NumChannels: 1, Size: Point3d{4, 4, 2}}); err == nil {
+		t.Errorf("expected error for TIFF with type different from expected")
+	}
+
+	// a TIFF whose IFD links back to itself and whose strip offset wraps in 32 bits.
+	bad := []byte("II\x2a\x00\x08\x00\x00\x00")
+	entry := func(tag, typ uint16, count, value uint32) []byte {
+		e := make([]byte, 12)
+		binary.LittleEndian.PutUint16(e[0:], tag)
+		binary.LittleEndian.PutUint16(e[2:], typ)
+		binary.LittleEndian.PutUint32(e[4:], count)
+		binary.LittleEndian.PutUint32(e[8:], value)
+		return e
+	}
+	bad = append(bad, 5, 0)
+	bad = append(bad, entry(256, tiffLong, 1, 1)...)
+	bad = append(bad, entry(257, tiffLong, 1, 1)...)
+	bad = append(bad, entry(258, tiffShort, 1, 8)...)
+	bad = append(bad, entry(273, tiffLong, 1, 0xFFFFFFF0)...)
+	bad = append(bad, entry(279, tiffLong, 1, 0x20)...)
+	bad = append(bad, 8, 0, 0, 0)
+	if _, _, err := ReadTIFFVolume(bytes.NewBuffer(bad), nil); err == nil {
+		t.Errorf("expected error for TIFF with wrapping strip offset")
+	}
+	binary.LittleEndian.PutUint32(bad[8+2+12*3+8:], 0)
+	binary.LittleEndian.PutUint32(bad[8+2+12*4+8:], 1)
+	if _, _, err := ReadTIFFVolume(bytes.NewBuffer(bad), nil); err == nil {
+		t.Errorf("expected error for TIFF with IFD loop")
+	}
+	binary.LittleEndian.PutUint32(bad[8+2+12*5:], 0)
+	binary.LittleEndian.PutUint32(bad[8+2+8:], 100000)
+	binary.LittleEndian.PutUint32(bad[8+2+12+8:], 100000)
+	if _, _, err := ReadTIFFVolume(bytes.NewBuffer(bad), nil); err == nil {
+		t.Errorf("expected error for TIFF with huge page")
+	}
+}
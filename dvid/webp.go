@@ -0,0 +1,143 @@
+/*
+	This file supports encoding and decoding of WebP images.  Encoding uses libwebp through
+	github.com/chai2010/webp and is lossless (VP8L) at quality 100 and lossy (VP8) otherwise.
+	Decoding of both bitstreams uses golang.org/x/image/webp.
+*/
+
+package dvid
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"io"
+
+	"github.com/chai2010/webp"
+	xwebp "golang.org/x/image/webp"
+)
+
+// GetWebP returns bytes in WebP format.  If lossless is false, the image is lossy encoded
+// with quality 1-100 where higher is better and quality 0 is DefaultJPEGQuality.
+func (img Image) GetWebP(quality int, lossless bool) ([]byte, error) {
+	if quality == 0 { // default
+		quality = DefaultJPEGQuality
+	}
+	if lossless {
+		quality = 100
+	}
+	var buffer bytes.Buffer
+	if err := EncodeWebP(&buffer, img.Get(), quality); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// EncodeWebP writes the image in WebP format.  A quality of 100 or more is lossless and
+// lower qualities, down to 1, are increasingly lossy.
+func EncodeWebP(w io.Writer, img image.Image, quality int) error {
+	if quality < 1 {
+		quality = 1
+	}
+	var data []byte
+	var err error
+	switch m := webpInput(img).(type) {
+	case *image.Gray:
+		if quality >= 100 {
+			data, err = webp.EncodeLosslessGray(m)
+		} else {
+			data, err = webp.EncodeGray(m, float32(quality))
+		}
+	default:
+		if quality >= 100 {
+			data, err = webp.EncodeExactLosslessRGBA(m)
+		} else {
+			data, err = webp.EncodeRGBA(m, float32(quality))
+		}
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// webpInput returns an *image.Gray for gray images and otherwise an *image.RGBA holding
+// non-premultiplied values, which is what libwebp expects.
+func webpInput(img image.Image) image.Image {
+	switch m := img.(type) {
+	case *image.Gray:
+		return m
+	case *image.Gray16:
+		gray := image.NewGray(m.Bounds())
+		draw.Draw(gray, gray.Bounds(), m, m.Bounds().Min, draw.Src)
+		return gray
+	}
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok {
+		nrgba = image.NewNRGBA(img.Bounds())
+		draw.Draw(nrgba, nrgba.Bounds(), img, img.Bounds().Min, draw.Src)
+	}
+	return &image.RGBA{Pix: nrgba.Pix, Stride: nrgba.Stride, Rect: nrgba.Rect}
+}
+
+// DecodeWebP decodes a lossless or lossy WebP image.  Opaque images whose pixels are all
+// gray are returned as *image.Gray and others as *image.NRGBA.
+func DecodeWebP(r io.Reader) (image.Image, error) {
+	img, err := xwebp.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+	nrgba := image.NewNRGBA(bounds)
+	switch m := img.(type) {
+	case *image.NYCbCrA:
+		webpYCbCrToNRGBA(nrgba, &m.YCbCr)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				nrgba.Pix[nrgba.PixOffset(x, y)+3] = m.A[m.AOffset(x, y)]
+			}
+		}
+	case *image.YCbCr:
+		webpYCbCrToNRGBA(nrgba, m)
+	default:
+		draw.Draw(nrgba, bounds, img, bounds.Min, draw.Src)
+	}
+
+	gray := image.NewGray(bounds)
+	for i := range gray.Pix {
+		p := nrgba.Pix[4*i : 4*i+4]
+		if p[3] != 255 || p[0] != p[1] || p[1] != p[2] {
+			return nrgba, nil
+		}
+		gray.Pix[i] = p[0]
+	}
+	return gray, nil
+}
+
+// webpYCbCrToNRGBA sets opaque pixels from the YUV of a lossy WebP image.  VP8 uses the
+// limited range ("studio swing") YUV of BT.601 while image.YCbCr assumes full range JFIF.
+func webpYCbCrToNRGBA(dst *image.NRGBA, src *image.YCbCr) {
+	clamp := func(v float64) uint8 {
+		if v <= 0 {
+			return 0
+		}
+		if v >= 255 {
+			return 255
+		}
+		return uint8(v + 0.5)
+	}
+	bounds := src.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			yy := 1.164 * (float64(src.Y[src.YOffset(x, y)]) - 16)
+			cOffset := src.COffset(x, y)
+			u := float64(src.Cb[cOffset]) - 128
+			v := float64(src.Cr[cOffset]) - 128
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = clamp(yy + 1.596*v)
+			dst.Pix[i+1] = clamp(yy - 0.391*u - 0.813*v)
+			dst.Pix[i+2] = clamp(yy + 2.018*u)
+			dst.Pix[i+3] = 255
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package dvid
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"testing"
+
+	"github.com/chai2010/webp"
+)
+
+// returns gray, color, and constant images for WebP tests.
+func webpTestImages() (gray *image.Gray, rgba *image.NRGBA, flat *image.Gray) {
+	gray = image.NewGray(image.Rect(0, 0, 37, 21))
+	for i := range gray.Pix {
+		gray.Pix[i] = uint8((i*i)%251 + i/40)
+	}
+	rgba = image.NewNRGBA(image.Rect(0, 0, 18, 33))
+	for y := 0; y < 33; y++ {
+		for x := 0; x < 18; x++ {
+			rgba.SetNRGBA(x, y, color.NRGBA{uint8(x * 13), uint8(y * 7), uint8(x * y), uint8(255 - x)})
+		}
+	}
+	flat = image.NewGray(image.Rect(0, 0, 64, 64))
+	return
+}
+
+// checks that two images have the same bounds and non-premultiplied pixel values.
+func checkSameImage(t *testing.T, name string, expected, got image.Image) {
+	if !got.Bounds().Eq(expected.Bounds()) {
+		t.Fatalf("%s: expected bounds %v, got %v", name, expected.Bounds(), got.Bounds())
+	}
+	b := expected.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			e := color.NRGBAModel.Convert(expected.At(x, y))
+			g := color.NRGBAModel.Convert(got.At(x, y))
+			if e != g {
+				t.Fatalf("%s at (%d,%d): expected %v, got %v", name, x, y, e, g)
+			}
+		}
+	}
+}
+
+func TestWebPRoundTrip(t *testing.T) {
+	gray, rgba, flat := webpTestImages()
+	for _, img := range []image.Image{gray, rgba, flat} {
+		var buf bytes.Buffer
+		if err := EncodeWebP(&buf, img, 100); err != nil {
+			t.Fatalf("error encoding WebP: %v", err)
+		}
+		if _, format, err := image.DecodeConfig(bytes.NewReader(buf.Bytes())); err != nil || format != "webp" {
+			t.Errorf("expected webp format, got %q: %v", format, err)
+		}
+		decoded, err := DecodeWebP(&buf)
+		if err != nil {
+			t.Fatalf("error decoding WebP: %v", err)
+		}
+		checkSameImage(t, "lossless WebP", img, decoded)
+	}
+	if _, isGray := mustDecodeWebP(t, gray, 100).(*image.Gray); !isGray {
+		t.Errorf("expected gray WebP to decode to *image.Gray")
+	}
+}
+
+func TestWebPLossy(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 50, 40))
+	seed := uint32(17)
+	for i := range img.Pix {
+		seed = seed*1103515245 + 12345
+		img.Pix[i] = uint8(i/10) + uint8(seed>>24)%8
+	}
+	var lossless, lossy bytes.Buffer
+	if err := EncodeWebP(&lossless, img, 100); err != nil {
+		t.Fatalf("error encoding WebP: %v", err)
+	}
+	if err := EncodeWebP(&lossy, img, 50); err != nil {
+		t.Fatalf("error encoding WebP: %v", err)
+	}
+	if chunk := string(lossy.Bytes()[12:16]); chunk != "VP8 " {
+		t.Errorf("expected lossy VP8 bitstream, got chunk %q", chunk)
+	}
+	if lossy.Len() >= lossless.Len() {
+		t.Errorf("expected lossy WebP (%d bytes) to be smaller than lossless (%d bytes)", lossy.Len(), lossless.Len())
+	}
+	decoded, err := DecodeWebP(&lossy)
+	if err != nil {
+		t.Fatalf("error decoding WebP: %v", err)
+	}
+	gray, ok := decoded.(*image.Gray)
+	if !ok {
+		t.Fatalf("expected gray lossy WebP to decode to *image.Gray, got %T", decoded)
+	}
+	var sumErr int
+	for i, v := range img.Pix {
+		diff := int(v) - int(gray.Pix[i])
+		if diff < 0 {
+			diff = -diff
+		}
+		sumErr += diff
+	}
+	if meanErr := float64(sumErr) / float64(len(img.Pix)); meanErr > 4 {
+		t.Errorf("expected mean error of lossy WebP to be at most 4, got %f", meanErr)
+	}
+}
+
+// Lossy WebP colors must match those decoded by libwebp, which upsamples chroma differently.
+func TestWebPLossyColor(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 48, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 48; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(40 + 4*x), uint8(200 - 5*y), uint8(100 + x + y), 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := EncodeWebP(&buf, img, 90); err != nil {
+		t.Fatalf("error encoding WebP: %v", err)
+	}
+	expected, err := webp.DecodeRGBA(buf.Bytes())
+	if err != nil {
+		t.Fatalf("libwebp can't decode WebP: %v", err)
+	}
+	decoded, err := DecodeWebP(&buf)
+	if err != nil {
+		t.Fatalf("error decoding WebP: %v", err)
+	}
+	got, ok := decoded.(*image.NRGBA)
+	if !ok {
+		t.Fatalf("expected color WebP to decode to *image.NRGBA, got %T", decoded)
+	}
+	for i, v := range expected.Pix {
+		diff := int(v) - int(got.Pix[i])
+		if diff < -6 || diff > 6 {
+			t.Fatalf("lossy WebP byte %d: libwebp decoded %d, got %d", i, v, got.Pix[i])
+		}
+	}
+}
+
+// WebP files encoded by libwebp must decode to their reference PNG images.
+func TestWebPReferenceFiles(t *testing.T) {
+	for _, name := range []string{"blue-purple-pink", "gopher-doc.2bpp"} {
+		f, err := os.Open("../test_data/" + name + ".lossless.webp")
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := DecodeWebP(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("error decoding libwebp file %s: %v", name, err)
+		}
+		f, err = os.Open("../test_data/" + name + ".png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := png.Decode(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkSameImage(t, name, expected, decoded)
+	}
+}
+
+func mustDecodeWebP(t *testing.T, img image.Image, quality int) image.Image {
+	var buf bytes.Buffer
+	if err := EncodeWebP(&buf, img, quality); err != nil {
+		t.Fatalf("error encoding WebP: %v", err)
+	}
+	decoded, err := DecodeWebP(&buf)
+	if err != nil {
+		t.Fatalf("error decoding WebP: %v", err)
+	}
+	return decoded
+}
@@ -60,6 +60,15 @@ go get github.com/zenazn/goji
 
 go get golang.org/x/net/context
 
+# x/image (WebP decoding)
+go get golang.org/x/image/webp
+
+# libwebp binding (WebP encoding)
+go get github.com/chai2010/webp
+
+# Apache Arrow (annotation bulk import/export)
+go get github.com/apache/arrow/go/v14/arrow
+
 # lumberjack
 go get gopkg.in/natefinch/lumberjack.v2
 
@@ -874,6 +874,15 @@ func BadRequest(w http.ResponseWriter, r *http.Request, format interface{}, args
 	http.Error(w, errorMsg, http.StatusBadRequest)
 }
 
+// PreconditionFailed writes an error message out to the http.ResponseWriter with a 412 status,
+// used when a conditional request like one with an If-Match header does not hold.
+func PreconditionFailed(w http.ResponseWriter, r *http.Request, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	errorMsg := fmt.Sprintf("%s (%s).", message, r.URL.Path)
+	dvid.Infof(errorMsg + "\n")
+	http.Error(w, errorMsg, http.StatusPreconditionFailed)
+}
+
 // DecodeJSON decodes JSON passed in a request into a dvid.Config.
 func DecodeJSON(r *http.Request) (dvid.Config, error) {
 	c := dvid.NewConfig()